@@ -4,10 +4,13 @@ package main
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
@@ -22,6 +25,7 @@ func readFileMetadata(path string) (title, artist, album, albumArtist, genre, co
 	file, err := os.Open(path)
 	if err != nil {
 		log.Printf("Error opening file for metadata %s: %v", path, err)
+		recordScanError(path, scanErrorOpen, err)
 		return
 	}
 	defer file.Close()
@@ -29,6 +33,9 @@ func readFileMetadata(path string) (title, artist, album, albumArtist, genre, co
 	if err != nil {
 		// No tags or unreadable tags; we will fallback to filename/path parsing below.
 		log.Printf("INFO: no readable tags for %s: %v", path, err)
+		if err != tag.ErrNoTagsFound {
+			recordScanError(path, scanErrorTag, err)
+		}
 	} else {
 		title = meta.Title()
 		artist = meta.Artist()
@@ -74,6 +81,17 @@ func readFileMetadata(path string) (title, artist, album, albumArtist, genre, co
 	return
 }
 
+// supportedAudioExts lists the file extensions the scanner imports. The server
+// is audio-only: video containers (.mp4, .mkv, .avi, ...) are deliberately not
+// listed so video files sitting in a library folder are skipped silently
+// instead of failing tag reads, and getVideos always returns an empty list.
+var supportedAudioExts = map[string]bool{".mp3": true, ".flac": true, ".m4a": true, ".ogg": true, ".wav": true, ".aiff": true, ".aac": true, ".opus": true}
+
+// isSupportedAudioFile reports whether path has an extension the scanner imports.
+func isSupportedAudioFile(path string) bool {
+	return supportedAudioExts[strings.ToLower(filepath.Ext(path))]
+}
+
 // isNumericString returns true if s consists only of digits.
 func isNumericString(s string) bool {
 	if s == "" {
@@ -128,13 +146,17 @@ func chooseAlbumArtist(albumArtist, artist string) string {
 	return albumArtist
 }
 
-func scanSingleLibrary(pathId int) {
+func scanSingleLibrary(gen int64, pathId int) {
+	defer recoverScanPanic("scanSingleLibrary", gen)
 	defer func() {
-		db.Exec("UPDATE scan_status SET is_scanning = 0, last_update_time = ? WHERE id = 1", time.Now().Format(time.RFC3339))
+		applyDuplicatePass(db)
 		invalidateArtistIDCache()
 		if err := RebuildLibraryIndex(db); err != nil {
 			log.Printf("RebuildLibraryIndex after single-library scan failed: %v", err)
 		}
+		invalidateBrowseCache()
+		// Released last, so no other scan starts while the index is rebuilt.
+		releaseScanStatus(db, gen)
 		log.Println("Single library scan process finished, final status updated.")
 	}()
 
@@ -147,15 +169,16 @@ func scanSingleLibrary(pathId int) {
 
 	log.Printf("Background scan started for single path: %s", path)
 	isScanCancelled.Store(false)
+	clearScanErrorsUnder(path)
 
 	// Initialize the scan counter for single path scan
-	db.Exec("UPDATE scan_status SET songs_added = 0, last_update_time = ? WHERE id = 1", time.Now().Format(time.RFC3339))
+	db.Exec("UPDATE scan_status SET songs_added = 0, stalled_at = NULL, last_update_time = ? WHERE id = 1", time.Now().Format(time.RFC3339))
 
 	scannedPaths := make(map[string]bool)
-	songsAdded := processPathWithTracking(path, &scannedPaths)
+	songsAdded := processPathWithTracking(gen, path, &scannedPaths)
 
 	// Remove songs that are in this library path but weren't found during scan
-	if !isScanCancelled.Load() {
+	if !scanCancelled(gen) {
 		removeMissingSongsFromPath(path, scannedPaths)
 	}
 
@@ -209,50 +232,33 @@ func scanSingleLibrary(pathId int) {
 	}
 	log.Printf("Database indexes verified/created successfully")
 
-	// also ensure FTS virtual table and triggers exist; harmless if already present.
-	// Drop and recreate triggers unconditionally so their body always matches the
-	// current code (older builds had a broken body referencing new.id/old.id).
-	_, err = db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS songs_fts USING fts5(title, artist, album, album_artist, content='songs', content_rowid='rowid');`)
-	if err != nil {
-		log.Printf("Warning: could not create songs_fts vtable: %v", err)
-	} else {
-		for _, trig := range []string{"songs_ai", "songs_au", "songs_ad"} {
-			_, _ = db.Exec(`DROP TRIGGER IF EXISTS ` + trig)
-		}
-		_, _ = db.Exec(`
-			CREATE TRIGGER songs_ai AFTER INSERT ON songs BEGIN
-				INSERT INTO songs_fts(rowid, title, artist, album, album_artist)
-				VALUES (new.rowid, new.title, new.artist, new.album, new.album_artist);
-			END;`)
-		_, _ = db.Exec(`
-			CREATE TRIGGER songs_au AFTER UPDATE ON songs BEGIN
-				UPDATE songs_fts SET title=new.title, artist=new.artist, album=new.album, album_artist=new.album_artist WHERE rowid=old.rowid;
-			END;`)
-		_, _ = db.Exec(`
-			CREATE TRIGGER songs_ad AFTER DELETE ON songs BEGIN
-				DELETE FROM songs_fts WHERE rowid=old.rowid;
-			END;`)
-	}
-
-	if isScanCancelled.Load() {
+	// Also ensure the FTS virtual table and triggers exist; harmless if already present.
+	ensureSongsFTS(db)
+
+	if scanCancelled(gen) {
 		log.Printf("Scan was cancelled for path %s. Songs added before stop: %d.", path, songsAdded)
 	} else {
 		log.Printf("Scan finished for path %s. Total songs added: %d.", path, songsAdded)
 	}
 }
 
-func scanAllLibraries() {
+func scanAllLibraries(gen int64) {
+	defer recoverScanPanic("scanAllLibraries", gen)
 	defer func() {
-		db.Exec("UPDATE scan_status SET is_scanning = 0, last_update_time = ? WHERE id = 1", time.Now().Format(time.RFC3339))
+		applyDuplicatePass(db)
 		invalidateArtistIDCache()
 		if err := RebuildLibraryIndex(db); err != nil {
 			log.Printf("RebuildLibraryIndex after full scan failed: %v", err)
 		}
+		invalidateBrowseCache()
+		// Released last, so no other scan starts while the index is rebuilt.
+		releaseScanStatus(db, gen)
 		log.Println("Finished scanning all libraries, final status updated.")
 	}()
 
 	log.Println("Background scan started for ALL library paths.")
 	isScanCancelled.Store(false)
+	clearScanErrors()
 
 	rows, err := db.Query("SELECT id, path FROM library_paths")
 	if err != nil {
@@ -268,23 +274,25 @@ func scanAllLibraries() {
 			log.Printf("Error scanning library path row for scan job: %v", err)
 			continue
 		}
+		// Paths saved before they were validated may carry a trailing separator
+		p.Path = filepath.Clean(p.Path)
 		pathsToScan = append(pathsToScan, p)
 	}
 
 	// Initialize the scan counter for "Scan All"
-	db.Exec("UPDATE scan_status SET songs_added = 0, last_update_time = ? WHERE id = 1", time.Now().Format(time.RFC3339))
+	db.Exec("UPDATE scan_status SET songs_added = 0, stalled_at = NULL, last_update_time = ? WHERE id = 1", time.Now().Format(time.RFC3339))
 
 	var totalSongsAdded int64
 	for _, p := range pathsToScan {
-		if isScanCancelled.Load() {
+		if scanCancelled(gen) {
 			log.Println("Scan All was cancelled, stopping further processing.")
 			break
 		}
 		scannedPaths := make(map[string]bool)
-		processPathWithRunningTotalAndTracking(p.Path, &totalSongsAdded, &scannedPaths)
+		processPathWithRunningTotalAndTracking(gen, p.Path, &totalSongsAdded, &scannedPaths)
 
 		// Remove songs that are in this library path but weren't found during scan
-		if !isScanCancelled.Load() {
+		if !scanCancelled(gen) {
 			removeMissingSongsFromPath(p.Path, scannedPaths)
 		}
 
@@ -293,7 +301,7 @@ func scanAllLibraries() {
 	}
 
 	// After scanning all paths, remove orphaned songs (songs that don't belong to any current library path)
-	if !isScanCancelled.Load() {
+	if !scanCancelled(gen) {
 		removeOrphanedSongs(pathsToScan)
 	}
 
@@ -345,27 +353,30 @@ func scanAllLibraries() {
 	log.Printf("Database indexes verified/created successfully")
 }
 
-func processPath(scanPath string) int64 {
+func processPath(gen int64, scanPath string) int64 {
 	var songsAdded int64
 	var filesSeen int64
 	var supportedSeen int64
 	log.Printf("Processing path: %s", scanPath)
 
-	walkErr := filepath.WalkDir(scanPath, func(path string, d os.DirEntry, err error) error {
-		if isScanCancelled.Load() {
+	ignore := scanIgnorePatterns()
+	walkErr := scanWalk(scanPath, func(path string, d os.DirEntry, err error) error {
+		if scanCancelled(gen) {
 			return errors.New("scan cancelled by user")
 		}
+		scanHeartbeat(gen)
 		if err != nil {
 			log.Printf("Error accessing path %q: %v\n", path, err)
+			recordScanError(path, scanErrorWalk, err)
 			return nil
 		}
+		if skip, err := skipIgnoredEntry(ignore, scanPath, path, d); skip {
+			return err
+		}
 
 		if !d.IsDir() {
 			filesSeen++
-			ext := strings.ToLower(filepath.Ext(path))
-			supportedExts := map[string]bool{".mp3": true, ".flac": true, ".m4a": true, ".ogg": true, ".wav": true, ".aiff": true, ".aac": true, ".opus": true}
-
-			if supportedExts[ext] {
+			if isSupportedAudioFile(path) {
 				supportedSeen++
 				file, err := os.Open(path)
 				if err != nil {
@@ -402,7 +413,8 @@ func processPath(scanPath string) int64 {
 				// Use INSERT ... ON CONFLICT to update existing songs or insert new ones
 				// This ensures date_added is set for old songs missing it, and date_updated is always current
 				// Mark as not cancelled when re-adding
-				albumPath := filepath.Dir(path) // Store directory path for grouping
+				albumPath := songAlbumPath(path) // Store directory path for grouping; see album_discs.go
+				disc = songDiscNumber(path, disc)
 
 				// Normalize unknown/numeric-only artist/album to "Unknown"
 				if artist == "" || isNumericString(artist) {
@@ -420,10 +432,10 @@ func processPath(scanPath string) int64 {
 						album_artist=excluded.album_artist,
 						album=excluded.album,
 						album_path=excluded.album_path, 
-						genre=excluded.genre,
+						genre=`+scannedGenreSQL+`,
 						duration=excluded.duration,
 						track=excluded.track,
-						year=excluded.year,
+						year=`+scannedYearSQL+`,
 						disc_number=excluded.disc_number,
 						size=excluded.size,
 						bitrate=excluded.bitrate,
@@ -459,26 +471,29 @@ func processPath(scanPath string) int64 {
 	return songsAdded
 }
 
-func processPathWithRunningTotal(scanPath string, totalSongsAdded *int64) {
+func processPathWithRunningTotal(gen int64, scanPath string, totalSongsAdded *int64) {
 	var filesSeen int64
 	var supportedSeen int64
 	log.Printf("Processing path: %s", scanPath)
 
-	walkErr := filepath.WalkDir(scanPath, func(path string, d os.DirEntry, err error) error {
-		if isScanCancelled.Load() {
+	ignore := scanIgnorePatterns()
+	walkErr := scanWalk(scanPath, func(path string, d os.DirEntry, err error) error {
+		if scanCancelled(gen) {
 			return errors.New("scan cancelled by user")
 		}
+		scanHeartbeat(gen)
 		if err != nil {
 			log.Printf("Error accessing path %q: %v\n", path, err)
+			recordScanError(path, scanErrorWalk, err)
 			return nil
 		}
+		if skip, err := skipIgnoredEntry(ignore, scanPath, path, d); skip {
+			return err
+		}
 
 		if !d.IsDir() {
 			filesSeen++
-			ext := strings.ToLower(filepath.Ext(path))
-			supportedExts := map[string]bool{".mp3": true, ".flac": true, ".m4a": true, ".ogg": true, ".wav": true, ".aiff": true, ".aac": true, ".opus": true}
-
-			if supportedExts[ext] {
+			if isSupportedAudioFile(path) {
 				supportedSeen++
 				file, err := os.Open(path)
 				if err != nil {
@@ -513,7 +528,8 @@ func processPathWithRunningTotal(scanPath string, totalSongsAdded *int64) {
 				}
 
 				// Use UPSERT to update existing songs or insert new ones
-				albumPath := filepath.Dir(path) // Store directory path for grouping
+				albumPath := songAlbumPath(path) // Store directory path for grouping; see album_discs.go
+				disc = songDiscNumber(path, disc)
 
 				// Normalize unknown/numeric-only artist/album to "Unknown"
 				if artist == "" || isNumericString(artist) {
@@ -531,10 +547,10 @@ func processPathWithRunningTotal(scanPath string, totalSongsAdded *int64) {
 						album_artist=excluded.album_artist,
 						album=excluded.album,
 						album_path=excluded.album_path, 
-						genre=excluded.genre,
+						genre=`+scannedGenreSQL+`,
 						duration=excluded.duration,
 						track=excluded.track,
-						year=excluded.year,
+						year=`+scannedYearSQL+`,
 						disc_number=excluded.disc_number,
 						size=excluded.size,
 						bitrate=excluded.bitrate,
@@ -569,178 +585,166 @@ func processPathWithRunningTotal(scanPath string, totalSongsAdded *int64) {
 	log.Printf("Scan summary for %s: filesSeen=%d supported=%d totalSongsAdded=%d", scanPath, filesSeen, supportedSeen, *totalSongsAdded)
 }
 
-func processPathWithTracking(scanPath string, scannedPaths *map[string]bool) int64 {
+// upsertSongFile reads the tags and audio properties of one supported file and
+// inserts or updates its songs row, reusing the song id when the path is
+// already known. Waveform peaks are only computed for new songs.
+func upsertSongFile(path string) (sql.Result, error) {
+	// Read metadata with centralized fallbacks
+	title, artist, album, albumArtist, genre, comment, track, year, disc := readFileMetadata(path)
+
+	currentTime := time.Now().Format(time.RFC3339)
+	if genre == "" {
+		genre = "Unknown"
+	}
+
+	// Fallback to filename parsing if metadata is empty (like Navidrome does)
+	// Priority: 1. Metadata tags, 2. Filename parsing, 3. Folder structure
+	if title == "" {
+		title = extractTitleFromFilename(path)
+		log.Printf("📝 No title metadata, parsed from filename: '%s' from %s", title, filepath.Base(path))
+	}
+	if artist == "" {
+		artist = extractArtistFromPath(path)
+		if artist != "" {
+			log.Printf("🎤 No artist metadata, parsed: '%s' from %s", artist, filepath.Base(path))
+		}
+	}
+	if album == "" {
+		// Pass artist to remove redundant "Artist - Album" patterns
+		album = extractAlbumFromPath(path, artist)
+		if album != "" {
+			log.Printf("💿 No album metadata, parsed: '%s' from folder: %s", album, filepath.Base(filepath.Dir(path)))
+		}
+	}
+	// Normalize unknown/numeric-only artist/album to "Unknown"
+	if artist == "" || isNumericString(artist) {
+		artist = "Unknown Artist"
+	}
+	if album == "" || isNumericString(album) {
+		album = "Unknown Album"
+	}
+	// Ensure album artist is canonicalized to match artist
+	normalizeArtistAndAlbumArtist(&artist, &albumArtist)
+	// Get duration using ffprobe
+	audioProps := getAudioProperties(path)
+	duration := audioProps.Duration
+
+	// Check if song already exists (by path) to reuse UUID
+	existingID, err := GetSongIDByPath(db, path)
+
+	var songID string
+	var shouldComputeWaveform bool
+	if err == sql.ErrNoRows {
+		// New song - generate UUID and compute waveform
+		songID = GenerateBase62UUID()
+		shouldComputeWaveform = true
+	} else if err != nil {
+		return nil, fmt.Errorf("checking for existing song: %w", err)
+	} else {
+		// Existing song (rescan) - reuse UUID, DON'T recompute waveform
+		songID = existingID
+		shouldComputeWaveform = false
+	}
+
+	// Pre-compute waveform ONLY for new songs
+	var waveformPeaks string
+	if shouldComputeWaveform {
+		waveformData, err := generateWaveformPeaks(path)
+		if err != nil {
+			log.Printf("⚠️  Failed to generate waveform for %s: %v", filepath.Base(path), err)
+			// Continue without waveform, not a fatal error
+		} else {
+			waveformPeaks = waveformData
+		}
+	}
+
+	// Use UPSERT to update existing songs or insert new ones
+	albumPath := songAlbumPath(path) // Store directory path for grouping; see album_discs.go
+	disc = songDiscNumber(path, disc)
+	var res sql.Result
+	if shouldComputeWaveform && waveformPeaks != "" {
+		// NEW song: Insert with waveform
+		res, err = db.Exec(`INSERT INTO songs (id, title, artist, album, album_artist, path, album_path, genre, duration, track, year, disc_number, size, bitrate, sample_rate, channels, bit_depth, comment, date_added, date_updated, waveform_peaks, cancelled) 
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)
+			ON CONFLICT(path) DO UPDATE SET 
+				title=excluded.title, 
+				artist=excluded.artist, 
+				album=excluded.album,
+				album_artist=excluded.album_artist,
+				album_path=excluded.album_path, 
+				genre=`+scannedGenreSQL+`,
+				duration=excluded.duration,
+				track=excluded.track,
+				year=`+scannedYearSQL+`,
+				disc_number=excluded.disc_number,
+				size=excluded.size,
+				bitrate=excluded.bitrate,
+				sample_rate=excluded.sample_rate,
+				channels=excluded.channels,
+				bit_depth=excluded.bit_depth,
+				comment=excluded.comment,
+				date_added=COALESCE(songs.date_added, excluded.date_added),
+				date_updated=excluded.date_updated,
+				waveform_peaks=excluded.waveform_peaks,
+				cancelled=0`,
+			songID, title, artist, album, albumArtist, path, albumPath, genre, duration, track, year, disc, audioProps.Size, audioProps.BitRate, audioProps.SamplingRate, audioProps.ChannelCount, audioProps.BitDepth, comment, currentTime, currentTime, waveformPeaks)
+	} else {
+		// EXISTING song (rescan) or new song without waveform: Preserve existing waveform
+		res, err = db.Exec(`INSERT INTO songs (id, title, artist, album, album_artist, path, album_path, genre, duration, track, year, disc_number, size, bitrate, sample_rate, channels, bit_depth, comment, date_added, date_updated, cancelled) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)
+			ON CONFLICT(path) DO UPDATE SET 
+				title=excluded.title, 
+				artist=excluded.artist, 
+				album=excluded.album,
+				album_path=excluded.album_path, 
+				genre=`+scannedGenreSQL+`,
+				duration=excluded.duration,
+				track=excluded.track,
+				year=`+scannedYearSQL+`,
+				disc_number=excluded.disc_number,
+				size=excluded.size,
+				bitrate=excluded.bitrate,
+				sample_rate=excluded.sample_rate,
+				channels=excluded.channels,
+				bit_depth=excluded.bit_depth,
+				comment=excluded.comment,
+				date_added=COALESCE(songs.date_added, excluded.date_added),
+				date_updated=excluded.date_updated,
+				cancelled=0`,
+			songID, title, artist, album, albumArtist, path, albumPath, genre, duration, track, year, disc, audioProps.Size, audioProps.BitRate, audioProps.SamplingRate, audioProps.ChannelCount, audioProps.BitDepth, comment, currentTime, currentTime)
+	}
+	return res, err
+}
+
+func processPathWithTracking(gen int64, scanPath string, scannedPaths *map[string]bool) int64 {
 	var songsAdded int64
 	var filesSeen int64
 	var supportedSeen int64
 	log.Printf("Processing path with tracking: %s", scanPath)
 
-	walkErr := filepath.WalkDir(scanPath, func(path string, d os.DirEntry, err error) error {
-		if isScanCancelled.Load() {
+	ignore := scanIgnorePatterns()
+	walkErr := scanWalk(scanPath, func(path string, d os.DirEntry, err error) error {
+		if scanCancelled(gen) {
 			return errors.New("scan cancelled by user")
 		}
+		scanHeartbeat(gen)
 		if err != nil {
 			log.Printf("Error accessing path %q: %v\n", path, err)
+			recordScanError(path, scanErrorWalk, err)
 			return nil
 		}
+		if skip, err := skipIgnoredEntry(ignore, scanPath, path, d); skip {
+			return err
+		}
 
 		if !d.IsDir() {
 			filesSeen++
-			ext := strings.ToLower(filepath.Ext(path))
-			supportedExts := map[string]bool{".mp3": true, ".flac": true, ".m4a": true, ".ogg": true, ".wav": true, ".aiff": true, ".aac": true, ".opus": true}
-
-			if supportedExts[ext] {
+			if isSupportedAudioFile(path) {
 				supportedSeen++
 				// Track this file path
 				(*scannedPaths)[path] = true
 
-				// Read metadata with centralized fallbacks
-				title, artist, album, albumArtist, genre, comment, track, year, disc := readFileMetadata(path)
-
-				currentTime := time.Now().Format(time.RFC3339)
-				if genre == "" {
-					genre = "Unknown"
-				}
-
-				// Fallback to filename parsing if metadata is empty (like Navidrome does)
-				// Priority: 1. Metadata tags, 2. Filename parsing, 3. Folder structure
-				if title == "" {
-					title = extractTitleFromFilename(path)
-					log.Printf("📝 No title metadata, parsed from filename: '%s' from %s", title, filepath.Base(path))
-				}
-				if artist == "" {
-					artist = extractArtistFromPath(path)
-					if artist != "" {
-						log.Printf("🎤 No artist metadata, parsed: '%s' from %s", artist, filepath.Base(path))
-					}
-				}
-				if album == "" {
-					// Pass artist to remove redundant "Artist - Album" patterns
-					album = extractAlbumFromPath(path, artist)
-					if album != "" {
-						log.Printf("💿 No album metadata, parsed: '%s' from folder: %s", album, filepath.Base(filepath.Dir(path)))
-					}
-				}
-				// Normalize unknown/numeric-only artist/album to "Unknown"
-				if artist == "" || isNumericString(artist) {
-					artist = "Unknown Artist"
-				}
-				if album == "" || isNumericString(album) {
-					album = "Unknown Album"
-				}
-				// Ensure album artist is canonicalized to match artist
-				normalizeArtistAndAlbumArtist(&artist, &albumArtist)
-				// Get duration using ffprobe
-				audioProps := getAudioProperties(path)
-				duration := audioProps.Duration
-
-				// DEBUG: Log the first few songs being inserted
-				if songsAdded < 3 {
-					log.Printf("DEBUG [processPathWithTracking]: Inserting song #%d: title='%s', artist='%s', album='%s', duration=%ds",
-						songsAdded+1, title, artist, album, duration)
-				}
-
-				// Check if song already exists (by path) to reuse UUID
-				existingID, err := GetSongIDByPath(db, path)
-
-				var songID string
-				var shouldComputeWaveform bool
-				if err == sql.ErrNoRows {
-					// New song - generate UUID and compute waveform
-					songID = GenerateBase62UUID()
-					shouldComputeWaveform = true
-				} else if err != nil {
-					log.Printf("Error checking for existing song: %v", err)
-					return nil
-				} else {
-					// Existing song (rescan) - reuse UUID, DON'T recompute waveform
-					songID = existingID
-					shouldComputeWaveform = false
-				}
-
-				// Pre-compute waveform ONLY for new songs
-				var waveformPeaks string
-				if shouldComputeWaveform {
-					waveformData, err := generateWaveformPeaks(path)
-					if err != nil {
-						log.Printf("⚠️  Failed to generate waveform for %s: %v", filepath.Base(path), err)
-						// Continue without waveform, not a fatal error
-					} else {
-						waveformPeaks = waveformData
-						if songsAdded < 3 {
-							log.Printf("🌊 Pre-computed waveform for NEW song #%d", songsAdded+1)
-						}
-					}
-				}
-
-				// Use UPSERT to update existing songs or insert new ones
-				albumPath := filepath.Dir(path) // Store directory path for grouping
-				// Normalize unknown/numeric-only artist/album to "Unknown"
-				if artist == "" || isNumericString(artist) {
-					artist = "Unknown Artist"
-				}
-				if album == "" || isNumericString(album) {
-					album = "Unknown Album"
-				}
-				if artist == "" || isNumericString(artist) {
-					artist = "Unknown Artist"
-				}
-				if album == "" || isNumericString(album) {
-					album = "Unknown Album"
-				}
-				var res sql.Result
-				if shouldComputeWaveform && waveformPeaks != "" {
-					// NEW song: Insert with waveform
-					res, err = db.Exec(`INSERT INTO songs (id, title, artist, album, album_artist, path, album_path, genre, duration, track, year, disc_number, size, bitrate, sample_rate, channels, bit_depth, comment, date_added, date_updated, waveform_peaks, cancelled) 
-						VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)
-						ON CONFLICT(path) DO UPDATE SET 
-							title=excluded.title, 
-							artist=excluded.artist, 
-							album=excluded.album,
-							album_artist=excluded.album_artist,
-							album_path=excluded.album_path, 
-							genre=excluded.genre,
-							duration=excluded.duration,
-							track=excluded.track,
-							year=excluded.year,
-							disc_number=excluded.disc_number,
-							size=excluded.size,
-							bitrate=excluded.bitrate,
-							sample_rate=excluded.sample_rate,
-							channels=excluded.channels,
-							bit_depth=excluded.bit_depth,
-							comment=excluded.comment,
-							date_added=COALESCE(songs.date_added, excluded.date_added),
-							date_updated=excluded.date_updated,
-							waveform_peaks=excluded.waveform_peaks,
-							cancelled=0`,
-						songID, title, artist, album, albumArtist, path, albumPath, genre, duration, track, year, disc, audioProps.Size, audioProps.BitRate, audioProps.SamplingRate, audioProps.ChannelCount, audioProps.BitDepth, comment, currentTime, currentTime, waveformPeaks)
-				} else {
-					// EXISTING song (rescan) or new song without waveform: Preserve existing waveform
-					res, err = db.Exec(`INSERT INTO songs (id, title, artist, album, album_artist, path, album_path, genre, duration, track, year, disc_number, size, bitrate, sample_rate, channels, bit_depth, comment, date_added, date_updated, cancelled) 
-					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)
-						ON CONFLICT(path) DO UPDATE SET 
-							title=excluded.title, 
-							artist=excluded.artist, 
-							album=excluded.album,
-							album_path=excluded.album_path, 
-							genre=excluded.genre,
-							duration=excluded.duration,
-							track=excluded.track,
-							year=excluded.year,
-							disc_number=excluded.disc_number,
-							size=excluded.size,
-							bitrate=excluded.bitrate,
-							sample_rate=excluded.sample_rate,
-							channels=excluded.channels,
-							bit_depth=excluded.bit_depth,
-							comment=excluded.comment,
-							date_added=COALESCE(songs.date_added, excluded.date_added),
-							date_updated=excluded.date_updated,
-							cancelled=0`,
-						songID, title, artist, album, albumArtist, path, albumPath, genre, duration, track, year, disc, audioProps.Size, audioProps.BitRate, audioProps.SamplingRate, audioProps.ChannelCount, audioProps.BitDepth, comment, currentTime, currentTime)
-				}
-
+				res, err := upsertSongFile(path)
 				if err != nil {
 					log.Printf("Error upserting song from %s into DB: %v", path, err)
 					return nil
@@ -775,26 +779,29 @@ func processPathWithTracking(scanPath string, scannedPaths *map[string]bool) int
 	return songsAdded
 }
 
-func processPathWithRunningTotalAndTracking(scanPath string, totalSongsAdded *int64, scannedPaths *map[string]bool) {
+func processPathWithRunningTotalAndTracking(gen int64, scanPath string, totalSongsAdded *int64, scannedPaths *map[string]bool) {
 	var filesSeen int64
 	var supportedSeen int64
 	log.Printf("Processing path with running total and tracking: %s", scanPath)
 
-	walkErr := filepath.WalkDir(scanPath, func(path string, d os.DirEntry, err error) error {
-		if isScanCancelled.Load() {
+	ignore := scanIgnorePatterns()
+	walkErr := scanWalk(scanPath, func(path string, d os.DirEntry, err error) error {
+		if scanCancelled(gen) {
 			return errors.New("scan cancelled by user")
 		}
+		scanHeartbeat(gen)
 		if err != nil {
 			log.Printf("Error accessing path %q: %v\n", path, err)
+			recordScanError(path, scanErrorWalk, err)
 			return nil
 		}
+		if skip, err := skipIgnoredEntry(ignore, scanPath, path, d); skip {
+			return err
+		}
 
 		if !d.IsDir() {
 			filesSeen++
-			ext := strings.ToLower(filepath.Ext(path))
-			supportedExts := map[string]bool{".mp3": true, ".flac": true, ".m4a": true, ".ogg": true, ".wav": true, ".aiff": true, ".aac": true, ".opus": true}
-
-			if supportedExts[ext] {
+			if isSupportedAudioFile(path) {
 				supportedSeen++
 				// Track this file path
 				(*scannedPaths)[path] = true
@@ -874,7 +881,8 @@ func processPathWithRunningTotalAndTracking(scanPath string, totalSongsAdded *in
 				}
 
 				// Use UPSERT to update existing songs or insert new ones
-				albumPath := filepath.Dir(path) // Store directory path for grouping
+				albumPath := songAlbumPath(path) // Store directory path for grouping; see album_discs.go
+				disc = songDiscNumber(path, disc)
 
 				var res sql.Result
 				if shouldComputeWaveform && waveformPeaks != "" {
@@ -887,10 +895,10 @@ func processPathWithRunningTotalAndTracking(scanPath string, totalSongsAdded *in
 							album=excluded.album,
 							album_artist=excluded.album_artist,
 							album_path=excluded.album_path, 
-							genre=excluded.genre,
+							genre=`+scannedGenreSQL+`,
 							duration=excluded.duration,
 							track=excluded.track,
-							year=excluded.year,
+							year=`+scannedYearSQL+`,
 							disc_number=excluded.disc_number,
 							size=excluded.size,
 							bitrate=excluded.bitrate,
@@ -912,10 +920,10 @@ func processPathWithRunningTotalAndTracking(scanPath string, totalSongsAdded *in
 							artist=excluded.artist, 
 							album=excluded.album,
 							album_path=excluded.album_path, 
-							genre=excluded.genre,
+							genre=`+scannedGenreSQL+`,
 							duration=excluded.duration,
 							track=excluded.track,
-							year=excluded.year,
+							year=`+scannedYearSQL+`,
 							disc_number=excluded.disc_number,
 							size=excluded.size,
 							bitrate=excluded.bitrate,
@@ -963,17 +971,10 @@ func processPathWithRunningTotalAndTracking(scanPath string, totalSongsAdded *in
 }
 
 func removeMissingSongsFromPath(libraryPath string, scannedPaths map[string]bool) {
-	// Normalize path for comparison
-	searchPath := libraryPath
-	if !strings.HasSuffix(searchPath, "/") && !strings.HasSuffix(searchPath, "\\") {
-		searchPath += string(filepath.Separator)
-	}
-	likePath := searchPath + "%"
-
 	log.Printf("Checking for missing songs in path: %s", libraryPath)
 
 	// Get all songs from database that belong to this library path and are not cancelled
-	rows, err := db.Query("SELECT id, path FROM songs WHERE path LIKE ? AND cancelled = 0", likePath)
+	rows, err := db.Query("SELECT id, path FROM songs WHERE "+songUnderPathClause+" AND cancelled = 0", songPathPattern(libraryPath))
 	if err != nil {
 		log.Printf("Error querying songs for cleanup: %v", err)
 		return
@@ -1002,7 +1003,7 @@ func removeMissingSongsFromPath(libraryPath string, scannedPaths map[string]bool
 
 		for _, songID := range songsToCancel {
 			// Mark the song as cancelled instead of deleting
-			_, err := db.Exec("UPDATE songs SET cancelled = 1 WHERE id = ?", songID)
+			_, err := db.Exec("UPDATE songs SET cancelled = 1, cancel_reason = ? WHERE id = ?", cancelReasonMissing, songID)
 			if err != nil {
 				log.Printf("Error marking song %s as cancelled: %v", songID, err)
 			}
@@ -1037,12 +1038,7 @@ func removeOrphanedSongs(activePaths []LibraryPath) {
 		// Check if this song belongs to any active library path
 		belongsToActiveLibrary := false
 		for _, libraryPath := range activePaths {
-			// Normalize paths for comparison (handle both / and \ separators)
-			normalizedLibPath := filepath.Clean(libraryPath.Path)
-			normalizedSongPath := filepath.Clean(songPath)
-
-			// Check if song path starts with library path
-			if strings.HasPrefix(normalizedSongPath, normalizedLibPath) {
+			if songUnderPath(songPath, libraryPath.Path) {
 				belongsToActiveLibrary = true
 				break
 			}
@@ -1061,7 +1057,7 @@ func removeOrphanedSongs(activePaths []LibraryPath) {
 
 		for _, songID := range orphanedSongs {
 			// Mark the song as cancelled instead of deleting
-			_, err := db.Exec("UPDATE songs SET cancelled = 1 WHERE id = ?", songID)
+			_, err := db.Exec("UPDATE songs SET cancelled = 1, cancel_reason = ? WHERE id = ?", cancelReasonOrphaned, songID)
 			if err != nil {
 				log.Printf("Error marking orphaned song %s as cancelled: %v", songID, err)
 			}
@@ -1075,16 +1071,11 @@ func removeOrphanedSongs(activePaths []LibraryPath) {
 
 func updateSongCountForPath(path string, pathId int) {
 	var count int
-	// Ensure path ends with / for proper pattern matching
-	searchPath := path
-	if !strings.HasSuffix(searchPath, "/") {
-		searchPath += "/"
-	}
-	likePath := searchPath + "%"
+	likePath := songPathPattern(path)
 
 	log.Printf("DEBUG: Counting songs for path '%s' using pattern '%s'", path, likePath)
 	// Only count non-cancelled songs
-	err := db.QueryRow("SELECT COUNT(*) FROM songs WHERE path LIKE ? AND cancelled = 0", likePath).Scan(&count)
+	err := db.QueryRow("SELECT COUNT(*) FROM songs WHERE "+songUnderPathClause+" AND cancelled = 0", likePath).Scan(&count)
 	if err != nil {
 		log.Printf("Error counting songs for path %s: %v", path, err)
 		return
@@ -1108,7 +1099,25 @@ func browseFiles(c *gin.Context) {
 		path += "\\"
 	}
 
-	dirEntries, err := os.ReadDir(path)
+	if hasDotDot(path) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Path must not contain '..'"})
+		return
+	}
+	absPath, err := filepath.Abs(path)
+	if err == nil {
+		absPath, err = filepath.EvalSymlinks(absPath)
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Could not read directory: " + err.Error()})
+		return
+	}
+	inside, toward := browseAccess(absPath, browseRoots())
+	if !inside && len(toward) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Path is outside the allowed browse roots (set BROWSE_ROOTS to change them)"})
+		return
+	}
+
+	dirEntries, err := os.ReadDir(absPath)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not read directory: " + err.Error()})
 		return
@@ -1116,6 +1125,9 @@ func browseFiles(c *gin.Context) {
 
 	var items []FileItem
 	for _, entry := range dirEntries {
+		if !inside && !slices.Contains(toward, entry.Name()) {
+			continue
+		}
 		if entry.IsDir() {
 			items = append(items, FileItem{Name: entry.Name(), Type: "dir"})
 		}
@@ -1129,68 +1141,98 @@ func cancelAdminScan(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Scan cancellation signal sent."})
 }
 
+// rescanAllLibraries rescans every library path in the background. The scan
+// upserts songs by path, so existing songs keep their ids and with them their
+// stars, play history and playlist entries; songs whose file is gone are
+// marked cancelled (see removeMissingSongsFromPath). With wipe=true the songs
+// and everything hanging off them are deleted first, for a clean slate.
 func rescanAllLibraries(c *gin.Context) {
-	// Check if scan is already running
-	var isScanning bool
-	err := db.QueryRow("SELECT is_scanning FROM scan_status WHERE id = 1").Scan(&isScanning)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error checking scan status"})
-		return
-	}
+	wipe := c.Query("wipe") == "true"
 
-	if isScanning {
+	gen, ok := claimScanStatus(db)
+	if !ok {
 		c.JSON(http.StatusConflict, gin.H{"error": "A scan is already running"})
 		return
 	}
 
-	// Create a pre-rescan backup, then clear the database
+	// Create a pre-rescan backup before touching anything
 	dbPath := getEnv("DATABASE_PATH", "/config/music.db")
 	if err := performBackup(db, dbPath); err != nil {
 		log.Printf("Error: pre-rescan backup failed: %v", err)
+		releaseScanStatus(db, gen)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Pre-rescan backup failed; aborting rescan"})
 		return
 	}
-	// Clear the database first
-	log.Println("Starting full library rescan - clearing existing data...")
 
-	// Delete all songs and related data
-	_, err = db.Exec("DELETE FROM playlist_songs")
-	if err != nil {
-		log.Printf("Warning: Could not clear playlist_songs: %v", err)
+	if wipe {
+		if err := wipeLibrary(); err != nil {
+			log.Printf("Error clearing songs table: %v", err)
+			releaseScanStatus(db, gen)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear songs database"})
+			return
+		}
+		log.Println("Database cleared. Starting fresh scan...")
+	} else {
+		log.Println("Starting full library rescan, keeping existing songs...")
 	}
 
-	_, err = db.Exec("DELETE FROM starred_songs")
-	if err != nil {
-		log.Printf("Warning: Could not clear starred_songs: %v", err)
-	}
+	// Start the scan in background
+	go scanAllLibraries(gen)
 
-	_, err = db.Exec("DELETE FROM songs")
-	if err != nil {
-		log.Printf("Error clearing songs table: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear songs database"})
-		return
-	}
+	c.JSON(http.StatusOK, gin.H{"message": "Full library rescan started successfully", "wipe": wipe})
+}
 
+// wipeLibrary deletes all songs and the rows that reference them.
+func wipeLibrary() error {
+	log.Println("Starting full library rescan - clearing existing data...")
+	for _, table := range songDependentTables {
+		if _, err := db.Exec("DELETE FROM " + table); err != nil {
+			log.Printf("Warning: Could not clear %s: %v", table, err)
+		}
+	}
+	if _, err := db.Exec("DELETE FROM songs"); err != nil {
+		return err
+	}
 	// Reset library path song counts
-	_, err = db.Exec("UPDATE library_paths SET song_count = 0, last_scan_ended = NULL")
-	if err != nil {
+	if _, err := db.Exec("UPDATE library_paths SET song_count = 0, last_scan_ended = NULL"); err != nil {
 		log.Printf("Warning: Could not reset library_paths: %v", err)
 	}
+	return nil
+}
 
-	log.Println("Database cleared. Starting fresh scan...")
-
-	// Mark scan as started
-	_, err = db.Exec("UPDATE scan_status SET is_scanning = 1, songs_added = 0, last_update_time = ? WHERE id = 1",
-		time.Now().Format(time.RFC3339))
+// rescanLibraryPath rescans a single library path in the background and
+// returns immediately.
+func rescanLibraryPath(c *gin.Context) {
+	pathID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scan status"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid library path id"})
+		return
+	}
+	var path string
+	if err := db.QueryRow("SELECT path FROM library_paths WHERE id = ?", pathID).Scan(&path); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Library path not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	// Start the scan in background
-	go scanAllLibraries()
+	gen, ok := claimScanStatus(db)
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "A scan is already running"})
+		return
+	}
+	dbPath := getEnv("DATABASE_PATH", "/config/music.db")
+	if err := performBackup(db, dbPath); err != nil {
+		log.Printf("Error: pre-scan backup failed: %v", err)
+		releaseScanStatus(db, gen)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Pre-scan backup failed; aborting scan"})
+		return
+	}
+
+	go scanSingleLibrary(gen, pathID)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Full library rescan started successfully"})
+	c.JSON(http.StatusAccepted, gin.H{"message": "Scan of " + path + " started", "pathId": pathID})
 }
 
 // backfillAlbumArtists endpoint removed at user's request.
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scanTestDB returns a file database with the tables the scanners write to,
+// installed as the global db for the duration of the test.
+func scanTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	d := fileSearchTestDB(t)
+	for _, stmt := range []string{
+		`CREATE TABLE configuration (key TEXT PRIMARY KEY NOT NULL, value TEXT)`,
+		`CREATE TABLE library_paths (id INTEGER PRIMARY KEY, path TEXT UNIQUE NOT NULL, song_count INTEGER NOT NULL DEFAULT 0, last_scan_ended TEXT, scan_schedule TEXT)`,
+		`CREATE TABLE scan_status (id INTEGER PRIMARY KEY, is_scanning INTEGER NOT NULL DEFAULT 0, songs_added INTEGER NOT NULL DEFAULT 0, last_update_time TEXT, stalled_at TEXT, scan_generation INTEGER NOT NULL DEFAULT 0)`,
+		`INSERT INTO scan_status (id) VALUES (1)`,
+		`CREATE TABLE scan_errors (path TEXT NOT NULL, category TEXT NOT NULL, error TEXT NOT NULL, occurred_at TEXT NOT NULL, PRIMARY KEY (path, category))`,
+		`ALTER TABLE songs ADD COLUMN date_updated TEXT`,
+		`ALTER TABLE songs ADD COLUMN waveform_peaks TEXT`,
+		`CREATE UNIQUE INDEX idx_songs_path ON songs(path)`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Scans read catalog overrides; see library_catalog_import.go.
+	if err := ensureSongTagOverridesTable(d); err != nil {
+		t.Fatal(err)
+	}
+	old := db
+	db = d
+	t.Cleanup(func() {
+		db = old
+		d.Close()
+	})
+	return d
+}
+
+func TestProcessPathWithRunningTotalUpdatesScanStatus(t *testing.T) {
+	d := scanTestDB(t)
+	lib := t.TempDir()
+	for _, name := range []string{"01 - One.mp3", "02 - Two.flac", "cover.jpg"} {
+		if err := os.WriteFile(filepath.Join(lib, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Start from a non-zero total, as "Scan All" does for every path after the first.
+	total := int64(5)
+	processPathWithRunningTotal(0, lib, &total)
+	if total != 7 {
+		t.Fatalf("total = %d, want 7", total)
+	}
+	var songsAdded int64
+	if err := d.QueryRow(`SELECT songs_added FROM scan_status WHERE id = 1`).Scan(&songsAdded); err != nil {
+		t.Fatal(err)
+	}
+	if songsAdded != total {
+		t.Fatalf("scan_status.songs_added = %d, want %d", songsAdded, total)
+	}
+}
+
+func TestRescanLibraryPath(t *testing.T) {
+	d := scanTestDB(t)
+	lib := t.TempDir()
+	if err := os.WriteFile(filepath.Join(lib, "01 - One.mp3"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Exec(`INSERT INTO library_paths (id, path) VALUES (3, ?)`, lib); err != nil {
+		t.Fatal(err)
+	}
+	setBackupTestPath(t)
+
+	r := gin.New()
+	r.POST("/scan/path/:id", rescanLibraryPath)
+	post := func(id string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/scan/path/"+id, nil))
+		return w.Code
+	}
+
+	if code := post("abc"); code != http.StatusBadRequest {
+		t.Errorf("invalid id = %d, want 400", code)
+	}
+	if code := post("9"); code != http.StatusNotFound {
+		t.Errorf("unknown path = %d, want 404", code)
+	}
+	d.Exec(`UPDATE scan_status SET is_scanning = 1 WHERE id = 1`)
+	if code := post("3"); code != http.StatusConflict {
+		t.Errorf("scan while scanning = %d, want 409", code)
+	}
+	d.Exec(`UPDATE scan_status SET is_scanning = 0 WHERE id = 1`)
+
+	if code := post("3"); code != http.StatusAccepted {
+		t.Fatalf("rescan = %d, want 202", code)
+	}
+	waitForScan(t, d)
+	var songs int
+	d.QueryRow(`SELECT COUNT(*) FROM songs WHERE path LIKE ?`, lib+"%").Scan(&songs)
+	if songs != 1 {
+		t.Errorf("songs after rescan = %d, want 1", songs)
+	}
+}
+
+// setBackupTestPath points DATABASE_PATH at a file of the test's own, for the
+// backup taken before a scan.
+func setBackupTestPath(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "music.db")
+	if err := os.WriteFile(dbPath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DATABASE_PATH", dbPath)
+}
+
+// waitForScan waits for the background scan to release scan_status.
+func waitForScan(t *testing.T, d *sql.DB) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var scanning bool
+		d.QueryRow(`SELECT is_scanning FROM scan_status WHERE id = 1`).Scan(&scanning)
+		if !scanning {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the background scan did not finish")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRescanAllLibrariesKeepsStars(t *testing.T) {
+	d := scanTestDB(t)
+	lib := t.TempDir()
+	kept, gone := filepath.Join(lib, "01 - Kept.mp3"), filepath.Join(lib, "02 - Gone.mp3")
+	for _, p := range []string{kept, gone} {
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := d.Exec(`INSERT INTO library_paths (id, path) VALUES (1, ?)`, lib); err != nil {
+		t.Fatal(err)
+	}
+	setBackupTestPath(t)
+
+	r := gin.New()
+	r.POST("/scan/rescan", rescanAllLibraries)
+	rescan := func(query string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/scan/rescan"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("rescan%s = %d: %s", query, w.Code, w.Body)
+		}
+		waitForScan(t, d)
+	}
+	idOf := func(path string) (id string, cancelled bool) {
+		d.QueryRow(`SELECT id, cancelled FROM songs WHERE path = ?`, path).Scan(&id, &cancelled)
+		return
+	}
+
+	rescan("")
+	keptID, _ := idOf(kept)
+	if keptID == "" {
+		t.Fatal("first scan did not add the song")
+	}
+	d.Exec(`INSERT INTO starred_songs (user_id, song_id, starred_at) VALUES (1, ?, '2024-01-01')`, keptID)
+	os.Remove(gone)
+
+	rescan("")
+	if id, cancelled := idOf(kept); id != keptID || cancelled {
+		t.Errorf("after rescan kept song = (%q, cancelled %v), want (%q, false)", id, cancelled, keptID)
+	}
+	if _, cancelled := idOf(gone); !cancelled {
+		t.Error("song whose file is gone was not cancelled")
+	}
+	var stars int
+	d.QueryRow(`SELECT COUNT(*) FROM starred_songs WHERE song_id = ?`, keptID).Scan(&stars)
+	if stars != 1 {
+		t.Errorf("stars after rescan = %d, want 1", stars)
+	}
+
+	rescan("?wipe=true")
+	d.QueryRow(`SELECT COUNT(*) FROM starred_songs`).Scan(&stars)
+	if stars != 0 {
+		t.Errorf("stars after wipe = %d, want 0", stars)
+	}
+	if id, _ := idOf(gone); id != "" {
+		t.Error("wipe kept the cancelled song")
+	}
+}
+
+func TestWipeLibraryClearsSongDependentTables(t *testing.T) {
+	d := scanTestDB(t)
+	for _, stmt := range []string{
+		`CREATE TABLE song_ratings (user_id INTEGER, song_id TEXT, rating INTEGER)`,
+		`CREATE TABLE play_history (user_id INTEGER, song_id TEXT, played_at TEXT)`,
+		`INSERT INTO songs (id, title, path) VALUES ('s1', 'One', '/m/one.mp3')`,
+		`INSERT INTO starred_songs (user_id, song_id) VALUES (1, 's1')`,
+		`INSERT INTO song_ratings (user_id, song_id, rating) VALUES (1, 's1', 5)`,
+		`INSERT INTO play_history (user_id, song_id, played_at) VALUES (1, 's1', '2024-01-01')`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wipeLibrary(); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"songs", "starred_songs", "song_ratings", "play_history"} {
+		var n int
+		if err := d.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("%s still has %d rows after a wipe", table, n)
+		}
+	}
+}
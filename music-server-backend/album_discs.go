@@ -0,0 +1,139 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// Box sets are often stored one folder per disc ("Album/CD1", "Album/Disc 2").
+// Albums are grouped by name and album_path, so each disc used to show up as
+// an album of its own. With group_multi_disc_albums on (the default) a song in
+// a folder whose name only marks a disc gets the folder above it as its
+// album_path, so the discs of a release, which share the album name, become
+// one album everywhere albums are listed, fetched or downloaded. Songs without
+// a disc number tag take it from the folder name so the merged track list
+// still sorts disc by disc.
+//
+// The scanners store the grouped album_path and disc number; songs scanned
+// before, or under the other setting, are regrouped at startup and whenever
+// the setting changes (see applyMultiDiscGrouping).
+
+// discFolderRe matches disc folder names: "CD1", "cd 2", "Disc 03",
+// "Disk 1 - Live", "CD.2".
+var discFolderRe = regexp.MustCompile(`(?i)^(?:cd|dis[ck])[\s._-]*(\d{1,3})(?:[\s._-].*)?$`)
+
+// discFolderNumber returns the disc number a folder name marks, or 0.
+func discFolderNumber(name string) int {
+	m := discFolderRe.FindStringSubmatch(name)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+// groupMultiDiscAlbums reads group_multi_disc_albums, on unless set to false.
+func groupMultiDiscAlbums() bool {
+	return configBool(db, "group_multi_disc_albums")
+}
+
+// albumPathFor returns the album_path of the song file at path.
+func albumPathFor(path string, groupDiscs bool) string {
+	dir := filepath.Dir(path)
+	if groupDiscs && discFolderNumber(filepath.Base(dir)) > 0 {
+		return filepath.Dir(dir)
+	}
+	return dir
+}
+
+// songAlbumPath is albumPathFor with the configured grouping, for the scanners.
+func songAlbumPath(path string) string {
+	return albumPathFor(path, groupMultiDiscAlbums())
+}
+
+// songDiscNumber returns the tagged disc number, or the one the song's folder
+// name marks when the tags have none.
+func songDiscNumber(path string, tagged int) int {
+	if tagged > 0 {
+		return tagged
+	}
+	return discFolderNumber(filepath.Base(filepath.Dir(path)))
+}
+
+// findAlbumImage looks for a folder image next to the song and, for a song in
+// a disc folder, in the release folder above it.
+func findAlbumImage(songPath string) (string, bool) {
+	dir := filepath.Dir(songPath)
+	if imagePath, ok := findLocalImage(dir); ok {
+		return imagePath, true
+	}
+	if discFolderNumber(filepath.Base(dir)) > 0 {
+		return findLocalImage(filepath.Dir(dir))
+	}
+	return "", false
+}
+
+// applyMultiDiscGrouping rewrites album_path for every song whose stored value
+// does not match the current setting, fills in disc numbers the folder names
+// give, and rebuilds the album index when any song changed. It returns how
+// many songs changed.
+func applyMultiDiscGrouping(db *sql.DB) (int, error) {
+	type placement struct {
+		albumPath string
+		disc      int
+	}
+	groupDiscs := groupMultiDiscAlbums()
+	rows, err := db.Query(`SELECT id, path, COALESCE(album_path, ''), COALESCE(disc_number, 0) FROM songs`)
+	if err != nil {
+		return 0, err
+	}
+	moved := map[string]placement{}
+	for rows.Next() {
+		var id, path, albumPath string
+		var disc int
+		if err := rows.Scan(&id, &path, &albumPath, &disc); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		want := placement{albumPathFor(path, groupDiscs), songDiscNumber(path, disc)}
+		if want != (placement{albumPath, disc}) {
+			moved[id] = want
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(moved) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`UPDATE songs SET album_path = ?, disc_number = ? WHERE id = ?`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for id, p := range moved {
+		if _, err := stmt.Exec(p.albumPath, p.disc, id); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	invalidateArtistIDCache()
+	if err := RebuildLibraryIndex(db); err != nil {
+		log.Printf("RebuildLibraryIndex after regrouping discs failed: %v", err)
+	}
+	invalidateBrowseCache()
+	return len(moved), nil
+}
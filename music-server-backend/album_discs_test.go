@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiscFolderNumber(t *testing.T) {
+	for name, want := range map[string]int{
+		"CD1":              1,
+		"cd 2":             2,
+		"Disc 03":          3,
+		"Disk 1 - Live":    1,
+		"CD.2":             2,
+		"disc_4":           4,
+		"CDs":              0,
+		"Discovery":        0,
+		"Disco 2000":       0,
+		"The CD1 Sessions": 0,
+		"2 Disc Set":       0,
+	} {
+		if got := discFolderNumber(name); got != want {
+			t.Errorf("discFolderNumber(%q) = %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestApplyMultiDiscGrouping(t *testing.T) {
+	d := scanTestDB(t)
+	box := filepath.Join("/music", "Artist", "Box Set")
+	songs := []struct{ id, path string }{
+		{"a", filepath.Join(box, "CD1", "01.mp3")},
+		{"b", filepath.Join(box, "CD2", "01.mp3")},
+		{"c", filepath.Join("/music", "Artist", "Single", "01.mp3")},
+	}
+	for _, s := range songs {
+		album := "Box Set"
+		if s.id == "c" {
+			album = "Single"
+		}
+		if _, err := d.Exec(`INSERT INTO songs (id, title, artist, album, path, album_path) VALUES (?, ?, 'Artist', ?, ?, ?)`,
+			s.id, s.id, album, s.path, filepath.Dir(s.path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	albums := func() int {
+		var n int
+		d.QueryRow(`SELECT COUNT(*) FROM albums`).Scan(&n)
+		return n
+	}
+
+	if n, err := applyMultiDiscGrouping(d); err != nil || n != 2 {
+		t.Fatalf("grouping moved %d songs (%v), want 2", n, err)
+	}
+	var albumPath string
+	d.QueryRow(`SELECT album_path FROM songs WHERE id = 'b'`).Scan(&albumPath)
+	if albumPath != box || albums() != 2 {
+		t.Errorf("grouped: album_path %q, %d albums; want %q and 2 albums", albumPath, albums(), box)
+	}
+	if n, _ := applyMultiDiscGrouping(d); n != 0 {
+		t.Errorf("a second pass moved %d songs", n)
+	}
+
+	d.Exec(`INSERT INTO configuration (key, value) VALUES ('group_multi_disc_albums', 'false')`)
+	if n, err := applyMultiDiscGrouping(d); err != nil || n != 2 {
+		t.Fatalf("ungrouping moved %d songs (%v), want 2", n, err)
+	}
+	if albums() != 3 {
+		t.Errorf("with grouping off there are %d albums, want one per disc folder (3)", albums())
+	}
+}
+
+func TestSongDiscNumberFallsBackToFolder(t *testing.T) {
+	path := filepath.Join("/music", "Box", "Disc 2", "05.flac")
+	if got := songDiscNumber(path, 0); got != 2 {
+		t.Errorf("untagged disc = %d, want 2 from the folder", got)
+	}
+	if got := songDiscNumber(path, 3); got != 3 {
+		t.Errorf("tagged disc = %d, want the tag (3)", got)
+	}
+}
+
+// A two-disc release stored as Box/CD1 and Box/CD2, scanned before discs were
+// grouped (per-disc album_path, no disc tags), is one album once regrouped,
+// and getAlbum lists disc 1 before disc 2.
+func TestGetAlbumMergesDiscFolders(t *testing.T) {
+	d := scanTestDB(t)
+	box := filepath.Join("/music", "Artist", "Box")
+	for _, s := range []struct {
+		id, disc string
+		track    int
+	}{{"s4", "CD2", 2}, {"s1", "CD1", 1}, {"s3", "CD2", 1}, {"s2", "CD1", 2}} {
+		path := filepath.Join(box, s.disc, s.id+".mp3")
+		if _, err := d.Exec(`INSERT INTO songs (id, title, artist, album, path, album_path, track, disc_number, date_added)
+			VALUES (?, ?, 'Artist', 'Box', ?, ?, ?, 0, '2024-01-01T00:00:00Z')`, s.id, s.id, path, filepath.Dir(path), s.track); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := applyMultiDiscGrouping(d); err != nil {
+		t.Fatal(err)
+	}
+
+	list, _ := callHandler(t, subsonicGetAlbumList2, "type=alphabeticalByName&size=50")["albumList2"].(map[string]interface{})
+	entries, _ := list["album"].([]interface{})
+	if len(entries) != 1 {
+		t.Fatalf("getAlbumList2 returned %d albums, want 1: %v", len(entries), list)
+	}
+	entry, _ := entries[0].(map[string]interface{})
+	if n, _ := entry["songCount"].(float64); n != 4 {
+		t.Errorf("album songCount = %v, want 4", entry["songCount"])
+	}
+
+	album, _ := callHandler(t, subsonicGetAlbum, "id="+entry["id"].(string))["album"].(map[string]interface{})
+	songs, _ := album["song"].([]interface{})
+	var got []string
+	for _, s := range songs {
+		song, _ := s.(map[string]interface{})
+		disc, _ := song["discNumber"].(float64)
+		got = append(got, fmt.Sprintf("%s/%v", song["id"], disc))
+	}
+	if want := []string{"s1/1", "s2/1", "s3/2", "s4/2"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("getAlbum songs = %v, want %v", got, want)
+	}
+}
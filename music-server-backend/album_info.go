@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// getAlbumInfo / getAlbumInfo2 data. The release is looked up on MusicBrainz
+// (album + artist search), which gives the musicBrainzId and, through its
+// release group, Cover Art Archive image URLs. When lastfm_api_key is set,
+// Last.fm's album.getInfo adds the notes, the Last.fm URL and images for
+// albums the Cover Art Archive does not know.
+//
+// Results are cached per album in album_info: MusicBrainz allows one request
+// per second, and clients call getAlbumInfo every time an album is opened.
+// Found albums are kept for albumInfoTTL, misses for albumInfoMissTTL; after a
+// failed lookup a stale row is served and retried after albumInfoRetryTTL.
+
+const (
+	albumInfoTTL      = 30 * 24 * time.Hour
+	albumInfoMissTTL  = 7 * 24 * time.Hour
+	albumInfoRetryTTL = time.Hour
+)
+
+// Base URLs of the metadata services; tests point them at a local server.
+var (
+	musicBrainzBaseURL     = "https://musicbrainz.org/ws/2"
+	coverArtArchiveBaseURL = "https://coverartarchive.org"
+	lastFmBaseURL          = "https://ws.audioscrobbler.com/2.0/"
+)
+
+// metadataHTTPClient is shared by the external metadata lookups.
+var metadataHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// MusicBrainz allows one request per second. Every lookup reserves the next
+// free slot under musicBrainzMu and waits for it outside the lock, giving up
+// when its request context ends, so a client that goes away does not leave a
+// handler sleeping behind a queue of other lookups.
+const musicBrainzInterval = time.Second
+
+var (
+	musicBrainzMu   sync.Mutex
+	musicBrainzNext time.Time
+)
+
+// waitMusicBrainz blocks until this caller may send a MusicBrainz request or
+// ctx is done.
+func waitMusicBrainz(ctx context.Context) error {
+	musicBrainzMu.Lock()
+	now := time.Now()
+	slot := musicBrainzNext
+	if slot.Before(now) {
+		slot = now
+	}
+	musicBrainzNext = slot.Add(musicBrainzInterval)
+	musicBrainzMu.Unlock()
+
+	wait := slot.Sub(now)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// AlbumInfo is the cached external metadata of one album.
+type AlbumInfo struct {
+	MusicBrainzID  string
+	Notes          string
+	LastFmURL      string
+	SmallImageURL  string
+	MediumImageURL string
+	LargeImageURL  string
+}
+
+func (info AlbumInfo) empty() bool {
+	return info == AlbumInfo{}
+}
+
+// getJSON GETs target and decodes the JSON body into v.
+func getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	// MusicBrainz rejects anonymous clients; the others accept any agent.
+	req.Header.Set("User-Agent", "AudioMuse-AI-MusicServer/"+subsonicServerVersion+" ( https://github.com/NeptuneHub/AudioMuse-AI-MusicServer )")
+	req.Header.Set("Accept", "application/json")
+	resp, err := metadataHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// lookupMusicBrainzRelease returns the best matching release id and its
+// release group id, or empty strings when there is no confident match.
+func lookupMusicBrainzRelease(ctx context.Context, album, artist string) (releaseID, groupID string, err error) {
+	if err := waitMusicBrainz(ctx); err != nil {
+		return "", "", err
+	}
+
+	query := fmt.Sprintf(`release:"%s"`, luceneEscape(album))
+	if artist != "" && !isUnknownString(artist) {
+		query += fmt.Sprintf(` AND artist:"%s"`, luceneEscape(artist))
+	}
+	var result struct {
+		Releases []struct {
+			ID           string `json:"id"`
+			Score        int    `json:"score"`
+			ReleaseGroup struct {
+				ID string `json:"id"`
+			} `json:"release-group"`
+		} `json:"releases"`
+	}
+	target := musicBrainzBaseURL + "/release/?" + url.Values{"query": {query}, "fmt": {"json"}, "limit": {"1"}}.Encode()
+	if err := getJSON(ctx, target, &result); err != nil {
+		return "", "", err
+	}
+	if len(result.Releases) == 0 || result.Releases[0].Score < 90 {
+		return "", "", nil
+	}
+	return result.Releases[0].ID, result.Releases[0].ReleaseGroup.ID, nil
+}
+
+// luceneEscape escapes the characters that are special inside a quoted
+// MusicBrainz search term.
+func luceneEscape(s string) string {
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			out = append(out, '\\')
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+// lookupLastFmAlbum fills notes, URL and missing images from Last.fm.
+func lookupLastFmAlbum(ctx context.Context, apiKey, album, artist string, info *AlbumInfo) error {
+	var result struct {
+		Album struct {
+			URL   string `json:"url"`
+			MBID  string `json:"mbid"`
+			Image []struct {
+				URL  string `json:"#text"`
+				Size string `json:"size"`
+			} `json:"image"`
+			Wiki struct {
+				Summary string `json:"summary"`
+			} `json:"wiki"`
+		} `json:"album"`
+		Error int `json:"error"`
+	}
+	target := lastFmBaseURL + "?" + url.Values{
+		"method": {"album.getinfo"}, "api_key": {apiKey}, "artist": {artist}, "album": {album},
+		"autocorrect": {"1"}, "format": {"json"},
+	}.Encode()
+	if err := getJSON(ctx, target, &result); err != nil {
+		return err
+	}
+	if result.Error != 0 {
+		return nil // not found
+	}
+	info.Notes = result.Album.Wiki.Summary
+	info.LastFmURL = result.Album.URL
+	if info.MusicBrainzID == "" {
+		info.MusicBrainzID = result.Album.MBID
+	}
+	if info.LargeImageURL == "" {
+		for _, img := range result.Album.Image {
+			switch img.Size {
+			case "small":
+				info.SmallImageURL = img.URL
+			case "medium":
+				info.MediumImageURL = img.URL
+			case "extralarge":
+				info.LargeImageURL = img.URL
+			}
+		}
+	}
+	return nil
+}
+
+// fetchAlbumInfo queries MusicBrainz and, when configured, Last.fm.
+func fetchAlbumInfo(ctx context.Context, album, artist string) (AlbumInfo, error) {
+	var info AlbumInfo
+	releaseID, groupID, err := lookupMusicBrainzRelease(ctx, album, artist)
+	if err != nil {
+		return info, fmt.Errorf("musicbrainz: %w", err)
+	}
+	info.MusicBrainzID = releaseID
+	if groupID != "" {
+		base := coverArtArchiveBaseURL + "/release-group/" + groupID + "/front-"
+		info.SmallImageURL, info.MediumImageURL, info.LargeImageURL = base+"250", base+"500", base+"1200"
+	}
+	if apiKey, err := GetConfig(db, "lastfm_api_key"); err == nil && apiKey != "" {
+		if err := lookupLastFmAlbum(ctx, apiKey, album, artist, &info); err != nil {
+			log.Printf("Last.fm album lookup failed for %q: %v", album, err)
+		}
+	}
+	return info, nil
+}
+
+// albumInfoFor returns the album's metadata from album_info, refreshing the
+// cached row when it has expired.
+func albumInfoFor(ctx context.Context, ref albumRef, artist string) AlbumInfo {
+	key := AlbumKey(ref.Name, ref.Path)
+	var info AlbumInfo
+	var expiresAt string
+	err := db.QueryRow(`SELECT musicbrainz_id, notes, lastfm_url, small_image_url, medium_image_url, large_image_url, expires_at
+		FROM album_info WHERE album_key = ?`, key).Scan(&info.MusicBrainzID, &info.Notes, &info.LastFmURL,
+		&info.SmallImageURL, &info.MediumImageURL, &info.LargeImageURL, &expiresAt)
+	cached := err == nil
+	if cached {
+		if expires, err := time.Parse(time.RFC3339, expiresAt); err == nil && time.Now().Before(expires) {
+			return info
+		}
+	} else if err != sql.ErrNoRows {
+		log.Printf("album_info lookup failed: %v", err)
+	}
+
+	fresh, err := fetchAlbumInfo(ctx, ref.Name, artist)
+	if err != nil && ctx.Err() != nil {
+		return info // the client went away; the next request looks it up
+	}
+	ttl := albumInfoTTL
+	switch {
+	case err != nil:
+		log.Printf("Album info lookup failed for %q: %v", ref.Name, err)
+		ttl = albumInfoRetryTTL // keep whatever we had, try again later
+	case fresh.empty():
+		info, ttl = fresh, albumInfoMissTTL
+	default:
+		info = fresh
+	}
+	now := time.Now()
+	if _, err := db.Exec(`INSERT OR REPLACE INTO album_info (album_key, musicbrainz_id, notes, lastfm_url, small_image_url, medium_image_url, large_image_url, fetched_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, key, info.MusicBrainzID, info.Notes, info.LastFmURL,
+		info.SmallImageURL, info.MediumImageURL, info.LargeImageURL, now.Format(time.RFC3339), now.Add(ttl).Format(time.RFC3339)); err != nil {
+		log.Printf("album_info cache write failed: %v", err)
+	}
+	return info
+}
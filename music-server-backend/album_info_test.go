@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetAlbumInfoLooksUpAndCaches(t *testing.T) {
+	d := scanTestDB(t)
+	for _, stmt := range []string{
+		`CREATE TABLE album_info (album_key TEXT PRIMARY KEY, musicbrainz_id TEXT NOT NULL DEFAULT '', notes TEXT NOT NULL DEFAULT '', lastfm_url TEXT NOT NULL DEFAULT '', small_image_url TEXT NOT NULL DEFAULT '', medium_image_url TEXT NOT NULL DEFAULT '', large_image_url TEXT NOT NULL DEFAULT '', fetched_at TEXT NOT NULL, expires_at TEXT NOT NULL)`,
+		`INSERT INTO configuration (key, value) VALUES ('lastfm_api_key', 'k')`,
+		`INSERT INTO songs (id, title, artist, album, album_artist, path, album_path) VALUES ('s1', 'One', 'Band', 'Record', 'Band', '/m/Band/Record/01.mp3', '/m/Band/Record')`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/mb/release"):
+			if q := r.URL.Query().Get("query"); q != `release:"Record" AND artist:"Band"` {
+				t.Errorf("musicbrainz query = %q", q)
+			}
+			w.Write([]byte(`{"releases":[{"id":"rel-1","score":100,"release-group":{"id":"rg-1"}}]}`))
+		case strings.HasPrefix(r.URL.Path, "/lastfm"):
+			w.Write([]byte(`{"album":{"url":"https://last.fm/record","mbid":"","wiki":{"summary":"A record."}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	oldMB, oldLF, oldCAA := musicBrainzBaseURL, lastFmBaseURL, coverArtArchiveBaseURL
+	musicBrainzBaseURL, lastFmBaseURL, coverArtArchiveBaseURL = srv.URL+"/mb", srv.URL+"/lastfm", "https://caa.test"
+	defer func() { musicBrainzBaseURL, lastFmBaseURL, coverArtArchiveBaseURL = oldMB, oldLF, oldCAA }()
+
+	info, _ := callHandler(t, subsonicGetAlbumInfo, "id=s1")["albumInfo"].(map[string]interface{})
+	want := map[string]string{
+		"musicBrainzId":  "rel-1",
+		"notes":          "A record.",
+		"lastFmUrl":      "https://last.fm/record",
+		"smallImageUrl":  "https://caa.test/release-group/rg-1/front-250",
+		"largeImageUrl":  "https://caa.test/release-group/rg-1/front-1200",
+		"mediumImageUrl": "https://caa.test/release-group/rg-1/front-500",
+	}
+	for k, v := range want {
+		if got, _ := info[k].(string); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("first lookup made %d requests, want 2", n)
+	}
+
+	info, _ = callHandler(t, subsonicGetAlbumInfo, "id=s1")["albumInfo"].(map[string]interface{})
+	if got, _ := info["musicBrainzId"].(string); got != "rel-1" {
+		t.Errorf("cached musicBrainzId = %q", got)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("second lookup made %d requests, want the cached row", n-2)
+	}
+}
+
+func TestWaitMusicBrainzHonoursContext(t *testing.T) {
+	musicBrainzMu.Lock()
+	old := musicBrainzNext
+	musicBrainzNext = time.Now().Add(time.Minute) // a queue of lookups ahead
+	musicBrainzMu.Unlock()
+	defer func() {
+		musicBrainzMu.Lock()
+		musicBrainzNext = old
+		musicBrainzMu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := waitMusicBrainz(ctx); err == nil {
+		t.Fatal("waitMusicBrainz should fail once the context is done")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("waitMusicBrainz kept waiting %s after the context ended", elapsed)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+)
+
+// Album identity. An album is the set of songs sharing a folder (album_path)
+// and an album tag, so two "Greatest Hits" by different artists in different
+// folders never merge, while every track of a one-folder album stays together
+// regardless of featured artists. Its id is "al-" followed by a hash of that
+// grouping key, so it can never be mistaken for a song id; its cover art id is
+// the album id too (getCoverArt resolves it to one of the album's songs).
+//
+// Every endpoint that lists or resolves albums (getAlbumList2, getAlbum,
+// getMusicDirectory, search2/search3, star, the derived albums table and
+// downloads) must use these helpers, otherwise an album id returned by one
+// endpoint may open a different (or partial) album in another.
+
+// albumIDPrefix marks album ids; song ids never start with it.
+const albumIDPrefix = "al-"
+
+// AlbumKey returns the grouping key of the album a song belongs to.
+func AlbumKey(album, albumPath string) string {
+	if strings.TrimSpace(albumPath) != "" {
+		return albumPath + "|||" + album
+	}
+	return album
+}
+
+// albumGroupKeySQL is AlbumKey in SQL for the songs row aliased as alias,
+// matching albums.group_key (RebuildLibraryIndex trims both parts).
+func albumGroupKeySQL(alias string) string {
+	return `CASE WHEN TRIM(COALESCE(` + alias + `.album_path, '')) != ''
+		THEN TRIM(` + alias + `.album_path) || '|||' || TRIM(` + alias + `.album)
+		ELSE TRIM(` + alias + `.album) END`
+}
+
+// AlbumID returns the id of the album identified by (album, albumPath), or ""
+// for songs without an album tag, which belong to no album. Both parts are
+// trimmed, as RebuildLibraryIndex does for albums.group_key.
+func AlbumID(album, albumPath string) string {
+	if strings.TrimSpace(album) == "" {
+		return ""
+	}
+	sum := md5.Sum([]byte(AlbumKey(strings.TrimSpace(album), strings.TrimSpace(albumPath))))
+	return albumIDPrefix + hex.EncodeToString(sum[:])
+}
+
+// isAlbumID reports whether id is an album id rather than a song id.
+func isAlbumID(id string) bool {
+	return strings.HasPrefix(id, albumIDPrefix)
+}
+
+// albumRef identifies the album a song belongs to.
+type albumRef struct {
+	ID   string // album id (see AlbumID)
+	Name string
+	Path string // album_path
+}
+
+// resolveAlbumRef returns the album identified by id. Besides album ids, any
+// song id of the album is accepted, so clients holding a song's id still land
+// on its album. Returns sql.ErrNoRows if neither exists.
+func resolveAlbumRef(db *sql.DB, id string) (albumRef, error) {
+	var ref albumRef
+	if isAlbumID(id) {
+		err := db.QueryRow(`SELECT id, name, album_path FROM albums WHERE id = ?`, id).Scan(&ref.ID, &ref.Name, &ref.Path)
+		return ref, err
+	}
+	var path string
+	err := db.QueryRow(`SELECT album, COALESCE(path, ''), COALESCE(album_path, '') FROM songs WHERE id = ? AND cancelled = 0`, id).Scan(&ref.Name, &path, &ref.Path)
+	if err != nil {
+		return ref, err
+	}
+	// Legacy rows without album_path fall back to the song's directory, which
+	// is what initDB backfills album_path with.
+	if ref.Path == "" {
+		ref.Path = filepath.Dir(path)
+	}
+	ref.ID = AlbumID(ref.Name, ref.Path)
+	return ref, nil
+}
+
+// albumCoverSongID returns the song whose art stands for the album: the one
+// with the smallest id, as before albums had ids of their own.
+func albumCoverSongID(db *sql.DB, ref albumRef) (string, error) {
+	var id sql.NullString
+	err := db.QueryRow(`SELECT MIN(id) FROM songs WHERE album = ? AND album_path = ? AND cancelled = 0`, ref.Name, ref.Path).Scan(&id)
+	if err == nil && !id.Valid {
+		err = sql.ErrNoRows
+	}
+	return id.String, err
+}
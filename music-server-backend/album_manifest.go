@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AlbumManifestTrack is one entry of an album manifest.
+type AlbumManifestTrack struct {
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	Artist     string `json:"artist"`
+	Track      int    `json:"track"`
+	DiscNumber int    `json:"discNumber"`
+	Duration   int    `json:"duration"`
+	URL        string `json:"url"`
+}
+
+// AlbumManifest is the GET /api/v1/album/:id/manifest response.
+type AlbumManifest struct {
+	ID        string               `json:"id"`
+	Name      string               `json:"name"`
+	Artist    string               `json:"artist"`
+	Duration  int                  `json:"duration"`
+	ExpiresAt string               `json:"expiresAt"`
+	Tracks    []AlbumManifestTrack `json:"tracks"`
+}
+
+// getAlbumManifest handles GET /api/v1/album/:id/manifest: the album's tracks
+// in play order with their exact durations and signed stream URLs, so a
+// player can pre-buffer the next track and play live albums and DJ mixes
+// without gaps. The URLs stay valid long enough to play the whole album.
+func getAlbumManifest(c *gin.Context) {
+	ref, err := resolveAlbumRef(db, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		return
+	}
+
+	rows, err := db.Query(`SELECT id, title, artist, COALESCE(track, 0), COALESCE(disc_number, 0), COALESCE(duration, 0)
+		FROM songs WHERE album = ? AND album_path = ? AND cancelled = 0
+		ORDER BY COALESCE(disc_number, 0), COALESCE(track, 0), title`, ref.Name, ref.Path)
+	if err != nil {
+		log.Printf("getAlbumManifest: query failed for album %s: %v", ref.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load album"})
+		return
+	}
+	defer rows.Close()
+
+	manifest := AlbumManifest{
+		ID:     ref.ID,
+		Name:   ref.Name,
+		Artist: albumDisplayArtist(db, ref.Name, ref.Path),
+		Tracks: []AlbumManifestTrack{},
+	}
+	for rows.Next() {
+		var t AlbumManifestTrack
+		if err := rows.Scan(&t.ID, &t.Title, &t.Artist, &t.Track, &t.DiscNumber, &t.Duration); err != nil {
+			continue
+		}
+		manifest.Duration += t.Duration
+		manifest.Tracks = append(manifest.Tracks, t)
+	}
+
+	// Every URL must outlive the album's playback, pauses included.
+	ttl := min(signedStreamDefaultTTL+time.Duration(manifest.Duration)*time.Second, signedStreamMaxTTL)
+	expires := time.Now().Add(ttl)
+	userID := c.GetInt("userID")
+	version, err := streamTokenVersion(userID)
+	if err != nil {
+		log.Printf("Stream token version lookup for user %d failed: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not sign stream URLs"})
+		return
+	}
+	for i := range manifest.Tracks {
+		manifest.Tracks[i].URL = signedStreamURL(c, manifest.Tracks[i].ID, userID, version, expires)
+	}
+	manifest.ExpiresAt = expires.UTC().Format(time.RFC3339)
+	c.JSON(http.StatusOK, manifest)
+}
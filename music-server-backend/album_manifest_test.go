@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAlbumManifestOrdersTracksWithSignedURLs(t *testing.T) {
+	d := scanTestDB(t)
+	for _, stmt := range []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, stream_token_version INTEGER NOT NULL DEFAULT 0)`,
+		`INSERT INTO users (id, username) VALUES (1, 'alice')`,
+		`INSERT INTO songs (id, title, artist, album, path, album_path, track, disc_number, duration) VALUES
+			('a', 'Encore', 'Band', 'Live', '/m/Live/CD2/01.flac', '/m/Live', 1, 2, 300),
+			('b', 'Intro', 'Band', 'Live', '/m/Live/CD1/01.flac', '/m/Live', 1, 1, 61),
+			('c', 'Second', 'Band', 'Live', '/m/Live/CD1/02.flac', '/m/Live', 2, 1, 240),
+			('d', 'Other', 'Band', 'Studio', '/m/Studio/01.flac', '/m/Studio', 1, 1, 100)`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/v1/album/:id/manifest", func(c *gin.Context) { c.Set("userID", 1); getAlbumManifest(c) })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/album/c/manifest", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("manifest: %d %s", w.Code, w.Body.String())
+	}
+	var m AlbumManifest
+	if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := AlbumID("Live", "/m/Live"); m.ID != want || m.Duration != 601 {
+		t.Errorf("album id %q duration %d, want %s and 601", m.ID, m.Duration, want)
+	}
+	var order []string
+	for _, tr := range m.Tracks {
+		order = append(order, tr.ID)
+		u, err := url.Parse(tr.URL)
+		if err != nil || u.Path != "/stream/signed" || u.Query().Get("id") != tr.ID {
+			t.Errorf("track %s url = %q", tr.ID, tr.URL)
+		}
+	}
+	if got := len(order); got != 3 || order[0] != "b" || order[1] != "c" || order[2] != "a" {
+		t.Errorf("track order = %v, want [b c a]", order)
+	}
+}
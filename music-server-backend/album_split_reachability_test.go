@@ -17,7 +17,7 @@ func albumSplitTestDB(t *testing.T) *sql.DB {
 	if err != nil {
 		t.Fatalf("open: %v", err)
 	}
-	if _, err := d.Exec(`CREATE TABLE songs (id TEXT PRIMARY KEY, title TEXT, artist TEXT, album TEXT, album_artist TEXT DEFAULT '', album_path TEXT DEFAULT '', genre TEXT DEFAULT '', path TEXT, duration INTEGER DEFAULT 0, play_count INTEGER DEFAULT 0, last_played TEXT, date_added TEXT, date_updated TEXT, replaygain_track_gain REAL, replaygain_track_peak REAL, replaygain_album_gain REAL, replaygain_album_peak REAL, track INTEGER DEFAULT 0, year INTEGER DEFAULT 0, disc_number INTEGER DEFAULT 0, size INTEGER DEFAULT 0, bitrate INTEGER DEFAULT 0, sample_rate INTEGER DEFAULT 0, channels INTEGER DEFAULT 0, bit_depth INTEGER DEFAULT 0, comment TEXT DEFAULT '', cancelled INTEGER DEFAULT 0)`); err != nil {
+	if _, err := d.Exec(`CREATE TABLE songs (id TEXT PRIMARY KEY, title TEXT, artist TEXT, album TEXT, album_artist TEXT DEFAULT '', album_path TEXT DEFAULT '', genre TEXT DEFAULT '', path TEXT, duration INTEGER DEFAULT 0, play_count INTEGER DEFAULT 0, last_played TEXT, date_added TEXT, date_updated TEXT, replaygain_track_gain REAL, replaygain_track_peak REAL, replaygain_album_gain REAL, replaygain_album_peak REAL, track INTEGER DEFAULT 0, year INTEGER DEFAULT 0, disc_number INTEGER DEFAULT 0, size INTEGER DEFAULT 0, bitrate INTEGER DEFAULT 0, sample_rate INTEGER DEFAULT 0, channels INTEGER DEFAULT 0, bit_depth INTEGER DEFAULT 0, comment TEXT DEFAULT '', search_text TEXT NOT NULL DEFAULT '', cancelled INTEGER DEFAULT 0)`); err != nil {
 		t.Fatalf("create songs: %v", err)
 	}
 	if _, err := d.Exec(`CREATE TABLE starred_songs (song_id TEXT, user_id INTEGER)`); err != nil {
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const recentAlbumsDefaultLimit = 20
+
+// RecentAlbum is one album of GET /api/v1/albums/recent.
+type RecentAlbum struct {
+	SearchAlbum
+	CoverArt string `json:"coverArt"`
+}
+
+// getRecentAlbums handles GET /api/v1/albums/recent, the albums most
+// recently added to the library (by the date of their first song), for the
+// "Recently Added" shelf. limit (default 20) and offset page through them;
+// effective=true shows the album artist, false the main track artist, and it
+// defaults to the use_album_artist setting.
+func getRecentAlbums(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(recentAlbumsDefaultLimit)))
+	if err != nil || limit <= 0 {
+		limit = recentAlbumsDefaultLimit
+	}
+	limit = min(limit, searchMaxPageSize)
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	effective := c.DefaultQuery("effective", strconv.FormatBool(UseAlbumArtist(db))) == "true"
+
+	albums, err := QueryAlbums(db, AlbumQueryOptions{
+		GroupByPath:     true,
+		IncludeAlbumID:  true,
+		IncludeGenre:    true,
+		IncludeCounts:   true,
+		IncludeDuration: true,
+		IncludeCreated:  true,
+		OrderBy:         AlbumOrderRecentlyAdded,
+		Limit:           limit,
+		Offset:          offset,
+	})
+	if err != nil {
+		log.Printf("getRecentAlbums: album query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load recently added albums"})
+		return
+	}
+
+	resp := make([]RecentAlbum, 0, len(albums))
+	for _, a := range albums {
+		var artist string
+		if effective {
+			artist = albumDisplayArtist(db, a.Name, a.AlbumPath)
+		} else {
+			artist = albumTrackArtist(a.Name, a.AlbumPath)
+		}
+		resp = append(resp, RecentAlbum{
+			SearchAlbum: SearchAlbum{ID: a.AlbumID, Name: a.Name, Artist: artist, ArtistID: GenerateArtistID(artist),
+				Genre: a.Genre, SongCount: a.SongCount, Duration: a.Duration, Created: a.Created},
+			CoverArt: a.AlbumID,
+		})
+	}
+	total, _ := CountAlbums(db, "")
+	c.JSON(http.StatusOK, gin.H{"albums": resp, "total": total, "limit": limit, "offset": offset})
+}
+
+// albumTrackArtist returns the track artist with the most songs on an album.
+func albumTrackArtist(albumName, albumPath string) string {
+	var artist string
+	err := db.QueryRow(`SELECT artist FROM songs
+		WHERE album = ? AND COALESCE(album_path, '') = ? AND cancelled = 0 AND artist != ''
+		GROUP BY artist ORDER BY COUNT(*) DESC, artist LIMIT 1`, albumName, albumPath).Scan(&artist)
+	if err != nil || artist == "" {
+		return "Unknown Artist"
+	}
+	return artist
+}
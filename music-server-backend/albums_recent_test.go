@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRecentAlbums(t *testing.T) {
+	d := scanTestDB(t)
+	d.Exec(`INSERT INTO songs (id, title, artist, album_artist, album, album_path, date_added, duration, path) VALUES
+		('a1', 'T1', 'Guest', 'Band', 'Old', '/m/old', '2025-01-01T00:00:00Z', 100, '/m/old/1.mp3'),
+		('a2', 'T2', 'Singer', 'Band', 'Old', '/m/old', '2025-01-02T00:00:00Z', 100, '/m/old/2.mp3'),
+		('a3', 'T3', 'Singer', 'Band', 'Old', '/m/old', '2025-01-03T00:00:00Z', 100, '/m/old/3.mp3'),
+		('b1', 'T1', 'Solo', '', 'New', '/m/new', '2026-03-01T00:00:00Z', 200, '/m/new/1.mp3'),
+		('c1', 'T1', 'Duo', '', 'Middle', '/m/mid', '2025-06-01T00:00:00Z', 300, '/m/mid/1.mp3')`)
+
+	r := gin.New()
+	r.GET("/albums/recent", getRecentAlbums)
+	get := func(query string) (albums []RecentAlbum, total int) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/albums/recent?"+query, nil))
+		var resp struct {
+			Albums []RecentAlbum
+			Total  int
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", query, w.Code, w.Body.String())
+		}
+		return resp.Albums, resp.Total
+	}
+
+	albums, total := get("")
+	if total != 3 || len(albums) != 3 {
+		t.Fatalf("got %d albums, total %d", len(albums), total)
+	}
+	for i, want := range []string{"New", "Middle", "Old"} {
+		if albums[i].Name != want {
+			t.Errorf("albums[%d] = %s, want %s", i, albums[i].Name, want)
+		}
+	}
+	if old := albums[2]; old.ID != AlbumID("Old", "/m/old") || old.CoverArt != old.ID || old.SongCount != 3 || old.Created != "2025-01-01T00:00:00Z" {
+		t.Errorf("Old = %+v", old)
+	}
+
+	albums, _ = get("limit=1&offset=2&effective=true")
+	if len(albums) != 1 || albums[0].Name != "Old" || albums[0].Artist != "Band" {
+		t.Errorf("page 3 with effective artists = %+v", albums)
+	}
+	albums, _ = get("limit=1&offset=2&effective=false")
+	if len(albums) != 1 || albums[0].Artist != "Singer" {
+		t.Errorf("page 3 with track artists = %+v", albums)
+	}
+}
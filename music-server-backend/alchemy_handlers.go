@@ -37,6 +37,13 @@ func AlchemyHandler(c *gin.Context) {
 		println("  Item", i, "- ID:", item.ID, "Op:", item.Op, "Type:", item.Type)
 	}
 
+	// The core knows songs by their external id.
+	for i, item := range req.Items {
+		if item.Type != "artist" {
+			req.Items[i].ID = coreItemID(db, item.ID)
+		}
+	}
+
 	payload, _ := json.Marshal(req)
 
 	// Log what we're sending to AudioMuse-AI
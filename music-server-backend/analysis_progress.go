@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getSonicAnalysisStatus returns the AudioMuse-AI Core's last task as before,
+// plus a progressInfo object (albums total/analyzed, percent, ETA and the
+// error of a failed run) so clients can draw a real progress bar. The Core
+// analyses album by album, so its /api/last_task details count albums:
+// total_albums and albums_completed while running, error_message when the
+// task failed, and status_message for the latest log line. The Core does not
+// report how many albums or tracks failed, so progressInfo has no failed
+// count; a failed run only surfaces as lastError. The Core is polled at most
+// once per analysisStatusTTL; every admin tab polling the panel shares that
+// answer.
+
+const analysisStatusTTL = 3 * time.Second
+
+// analysisProgress is the progressInfo object. EtaSeconds is omitted when it
+// cannot be estimated (nothing done yet, or the task is not running).
+type analysisProgress struct {
+	TotalAlbums int     `json:"totalAlbums"`
+	Analyzed    int     `json:"analyzed"`
+	Percent     float64 `json:"percent"`
+	EtaSeconds  int     `json:"etaSeconds,omitempty"`
+	LastError   string  `json:"lastError,omitempty"`
+}
+
+var analysisStatusCache struct {
+	sync.Mutex
+	fetchedAt time.Time
+	status    int
+	body      []byte
+}
+
+// invalidateAnalysisStatusCache makes the next status request poll the Core,
+// so a task started or cancelled a moment ago shows up immediately.
+func invalidateAnalysisStatusCache() {
+	analysisStatusCache.Lock()
+	analysisStatusCache.fetchedAt = time.Time{}
+	analysisStatusCache.Unlock()
+}
+
+// buildAnalysisProgress derives the progressInfo object from a last_task body.
+func buildAnalysisProgress(task map[string]interface{}) analysisProgress {
+	var p analysisProgress
+	details, _ := task["details"].(map[string]interface{})
+	if n, ok := details["total_albums"].(float64); ok {
+		p.TotalAlbums = int(n)
+	}
+	if n, ok := details["albums_completed"].(float64); ok {
+		p.Analyzed = int(n)
+	}
+
+	state, _ := task["status"].(string)
+	state = strings.ToUpper(state)
+	if progress, ok := task["progress"].(float64); ok {
+		p.Percent = progress
+	} else if p.TotalAlbums > 0 {
+		p.Percent = float64(p.Analyzed) * 100 / float64(p.TotalAlbums)
+	}
+	if state == "SUCCESS" {
+		p.Percent = 100
+	}
+	p.Percent = math.Round(math.Min(math.Max(p.Percent, 0), 100)*10) / 10
+
+	running := state == "PROGRESS" || state == "STARTED" || state == "PENDING"
+	if elapsed, ok := task["running_time_seconds"].(float64); ok && running && p.Percent > 0 && p.Percent < 100 {
+		p.EtaSeconds = int(math.Round(elapsed * (100 - p.Percent) / p.Percent))
+	}
+
+	if state == "FAILURE" || state == "REVOKED" {
+		if msg, ok := details["error_message"].(string); ok && msg != "" {
+			p.LastError = msg
+		} else if msg, ok := details["status_message"].(string); ok && msg != "" {
+			p.LastError = msg
+		} else {
+			p.LastError = "Analysis " + strings.ToLower(state)
+		}
+	}
+	return p
+}
+
+// fetchAnalysisStatus returns the Core's last_task answer, from the cache when
+// it is fresh enough.
+func fetchAnalysisStatus(c *gin.Context) ([]byte, int, error) {
+	analysisStatusCache.Lock()
+	defer analysisStatusCache.Unlock()
+	if time.Since(analysisStatusCache.fetchedAt) < analysisStatusTTL {
+		return analysisStatusCache.body, analysisStatusCache.status, nil
+	}
+	body, status, err := audioMuseClient.GetAnalysisStatus(c.Request.Context())
+	if err != nil {
+		return body, status, err
+	}
+	analysisStatusCache.fetchedAt = time.Now()
+	analysisStatusCache.status = status
+	analysisStatusCache.body = body
+	return body, status, nil
+}
+
+// subsonicGetSonicAnalysisStatus handles the Subsonic API request to get analysis status.
+func subsonicGetSonicAnalysisStatus(c *gin.Context) {
+	_ = c.MustGet("user") // Auth is handled by middleware
+	body, status, err := fetchAnalysisStatus(c)
+	if err == ErrAudioMuse401 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AudioMuse-AI authentication failed. Please configure API token in Admin settings."})
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching AudioMuse-AI analysis status: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to contact AudioMuse-AI Core"})
+		return
+	}
+
+	var task map[string]interface{}
+	if status != http.StatusOK || json.Unmarshal(body, &task) != nil || task == nil {
+		// Nothing to summarize (no task yet, or an error): pass it through.
+		c.Data(status, "application/json", body)
+		return
+	}
+	task["progressInfo"] = buildAnalysisProgress(task)
+	c.JSON(http.StatusOK, task)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBuildAnalysisProgress(t *testing.T) {
+	decode := func(s string) map[string]interface{} {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	p := buildAnalysisProgress(decode(`{"task_id":"t1","task_type":"main_analysis","status":"PROGRESS","progress":25,"running_time_seconds":60,
+		"details":{"status_message":"Processing albums: 50/200 completed.","albums_completed":50,"total_albums":200,"log":["started"]}}`))
+	if p != (analysisProgress{TotalAlbums: 200, Analyzed: 50, Percent: 25, EtaSeconds: 180}) {
+		t.Errorf("running task = %+v", p)
+	}
+
+	p = buildAnalysisProgress(decode(`{"status":"STARTED","details":{"total_albums":40,"albums_completed":10}}`))
+	if p.Percent != 25 || p.EtaSeconds != 0 {
+		t.Errorf("percent from counters = %+v, want 25%% and no ETA without a running time", p)
+	}
+
+	p = buildAnalysisProgress(decode(`{"status":"FAILURE","progress":40,"running_time_seconds":10,"details":{"status_message":"Main analysis failed","error_message":"ffmpeg crashed"}}`))
+	if p.LastError != "ffmpeg crashed" || p.EtaSeconds != 0 {
+		t.Errorf("failed task = %+v", p)
+	}
+
+	p = buildAnalysisProgress(decode(`{"status":"REVOKED","details":{"status_message":"Task revoked by user."}}`))
+	if p.LastError != "Task revoked by user." {
+		t.Errorf("revoked task = %+v", p)
+	}
+
+	p = buildAnalysisProgress(decode(`{"status":"SUCCESS","progress":99.96}`))
+	if p.Percent != 100 || p.LastError != "" {
+		t.Errorf("finished task = %+v", p)
+	}
+}
+
+func TestGetSonicAnalysisStatusCachesCore(t *testing.T) {
+	d := scanTestDB(t)
+	polls := 0
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"task_id":"t1","status":"PROGRESS","progress":50,"running_time_seconds":30,"details":{"status_message":"Analyzing"}}`))
+	}))
+	defer core.Close()
+	t.Setenv("AUDIOMUSE_AI_CORE_URL", core.URL)
+	prevClient := audioMuseClient
+	audioMuseClient = NewAudioMuseClient(d)
+	t.Cleanup(func() { audioMuseClient = prevClient })
+	invalidateAnalysisStatusCache()
+	t.Cleanup(invalidateAnalysisStatusCache)
+
+	r := gin.New()
+	r.GET("/status", func(c *gin.Context) { c.Set("user", User{ID: 1, Username: "admin", IsAdmin: true}) }, subsonicGetSonicAnalysisStatus)
+	get := func() map[string]any {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d %s", w.Code, w.Body)
+		}
+		var body map[string]any
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return body
+	}
+
+	body := get()
+	info, _ := body["progressInfo"].(map[string]any)
+	if body["task_id"] != "t1" || info["percent"] != 50.0 || info["etaSeconds"] != 30.0 {
+		t.Fatalf("body = %v", body)
+	}
+	get()
+	if polls != 1 {
+		t.Errorf("core polled %d times, want 1 within the cache TTL", polls)
+	}
+	invalidateAnalysisStatusCache()
+	get()
+	if polls != 2 {
+		t.Errorf("core polled %d times after invalidation, want 2", polls)
+	}
+}
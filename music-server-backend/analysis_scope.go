@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scoped analysis: instead of re-analyzing the whole library, an admin can ask
+// the AudioMuse-AI Core to analyze one artist, one album or a list of songs,
+// typically right after adding them. The scope is resolved to songs here and
+// their external ids (see song_id_reconcile.go) are sent as item_ids to the
+// Core's regular analysis task, so its progress shows up in
+// getSonicAnalysisStatus like any other analysis run.
+
+// analyzeScopeRequest is the body of POST /api/v1/admin/analyze. Artist is an
+// artist id or name; Album is an album id (any song id of the album) or, when
+// no such album exists, an album name, narrowed by Artist if both are given.
+type analyzeScopeRequest struct {
+	Artist  string   `json:"artist"`
+	Album   string   `json:"album"`
+	SongIDs []string `json:"songIds"`
+}
+
+// resolveAnalyzeScope returns the core-facing ids of the non-cancelled songs
+// in scope, in a stable order and without duplicates.
+func resolveAnalyzeScope(db *sql.DB, req analyzeScopeRequest) ([]string, error) {
+	artist := strings.TrimSpace(req.Artist)
+	if name, ok := resolveArtistIDToName(db, artist); ok {
+		artist = name
+	}
+	album := strings.TrimSpace(req.Album)
+
+	var queries []string
+	var args []interface{}
+	switch {
+	case album != "":
+		if ref, err := resolveAlbumRef(db, album); err == nil {
+			queries = append(queries, `SELECT COALESCE(NULLIF(external_id, ''), id) AS item_id FROM songs WHERE album = ? AND album_path = ? AND cancelled = 0`)
+			args = append(args, ref.Name, ref.Path)
+		} else if artist != "" {
+			queries = append(queries, `SELECT COALESCE(NULLIF(external_id, ''), id) AS item_id FROM songs WHERE album = ? AND (artist = ? OR album_artist = ?) AND cancelled = 0`)
+			args = append(args, album, artist, artist)
+		} else {
+			queries = append(queries, `SELECT COALESCE(NULLIF(external_id, ''), id) AS item_id FROM songs WHERE album = ? AND cancelled = 0`)
+			args = append(args, album)
+		}
+	case artist != "":
+		queries = append(queries, `SELECT COALESCE(NULLIF(external_id, ''), id) AS item_id FROM songs WHERE (artist = ? OR album_artist = ?) AND cancelled = 0`)
+		args = append(args, artist, artist)
+	}
+	for _, id := range req.SongIDs {
+		if id = strings.TrimSpace(id); id != "" {
+			queries = append(queries, `SELECT COALESCE(NULLIF(external_id, ''), id) AS item_id FROM songs WHERE (id = ? OR external_id = ?) AND cancelled = 0`)
+			args = append(args, id, id)
+		}
+	}
+	if len(queries) == 0 {
+		return nil, nil
+	}
+
+	// UNION drops duplicates between the album/artist and the explicit ids.
+	rows, err := db.Query(strings.Join(queries, " UNION ")+" ORDER BY item_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// analyzeScoped starts an AudioMuse-AI analysis limited to an artist, an
+// album and/or specific songs.
+func analyzeScoped(c *gin.Context) {
+	var req analyzeScopeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if strings.TrimSpace(req.Artist) == "" && strings.TrimSpace(req.Album) == "" && len(req.SongIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Give an artist, an album or songIds to analyze"})
+		return
+	}
+
+	ids, err := resolveAnalyzeScope(db, req)
+	if err != nil {
+		log.Printf("Error resolving analysis scope: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve songs to analyze"})
+		return
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No songs match the requested scope"})
+		return
+	}
+
+	invalidateAnalysisStatusCache()
+	payload, _ := json.Marshal(gin.H{"item_ids": ids})
+	respBody, statusCode, err := audioMuseClient.StartScopedAnalysis(c.Request.Context(), bytes.NewReader(payload))
+	if err == ErrAudioMuse401 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AudioMuse-AI authentication failed. Please configure API token in Admin settings."})
+		return
+	}
+	if err != nil {
+		log.Printf("Error calling AudioMuse-AI for scoped analysis: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to contact AudioMuse-AI API", "details": err.Error()})
+		return
+	}
+	if statusCode >= 300 {
+		c.Data(statusCode, "application/json", respBody)
+		return
+	}
+	log.Printf("Started AudioMuse-AI analysis of %d song(s)", len(ids))
+
+	var task interface{}
+	if json.Unmarshal(respBody, &task) != nil {
+		task = string(respBody)
+	}
+	c.JSON(statusCode, gin.H{"songs": len(ids), "task": task})
+}
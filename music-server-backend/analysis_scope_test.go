@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAnalyzeScoped(t *testing.T) {
+	d := scanTestDB(t)
+	for _, s := range [][]string{
+		{"s1", "One", "Band", "First", "Band", "/m/Band/First"},
+		{"s2", "Two", "Band", "First", "Band", "/m/Band/First"},
+		{"s3", "Three", "Guest", "Second", "Band", "/m/Band/Second"},
+		{"s4", "Four", "Other", "First", "Other", "/m/Other/First"},
+	} {
+		if _, err := d.Exec(`INSERT INTO songs (id, title, artist, album, album_artist, album_path, path) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			s[0], s[1], s[2], s[3], s[4], s[5], s[5]+"/"+s[1]+".mp3"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var gotPath string
+	var gotBody struct {
+		ItemIDs []string `json:"item_ids"`
+	}
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		b, _ := io.ReadAll(r.Body)
+		json.Unmarshal(b, &gotBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"task_id":"t1","status":"queued"}`))
+	}))
+	defer core.Close()
+	t.Setenv("AUDIOMUSE_AI_CORE_URL", core.URL)
+	prevClient := audioMuseClient
+	audioMuseClient = NewAudioMuseClient(d)
+	t.Cleanup(func() { audioMuseClient = prevClient })
+
+	r := gin.New()
+	r.POST("/analyze", analyzeScoped)
+	post := func(body string) (int, map[string]any) {
+		gotBody.ItemIDs = nil
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/analyze", strings.NewReader(body)))
+		var resp map[string]any
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	for _, tc := range []struct {
+		body string
+		want string
+	}{
+		{`{"artist":"Band"}`, "s1,s2,s3"},
+		{`{"album":"s2"}`, "s1,s2"},
+		{`{"album":"First"}`, "s1,s2,s4"},
+		{`{"album":"First","artist":"Other"}`, "s4"},
+		{`{"album":"s3","songIds":["s4","s3","missing"]}`, "s3,s4"},
+	} {
+		code, resp := post(tc.body)
+		if code != http.StatusOK {
+			t.Errorf("%s: status %d %v", tc.body, code, resp)
+			continue
+		}
+		if got := strings.Join(gotBody.ItemIDs, ","); got != tc.want {
+			t.Errorf("%s: item_ids = %s, want %s", tc.body, got, tc.want)
+		}
+		if gotPath != "/api/analysis/start" || resp["task"].(map[string]any)["task_id"] != "t1" {
+			t.Errorf("%s: path %s, response %v", tc.body, gotPath, resp)
+		}
+	}
+
+	if code, _ := post(`{}`); code != http.StatusBadRequest {
+		t.Errorf("empty scope = %d, want 400", code)
+	}
+	if code, _ := post(`{"artist":"Nobody"}`); code != http.StatusNotFound {
+		t.Errorf("unknown artist = %d, want 404", code)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "golang.org/x/image/webp" // lets imaging.Decode read WebP folder images and embedded pictures
+)
+
+// Cover art goes out as WebP to clients whose Accept header lists image/webp,
+// which makes album grids a good deal lighter; other clients get the usual
+// formats. Go has no WebP encoder, so the resized image is piped through
+// ffmpeg, which the server already needs for transcoding. If that fails (no
+// ffmpeg, or one built without libwebp) the error is logged once and art is
+// served in the usual formats until the server restarts.
+//
+// The negotiated format is part of the art ETag and responses carry
+// Vary: Accept, so caches keep the WebP and non-WebP variants apart.
+
+const (
+	webpQuality       = "80"
+	webpEncodeTimeout = 10 * time.Second
+)
+
+// webpUnavailable is set after ffmpeg first fails to encode WebP.
+var webpUnavailable atomic.Bool
+
+// artOutputFormat returns "webp" when art for this request should be encoded
+// as WebP and "" otherwise, and marks the response as varying by Accept.
+func artOutputFormat(c *gin.Context) string {
+	c.Header("Vary", "Accept")
+	if webpUnavailable.Load() || !acceptsWebP(c.GetHeader("Accept")) {
+		return ""
+	}
+	return "webp"
+}
+
+// acceptsWebP reports whether an Accept header lists image/webp (or image/*)
+// with a non-zero quality. A bare */* does not count: browsers send it for
+// <img> requests alongside an explicit image/webp when they support it.
+func acceptsWebP(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		if mediaType != "image/webp" && mediaType != "image/*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if k, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.EqualFold(k, "q") {
+				q, _ = strconv.ParseFloat(v, 64)
+			}
+		}
+		if q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeWebP encodes img as WebP with ffmpeg. The image is handed over as an
+// uncompressed PNG, which is quick to write and to read back.
+func encodeWebP(ctx context.Context, img image.Image) ([]byte, error) {
+	var in bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: png.NoCompression}).Encode(&in, img); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webpEncodeTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-loglevel", "error",
+		"-f", "png_pipe", "-i", "pipe:0", "-c:v", "libwebp", "-quality", webpQuality, "-f", "webp", "pipe:1")
+	cmd.Stdin = &in
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == nil {
+			// Not a timeout or a client gone away: this ffmpeg cannot do WebP.
+			if webpUnavailable.CompareAndSwap(false, true) {
+				log.Printf("[RESIZE] WebP encoding unavailable, serving other formats: %v %s", err, strings.TrimSpace(stderr.String()))
+			}
+		}
+		return nil, fmt.Errorf("ffmpeg webp: %w", err)
+	}
+	if out.Len() == 0 {
+		return nil, errors.New("ffmpeg webp: empty output")
+	}
+	return out.Bytes(), nil
+}
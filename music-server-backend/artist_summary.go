@@ -0,0 +1,57 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ArtistSummary is the GET /api/v1/artist/:id/summary response.
+type ArtistSummary struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	AlbumCount   int    `json:"albumCount"`
+	SongCount    int    `json:"songCount"`
+	PlayCount    int    `json:"playCount"`
+	LastPlayed   string `json:"lastPlayed,omitempty"`
+	StarredCount int    `json:"starredCount"`
+}
+
+// getArtistSummary handles GET /api/v1/artist/:id/summary: aggregate stats for
+// an artist detail page. Like getArtist it counts every song the artist plays
+// on or is the album artist of. Play count and last played are library-wide,
+// as songs keep one counter; starredCount is the requesting user's stars.
+func getArtistSummary(c *gin.Context) {
+	id := c.Param("id")
+	name, ok := resolveArtistIDToName(db, id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Artist not found"})
+		return
+	}
+
+	summary := ArtistSummary{ID: id, Name: name}
+	var lastPlayed sql.NullString
+	err := db.QueryRow(`SELECT
+			COUNT(DISTINCT CASE
+				WHEN s.album = '' THEN NULL
+				WHEN s.album_path IS NOT NULL AND s.album_path != '' THEN s.album_path || '|||' || s.album
+				ELSE s.album
+			END),
+			COUNT(*),
+			COALESCE(SUM(s.play_count), 0),
+			MAX(NULLIF(s.last_played, '')),
+			COUNT(ss.song_id)
+		FROM songs s
+		LEFT JOIN starred_songs ss ON ss.song_id = s.id AND ss.user_id = ?
+		WHERE (s.artist = ? OR s.album_artist = ?) AND s.cancelled = 0`,
+		c.GetInt("userID"), name, name).Scan(&summary.AlbumCount, &summary.SongCount, &summary.PlayCount, &lastPlayed, &summary.StarredCount)
+	if err != nil {
+		log.Printf("getArtistSummary: query failed for artist %s: %v", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load artist"})
+		return
+	}
+	summary.LastPlayed = lastPlayed.String
+	c.JSON(http.StatusOK, summary)
+}
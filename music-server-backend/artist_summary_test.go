@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestArtistSummary(t *testing.T) {
+	d := scanTestDB(t)
+	invalidateArtistIDCache()
+	t.Cleanup(invalidateArtistIDCache)
+	for _, stmt := range []string{
+		`INSERT INTO songs (id, title, artist, album_artist, album, path, album_path, play_count, last_played) VALUES
+			('a', 'One', 'Band', '', 'First', '/m/First/1.mp3', '/m/First', 3, '2025-01-02T00:00:00Z'),
+			('b', 'Two', 'Band', '', 'First', '/m/First/2.mp3', '/m/First', 2, '2025-03-04T00:00:00Z'),
+			('c', 'Guest', 'Other feat. X', 'Band', 'Second', '/m/Second/1.mp3', '/m/Second', 1, NULL),
+			('d', 'Single', 'Band', '', '', '/m/loose.mp3', '', 0, NULL),
+			('e', 'Gone', 'Band', '', 'Third', '/m/Third/1.mp3', '/m/Third', 9, '2026-01-01T00:00:00Z'),
+			('f', 'Else', 'Someone', '', 'First', '/m/Other/1.mp3', '/m/Other', 5, NULL)`,
+		`UPDATE songs SET cancelled = 1 WHERE id = 'e'`,
+		`INSERT INTO starred_songs (user_id, song_id, starred_at) VALUES (1, 'a', 'x'), (1, 'c', 'x'), (2, 'b', 'x')`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/v1/artist/:id/summary", func(c *gin.Context) { c.Set("userID", 1); getArtistSummary(c) })
+	get := func(id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/artist/"+id+"/summary", nil))
+		return w
+	}
+
+	w := get(GenerateArtistID("Band"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("summary: %d %s", w.Code, w.Body.String())
+	}
+	var s ArtistSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	want := ArtistSummary{ID: GenerateArtistID("Band"), Name: "Band", AlbumCount: 2, SongCount: 4, PlayCount: 6, LastPlayed: "2025-03-04T00:00:00Z", StarredCount: 2}
+	if s != want {
+		t.Errorf("summary = %+v, want %+v", s, want)
+	}
+
+	if w := get("nope"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown artist: %d, want 404", w.Code)
+	}
+}
@@ -12,6 +12,7 @@ import (
 // subsonicStartSonicAnalysis handles the Subsonic API request to start an analysis.
 func subsonicStartSonicAnalysis(c *gin.Context) {
 	_ = c.MustGet("user") // Auth is handled by middleware
+	invalidateAnalysisStatusCache()
 	audioMuseClient.ProxyGin(c, "POST", "/api/analysis/start")
 }
 
@@ -23,18 +24,14 @@ func subsonicCancelSonicAnalysis(c *gin.Context) {
 		subsonicRespond(c, newSubsonicErrorResponse(10, "Parameter 'taskId' is required."))
 		return
 	}
+	invalidateAnalysisStatusCache()
 	audioMuseClient.ProxyGin(c, "POST", fmt.Sprintf("/api/cancel/%s", taskID))
 }
 
-// subsonicGetSonicAnalysisStatus handles the Subsonic API request to get analysis status.
-func subsonicGetSonicAnalysisStatus(c *gin.Context) {
-	_ = c.MustGet("user") // Auth is handled by middleware
-	audioMuseClient.ProxyGin(c, "GET", "/api/last_task")
-}
-
 // subsonicStartClusteringAnalysis handles the Subsonic API request to start clustering.
 func subsonicStartClusteringAnalysis(c *gin.Context) {
 	_ = c.MustGet("user") // Auth is handled by middleware
+	invalidateAnalysisStatusCache()
 	audioMuseClient.ProxyGin(c, "POST", "/api/clustering/start")
 }
 
@@ -43,6 +40,7 @@ func subsonicStartClusteringAnalysis(c *gin.Context) {
 func runAnalysisJob(ctx context.Context) error {
 	log.Printf("INFO: runAnalysisJob: POST /api/analysis/start")
 
+	invalidateAnalysisStatusCache()
 	body, statusCode, err := audioMuseClient.StartAnalysis(ctx)
 	if err == ErrAudioMuse401 {
 		log.Printf("❌ AudioMuse-AI returned 401 - API token likely not configured or invalid")
@@ -64,6 +62,7 @@ func runAnalysisJob(ctx context.Context) error {
 func runClusteringJob(ctx context.Context) error {
 	log.Printf("INFO: runClusteringJob: POST /api/clustering/start")
 
+	invalidateAnalysisStatusCache()
 	body, statusCode, err := audioMuseClient.StartClustering(ctx)
 	if err == ErrAudioMuse401 {
 		log.Printf("❌ AudioMuse-AI returned 401 - API token likely not configured or invalid")
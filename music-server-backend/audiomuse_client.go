@@ -323,6 +323,12 @@ func (cl *AudioMuseClient) StartAnalysis(ctx context.Context) ([]byte, int, erro
 	return cl.Post(ctx, "/api/analysis/start", nil)
 }
 
+// StartScopedAnalysis initiates a sonic analysis limited to the songs listed
+// in body (a JSON object with an item_ids array).
+func (cl *AudioMuseClient) StartScopedAnalysis(ctx context.Context, body io.Reader) ([]byte, int, error) {
+	return cl.Post(ctx, "/api/analysis/start", body)
+}
+
 // CancelAnalysis cancels an analysis task.
 func (cl *AudioMuseClient) CancelAnalysis(ctx context.Context, taskID string) ([]byte, int, error) {
 	return cl.Post(ctx, fmt.Sprintf("/api/cancel/%s", taskID), nil)
@@ -12,16 +12,32 @@ import (
 )
 
 // getSongsByIDs is a helper function to fetch song details from a list of IDs, preserving order.
+// Ids may be current song ids or the external ids the AudioMuse-AI Core knows songs by;
+// ids matching no song are skipped.
 func getSongsByIDs(ids []string) ([]SubsonicSong, error) {
-	results, err := QuerySongsByIDs(db, ids)
+	resolved, err := resolveSongIDs(db, ids)
 	if err != nil {
 		return nil, err
 	}
+	current := make([]string, 0, len(resolved))
+	for _, id := range resolved {
+		current = append(current, id)
+	}
+	results, err := QuerySongsByIDs(db, current)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]SongResult, len(results))
+	for _, result := range results {
+		byID[result.ID] = result
+	}
 
 	// Convert to spec-aligned SubsonicSong (Child) format
 	var songs []SubsonicSong
-	for _, result := range results {
-		songs = append(songs, buildSubsonicSong(result))
+	for _, id := range ids {
+		if result, ok := byID[resolved[id]]; ok {
+			songs = append(songs, buildSubsonicSong(result))
+		}
 	}
 
 	return songs, nil
@@ -29,7 +45,7 @@ func getSongsByIDs(ids []string) ([]SubsonicSong, error) {
 
 func subsonicGetSimilarSongs(c *gin.Context) {
 	// Allow all authenticated users to request similar songs (Instant Mix).
-	_ = c.MustGet("user").(User)
+	user := c.MustGet("user").(User)
 
 	songId := c.Query("id")
 	count := c.DefaultQuery("count", "20")
@@ -39,7 +55,7 @@ func subsonicGetSimilarSongs(c *gin.Context) {
 		return
 	}
 
-	body, statusCode, err := audioMuseClient.GetSimilarTracks(c.Request.Context(), songId, count)
+	body, statusCode, err := audioMuseClient.GetSimilarTracks(c.Request.Context(), coreItemID(db, songId), count)
 	if err == ErrAudioMuse401 {
 		subsonicRespond(c, newSubsonicErrorResponse(0, "AudioMuse-AI authentication failed."))
 		return
@@ -74,6 +90,7 @@ func subsonicGetSimilarSongs(c *gin.Context) {
 		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error fetching song details."))
 		return
 	}
+	applySongRatings(user.ID, songs)
 
 	response := newSubsonicResponse(&SubsonicDirectory{
 		Name:      "Similar Songs",
@@ -95,7 +112,7 @@ func subsonicGetSongPath(c *gin.Context) {
 		return
 	}
 
-	body, statusCode, err := audioMuseClient.GetSongPath(c.Request.Context(), startId, endId)
+	body, statusCode, err := audioMuseClient.GetSongPath(c.Request.Context(), coreItemID(db, startId), coreItemID(db, endId))
 	if err == ErrAudioMuse401 {
 		subsonicRespond(c, newSubsonicErrorResponse(0, "AudioMuse-AI authentication failed."))
 		return
@@ -3,7 +3,9 @@ package main
 
 import (
 	"crypto/rand"
+	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -47,15 +49,32 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-// GenerateJWT creates a new JWT for a given user.
+// jwtTTL returns the lifetime of access tokens. Tokens are short-lived and the
+// web UI renews them via POST /api/v1/user/refresh; override with JWT_TTL (a Go
+// duration such as "30m" or "2h").
+func jwtTTL() time.Duration {
+	if ttl, err := time.ParseDuration(getEnv("JWT_TTL", "1h")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return time.Hour
+}
+
+// GenerateJWT creates a new JWT for a given user. Every token carries a random
+// jti so it can be revoked individually on logout.
 func GenerateJWT(userID int, username string, isAdmin bool) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	now := time.Now()
 	claims := &Claims{
 		UserID:   userID,
 		Username: username,
 		IsAdmin:  isAdmin,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			ID:        hex.EncodeToString(jti),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(jwtTTL())),
 		},
 	}
 
@@ -81,10 +100,62 @@ func parseJWT(tokenString string) (*Claims, error) {
 	if !token.Valid {
 		return nil, fmt.Errorf("invalid token")
 	}
+	revoked, err := isTokenRevoked(claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errRevocationCheck, err)
+	}
+	if revoked {
+		return nil, fmt.Errorf("token has been revoked")
+	}
 
 	return claims, nil
 }
 
+// errRevocationCheck is returned by parseJWT when the revocation list cannot
+// be read. The token is then neither trusted nor reported as invalid.
+var errRevocationCheck = errors.New("could not check token revocation")
+
+// isTokenRevoked reports whether the token with the given jti was logged out.
+// Tokens issued before jti support have an empty ID and cannot be revoked.
+func isTokenRevoked(jti string) (bool, error) {
+	if jti == "" || db == nil {
+		return false, nil
+	}
+	var revoked bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = ?)", jti).Scan(&revoked); err != nil {
+		log.Printf("Failed to check token revocation: %v", err)
+		return false, err
+	}
+	return revoked, nil
+}
+
+// revokeToken records a token's jti until its natural expiry, after which
+// cleanupRevokedTokens drops the row.
+func revokeToken(claims *Claims) error {
+	if claims.ID == "" {
+		return nil
+	}
+	expiresAt := time.Now().Add(jwtTTL())
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	_, err := db.Exec("INSERT OR IGNORE INTO revoked_tokens (jti, expires_at) VALUES (?, ?)", claims.ID, expiresAt.Unix())
+	return err
+}
+
+// cleanupRevokedTokens removes revocation entries for tokens that have expired
+// anyway.
+func cleanupRevokedTokens(db *sql.DB) {
+	res, err := db.Exec("DELETE FROM revoked_tokens WHERE expires_at < ?", time.Now().Unix())
+	if err != nil {
+		log.Printf("Revoked token cleanup failed: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("Revoked token cleanup: removed %d expired entries", n)
+	}
+}
+
 // AuthMiddleware is the middleware to protect routes.
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -104,6 +175,11 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		tokenString := parts[1]
 		claims, err := parseJWT(tokenString)
+		if errors.Is(err, errRevocationCheck) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Could not verify token, try again later"})
+			c.Abort()
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
@@ -113,6 +189,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		c.Set("userID", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("isAdmin", claims.IsAdmin)
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRefreshAndLogoutRevokesToken(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+	stmts := []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT UNIQUE NOT NULL, is_admin BOOLEAN NOT NULL DEFAULT 0)`,
+		`CREATE TABLE revoked_tokens (jti TEXT PRIMARY KEY NOT NULL, expires_at INTEGER NOT NULL)`,
+		`INSERT INTO users (id, username) VALUES (1, 'alice')`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+	jwtKey = []byte("test-key")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/user/refresh", AuthMiddleware(), refreshToken)
+	r.POST("/api/v1/user/logout", AuthMiddleware(), logoutUser)
+	r.GET("/api/v1/user/me", AuthMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	token, err := GenerateJWT(1, "alice", false)
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+	w := do(http.MethodPost, "/api/v1/user/refresh", token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh should succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Token == "" || body.Token == token {
+		t.Fatalf("refresh should return a new token, got %q", body.Token)
+	}
+
+	// Refreshing retires the old token.
+	if w := do(http.MethodGet, "/api/v1/user/me", token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("refreshed-away token should be rejected, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/api/v1/user/refresh", token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("refreshed-away token must not be refreshable again, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/api/v1/user/me", body.Token); w.Code != http.StatusOK {
+		t.Fatalf("refreshed token should be valid, got %d", w.Code)
+	}
+
+	if w := do(http.MethodPost, "/api/v1/user/logout", body.Token); w.Code != http.StatusOK {
+		t.Fatalf("logout should succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/api/v1/user/me", body.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("logged-out token should be rejected, got %d", w.Code)
+	}
+
+	// Expired revocation entries are cleaned up.
+	if _, err := db.Exec(`UPDATE revoked_tokens SET expires_at = 0`); err != nil {
+		t.Fatalf("age revocations: %v", err)
+	}
+	cleanupRevokedTokens(db)
+	var n int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM revoked_tokens`).Scan(&n)
+	if n != 0 {
+		t.Fatalf("expected expired revocations to be removed, %d left", n)
+	}
+}
+
+// A token whose revocation status cannot be read is refused with 503 rather
+// than accepted.
+func TestAuthMiddlewareFailsClosedOnRevocationError(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+	jwtKey = []byte("test-key")
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/v1/user/me", AuthMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	token, err := GenerateJWT(1, "alice", false)
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+	// No revoked_tokens table: the lookup fails.
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/user/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when revocation cannot be checked, got %d", w.Code)
+	}
+}
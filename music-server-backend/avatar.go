@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/gin-gonic/gin"
+)
+
+// User avatars. Uploads are decoded, cropped to a square and re-encoded as
+// PNG before they are stored in the avatars table, so whatever a client
+// uploads, getAvatar only ever serves a small, well-formed image. Users
+// without an avatar get an identicon derived from their username, so clients
+// never show a broken image.
+
+const (
+	avatarSize         = 256
+	avatarMaxPixels    = 4096 * 4096 // reject decompression bombs before decoding
+	identiconGrid      = 5
+	identiconCell      = 40
+	identiconMargin    = 20
+	avatarCacheControl = "private, max-age=300"
+)
+
+// subsonicGetAvatar handles getAvatar.view. Any authenticated user may fetch
+// any user's avatar by username.
+func subsonicGetAvatar(c *gin.Context) {
+	username := c.Query("username")
+	if username == "" {
+		subsonicRespond(c, newSubsonicErrorResponse(10, "Required parameter 'username' is missing."))
+		return
+	}
+
+	var userID int
+	if err := db.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&userID); err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(70, "User not found."))
+		return
+	}
+
+	var data []byte
+	err := db.QueryRow("SELECT image FROM avatars WHERE user_id = ?", userID).Scan(&data)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("getAvatar: failed to load avatar of %s: %v", username, err)
+	}
+	if len(data) == 0 {
+		data = identicon(username)
+	}
+	c.Header("Cache-Control", avatarCacheControl)
+	c.Data(http.StatusOK, "image/png", data)
+}
+
+// uploadAvatar handles POST /api/v1/user/avatar with the image (JPEG, PNG,
+// GIF, BMP or TIFF) in the multipart field "file".
+func uploadAvatar(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing image file"})
+		return
+	}
+	f, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read image file"})
+		return
+	}
+	raw, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read image file"})
+		return
+	}
+
+	data, err := normalizeAvatar(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported or invalid image"})
+		return
+	}
+	_, err = db.Exec(`INSERT INTO avatars (user_id, image, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET image = excluded.image, updated_at = excluded.updated_at`,
+		c.GetInt("userID"), data, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("uploadAvatar: failed to store avatar: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save avatar"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// deleteAvatar handles DELETE /api/v1/user/avatar, going back to the
+// identicon.
+func deleteAvatar(c *gin.Context) {
+	if _, err := db.Exec("DELETE FROM avatars WHERE user_id = ?", c.GetInt("userID")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove avatar"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// normalizeAvatar decodes an uploaded image and returns it center-cropped to
+// avatarSize square, as PNG.
+func normalizeAvatar(raw []byte) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > avatarMaxPixels {
+		return nil, image.ErrFormat
+	}
+	img, err := imaging.Decode(bytes.NewReader(raw), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, imaging.Fill(img, avatarSize, avatarSize, imaging.Center, imaging.Lanczos)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// identicon renders the classic mirrored 5x5 pattern for name, in a color
+// taken from the same hash, on a light background.
+func identicon(name string) []byte {
+	sum := sha256.Sum256([]byte(name))
+	fg := color.RGBA{R: sum[0]/2 + 64, G: sum[1]/2 + 64, B: sum[2]/2 + 64, A: 255}
+	bg := color.RGBA{R: 240, G: 240, B: 240, A: 255}
+
+	size := identiconGrid*identiconCell + 2*identiconMargin
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.SetRGBA(x, y, bg)
+		}
+	}
+	half := (identiconGrid + 1) / 2
+	for row := 0; row < identiconGrid; row++ {
+		for col := 0; col < half; col++ {
+			if sum[3+row*half+col]%2 == 0 {
+				continue
+			}
+			for _, cx := range []int{col, identiconGrid - 1 - col} {
+				x0, y0 := identiconMargin+cx*identiconCell, identiconMargin+row*identiconCell
+				for y := y0; y < y0+identiconCell; y++ {
+					for x := x0; x < x0+identiconCell; x++ {
+						img.SetRGBA(x, y, fg)
+					}
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
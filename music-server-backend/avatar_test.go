@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAvatarUploadAndGet(t *testing.T) {
+	d := scanTestDB(t)
+	for _, stmt := range []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT UNIQUE NOT NULL)`,
+		`INSERT INTO users (id, username) VALUES (1, 'alice'), (2, 'bob')`,
+		`CREATE TABLE avatars (user_id INTEGER PRIMARY KEY NOT NULL, image BLOB NOT NULL, updated_at TEXT NOT NULL)`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := gin.New()
+	r.GET("/rest/getAvatar", func(c *gin.Context) { c.Set("user", User{ID: 2}); subsonicGetAvatar(c) })
+	r.POST("/avatar", func(c *gin.Context) { c.Set("userID", 1); uploadAvatar(c) })
+	getAvatar := func(username string) image.Image {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rest/getAvatar?username="+username, nil))
+		if w.Header().Get("Content-Type") != "image/png" {
+			t.Fatalf("getAvatar(%s): %s %s", username, w.Header().Get("Content-Type"), w.Body.String())
+		}
+		img, err := png.Decode(w.Body)
+		if err != nil {
+			t.Fatalf("getAvatar(%s): %v", username, err)
+		}
+		return img
+	}
+	upload := func(data []byte) int {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", "me.png")
+		fw.Write(data)
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/avatar", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Without an upload, a stable identicon.
+	if size := getAvatar("alice").Bounds().Dx(); size != identiconGrid*identiconCell+2*identiconMargin {
+		t.Errorf("identicon size = %d", size)
+	}
+	if !bytes.Equal(identicon("alice"), identicon("alice")) || bytes.Equal(identicon("alice"), identicon("bob")) {
+		t.Error("identicons should be stable per name and differ between names")
+	}
+
+	var src bytes.Buffer
+	png.Encode(&src, image.NewRGBA(image.Rect(0, 0, 300, 200)))
+	if code := upload(src.Bytes()); code != http.StatusOK {
+		t.Fatalf("upload: %d", code)
+	}
+	if b := getAvatar("alice").Bounds(); b.Dx() != avatarSize || b.Dy() != avatarSize {
+		t.Errorf("stored avatar is %v", b)
+	}
+	if code := upload([]byte("not an image")); code != http.StatusBadRequest {
+		t.Errorf("upload of garbage: %d", code)
+	}
+	var huge bytes.Buffer
+	png.Encode(&huge, image.NewGray(image.Rect(0, 0, 4097, 4096)))
+	if code := upload(huge.Bytes()); code != http.StatusBadRequest {
+		t.Errorf("upload of %d pixels: %d", 4097*4096, code)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rest/getAvatar?username=nobody", nil))
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"code":70`)) && !bytes.Contains(w.Body.Bytes(), []byte(`code="70"`)) {
+		t.Errorf("unknown user: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// The artist index (getArtists/getIndexes), the genre list and the library
+// statistics are built with GROUP BY/DISTINCT queries over the whole library
+// but only change when a scan finishes. This cache keeps the finished response bodies in memory and is
+// cleared by invalidateBrowseCache at the end of every scan; the TTL is a
+// safety net so manual database edits still show up eventually.
+var (
+	browseCacheMu      sync.Mutex
+	browseCacheEntries = map[string]browseCacheEntry{}
+)
+
+type browseCacheEntry struct {
+	value   interface{}
+	builtAt time.Time
+}
+
+const browseCacheTTL = 10 * time.Minute
+
+const (
+	browseCacheArtists = "artists"
+	browseCacheIndexes = "indexes"
+	browseCacheGenres  = "genres"
+	browseCacheStats   = "stats"
+)
+
+// cachedBrowse returns the cached value for key, calling build to (re)create it
+// when missing or older than browseCacheTTL. Build errors are not cached.
+func cachedBrowse(key string, build func() (interface{}, error)) (interface{}, error) {
+	browseCacheMu.Lock()
+	if e, ok := browseCacheEntries[key]; ok && time.Since(e.builtAt) <= browseCacheTTL {
+		browseCacheMu.Unlock()
+		return e.value, nil
+	}
+	browseCacheMu.Unlock()
+
+	value, err := build()
+	if err != nil {
+		return nil, err
+	}
+	browseCacheMu.Lock()
+	browseCacheEntries[key] = browseCacheEntry{value: value, builtAt: time.Now()}
+	browseCacheMu.Unlock()
+	return value, nil
+}
+
+// invalidateBrowseCache drops every cached browse response. Call after a scan
+// has rebuilt the library index.
+func invalidateBrowseCache() {
+	browseCacheMu.Lock()
+	browseCacheEntries = map[string]browseCacheEntry{}
+	browseCacheMu.Unlock()
+}
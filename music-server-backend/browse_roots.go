@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// The admin folder browser only shows directories under the browse roots:
+// BROWSE_ROOTS (a list separated like PATH) when set, otherwise the library
+// paths and, outside Windows, the usual media mount points. A filesystem or
+// drive root ("/", "C:\") is never a browse root, wherever it comes from.
+// Directories above a root stay reachable so the browser can walk down from
+// "/", but only the entries that lead to a root are listed there. Roots and
+// requested paths are compared after resolving symlinks, so a link inside a
+// root cannot point the browser at the rest of the filesystem.
+
+var defaultUnixBrowseRoots = []string{"/music", "/media", "/mnt"}
+
+// browseRoots returns the resolved browse roots that exist.
+func browseRoots() []string {
+	var candidates []string
+	if env := os.Getenv("BROWSE_ROOTS"); env != "" {
+		candidates = filepath.SplitList(env)
+	} else {
+		if rows, err := db.Query("SELECT path FROM library_paths"); err == nil {
+			for rows.Next() {
+				var p string
+				if rows.Scan(&p) == nil {
+					candidates = append(candidates, p)
+				}
+			}
+			rows.Close()
+		}
+		if runtime.GOOS != "windows" {
+			candidates = append(candidates, defaultUnixBrowseRoots...)
+		}
+	}
+
+	var roots []string
+	for _, c := range candidates {
+		if c = strings.TrimSpace(c); c == "" {
+			continue
+		}
+		resolved, err := filepath.EvalSymlinks(c)
+		if err != nil {
+			continue
+		}
+		abs, err := filepath.Abs(resolved)
+		if err != nil || isFilesystemRoot(abs) || slices.Contains(roots, abs) {
+			continue
+		}
+		roots = append(roots, abs)
+	}
+	return roots
+}
+
+// isFilesystemRoot reports whether an absolute path is "/" or a drive root.
+func isFilesystemRoot(path string) bool {
+	return filepath.Dir(path) == path
+}
+
+// hasDotDot reports whether a requested path contains a ".." element.
+func hasDotDot(path string) bool {
+	return slices.Contains(strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '\\' }), "..")
+}
+
+// pathWithin reports whether path is dir or below it. Both must be clean and
+// absolute.
+func pathWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel))
+}
+
+// browseAccess classifies a resolved directory against the roots. inside is
+// true when everything in it may be listed; otherwise, if it is an ancestor
+// of some roots, toward holds the names of its entries that lead to them.
+func browseAccess(path string, roots []string) (inside bool, toward []string) {
+	for _, root := range roots {
+		if pathWithin(path, root) {
+			return true, nil
+		}
+	}
+	for _, root := range roots {
+		if !pathWithin(root, path) {
+			continue
+		}
+		rel, _ := filepath.Rel(path, root)
+		next, _, _ := strings.Cut(rel, string(filepath.Separator))
+		if !slices.Contains(toward, next) {
+			toward = append(toward, next)
+		}
+	}
+	return false, toward
+}
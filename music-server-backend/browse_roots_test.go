@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBrowseFilesSandbox(t *testing.T) {
+	scanTestDB(t)
+	base, _ := filepath.EvalSymlinks(t.TempDir())
+	for _, dir := range []string{"music/Artist A", "music/Artist B", "other", "secret"} {
+		os.MkdirAll(filepath.Join(base, dir), 0o755)
+	}
+	t.Setenv("BROWSE_ROOTS", filepath.Join(base, "music"))
+
+	r := gin.New()
+	r.GET("/browse", browseFiles)
+	browse := func(path string) (int, []string) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/browse?path="+url.QueryEscape(path), nil))
+		var resp struct{ Items []FileItem }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		var names []string
+		for _, item := range resp.Items {
+			names = append(names, item.Name)
+		}
+		return w.Code, names
+	}
+
+	if code, names := browse(base); code != http.StatusOK || !slices.Equal(names, []string{"music"}) {
+		t.Errorf("ancestor of the root: %d %v, want only the way to the root", code, names)
+	}
+	if code, names := browse(filepath.Join(base, "music")); code != http.StatusOK || len(names) != 2 {
+		t.Errorf("root: %d %v, want both artists", code, names)
+	}
+	if code, _ := browse(filepath.Join(base, "other")); code != http.StatusForbidden {
+		t.Errorf("sibling of the root: %d, want 403", code)
+	}
+	if code, _ := browse(filepath.Join(base, "music") + "/../secret"); code != http.StatusBadRequest {
+		t.Errorf("path with ..: %d, want 400", code)
+	}
+
+	if err := os.Symlink(filepath.Join(base, "secret"), filepath.Join(base, "music", "escape")); err == nil {
+		if code, _ := browse(filepath.Join(base, "music", "escape")); code != http.StatusForbidden {
+			t.Errorf("symlink out of the root: %d, want 403", code)
+		}
+	}
+}
+
+func TestBrowseRootsDefaults(t *testing.T) {
+	d := scanTestDB(t)
+	base, _ := filepath.EvalSymlinks(t.TempDir())
+	lib := filepath.Join(base, "library")
+	os.MkdirAll(lib, 0o755)
+	d.Exec(`INSERT INTO library_paths (id, path) VALUES (1, ?), (2, '/')`, lib)
+
+	t.Setenv("BROWSE_ROOTS", "")
+	roots := browseRoots()
+	if !slices.Contains(roots, lib) {
+		t.Errorf("roots %v should contain the library path %s", roots, lib)
+	}
+	for _, r := range roots {
+		if r == base || r == "/" {
+			t.Errorf("roots %v must not include %s", roots, r)
+		}
+	}
+
+	t.Setenv("BROWSE_ROOTS", string(filepath.Separator)+string(filepath.ListSeparator)+lib)
+	if roots := browseRoots(); !slices.Equal(roots, []string{lib}) {
+		t.Errorf("BROWSE_ROOTS roots = %v, want only %s", roots, lib)
+	}
+}
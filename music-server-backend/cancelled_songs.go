@@ -0,0 +1,219 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Songs are never deleted by a scan: a song whose file disappears, falls
+// outside every library path or is hidden as a duplicate is marked cancelled
+// and kept, with its stars and playlist entries, in case it comes back. The
+// songs_cancelled_at trigger stamps cancelled_at whenever cancelled goes from
+// 0 to 1 and clears it (and cancel_reason) when the song is restored, so every
+// code path that cancels a song is covered; the code paths that know why set
+// cancel_reason in the same UPDATE. Admins list them under
+// /api/v1/admin/cancelled, restore one whose file is back, or purge them for
+// good, either one at a time or by age.
+
+// Reasons stored in songs.cancel_reason.
+const (
+	cancelReasonMissing        = "missing"         // a scan or the watcher no longer found the file
+	cancelReasonOrphaned       = "orphaned"        // the file is outside every library path
+	cancelReasonDuplicate      = "duplicate"       // hidden as a copy of another song
+	cancelReasonLibraryRemoved = "library_removed" // its library path was deleted
+)
+
+const (
+	cancelledSongsDefaultLimit = 100
+	cancelledSongsMaxLimit     = 500
+)
+
+// songDependentTables hold rows keyed by song_id that a purge removes along
+// with the song.
+var songDependentTables = []string{"starred_songs", "playlist_songs", "play_history", "user_song_stats", "song_ratings", "song_tag_overrides", "bookmarks", "duplicates"}
+
+// ensureCancelledSongTracking stamps songs cancelled before cancelled_at
+// existed with the time of the migration, so the age-based purge counts from
+// then, and installs the songs_cancelled_at trigger.
+func ensureCancelledSongTracking(db *sql.DB) {
+	for _, stmt := range []string{
+		`UPDATE songs SET cancelled_at = strftime('%Y-%m-%dT%H:%M:%SZ', 'now') WHERE cancelled != 0 AND cancelled_at IS NULL`,
+		`CREATE TRIGGER IF NOT EXISTS songs_cancelled_at AFTER UPDATE OF cancelled ON songs WHEN new.cancelled != old.cancelled BEGIN
+			UPDATE songs SET
+				cancelled_at = CASE WHEN new.cancelled != 0 THEN strftime('%Y-%m-%dT%H:%M:%SZ', 'now') END,
+				cancel_reason = CASE WHEN new.cancelled != 0 THEN new.cancel_reason ELSE '' END
+			WHERE rowid = new.rowid;
+		END;`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			log.Printf("ensureCancelledSongTracking: warning - %v", err)
+		}
+	}
+}
+
+// CancelledSong is one row of GET /api/v1/admin/cancelled.
+type CancelledSong struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Artist      string `json:"artist"`
+	Album       string `json:"album"`
+	Path        string `json:"path"`
+	Reason      string `json:"reason"`
+	CancelledAt string `json:"cancelledAt,omitempty"`
+	FileExists  bool   `json:"fileExists"`
+}
+
+// getCancelledSongs handles GET /api/v1/admin/cancelled, most recently
+// cancelled first. It takes limit (default 100, at most 500), offset and an
+// optional reason, and returns the page with the total number of matching
+// songs. fileExists tells which songs can be restored.
+func getCancelledSongs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(cancelledSongsDefaultLimit)))
+	if err != nil || limit <= 0 {
+		limit = cancelledSongsDefaultLimit
+	}
+	limit = min(limit, cancelledSongsMaxLimit)
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	reason := c.Query("reason")
+
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM songs WHERE cancelled != 0 AND (? = '' OR cancel_reason = ?)`, reason, reason).Scan(&total); err != nil {
+		log.Printf("getCancelledSongs: count failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query cancelled songs"})
+		return
+	}
+	rows, err := db.Query(`SELECT id, COALESCE(title, ''), COALESCE(artist, ''), COALESCE(album, ''), path, cancel_reason, COALESCE(cancelled_at, '')
+		FROM songs WHERE cancelled != 0 AND (? = '' OR cancel_reason = ?)
+		ORDER BY cancelled_at DESC, path LIMIT ? OFFSET ?`, reason, reason, limit, offset)
+	if err != nil {
+		log.Printf("getCancelledSongs: query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query cancelled songs"})
+		return
+	}
+	defer rows.Close()
+
+	songs := []CancelledSong{}
+	for rows.Next() {
+		var s CancelledSong
+		if err := rows.Scan(&s.ID, &s.Title, &s.Artist, &s.Album, &s.Path, &s.Reason, &s.CancelledAt); err != nil {
+			continue
+		}
+		_, statErr := os.Stat(s.Path)
+		s.FileExists = statErr == nil
+		songs = append(songs, s)
+	}
+	c.JSON(http.StatusOK, gin.H{"songs": songs, "total": total, "limit": limit, "offset": offset})
+}
+
+// restoreCancelledSong handles POST /api/v1/admin/cancelled/:id/restore. The
+// song's file must exist again; a hidden duplicate is unhidden so the next
+// scan does not cancel it again.
+func restoreCancelledSong(c *gin.Context) {
+	id := c.Param("id")
+	var path string
+	err := db.QueryRow(`SELECT path FROM songs WHERE id = ? AND cancelled != 0`, id).Scan(&path)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cancelled song not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "The song's file does not exist: " + path})
+		return
+	}
+
+	if _, err := db.Exec(`UPDATE duplicates SET hidden = 0 WHERE song_id = ?`, id); err != nil {
+		log.Printf("restoreCancelledSong: unhiding duplicate %s: %v", id, err)
+	}
+	if _, err := db.Exec(`UPDATE songs SET cancelled = 0 WHERE id = ?`, id); err != nil {
+		log.Printf("restoreCancelledSong: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore song"})
+		return
+	}
+	refreshAfterCancelledChange()
+	c.JSON(http.StatusOK, gin.H{"message": "Song restored", "id": id})
+}
+
+// purgeCancelledSong handles DELETE /api/v1/admin/cancelled/:id.
+func purgeCancelledSong(c *gin.Context) {
+	n, err := purgeSongs(`SELECT id FROM songs WHERE id = ? AND cancelled != 0`, c.Param("id"))
+	if err != nil {
+		log.Printf("purgeCancelledSong: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge song"})
+		return
+	}
+	if n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cancelled song not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"purged": n})
+}
+
+// purgeCancelledSongs handles DELETE /api/v1/admin/cancelled?olderThanDays=N,
+// purging every song cancelled at least N days ago (0 purges them all).
+func purgeCancelledSongs(c *gin.Context) {
+	days, err := strconv.Atoi(c.Query("olderThanDays"))
+	if err != nil || days < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "olderThanDays must be a number of days (0 purges every cancelled song)"})
+		return
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -days).Format("2006-01-02T15:04:05Z")
+	n, err := purgeSongs(`SELECT id FROM songs WHERE cancelled != 0 AND (cancelled_at IS NULL OR cancelled_at <= ?)`, cutoff)
+	if err != nil {
+		log.Printf("purgeCancelledSongs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge songs"})
+		return
+	}
+	log.Printf("Purged %d songs cancelled more than %d days ago", n, days)
+	c.JSON(http.StatusOK, gin.H{"purged": n})
+}
+
+// purgeSongs deletes the songs selected by query, and their rows in
+// songDependentTables, in one transaction.
+func purgeSongs(query string, args ...interface{}) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	selected := "song_id IN (" + query + ")"
+	for _, table := range songDependentTables {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE "+selected, args...); err != nil && !strings.Contains(err.Error(), "no such table") {
+			return 0, err
+		}
+	}
+	res, err := tx.Exec("DELETE FROM songs WHERE id IN ("+query+")", args...)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	if n > 0 {
+		refreshAfterCancelledChange()
+	}
+	return n, nil
+}
+
+// refreshAfterCancelledChange rebuilds what is derived from the visible songs.
+func refreshAfterCancelledChange() {
+	invalidateArtistIDCache()
+	if err := RebuildLibraryIndex(db); err != nil {
+		log.Printf("RebuildLibraryIndex after cancelled songs change failed: %v", err)
+	}
+	invalidateBrowseCache()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCancelledSongsRestoreAndPurge(t *testing.T) {
+	d := scanTestDB(t)
+	ensureCancelledSongTracking(d)
+	back := filepath.Join(t.TempDir(), "back.mp3")
+	if err := os.WriteFile(back, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []struct{ id, path string }{{"back", back}, {"gone", "/nowhere/gone.mp3"}, {"recent", "/nowhere/recent.mp3"}} {
+		if _, err := d.Exec(`INSERT INTO songs (id, title, artist, album, path) VALUES (?, ?, 'A', 'B', ?)`, s.id, s.id, s.path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Exec(`UPDATE songs SET cancelled = 1, cancel_reason = ? WHERE id IN ('back', 'gone', 'recent')`, cancelReasonMissing)
+	d.Exec(`UPDATE songs SET cancelled_at = ? WHERE id = 'gone'`, time.Now().UTC().AddDate(0, 0, -40).Format("2006-01-02T15:04:05Z"))
+	d.Exec(`INSERT INTO starred_songs (user_id, song_id, starred_at) VALUES (1, 'gone', '2024-01-01')`)
+
+	r := gin.New()
+	r.GET("/cancelled", getCancelledSongs)
+	r.DELETE("/cancelled", purgeCancelledSongs)
+	r.POST("/cancelled/:id/restore", restoreCancelledSong)
+	r.DELETE("/cancelled/:id", purgeCancelledSong)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	w := do(http.MethodGet, "/cancelled")
+	var list struct {
+		Songs []CancelledSong `json:"songs"`
+		Total int             `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || list.Total != 3 {
+		t.Fatalf("list = %d %s, want 3 songs", w.Code, w.Body)
+	}
+	for _, s := range list.Songs {
+		if s.CancelledAt == "" || s.Reason != cancelReasonMissing || s.FileExists != (s.ID == "back") {
+			t.Errorf("listed %+v", s)
+		}
+	}
+
+	if w := do(http.MethodPost, "/cancelled/gone/restore"); w.Code != http.StatusConflict {
+		t.Errorf("restore without file = %d, want 409", w.Code)
+	}
+	if w := do(http.MethodPost, "/cancelled/back/restore"); w.Code != http.StatusOK {
+		t.Fatalf("restore = %d: %s", w.Code, w.Body)
+	}
+	var cancelled bool
+	var cancelledAt *string
+	var reason string
+	d.QueryRow(`SELECT cancelled, cancelled_at, cancel_reason FROM songs WHERE id = 'back'`).Scan(&cancelled, &cancelledAt, &reason)
+	if cancelled || cancelledAt != nil || reason != "" {
+		t.Errorf("restored song = (%v, %v, %q), want it no longer cancelled", cancelled, cancelledAt, reason)
+	}
+
+	if w := do(http.MethodDelete, "/cancelled?olderThanDays=x"); w.Code != http.StatusBadRequest {
+		t.Errorf("purge with bad age = %d, want 400", w.Code)
+	}
+	if w := do(http.MethodDelete, "/cancelled?olderThanDays=30"); w.Code != http.StatusOK || w.Body.String() != `{"purged":1}` {
+		t.Errorf("purge by age = %d %s, want only the old song", w.Code, w.Body)
+	}
+	var stars int
+	d.QueryRow(`SELECT COUNT(*) FROM starred_songs WHERE song_id = 'gone'`).Scan(&stars)
+	if stars != 0 {
+		t.Errorf("purged song still has %d stars", stars)
+	}
+	if w := do(http.MethodDelete, "/cancelled/back"); w.Code != http.StatusNotFound {
+		t.Errorf("purging a song that is not cancelled = %d, want 404", w.Code)
+	}
+	if w := do(http.MethodDelete, "/cancelled/recent"); w.Code != http.StatusOK {
+		t.Errorf("purge one = %d: %s", w.Code, w.Body)
+	}
+	var left int
+	d.QueryRow(`SELECT COUNT(*) FROM songs`).Scan(&left)
+	if left != 1 {
+		t.Errorf("songs left = %d, want 1", left)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// configSchema types the configuration keys the server reads, so
+// setConfiguration can refuse a value that would only fail later, at the next
+// scan or stream. Keys not listed here are stored as given; any other key
+// ending in _schedule must still be a cron expression.
+
+type configType string
+
+const (
+	configTypeString configType = "string"
+	configTypeBool   configType = "bool"
+	configTypeInt    configType = "int"
+	configTypeFloat  configType = "float"
+	configTypeEnum   configType = "enum"
+	configTypeCron   configType = "cron"
+)
+
+type configSpec struct {
+	Type     configType
+	Default  string
+	Min, Max float64  // inclusive bounds for int and float
+	Values   []string // allowed values for enum
+	// Check is an extra validation for string values.
+	Check func(string) error
+}
+
+func boolSetting(def string) configSpec { return configSpec{Type: configTypeBool, Default: def} }
+
+func intSetting(def string, min, max float64) configSpec {
+	return configSpec{Type: configTypeInt, Default: def, Min: min, Max: max}
+}
+
+var configSchema = map[string]configSpec{
+	// Scheduled tasks; see scan_schedule.go.
+	"scan_enabled":        boolSetting("true"),
+	"scan_schedule":       {Type: configTypeCron, Default: "0 2 * * *"},
+	"analysis_enabled":    boolSetting("false"),
+	"analysis_schedule":   {Type: configTypeCron, Default: "0 2 * * 0-5"},
+	"clustering_enabled":  boolSetting("false"),
+	"clustering_schedule": {Type: configTypeCron, Default: "0 2 * * 6"},
+
+	// Play history cleanup; see play_history_retention.go.
+	"play_history_retention_days": intSetting("0", 0, 100*365),
+
+	// Library scanning.
+	"follow_symlinks":         boolSetting("false"),
+	"watch_library":           boolSetting("false"),
+	"detect_duplicates":       boolSetting("false"),
+	"analyze_silence":         boolSetting("false"),
+	"scan_ignore_globs":       {Type: configTypeString, Default: defaultScanIgnoreGlobs},
+	"scan_stall_minutes":      intSetting("15", 0, 24*60),
+	"ffprobe_timeout_seconds": intSetting("30", 1, 3600),
+
+	// Browsing and search.
+	"use_album_artist":        boolSetting("false"),
+	"group_multi_disc_albums": boolSetting("true"),
+	"ignored_articles":        {Type: configTypeString, Default: defaultIgnoredArticles},
+	"search_substring_match":  boolSetting("false"),
+	"map_cache_seconds":       intSetting("60", 0, 24*60*60),
+	"cover_art_filenames":     {Type: configTypeString, Default: defaultCoverArtFilenames},
+	"cover_art_preference":    {Type: configTypeEnum, Default: coverArtPreferLargest, Values: []string{coverArtPreferLargest, coverArtPreferEmbedded, coverArtPreferFolder}},
+
+	// Streaming and transcoding.
+	"default_transcode_enabled":   boolSetting("false"),
+	"default_transcode_format":    {Type: configTypeEnum, Default: defaultTranscodeFormat, Values: []string{"mp3", "ogg", "aac", "opus"}},
+	"default_transcode_bitrate":   intSetting("128", minTranscodeBitrate, maxTranscodeBitrate),
+	"allow_lossless_direct":       boolSetting("false"),
+	"lan_cidrs":                   {Type: configTypeString, Check: func(v string) error { _, err := parseLANCIDRs(v); return err }},
+	"max_concurrent_transcodes":   intSetting("0", 0, 256),
+	"normalize_loudness":          boolSetting("false"),
+	"normalize_loudness_target":   {Type: configTypeFloat, Default: "-14", Min: -70, Max: -5},
+	"hls_segment_seconds":         intSetting("10", 2, 30),
+	"hls_session_timeout_seconds": intSetting("300", 60, 24*60*60),
+
+	// Sharing, jukebox and security.
+	"enable_shares":                boolSetting("false"),
+	"enable_jukebox":               boolSetting("false"),
+	"disable_plaintext_passwords":  boolSetting("false"),
+	"login_max_failures":           intSetting("5", 0, 1000),
+	"login_failure_window_seconds": intSetting("900", 1, 7*24*60*60),
+	"login_lockout_seconds":        intSetting("60", 1, 24*60*60),
+
+	// External services.
+	"audiomuse_ai_core_url":  {Type: configTypeString, Check: checkOptionalHTTPURL},
+	"audiomuse_ai_api_token": {Type: configTypeString},
+	"lastfm_api_key":         {Type: configTypeString},
+	"lastfm_api_secret":      {Type: configTypeString},
+}
+
+// configBool reads a boolean key. A missing row, or a value other than
+// "true"/"false" stored before the schema existed, reads as the schema default.
+func configBool(db *sql.DB, key string) bool {
+	switch value, _ := GetConfig(db, key); value {
+	case "true":
+		return true
+	case "false":
+		return false
+	default:
+		return configSchema[key].Default == "true"
+	}
+}
+
+// configInt reads a non-negative integer key, or fallback when it is missing
+// or unusable.
+func configInt(db *sql.DB, key string, fallback int) int {
+	value, err := GetConfig(db, key)
+	if err != nil || value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fallback
+	}
+	return n
+}
+
+// lookupConfigSpec returns the schema for key, treating unknown *_schedule
+// keys as cron expressions.
+func lookupConfigSpec(key string) (configSpec, bool) {
+	if spec, ok := configSchema[key]; ok {
+		return spec, true
+	}
+	if strings.HasSuffix(key, "_schedule") {
+		return configSpec{Type: configTypeCron}, true
+	}
+	return configSpec{}, false
+}
+
+// validateConfigValue checks value against key's schema and returns it in the
+// form the server reads back (booleans as "true"/"false", numbers trimmed).
+// Unknown keys are returned unchanged.
+func validateConfigValue(key, value string) (string, error) {
+	spec, ok := lookupConfigSpec(key)
+	if !ok {
+		return value, nil
+	}
+	switch spec.Type {
+	case configTypeBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("%s must be true or false", key)
+		}
+		return strconv.FormatBool(b), nil
+	case configTypeInt:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || float64(n) < spec.Min || float64(n) > spec.Max {
+			return "", fmt.Errorf("%s must be a whole number between %s and %s", key, strconv.FormatFloat(spec.Min, 'g', -1, 64), strconv.FormatFloat(spec.Max, 'g', -1, 64))
+		}
+		return strconv.Itoa(n), nil
+	case configTypeFloat:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || f < spec.Min || f > spec.Max {
+			return "", fmt.Errorf("%s must be a number between %s and %s", key, strconv.FormatFloat(spec.Min, 'g', -1, 64), strconv.FormatFloat(spec.Max, 'g', -1, 64))
+		}
+		return strings.TrimSpace(value), nil
+	case configTypeEnum:
+		for _, allowed := range spec.Values {
+			if value == allowed {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("%s must be one of: %s", key, strings.Join(spec.Values, ", "))
+	case configTypeCron:
+		if err := validateCronSchedule(value); err != nil {
+			return "", fmt.Errorf("%s: %v", key, err)
+		}
+		return strings.TrimSpace(value), nil
+	}
+	if spec.Check != nil {
+		if err := spec.Check(value); err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+func checkOptionalHTTPURL(value string) error {
+	if value == "" {
+		return nil
+	}
+	if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http(s) URL", value)
+	}
+	return nil
+}
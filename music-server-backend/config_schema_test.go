@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateConfigValue(t *testing.T) {
+	valid := []struct{ key, value, want string }{
+		{"enable_shares", "1", "true"},
+		{"watch_library", "FALSE", "false"},
+		{"hls_segment_seconds", " 6 ", "6"},
+		{"normalize_loudness_target", "-16.5", "-16.5"},
+		{"default_transcode_format", "opus", "opus"},
+		{"scan_schedule", "*/30 * * * *", "*/30 * * * *"},
+		{"lan_cidrs", "10.0.0.0/8", "10.0.0.0/8"},
+		{"audiomuse_ai_core_url", "http://audiomuse:8000", "http://audiomuse:8000"},
+		{"some_plugin_setting", "anything at all", "anything at all"},
+	}
+	for _, tc := range valid {
+		got, err := validateConfigValue(tc.key, tc.value)
+		if err != nil || got != tc.want {
+			t.Errorf("%s=%q: got %q, %v; want %q", tc.key, tc.value, got, err, tc.want)
+		}
+	}
+
+	invalid := []struct{ key, value string }{
+		{"enable_shares", "yes please"},
+		{"hls_segment_seconds", "1"},
+		{"default_transcode_bitrate", "128k"},
+		{"normalize_loudness_target", "0"},
+		{"default_transcode_format", "wav"},
+		{"analysis_schedule", "nightly"},
+		{"scan_schedule", ""},
+		{"custom_task_schedule", "61 * * * *"},
+		{"lan_cidrs", "10.0.0.0/40"},
+		{"audiomuse_ai_core_url", "audiomuse:8000"},
+	}
+	for _, tc := range invalid {
+		if _, err := validateConfigValue(tc.key, tc.value); err == nil {
+			t.Errorf("%s=%q should be rejected", tc.key, tc.value)
+		}
+	}
+}
+
+func TestValidateCronConfigValues(t *testing.T) {
+	keys := []string{"my_plugin_schedule"}
+	for key, spec := range configSchema {
+		if spec.Type == configTypeCron {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		if got, err := validateConfigValue(key, " 0 3 * * * "); err != nil || got != "0 3 * * *" {
+			t.Errorf("%s: got %q, %v for a valid expression", key, got, err)
+		}
+		for _, value := range []string{"", "   ", "nightly", "0 25 * * *", "* * * *"} {
+			_, err := validateConfigValue(key, value)
+			if err == nil {
+				t.Errorf("%s=%q should be rejected", key, value)
+			} else if !strings.Contains(err.Error(), key) {
+				t.Errorf("%s=%q: error %q does not name the key", key, value, err)
+			}
+		}
+	}
+}
+
+func TestSetConfigurationValidates(t *testing.T) {
+	scanTestDB(t)
+	gin.SetMode(gin.TestMode)
+	call := func(handler gin.HandlerFunc, rawQuery string) string {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/rest/x?f=json&"+rawQuery, nil)
+		c.Set("user", User{ID: 1, Username: "admin", IsAdmin: true})
+		handler(c)
+		return w.Body.String()
+	}
+
+	if body := call(subsonicSetConfiguration, "key=hls_segment_seconds&value=ten"); !strings.Contains(body, `"code":10`) {
+		t.Fatalf("a non-numeric value should be rejected: %s", body)
+	}
+	if _, err := GetConfig(db, "hls_segment_seconds"); err == nil {
+		t.Fatal("a rejected value must not be stored")
+	}
+
+	call(subsonicSetConfiguration, "key=enable_shares&value=1")
+	call(subsonicSetConfiguration, "key=my_note&value=hello")
+	body := call(subsonicGetConfiguration, "")
+	for _, want := range []string{
+		`{"name":"enable_shares","value":"true","type":"bool","default":"false"}`,
+		`{"name":"my_note","value":"hello"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("getConfiguration should contain %s: %s", want, body)
+		}
+	}
+}
+
+func TestConfigReaders(t *testing.T) {
+	d := scanTestDB(t)
+	if configBool(d, "watch_library") || !configBool(d, "group_multi_disc_albums") {
+		t.Fatal("unset keys should read as their schema defaults")
+	}
+	d.Exec(`INSERT INTO configuration (key, value) VALUES ('watch_library', 'true'), ('group_multi_disc_albums', 'false'),
+		('enable_shares', 'yes'), ('scan_stall_minutes', '-3'), ('map_cache_seconds', '30')`)
+	if !configBool(d, "watch_library") || configBool(d, "group_multi_disc_albums") {
+		t.Error("stored true/false should win over the defaults")
+	}
+	if configBool(d, "enable_shares") {
+		t.Error("a value that is not true/false should read as the default")
+	}
+	if got := configInt(db, "scan_stall_minutes", 15); got != 15 {
+		t.Errorf("negative int = %d, want the fallback", got)
+	}
+	if got := configInt(db, "map_cache_seconds", 60); got != 30 {
+		t.Errorf("map_cache_seconds = %d, want 30", got)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCorsMiddleware(t *testing.T) {
+	serve := func(allowedOrigin, method, origin string) *httptest.ResponseRecorder {
+		t.Setenv("ALLOWED_ORIGIN", allowedOrigin)
+		r := gin.New()
+		r.Use(corsMiddleware())
+		r.GET("/rest/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+		req := httptest.NewRequest(method, "/rest/ping", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	cases := []struct {
+		name, allowed, method, origin string
+		code                          int
+		allowOrigin, credentials      string
+	}{
+		{"wildcard", "*", "GET", "https://a.example", 200, "*", ""},
+		{"wildcard preflight", "", "OPTIONS", "https://a.example", 204, "*", ""},
+		{"listed origin", "https://a.example, https://b.example/", "GET", "https://b.example", 200, "https://b.example", "true"},
+		{"listed origin preflight", "https://a.example,https://b.example", "OPTIONS", "https://A.example", 204, "https://A.example", "true"},
+		{"unlisted origin", "https://a.example", "GET", "https://evil.example", 200, "", ""},
+		{"unlisted origin preflight", "https://a.example", "OPTIONS", "https://evil.example", 403, "", ""},
+		{"same-origin request", "https://a.example", "GET", "", 200, "", ""},
+	}
+	for _, tc := range cases {
+		w := serve(tc.allowed, tc.method, tc.origin)
+		if w.Code != tc.code {
+			t.Errorf("%s: status = %d, want %d", tc.name, w.Code, tc.code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tc.allowOrigin {
+			t.Errorf("%s: Allow-Origin = %q, want %q", tc.name, got, tc.allowOrigin)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tc.credentials {
+			t.Errorf("%s: Allow-Credentials = %q, want %q", tc.name, got, tc.credentials)
+		}
+		if got := w.Header().Get("Vary"); got != "Origin" {
+			t.Errorf("%s: Vary = %q, want Origin", tc.name, got)
+		}
+	}
+}
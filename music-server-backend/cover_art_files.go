@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Folder images are found by listing the directory once and matching every
+// image file, case-insensitively, against the newline-separated glob patterns
+// in the cover_art_filenames configuration key; any image whose name contains
+// "cover", "front" or "folder" qualifies as well. When several match, the
+// largest file wins, as it is usually the highest-resolution scan. Lines
+// starting with '#' are comments, as in scan_ignore_globs.
+//
+// The pick is cached per directory and reused until the directory's
+// modification time changes (an image added, removed or renamed), so serving
+// art for a grid of albums costs one stat per album instead of one per
+// candidate name.
+const defaultCoverArtFilenames = `cover.*
+folder.*
+front.*
+albumart*.*
+thumb.*
+artist.*`
+
+// When a song has both an embedded picture and a folder image,
+// cover_art_preference decides which one is served: embedded_first and
+// folder_first always take that source when it exists, largest (the default)
+// compares the images' pixel sizes, capped at the requested size, and keeps
+// the embedded picture unless the folder image is sharper at that size.
+const (
+	coverArtPreferLargest  = "largest"
+	coverArtPreferEmbedded = "embedded_first"
+	coverArtPreferFolder   = "folder_first"
+)
+
+// coverArtNameHints make an image a candidate whatever the patterns say.
+var coverArtNameHints = []string{"cover", "front", "folder"}
+
+// coverArtExtensions are the image files resizeAndServeImage can decode.
+var coverArtExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true, ".tif": true, ".tiff": true, ".webp": true,
+}
+
+// coverArtDirCacheMax bounds the per-directory cache; it is emptied when full.
+const coverArtDirCacheMax = 20000
+
+type coverArtDirEntry struct {
+	modTime  time.Time
+	patterns string
+	path     string
+}
+
+var coverArtDirCache = struct {
+	sync.Mutex
+	m map[string]coverArtDirEntry
+}{m: map[string]coverArtDirEntry{}}
+
+// coverArtFilenames reads cover_art_filenames, falling back to the defaults
+// when the key has never been set.
+func coverArtFilenames() string {
+	value, err := GetConfig(db, "cover_art_filenames")
+	if err != nil {
+		return defaultCoverArtFilenames
+	}
+	return value
+}
+
+// findLocalImage returns the folder image to use for the songs in dir.
+func findLocalImage(dir string) (string, bool) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", false
+	}
+	patterns := coverArtFilenames()
+
+	coverArtDirCache.Lock()
+	cached, ok := coverArtDirCache.m[dir]
+	coverArtDirCache.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.patterns == patterns {
+		return cached.path, cached.path != ""
+	}
+
+	path := pickCoverImage(dir, parseCoverArtPatterns(patterns))
+	coverArtDirCache.Lock()
+	if len(coverArtDirCache.m) >= coverArtDirCacheMax {
+		coverArtDirCache.m = map[string]coverArtDirEntry{}
+	}
+	coverArtDirCache.m[dir] = coverArtDirEntry{modTime: info.ModTime(), patterns: patterns, path: path}
+	coverArtDirCache.Unlock()
+	return path, path != ""
+}
+
+// parseCoverArtPatterns parses the setting like scan_ignore_globs and lowers
+// the patterns for case-insensitive matching.
+func parseCoverArtPatterns(value string) []string {
+	patterns := parseScanIgnoreGlobs(value)
+	for i, p := range patterns {
+		patterns[i] = strings.ToLower(p)
+	}
+	return patterns
+}
+
+// pickCoverImage returns the largest image in dir whose name matches patterns
+// or contains one of coverArtNameHints, or "" when there is none.
+func pickCoverImage(dir string, patterns []string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	best, bestSize := "", int64(-1)
+	for _, e := range entries {
+		name := strings.ToLower(e.Name())
+		if e.IsDir() || !coverArtExtensions[filepath.Ext(name)] || !isCoverArtName(name, patterns) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		// Entries come sorted by name, so ties go to the first name.
+		if info.Size() > bestSize {
+			best, bestSize = filepath.Join(dir, e.Name()), info.Size()
+		}
+	}
+	return best
+}
+
+// isCoverArtName reports whether the lower-cased file name is a cover
+// candidate.
+func isCoverArtName(name string, patterns []string) bool {
+	for _, hint := range coverArtNameHints {
+		if strings.Contains(name, hint) {
+			return true
+		}
+	}
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// coverArtPreference reads cover_art_preference, defaulting to largest.
+func coverArtPreference() string {
+	value, err := GetConfig(db, "cover_art_preference")
+	if err != nil || value == "" {
+		return coverArtPreferLargest
+	}
+	return value
+}
+
+// useFolderArt reports whether the folder image at folderPath should be served
+// instead of the embedded picture, for a request of size pixels.
+func useFolderArt(pref string, embedded []byte, folderPath string, size int) bool {
+	switch pref {
+	case coverArtPreferEmbedded:
+		return false
+	case coverArtPreferFolder:
+		return true
+	}
+	if size <= 0 {
+		size = math.MaxInt
+	}
+	folder, err := os.Open(folderPath)
+	if err != nil {
+		return false
+	}
+	defer folder.Close()
+	return min(imageLongSide(folder), size) > min(imageLongSide(bytes.NewReader(embedded)), size)
+}
+
+// imageLongSide returns the longer side of an encoded image from its header,
+// or 0 when the format is unknown.
+func imageLongSide(r io.Reader) int {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0
+	}
+	return max(cfg.Width, cfg.Height)
+}
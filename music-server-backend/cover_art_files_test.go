@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFindLocalImagePicksLargestMatch(t *testing.T) {
+	d := scanTestDB(t)
+	dir := t.TempDir()
+	write := func(name string, size int) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("AlbumArt.JPG", 10)
+	write("Front Cover.png", 20)
+	write("scan.jpg", 90)
+	write("cover.txt", 99)
+
+	if got, ok := findLocalImage(dir); !ok || filepath.Base(got) != "Front Cover.png" {
+		t.Fatalf("findLocalImage = %q, %v; want Front Cover.png", got, ok)
+	}
+
+	// A new image changes the directory's mtime, which drops the cached pick.
+	write("THUMB.jpg", 50)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(dir, later, later)
+	if got, _ := findLocalImage(dir); filepath.Base(got) != "THUMB.jpg" {
+		t.Errorf("after adding a larger image findLocalImage = %q, want THUMB.jpg", got)
+	}
+
+	// So does changing the patterns.
+	d.Exec(`INSERT OR REPLACE INTO configuration (key, value) VALUES ('cover_art_filenames', 'SCAN.*')`)
+	if got, _ := findLocalImage(dir); filepath.Base(got) != "scan.jpg" {
+		t.Errorf("with scan.* configured findLocalImage = %q, want scan.jpg", got)
+	}
+
+	if _, ok := findLocalImage(t.TempDir()); ok {
+		t.Error("findLocalImage found an image in an empty directory")
+	}
+}
+
+func TestUseFolderArtComparesPixelsUpToRequestedSize(t *testing.T) {
+	encode := func(side int) []byte {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, side, side))); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	dir := t.TempDir()
+	big := filepath.Join(dir, "cover.png")
+	small := filepath.Join(dir, "folder.png")
+	os.WriteFile(big, encode(600), 0o644)
+	os.WriteFile(small, encode(100), 0o644)
+	thumb, large := encode(100), encode(600)
+
+	cases := []struct {
+		pref     string
+		embedded []byte
+		folder   string
+		size     int
+		want     bool
+	}{
+		{coverArtPreferLargest, thumb, big, 512, true},
+		{coverArtPreferLargest, thumb, big, 64, false}, // both cover the request
+		{coverArtPreferLargest, large, small, 512, false},
+		{coverArtPreferLargest, thumb, filepath.Join(dir, "missing.png"), 512, false},
+		{coverArtPreferEmbedded, thumb, big, 512, false},
+		{coverArtPreferFolder, large, small, 512, true},
+	}
+	for _, tc := range cases {
+		if got := useFolderArt(tc.pref, tc.embedded, tc.folder, tc.size); got != tc.want {
+			t.Errorf("useFolderArt(%s, %s, size %d) = %v, want %v", tc.pref, filepath.Base(tc.folder), tc.size, got, tc.want)
+		}
+	}
+}
@@ -3,7 +3,11 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"path/filepath"
+	"slices"
 	"strings"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 // ============================================================================
@@ -29,13 +33,18 @@ type AlbumQueryOptions struct {
 	Limit           int    // Limit results (0 = no limit)
 	Offset          int    // Offset for pagination
 	OrderBy         string // Order clause (default: "album COLLATE NOCASE")
-	IncludeAlbumID  bool   // Include MIN(id) as albumId
+	IncludeAlbumID  bool   // Include the album id (see album_key.go)
 	IncludeGenre    bool   // Include genre
 	IncludeArtist   bool   // Include effective artist
 	IncludeDuration bool   // Include SUM(duration) as total_duration (requires GroupByPath)
 	IncludeCreated  bool   // Include MIN(date_added) as created (requires GroupByPath)
 }
 
+// AlbumOrderRecentlyAdded is an AlbumQueryOptions.OrderBy listing albums
+// newest first by the date their first song was added. It needs
+// IncludeCreated and GroupByPath.
+const AlbumOrderRecentlyAdded = "created DESC, songs.album COLLATE NOCASE"
+
 // SongQueryOptions defines options for song queries
 type SongQueryOptions struct {
 	Artist           string   // Filter by artist
@@ -53,11 +62,17 @@ type SongQueryOptions struct {
 	OrderBy          string   // Order clause (default: "artist, album, title")
 	IncludeTranscode bool     // Include transcoding settings
 	OnlyStarred      bool     // Only return starred songs
+
+	// Where is an extra condition on the songs table (aliased s), with its
+	// arguments in WhereArgs; smart playlists build it from their rules.
+	Where     string
+	WhereArgs []interface{}
 }
 
 // ArtistResult represents an artist query result
 type ArtistResult struct {
 	Name       string
+	SortName   string // see sort_name.go
 	AlbumCount int
 	SongCount  int
 }
@@ -65,6 +80,7 @@ type ArtistResult struct {
 // AlbumResult represents an album query result
 type AlbumResult struct {
 	Name      string
+	SortName  string // see sort_name.go
 	AlbumPath string
 	Artist    string
 	Genre     string
@@ -90,7 +106,7 @@ type SongResult struct {
 	// Fields below carry the data needed to build a fully spec-aligned
 	// OpenSubsonic Child object (see buildSubsonicSong).
 	AlbumArtist  string // album_artist tag
-	AlbumID      string // representative album id (MIN(id) over album_path)
+	AlbumID      string // album id (see album_key.go)
 	Created      string // date_added (RFC3339)
 	Track        int    // track number (0 = unknown)
 	Year         int    // release year (0 = unknown)
@@ -146,11 +162,23 @@ func QueryArtists(db *sql.DB, opts ArtistQueryOptions) ([]ArtistResult, error) {
 	var query strings.Builder
 	var args []interface{}
 
+	// With UseEffectiveArtist, counts are grouped by album artist (falling back
+	// to the track artist) instead of the raw artist tag.
+	nameExpr := "songs.artist"
+	if opts.UseEffectiveArtist {
+		nameExpr = `CASE
+			WHEN songs.album_artist IS NOT NULL AND TRIM(songs.album_artist) != ''
+				AND LOWER(TRIM(songs.album_artist)) NOT IN ('unknown','unknown artist')
+			THEN songs.album_artist
+			ELSE songs.artist
+		END`
+	}
+
 	// Build SELECT clause
 	if opts.IncludeCounts {
 		query.WriteString(`
 			SELECT
-				songs.artist AS name,
+				` + nameExpr + ` AS name,
 				COUNT(*) as song_count,
 				COUNT(DISTINCT CASE
 					WHEN songs.album != '' AND songs.album_path != ''
@@ -189,44 +217,26 @@ func QueryArtists(db *sql.DB, opts ArtistQueryOptions) ([]ArtistResult, error) {
 		whereClauses = append(whereClauses, "songs.artist != ''")
 	}
 
-	// Search filter (support multi-word AND semantics, prefer FTS when possible)
+	// Search filter (query syntax in search_query.go, FTS when possible)
 	if opts.SearchTerm != "" {
-		if ftsAvailable(db) {
-			// join FTS table and match
-			ftsQuery := buildFTSQuery(opts.SearchTerm)
-			query.WriteString(" JOIN songs_fts f ON f.rowid = songs.rowid")
-			whereClauses = append(whereClauses, "songs_fts MATCH ?")
-			args = append(args, ftsQuery)
-		} else {
-			words := strings.Fields(opts.SearchTerm)
-			var termClauses []string
-			if opts.UseEffectiveArtist {
-				for _, w := range words {
-					termClauses = append(termClauses, "(artist LIKE ? OR album_artist LIKE ?)")
-					p := "%" + w + "%"
-					args = append(args, p, p)
-				}
-			} else {
-				for _, w := range words {
-					termClauses = append(termClauses, "artist LIKE ?")
-					args = append(args, "%"+w+"%")
-				}
-			}
-			whereClauses = append(whereClauses, strings.Join(termClauses, " AND "))
-		}
+		join, where, searchArgs := songSearchFilter(db, "songs", opts.SearchTerm, searchScopeArtist)
+		query.WriteString(join)
+		whereClauses = append(whereClauses, where)
+		args = append(args, searchArgs...)
 	}
 
 	query.WriteString(" WHERE " + strings.Join(whereClauses, " AND "))
 
 	// GROUP BY for aggregation
 	if opts.IncludeCounts {
-		query.WriteString(" GROUP BY songs.artist")
+		query.WriteString(" GROUP BY " + nameExpr)
 	}
 
-	// ORDER BY
+	// ORDER BY, by default on the stored sort name (see sort_name.go)
+	articles := ignoredArticles(db)
 	orderBy := opts.OrderBy
 	if orderBy == "" {
-		orderBy = "songs.artist COLLATE NOCASE"
+		orderBy = artistSortNameSQL(nameExpr) + ", " + nameExpr + " COLLATE NOCASE"
 	}
 	query.WriteString(" ORDER BY " + orderBy)
 
@@ -264,6 +274,8 @@ func QueryArtists(db *sql.DB, opts ArtistQueryOptions) ([]ArtistResult, error) {
 			}
 		}
 
+		result.SortName = sortName(result.Name, articles)
+
 		// Deduplicate if not using aggregation
 		if !opts.IncludeCounts {
 			key := normalizeKey(result.Name)
@@ -315,10 +327,6 @@ func QueryAlbums(db *sql.DB, opts AlbumQueryOptions) ([]AlbumResult, error) {
 		selectFields = append(selectFields, "COALESCE(genre, '') as genre")
 	}
 
-	if opts.IncludeAlbumID {
-		selectFields = append(selectFields, "MIN(id) as albumId")
-	}
-
 	if opts.IncludeCounts {
 		selectFields = append(selectFields, "COUNT(*) as song_count")
 	}
@@ -346,27 +354,17 @@ func QueryAlbums(db *sql.DB, opts AlbumQueryOptions) ([]AlbumResult, error) {
 	}
 
 	if opts.SearchTerm != "" {
-		if ftsAvailable(db) {
-			// join FTS and filter
-			query.WriteString(" JOIN songs_fts f ON f.rowid = songs.rowid")
-			whereClauses = append(whereClauses, "songs_fts MATCH ?")
-			args = append(args, buildFTSQuery(opts.SearchTerm))
-		} else {
-			words := strings.Fields(opts.SearchTerm)
-			var termClauses []string
-			for _, w := range words {
-				termClauses = append(termClauses, "(album LIKE ? OR artist LIKE ? OR album_artist LIKE ?)")
-				p := "%" + w + "%"
-				args = append(args, p, p, p)
-			}
-			whereClauses = append(whereClauses, strings.Join(termClauses, " AND "))
-		}
+		join, where, searchArgs := songSearchFilter(db, "songs", opts.SearchTerm, searchScopeAlbum)
+		query.WriteString(join)
+		whereClauses = append(whereClauses, where)
+		args = append(args, searchArgs...)
 	}
 
 	query.WriteString(" WHERE " + strings.Join(whereClauses, " AND "))
 
 	// GROUP BY for aggregation or path grouping
 	if opts.GroupByPath {
+		// Mirrors AlbumKey.
 		query.WriteString(` GROUP BY CASE
 			WHEN songs.album_path IS NOT NULL AND songs.album_path != ''
 			THEN songs.album_path || '|||' || songs.album
@@ -374,13 +372,13 @@ func QueryAlbums(db *sql.DB, opts AlbumQueryOptions) ([]AlbumResult, error) {
 		END`)
 	}
 
-	// ORDER BY
+	// ORDER BY, by default on the stored sort names (see sort_name.go)
+	articles := ignoredArticles(db)
 	orderBy := opts.OrderBy
 	if orderBy == "" {
+		orderBy = albumSortNameSQL("songs") + ", songs.album COLLATE NOCASE"
 		if opts.IncludeArtist {
-			orderBy = "effective_artist COLLATE NOCASE, songs.album COLLATE NOCASE"
-		} else {
-			orderBy = "songs.album COLLATE NOCASE"
+			orderBy = artistSortNameSQL("COALESCE(NULLIF(songs.album_artist, ''), songs.artist)") + ", " + orderBy
 		}
 	}
 	query.WriteString(" ORDER BY " + orderBy)
@@ -408,7 +406,6 @@ func QueryAlbums(db *sql.DB, opts AlbumQueryOptions) ([]AlbumResult, error) {
 		var result AlbumResult
 		var albumPath sql.NullString
 		var genre sql.NullString
-		var albumID sql.NullString
 
 		scanArgs := []interface{}{&result.Name}
 
@@ -422,10 +419,6 @@ func QueryAlbums(db *sql.DB, opts AlbumQueryOptions) ([]AlbumResult, error) {
 			scanArgs = append(scanArgs, &genre)
 		}
 
-		if opts.IncludeAlbumID {
-			scanArgs = append(scanArgs, &albumID)
-		}
-
 		if opts.IncludeCounts {
 			scanArgs = append(scanArgs, &result.SongCount)
 		}
@@ -449,12 +442,15 @@ func QueryAlbums(db *sql.DB, opts AlbumQueryOptions) ([]AlbumResult, error) {
 		if genre.Valid {
 			result.Genre = genre.String
 		}
-		if albumID.Valid {
-			result.AlbumID = albumID.String
+		// The album id covers the whole album, not just the songs that matched
+		// a search, so it agrees with getAlbumList2 and getAlbum.
+		if opts.IncludeAlbumID {
+			result.AlbumID = AlbumID(result.Name, result.AlbumPath)
 		}
 		if created.Valid {
 			result.Created = created.String
 		}
+		result.SortName = sortName(result.Name, articles)
 
 		results = append(results, result)
 	}
@@ -526,10 +522,9 @@ func QuerySongs(db *sql.DB, opts SongQueryOptions) ([]SongResult, error) {
 	var args []interface{}
 
 	// Build SELECT clause. The fixed columns after last_played carry the data
-	// needed for a fully spec-aligned OpenSubsonic Child object. The album_id
-	// correlated subquery resolves each song's representative album id via the
-	// idx_songs_albumpath_id index (album_path, id) so MIN(id) is an index seek.
-	query.WriteString(`SELECT s.id, s.title, s.artist, s.album, s.path, s.duration, s.play_count, s.last_played, COALESCE(s.album_artist, ''), COALESCE(s.date_added, ''), s.replaygain_track_gain, s.replaygain_track_peak, s.replaygain_album_gain, s.replaygain_album_peak, (SELECT MIN(s2.id) FROM songs s2 WHERE s2.album_path = s.album_path AND s2.cancelled = 0) AS album_id, COALESCE(s.track, 0), COALESCE(s.year, 0), COALESCE(s.disc_number, 0), COALESCE(s.size, 0), COALESCE(s.bitrate, 0), COALESCE(s.sample_rate, 0), COALESCE(s.channels, 0), COALESCE(s.bit_depth, 0), COALESCE(s.comment, '')`)
+	// needed for a fully spec-aligned OpenSubsonic Child object; album_path
+	// gives each song its album id (see album_key.go).
+	query.WriteString(`SELECT s.id, s.title, s.artist, s.album, s.path, s.duration, s.play_count, s.last_played, COALESCE(s.album_artist, ''), COALESCE(s.date_added, ''), s.replaygain_track_gain, s.replaygain_track_peak, s.replaygain_album_gain, s.replaygain_album_peak, COALESCE(s.album_path, '') AS album_path, COALESCE(s.track, 0), COALESCE(s.year, 0), COALESCE(s.disc_number, 0), COALESCE(s.size, 0), COALESCE(s.bitrate, 0), COALESCE(s.sample_rate, 0), COALESCE(s.channels, 0), COALESCE(s.bit_depth, 0), COALESCE(s.comment, '')`)
 
 	if opts.IncludeGenre {
 		query.WriteString(`, COALESCE(s.genre, '') as genre`)
@@ -580,20 +575,10 @@ func QuerySongs(db *sql.DB, opts SongQueryOptions) ([]SongResult, error) {
 	}
 
 	if opts.SearchTerm != "" {
-		if ftsAvailable(db) {
-			query.WriteString(" JOIN songs_fts f ON f.rowid = s.rowid")
-			whereClauses = append(whereClauses, "songs_fts MATCH ?")
-			args = append(args, buildFTSQuery(opts.SearchTerm))
-		} else {
-			words := strings.Fields(opts.SearchTerm)
-			var termClauses []string
-			for _, w := range words {
-				termClauses = append(termClauses, "(s.title LIKE ? OR s.artist LIKE ? OR s.album LIKE ?)")
-				p := "%" + w + "%"
-				args = append(args, p, p, p)
-			}
-			whereClauses = append(whereClauses, strings.Join(termClauses, " AND "))
-		}
+		join, where, searchArgs := songSearchFilter(db, "s", opts.SearchTerm, searchScopeSong)
+		query.WriteString(join)
+		whereClauses = append(whereClauses, where)
+		args = append(args, searchArgs...)
 	}
 
 	if len(opts.IDs) > 0 {
@@ -608,6 +593,11 @@ func QuerySongs(db *sql.DB, opts SongQueryOptions) ([]SongResult, error) {
 		whereClauses = append(whereClauses, "ss.song_id IS NOT NULL")
 	}
 
+	if opts.Where != "" {
+		whereClauses = append(whereClauses, "("+opts.Where+")")
+		args = append(args, opts.WhereArgs...)
+	}
+
 	query.WriteString(" WHERE " + strings.Join(whereClauses, " AND "))
 
 	// ORDER BY
@@ -655,13 +645,13 @@ func QuerySongs(db *sql.DB, opts SongQueryOptions) ([]SongResult, error) {
 		var albumArtist sql.NullString
 		var created sql.NullString
 		var rgTrackGain, rgTrackPeak, rgAlbumGain, rgAlbumPeak sql.NullFloat64
-		var albumID sql.NullString
+		var albumPath sql.NullString
 		var trackInt, yearInt, discInt sql.NullInt64
 
 		scanArgs := []interface{}{
 			&result.ID, &title, &artist, &album,
 			&path, &durationInt, &playCountInt, &lastPlayed,
-			&albumArtist, &created, &rgTrackGain, &rgTrackPeak, &rgAlbumGain, &rgAlbumPeak, &albumID,
+			&albumArtist, &created, &rgTrackGain, &rgTrackPeak, &rgAlbumGain, &rgAlbumPeak, &albumPath,
 			&trackInt, &yearInt, &discInt,
 			&result.Size, &result.BitRate, &result.SamplingRate, &result.ChannelCount, &result.BitDepth, &result.Comment,
 		}
@@ -711,9 +701,7 @@ func QuerySongs(db *sql.DB, opts SongQueryOptions) ([]SongResult, error) {
 		if created.Valid {
 			result.Created = created.String
 		}
-		if albumID.Valid {
-			result.AlbumID = albumID.String
-		}
+		result.AlbumID = AlbumID(result.Album, albumPath.String)
 		result.Track = int(trackInt.Int64)
 		result.Year = int(yearInt.Int64)
 		result.DiscNumber = int(discInt.Int64)
@@ -788,7 +776,7 @@ func QuerySimilarSongs(db *sql.DB, songID string, limit int) ([]SongResult, erro
 		SELECT s.id, s.title, s.artist, s.album, s.path, s.play_count, s.last_played, COALESCE(s.genre, ''), s.duration,
 			COALESCE(s.album_artist, ''), COALESCE(s.date_added, ''),
 			s.replaygain_track_gain, s.replaygain_track_peak, s.replaygain_album_gain, s.replaygain_album_peak,
-			(SELECT MIN(s2.id) FROM songs s2 WHERE s2.album_path = s.album_path AND s2.cancelled = 0) AS album_id,
+			COALESCE(s.album_path, '') AS album_path,
 			COALESCE(s.track, 0), COALESCE(s.year, 0), COALESCE(s.disc_number, 0),
 			COALESCE(s.size, 0), COALESCE(s.bitrate, 0), COALESCE(s.sample_rate, 0), COALESCE(s.channels, 0), COALESCE(s.bit_depth, 0), COALESCE(s.comment, '')
 		FROM songs s
@@ -814,13 +802,13 @@ func QuerySimilarSongs(db *sql.DB, songID string, limit int) ([]SongResult, erro
 		var result SongResult
 		var lastPlayed sql.NullString
 		var genreVal sql.NullString
-		var albumArtist, created, albumID sql.NullString
+		var albumArtist, created, albumPath sql.NullString
 		var rgTrackGain, rgTrackPeak, rgAlbumGain, rgAlbumPeak sql.NullFloat64
 		var trackInt, yearInt, discInt sql.NullInt64
 
 		if err := rows.Scan(&result.ID, &result.Title, &result.Artist, &result.Album,
 			&result.Path, &result.PlayCount, &lastPlayed, &genreVal, &result.Duration,
-			&albumArtist, &created, &rgTrackGain, &rgTrackPeak, &rgAlbumGain, &rgAlbumPeak, &albumID,
+			&albumArtist, &created, &rgTrackGain, &rgTrackPeak, &rgAlbumGain, &rgAlbumPeak, &albumPath,
 			&trackInt, &yearInt, &discInt,
 			&result.Size, &result.BitRate, &result.SamplingRate, &result.ChannelCount, &result.BitDepth, &result.Comment); err != nil {
 			continue
@@ -838,9 +826,7 @@ func QuerySimilarSongs(db *sql.DB, songID string, limit int) ([]SongResult, erro
 		if created.Valid {
 			result.Created = created.String
 		}
-		if albumID.Valid {
-			result.AlbumID = albumID.String
-		}
+		result.AlbumID = AlbumID(result.Album, albumPath.String)
 		result.Track = int(trackInt.Int64)
 		result.Year = int(yearInt.Int64)
 		result.DiscNumber = int(discInt.Int64)
@@ -863,14 +849,9 @@ func CountSongs(db *sql.DB, searchTerm string) (int, error) {
 	var args []interface{}
 
 	if searchTerm != "" {
-		if ftsAvailable(db) {
-			query = `SELECT COUNT(*) FROM songs JOIN songs_fts f ON f.rowid = songs.rowid WHERE songs_fts MATCH ? AND cancelled = 0`
-			args = []interface{}{buildFTSQuery(searchTerm)}
-		} else {
-			query = `SELECT COUNT(*) FROM songs WHERE (title LIKE ? OR artist LIKE ? OR album LIKE ?) AND cancelled = 0`
-			searchPattern := "%" + searchTerm + "%"
-			args = []interface{}{searchPattern, searchPattern, searchPattern}
-		}
+		join, where, searchArgs := songSearchFilter(db, "songs", searchTerm, searchScopeSong)
+		query = `SELECT COUNT(*) FROM songs` + join + ` WHERE ` + where + ` AND cancelled = 0`
+		args = searchArgs
 	} else {
 		query = `SELECT COUNT(*) FROM songs WHERE cancelled = 0`
 	}
@@ -887,24 +868,14 @@ func CountArtists(db *sql.DB, searchTerm string, useEffective bool) (int, error)
 
 	if useEffective {
 		if searchTerm != "" {
-			if ftsAvailable(db) {
-				query = `SELECT COUNT(DISTINCT CASE
-					WHEN songs.album_artist IS NOT NULL AND TRIM(songs.album_artist) != ''
-						AND LOWER(TRIM(songs.album_artist)) NOT IN ('unknown','unknown artist')
-					THEN songs.album_artist ELSE songs.artist END)
-				FROM songs JOIN songs_fts f ON f.rowid = songs.rowid
-				WHERE songs_fts MATCH ? AND cancelled = 0`
-				args = []interface{}{buildFTSQuery(searchTerm)}
-			} else {
-				query = `SELECT COUNT(DISTINCT CASE
-					WHEN album_artist IS NOT NULL AND TRIM(album_artist) != ''
-						AND LOWER(TRIM(album_artist)) NOT IN ('unknown','unknown artist')
-					THEN album_artist ELSE artist END)
-				FROM songs
-				WHERE (artist LIKE ? OR album_artist LIKE ?) AND cancelled = 0`
-				searchPattern := "%" + searchTerm + "%"
-				args = []interface{}{searchPattern, searchPattern}
-			}
+			join, where, searchArgs := songSearchFilter(db, "songs", searchTerm, searchScopeArtist)
+			query = `SELECT COUNT(DISTINCT CASE
+				WHEN songs.album_artist IS NOT NULL AND TRIM(songs.album_artist) != ''
+					AND LOWER(TRIM(songs.album_artist)) NOT IN ('unknown','unknown artist')
+				THEN songs.album_artist ELSE songs.artist END)
+			FROM songs` + join + `
+			WHERE ` + where + ` AND cancelled = 0`
+			args = searchArgs
 		} else {
 			query = `SELECT COUNT(DISTINCT CASE
 				WHEN album_artist IS NOT NULL AND TRIM(album_artist) != ''
@@ -914,13 +885,9 @@ func CountArtists(db *sql.DB, searchTerm string, useEffective bool) (int, error)
 		}
 	} else {
 		if searchTerm != "" {
-			if ftsAvailable(db) {
-				query = `SELECT COUNT(DISTINCT songs.artist) FROM songs JOIN songs_fts f ON f.rowid = songs.rowid WHERE songs_fts MATCH ? AND songs.artist != '' AND cancelled = 0`
-				args = []interface{}{buildFTSQuery(searchTerm)}
-			} else {
-				query = `SELECT COUNT(DISTINCT artist) FROM songs WHERE artist LIKE ? AND artist != '' AND cancelled = 0`
-				args = []interface{}{"%" + searchTerm + "%"}
-			}
+			join, where, searchArgs := songSearchFilter(db, "songs", searchTerm, searchScopeArtist)
+			query = `SELECT COUNT(DISTINCT songs.artist) FROM songs` + join + ` WHERE ` + where + ` AND songs.artist != '' AND cancelled = 0`
+			args = searchArgs
 		} else {
 			query = `SELECT COUNT(DISTINCT artist) FROM songs WHERE artist != '' AND cancelled = 0`
 		}
@@ -937,22 +904,13 @@ func CountAlbums(db *sql.DB, searchTerm string) (int, error) {
 	var args []interface{}
 
 	if searchTerm != "" {
-		if ftsAvailable(db) {
-			query = `SELECT COUNT(DISTINCT CASE
-				WHEN songs.album_path IS NOT NULL AND songs.album_path != ''
-				THEN songs.album_path || '|||' || songs.album ELSE songs.album END)
-			FROM songs JOIN songs_fts f ON f.rowid = songs.rowid
-			WHERE songs_fts MATCH ? AND songs.album != '' AND cancelled = 0`
-			args = []interface{}{buildFTSQuery(searchTerm)}
-		} else {
-			query = `SELECT COUNT(DISTINCT CASE
-				WHEN album_path IS NOT NULL AND album_path != ''
-				THEN album_path || '|||' || album ELSE album END)
-			FROM songs
-			WHERE (album LIKE ? OR artist LIKE ? OR album_artist LIKE ?) AND album != '' AND cancelled = 0`
-			searchPattern := "%" + searchTerm + "%"
-			args = []interface{}{searchPattern, searchPattern, searchPattern}
-		}
+		join, where, searchArgs := songSearchFilter(db, "songs", searchTerm, searchScopeAlbum)
+		query = `SELECT COUNT(DISTINCT CASE
+			WHEN songs.album_path IS NOT NULL AND songs.album_path != ''
+			THEN songs.album_path || '|||' || songs.album ELSE songs.album END)
+		FROM songs` + join + `
+		WHERE ` + where + ` AND songs.album != '' AND cancelled = 0`
+		args = searchArgs
 	} else {
 		query = `SELECT COUNT(DISTINCT CASE
 			WHEN album_path IS NOT NULL AND album_path != ''
@@ -1103,6 +1061,13 @@ func GetConfig(db *sql.DB, key string) (string, error) {
 	return value, err
 }
 
+// UseAlbumArtist reports whether artist browsing (getArtists, getIndexes and the
+// artist part of search) groups songs by album artist, falling back to the track
+// artist, instead of by the raw artist tag. Controlled by use_album_artist.
+func UseAlbumArtist(db *sql.DB) bool {
+	return configBool(db, "use_album_artist")
+}
+
 // SetConfig sets a configuration value
 func SetConfig(db *sql.DB, key, value string) error {
 	_, err := db.Exec(`INSERT OR REPLACE INTO configuration (key, value) VALUES (?, ?)`, key, value)
@@ -1173,15 +1138,20 @@ func QueryGenres(db *sql.DB) (map[string]struct{ SongCount, AlbumCount int }, er
 // PLAYLIST HELPERS
 // ============================================================================
 
-// GetPlaylistSongs returns songs in a playlist ordered by position
+// GetPlaylistSongs returns songs in a playlist ordered by position, with the
+// full set of columns buildSubsonicSong needs plus the user's starred state.
 func GetPlaylistSongs(db *sql.DB, playlistID, userID int) ([]SongResult, error) {
 	query := `
 		SELECT s.id, s.title, s.artist, s.album, s.path, s.duration, s.play_count, s.last_played,
 			COALESCE(s.genre, '') as genre,
-			CASE WHEN ss.song_id IS NOT NULL THEN 1 ELSE 0 END as starred
+			EXISTS(SELECT 1 FROM starred_songs ss WHERE ss.song_id = s.id AND ss.user_id = ?) as starred,
+			COALESCE(s.album_artist, ''), COALESCE(s.date_added, ''),
+			s.replaygain_track_gain, s.replaygain_track_peak, s.replaygain_album_gain, s.replaygain_album_peak,
+			COALESCE(s.album_path, '') AS album_path,
+			COALESCE(s.track, 0), COALESCE(s.year, 0), COALESCE(s.disc_number, 0),
+			COALESCE(s.size, 0), COALESCE(s.bitrate, 0), COALESCE(s.sample_rate, 0), COALESCE(s.channels, 0), COALESCE(s.bit_depth, 0), COALESCE(s.comment, '')
 		FROM playlist_songs ps
 		JOIN songs s ON ps.song_id = s.id
-		LEFT JOIN starred_songs ss ON s.id = ss.song_id AND ss.user_id = ?
 		WHERE ps.playlist_id = ? AND s.cancelled = 0
 		ORDER BY ps.position
 	`
@@ -1195,22 +1165,32 @@ func GetPlaylistSongs(db *sql.DB, playlistID, userID int) ([]SongResult, error)
 	var results []SongResult
 	for rows.Next() {
 		var result SongResult
-		var lastPlayed sql.NullString
+		var lastPlayed, albumPath sql.NullString
+		var rgTrackGain, rgTrackPeak, rgAlbumGain, rgAlbumPeak sql.NullFloat64
+		var trackInt, yearInt, discInt sql.NullInt64
 
 		if err := rows.Scan(&result.ID, &result.Title, &result.Artist, &result.Album,
 			&result.Path, &result.Duration, &result.PlayCount, &lastPlayed,
-			&result.Genre, &result.Starred); err != nil {
+			&result.Genre, &result.Starred, &result.AlbumArtist, &result.Created,
+			&rgTrackGain, &rgTrackPeak, &rgAlbumGain, &rgAlbumPeak, &albumPath,
+			&trackInt, &yearInt, &discInt,
+			&result.Size, &result.BitRate, &result.SamplingRate, &result.ChannelCount, &result.BitDepth, &result.Comment); err != nil {
 			continue
 		}
 
 		if lastPlayed.Valid {
 			result.LastPlayed = lastPlayed.String
 		}
+		result.AlbumID = AlbumID(result.Album, albumPath.String)
+		result.Track = int(trackInt.Int64)
+		result.Year = int(yearInt.Int64)
+		result.DiscNumber = int(discInt.Int64)
+		result.ReplayGain = newReplayGain(rgTrackGain, rgTrackPeak, rgAlbumGain, rgAlbumPeak)
 
 		results = append(results, result)
 	}
 
-	return results, nil
+	return results, rows.Err()
 }
 
 // AddSongsToPlaylist adds songs to a playlist
@@ -1240,6 +1220,82 @@ func AddSongsToPlaylist(db *sql.DB, playlistID int, songIDs []string) error {
 	return nil
 }
 
+// nextPlaylistPosition returns the position the next song appended to a
+// playlist should take (0 for an empty playlist). It runs on the caller's
+// transaction so positions stay contiguous while songs are being inserted.
+func nextPlaylistPosition(tx *sql.Tx, playlistID interface{}) (int, error) {
+	var nextPos int
+	err := tx.QueryRow(`SELECT COALESCE(MAX(position) + 1, 0) FROM playlist_songs WHERE playlist_id = ?`,
+		playlistID).Scan(&nextPos)
+	return nextPos, err
+}
+
+// uniqueSongIDs returns ids without repeats, keeping each first occurrence in
+// order. Empty ids are dropped.
+func uniqueSongIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
+
+// DedupePlaylist removes repeated songs from a playlist, keeping the first
+// occurrence of each, renumbers the positions from 0 and returns how many
+// entries were removed.
+func DedupePlaylist(db *sql.DB, playlistID interface{}) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT song_id FROM playlist_songs WHERE playlist_id = ? ORDER BY position, rowid`, playlistID)
+	if err != nil {
+		return 0, err
+	}
+	var songIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		songIDs = append(songIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	unique := uniqueSongIDs(songIDs)
+	if len(unique) == len(songIDs) {
+		return 0, nil
+	}
+	if _, err := tx.Exec(`DELETE FROM playlist_songs WHERE playlist_id = ?`, playlistID); err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO playlist_songs (playlist_id, song_id, position) VALUES (?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for i, id := range unique {
+		if _, err := stmt.Exec(playlistID, id, i); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(songIDs) - len(unique), nil
+}
+
 // ============================================================================
 // BATCH OPERATIONS
 // ============================================================================
@@ -1255,7 +1311,7 @@ func QuerySongsByIDs(db *sql.DB, songIDs []string) ([]SongResult, error) {
 		SELECT s.id, s.title, s.artist, s.album, s.path, s.play_count, s.last_played, s.duration,
 			COALESCE(s.genre, ''), COALESCE(s.album_artist, ''), COALESCE(s.date_added, ''),
 			s.replaygain_track_gain, s.replaygain_track_peak, s.replaygain_album_gain, s.replaygain_album_peak,
-			(SELECT MIN(s2.id) FROM songs s2 WHERE s2.album_path = s.album_path AND s2.cancelled = 0) AS album_id,
+			COALESCE(s.album_path, '') AS album_path,
 			COALESCE(s.track, 0), COALESCE(s.year, 0), COALESCE(s.disc_number, 0),
 			COALESCE(s.size, 0), COALESCE(s.bitrate, 0), COALESCE(s.sample_rate, 0), COALESCE(s.channels, 0), COALESCE(s.bit_depth, 0), COALESCE(s.comment, '')
 		FROM songs s
@@ -1277,13 +1333,13 @@ func QuerySongsByIDs(db *sql.DB, songIDs []string) ([]SongResult, error) {
 	for rows.Next() {
 		var result SongResult
 		var lastPlayed sql.NullString
-		var genreVal, albumArtist, created, albumID sql.NullString
+		var genreVal, albumArtist, created, albumPath sql.NullString
 		var rgTrackGain, rgTrackPeak, rgAlbumGain, rgAlbumPeak sql.NullFloat64
 		var trackInt, yearInt, discInt sql.NullInt64
 
 		if err := rows.Scan(&result.ID, &result.Title, &result.Artist, &result.Album,
 			&result.Path, &result.PlayCount, &lastPlayed, &result.Duration,
-			&genreVal, &albumArtist, &created, &rgTrackGain, &rgTrackPeak, &rgAlbumGain, &rgAlbumPeak, &albumID,
+			&genreVal, &albumArtist, &created, &rgTrackGain, &rgTrackPeak, &rgAlbumGain, &rgAlbumPeak, &albumPath,
 			&trackInt, &yearInt, &discInt,
 			&result.Size, &result.BitRate, &result.SamplingRate, &result.ChannelCount, &result.BitDepth, &result.Comment); err != nil {
 			continue
@@ -1301,9 +1357,7 @@ func QuerySongsByIDs(db *sql.DB, songIDs []string) ([]SongResult, error) {
 		if created.Valid {
 			result.Created = created.String
 		}
-		if albumID.Valid {
-			result.AlbumID = albumID.String
-		}
+		result.AlbumID = AlbumID(result.Album, albumPath.String)
 		result.Track = int(trackInt.Int64)
 		result.Year = int(yearInt.Int64)
 		result.DiscNumber = int(discInt.Int64)
@@ -1321,3 +1375,72 @@ func GetSongIDByPath(db *sql.DB, path string) (string, error) {
 	err := db.QueryRow(`SELECT id FROM songs WHERE path = ?`, path).Scan(&id)
 	return id, err
 }
+
+// normalizedPathCandidates returns the forms a path may be stored in: cleaned,
+// then its NFC and NFD spellings (file names copied from macOS are often NFD).
+func normalizedPathCandidates(path string) []string {
+	clean := filepath.Clean(strings.TrimSpace(path))
+	candidates := []string{clean}
+	for _, form := range []string{norm.NFC.String(clean), norm.NFD.String(clean)} {
+		if !slices.Contains(candidates, form) {
+			candidates = append(candidates, form)
+		}
+	}
+	return candidates
+}
+
+// BatchGetSongIDsByPath resolves many file paths to song ids at once. Paths
+// are normalized before the lookup (see normalizedPathCandidates); the result
+// maps each given path that matched a non-cancelled song to its id.
+func BatchGetSongIDsByPath(db *sql.DB, paths []string) (map[string]string, error) {
+	var lookups []interface{}
+	seen := map[string]bool{}
+	for _, p := range paths {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		for _, c := range normalizedPathCandidates(p) {
+			if !seen[c] {
+				seen[c] = true
+				lookups = append(lookups, c)
+			}
+		}
+	}
+
+	byPath := make(map[string]string, len(lookups))
+	const chunk = 500
+	for start := 0; start < len(lookups); start += chunk {
+		args := lookups[start:min(start+chunk, len(lookups))]
+		placeholders := strings.Repeat("?,", len(args)-1) + "?"
+		rows, err := db.Query(`SELECT id, path FROM songs WHERE cancelled = 0 AND path IN (`+placeholders+`)`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id, path string
+			if err := rows.Scan(&id, &path); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			byPath[path] = id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make(map[string]string, len(paths))
+	for _, p := range paths {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		for _, c := range normalizedPathCandidates(p) {
+			if id, ok := byPath[c]; ok {
+				ids[p] = id
+				break
+			}
+		}
+	}
+	return ids, nil
+}
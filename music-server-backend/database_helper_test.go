@@ -42,13 +42,22 @@ func setupTestDB(t *testing.T) *sql.DB {
 		channels INTEGER DEFAULT 0,
 		bit_depth INTEGER DEFAULT 0,
 		comment TEXT DEFAULT '',
-		cancelled INTEGER DEFAULT 0
+		search_text TEXT NOT NULL DEFAULT '',
+		external_id TEXT NOT NULL DEFAULT '',
+		cancelled INTEGER DEFAULT 0,
+		cancelled_at TEXT,
+		cancel_reason TEXT NOT NULL DEFAULT ''
 	);
 	`
 	if _, err := db.Exec(create); err != nil {
 		db.Close()
 		t.Fatalf("failed to create songs table: %v", err)
 	}
+	// Artist and album queries order by the sort names in the derived tables.
+	if _, err := db.Exec(librarySchemaDDL); err != nil {
+		db.Close()
+		t.Fatalf("failed to create derived tables: %v", err)
+	}
 	// create FTS virtual table for tests and triggers so inserts update it automatically
 	_, err = db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS songs_fts USING fts5(title, artist, album, album_artist, content='songs', content_rowid='rowid');`)
 	if err != nil {
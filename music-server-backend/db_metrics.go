@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// timedDriverName is the sqlite3 driver with every statement timed into
+// audiomuse_db_query_duration_seconds. The server database is opened with it
+// when metrics are on.
+const timedDriverName = "sqlite3_timed"
+
+func init() {
+	sql.Register(timedDriverName, timedDriver{&sqlite3.SQLiteDriver{}})
+}
+
+// dbDriverName returns the driver the server database is opened with.
+func dbDriverName() string {
+	if metricsEnabled() {
+		return timedDriverName
+	}
+	return "sqlite3"
+}
+
+type timedDriver struct {
+	*sqlite3.SQLiteDriver
+}
+
+func (d timedDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+// timedConn keeps every SQLiteConn method (transactions, ping, ...) and times
+// the statement paths database/sql goes through.
+type timedConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	res, err := c.SQLiteConn.ExecContext(ctx, query, args)
+	observeDBQuery(query, time.Since(start))
+	return res, err
+}
+
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.SQLiteConn.QueryContext(ctx, query, args)
+	if err != nil {
+		observeDBQuery(query, time.Since(start))
+		return nil, err
+	}
+	return &timedRows{Rows: rows, query: query, elapsed: time.Since(start)}, nil
+}
+
+func (c *timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.SQLiteConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &timedStmt{Stmt: stmt, query: query}, nil
+}
+
+type timedStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *timedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	res, err := s.Stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+	observeDBQuery(s.query, time.Since(start))
+	return res, err
+}
+
+func (s *timedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.Stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+	if err != nil {
+		observeDBQuery(s.query, time.Since(start))
+		return nil, err
+	}
+	return &timedRows{Rows: rows, query: s.query, elapsed: time.Since(start)}, nil
+}
+
+// timedRows adds the time spent stepping through the result, which is where
+// SQLite does most of the work for a SELECT, and records the total on Close.
+// Time the caller spends between rows is not counted.
+type timedRows struct {
+	driver.Rows
+	query   string
+	elapsed time.Duration
+}
+
+func (r *timedRows) Next(dest []driver.Value) error {
+	start := time.Now()
+	err := r.Rows.Next(dest)
+	r.elapsed += time.Since(start)
+	return err
+}
+
+func (r *timedRows) Close() error {
+	observeDBQuery(r.query, r.elapsed)
+	return r.Rows.Close()
+}
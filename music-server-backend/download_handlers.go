@@ -0,0 +1,106 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- Download Handlers (JSON API) ---
+
+// downloadRoleRequired lets admins and users holding download_role through.
+func downloadRoleRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := User{ID: c.GetInt("userID"), Username: c.GetString("username"), IsAdmin: c.GetBool("isAdmin")}
+		if !userHasRole(user, roleDownload) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Download permission required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// downloadAlbumZip streams an album as a zip named by track number and title,
+// with the embedded cover art as cover.jpg. The id is the album id returned by
+// getAlbum/getAlbumList2.
+func downloadAlbumZip(c *gin.Context) {
+	id := c.Param("id")
+	album, err := resolveAlbumRef(db, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		return
+	}
+	albumName, albumDir := album.Name, album.Path
+
+	songs, err := querySongsForZip(`album = ? AND album_path = ?`, albumName, albumDir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if len(songs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Album has no songs"})
+		return
+	}
+
+	log.Printf("[DOWNLOAD] User %s downloading album '%s' (%d songs)", c.GetString("username"), albumName, len(songs))
+	streamAlbumZip(c, album, songs)
+}
+
+// streamAlbumZip streams an album's songs as "Artist - Album.zip", named by
+// track number and title, with the embedded cover art as cover.jpg.
+func streamAlbumZip(c *gin.Context, album albumRef, songs []zipSong) {
+	paths := make([]string, 0, len(songs))
+	for _, s := range songs {
+		paths = append(paths, s.Path)
+	}
+	streamSongsAsZip(c, albumDisplayArtist(db, album.Name, album.Path)+" - "+album.Name+".zip", songs,
+		zipLayout{trackNames: true, cover: embeddedCover(paths...)})
+}
+
+// downloadPlaylistZip streams a playlist as a zip whose entries are numbered in
+// playlist order. The same visibility rules as getPlaylist apply.
+func downloadPlaylistZip(c *gin.Context) {
+	userID := c.GetInt("userID")
+	id := c.Param("id")
+
+	var name string
+	err := db.QueryRow(
+		"SELECT p.name FROM playlists p JOIN users u ON p.user_id = u.id WHERE p.id = ? AND (p.user_id = ? OR u.is_admin = 1 OR p.public = 1)",
+		id, userID,
+	).Scan(&name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT s.id, s.title, s.album, s.path
+		FROM playlist_songs ps
+		JOIN songs s ON ps.song_id = s.id
+		WHERE ps.playlist_id = ? AND s.cancelled = 0
+		ORDER BY ps.position`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var songs []zipSong
+	for rows.Next() {
+		var s zipSong
+		if err := rows.Scan(&s.ID, &s.Title, &s.Album, &s.Path); err != nil {
+			log.Printf("Error scanning playlist song for zip: %v", err)
+			continue
+		}
+		s.Track = len(songs) + 1
+		songs = append(songs, s)
+	}
+	rows.Close()
+	if len(songs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist has no songs"})
+		return
+	}
+
+	log.Printf("[DOWNLOAD] User %s downloading playlist '%s' (%d songs)", c.GetString("username"), name, len(songs))
+	streamSongsAsZip(c, name+".zip", songs, zipLayout{trackNames: true})
+}
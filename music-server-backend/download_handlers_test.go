@@ -0,0 +1,68 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAlbumZipDownloadNamesTracksAndRequiresRole(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+
+	dir := t.TempDir()
+	stmts := []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT UNIQUE NOT NULL, is_admin BOOLEAN NOT NULL DEFAULT 0,
+			download_role INTEGER NOT NULL DEFAULT 1)`,
+		`INSERT INTO users (id, username, download_role) VALUES (1, 'alice', 1), (2, 'bob', 0)`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+	for i, title := range []string{"Intro", "Outro: Reprise"} {
+		path := filepath.Join(dir, []string{"a.mp3", "b.mp3"}[i])
+		if err := os.WriteFile(path, []byte(title), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO songs (id, title, artist, album, album_path, path, track, cancelled) VALUES (?, ?, 'Band', 'Record', ?, ?, ?, 0)`,
+			[]string{"s1", "s2"}[i], title, dir, path, i+1); err != nil {
+			t.Fatalf("seed song: %v", err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	asUser := func(id int) gin.HandlerFunc {
+		return func(c *gin.Context) { c.Set("userID", id); c.Set("isAdmin", false) }
+	}
+	r.GET("/alice/album/:id", asUser(1), downloadRoleRequired(), downloadAlbumZip)
+	r.GET("/bob/album/:id", asUser(2), downloadRoleRequired(), downloadAlbumZip)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/bob/album/s1", nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("user without download_role should get 403, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/alice/album/s1", nil))
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("expected a zip, got %d: %v", w.Code, err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if len(names) != 2 || names[0] != "01 - Intro.mp3" || names[1] != "02 - Outro_ Reprise.mp3" {
+		t.Fatalf("unexpected zip entries %v", names)
+	}
+}
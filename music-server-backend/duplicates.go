@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"math/bits"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Duplicate detection (detect_duplicates=true, off by default because it reads
+// every candidate file). After each scan, songs are fingerprinted and songs
+// sharing a fingerprint are recorded in the duplicates table:
+//
+//   - files of the same size are compared by a hash of the size plus their
+//     first and last 64 KiB, which catches byte-identical copies cheaply;
+//   - when Chromaprint's fpcalc is installed, songs with the same artist and
+//     title are also compared by acoustic fingerprint, which catches the same
+//     recording in another format or bitrate. Two fingerprints match when
+//     most of their bits agree at the best alignment; they are cached in the
+//     fingerprints table until the file's size or mtime changes.
+//
+// An admin picks the copy to keep with POST /api/v1/admin/duplicates/resolve;
+// the other copies are marked hidden and cancelled. A rescan clears cancelled,
+// so hidden copies are cancelled again at the end of every scan.
+
+const duplicateBlockSize = 64 << 10
+
+// fpcalcTimeout bounds one Chromaprint run; it only decodes the first two minutes.
+const fpcalcTimeout = 30 * time.Second
+
+// fingerprintMatchThreshold is the share of equal bits above which two
+// Chromaprint fingerprints are the same recording; unrelated audio scores
+// around 0.5.
+const fingerprintMatchThreshold = 0.85
+
+// fingerprintMaxOffset bounds the alignment search, in fingerprint items
+// (about 0.12s each), to absorb leading silence or encoder delay.
+const fingerprintMaxOffset = 40
+
+func duplicateDetectionEnabled() bool {
+	return configBool(db, "detect_duplicates")
+}
+
+// fileBlockHash returns a hash of a file's size and its first and last blocks.
+func fileBlockHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	fmt.Fprintf(h, "%d:", info.Size())
+	if _, err := io.CopyN(h, f, duplicateBlockSize); err != nil && err != io.EOF {
+		return "", err
+	}
+	if info.Size() > duplicateBlockSize {
+		if _, err := f.Seek(-min(info.Size()-duplicateBlockSize, duplicateBlockSize), io.SeekEnd); err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	}
+	return "size:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// chromaprintFingerprint returns the song's raw Chromaprint fingerprint,
+// from the cache when the file has not changed since it was computed.
+func chromaprintFingerprint(db *sql.DB, fpcalc, path string) ([]uint32, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var cached string
+	if err := db.QueryRow(`SELECT fingerprint FROM fingerprints WHERE path = ? AND size = ? AND mtime = ?`,
+		path, info.Size(), info.ModTime().UnixNano()).Scan(&cached); err == nil {
+		if fp, err := parseRawFingerprint(cached); err == nil {
+			return fp, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fpcalcTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, fpcalc, "-raw", "-length", "120", path).Output()
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if raw, ok := strings.CutPrefix(strings.TrimSpace(line), "FINGERPRINT="); ok && raw != "" {
+			fp, err := parseRawFingerprint(raw)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := db.Exec(`INSERT OR REPLACE INTO fingerprints (path, size, mtime, fingerprint) VALUES (?, ?, ?, ?)`,
+				path, info.Size(), info.ModTime().UnixNano(), raw); err != nil {
+				log.Printf("chromaprintFingerprint: caching %s: %v", path, err)
+			}
+			return fp, nil
+		}
+	}
+	return nil, fmt.Errorf("fpcalc returned no fingerprint for %s", path)
+}
+
+// parseRawFingerprint parses fpcalc -raw output ("123,-456,...").
+func parseRawFingerprint(raw string) ([]uint32, error) {
+	fields := strings.Split(raw, ",")
+	fp := make([]uint32, 0, len(fields))
+	for _, f := range fields {
+		v, err := strconv.ParseInt(strings.TrimSpace(f), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fingerprint item %q", f)
+		}
+		fp = append(fp, uint32(v))
+	}
+	return fp, nil
+}
+
+// fingerprintSimilarity returns the share of equal bits between two raw
+// fingerprints at their best alignment, from 0 to 1. Alignments that overlap
+// less than half of the shorter fingerprint are not considered.
+func fingerprintSimilarity(a, b []uint32) float64 {
+	minOverlap := (min(len(a), len(b)) + 1) / 2
+	best := 0.0
+	for offset := -fingerprintMaxOffset; offset <= fingerprintMaxOffset; offset++ {
+		diff, n := 0, 0
+		for i := max(0, -offset); i < len(a) && i+offset < len(b); i++ {
+			diff += bits.OnesCount32(a[i] ^ b[i+offset])
+			n++
+		}
+		if n == 0 || n < minOverlap {
+			continue
+		}
+		if sim := 1 - float64(diff)/float64(n*32); sim > best {
+			best = sim
+		}
+	}
+	return best
+}
+
+type duplicateCandidate struct {
+	id, path string
+	size     int64
+	trackKey string // normalized artist + title
+}
+
+// detectDuplicates fingerprints candidate songs and rewrites the unresolved
+// rows of the duplicates table. It returns the number of duplicate groups.
+func detectDuplicates(db *sql.DB) (int, error) {
+	// Hidden copies are cancelled but still belong to their group.
+	rows, err := db.Query(`SELECT id, path, COALESCE(size, 0), COALESCE(title, ''), COALESCE(artist, '') FROM songs
+		WHERE cancelled = 0 OR id IN (SELECT song_id FROM duplicates WHERE hidden = 1)`)
+	if err != nil {
+		return 0, err
+	}
+	bySize := map[int64][]duplicateCandidate{}
+	byTrack := map[string][]duplicateCandidate{}
+	for rows.Next() {
+		var c duplicateCandidate
+		var title, artist string
+		if err := rows.Scan(&c.id, &c.path, &c.size, &title, &artist); err != nil {
+			continue
+		}
+		c.trackKey = normalizeSearchText(artist) + "|" + normalizeSearchText(title)
+		if c.size > 0 {
+			bySize[c.size] = append(bySize[c.size], c)
+		}
+		byTrack[c.trackKey] = append(byTrack[c.trackKey], c)
+	}
+	rows.Close()
+	if _, err := db.Exec(`DELETE FROM fingerprints WHERE path NOT IN (SELECT path FROM songs)`); err != nil {
+		log.Printf("detectDuplicates: pruning fingerprint cache: %v", err)
+	}
+
+	groups := map[string][]string{} // fingerprint -> song ids
+	for _, cands := range bySize {
+		if len(cands) < 2 {
+			continue
+		}
+		for _, c := range cands {
+			if fp, err := fileBlockHash(c.path); err == nil {
+				groups[fp] = append(groups[fp], c.id)
+			}
+		}
+	}
+	if fpcalc, err := exec.LookPath("fpcalc"); err == nil {
+		for key, cands := range byTrack {
+			if len(cands) < 2 || key == "|" {
+				continue
+			}
+			// Copies are visited in id order and each joins the first group
+			// whose first song it matches, so a group is named after its
+			// smallest song id whatever order the rows came back in.
+			type chromaprintGroup struct {
+				id string
+				fp []uint32
+			}
+			var seen []chromaprintGroup
+			slices.SortFunc(cands, func(a, b duplicateCandidate) int { return strings.Compare(a.id, b.id) })
+			for _, c := range cands {
+				fp, err := chromaprintFingerprint(db, fpcalc, c.path)
+				if err != nil {
+					log.Printf("detectDuplicates: chromaprint failed for %s: %v", c.path, err)
+					continue
+				}
+				group := ""
+				for _, g := range seen {
+					if fingerprintSimilarity(g.fp, fp) >= fingerprintMatchThreshold {
+						group = g.id
+						break
+					}
+				}
+				if group == "" {
+					group = c.id
+					seen = append(seen, chromaprintGroup{c.id, fp})
+				}
+				groups["chromaprint:"+group] = append(groups["chromaprint:"+group], c.id)
+			}
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM duplicates WHERE hidden = 0`); err != nil {
+		return 0, err
+	}
+	now := time.Now().Format(time.RFC3339)
+	found := 0
+	// Visit groups in a fixed order so a song matched by both detectors
+	// always lands in the same one.
+	fps := make([]string, 0, len(groups))
+	for fp := range groups {
+		fps = append(fps, fp)
+	}
+	slices.Sort(fps)
+	for _, fp := range fps {
+		ids := groups[fp]
+		if len(ids) < 2 {
+			continue
+		}
+		found++
+		slices.Sort(ids)
+		for _, id := range ids {
+			// A song can only belong to one group; a hidden copy keeps the
+			// group it was resolved in.
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO duplicates (song_id, fingerprint, detected_at) VALUES (?, ?, ?)`, id, fp, now); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return found, tx.Commit()
+}
+
+// applyDuplicatePass runs at the end of a scan, before the library index is
+// rebuilt: it refreshes detection when enabled and re-cancels hidden copies.
+func applyDuplicatePass(db *sql.DB) {
+	if duplicateDetectionEnabled() {
+		if n, err := detectDuplicates(db); err != nil {
+			log.Printf("Duplicate detection failed: %v", err)
+		} else {
+			log.Printf("Duplicate detection found %d groups of duplicate songs", n)
+		}
+	}
+	if _, err := db.Exec(`UPDATE songs SET cancelled = 1, cancel_reason = ? WHERE cancelled = 0 AND id IN (SELECT song_id FROM duplicates WHERE hidden = 1)`, cancelReasonDuplicate); err != nil {
+		log.Printf("Failed to re-apply hidden duplicates: %v", err)
+	}
+}
+
+// DuplicateSong is one copy in a duplicate group.
+type DuplicateSong struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Artist  string `json:"artist"`
+	Album   string `json:"album"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	BitRate int    `json:"bitRate"`
+	Hidden  bool   `json:"hidden"`
+}
+
+// DuplicateGroup is a set of songs sharing a fingerprint.
+type DuplicateGroup struct {
+	Fingerprint string          `json:"fingerprint"`
+	Songs       []DuplicateSong `json:"songs"`
+}
+
+// getDuplicates handles GET /api/v1/admin/duplicates.
+func getDuplicates(c *gin.Context) {
+	rows, err := db.Query(`SELECT d.fingerprint, s.id, COALESCE(s.title, ''), COALESCE(s.artist, ''), COALESCE(s.album, ''), s.path,
+			COALESCE(s.size, 0), COALESCE(s.bitrate, 0), d.hidden
+		FROM duplicates d JOIN songs s ON s.id = d.song_id
+		ORDER BY s.artist COLLATE NOCASE, s.title COLLATE NOCASE, d.fingerprint, s.path`)
+	if err != nil {
+		log.Printf("getDuplicates: query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query duplicates"})
+		return
+	}
+	defer rows.Close()
+
+	groups := []DuplicateGroup{}
+	index := map[string]int{}
+	for rows.Next() {
+		var fp string
+		var s DuplicateSong
+		if err := rows.Scan(&fp, &s.ID, &s.Title, &s.Artist, &s.Album, &s.Path, &s.Size, &s.BitRate, &s.Hidden); err != nil {
+			continue
+		}
+		i, ok := index[fp]
+		if !ok {
+			i = len(groups)
+			index[fp] = i
+			groups = append(groups, DuplicateGroup{Fingerprint: fp})
+		}
+		groups[i].Songs = append(groups[i].Songs, s)
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": duplicateDetectionEnabled(), "groups": groups})
+}
+
+// resolveDuplicates handles POST /api/v1/admin/duplicates/resolve with
+// {"fingerprint": "...", "keep": "<song id>"}: every other copy in the group is
+// hidden and cancelled, and the kept copy is restored if it had been hidden.
+func resolveDuplicates(c *gin.Context) {
+	var req struct {
+		Fingerprint string `json:"fingerprint" binding:"required"`
+		Keep        string `json:"keep" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fingerprint and keep are required"})
+		return
+	}
+	var inGroup bool
+	_ = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM duplicates WHERE fingerprint = ? AND song_id = ?)`, req.Fingerprint, req.Keep).Scan(&inGroup)
+	if !inGroup {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Song is not part of that duplicate group"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+	stmts := []string{
+		`UPDATE duplicates SET hidden = (song_id != ?) WHERE fingerprint = ?`,
+		`UPDATE songs SET cancelled = (id != ?1), cancel_reason = CASE WHEN id != ?1 THEN '` + cancelReasonDuplicate + `' ELSE '' END WHERE id IN (SELECT song_id FROM duplicates WHERE fingerprint = ?2)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt, req.Keep, req.Fingerprint); err != nil {
+			log.Printf("resolveDuplicates: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve duplicates"})
+			return
+		}
+	}
+	var hidden int
+	_ = tx.QueryRow(`SELECT COUNT(*) FROM duplicates WHERE fingerprint = ? AND hidden = 1`, req.Fingerprint).Scan(&hidden)
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve duplicates"})
+		return
+	}
+
+	invalidateArtistIDCache()
+	if err := RebuildLibraryIndex(db); err != nil {
+		log.Printf("RebuildLibraryIndex after resolving duplicates failed: %v", err)
+	}
+	invalidateBrowseCache()
+	c.JSON(http.StatusOK, gin.H{"message": "Duplicates resolved", "hidden": hidden})
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDuplicateDetectionAndResolve(t *testing.T) {
+	testDB := fileSearchTestDB(t)
+	defer testDB.Close()
+	old := db
+	db = testDB
+	defer func() { db = old }()
+
+	for _, s := range []string{
+		`CREATE TABLE configuration (key TEXT PRIMARY KEY NOT NULL, value TEXT)`,
+		`CREATE TABLE duplicates (song_id TEXT PRIMARY KEY, fingerprint TEXT NOT NULL, detected_at TEXT NOT NULL, hidden INTEGER NOT NULL DEFAULT 0)`,
+		`CREATE TABLE fingerprints (path TEXT PRIMARY KEY, size INTEGER NOT NULL, mtime INTEGER NOT NULL, fingerprint TEXT NOT NULL)`,
+	} {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := t.TempDir()
+	audio := bytes.Repeat([]byte("song"), 50000) // larger than two hash blocks
+	other := bytes.Repeat([]byte("tune"), 50000) // same size, different bytes
+	for id, data := range map[string][]byte{"d1": audio, "d2": audio, "d3": other} {
+		p := filepath.Join(dir, id+".mp3")
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO songs (id, title, artist, album, path, album_path, size) VALUES (?, 'Song', 'Band', 'Album', ?, ?, ?)`, id, p, dir, len(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Off by default: nothing is recorded.
+	applyDuplicatePass(db)
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM duplicates`).Scan(&n)
+	if n != 0 {
+		t.Fatalf("detection should be off by default, got %d rows", n)
+	}
+
+	db.Exec(`INSERT INTO configuration (key, value) VALUES ('detect_duplicates', 'true')`)
+	applyDuplicatePass(db)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/dups", getDuplicates)
+	r.POST("/dups/resolve", resolveDuplicates)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dups", nil))
+	var listed struct {
+		Groups []DuplicateGroup `json:"groups"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil || len(listed.Groups) != 1 || len(listed.Groups[0].Songs) != 2 {
+		t.Fatalf("expected one group of d1+d2, got %s", w.Body.String())
+	}
+	fp := listed.Groups[0].Fingerprint
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/dups/resolve", strings.NewReader(`{"fingerprint":"`+fp+`","keep":"d3"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("keeping a song outside the group should be 404, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/dups/resolve", strings.NewReader(`{"fingerprint":"`+fp+`","keep":"d1"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("resolve failed: %d %s", w.Code, w.Body.String())
+	}
+	cancelled := func(id string) (c int) {
+		db.QueryRow(`SELECT cancelled FROM songs WHERE id = ?`, id).Scan(&c)
+		return c
+	}
+	if cancelled("d1") != 0 || cancelled("d2") != 1 || cancelled("d3") != 0 {
+		t.Fatalf("expected only d2 cancelled, got d1=%d d2=%d d3=%d", cancelled("d1"), cancelled("d2"), cancelled("d3"))
+	}
+
+	// A rescan resets cancelled; the end-of-scan pass hides d2 again.
+	db.Exec(`UPDATE songs SET cancelled = 0`)
+	applyDuplicatePass(db)
+	if cancelled("d2") != 1 {
+		t.Fatalf("hidden duplicate should stay cancelled after a rescan")
+	}
+}
+
+func TestFingerprintSimilarityAndCache(t *testing.T) {
+	a := make([]uint32, 200)
+	for i := range a {
+		a[i] = uint32(i) * 2654435761
+	}
+	// The same audio starting a few items later, with a few flipped bits.
+	b := append([]uint32{7, 7, 7}, a...)
+	for i := 10; i < len(b); i += 10 {
+		b[i] ^= 0x11
+	}
+	if sim := fingerprintSimilarity(a, b); sim < fingerprintMatchThreshold {
+		t.Fatalf("shifted copy should match, similarity %.2f", sim)
+	}
+	c := make([]uint32, 200)
+	for i := range c {
+		c[i] = uint32(i+1000) * 40503 * 2246822519
+	}
+	if sim := fingerprintSimilarity(a, c); sim >= fingerprintMatchThreshold {
+		t.Fatalf("unrelated fingerprints should not match, similarity %.2f", sim)
+	}
+
+	testDB := fileSearchTestDB(t)
+	defer testDB.Close()
+	if _, err := testDB.Exec(`CREATE TABLE fingerprints (path TEXT PRIMARY KEY, size INTEGER NOT NULL, mtime INTEGER NOT NULL, fingerprint TEXT NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(t.TempDir(), "song.flac")
+	if err := os.WriteFile(p, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(p)
+	testDB.Exec(`INSERT INTO fingerprints (path, size, mtime, fingerprint) VALUES (?, ?, ?, '1,-2,3')`, p, info.Size(), info.ModTime().UnixNano())
+
+	// A cache hit never runs fpcalc.
+	fp, err := chromaprintFingerprint(testDB, "/nonexistent/fpcalc", p)
+	if err != nil || len(fp) != 3 || fp[1] != 0xfffffffe {
+		t.Fatalf("expected the cached fingerprint, got %v (%v)", fp, err)
+	}
+	// A changed file is fingerprinted again.
+	if err := os.WriteFile(p, []byte("new audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chromaprintFingerprint(testDB, "/nonexistent/fpcalc", p); err == nil {
+		t.Fatal("a stale cache entry should not be used")
+	}
+}
+
+// Chromaprint groups are named after their smallest song id, whatever order
+// the songs are stored in.
+func TestChromaprintGroupsAreDeterministic(t *testing.T) {
+	testDB := fileSearchTestDB(t)
+	defer testDB.Close()
+	for _, s := range []string{
+		`CREATE TABLE duplicates (song_id TEXT PRIMARY KEY, fingerprint TEXT NOT NULL, detected_at TEXT NOT NULL, hidden INTEGER NOT NULL DEFAULT 0)`,
+		`CREATE TABLE fingerprints (path TEXT PRIMARY KEY, size INTEGER NOT NULL, mtime INTEGER NOT NULL, fingerprint TEXT NOT NULL)`,
+	} {
+		if _, err := testDB.Exec(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// fpcalc only has to exist: every fingerprint below is served from the cache.
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "fpcalc"), []byte("#!/bin/sh\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	fp := make([]string, 100)
+	for i := range fp {
+		fp[i] = strconv.Itoa(i * 7919)
+	}
+	dir := t.TempDir()
+	for i, id := range []string{"c3", "c1", "c2"} {
+		p := filepath.Join(dir, id+".mp3")
+		if err := os.WriteFile(p, bytes.Repeat([]byte("x"), 100+i), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		info, _ := os.Stat(p)
+		testDB.Exec(`INSERT INTO fingerprints (path, size, mtime, fingerprint) VALUES (?, ?, ?, ?)`, p, info.Size(), info.ModTime().UnixNano(), strings.Join(fp, ","))
+		testDB.Exec(`INSERT INTO songs (id, title, artist, path, size) VALUES (?, 'Song', 'Band', ?, ?)`, id, p, info.Size())
+	}
+
+	if n, err := detectDuplicates(testDB); err != nil || n != 1 {
+		t.Fatalf("detectDuplicates = %d, %v; want one group", n, err)
+	}
+	rows, err := testDB.Query(`SELECT DISTINCT fingerprint FROM duplicates`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		names = append(names, name)
+	}
+	if len(names) != 1 || names[0] != "chromaprint:c1" {
+		t.Fatalf("group names = %v, want [chromaprint:c1]", names)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// defaultFFprobeTimeoutSeconds bounds a single ffprobe run. A malformed file
+// can make ffprobe spin or block forever, which used to hang the scan (or a
+// stream request) that was waiting for it.
+const defaultFFprobeTimeoutSeconds = 30
+
+// runFFprobe runs ffprobe with args and returns its stdout. The process is
+// killed once ffprobe_timeout_seconds have passed; callers treat the error
+// like any other probe failure (unknown duration/bitrate).
+func runFFprobe(args ...string) ([]byte, error) {
+	timeout := time.Duration(configInt(db, "ffprobe_timeout_seconds", defaultFFprobeTimeoutSeconds)) * time.Second
+	if timeout <= 0 {
+		timeout = defaultFFprobeTimeoutSeconds * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ffprobe", args...)
+	// Don't wait on pipes a killed process may have handed to children.
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("ffprobe timed out after %s", timeout)
+	}
+	return out, err
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFFprobeTimeoutKillsHungProbe(t *testing.T) {
+	d := scanTestDB(t)
+	d.Exec(`INSERT INTO configuration (key, value) VALUES ('ffprobe_timeout_seconds', '1')`)
+
+	// A stand-in ffprobe that hangs, with a child holding its stdout open.
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "ffprobe"), []byte("#!/bin/sh\nsleep 30\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	song := filepath.Join(t.TempDir(), "song.mp3")
+	os.WriteFile(song, []byte("not really audio"), 0o644)
+
+	start := time.Now()
+	props := getAudioProperties(song)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("getAudioProperties took %s; the probe should be killed after 1s", elapsed)
+	}
+	if props.Duration != 0 || props.BitRate != 0 || props.Size == 0 {
+		t.Fatalf("props = %+v, want unknown duration/bitrate with the file size", props)
+	}
+	var msg string
+	d.QueryRow(`SELECT error FROM scan_errors WHERE path = ? AND category = 'ffprobe'`, song).Scan(&msg)
+	if !strings.Contains(msg, "timed out") {
+		t.Fatalf("scan error = %q, want a timeout", msg)
+	}
+
+	if info, err := detectAudioFormat(song); err != nil || info.Bitrate != 0 {
+		t.Fatalf("detectAudioFormat = %+v, %v; want unknown bitrate", info, err)
+	}
+}
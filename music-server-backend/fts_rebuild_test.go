@@ -16,7 +16,7 @@ func ftsTestDB(t *testing.T) *sql.DB {
 	if err != nil {
 		t.Fatalf("open: %v", err)
 	}
-	db.Exec(`CREATE TABLE songs (id TEXT PRIMARY KEY, title TEXT, artist TEXT, album TEXT, album_artist TEXT DEFAULT '', album_path TEXT DEFAULT '', genre TEXT DEFAULT '', path TEXT, duration INTEGER, play_count INTEGER, last_played TEXT, date_added TEXT, replaygain_track_gain REAL, replaygain_track_peak REAL, replaygain_album_gain REAL, replaygain_album_peak REAL, track INTEGER DEFAULT 0, year INTEGER DEFAULT 0, disc_number INTEGER DEFAULT 0, size INTEGER DEFAULT 0, bitrate INTEGER DEFAULT 0, sample_rate INTEGER DEFAULT 0, channels INTEGER DEFAULT 0, bit_depth INTEGER DEFAULT 0, comment TEXT DEFAULT '', cancelled INTEGER DEFAULT 0)`)
+	db.Exec(`CREATE TABLE songs (id TEXT PRIMARY KEY, title TEXT, artist TEXT, album TEXT, album_artist TEXT DEFAULT '', album_path TEXT DEFAULT '', genre TEXT DEFAULT '', path TEXT, duration INTEGER, play_count INTEGER, last_played TEXT, date_added TEXT, replaygain_track_gain REAL, replaygain_track_peak REAL, replaygain_album_gain REAL, replaygain_album_peak REAL, track INTEGER DEFAULT 0, year INTEGER DEFAULT 0, disc_number INTEGER DEFAULT 0, size INTEGER DEFAULT 0, bitrate INTEGER DEFAULT 0, sample_rate INTEGER DEFAULT 0, channels INTEGER DEFAULT 0, bit_depth INTEGER DEFAULT 0, comment TEXT DEFAULT '', search_text TEXT NOT NULL DEFAULT '', cancelled INTEGER DEFAULT 0)`)
 	db.Exec(`CREATE VIRTUAL TABLE songs_fts USING fts5(title, artist, album, album_artist, content='songs', content_rowid='rowid')`)
 	db.Exec(`CREATE TRIGGER songs_ai AFTER INSERT ON songs BEGIN INSERT INTO songs_fts(rowid,title,artist,album,album_artist) VALUES (new.rowid,new.title,new.artist,new.album,new.album_artist); END;`)
 	return db
@@ -107,3 +107,31 @@ func TestSongsFTSIndexEmptyOnFreshTable(t *testing.T) {
 		t.Fatalf("freshly recreated index should be detected as empty")
 	}
 }
+
+func TestSongsFTSTriggersDropStaleTokensOnUpdateAndDelete(t *testing.T) {
+	db := ftsTestDB(t)
+	defer db.Close()
+	db.Exec(`DROP TRIGGER IF EXISTS songs_ai`)
+	db.Exec(`DROP TABLE songs_fts`)
+	if !ensureSongsFTS(db) {
+		t.Fatalf("fts5 not available (build with -tags fts5)")
+	}
+
+	matches := func(term string) int {
+		var n int
+		_ = db.QueryRow(`SELECT COUNT(*) FROM songs_fts WHERE songs_fts MATCH ?`, buildFTSQuery(term)).Scan(&n)
+		return n
+	}
+	db.Exec(`INSERT INTO songs (id,title,artist,album) VALUES (?,?,?,?)`, "s1", "Yellow Submarine", "Beatles", "Revolver")
+	if matches("submarine") != 1 {
+		t.Fatalf("inserted song should be indexed")
+	}
+	db.Exec(`UPDATE songs SET title = 'Eleanor Rigby' WHERE id = 's1'`)
+	if matches("submarine") != 0 || matches("eleanor") != 1 {
+		t.Fatalf("update should replace old tokens: submarine=%d eleanor=%d", matches("submarine"), matches("eleanor"))
+	}
+	db.Exec(`DELETE FROM songs WHERE id = 's1'`)
+	if matches("eleanor") != 0 || matches("beatles") != 0 {
+		t.Fatalf("delete should remove the song's tokens")
+	}
+}
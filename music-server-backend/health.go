@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Health endpoints for orchestrators. /healthz only says the process is
+// serving requests; /readyz also checks the database and, with
+// READYZ_CHECK_AUDIOMUSE=true, that AudioMuse-AI Core answers. Neither needs
+// authentication, and both reply with plain JSON and 200 or 503, unlike the
+// Subsonic envelope of /rest/ping.
+
+const readinessCheckTimeout = 3 * time.Second
+
+// healthzHandler handles GET /healthz.
+func healthzHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyzHandler handles GET /readyz. checks maps each dependency to "ok" or
+// the reason it failed.
+func readyzHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessCheckTimeout)
+	defer cancel()
+
+	ready := true
+	checks := gin.H{}
+	if _, err := db.ExecContext(ctx, "SELECT 1"); err != nil {
+		ready = false
+		checks["database"] = err.Error()
+	} else {
+		checks["database"] = "ok"
+	}
+	if getEnv("READYZ_CHECK_AUDIOMUSE", "false") == "true" {
+		if err := checkAudioMuseCore(ctx); err != nil {
+			ready = false
+			checks["audiomuse"] = err.Error()
+		} else {
+			checks["audiomuse"] = "ok"
+		}
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "checks": checks})
+}
+
+// checkAudioMuseCore reports whether AudioMuse-AI Core is configured and
+// answers its root URL without a server error.
+func checkAudioMuseCore(ctx context.Context) error {
+	_, status, err := audioMuseClient.Get(ctx, "/", nil)
+	if err != nil {
+		return err
+	}
+	if status >= http.StatusInternalServerError {
+		return fmt.Errorf("AudioMuse-AI returned HTTP %d", status)
+	}
+	return nil
+}
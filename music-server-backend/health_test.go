@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadyz(t *testing.T) {
+	d := scanTestDB(t)
+	coreStatus := http.StatusOK
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(coreStatus) }))
+	defer core.Close()
+	t.Setenv("AUDIOMUSE_AI_CORE_URL", core.URL)
+	prevClient := audioMuseClient
+	audioMuseClient = NewAudioMuseClient(d)
+	t.Cleanup(func() { audioMuseClient = prevClient })
+
+	r := gin.New()
+	r.GET("/healthz", healthzHandler)
+	r.GET("/readyz", readyzHandler)
+	get := func(path string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var body map[string]any
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("healthz = %d", code)
+	}
+	if code, body := get("/readyz"); code != http.StatusOK || body["checks"].(map[string]any)["audiomuse"] != nil {
+		t.Errorf("readyz = %d %v, want 200 without the core check", code, body)
+	}
+
+	t.Setenv("READYZ_CHECK_AUDIOMUSE", "true")
+	if code, body := get("/readyz"); code != http.StatusOK || body["checks"].(map[string]any)["audiomuse"] != "ok" {
+		t.Errorf("readyz = %d %v, want 200 with core ok", code, body)
+	}
+	coreStatus = http.StatusBadGateway
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable || body["status"] != "unavailable" {
+		t.Errorf("readyz = %d %v, want 503 while core fails", code, body)
+	}
+
+	t.Setenv("READYZ_CHECK_AUDIOMUSE", "false")
+	d.Close()
+	if code, _ := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz = %d with the database closed, want 503", code)
+	}
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("healthz = %d with the database closed, want 200", code)
+	}
+}
@@ -144,7 +144,10 @@ func getAlbumDisplayArtist(db *sql.DB, albumName, albumPath string) (string, err
 					AND TRIM(artist) != ''
 				THEN TRIM(artist)
 				ELSE NULL
-			END as display_artist
+			END as display_artist,
+			(album_artist IS NOT NULL
+				AND TRIM(album_artist) != ''
+				AND LOWER(TRIM(album_artist)) NOT IN ('unknown', 'unknown artist')) as from_album_artist
 		FROM songs
 		WHERE album = ? AND (album_path = ? OR (album_path IS NULL AND ? = '')) AND cancelled = 0
 		ORDER BY display_artist COLLATE NOCASE
@@ -158,10 +161,14 @@ func getAlbumDisplayArtist(db *sql.DB, albumName, albumPath string) (string, err
 
 	parts := []string{}
 	seen := make(map[string]bool)
+	// Track artists are only used when no song of the album has an album_artist.
+	var fallback []string
+	fallbackSeen := make(map[string]bool)
 
 	for rows.Next() {
 		var displayArtist sql.NullString
-		if err := rows.Scan(&displayArtist); err != nil {
+		var fromAlbumArtist bool
+		if err := rows.Scan(&displayArtist, &fromAlbumArtist); err != nil {
 			continue
 		}
 
@@ -171,6 +178,13 @@ func getAlbumDisplayArtist(db *sql.DB, albumName, albumPath string) (string, err
 
 		// Normalize for deduplication
 		nk := normalizeKey(displayArtist.String)
+		if !fromAlbumArtist {
+			if !fallbackSeen[nk] {
+				fallbackSeen[nk] = true
+				fallback = append(fallback, displayArtist.String)
+			}
+			continue
+		}
 		if seen[nk] {
 			continue
 		}
@@ -181,6 +195,9 @@ func getAlbumDisplayArtist(db *sql.DB, albumName, albumPath string) (string, err
 	if len(parts) > 0 {
 		return strings.Join(parts, "; "), nil
 	}
+	if len(fallback) > 0 {
+		return strings.Join(fallback, "; "), nil
+	}
 
 	return "Unknown Artist", nil
 }
\ No newline at end of file
@@ -2,12 +2,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,6 +21,7 @@ import (
 // TranscodingSession represents an active HLS transcoding session
 type TranscodingSession struct {
 	SessionID      string
+	UserID         int // Owner; only this user may fetch the segments
 	SongID         string
 	Format         string
 	Bitrate        string
@@ -25,6 +30,7 @@ type TranscodingSession struct {
 	CreatedAt      time.Time
 	LastAccessedAt time.Time
 	Duration       int // Total duration in seconds
+	SegmentSeconds int // Segment length, fixed for the life of the session
 	mu             sync.Mutex
 }
 
@@ -35,14 +41,63 @@ type SessionManager struct {
 
 var hlsSessionManager = &SessionManager{}
 
-// Constants for HLS configuration
+// Constants for HLS configuration. Segment length and session timeout are
+// defaults for the hls_segment_seconds and hls_session_timeout_seconds keys.
 const (
-	HLS_SEGMENT_DURATION = 10          // seconds per segment
-	HLS_SESSION_TIMEOUT  = 5 * 60      // 5 minutes
-	HLS_CLEANUP_INTERVAL = 1 * 60      // Check every 1 minute
-	HLS_TEMP_DIR         = "hls_cache" // Directory for HLS segments
+	HLS_SEGMENT_DURATION = 10     // seconds per segment
+	HLS_SESSION_TIMEOUT  = 5 * 60 // 5 minutes
+	HLS_CLEANUP_INTERVAL = 1 * 60 // Check every 1 minute
 )
 
+// hlsPreEncodeQueueWait is how long the background whole-song encode waits for
+// a transcode slot before leaving the session to on-demand segments.
+const hlsPreEncodeQueueWait = time.Minute
+
+// hlsTempDir holds the HLS segments, one directory per session; see
+// initHLSTempDir.
+var hlsTempDir = "hls_cache"
+
+// initHLSTempDir sets hlsTempDir from the HLS_TEMP_DIR environment variable,
+// defaulting to hls_cache next to the database (the /config volume in
+// containers) rather than the process's working directory. An in-memory
+// database has no directory, so the system temp dir is used instead.
+func initHLSTempDir(dbPath string) {
+	defaultDir := filepath.Join(filepath.Dir(dbPath), "hls_cache")
+	if strings.Contains(dbPath, ":memory:") {
+		defaultDir = filepath.Join(os.TempDir(), "audiomuse-hls_cache")
+	}
+	hlsTempDir = getEnv("HLS_TEMP_DIR", defaultDir)
+	log.Printf("HLS segment cache: %s", hlsTempDir)
+}
+
+// hlsSegmentSeconds returns hls_segment_seconds; shorter segments start
+// faster on mobile, longer ones mean fewer requests. Values outside 2-30
+// fall back to the default.
+func hlsSegmentSeconds() int {
+	n := configInt(db, "hls_segment_seconds", HLS_SEGMENT_DURATION)
+	if n < 2 || n > 30 {
+		log.Printf("⚠️  Invalid hls_segment_seconds %d, using %d", n, HLS_SEGMENT_DURATION)
+		return HLS_SEGMENT_DURATION
+	}
+	return n
+}
+
+// hlsSessionTimeout returns hls_session_timeout_seconds, how long an unused
+// session keeps its segments. Values outside 60s-24h fall back to the default.
+func hlsSessionTimeout() time.Duration {
+	n := configInt(db, "hls_session_timeout_seconds", HLS_SESSION_TIMEOUT)
+	if n < 60 || n > 24*60*60 {
+		log.Printf("⚠️  Invalid hls_session_timeout_seconds %d, using %d", n, HLS_SESSION_TIMEOUT)
+		n = HLS_SESSION_TIMEOUT
+	}
+	return time.Duration(n) * time.Second
+}
+
+// segmentCount returns the number of segments covering the song.
+func (s *TranscodingSession) segmentCount() int {
+	return (s.Duration + s.SegmentSeconds - 1) / s.SegmentSeconds
+}
+
 // StartSessionCleanup starts a background goroutine to clean up stale sessions
 func StartSessionCleanup() {
 	// Clean up any orphaned cache directories from previous server runs
@@ -61,14 +116,14 @@ func StartSessionCleanup() {
 
 // cleanupOrphanedCache removes all cache directories on startup (since sessions are in-memory only)
 func cleanupOrphanedCache() {
-	if _, err := os.Stat(HLS_TEMP_DIR); os.IsNotExist(err) {
+	if _, err := os.Stat(hlsTempDir); os.IsNotExist(err) {
 		// Cache directory doesn't exist, nothing to clean
 		return
 	}
 
 	log.Println("🧹 Cleaning up orphaned HLS cache from previous server run...")
 
-	entries, err := os.ReadDir(HLS_TEMP_DIR)
+	entries, err := os.ReadDir(hlsTempDir)
 	if err != nil {
 		log.Printf("⚠️  Failed to read HLS cache directory: %v", err)
 		return
@@ -77,7 +132,7 @@ func cleanupOrphanedCache() {
 	cleaned := 0
 	for _, entry := range entries {
 		if entry.IsDir() {
-			dirPath := filepath.Join(HLS_TEMP_DIR, entry.Name())
+			dirPath := filepath.Join(hlsTempDir, entry.Name())
 			if err := os.RemoveAll(dirPath); err != nil {
 				log.Printf("⚠️  Failed to remove cache directory %s: %v", dirPath, err)
 			} else {
@@ -94,6 +149,7 @@ func cleanupOrphanedCache() {
 // cleanupStaleSessions removes sessions that haven't been accessed recently
 func cleanupStaleSessions() {
 	now := time.Now()
+	timeout := hlsSessionTimeout()
 	var toDelete []string
 
 	hlsSessionManager.sessions.Range(func(key, value interface{}) bool {
@@ -101,7 +157,7 @@ func cleanupStaleSessions() {
 		session := value.(*TranscodingSession)
 
 		session.mu.Lock()
-		if now.Sub(session.LastAccessedAt).Seconds() > HLS_SESSION_TIMEOUT {
+		if now.Sub(session.LastAccessedAt) > timeout {
 			toDelete = append(toDelete, sessionID)
 		}
 		session.mu.Unlock()
@@ -122,6 +178,21 @@ func cleanupStaleSessions() {
 	}
 }
 
+// cleanupAllSessions drops every session and its segments; called on
+// shutdown.
+func cleanupAllSessions() {
+	count := 0
+	hlsSessionManager.sessions.Range(func(key, value interface{}) bool {
+		cleanupSession(value.(*TranscodingSession))
+		hlsSessionManager.sessions.Delete(key)
+		count++
+		return true
+	})
+	if count > 0 {
+		log.Printf("🧹 Removed %d HLS sessions on shutdown", count)
+	}
+}
+
 // cleanupSession removes all files and directories for a session
 func cleanupSession(session *TranscodingSession) {
 	session.mu.Lock()
@@ -134,9 +205,10 @@ func cleanupSession(session *TranscodingSession) {
 	}
 }
 
-// getOrCreateSession gets an existing session or creates a new one
-func getOrCreateSession(songID, format, bitrate, filePath string, duration int) (*TranscodingSession, error) {
-	sessionID := fmt.Sprintf("%s_%s_%s", songID, format, bitrate)
+// getOrCreateSession gets an existing session or creates a new one. Sessions
+// are per user, so a session id never grants access to another user's stream.
+func getOrCreateSession(userID int, songID, format, bitrate, filePath string, duration int) (*TranscodingSession, error) {
+	sessionID := fmt.Sprintf("%d_%s_%s_%s", userID, songID, format, bitrate)
 
 	// Check if session exists and is still valid
 	if sessionVal, ok := hlsSessionManager.sessions.Load(sessionID); ok {
@@ -148,13 +220,14 @@ func getOrCreateSession(songID, format, bitrate, filePath string, duration int)
 	}
 
 	// Create new session
-	segmentDir := filepath.Join(HLS_TEMP_DIR, sessionID)
+	segmentDir := filepath.Join(hlsTempDir, sessionID)
 	if err := os.MkdirAll(segmentDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create segment directory: %v", err)
 	}
 
 	session := &TranscodingSession{
 		SessionID:      sessionID,
+		UserID:         userID,
 		SongID:         songID,
 		Format:         format,
 		Bitrate:        bitrate,
@@ -163,6 +236,7 @@ func getOrCreateSession(songID, format, bitrate, filePath string, duration int)
 		CreatedAt:      time.Now(),
 		LastAccessedAt: time.Now(),
 		Duration:       duration,
+		SegmentSeconds: hlsSegmentSeconds(),
 	}
 
 	hlsSessionManager.sessions.Store(sessionID, session)
@@ -196,32 +270,25 @@ func generateHLSPlaylist(c *gin.Context, session *TranscodingSession) {
 	session.mu.Unlock()
 
 	// Calculate total number of segments
-	totalSegments := (session.Duration + HLS_SEGMENT_DURATION - 1) / HLS_SEGMENT_DURATION
+	totalSegments := session.segmentCount()
 
 	// Build M3U8 playlist
 	playlist := "#EXTM3U\n"
 	playlist += "#EXT-X-VERSION:3\n"
-	playlist += fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", HLS_SEGMENT_DURATION)
+	playlist += fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", session.SegmentSeconds)
 	playlist += "#EXT-X-MEDIA-SEQUENCE:0\n"
 	playlist += "#EXT-X-PLAYLIST-TYPE:VOD\n"
 
 	// Add segments
 	for i := 0; i < totalSegments; i++ {
-		segmentDuration := HLS_SEGMENT_DURATION
+		segmentDuration := session.SegmentSeconds
 		if i == totalSegments-1 {
 			// Last segment may be shorter
-			segmentDuration = session.Duration - (i * HLS_SEGMENT_DURATION)
+			segmentDuration = session.Duration - (i * session.SegmentSeconds)
 		}
 		playlist += fmt.Sprintf("#EXTINF:%.3f,\n", float64(segmentDuration))
 
-		// Construct segment URL with JWT authentication (same as playlist request)
-		jwt := c.Query("jwt")
-		segmentURL := fmt.Sprintf("/rest/hlsSegment.view?sessionId=%s&segment=%d&jwt=%s&v=%s&c=%s",
-			session.SessionID,
-			i,
-			jwt,
-			c.Query("v"),
-			c.Query("c"))
+		segmentURL := hlsURL(c, "/rest/hlsSegment.view", url.Values{"sessionId": {session.SessionID}, "segment": {strconv.Itoa(i)}})
 		playlist += segmentURL + "\n"
 	}
 
@@ -233,10 +300,78 @@ func generateHLSPlaylist(c *gin.Context, session *TranscodingSession) {
 	c.String(200, playlist)
 }
 
+// hlsForwardedParams are the Subsonic auth and client parameters copied from
+// the playlist request onto every segment URL.
+var hlsForwardedParams = []string{"jwt", "apiKey", "u", "p", "t", "s", "v", "c"}
+
+// hlsURL builds a playlist entry pointing at path. It carries the same
+// credentials as the playlist request.
+func hlsURL(c *gin.Context, path string, query url.Values) string {
+	for _, key := range hlsForwardedParams {
+		if v := c.Query(key); v != "" {
+			query.Set(key, v)
+		}
+	}
+	return path + "?" + query.Encode()
+}
+
+// hlsAdaptiveBitrates are the variants of an adaptive (master) playlist, in
+// kbps, lowest first.
+var hlsAdaptiveBitrates = []int{96, 128, 192}
+
+// hlsCodecs are the RFC 6381 codec strings announced in a master playlist;
+// formats without an entry are listed without CODECS.
+var hlsCodecs = map[string]string{"mp3": "mp4a.40.34", "aac": "mp4a.40.2"}
+
+// generateHLSMasterPlaylist creates (or reuses) one session per variant and
+// returns a master playlist referencing their media playlists. Creating the
+// sessions up front pre-encodes the first segments of every variant, so the
+// player can switch bitrates without waiting for ffmpeg.
+func generateHLSMasterPlaylist(c *gin.Context, userID int, songID, format string, maxBitRate int, filePath string, duration int) {
+	var bitrates []int
+	for _, b := range hlsAdaptiveBitrates {
+		if maxBitRate <= 0 || b <= maxBitRate || len(bitrates) == 0 {
+			bitrates = append(bitrates, b)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(bitrates))
+	for i, b := range bitrates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = getOrCreateSession(userID, songID, format, strconv.Itoa(b), filePath, duration)
+		}()
+	}
+	wg.Wait()
+
+	playlist := "#EXTM3U\n"
+	playlist += "#EXT-X-VERSION:3\n"
+	playlist += "#EXT-X-INDEPENDENT-SEGMENTS\n"
+	for i, b := range bitrates {
+		if errs[i] != nil {
+			log.Printf("❌ Failed to create HLS variant %dkbps: %v", b, errs[i])
+			continue
+		}
+		info := fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d", b*1000)
+		if codec, ok := hlsCodecs[format]; ok {
+			info += fmt.Sprintf(",CODECS=\"%s\"", codec)
+		}
+		playlist += info + "\n"
+		playlist += hlsURL(c, "/rest/hlsPlaylist.view", url.Values{"id": {songID}, "format": {format}, "maxBitRate": {strconv.Itoa(b)}}) + "\n"
+	}
+
+	c.Header("Content-Type", "application/vnd.apple.mpegurl")
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.String(200, playlist)
+}
+
 // preEncodeFirstSegments quickly encodes first N segments for instant playback
 // Uses on-demand encoding for speed, background process will replace with gapless versions
 func preEncodeFirstSegments(session *TranscodingSession, count int) error {
-	totalSegments := (session.Duration + HLS_SEGMENT_DURATION - 1) / HLS_SEGMENT_DURATION
+	totalSegments := session.segmentCount()
 	if count > totalSegments {
 		count = totalSegments
 	}
@@ -244,7 +379,7 @@ func preEncodeFirstSegments(session *TranscodingSession, count int) error {
 	log.Printf("⚡ Quick-encoding first %d segments for instant playback", count)
 
 	for i := 0; i < count; i++ {
-		startTime := i * HLS_SEGMENT_DURATION
+		startTime := i * session.SegmentSeconds
 		segmentPath := filepath.Join(session.SegmentDir, fmt.Sprintf("segment_%d.ts", i))
 
 		// Check if already exists (from previous session or background encoding)
@@ -253,7 +388,7 @@ func preEncodeFirstSegments(session *TranscodingSession, count int) error {
 			continue
 		}
 
-		if err := generateSegment(session, i, segmentPath, startTime); err != nil {
+		if err := generateSegment(appCtx, session, i, segmentPath, startTime); err != nil {
 			return fmt.Errorf("failed to encode segment %d: %v", i, err)
 		}
 		log.Printf("✅ Quick-encoded segment %d/%d", i+1, count)
@@ -269,7 +404,7 @@ func generateHLSSegment(c *gin.Context, session *TranscodingSession, segmentNum
 	session.mu.Unlock()
 
 	// Calculate start time for this segment
-	startTime := segmentNum * HLS_SEGMENT_DURATION
+	startTime := segmentNum * session.SegmentSeconds
 
 	// Segment file path
 	segmentPath := filepath.Join(session.SegmentDir, fmt.Sprintf("segment_%d.ts", segmentNum))
@@ -285,8 +420,13 @@ func generateHLSSegment(c *gin.Context, session *TranscodingSession, segmentNum
 	// Generate segment using FFmpeg
 	log.Printf("🎬 Generating HLS segment %d for session %s (start=%ds)", segmentNum, session.SessionID, startTime)
 
-	// Generate this segment ON-DEMAND (backend has 10 seconds to generate each segment)
-	if err := generateSegment(session, segmentNum, segmentPath, startTime); err != nil {
+	// Generate this segment ON-DEMAND (backend has one segment's length to generate it)
+	if err := generateSegment(c.Request.Context(), session, segmentNum, segmentPath, startTime); err != nil {
+		if errors.Is(err, errTranscodeSlotsBusy) {
+			c.Header("Retry-After", "1")
+			c.String(503, "Transcode slots busy")
+			return
+		}
 		log.Printf("❌ Segment generation failed: %v", err)
 		c.String(500, "Segment generation failed")
 		return
@@ -335,7 +475,7 @@ func preEncodeHLSSegments(session *TranscodingSession) error {
 
 		// HLS muxer settings
 		"-f", "hls", // HLS output format
-		"-hls_time", fmt.Sprintf("%d", HLS_SEGMENT_DURATION), // Segment duration
+		"-hls_time", fmt.Sprintf("%d", session.SegmentSeconds), // Segment duration
 		"-hls_list_size", "0", // Keep all segments in playlist
 		"-hls_segment_type", "mpegts", // Use MPEG-TS for audio
 		"-hls_flags", "split_by_time+independent_segments", // Accurate splitting + independent segments
@@ -345,8 +485,16 @@ func preEncodeHLSSegments(session *TranscodingSession) error {
 		filepath.Join(session.SegmentDir, "playlist.m3u8"),
 	)
 
+	// The whole-file encode is the slowest ffmpeg job, so it queues for a
+	// transcode slot like any stream; segments are encoded on demand meanwhile.
+	release, ok := acquireTranscodeSlot(appCtx, hlsPreEncodeQueueWait)
+	if !ok {
+		return errTranscodeSlotsBusy
+	}
+	defer release()
+
 	// Run FFmpeg in background
-	cmd := exec.Command("ffmpeg", ffmpegArgs...)
+	cmd := exec.CommandContext(appCtx, "ffmpeg", ffmpegArgs...)
 
 	// Capture output for debugging
 	output, err := cmd.CombinedOutput()
@@ -360,7 +508,9 @@ func preEncodeHLSSegments(session *TranscodingSession) error {
 
 // generateSegment generates a single HLS segment on-demand (FALLBACK ONLY)
 // NOTE: This approach can cause audio gaps - pre-encoding is preferred
-func generateSegment(session *TranscodingSession, segmentNum int, segmentPath string, startTime int) error {
+// It waits up to transcodeQueueWait for a transcode slot and returns
+// errTranscodeSlotsBusy when none frees up.
+func generateSegment(ctx context.Context, session *TranscodingSession, segmentNum int, segmentPath string, startTime int) error {
 	var ffmpegArgs []string
 
 	// Input file
@@ -372,7 +522,7 @@ func generateSegment(session *TranscodingSession, segmentNum int, segmentPath st
 	}
 
 	// Segment duration (exact, no overlap - overlap causes artifacts!)
-	ffmpegArgs = append(ffmpegArgs, "-t", fmt.Sprintf("%d", HLS_SEGMENT_DURATION))
+	ffmpegArgs = append(ffmpegArgs, "-t", fmt.Sprintf("%d", session.SegmentSeconds))
 
 	// Convert bitrate string to int for getTranscodingProfile
 	bitrateInt, err := strconv.Atoi(session.Bitrate)
@@ -397,7 +547,13 @@ func generateSegment(session *TranscodingSession, segmentNum int, segmentPath st
 		segmentPath,
 	)
 
-	cmd := exec.Command("ffmpeg", ffmpegArgs...)
+	release, ok := acquireTranscodeSlot(ctx, transcodeQueueWait)
+	if !ok {
+		return errTranscodeSlotsBusy
+	}
+	defer release()
+
+	cmd := exec.CommandContext(appCtx, "ffmpeg", ffmpegArgs...)
 
 	// Run FFmpeg
 	output, err := cmd.CombinedOutput()
@@ -446,8 +602,17 @@ func subsonicHLSPlaylist(c *gin.Context) {
 		format = "mp3"
 	}
 
+	user := c.MustGet("user").(User)
+
+	// adaptive=true returns a master playlist of several bitrates instead
+	if c.Query("adaptive") == "true" {
+		maxBitRate, _ := strconv.Atoi(c.Query("maxBitRate"))
+		generateHLSMasterPlaylist(c, user.ID, songID, format, maxBitRate, filePath, duration)
+		return
+	}
+
 	// Get or create session
-	session, err := getOrCreateSession(songID, format, bitrate, filePath, duration)
+	session, err := getOrCreateSession(user.ID, songID, format, bitrate, filePath, duration)
 	if err != nil {
 		log.Printf("❌ Failed to create HLS session: %v", err)
 		c.String(500, "Failed to create transcoding session")
@@ -487,6 +652,11 @@ func subsonicHLSSegment(c *gin.Context) {
 	}
 
 	session := sessionVal.(*TranscodingSession)
+	if user := c.MustGet("user").(User); session.UserID != user.ID {
+		log.Printf("❌ HLS session %s requested by user %s, who does not own it", sessionID, user.Username)
+		c.String(403, "Session belongs to another user")
+		return
+	}
 
 	// Generate and serve segment
 	generateHLSSegment(c, session, segmentNum)
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHLSSegmentSecondsFromConfig(t *testing.T) {
+	d := scanTestDB(t)
+
+	if got := hlsSegmentSeconds(); got != HLS_SEGMENT_DURATION {
+		t.Errorf("unset hls_segment_seconds = %d, want default %d", got, HLS_SEGMENT_DURATION)
+	}
+	d.Exec(`INSERT INTO configuration (key, value) VALUES ('hls_segment_seconds', '1'), ('hls_session_timeout_seconds', 'soon')`)
+	if got := hlsSegmentSeconds(); got != HLS_SEGMENT_DURATION {
+		t.Errorf("out-of-range hls_segment_seconds = %d, want default %d", got, HLS_SEGMENT_DURATION)
+	}
+	if got := hlsSessionTimeout().Seconds(); got != HLS_SESSION_TIMEOUT {
+		t.Errorf("invalid hls_session_timeout_seconds = %v, want default %d", got, HLS_SESSION_TIMEOUT)
+	}
+
+	d.Exec(`UPDATE configuration SET value = '4' WHERE key = 'hls_segment_seconds'`)
+	session := &TranscodingSession{SessionID: "s", Duration: 10, SegmentSeconds: hlsSegmentSeconds()}
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/rest/hlsPlaylist?id=s&u=alice&t=tok&s=salt&v=1.16.1&c=web", nil)
+	generateHLSPlaylist(c, session)
+
+	body := w.Body.String()
+	if !strings.Contains(body, "#EXT-X-TARGETDURATION:4\n") {
+		t.Errorf("playlist target duration not 4:\n%s", body)
+	}
+	if got := strings.Count(body, "#EXTINF:"); got != 3 {
+		t.Errorf("playlist has %d segments, want 3:\n%s", got, body)
+	}
+	if !strings.Contains(body, "/rest/hlsSegment.view?c=web&s=salt&segment=2&sessionId=s&t=tok&u=alice&v=1.16.1\n") {
+		t.Errorf("segment URLs should carry the request's credentials:\n%s", body)
+	}
+	if !strings.Contains(body, "#EXTINF:2.000,") {
+		t.Errorf("last segment should be 2s:\n%s", body)
+	}
+}
+
+func TestHLSSegmentRejectsOtherUsers(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "segment_0.ts"), []byte("ts"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	session := &TranscodingSession{SessionID: "1_song_mp3_192", UserID: 1, SegmentDir: dir, Duration: 5, SegmentSeconds: 10}
+	hlsSessionManager.sessions.Store(session.SessionID, session)
+	defer hlsSessionManager.sessions.Delete(session.SessionID)
+
+	gin.SetMode(gin.TestMode)
+	get := func(user User) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/rest/hlsSegment?sessionId=1_song_mp3_192&segment=0", nil)
+		c.Set("user", user)
+		subsonicHLSSegment(c)
+		return w
+	}
+	if w := get(User{ID: 2, Username: "other"}); w.Code != http.StatusForbidden {
+		t.Errorf("other user got %d, want 403", w.Code)
+	}
+	if w := get(User{ID: 1, Username: "owner"}); w.Code != http.StatusOK || w.Body.String() != "ts" {
+		t.Errorf("owner got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestHLSSegmentNeedsTranscodeSlot(t *testing.T) {
+	scanTestDB(t)
+	t.Cleanup(func() { transcodeSlots.slots = nil })
+	if _, err := db.Exec(`INSERT INTO configuration (key, value) VALUES ('max_concurrent_transcodes', '1')`); err != nil {
+		t.Fatal(err)
+	}
+	release, ok := acquireTranscodeSlot(context.Background(), time.Second)
+	if !ok {
+		t.Fatal("could not take the only transcode slot")
+	}
+	defer release()
+
+	dir := t.TempDir()
+	session := &TranscodingSession{SessionID: "1_song_mp3_192", UserID: 1, Format: "mp3", Bitrate: "192", FilePath: "/m/song.flac", SegmentDir: dir, Duration: 30, SegmentSeconds: 10}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	segmentPath := filepath.Join(dir, "segment_1.ts")
+	if err := generateSegment(ctx, session, 1, segmentPath, 10); !errors.Is(err, errTranscodeSlotsBusy) {
+		t.Fatalf("generateSegment with every slot taken: %v, want errTranscodeSlotsBusy", err)
+	}
+	if _, err := os.Stat(segmentPath); !os.IsNotExist(err) {
+		t.Errorf("ffmpeg ran without a slot: %v", err)
+	}
+}
+
+func TestHLSMasterPlaylistListsVariants(t *testing.T) {
+	// Existing sessions are reused, so no ffmpeg runs here.
+	for _, b := range []string{"96", "128", "192"} {
+		id := "1_song_aac_" + b
+		hlsSessionManager.sessions.Store(id, &TranscodingSession{SessionID: id, UserID: 1, SegmentSeconds: 10})
+		defer hlsSessionManager.sessions.Delete(id)
+	}
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/rest/hlsPlaylist?id=song&adaptive=true&jwt=tok", nil)
+	generateHLSMasterPlaylist(c, 1, "song", "aac", 128, "/m/song.flac", 200)
+
+	body := w.Body.String()
+	if got := strings.Count(body, "#EXT-X-STREAM-INF:"); got != 2 {
+		t.Fatalf("master playlist has %d variants, want 2 (capped at maxBitRate 128):\n%s", got, body)
+	}
+	for _, want := range []string{
+		"#EXT-X-STREAM-INF:BANDWIDTH=96000,CODECS=\"mp4a.40.2\"\n/rest/hlsPlaylist.view?format=aac&id=song&jwt=tok&maxBitRate=96\n",
+		"#EXT-X-STREAM-INF:BANDWIDTH=128000,CODECS=\"mp4a.40.2\"\n/rest/hlsPlaylist.view?format=aac&id=song&jwt=tok&maxBitRate=128\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("master playlist missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestInitHLSTempDir(t *testing.T) {
+	old := hlsTempDir
+	defer func() { hlsTempDir = old }()
+
+	initHLSTempDir("/config/music.db")
+	if hlsTempDir != filepath.Join("/config", "hls_cache") {
+		t.Errorf("default dir = %s, want next to the database", hlsTempDir)
+	}
+	initHLSTempDir("file::memory:?cache=shared")
+	if hlsTempDir != filepath.Join(os.TempDir(), "audiomuse-hls_cache") {
+		t.Errorf("in-memory default = %s, want under the temp dir", hlsTempDir)
+	}
+	t.Setenv("HLS_TEMP_DIR", "/scratch/hls")
+	initHLSTempDir("/config/music.db")
+	if hlsTempDir != "/scratch/hls" {
+		t.Errorf("HLS_TEMP_DIR ignored: %s", hlsTempDir)
+	}
+}
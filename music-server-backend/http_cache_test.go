@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/gin-gonic/gin"
+)
+
+func serveWithHeaders(handler func(*gin.Context), headers map[string]string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/rest/x", nil)
+	for k, v := range headers {
+		c.Request.Header.Set(k, v)
+	}
+	handler(c)
+	c.Writer.WriteHeaderNow() // as gin does once the handlers return
+	return w
+}
+
+func TestDirectStreamConditionalGet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "song.mp3")
+	if err := os.WriteFile(path, []byte("not really audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stream := func(c *gin.Context) { streamDirect(c, path) }
+
+	w := serveWithHeaders(stream, nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Header().Get("Last-Modified") == "" {
+		t.Fatalf("first request: %d, ETag %q", w.Code, etag)
+	}
+	if w := serveWithHeaders(stream, map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("matching If-None-Match should give 304, got %d", w.Code)
+	}
+
+	if err := os.WriteFile(path, []byte("different audio now"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if w := serveWithHeaders(stream, map[string]string{"If-None-Match": etag}); w.Code != http.StatusOK {
+		t.Fatalf("a changed file should be sent again, got %d", w.Code)
+	}
+}
+
+func TestCoverArtConditionalGet(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+
+	dir := t.TempDir()
+	songPath := filepath.Join(dir, "01.mp3")
+	if err := os.WriteFile(songPath, []byte("no tags here"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := imaging.Save(image.NewRGBA(image.Rect(0, 0, 64, 64)), filepath.Join(dir, "cover.png")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO songs (id, title, artist, album, album_path, path, duration, play_count, cancelled)
+		VALUES ('s1', 'One', 'A', 'X', ?, ?, 60, 0, 0)`, dir, songPath); err != nil {
+		t.Fatal(err)
+	}
+	art := func(size int) func(*gin.Context) {
+		return func(c *gin.Context) { handleAlbumArt(c, "s1", size) }
+	}
+
+	w := serveWithHeaders(art(32), nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Header().Get("Cache-Control") != coverArtCacheControl {
+		t.Fatalf("first request: %d, headers %v", w.Code, w.Header())
+	}
+	if w := serveWithHeaders(art(32), map[string]string{"If-None-Match": `"other", ` + etag}); w.Code != http.StatusNotModified {
+		t.Fatalf("matching If-None-Match should give 304, got %d", w.Code)
+	}
+	if w := serveWithHeaders(art(32), map[string]string{"If-Modified-Since": w.Header().Get("Last-Modified")}); w.Code != http.StatusNotModified {
+		t.Fatalf("If-Modified-Since should give 304, got %d", w.Code)
+	}
+	if w := serveWithHeaders(art(64), map[string]string{"If-None-Match": etag}); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("another size is another representation, got %d", w.Code)
+	}
+}
+
+func TestCoverArtWebPNegotiation(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+	t.Cleanup(func() { webpUnavailable.Store(false) })
+
+	dir := t.TempDir()
+	songPath := filepath.Join(dir, "01.mp3")
+	if err := os.WriteFile(songPath, []byte("no tags here"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := imaging.Save(image.NewRGBA(image.Rect(0, 0, 64, 64)), filepath.Join(dir, "cover.png")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO songs (id, title, artist, album, album_path, path, duration, play_count, cancelled)
+		VALUES ('s1', 'One', 'A', 'X', ?, ?, 60, 0, 0)`, dir, songPath); err != nil {
+		t.Fatal(err)
+	}
+	art := func(c *gin.Context) { handleAlbumArt(c, "s1", 32) }
+
+	plain := serveWithHeaders(art, map[string]string{"Accept": "image/png,*/*"})
+	webp := serveWithHeaders(art, map[string]string{"Accept": "image/avif,image/webp,*/*;q=0.8"})
+	if plain.Header().Get("Vary") != "Accept" || webp.Header().Get("Vary") != "Accept" {
+		t.Errorf("art responses should vary by Accept: %v / %v", plain.Header(), webp.Header())
+	}
+	if plain.Header().Get("Content-Type") == "image/webp" {
+		t.Error("WebP sent to a client that did not ask for it")
+	}
+	switch {
+	case webp.Header().Get("Content-Type") == "image/webp":
+		if !bytes.HasPrefix(webp.Body.Bytes(), []byte("RIFF")) || webp.Header().Get("ETag") == plain.Header().Get("ETag") {
+			t.Errorf("WebP variant: ETag %q, body starts %q", webp.Header().Get("ETag"), webp.Body.Bytes()[:4])
+		}
+	case webp.Code != http.StatusOK || !webpUnavailable.Load():
+		t.Errorf("without a WebP-capable ffmpeg the art should fall back, got %d %v", webp.Code, webp.Header())
+	}
+}
+
+func TestAcceptsWebP(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"image/webp,*/*":                 true,
+		"image/avif, image/webp;q=0.9":   true,
+		"image/*":                        true,
+		"IMAGE/WEBP":                     true,
+		"image/webp;q=0":                 false,
+		"*/*":                            false,
+		"image/png,image/jpeg;q=0.9,*/*": false,
+		"":                               false,
+	} {
+		if got := acceptsWebP(accept); got != want {
+			t.Errorf("acceptsWebP(%q) = %v, want %v", accept, got, want)
+		}
+	}
+}
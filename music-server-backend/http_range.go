@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// httpByteRange is one parsed byte-range-spec; end is inclusive.
+type httpByteRange struct {
+	start, end int64
+}
+
+// parseFirstRange parses the first range of a Range header for a body of size
+// bytes. ok is false when the header is malformed or the range cannot be
+// satisfied.
+func parseFirstRange(header string, size int64) (r httpByteRange, count int, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found {
+		return r, 0, false
+	}
+	specs := strings.Split(spec, ",")
+	first := strings.TrimSpace(specs[0])
+	startStr, endStr, found := strings.Cut(first, "-")
+	if !found {
+		return r, len(specs), false
+	}
+
+	if startStr == "" {
+		// Suffix range: the last n bytes.
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return r, len(specs), false
+		}
+		if n > size {
+			n = size
+		}
+		return httpByteRange{size - n, size - 1}, len(specs), true
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return r, len(specs), false
+	}
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return r, len(specs), false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return httpByteRange{start, end}, len(specs), true
+}
+
+// prepareRangeRequest checks the Range header of a direct stream before
+// http.ServeContent sees it. Multi-range requests are collapsed to their first
+// range, since a multipart/byteranges body is not something audio players can
+// use; malformed or unsatisfiable ranges get a 416 here, unless If-Range may
+// turn the request into a plain GET. It reports false when the response has
+// already been written.
+func prepareRangeRequest(c *gin.Context, name string, size int64) bool {
+	c.Header("Accept-Ranges", "bytes")
+	header := c.GetHeader("Range")
+	if header == "" {
+		return true
+	}
+
+	r, count, ok := parseFirstRange(header, size)
+	if !ok && c.GetHeader("If-Range") != "" {
+		// The range may be ignored anyway; let ServeContent decide.
+		return true
+	}
+	if !ok {
+		log.Printf("📍 Unsatisfiable Range %q for %s (%d bytes): 416", header, name, size)
+		c.Header("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+		c.Status(http.StatusRequestedRangeNotSatisfiable)
+		return false
+	}
+	if count > 1 {
+		log.Printf("📍 Multi-range request %q for %s: serving the first range only", header, name)
+		c.Request.Header.Set("Range", "bytes="+strconv.FormatInt(r.start, 10)+"-"+strconv.FormatInt(r.end, 10))
+	}
+	log.Printf("📍 Range bytes=%d-%d/%d of %s", r.start, r.end, size, name)
+	return true
+}
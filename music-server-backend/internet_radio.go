@@ -0,0 +1,179 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Internet radio stations are external stream URLs kept in the internet_radio
+// table; they have nothing to do with the AI radio feature. Station ids carry
+// the "ir-" prefix so stream.view can tell them apart from song ids and send
+// the client on to the station instead of proxying arbitrary URLs.
+
+const internetRadioIDPrefix = "ir-"
+
+// --- getInternetRadioStations / create / update / delete --------------------
+
+// SubsonicInternetRadioStations is the getInternetRadioStations response.
+type SubsonicInternetRadioStations struct {
+	XMLName  xml.Name                       `xml:"internetRadioStations" json:"-"`
+	Stations []SubsonicInternetRadioStation `xml:"internetRadioStation" json:"internetRadioStation"`
+}
+
+type SubsonicInternetRadioStation struct {
+	XMLName     xml.Name `xml:"internetRadioStation" json:"-"`
+	ID          string   `xml:"id,attr" json:"id"`
+	Name        string   `xml:"name,attr" json:"name"`
+	StreamURL   string   `xml:"streamUrl,attr" json:"streamUrl"`
+	HomePageURL string   `xml:"homePageUrl,attr,omitempty" json:"homePageUrl,omitempty"`
+}
+
+// internetRadioRowID parses a station id ("ir-3"), accepting the bare number
+// too since some clients strip what they do not expect.
+func internetRadioRowID(id string) (int64, bool) {
+	n, err := strconv.ParseInt(strings.TrimPrefix(id, internetRadioIDPrefix), 10, 64)
+	return n, err == nil && n > 0
+}
+
+// validRadioURL accepts absolute http(s) URLs; empty is allowed when optional.
+func validRadioURL(raw string, optional bool) bool {
+	if raw == "" {
+		return optional
+	}
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// canManageInternetRadio gates create/update/delete behind admin or the
+// settings role.
+func canManageInternetRadio(c *gin.Context) bool {
+	user := c.MustGet("user").(User)
+	if !userHasRole(user, roleSettings) {
+		subsonicRespond(c, newSubsonicErrorResponse(50, "User is not authorized to manage internet radio stations."))
+		return false
+	}
+	return true
+}
+
+func subsonicGetInternetRadioStations(c *gin.Context) {
+	_ = c.MustGet("user")
+
+	rows, err := db.Query("SELECT id, name, stream_url, COALESCE(homepage_url, '') FROM internet_radio ORDER BY name COLLATE NOCASE, id")
+	if err != nil {
+		log.Printf("getInternetRadioStations: query failed: %v", err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error."))
+		return
+	}
+	defer rows.Close()
+
+	stations := []SubsonicInternetRadioStation{}
+	for rows.Next() {
+		var id int64
+		var s SubsonicInternetRadioStation
+		if err := rows.Scan(&id, &s.Name, &s.StreamURL, &s.HomePageURL); err != nil {
+			continue
+		}
+		s.ID = internetRadioIDPrefix + strconv.FormatInt(id, 10)
+		stations = append(stations, s)
+	}
+	subsonicRespond(c, newSubsonicResponse(&SubsonicInternetRadioStations{Stations: stations}))
+}
+
+func subsonicCreateInternetRadioStation(c *gin.Context) {
+	if !canManageInternetRadio(c) {
+		return
+	}
+	streamURL, name, homepageURL := c.Query("streamUrl"), strings.TrimSpace(c.Query("name")), c.Query("homepageUrl")
+	if streamURL == "" || name == "" {
+		subsonicRespond(c, newSubsonicErrorResponse(10, "Required parameters streamUrl and name are missing."))
+		return
+	}
+	if !validRadioURL(streamURL, false) || !validRadioURL(homepageURL, true) {
+		subsonicRespond(c, newSubsonicErrorResponse(10, "streamUrl and homepageUrl must be http(s) URLs."))
+		return
+	}
+
+	if _, err := db.Exec("INSERT INTO internet_radio (name, stream_url, homepage_url) VALUES (?, ?, ?)", name, streamURL, homepageURL); err != nil {
+		log.Printf("createInternetRadioStation: insert failed: %v", err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Error creating internet radio station."))
+		return
+	}
+	subsonicRespond(c, newSubsonicResponse(nil))
+}
+
+func subsonicUpdateInternetRadioStation(c *gin.Context) {
+	if !canManageInternetRadio(c) {
+		return
+	}
+	id, ok := internetRadioRowID(c.Query("id"))
+	streamURL, name, homepageURL := c.Query("streamUrl"), strings.TrimSpace(c.Query("name")), c.Query("homepageUrl")
+	if !ok || streamURL == "" || name == "" {
+		subsonicRespond(c, newSubsonicErrorResponse(10, "Required parameters id, streamUrl and name are missing."))
+		return
+	}
+	if !validRadioURL(streamURL, false) || !validRadioURL(homepageURL, true) {
+		subsonicRespond(c, newSubsonicErrorResponse(10, "streamUrl and homepageUrl must be http(s) URLs."))
+		return
+	}
+
+	res, err := db.Exec("UPDATE internet_radio SET name = ?, stream_url = ?, homepage_url = ? WHERE id = ?", name, streamURL, homepageURL, id)
+	if err != nil {
+		log.Printf("updateInternetRadioStation: update failed: %v", err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Error updating internet radio station."))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		subsonicRespond(c, newSubsonicErrorResponse(70, "Internet radio station not found."))
+		return
+	}
+	subsonicRespond(c, newSubsonicResponse(nil))
+}
+
+func subsonicDeleteInternetRadioStation(c *gin.Context) {
+	if !canManageInternetRadio(c) {
+		return
+	}
+	id, ok := internetRadioRowID(c.Query("id"))
+	if !ok {
+		subsonicRespond(c, newSubsonicErrorResponse(10, "Required parameter id is missing."))
+		return
+	}
+
+	res, err := db.Exec("DELETE FROM internet_radio WHERE id = ?", id)
+	if err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Error deleting internet radio station."))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		subsonicRespond(c, newSubsonicErrorResponse(70, "Internet radio station not found."))
+		return
+	}
+	subsonicRespond(c, newSubsonicResponse(nil))
+}
+
+// streamInternetRadio redirects stream.view calls for a station id to the
+// station's URL. It reports false when id is not a station id.
+func streamInternetRadio(c *gin.Context, id string) bool {
+	if !strings.HasPrefix(id, internetRadioIDPrefix) {
+		return false
+	}
+	rowID, ok := internetRadioRowID(id)
+	var streamURL string
+	err := sql.ErrNoRows
+	if ok {
+		err = db.QueryRow("SELECT stream_url FROM internet_radio WHERE id = ?", rowID).Scan(&streamURL)
+	}
+	if err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(70, "Internet radio station not found."))
+		return true
+	}
+	c.Redirect(http.StatusFound, streamURL)
+	return true
+}
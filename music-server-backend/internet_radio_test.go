@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestInternetRadioStations(t *testing.T) {
+	db = setupPlaylistTestDB(t)
+	defer db.Close()
+	stmts := []string{
+		`ALTER TABLE users ADD COLUMN settings_role INTEGER NOT NULL DEFAULT 1`,
+		`CREATE TABLE internet_radio (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, stream_url TEXT NOT NULL, homepage_url TEXT NOT NULL DEFAULT '')`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+
+	callHandler(t, subsonicCreateInternetRadioStation, "name=Jazz+FM&streamUrl=http://radio.example/jazz&homepageUrl=https://radio.example")
+	callHandler(t, subsonicCreateInternetRadioStation, "name=Ambient&streamUrl=https://ambient.example/live")
+
+	list := func() []interface{} {
+		stations, _ := callHandler(t, subsonicGetInternetRadioStations, "")["internetRadioStations"].(map[string]interface{})
+		l, _ := stations["internetRadioStation"].([]interface{})
+		return l
+	}
+	stations := list()
+	if len(stations) != 2 {
+		t.Fatalf("stations = %v", stations)
+	}
+	first := stations[0].(map[string]interface{})
+	if first["name"] != "Ambient" || !strings.HasPrefix(first["id"].(string), internetRadioIDPrefix) || first["homePageUrl"] != nil {
+		t.Fatalf("first station = %v", first)
+	}
+	jazzID := stations[1].(map[string]interface{})["id"].(string)
+
+	callHandler(t, subsonicUpdateInternetRadioStation, "id="+jazzID+"&name=Smooth+Jazz&streamUrl=http://radio.example/smooth")
+	if got := list()[1].(map[string]interface{}); got["name"] != "Smooth Jazz" || got["streamUrl"] != "http://radio.example/smooth" {
+		t.Fatalf("updated station = %v", got)
+	}
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/rest/stream?id="+jazzID, nil)
+	c.Set("user", User{ID: 1, Username: "test"})
+	subsonicStream(c)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "http://radio.example/smooth" {
+		t.Fatalf("stream of a station should redirect, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	callHandler(t, subsonicDeleteInternetRadioStation, "id="+jazzID)
+	if len(list()) != 1 {
+		t.Fatal("station should be deleted")
+	}
+}
+
+func TestInternetRadioRequiresSettingsRole(t *testing.T) {
+	db = setupPlaylistTestDB(t)
+	defer db.Close()
+	stmts := []string{
+		`ALTER TABLE users ADD COLUMN settings_role INTEGER NOT NULL DEFAULT 0`,
+		`CREATE TABLE internet_radio (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, stream_url TEXT NOT NULL, homepage_url TEXT NOT NULL DEFAULT '')`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+
+	for _, query := range []string{
+		"name=X&streamUrl=http://x.example/",
+		"name=X&streamUrl=ftp://x.example/",
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/rest/x?f=json&"+query, nil)
+		c.Set("user", User{ID: 1, Username: "test"})
+		subsonicCreateInternetRadioStation(c)
+		if !strings.Contains(w.Body.String(), `"code":50`) {
+			t.Fatalf("%s: expected authorization error, got %s", query, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/rest/x?f=json&name=X&streamUrl=ftp://x.example/", nil)
+	c.Set("user", User{ID: 1, Username: "test", IsAdmin: true})
+	subsonicCreateInternetRadioStation(c)
+	if !strings.Contains(w.Body.String(), `"code":10`) {
+		t.Fatalf("non-http stream URL should be rejected, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/xml"
+	"log"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- jukeboxControl ---------------------------------------------------------
+
+// Jukebox mode plays a server-side queue on the host's own audio output, for
+// servers wired to speakers. There is a single queue shared by every jukebox
+// user. Each track is played by an ffplay subprocess; pausing kills it and
+// remembers the position, resuming starts a new one with -ss. Because it
+// controls the host's audio, it is off unless enable_jukebox is true and
+// needs the jukebox role.
+
+const defaultJukeboxGain = 0.5
+
+// SubsonicJukeboxStatus is the jukeboxControl response for every action but get.
+type SubsonicJukeboxStatus struct {
+	XMLName      xml.Name `xml:"jukeboxStatus" json:"-"`
+	CurrentIndex int      `xml:"currentIndex,attr" json:"currentIndex"`
+	Playing      bool     `xml:"playing,attr" json:"playing"`
+	Gain         float64  `xml:"gain,attr" json:"gain"`
+	Position     int      `xml:"position,attr" json:"position"`
+}
+
+// SubsonicJukeboxPlaylist is the jukeboxControl action=get response.
+type SubsonicJukeboxPlaylist struct {
+	XMLName      xml.Name       `xml:"jukeboxPlaylist" json:"-"`
+	CurrentIndex int            `xml:"currentIndex,attr" json:"currentIndex"`
+	Playing      bool           `xml:"playing,attr" json:"playing"`
+	Gain         float64        `xml:"gain,attr" json:"gain"`
+	Position     int            `xml:"position,attr" json:"position"`
+	Entries      []SubsonicSong `xml:"entry" json:"entry"`
+}
+
+// jukeboxCommand builds the player process for one track; offset is in
+// seconds and gain in 0..1. Tests replace it.
+var jukeboxCommand = func(path string, offset int, gain float64) *exec.Cmd {
+	return exec.CommandContext(appCtx, "ffplay", "-nodisp", "-autoexit", "-loglevel", "quiet",
+		"-volume", strconv.Itoa(int(gain*100+0.5)), "-ss", strconv.Itoa(offset), path)
+}
+
+type jukeboxPlayer struct {
+	mu      sync.Mutex
+	queue   []string
+	index   int // -1 when the queue is empty
+	playing bool
+	gain    float64
+	offset  int       // seconds into the current track when the player started
+	started time.Time // when the current player process started
+	cmd     *exec.Cmd
+	gen     int // bumped whenever cmd is replaced, so stale exits are ignored
+}
+
+var jukebox = &jukeboxPlayer{index: -1, gain: defaultJukeboxGain}
+
+// jukeboxEnabled reports whether the admin has turned on jukebox mode via the
+// enable_jukebox configuration key (off by default).
+func jukeboxEnabled() bool {
+	return configBool(db, "enable_jukebox")
+}
+
+// positionLocked returns the playback position in seconds.
+func (j *jukeboxPlayer) positionLocked() int {
+	if j.playing {
+		return j.offset + int(time.Since(j.started).Seconds())
+	}
+	return j.offset
+}
+
+// stopLocked kills the player, keeping the position so start resumes there.
+func (j *jukeboxPlayer) stopLocked() {
+	j.offset = j.positionLocked()
+	j.playing = false
+	if j.cmd != nil {
+		j.gen++
+		if j.cmd.Process != nil {
+			j.cmd.Process.Kill()
+		}
+		j.cmd = nil
+	}
+}
+
+// playLocked starts the track at index from offset, skipping songs that are
+// no longer in the library, and moves on to the next track when it ends.
+func (j *jukeboxPlayer) playLocked() {
+	for ; j.index >= 0 && j.index < len(j.queue); j.index, j.offset = j.index+1, 0 {
+		path, _, err := QuerySongPathAndDuration(db, j.queue[j.index])
+		if err != nil {
+			log.Printf("Jukebox: skipping %s: %v", j.queue[j.index], err)
+			continue
+		}
+		cmd := jukeboxCommand(path, j.offset, j.gain)
+		if err := cmd.Start(); err != nil {
+			log.Printf("Jukebox: failed to start player: %v", err)
+			j.playing = false
+			return
+		}
+		j.gen++
+		gen := j.gen
+		j.cmd, j.playing, j.started = cmd, true, time.Now()
+		go func() {
+			cmd.Wait()
+			j.mu.Lock()
+			defer j.mu.Unlock()
+			if j.gen != gen {
+				return
+			}
+			j.cmd = nil
+			j.index, j.offset = j.index+1, 0
+			j.playLocked()
+		}()
+		return
+	}
+	// Ran off the end of the queue.
+	j.playing, j.offset = false, 0
+	if len(j.queue) == 0 {
+		j.index = -1
+	} else {
+		j.index = len(j.queue) - 1
+	}
+}
+
+// stopJukebox pauses playback, e.g. when jukebox mode is switched off.
+func stopJukebox() {
+	jukebox.mu.Lock()
+	defer jukebox.mu.Unlock()
+	jukebox.stopLocked()
+}
+
+func (j *jukeboxPlayer) statusLocked() SubsonicJukeboxStatus {
+	return SubsonicJukeboxStatus{CurrentIndex: j.index, Playing: j.playing, Gain: j.gain, Position: j.positionLocked()}
+}
+
+func subsonicJukeboxControl(c *gin.Context) {
+	user := c.MustGet("user").(User)
+	if !jukeboxEnabled() {
+		subsonicRespond(c, newSubsonicErrorResponse(50, "Jukebox is disabled on this server."))
+		return
+	}
+	if !userHasRole(user, roleJukebox) {
+		subsonicRespond(c, newSubsonicErrorResponse(50, "User is not authorized for jukebox playback."))
+		return
+	}
+
+	action := c.Query("action")
+	var ids []string
+	if action == "set" || action == "add" {
+		for _, id := range c.QueryArray("id") {
+			exists, err := SongExists(db, id)
+			if err != nil {
+				subsonicRespond(c, newSubsonicErrorResponse(0, "Database error."))
+				return
+			}
+			if !exists {
+				subsonicRespond(c, newSubsonicErrorResponse(70, "Song not found: "+id))
+				return
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	j := jukebox
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	switch action {
+	case "get":
+		songs, err := getSongsByIDs(j.queue)
+		if err != nil {
+			subsonicRespond(c, newSubsonicErrorResponse(0, "Database error fetching jukebox playlist."))
+			return
+		}
+		byID := make(map[string]SubsonicSong, len(songs))
+		for _, s := range songs {
+			byID[s.ID] = s
+		}
+		entries := make([]SubsonicSong, 0, len(j.queue))
+		for _, id := range j.queue {
+			if s, ok := byID[id]; ok {
+				entries = append(entries, s)
+			}
+		}
+		status := j.statusLocked()
+		subsonicRespond(c, newSubsonicResponse(&SubsonicJukeboxPlaylist{
+			CurrentIndex: status.CurrentIndex,
+			Playing:      status.Playing,
+			Gain:         status.Gain,
+			Position:     status.Position,
+			Entries:      entries,
+		}))
+		return
+	case "status":
+	case "set":
+		wasPlaying := j.playing
+		j.stopLocked()
+		j.queue, j.index, j.offset = ids, -1, 0
+		if len(ids) > 0 {
+			j.index = 0
+			if wasPlaying {
+				j.playLocked()
+			}
+		}
+	case "start":
+		if !j.playing {
+			if j.index < 0 && len(j.queue) > 0 {
+				j.index = 0
+			}
+			j.playLocked()
+		}
+	case "stop":
+		j.stopLocked()
+	case "skip":
+		index, err := strconv.Atoi(c.Query("index"))
+		if err != nil || index < 0 || index >= len(j.queue) {
+			subsonicRespond(c, newSubsonicErrorResponse(10, "Invalid index."))
+			return
+		}
+		offset := 0
+		if v := c.Query("offset"); v != "" {
+			if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+				subsonicRespond(c, newSubsonicErrorResponse(10, "Invalid offset."))
+				return
+			}
+		}
+		j.stopLocked()
+		j.index, j.offset = index, offset
+		j.playLocked()
+	case "add":
+		j.queue = append(j.queue, ids...)
+		if j.index < 0 && len(j.queue) > 0 {
+			j.index = 0
+		}
+	case "clear":
+		j.stopLocked()
+		j.queue, j.index, j.offset = nil, -1, 0
+	case "setGain":
+		gain, err := strconv.ParseFloat(c.Query("gain"), 64)
+		if err != nil || gain < 0 || gain > 1 {
+			subsonicRespond(c, newSubsonicErrorResponse(10, "gain must be between 0.0 and 1.0."))
+			return
+		}
+		j.gain = gain
+		// ffplay cannot change volume on the fly; restart at the same spot.
+		if j.playing {
+			j.stopLocked()
+			j.playLocked()
+		}
+	default:
+		subsonicRespond(c, newSubsonicErrorResponse(10, "Invalid or missing action."))
+		return
+	}
+	status := j.statusLocked()
+	subsonicRespond(c, newSubsonicResponse(&status))
+}
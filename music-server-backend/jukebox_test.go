@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestJukeboxControl(t *testing.T) {
+	db = setupPlaylistTestDB(t)
+	defer db.Close()
+	stmts := []string{
+		`CREATE TABLE configuration (key TEXT PRIMARY KEY NOT NULL, value TEXT)`,
+		`ALTER TABLE users ADD COLUMN jukebox_role INTEGER NOT NULL DEFAULT 0`,
+		`INSERT INTO users (id, username, is_admin) VALUES (2, 'guest', 0)`,
+		`UPDATE users SET jukebox_role = 1 WHERE id = 1`,
+		`INSERT INTO songs (id, title, artist, album, album_path, path, duration, play_count, cancelled) VALUES
+			('a', 'A', 'X', 'Y', '/m/Y', '/m/Y/a.mp3', 100, 0, 0),
+			('b', 'B', 'X', 'Y', '/m/Y', '/m/Y/b.mp3', 100, 0, 0),
+			('c', 'C', 'X', 'Y', '/m/Y', '/m/Y/c.mp3', 100, 0, 0)`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+
+	var played []string
+	origCommand := jukeboxCommand
+	jukeboxCommand = func(path string, offset int, gain float64) *exec.Cmd {
+		played = append(played, path)
+		if strings.HasSuffix(path, "a.mp3") {
+			return exec.Command("true") // ends at once, so the queue moves on
+		}
+		return exec.Command("sleep", "30")
+	}
+	jukebox = &jukeboxPlayer{index: -1, gain: defaultJukeboxGain}
+	t.Cleanup(func() {
+		stopJukebox()
+		jukeboxCommand = origCommand
+	})
+
+	gin.SetMode(gin.TestMode)
+	call := func(user User, rawQuery string) string {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/rest/jukeboxControl?f=json&"+rawQuery, nil)
+		c.Set("user", user)
+		subsonicJukeboxControl(c)
+		return w.Body.String()
+	}
+	user := User{ID: 1, Username: "test"}
+
+	if body := call(user, "action=status"); !strings.Contains(body, `"code":50`) {
+		t.Fatalf("jukebox should be disabled by default: %s", body)
+	}
+	if _, err := db.Exec(`INSERT INTO configuration (key, value) VALUES ('enable_jukebox', 'true')`); err != nil {
+		t.Fatal(err)
+	}
+	if body := call(User{ID: 2, Username: "guest"}, "action=status"); !strings.Contains(body, `"code":50`) {
+		t.Fatalf("users without jukebox_role should be refused: %s", body)
+	}
+	if body := call(user, "action=add&id=missing"); !strings.Contains(body, `"code":70`) {
+		t.Fatalf("unknown songs should be rejected: %s", body)
+	}
+
+	if body := call(user, "action=set&id=a&id=b"); !strings.Contains(body, `"currentIndex":0,"playing":false`) {
+		t.Fatalf("set = %s", body)
+	}
+	call(user, "action=add&id=c")
+	call(user, "action=start")
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(call(user, "action=status"), `"currentIndex":1,"playing":true`) {
+		if time.Now().After(deadline) {
+			t.Fatalf("jukebox should move on to the second track: %s", call(user, "action=status"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if body := call(user, "action=skip&index=2&offset=30"); !strings.Contains(body, `"currentIndex":2,"playing":true,"gain":0.5,"position":30`) {
+		t.Fatalf("skip = %s", body)
+	}
+	if body := call(user, "action=setGain&gain=0.8"); !strings.Contains(body, `"gain":0.8`) {
+		t.Fatalf("setGain = %s", body)
+	}
+	if body := call(user, "action=setGain&gain=2"); !strings.Contains(body, `"code":10`) {
+		t.Fatalf("gain above 1 should be rejected: %s", body)
+	}
+	if body := call(user, "action=stop"); !strings.Contains(body, `"currentIndex":2,"playing":false`) {
+		t.Fatalf("stop = %s", body)
+	}
+
+	body := call(user, "action=get")
+	if !strings.Contains(body, `"jukeboxPlaylist"`) || strings.Count(body, `"isDir":false`) != 3 {
+		t.Fatalf("get should list the queue: %s", body)
+	}
+	if got := strings.Join(played, ","); got != "/m/Y/a.mp3,/m/Y/b.mp3,/m/Y/c.mp3,/m/Y/c.mp3" {
+		t.Fatalf("played = %s", got)
+	}
+
+	if body := call(user, "action=clear"); !strings.Contains(body, `"currentIndex":-1,"playing":false`) {
+		t.Fatalf("clear = %s", body)
+	}
+}
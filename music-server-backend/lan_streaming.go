@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"strings"
+)
+
+// Clients on the local network can be exempted from transcoding: lan_cidrs
+// lists address ranges ("192.168.0.0/16, fd00::/8"; bare addresses count as a
+// single host) whose streams are always the original file, whatever the
+// user's transcoding settings, while remote clients keep being transcoded.
+// The client address is gin's ClientIP, which depends on TRUSTED_PROXIES (see
+// trusted_proxies.go): by default it is the connection's address and a
+// forged X-Forwarded-For cannot make a remote client look local. Behind a
+// reverse proxy, TRUSTED_PROXIES must list the proxy, otherwise every client
+// has the proxy's address and is on the LAN exactly when the proxy is.
+
+// parseLANCIDRs parses a lan_cidrs value. Empty means no LAN ranges.
+func parseLANCIDRs(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address or CIDR range %q", entry)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address or CIDR range %q", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// isLANClient reports whether clientIP falls in one of the lan_cidrs ranges.
+func isLANClient(clientIP string) bool {
+	value, err := GetConfig(db, "lan_cidrs")
+	if err != nil || strings.TrimSpace(value) == "" {
+		return false
+	}
+	prefixes, err := parseLANCIDRs(value)
+	if err != nil {
+		log.Printf("Ignoring lan_cidrs: %v", err)
+		return false
+	}
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap() // IPv4 clients on a dual-stack listener
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
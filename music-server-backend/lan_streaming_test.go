@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLANClientsStreamDirect(t *testing.T) {
+	d := scanTestDB(t)
+
+	if _, err := parseLANCIDRs("192.168.1.0/24, 10.0.0.7, fd00::/8"); err != nil {
+		t.Fatalf("valid list rejected: %v", err)
+	}
+	for _, bad := range []string{"192.168.1.0/33", "lan", "10.0.0.0/8,nope"} {
+		if _, err := parseLANCIDRs(bad); err == nil {
+			t.Errorf("%q should be rejected", bad)
+		}
+	}
+
+	if isLANClient("192.168.1.20") {
+		t.Fatal("without lan_cidrs no client is on the LAN")
+	}
+	d.Exec(`INSERT INTO configuration (key, value) VALUES ('lan_cidrs', '192.168.1.0/24, 10.0.0.7')`)
+	for ip, want := range map[string]bool{
+		"192.168.1.20":        true,
+		"::ffff:192.168.1.20": true,
+		"10.0.0.7":            true,
+		"10.0.0.8":            false,
+		"203.0.113.9":         false,
+		"":                    false,
+	} {
+		if got := isLANClient(ip); got != want {
+			t.Errorf("isLANClient(%q) = %v, want %v", ip, got, want)
+		}
+	}
+
+	// Transcoding is on for everyone, but a LAN client still gets the file.
+	d.Exec(`INSERT INTO configuration (key, value) VALUES ('default_transcode_enabled', 'true')`)
+	path := filepath.Join(t.TempDir(), "track.flac")
+	if err := os.WriteFile(path, []byte("lossless"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/rest/stream.view", nil)
+	c.Request.RemoteAddr = "192.168.1.20:51234"
+	streamSongForUser(c, User{ID: 1, Username: "test"}, path, 0, 0)
+	if w.Body.String() != "lossless" || w.Header().Get("X-Stream-Decision") != "direct" || w.Header().Get("X-Stream-Reason") != "LAN client" {
+		t.Fatalf("LAN stream: %q, headers %v", w.Body.String(), w.Header())
+	}
+
+	// A remote client claiming a LAN address in X-Forwarded-For is only
+	// believed when the request comes through a trusted proxy.
+	forwardedReason := func() string {
+		r := gin.New()
+		if err := configureTrustedProxies(r); err != nil {
+			t.Fatal(err)
+		}
+		r.GET("/rest/stream.view", func(c *gin.Context) { streamSongForUser(c, User{ID: 1, Username: "test"}, path, 0, 0) })
+		req := httptest.NewRequest(http.MethodGet, "/rest/stream.view", nil)
+		req.RemoteAddr = "203.0.113.9:40000"
+		req.Header.Set("X-Forwarded-For", "192.168.1.20")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Header().Get("X-Stream-Reason")
+	}
+	t.Setenv("TRUSTED_PROXIES", "")
+	if reason := forwardedReason(); reason == "LAN client" {
+		t.Error("a forged X-Forwarded-For made a remote client a LAN client")
+	}
+	t.Setenv("TRUSTED_PROXIES", "203.0.113.9")
+	if reason := forwardedReason(); reason != "LAN client" {
+		t.Errorf("behind a trusted proxy the forwarded LAN address was ignored (reason %q)", reason)
+	}
+}
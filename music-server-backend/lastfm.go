@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Last.fm scrobbling passthrough. Each user links their own Last.fm account
+// once (Last.fm's desktop auth flow: get a token, approve it on last.fm,
+// exchange it for a session key) or pastes a session key directly. Plays
+// submitted through subsonicScrobble are then forwarded to track.scrobble in
+// the background; a failing or slow Last.fm never affects the local play
+// count or history. The server-wide lastfm_api_key / lastfm_api_secret pair
+// identifies this server to Last.fm.
+
+const lastFmAuthURL = "https://www.last.fm/api/auth/"
+
+// LastFmSettings is the GET /api/v1/user/settings/lastfm response.
+type LastFmSettings struct {
+	Available  bool   `json:"available"` // the server has an API key and secret
+	Linked     bool   `json:"linked"`
+	LastFmUser string `json:"lastFmUser,omitempty"`
+	Enabled    bool   `json:"enabled"`
+}
+
+// lastFmCredentials returns the server's API key and secret; ok is false
+// unless both are set.
+func lastFmCredentials() (apiKey, secret string, ok bool) {
+	apiKey, _ = GetConfig(db, "lastfm_api_key")
+	secret, _ = GetConfig(db, "lastfm_api_secret")
+	return apiKey, secret, apiKey != "" && secret != ""
+}
+
+// lastFmSignature computes api_sig: the md5 of every parameter except format
+// and callback, sorted by name and concatenated as name+value, followed by
+// the shared secret.
+func lastFmSignature(params url.Values, secret string) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		if name != "format" && name != "callback" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteString(params.Get(name))
+	}
+	b.WriteString(secret)
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// lastFmCall signs params and POSTs them to the Last.fm API, decoding the JSON
+// reply into v (which may be nil). Last.fm reports failures in the body.
+func lastFmCall(ctx context.Context, apiKey, secret string, params url.Values, v interface{}) error {
+	params.Set("api_key", apiKey)
+	params.Set("api_sig", lastFmSignature(params, secret))
+	params.Set("format", "json")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, lastFmBaseURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "AudioMuse-AI-MusicServer/"+subsonicServerVersion)
+	resp, err := metadataHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("last.fm returned %s", resp.Status)
+	}
+	var apiErr struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != 0 {
+		return fmt.Errorf("last.fm error %d: %s", apiErr.Error, apiErr.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("last.fm returned %s", resp.Status)
+	}
+	if v != nil {
+		return json.Unmarshal(body, v)
+	}
+	return nil
+}
+
+// scrobbleToLastFm submits one play of songID to the user's Last.fm account.
+// It does nothing unless the server is configured and the user has linked an
+// account and left scrobbling enabled. Errors are logged, never returned:
+// callers run it in the background after the local scrobble.
+func scrobbleToLastFm(userID int, songID string, playedAt time.Time) {
+	apiKey, secret, ok := lastFmCredentials()
+	if !ok {
+		return
+	}
+	var sessionKey string
+	err := db.QueryRow(`SELECT session_key FROM lastfm_sessions WHERE user_id = ? AND enabled = 1`, userID).Scan(&sessionKey)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Last.fm scrobble: failed to load session for user %d: %v", userID, err)
+		}
+		return
+	}
+
+	var title, artist, album, albumArtist string
+	var duration, track int
+	err = db.QueryRow(`SELECT title, artist, album, COALESCE(album_artist, ''), duration, track FROM songs WHERE id = ?`, songID).
+		Scan(&title, &artist, &album, &albumArtist, &duration, &track)
+	if err != nil {
+		log.Printf("Last.fm scrobble: song %s not found: %v", songID, err)
+		return
+	}
+	if isUnknownString(artist) || title == "" {
+		return // Last.fm rejects scrobbles without artist and title
+	}
+
+	params := url.Values{
+		"method":    {"track.scrobble"},
+		"sk":        {sessionKey},
+		"artist":    {artist},
+		"track":     {title},
+		"timestamp": {strconv.FormatInt(playedAt.Unix(), 10)},
+	}
+	if album != "" && !isUnknownString(album) {
+		params.Set("album", album)
+	}
+	if albumArtist != "" && albumArtist != artist && !isUnknownString(albumArtist) {
+		params.Set("albumArtist", albumArtist)
+	}
+	if duration > 0 {
+		params.Set("duration", strconv.Itoa(duration))
+	}
+	if track > 0 {
+		params.Set("trackNumber", strconv.Itoa(track))
+	}
+	if err := lastFmCall(context.Background(), apiKey, secret, params, nil); err != nil {
+		log.Printf("Last.fm scrobble of song %s for user %d failed: %v", songID, userID, err)
+	}
+}
+
+// getUserLastFmSettings handles GET /api/v1/user/settings/lastfm.
+func getUserLastFmSettings(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var settings LastFmSettings
+	_, _, settings.Available = lastFmCredentials()
+
+	var enabled int
+	err := db.QueryRow(`SELECT lastfm_user, enabled FROM lastfm_sessions WHERE user_id = ?`, userID).Scan(&settings.LastFmUser, &enabled)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve settings"})
+		return
+	}
+	settings.Linked = err == nil
+	settings.Enabled = enabled == 1
+	c.JSON(http.StatusOK, settings)
+}
+
+// updateUserLastFmSettings handles POST /api/v1/user/settings/lastfm, which
+// turns scrobbling to the linked account on or off.
+func updateUserLastFmSettings(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	res, err := db.Exec(`UPDATE lastfm_sessions SET enabled = ? WHERE user_id = ?`, req.Enabled, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No Last.fm account is linked"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Settings updated successfully"})
+}
+
+// startLastFmAuth handles POST /api/v1/user/settings/lastfm/token. It returns
+// a request token and the last.fm page where the user approves it.
+func startLastFmAuth(c *gin.Context) {
+	apiKey, secret, ok := lastFmCredentials()
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Last.fm is not configured on this server"})
+		return
+	}
+	var result struct {
+		Token string `json:"token"`
+	}
+	if err := lastFmCall(c.Request.Context(), apiKey, secret, url.Values{"method": {"auth.getToken"}}, &result); err != nil {
+		log.Printf("Last.fm auth.getToken failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to contact Last.fm"})
+		return
+	}
+	authURL := lastFmAuthURL + "?" + url.Values{"api_key": {apiKey}, "token": {result.Token}}.Encode()
+	c.JSON(http.StatusOK, gin.H{"token": result.Token, "authUrl": authURL})
+}
+
+// linkLastFmSession handles POST /api/v1/user/settings/lastfm/session. The
+// body holds either the approved token from startLastFmAuth or an existing
+// sessionKey (plus optional lastFmUser); the session is stored and enabled.
+func linkLastFmSession(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var req struct {
+		Token      string `json:"token"`
+		SessionKey string `json:"sessionKey"`
+		LastFmUser string `json:"lastFmUser"`
+	}
+	if err := c.BindJSON(&req); err != nil || (req.Token == "" && req.SessionKey == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token or sessionKey is required"})
+		return
+	}
+
+	if req.Token != "" {
+		apiKey, secret, ok := lastFmCredentials()
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Last.fm is not configured on this server"})
+			return
+		}
+		var result struct {
+			Session struct {
+				Name string `json:"name"`
+				Key  string `json:"key"`
+			} `json:"session"`
+		}
+		err := lastFmCall(c.Request.Context(), apiKey, secret, url.Values{"method": {"auth.getSession"}, "token": {req.Token}}, &result)
+		if err == nil && result.Session.Key == "" {
+			err = errors.New("no session key in reply")
+		}
+		if err != nil {
+			log.Printf("Last.fm auth.getSession failed for user %d: %v", userID, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Last.fm did not grant a session; approve the request on last.fm and try again"})
+			return
+		}
+		req.SessionKey, req.LastFmUser = result.Session.Key, result.Session.Name
+	}
+
+	_, err := db.Exec(`INSERT INTO lastfm_sessions (user_id, session_key, lastfm_user, enabled, linked_at) VALUES (?, ?, ?, 1, ?)
+		ON CONFLICT(user_id) DO UPDATE SET session_key = excluded.session_key, lastfm_user = excluded.lastfm_user, enabled = 1, linked_at = excluded.linked_at`,
+		userID, req.SessionKey, req.LastFmUser, time.Now().Format(time.RFC3339))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save Last.fm session"})
+		return
+	}
+	c.JSON(http.StatusOK, LastFmSettings{Available: true, Linked: true, LastFmUser: req.LastFmUser, Enabled: true})
+}
+
+// unlinkLastFm handles DELETE /api/v1/user/settings/lastfm.
+func unlinkLastFm(c *gin.Context) {
+	if _, err := db.Exec(`DELETE FROM lastfm_sessions WHERE user_id = ?`, c.GetInt("userID")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink Last.fm"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Last.fm account unlinked"})
+}
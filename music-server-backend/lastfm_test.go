@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestLastFmSignature(t *testing.T) {
+	// Parameters sorted by name, format excluded, secret appended:
+	// md5("api_keyxxxmethodauth.getSessiontokenyyys").
+	params := url.Values{"api_key": {"xxx"}, "method": {"auth.getSession"}, "token": {"yyy"}, "format": {"json"}}
+	if got, want := lastFmSignature(params, "s"), "840bb2137e5b2e0812051089f3d6161a"; got != want {
+		t.Errorf("signature = %s, want %s", got, want)
+	}
+}
+
+func TestScrobbleToLastFm(t *testing.T) {
+	d := scanTestDB(t)
+	for _, stmt := range []string{
+		`CREATE TABLE lastfm_sessions (user_id INTEGER PRIMARY KEY NOT NULL, session_key TEXT NOT NULL, lastfm_user TEXT NOT NULL DEFAULT '', enabled INTEGER NOT NULL DEFAULT 1, linked_at TEXT NOT NULL)`,
+		`INSERT INTO configuration (key, value) VALUES ('lastfm_api_key', 'key'), ('lastfm_api_secret', 'secret')`,
+		`INSERT INTO lastfm_sessions (user_id, session_key, lastfm_user, enabled, linked_at) VALUES (1, 'sk1', 'me', 1, ''), (2, 'sk2', 'other', 0, '')`,
+		`INSERT INTO songs (id, title, artist, album, album_artist, path, duration, track) VALUES ('s1', 'One', 'Band', 'Record', 'Band', '/m/01.mp3', 200, 1)`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		got = append(got, r.PostForm)
+		w.Write([]byte(`{"scrobbles":{"@attr":{"accepted":1,"ignored":0}}}`))
+	}))
+	defer srv.Close()
+	old := lastFmBaseURL
+	lastFmBaseURL = srv.URL
+	defer func() { lastFmBaseURL = old }()
+
+	playedAt := time.Unix(1700000000, 0)
+	scrobbleToLastFm(1, "s1", playedAt)
+	scrobbleToLastFm(2, "s1", playedAt) // scrobbling turned off
+	scrobbleToLastFm(3, "s1", playedAt) // no linked account
+
+	if len(got) != 1 {
+		t.Fatalf("made %d Last.fm requests, want 1", len(got))
+	}
+	form := got[0]
+	for k, v := range map[string]string{
+		"method": "track.scrobble", "sk": "sk1", "api_key": "key", "artist": "Band", "track": "One",
+		"album": "Record", "timestamp": "1700000000", "duration": "200", "trackNumber": "1", "format": "json",
+	} {
+		if form.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, form.Get(k), v)
+		}
+	}
+	if form.Get("albumArtist") != "" {
+		t.Errorf("albumArtist sent although it equals the artist")
+	}
+	signed := url.Values{}
+	for k, v := range form {
+		if k != "api_sig" {
+			signed[k] = v
+		}
+	}
+	if form.Get("api_sig") != lastFmSignature(signed, "secret") {
+		t.Errorf("api_sig does not match the request parameters")
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Catalog export. GET /api/v1/admin/export?format=json|csv streams every song
+// in the library with its metadata, play statistics and the users who starred
+// it, so a catalog can be snapshotted and diffed without touching the SQLite
+// file. Rows are written as they are read, so memory use does not grow with
+// the library. Paths are relative to the song's library folder unless
+// absolutePaths=true is passed.
+
+// catalogSong is one song of a catalog export.
+type catalogSong struct {
+	ID                  string   `json:"id"`
+	ExternalID          string   `json:"externalId,omitempty"`
+	Path                string   `json:"path"`
+	Title               string   `json:"title"`
+	Artist              string   `json:"artist"`
+	AlbumArtist         string   `json:"albumArtist,omitempty"`
+	Album               string   `json:"album"`
+	Genre               string   `json:"genre,omitempty"`
+	Year                int      `json:"year,omitempty"`
+	Track               int      `json:"track,omitempty"`
+	DiscNumber          int      `json:"discNumber,omitempty"`
+	Duration            int      `json:"duration"`
+	Size                int64    `json:"size,omitempty"`
+	BitRate             int      `json:"bitRate,omitempty"`
+	SampleRate          int      `json:"sampleRate,omitempty"`
+	Channels            int      `json:"channels,omitempty"`
+	BitDepth            int      `json:"bitDepth,omitempty"`
+	Comment             string   `json:"comment,omitempty"`
+	ReplayGainTrackGain *float64 `json:"replayGainTrackGain,omitempty"`
+	ReplayGainTrackPeak *float64 `json:"replayGainTrackPeak,omitempty"`
+	ReplayGainAlbumGain *float64 `json:"replayGainAlbumGain,omitempty"`
+	ReplayGainAlbumPeak *float64 `json:"replayGainAlbumPeak,omitempty"`
+	PlayCount           int      `json:"playCount"`
+	LastPlayed          string   `json:"lastPlayed,omitempty"`
+	DateAdded           string   `json:"dateAdded,omitempty"`
+	DateUpdated         string   `json:"dateUpdated,omitempty"`
+	StarredBy           []string `json:"starredBy,omitempty"`
+}
+
+// catalogCSVHeader names the CSV columns, in catalogSong.csvRecord order.
+var catalogCSVHeader = []string{
+	"id", "externalId", "path", "title", "artist", "albumArtist", "album", "genre", "year", "track", "discNumber",
+	"duration", "size", "bitRate", "sampleRate", "channels", "bitDepth", "comment",
+	"replayGainTrackGain", "replayGainTrackPeak", "replayGainAlbumGain", "replayGainAlbumPeak",
+	"playCount", "lastPlayed", "dateAdded", "dateUpdated", "starredBy",
+}
+
+// catalogFlushEvery is how many rows are written between flushes.
+const catalogFlushEvery = 500
+
+func (s *catalogSong) csvRecord() []string {
+	float := func(f *float64) string {
+		if f == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*f, 'f', -1, 64)
+	}
+	return []string{
+		s.ID, s.ExternalID, s.Path, s.Title, s.Artist, s.AlbumArtist, s.Album, s.Genre,
+		strconv.Itoa(s.Year), strconv.Itoa(s.Track), strconv.Itoa(s.DiscNumber), strconv.Itoa(s.Duration),
+		strconv.FormatInt(s.Size, 10), strconv.Itoa(s.BitRate), strconv.Itoa(s.SampleRate), strconv.Itoa(s.Channels),
+		strconv.Itoa(s.BitDepth), s.Comment,
+		float(s.ReplayGainTrackGain), float(s.ReplayGainTrackPeak), float(s.ReplayGainAlbumGain), float(s.ReplayGainAlbumPeak),
+		strconv.Itoa(s.PlayCount), s.LastPlayed, s.DateAdded, s.DateUpdated, strings.Join(s.StarredBy, ";"),
+	}
+}
+
+// libraryRoots returns the library folders, longest first so nested folders
+// match before their parents.
+func libraryRoots(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`SELECT path FROM library_paths`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var roots []string
+	for rows.Next() {
+		var root string
+		if err := rows.Scan(&root); err == nil {
+			roots = append(roots, filepath.Clean(root))
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool { return len(roots[i]) > len(roots[j]) })
+	return roots, rows.Err()
+}
+
+// libraryRelativePath returns path relative to the library folder holding it,
+// or just the file name when it is in none of them.
+func libraryRelativePath(path string, roots []string) string {
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Base(path)
+}
+
+// exportLibraryCatalog handles GET /api/v1/admin/export.
+func exportLibraryCatalog(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+	absolute := c.Query("absolutePaths") == "true"
+	roots, err := libraryRoots(db)
+	if err != nil {
+		log.Printf("exportLibraryCatalog: reading library paths: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	rows, err := db.Query(`SELECT s.id, COALESCE(s.external_id, ''), s.path, COALESCE(s.title, ''), COALESCE(s.artist, ''),
+		COALESCE(s.album_artist, ''), COALESCE(s.album, ''), COALESCE(s.genre, ''), COALESCE(s.year, 0), COALESCE(s.track, 0),
+		COALESCE(s.disc_number, 0), COALESCE(s.duration, 0), COALESCE(s.size, 0), COALESCE(s.bitrate, 0),
+		COALESCE(s.sample_rate, 0), COALESCE(s.channels, 0), COALESCE(s.bit_depth, 0), COALESCE(s.comment, ''),
+		s.replaygain_track_gain, s.replaygain_track_peak, s.replaygain_album_gain, s.replaygain_album_peak,
+		COALESCE(s.play_count, 0), COALESCE(s.last_played, ''), COALESCE(s.date_added, ''), COALESCE(s.date_updated, ''),
+		COALESCE((SELECT GROUP_CONCAT(u.username, char(31)) FROM starred_songs ss JOIN users u ON u.id = ss.user_id WHERE ss.song_id = s.id), '')
+		FROM songs s WHERE s.cancelled = 0 ORDER BY s.path`)
+	if err != nil {
+		log.Printf("exportLibraryCatalog: query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	// A large library takes longer than the server's WriteTimeout to send.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	stamp := time.Now().UTC()
+	c.Header("Content-Disposition", attachmentDisposition("library-"+stamp.Format("20060102-150405")+"."+format))
+	var (
+		csvOut *csv.Writer
+		count  int
+	)
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		csvOut = csv.NewWriter(c.Writer)
+		csvOut.Write(catalogCSVHeader)
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Status(http.StatusOK)
+		head, _ := json.Marshal(stamp.Format(time.RFC3339))
+		c.Writer.WriteString(`{"exportedAt":` + string(head) + `,"absolutePaths":` + strconv.FormatBool(absolute) + `,"songs":[`)
+	}
+
+	for rows.Next() {
+		var s catalogSong
+		var starredBy string
+		if err := rows.Scan(&s.ID, &s.ExternalID, &s.Path, &s.Title, &s.Artist, &s.AlbumArtist, &s.Album, &s.Genre, &s.Year,
+			&s.Track, &s.DiscNumber, &s.Duration, &s.Size, &s.BitRate, &s.SampleRate, &s.Channels, &s.BitDepth, &s.Comment,
+			&s.ReplayGainTrackGain, &s.ReplayGainTrackPeak, &s.ReplayGainAlbumGain, &s.ReplayGainAlbumPeak,
+			&s.PlayCount, &s.LastPlayed, &s.DateAdded, &s.DateUpdated, &starredBy); err != nil {
+			log.Printf("exportLibraryCatalog: scanning row: %v", err)
+			continue
+		}
+		if !absolute {
+			s.Path = libraryRelativePath(s.Path, roots)
+		}
+		if starredBy != "" {
+			s.StarredBy = strings.Split(starredBy, "\x1f")
+			sort.Strings(s.StarredBy)
+		}
+
+		if csvOut != nil {
+			csvOut.Write(s.csvRecord())
+		} else {
+			line, _ := json.Marshal(s)
+			if count > 0 {
+				c.Writer.WriteString(",")
+			}
+			c.Writer.WriteString("\n")
+			c.Writer.Write(line)
+		}
+		count++
+		if count%catalogFlushEvery == 0 {
+			if csvOut != nil {
+				csvOut.Flush()
+			}
+			c.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		// The status is already sent; the truncated document shows the failure.
+		log.Printf("exportLibraryCatalog: reading songs: %v", err)
+		return
+	}
+
+	if csvOut != nil {
+		csvOut.Flush()
+	} else {
+		c.Writer.WriteString("\n]}\n")
+	}
+	log.Printf("Exported %d songs as %s", count, format)
+}
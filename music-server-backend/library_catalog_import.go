@@ -0,0 +1,281 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Catalog import, the counterpart of exportLibraryCatalog. POST
+// /api/v1/admin/import takes a JSON catalog, either an export document
+// ({"songs": [...]}) or a bare array of songs, and applies its curation to the
+// songs already in the library: genre and year when present, stars, for the
+// users named in starredBy and, with "starred": true, for the admin importing,
+// and a rating (1-5, 0 clears it) for the admin importing. A catalog song
+// matches by externalId, then by path, which may be absolute or relative to a
+// library folder as exports write it. Songs are never created; a file only
+// joins the library by being scanned. The document is decoded song by song;
+// catalogs larger than MAX_REQUEST_BODY_MB need that limit raised.
+//
+// Imported genres and years are kept in song_tag_overrides as well as on the
+// song, and a rescan writes them (scannedGenreSQL, scannedYearSQL) in place of
+// the file's tags, so curation survives the next scan.
+
+// scannedGenreSQL and scannedYearSQL are the values the scanner's upserts
+// store for an existing song: its override when it has one, else the tag.
+const (
+	scannedGenreSQL = `COALESCE((SELECT genre FROM song_tag_overrides WHERE song_id = songs.id), excluded.genre)`
+	scannedYearSQL  = `COALESCE((SELECT year FROM song_tag_overrides WHERE song_id = songs.id), excluded.year)`
+)
+
+// ensureSongTagOverridesTable creates song_tag_overrides. A NULL column has no
+// override.
+func ensureSongTagOverridesTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS song_tag_overrides (
+		song_id TEXT PRIMARY KEY NOT NULL,
+		genre TEXT,
+		year INTEGER,
+		FOREIGN KEY(song_id) REFERENCES songs(id) ON DELETE CASCADE
+	)`)
+	return err
+}
+
+// catalogImportSong is one song of an imported catalog. Absent fields are
+// left alone.
+type catalogImportSong struct {
+	ExternalID string   `json:"externalId"`
+	Path       string   `json:"path"`
+	Genre      *string  `json:"genre"`
+	Year       *int     `json:"year"`
+	Starred    bool     `json:"starred"`
+	StarredBy  []string `json:"starredBy"`
+	Rating     *int     `json:"rating"`
+}
+
+// catalogImportReport is the import response.
+type catalogImportReport struct {
+	Matched        int      `json:"matched"`
+	Unmatched      int      `json:"unmatched"`
+	Starred        int      `json:"starred"`
+	Rated          int      `json:"rated"`
+	UnmatchedPaths []string `json:"unmatchedPaths"`
+	UnknownUsers   []string `json:"unknownUsers"`
+}
+
+// catalogImportMaxUnmatched caps the unmatched paths listed in the report.
+const catalogImportMaxUnmatched = 100
+
+// decodeCatalogSongs calls fn for every song of the catalog read from r.
+func decodeCatalogSongs(r io.Reader, fn func(catalogImportSong) error) error {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == json.Delim('{') {
+		for {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if key == json.Delim('}') {
+				return errors.New(`the catalog has no "songs" array`)
+			}
+			if key == "songs" {
+				if tok, err = dec.Token(); err != nil {
+					return err
+				}
+				break
+			}
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+		}
+	}
+	if tok != json.Delim('[') {
+		return errors.New("the catalog must be an export document or an array of songs")
+	}
+	for dec.More() {
+		var s catalogImportSong
+		if err := dec.Decode(&s); err != nil {
+			return err
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// matchCatalogSong returns the id of the library song s describes, or "".
+func matchCatalogSong(tx *sql.Tx, s catalogImportSong, roots []string) (string, error) {
+	lookup := func(column, value string) (string, error) {
+		var id string
+		err := tx.QueryRow("SELECT id FROM songs WHERE cancelled = 0 AND "+column+" = ?", value).Scan(&id)
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return id, err
+	}
+	if s.ExternalID != "" {
+		if id, err := lookup("external_id", s.ExternalID); id != "" || err != nil {
+			return id, err
+		}
+	}
+	if s.Path == "" {
+		return "", nil
+	}
+	if filepath.IsAbs(s.Path) {
+		return lookup("path", filepath.Clean(s.Path))
+	}
+	for _, root := range roots {
+		if id, err := lookup("path", filepath.Join(root, filepath.FromSlash(s.Path))); id != "" || err != nil {
+			return id, err
+		}
+	}
+	return "", nil
+}
+
+// importLibraryCatalog handles POST /api/v1/admin/import.
+func importLibraryCatalog(c *gin.Context) {
+	roots, err := libraryRoots(db)
+	if err != nil {
+		log.Printf("importLibraryCatalog: reading library paths: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	userIDs := map[string]int{}
+	rows, err := db.Query(`SELECT id, username FROM users`)
+	if err != nil {
+		log.Printf("importLibraryCatalog: reading users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	for rows.Next() {
+		var id int
+		var name string
+		if rows.Scan(&id, &name) == nil {
+			userIDs[name] = id
+		}
+	}
+	rows.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	report := catalogImportReport{UnmatchedPaths: []string{}, UnknownUsers: []string{}}
+	unknown := map[string]bool{}
+	importer := c.GetInt("userID")
+	now := time.Now().Format(time.RFC3339)
+	var dbErr error
+	err = decodeCatalogSongs(c.Request.Body, func(s catalogImportSong) error {
+		id, err := matchCatalogSong(tx, s, roots)
+		if err != nil {
+			dbErr = err
+			return err
+		}
+		if id == "" {
+			report.Unmatched++
+			if len(report.UnmatchedPaths) < catalogImportMaxUnmatched {
+				report.UnmatchedPaths = append(report.UnmatchedPaths, s.Path)
+			}
+			return nil
+		}
+		report.Matched++
+
+		if s.Genre != nil {
+			genre := strings.TrimSpace(*s.Genre)
+			if _, err := tx.Exec(`UPDATE songs SET genre = ? WHERE id = ?`, genre, id); err != nil {
+				dbErr = err
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO song_tag_overrides (song_id, genre) VALUES (?, ?)
+				ON CONFLICT(song_id) DO UPDATE SET genre = excluded.genre`, id, genre); err != nil {
+				dbErr = err
+				return err
+			}
+		}
+		if s.Year != nil && *s.Year >= 0 {
+			if _, err := tx.Exec(`UPDATE songs SET year = ? WHERE id = ?`, *s.Year, id); err != nil {
+				dbErr = err
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO song_tag_overrides (song_id, year) VALUES (?, ?)
+				ON CONFLICT(song_id) DO UPDATE SET year = excluded.year`, id, *s.Year); err != nil {
+				dbErr = err
+				return err
+			}
+		}
+
+		if s.Rating != nil && *s.Rating >= 0 && *s.Rating <= 5 && importer != 0 {
+			if err := setSongRating(tx, importer, id, *s.Rating); err != nil {
+				dbErr = err
+				return err
+			}
+			report.Rated++
+		}
+
+		starrers := map[int]bool{}
+		if s.Starred && importer != 0 {
+			starrers[importer] = true
+		}
+		for _, name := range s.StarredBy {
+			if uid, ok := userIDs[name]; ok {
+				starrers[uid] = true
+			} else if !unknown[name] {
+				unknown[name] = true
+				report.UnknownUsers = append(report.UnknownUsers, name)
+			}
+		}
+		for uid := range starrers {
+			res, err := tx.Exec(`INSERT OR IGNORE INTO starred_songs (user_id, song_id, starred_at) VALUES (?, ?, ?)`, uid, id, now)
+			if err != nil {
+				dbErr = err
+				return err
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				report.Starred++
+			}
+		}
+		return nil
+	})
+	if dbErr != nil {
+		log.Printf("importLibraryCatalog: %v", dbErr)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid catalog: " + err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit"})
+		return
+	}
+
+	// Album genres and the genre lists are derived from the songs.
+	if report.Matched > 0 {
+		if err := RebuildLibraryIndex(db); err != nil {
+			log.Printf("RebuildLibraryIndex after catalog import failed: %v", err)
+		}
+		invalidateBrowseCache()
+	}
+	sort.Strings(report.UnknownUsers)
+	log.Printf("Catalog import: %d songs matched, %d unmatched, %d stars added, %d ratings set", report.Matched, report.Unmatched, report.Starred, report.Rated)
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func catalogTestDB(t *testing.T) {
+	t.Helper()
+	d := scanTestDB(t)
+	for _, stmt := range []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT UNIQUE NOT NULL)`,
+		`INSERT INTO users (id, username) VALUES (1, 'alice'), (2, 'bob')`,
+		`INSERT INTO library_paths (id, path) VALUES (1, '/music'), (2, '/music/classical')`,
+		`INSERT INTO songs (id, title, artist, album, path, genre, year, play_count, replaygain_track_gain) VALUES
+			('a', 'One, "quoted"', 'Band', 'Debut', '/music/Band/Debut/01.flac', 'Rock', 1999, 4, -6.5),
+			('b', 'Aria', 'Bach', 'Goldberg', '/music/classical/Bach/01.flac', '', 0, 0, NULL),
+			('c', 'Gone', 'Band', 'Debut', '/music/Band/Debut/02.flac', '', 0, 0, NULL)`,
+		`UPDATE songs SET cancelled = 1 WHERE id = 'c'`,
+		`INSERT INTO starred_songs (user_id, song_id, starred_at) VALUES (2, 'a', 'x'), (1, 'a', 'x')`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func getCatalog(t *testing.T, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/export", exportLibraryCatalog)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export"+query, nil))
+	return w
+}
+
+func TestExportLibraryCatalogJSON(t *testing.T) {
+	catalogTestDB(t)
+
+	w := getCatalog(t, "")
+	var doc struct {
+		AbsolutePaths bool          `json:"absolutePaths"`
+		Songs         []catalogSong `json:"songs"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("export is not valid JSON: %v\n%s", err, w.Body.String())
+	}
+	if len(doc.Songs) != 2 || doc.AbsolutePaths {
+		t.Fatalf("exported %d songs (absolutePaths %v), want the 2 live songs with relative paths", len(doc.Songs), doc.AbsolutePaths)
+	}
+	a, b := doc.Songs[0], doc.Songs[1]
+	if a.ID != "a" || a.Path != "Band/Debut/01.flac" || a.Year != 1999 || a.PlayCount != 4 ||
+		a.ReplayGainTrackGain == nil || *a.ReplayGainTrackGain != -6.5 || strings.Join(a.StarredBy, ",") != "alice,bob" {
+		t.Errorf("song a = %+v", a)
+	}
+	if b.Path != "Bach/01.flac" || b.ReplayGainTrackGain != nil || b.StarredBy != nil {
+		t.Errorf("song b = %+v; want the path relative to the nested library", b)
+	}
+
+	w = getCatalog(t, "?absolutePaths=true")
+	json.Unmarshal(w.Body.Bytes(), &doc)
+	if len(doc.Songs) == 0 || doc.Songs[0].Path != "/music/Band/Debut/01.flac" {
+		t.Errorf("absolutePaths=true exported %+v", doc.Songs)
+	}
+}
+
+func TestExportLibraryCatalogCSV(t *testing.T) {
+	catalogTestDB(t)
+
+	w := getCatalog(t, "?format=csv")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || len(records[1]) != len(catalogCSVHeader) {
+		t.Fatalf("got %d records, want a header and 2 songs: %v", len(records), records)
+	}
+	if records[1][3] != `One, "quoted"` || records[1][len(catalogCSVHeader)-1] != "alice;bob" {
+		t.Errorf("first song record = %v", records[1])
+	}
+
+	if w := getCatalog(t, "?format=xml"); w.Code != http.StatusBadRequest {
+		t.Errorf("format=xml: %d, want 400", w.Code)
+	}
+}
+
+func TestImportLibraryCatalog(t *testing.T) {
+	catalogTestDB(t)
+	db.Exec(`UPDATE songs SET external_id = 'ext-b' WHERE id = 'b'`)
+	db.Exec(`DELETE FROM starred_songs`)
+	if err := ensureSongRatingsTable(db); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/import", func(c *gin.Context) { c.Set("userID", 1); importLibraryCatalog(c) })
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/import", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"exportedAt": "2026-01-01T00:00:00Z", "songs": [
+		{"path": "Band/Debut/01.flac", "genre": "Post-Rock", "starredBy": ["bob", "carol"]},
+		{"externalId": "ext-b", "path": "elsewhere/aria.flac", "year": 1741, "starred": true, "rating": 4},
+		{"path": "/music/Band/Debut/02.flac", "genre": "Cancelled"},
+		{"path": "/nowhere/new.flac", "genre": "New"}
+	]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("import: %d %s", w.Code, w.Body.String())
+	}
+	var report catalogImportReport
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if report.Matched != 2 || report.Unmatched != 2 || report.Starred != 2 || report.Rated != 1 ||
+		strings.Join(report.UnknownUsers, ",") != "carol" || len(report.UnmatchedPaths) != 2 {
+		t.Errorf("report = %+v", report)
+	}
+
+	var genre string
+	var year int
+	db.QueryRow(`SELECT genre, year FROM songs WHERE id = 'a'`).Scan(&genre, &year)
+	if genre != "Post-Rock" || year != 1999 {
+		t.Errorf("song a: genre %q year %d; want the imported genre and the year left alone", genre, year)
+	}
+	db.QueryRow(`SELECT year FROM songs WHERE id = 'b'`).Scan(&year)
+	db.QueryRow(`SELECT genre FROM songs WHERE id = 'c'`).Scan(&genre)
+	if year != 1741 || genre != "" {
+		t.Errorf("song b year %d, cancelled song c genre %q", year, genre)
+	}
+	var stars []string
+	rows, _ := db.Query(`SELECT user_id || ':' || song_id FROM starred_songs ORDER BY 1`)
+	for rows.Next() {
+		var s string
+		rows.Scan(&s)
+		stars = append(stars, s)
+	}
+	rows.Close()
+	if strings.Join(stars, " ") != "1:b 2:a" {
+		t.Errorf("stars = %v, want [1:b 2:a]", stars)
+	}
+	var rating int
+	db.QueryRow(`SELECT rating FROM song_ratings WHERE user_id = 1 AND song_id = 'b'`).Scan(&rating)
+	if rating != 4 {
+		t.Errorf("song b rating = %d, want the importer's 4", rating)
+	}
+	var songs int
+	db.QueryRow(`SELECT COUNT(*) FROM songs`).Scan(&songs)
+	if songs != 3 {
+		t.Errorf("import created songs: %d in the library, want 3", songs)
+	}
+
+	// A bare array is a catalog too; anything else is refused.
+	if w := post(`[{"path": "Bach/01.flac", "starred": true}]`); w.Code != http.StatusOK {
+		t.Errorf("bare array: %d %s", w.Code, w.Body.String())
+	}
+	for _, body := range []string{`{"tracks": []}`, `"songs"`, `{"songs": [{"path": 3}]}`} {
+		if w := post(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestCatalogOverridesSurviveRescan(t *testing.T) {
+	scanTestDB(t)
+	for _, stmt := range []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT UNIQUE NOT NULL)`,
+		`CREATE TABLE song_ratings (user_id INTEGER, song_id TEXT, rating INTEGER)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "01 - Song.mp3")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := upsertSongFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	body, _ := json.Marshal([]map[string]any{{"path": path, "genre": "Shoegaze", "year": 1991}})
+	c.Request = httptest.NewRequest(http.MethodPost, "/import", strings.NewReader(string(body)))
+	importLibraryCatalog(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("import: %d %s", w.Code, w.Body.String())
+	}
+
+	if _, err := upsertSongFile(path); err != nil {
+		t.Fatal(err)
+	}
+	var genre string
+	var year int
+	db.QueryRow(`SELECT genre, year FROM songs WHERE path = ?`, path).Scan(&genre, &year)
+	if genre != "Shoegaze" || year != 1991 {
+		t.Errorf("after a rescan genre %q year %d, want the imported Shoegaze 1991", genre, year)
+	}
+}
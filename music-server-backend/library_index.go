@@ -27,7 +27,8 @@ CREATE TABLE IF NOT EXISTS artists (
 	name TEXT NOT NULL,
 	song_count INTEGER NOT NULL DEFAULT 0,
 	album_count INTEGER NOT NULL DEFAULT 0,
-	search_text TEXT NOT NULL DEFAULT ''
+	search_text TEXT NOT NULL DEFAULT '',
+	sort_name TEXT NOT NULL DEFAULT ''
 );
 CREATE INDEX IF NOT EXISTS idx_artists_name ON artists (name COLLATE NOCASE);
 
@@ -47,7 +48,9 @@ CREATE TABLE IF NOT EXISTS albums (
 	total_play_count INTEGER NOT NULL DEFAULT 0,
 	total_duration INTEGER NOT NULL DEFAULT 0,
 	genres TEXT NOT NULL DEFAULT '',
-	search_text TEXT NOT NULL DEFAULT ''
+	search_text TEXT NOT NULL DEFAULT '',
+	sort_name TEXT NOT NULL DEFAULT '',
+	artist_sort_name TEXT NOT NULL DEFAULT ''
 );
 CREATE INDEX IF NOT EXISTS idx_albums_name ON albums (name COLLATE NOCASE);
 CREATE INDEX IF NOT EXISTS idx_albums_artist ON albums (artist COLLATE NOCASE);
@@ -74,10 +77,12 @@ func ensureLibraryDerivedTables(db *sql.DB) {
 		"max_last_played": "TEXT NOT NULL DEFAULT ''", "total_play_count": "INTEGER NOT NULL DEFAULT 0",
 		"total_duration": "INTEGER NOT NULL DEFAULT 0",
 		"genres": "TEXT NOT NULL DEFAULT ''", "search_text": "TEXT NOT NULL DEFAULT ''",
+		"sort_name": "TEXT NOT NULL DEFAULT ''", "artist_sort_name": "TEXT NOT NULL DEFAULT ''",
 	}
 	// If total_duration is newly added, the albums table predates the aggregate
 	// columns and its rows hold the defaults (0 / ''); flag a rebuild so
-	// getAlbumList2 returns real duration/created right after an upgrade.
+	// getAlbumList2 returns real duration/created right after an upgrade. The
+	// same goes for the sort names (see sort_name.go).
 	needsAggregateRebuild := false
 	for col, def := range albumCols {
 		added, err := ensureColumnExists(db, "albums", col, def)
@@ -85,23 +90,40 @@ func ensureLibraryDerivedTables(db *sql.DB) {
 			log.Printf("ensureLibraryDerivedTables: albums.%s: %v", col, err)
 			continue
 		}
-		if added && col == "total_duration" {
+		if added && (col == "total_duration" || col == "sort_name") {
 			needsAggregateRebuild = true
 		}
 	}
-	for col, def := range map[string]string{"song_count": "INTEGER NOT NULL DEFAULT 0", "album_count": "INTEGER NOT NULL DEFAULT 0", "search_text": "TEXT NOT NULL DEFAULT ''"} {
-		if _, err := ensureColumnExists(db, "artists", col, def); err != nil {
+	for col, def := range map[string]string{"song_count": "INTEGER NOT NULL DEFAULT 0", "album_count": "INTEGER NOT NULL DEFAULT 0", "search_text": "TEXT NOT NULL DEFAULT ''", "sort_name": "TEXT NOT NULL DEFAULT ''"} {
+		added, err := ensureColumnExists(db, "artists", col, def)
+		if err != nil {
 			log.Printf("ensureLibraryDerivedTables: artists.%s: %v", col, err)
+			continue
+		}
+		if added && col == "sort_name" {
+			needsAggregateRebuild = true
 		}
 	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_artists_sort_name ON artists (sort_name);
+		CREATE INDEX IF NOT EXISTS idx_albums_sort_name ON albums (sort_name)`); err != nil {
+		log.Printf("ensureLibraryDerivedTables: sort name indexes: %v", err)
+	}
 	ensureDerivedFTS(db, "artists_fts", "artists")
 	ensureDerivedFTS(db, "albums_fts", "albums")
 
+	// Albums indexed by an earlier build carry their smallest song id instead
+	// of an album id (see album_key.go).
+	var legacyIDs bool
+	_ = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM albums WHERE id NOT LIKE '` + albumIDPrefix + `%')`).Scan(&legacyIDs)
+	if legacyIDs {
+		needsAggregateRebuild = true
+	}
+
 	if needsAggregateRebuild {
 		var songs int
 		_ = db.QueryRow(`SELECT COUNT(*) FROM songs WHERE cancelled = 0`).Scan(&songs)
 		if songs > 0 {
-			log.Printf("ensureLibraryDerivedTables: backfilling album duration/created aggregates")
+			log.Printf("ensureLibraryDerivedTables: backfilling album aggregates, ids and sort names")
 			if err := RebuildLibraryIndex(db); err != nil {
 				log.Printf("ensureLibraryDerivedTables: aggregate backfill rebuild: %v", err)
 			}
@@ -129,7 +151,6 @@ type albumAccumulator struct {
 	groupKey       string
 	name           string
 	albumPath      string
-	id             string
 	genre          string
 	songCount      int
 	hasAlbumArtist bool
@@ -139,6 +160,7 @@ type albumAccumulator struct {
 	totalPlayCount int
 	totalDuration  int
 	displaySeen    map[string]string // normalizeKey -> original display token
+	albumArtSeen   map[string]string // same, for songs with a usable album_artist
 	searchTokens   map[string]bool
 	genreTokens    map[string]bool
 }
@@ -161,13 +183,6 @@ func effectiveArtist(albumArtist, artist string) string {
 	return strings.TrimSpace(artist)
 }
 
-func albumGroupKey(album, albumPath string) string {
-	if strings.TrimSpace(albumPath) != "" {
-		return albumPath + "|||" + album
-	}
-	return album
-}
-
 // RebuildLibraryIndex repopulates the artists and albums tables (and their FTS
 // indexes) from the current contents of the songs table. It performs a single
 // streaming pass over songs and aggregates in memory, reproducing the exact
@@ -179,7 +194,8 @@ func RebuildLibraryIndex(db *sql.DB) error {
 
 	rows, err := db.Query(`SELECT COALESCE(id,''), COALESCE(title,''), COALESCE(artist,''),
 		COALESCE(album,''), COALESCE(album_artist,''), COALESCE(album_path,''), COALESCE(genre,''),
-		COALESCE(date_added,''), COALESCE(last_played,''), COALESCE(play_count,0), COALESCE(duration,0)
+		COALESCE(date_added,''), COALESCE(last_played,''), COALESCE(play_count,0), COALESCE(duration,0),
+		COALESCE(search_text,'')
 		FROM songs WHERE cancelled = 0`)
 	if err != nil {
 		return err
@@ -187,14 +203,19 @@ func RebuildLibraryIndex(db *sql.DB) error {
 
 	albumsByKey := make(map[string]*albumAccumulator)
 	artistsByName := make(map[string]*artistAccumulator)
+	// songs whose accent-folded search text (see search_text.go) is missing or stale
+	staleSearchText := make(map[string]string)
 
 	for rows.Next() {
-		var id, title, artist, album, albumArtist, albumPath, genre, dateAdded, lastPlayed string
+		var id, title, artist, album, albumArtist, albumPath, genre, dateAdded, lastPlayed, storedSearchText string
 		var playCount int
 		var duration int
-		if err := rows.Scan(&id, &title, &artist, &album, &albumArtist, &albumPath, &genre, &dateAdded, &lastPlayed, &playCount, &duration); err != nil {
+		if err := rows.Scan(&id, &title, &artist, &album, &albumArtist, &albumPath, &genre, &dateAdded, &lastPlayed, &playCount, &duration, &storedSearchText); err != nil {
 			continue
 		}
+		if st := songSearchText(title, artist, album, albumArtist); st != storedSearchText {
+			staleSearchText[id] = st
+		}
 		artist = strings.TrimSpace(artist)
 		album = strings.TrimSpace(album)
 		albumPath = strings.TrimSpace(albumPath)
@@ -208,7 +229,7 @@ func RebuildLibraryIndex(db *sql.DB) error {
 			}
 			a.songCount++
 			if album != "" {
-				a.albumKeys[albumGroupKey(album, albumPath)] = true
+				a.albumKeys[AlbumKey(album, albumPath)] = true
 			}
 		}
 
@@ -216,25 +237,22 @@ func RebuildLibraryIndex(db *sql.DB) error {
 		if album == "" {
 			continue
 		}
-		key := albumGroupKey(album, albumPath)
+		key := AlbumKey(album, albumPath)
 		acc := albumsByKey[key]
 		if acc == nil {
 			acc = &albumAccumulator{
 				groupKey:     key,
 				name:         album,
 				albumPath:    albumPath,
-				id:           id,
 				genre:        genre,
 				displaySeen:  make(map[string]string),
+				albumArtSeen: make(map[string]string),
 				searchTokens: make(map[string]bool),
 				genreTokens:  make(map[string]bool),
 			}
 			albumsByKey[key] = acc
 		}
 		acc.songCount++
-		if id < acc.id {
-			acc.id = id
-		}
 		if acc.genre == "" && genre != "" {
 			acc.genre = genre
 		}
@@ -259,6 +277,7 @@ func RebuildLibraryIndex(db *sql.DB) error {
 		aaTrim := strings.TrimSpace(albumArtist)
 		if aaTrim != "" && strings.ToLower(aaTrim) != "unknown" && strings.ToLower(aaTrim) != "unknown artist" {
 			acc.hasAlbumArtist = true
+			acc.albumArtSeen[normalizeKey(aaTrim)] = aaTrim
 		}
 		// search tokens: album name + every contributing raw artist / album_artist
 		acc.searchTokens[album] = true
@@ -291,13 +310,14 @@ func RebuildLibraryIndex(db *sql.DB) error {
 		return err
 	}
 
-	artStmt, err := tx.Prepare(`INSERT OR REPLACE INTO artists (id, name, song_count, album_count, search_text) VALUES (?,?,?,?,?)`)
+	articles := ignoredArticles(db)
+	artStmt, err := tx.Prepare(`INSERT OR REPLACE INTO artists (id, name, song_count, album_count, search_text, sort_name) VALUES (?,?,?,?,?,?)`)
 	if err != nil {
 		return err
 	}
 	for _, a := range artistsByName {
 		id := GenerateArtistID(a.name)
-		if _, err := artStmt.Exec(id, a.name, a.songCount, len(a.albumKeys), a.name); err != nil {
+		if _, err := artStmt.Exec(id, a.name, a.songCount, len(a.albumKeys), a.name, sortName(a.name, articles)); err != nil {
 			artStmt.Close()
 			return err
 		}
@@ -305,27 +325,47 @@ func RebuildLibraryIndex(db *sql.DB) error {
 	artStmt.Close()
 
 	albStmt, err := tx.Prepare(`INSERT OR REPLACE INTO albums
-		(group_key, id, name, album_path, artist, artist_id, genre, song_count, has_album_artist, max_date_added, min_date_added, max_last_played, total_play_count, total_duration, genres, search_text)
-		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`)
+		(group_key, id, name, album_path, artist, artist_id, genre, song_count, has_album_artist, max_date_added, min_date_added, max_last_played, total_play_count, total_duration, genres, search_text, sort_name, artist_sort_name)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`)
 	if err != nil {
 		return err
 	}
 	for _, acc := range albumsByKey {
+		// Once any track carries an album artist, tracks without one must not
+		// add their raw (often "feat.") artist to the album's display artist.
 		display := buildDisplayArtist(acc.displaySeen)
+		if acc.hasAlbumArtist {
+			display = buildDisplayArtist(acc.albumArtSeen)
+		}
 		var hasAA int
 		if acc.hasAlbumArtist {
 			hasAA = 1
 		}
 		searchText := buildSearchText(acc.searchTokens)
 		genres := joinTokens(acc.genreTokens, ";")
-		if _, err := albStmt.Exec(acc.groupKey, acc.id, acc.name, acc.albumPath, display, GenerateArtistID(display),
-			acc.genre, acc.songCount, hasAA, acc.maxDateAdded, acc.minDateAdded, acc.maxLastPlayed, acc.totalPlayCount, acc.totalDuration, genres, searchText); err != nil {
+		if _, err := albStmt.Exec(acc.groupKey, AlbumID(acc.name, acc.albumPath), acc.name, acc.albumPath, display, GenerateArtistID(display),
+			acc.genre, acc.songCount, hasAA, acc.maxDateAdded, acc.minDateAdded, acc.maxLastPlayed, acc.totalPlayCount, acc.totalDuration, genres, searchText,
+			sortName(acc.name, articles), sortName(display, articles)); err != nil {
 			albStmt.Close()
 			return err
 		}
 	}
 	albStmt.Close()
 
+	if len(staleSearchText) > 0 {
+		stStmt, err := tx.Prepare(`UPDATE songs SET search_text = ? WHERE id = ?`)
+		if err != nil {
+			return err
+		}
+		for id, st := range staleSearchText {
+			if _, err := stStmt.Exec(st, id); err != nil {
+				stStmt.Close()
+				return err
+			}
+		}
+		stStmt.Close()
+	}
+
 	if err := tx.Commit(); err != nil {
 		return err
 	}
@@ -348,7 +388,7 @@ func RebuildLibraryIndex(db *sql.DB) error {
 		}
 	}
 
-	log.Printf("RebuildLibraryIndex: %d artists, %d albums", len(artistsByName), len(albumsByKey))
+	log.Printf("RebuildLibraryIndex: %d artists, %d albums, %d search texts updated", len(artistsByName), len(albumsByKey), len(staleSearchText))
 	return nil
 }
 
@@ -356,7 +396,7 @@ func RebuildLibraryIndex(db *sql.DB) error {
 // the derived albums table (an O(1) primary-key lookup), falling back to the
 // live per-song computation if the album is not yet in the table.
 func albumDisplayArtist(db *sql.DB, albumName, albumPath string) string {
-	key := albumGroupKey(albumName, strings.TrimSpace(albumPath))
+	key := AlbumKey(albumName, strings.TrimSpace(albumPath))
 	var artist string
 	if err := db.QueryRow(`SELECT artist FROM albums WHERE group_key = ?`, key).Scan(&artist); err == nil && artist != "" {
 		return artist
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// Songs belong to a library path when their path starts with it. Paths from
+// Windows may use either separator and may or may not end in one, so both
+// sides are compared in a slash-separated, cleaned form: slashPath for Go
+// code and songUnderPathClause with songPathPattern in SQL.
+
+// songUnderPathClause matches songs.path against a songPathPattern.
+const songUnderPathClause = `REPLACE(path, '\', '/') LIKE ? ESCAPE '!'`
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// slashPath returns p cleaned and with "/" as the only separator.
+func slashPath(p string) string {
+	return path.Clean(strings.ReplaceAll(p, `\`, "/"))
+}
+
+// songPathPattern returns the LIKE pattern for songUnderPathClause that
+// matches every file below libraryPath, but not a sibling sharing its name
+// prefix (/music2 for /music).
+func songPathPattern(libraryPath string) string {
+	prefix := slashPath(libraryPath)
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return likeEscaper.Replace(prefix) + "%"
+}
+
+// songUnderPath is the Go counterpart of songUnderPathClause.
+func songUnderPath(songPath, libraryPath string) bool {
+	prefix := slashPath(libraryPath)
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return strings.HasPrefix(slashPath(songPath), prefix)
+}
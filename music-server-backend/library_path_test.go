@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateLibraryPath(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "song.mp3")
+	os.WriteFile(file, nil, 0o644)
+
+	if got, err := validateLibraryPath(" " + dir + string(filepath.Separator) + " "); err != nil || got != dir {
+		t.Errorf("validateLibraryPath(dir/) = %q, %v; want %q", got, err, dir)
+	}
+	for _, tc := range []struct{ path, want string }{
+		{"music", "must be absolute"},
+		{filepath.Join(dir, "missing"), "does not exist"},
+		{file, "is not a directory"},
+	} {
+		if _, err := validateLibraryPath(tc.path); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("validateLibraryPath(%q) = %v, want an error containing %q", tc.path, err, tc.want)
+		}
+	}
+
+	if os.Getuid() != 0 {
+		locked := filepath.Join(dir, "locked")
+		os.Mkdir(locked, 0o000)
+		defer os.Chmod(locked, 0o755)
+		if _, err := validateLibraryPath(locked); err == nil || !strings.Contains(err.Error(), "not readable") {
+			t.Errorf("validateLibraryPath(unreadable) = %v", err)
+		}
+	}
+}
+
+func TestAddLibraryPathRejectsNestedPaths(t *testing.T) {
+	d := scanTestDB(t)
+	music := t.TempDir()
+	for _, dir := range []string{"rock", "jazz"} {
+		os.Mkdir(filepath.Join(music, dir), 0o755)
+	}
+	os.Mkdir(music+"2", 0o755)
+	defer os.Remove(music + "2")
+	d.Exec(`INSERT INTO library_paths (id, path) VALUES (1, ?)`, music)
+	d.Exec(`INSERT INTO songs (id, title, path) VALUES ('s1', 'A', ?), ('s2', 'B', ?)`,
+		filepath.Join(music, "rock", "a.mp3"), filepath.Join(music, "jazz", "b.mp3"))
+
+	add := func(path string) string {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		body, _ := json.Marshal(map[string]string{"path": path})
+		c.Request = httptest.NewRequest(http.MethodPost, "/rest/addLibraryPath?f=json", bytes.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user", User{ID: 1, Username: "admin"})
+		subsonicAddLibraryPath(c)
+		return w.Body.String()
+	}
+
+	if body := add(filepath.Join(music, "rock")); !strings.Contains(body, "already covered by the library path") {
+		t.Errorf("nested path accepted: %s", body)
+	}
+	if body := add(filepath.Dir(music)); !strings.Contains(body, "contains the existing library path") {
+		t.Errorf("parent path accepted: %s", body)
+	}
+	var paths int
+	d.QueryRow(`SELECT COUNT(*) FROM library_paths`).Scan(&paths)
+	if paths != 1 {
+		t.Fatalf("library_paths has %d rows, want 1", paths)
+	}
+
+	updateSongCountForPath(music, 1)
+	var count int
+	d.QueryRow(`SELECT song_count FROM library_paths WHERE id = 1`).Scan(&count)
+	if count != 2 {
+		t.Errorf("song_count = %d, want 2", count)
+	}
+
+	// A sibling that merely shares the name prefix does not overlap.
+	if err := checkLibraryPathOverlap(music+"2", 0); err != nil {
+		t.Errorf("sibling rejected: %v", err)
+	}
+}
+
+func TestSongCountWithWindowsPaths(t *testing.T) {
+	d := scanTestDB(t)
+	d.Exec(`INSERT INTO library_paths (id, path) VALUES (1, 'C:\Music\'), (2, 'C:/Music2')`)
+	for i, p := range []string{
+		`C:\Music\Rock\a.mp3`,
+		`C:\Music\b.flac`,
+		`C:/Music/Mixed\c.mp3`,
+		`C:\Music2\d.mp3`,
+		`C:\Music_Old\e.mp3`,
+	} {
+		d.Exec(`INSERT INTO songs (id, title, path) VALUES (?, 'T', ?)`, fmt.Sprint("s", i), p)
+	}
+
+	counts := map[int]int{}
+	updateSongCountForPath(`C:\Music\`, 1)
+	updateSongCountForPath(`C:/Music2`, 2)
+	rows, _ := d.Query(`SELECT id, song_count FROM library_paths`)
+	for rows.Next() {
+		var id, n int
+		rows.Scan(&id, &n)
+		counts[id] = n
+	}
+	rows.Close()
+	if counts[1] != 3 || counts[2] != 1 {
+		t.Errorf("song counts = %v, want map[1:3 2:1]", counts)
+	}
+
+	for _, tc := range []struct {
+		song, lib string
+		want      bool
+	}{
+		{`C:\Music\Rock\a.mp3`, `C:/Music/`, true},
+		{`C:/Music/b.flac`, `C:\Music`, true},
+		{`C:\Music2\d.mp3`, `C:\Music`, false},
+		{`/music/a.mp3`, `/music/`, true},
+		{`/music2/a.mp3`, `/music`, false},
+		{`/a.mp3`, `/`, true},
+	} {
+		if got := songUnderPath(tc.song, tc.lib); got != tc.want {
+			t.Errorf("songUnderPath(%q, %q) = %v, want %v", tc.song, tc.lib, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// renameLibraryEntity handles POST /api/v1/admin/rename with
+// {"type": "artist"|"album", "from": "...", "to": "..."}. It rewrites the
+// tags stored in the database, so a systematic tagging mistake ("Beatles" vs
+// "The Beatles") can be fixed without retagging the files and rescanning; a
+// later full rescan of files that still carry the old tag brings it back.
+// Names match exactly. An artist rename covers both artist and album_artist
+// and carries over stars on the artist. changed is the number of songs
+// updated.
+func renameLibraryEntity(c *gin.Context) {
+	var req struct {
+		Type string `json:"type"`
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	req.To = strings.TrimSpace(req.To)
+	if req.Type != "artist" && req.Type != "album" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be artist or album"})
+		return
+	}
+	if req.From == "" || req.To == "" || req.From == req.To {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be different, non-empty names"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var changed int64
+	if req.Type == "artist" {
+		res, err := tx.Exec(`UPDATE songs SET
+				artist = CASE WHEN artist = ? THEN ? ELSE artist END,
+				album_artist = CASE WHEN album_artist = ? THEN ? ELSE album_artist END
+			WHERE artist = ? OR album_artist = ?`,
+			req.From, req.To, req.From, req.To, req.From, req.From)
+		if err == nil {
+			changed, _ = res.RowsAffected()
+			_, err = tx.Exec(`UPDATE OR REPLACE starred_artists SET artist_name = ? WHERE artist_name = ?`, req.To, req.From)
+		}
+		if err != nil {
+			log.Printf("renameLibraryEntity: renaming artist %q failed: %v", req.From, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename artist"})
+			return
+		}
+	} else {
+		res, err := tx.Exec(`UPDATE songs SET album = ? WHERE album = ?`, req.To, req.From)
+		if err != nil {
+			log.Printf("renameLibraryEntity: renaming album %q failed: %v", req.From, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename album"})
+			return
+		}
+		changed, _ = res.RowsAffected()
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit"})
+		return
+	}
+
+	log.Printf("[ADMIN] %s renamed %s %q to %q (%d songs)", c.GetString("username"), req.Type, req.From, req.To, changed)
+	if changed > 0 {
+		invalidateArtistIDCache()
+		if err := RebuildLibraryIndex(db); err != nil {
+			log.Printf("RebuildLibraryIndex after rename failed: %v", err)
+		}
+		invalidateBrowseCache()
+	}
+	c.JSON(http.StatusOK, gin.H{"changed": changed})
+}
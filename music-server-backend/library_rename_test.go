@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRenameLibraryEntity(t *testing.T) {
+	d := scanTestDB(t)
+	for _, stmt := range []string{
+		`CREATE TABLE starred_artists (user_id INTEGER NOT NULL, artist_name TEXT NOT NULL, starred_at TEXT NOT NULL, PRIMARY KEY (user_id, artist_name))`,
+		`INSERT INTO songs (id, title, artist, album_artist, album, path) VALUES
+			('s1', 'Help', 'Beatles', 'Beatles', 'Help!', '/m/1.mp3'),
+			('s2', 'Duet', 'Guest', 'Beatles', 'Help!', '/m/2.mp3'),
+			('s3', 'Yesterday', 'The Beatles', 'The Beatles', 'Help', '/m/3.mp3'),
+			('s4', 'Other', 'Beatles Tribute', '', 'Help', '/m/4.mp3')`,
+		`INSERT INTO starred_artists VALUES (1, 'Beatles', 'x'), (2, 'Beatles', 'x'), (2, 'The Beatles', 'x')`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := gin.New()
+	r.POST("/rename", renameLibraryEntity)
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/rename", bytes.NewBufferString(body)))
+		return w
+	}
+
+	if w := post(`{"type":"artist","from":"Beatles","to":"The Beatles"}`); w.Code != http.StatusOK || w.Body.String() != `{"changed":2}` {
+		t.Fatalf("artist rename: %d %s", w.Code, w.Body.String())
+	}
+	var artist, albumArtist string
+	d.QueryRow(`SELECT artist, album_artist FROM songs WHERE id = 's2'`).Scan(&artist, &albumArtist)
+	if artist != "Guest" || albumArtist != "The Beatles" {
+		t.Errorf("s2 = %q / %q", artist, albumArtist)
+	}
+	var left, stars int
+	d.QueryRow(`SELECT COUNT(*) FROM songs WHERE artist = 'Beatles' OR album_artist = 'Beatles'`).Scan(&left)
+	d.QueryRow(`SELECT COUNT(*) FROM starred_artists WHERE artist_name = 'The Beatles'`).Scan(&stars)
+	if left != 0 || stars != 2 {
+		t.Errorf("%d songs still use the old name, %d stars on the new one", left, stars)
+	}
+
+	if w := post(`{"type":"album","from":"Help","to":"Help!"}`); w.Body.String() != `{"changed":2}` {
+		t.Fatalf("album rename: %d %s", w.Code, w.Body.String())
+	}
+	for _, body := range []string{
+		`{"type":"genre","from":"a","to":"b"}`,
+		`{"type":"album","from":"Help!","to":"  "}`,
+		`{"type":"album","from":"Help!","to":"Help!"}`,
+	} {
+		if w := post(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: %d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Watch mode (watch_library=true, off by default). Every folder of every
+// library path is watched so new, replaced and deleted songs show up within a
+// few seconds instead of at the next scheduled scan. Events are collected per
+// path and handled once the library has been quiet for watchDebounce, so a
+// large copy is indexed in batches rather than file by file: a file that
+// exists is upserted with the same tag reading the scanner uses, a path that
+// is gone is marked cancelled along with anything below it.
+//
+// The changes are applied under the scan claim (claimScanStatus), so the
+// watcher never writes songs or rebuilds the library index underneath a
+// running scan, and no scan starts while it does. While a scan holds the
+// claim the queued changes are kept and retried after another debounce
+// interval.
+//
+// Watches are per folder and go through fsnotify, so watch mode works on
+// every platform it supports. When the OS limit is reached (on Linux
+// fs.inotify.max_user_watches) the remaining folders are left to the
+// scheduled scans and a warning is logged once.
+
+const watchDebounce = 2 * time.Second
+
+type watchOp int
+
+const (
+	watchCreate watchOp = 1 << iota
+	watchWrite
+	watchRemove
+	watchRename
+)
+
+type watchEvent struct {
+	Path  string
+	Op    watchOp
+	IsDir bool
+}
+
+// dirWatcher reports changes to the entries of the directories added to it
+// (not recursively). newDirWatcher returns the platform implementation.
+type dirWatcher interface {
+	Add(dir string) error
+	Events() <-chan watchEvent
+	Errors() <-chan error
+	Close() error
+}
+
+// errWatchLimit is returned by dirWatcher.Add when the OS refuses more watches.
+var errWatchLimit = errors.New("watch limit reached")
+
+type libraryWatcher struct {
+	w        dirWatcher
+	roots    []LibraryPath
+	ignore   []string
+	debounce time.Duration
+
+	mu       sync.Mutex
+	pending  map[string]bool
+	timer    *time.Timer
+	watched  int
+	limitHit bool
+	closed   bool
+}
+
+var (
+	libraryWatcherMu      sync.Mutex
+	activeLibraryWatcher  *libraryWatcher
+	libraryWatcherStopped bool // set on shutdown; no watcher starts after it
+
+	// libraryWatcherReloadMu serialises reloads, which each read the settings
+	// afresh, so the last one wins.
+	libraryWatcherReloadMu sync.Mutex
+)
+
+// ReloadLibraryWatcher stops the running watcher, if any, and starts a new one
+// over the current library paths when watch_library is enabled. Starting a
+// watcher walks every folder of the library, so it runs in the background
+// rather than holding up startup or the admin request that changed a setting.
+func ReloadLibraryWatcher() {
+	go reloadLibraryWatcher()
+}
+
+func reloadLibraryWatcher() {
+	libraryWatcherReloadMu.Lock()
+	defer libraryWatcherReloadMu.Unlock()
+	if !swapLibraryWatcher(nil) || !configBool(db, "watch_library") {
+		return
+	}
+
+	rows, err := db.Query("SELECT id, path FROM library_paths ORDER BY path")
+	if err != nil {
+		log.Printf("Library watcher not started: %v", err)
+		return
+	}
+	var roots []LibraryPath
+	for rows.Next() {
+		var p LibraryPath
+		if err := rows.Scan(&p.ID, &p.Path); err == nil {
+			roots = append(roots, p)
+		}
+	}
+	rows.Close()
+
+	lw, err := newLibraryWatcher(roots, watchDebounce)
+	if err != nil {
+		log.Printf("Library watcher not started: %v", err)
+		return
+	}
+	if !swapLibraryWatcher(lw) {
+		lw.Close()
+	}
+}
+
+// swapLibraryWatcher stops the running watcher and installs lw in its place.
+// It returns false, leaving lw uninstalled, once the server is shutting down.
+func swapLibraryWatcher(lw *libraryWatcher) bool {
+	libraryWatcherMu.Lock()
+	defer libraryWatcherMu.Unlock()
+	if activeLibraryWatcher != nil {
+		activeLibraryWatcher.Close()
+		activeLibraryWatcher = nil
+	}
+	if libraryWatcherStopped {
+		return false
+	}
+	activeLibraryWatcher = lw
+	return true
+}
+
+// stopLibraryWatcher stops the running watcher, if any, and keeps reloads
+// still in progress from starting another; called on shutdown.
+func stopLibraryWatcher() {
+	libraryWatcherMu.Lock()
+	defer libraryWatcherMu.Unlock()
+	libraryWatcherStopped = true
+	if activeLibraryWatcher != nil {
+		activeLibraryWatcher.Close()
+		activeLibraryWatcher = nil
+	}
+}
+
+func newLibraryWatcher(roots []LibraryPath, debounce time.Duration) (*libraryWatcher, error) {
+	w, err := newDirWatcher()
+	if err != nil {
+		return nil, err
+	}
+	lw := &libraryWatcher{w: w, roots: roots, ignore: scanIgnorePatterns(), debounce: debounce, pending: make(map[string]bool)}
+	for _, root := range roots {
+		lw.addTree(root.Path, false)
+	}
+	log.Printf("Library watcher started: %d folders watched in %d library paths", lw.watched, len(roots))
+	go lw.run()
+	return lw, nil
+}
+
+// Close stops the watcher. Changes still waiting for the debounce are dropped;
+// the next scan picks them up.
+func (lw *libraryWatcher) Close() {
+	lw.mu.Lock()
+	lw.closed = true
+	if lw.timer != nil {
+		lw.timer.Stop()
+	}
+	lw.mu.Unlock()
+	lw.w.Close()
+}
+
+// rootOf returns the library path containing path.
+func (lw *libraryWatcher) rootOf(path string) (LibraryPath, bool) {
+	var best LibraryPath
+	found := false
+	for _, root := range lw.roots {
+		if path == root.Path || strings.HasPrefix(path, strings.TrimRight(root.Path, string(filepath.Separator))+string(filepath.Separator)) {
+			if !found || len(root.Path) > len(best.Path) {
+				best, found = root, true
+			}
+		}
+	}
+	return best, found
+}
+
+// addTree watches dir and every folder below it. With queueFiles the audio
+// files found are queued too, for folders that appeared (or were moved in)
+// with their content already in place.
+func (lw *libraryWatcher) addTree(dir string, queueFiles bool) {
+	root, ok := lw.rootOf(dir)
+	if !ok {
+		return
+	}
+	scanWalk(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if skip, err := skipIgnoredEntry(lw.ignore, root.Path, path, d); skip {
+			return err
+		}
+		if !d.IsDir() {
+			if queueFiles && isSupportedAudioFile(path) {
+				lw.queue(path)
+			}
+			return nil
+		}
+		if err := lw.w.Add(path); err != nil {
+			if errors.Is(err, errWatchLimit) {
+				lw.mu.Lock()
+				if !lw.limitHit {
+					lw.limitHit = true
+					log.Printf("Library watcher: OS watch limit reached after %d folders; changes in the remaining folders are picked up by scheduled scans (on Linux, raise fs.inotify.max_user_watches)", lw.watched)
+				}
+				lw.mu.Unlock()
+				return filepath.SkipAll
+			}
+			log.Printf("Library watcher: cannot watch %s: %v", path, err)
+			return nil
+		}
+		lw.mu.Lock()
+		lw.watched++
+		lw.mu.Unlock()
+		return nil
+	})
+}
+
+func (lw *libraryWatcher) run() {
+	for {
+		select {
+		case ev, ok := <-lw.w.Events():
+			if !ok {
+				return
+			}
+			lw.handle(ev)
+		case err, ok := <-lw.w.Errors():
+			if !ok {
+				return
+			}
+			log.Printf("Library watcher: %v", err)
+		}
+	}
+}
+
+func (lw *libraryWatcher) handle(ev watchEvent) {
+	root, ok := lw.rootOf(ev.Path)
+	if !ok || scanIgnored(lw.ignore, root.Path, ev.Path) {
+		return
+	}
+	if ev.IsDir {
+		if ev.Op&watchCreate != 0 {
+			lw.addTree(ev.Path, true)
+		} else {
+			lw.queue(ev.Path) // gone: cancel everything below it
+		}
+		return
+	}
+	if isSupportedAudioFile(ev.Path) {
+		lw.queue(ev.Path)
+	}
+}
+
+// queue records a changed path and restarts the debounce timer.
+func (lw *libraryWatcher) queue(path string) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	if lw.closed {
+		return
+	}
+	lw.pending[path] = true
+	if lw.timer == nil {
+		lw.timer = time.AfterFunc(lw.debounce, lw.flush)
+	} else {
+		lw.timer.Reset(lw.debounce)
+	}
+}
+
+// flush applies the queued changes and refreshes the derived tables once.
+func (lw *libraryWatcher) flush() {
+	gen, claimed := claimScanStatus(db)
+	if !claimed {
+		lw.mu.Lock()
+		if !lw.closed {
+			if lw.timer == nil {
+				lw.timer = time.AfterFunc(lw.debounce, lw.flush)
+			} else {
+				lw.timer.Reset(lw.debounce)
+			}
+		}
+		lw.mu.Unlock()
+		return
+	}
+	defer releaseScanStatus(db, gen)
+
+	lw.mu.Lock()
+	pending := lw.pending
+	lw.pending = make(map[string]bool)
+	lw.timer = nil
+	closed := lw.closed
+	lw.mu.Unlock()
+	if closed || len(pending) == 0 {
+		return
+	}
+
+	changed := 0
+	touched := make(map[int]LibraryPath)
+	for path := range pending {
+		info, err := os.Stat(path)
+		switch {
+		case err == nil && info.IsDir():
+			continue
+		case err == nil:
+			if _, err := upsertSongFile(path); err != nil {
+				log.Printf("Library watcher: error upserting %s: %v", path, err)
+				continue
+			}
+		case os.IsNotExist(err):
+			prefix := strings.TrimRight(path, string(filepath.Separator)) + string(filepath.Separator)
+			if _, err := db.Exec("UPDATE songs SET cancelled = 1, cancel_reason = ? WHERE (path = ? OR path LIKE ?) AND cancelled = 0", cancelReasonMissing, path, prefix+"%"); err != nil {
+				log.Printf("Library watcher: error cancelling %s: %v", path, err)
+				continue
+			}
+		default:
+			continue
+		}
+		changed++
+		if root, ok := lw.rootOf(path); ok {
+			touched[root.ID] = root
+		}
+	}
+	if changed == 0 {
+		return
+	}
+	log.Printf("Library watcher: applied %d changes", changed)
+	for _, root := range touched {
+		updateSongCountForPath(root.Path, root.ID)
+	}
+	invalidateArtistIDCache()
+	if err := RebuildLibraryIndex(db); err != nil {
+		log.Printf("RebuildLibraryIndex after watched changes failed: %v", err)
+	}
+	invalidateBrowseCache()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fsnotifyWatcher implements dirWatcher on top of fsnotify (inotify on Linux,
+// kqueue on the BSDs and macOS, ReadDirectoryChangesW on Windows). fsnotify
+// does not say whether a removed or renamed path was a folder, so the watched
+// folders are remembered to tell them apart from files.
+type fsnotifyWatcher struct {
+	w      *fsnotify.Watcher
+	events chan watchEvent
+	done   chan struct{}
+	once   sync.Once
+
+	mu   sync.Mutex
+	dirs map[string]bool
+}
+
+func newDirWatcher() (dirWatcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &fsnotifyWatcher{
+		w:      fw,
+		events: make(chan watchEvent, 256),
+		done:   make(chan struct{}),
+		dirs:   make(map[string]bool),
+	}
+	go w.readEvents()
+	return w, nil
+}
+
+func (w *fsnotifyWatcher) Add(dir string) error {
+	if err := w.w.Add(dir); err != nil {
+		// ENOSPC is inotify's max_user_watches; kqueue needs a descriptor
+		// per watched folder and runs out of those instead.
+		if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE) {
+			return errWatchLimit
+		}
+		return err
+	}
+	w.mu.Lock()
+	w.dirs[dir] = true
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *fsnotifyWatcher) Events() <-chan watchEvent { return w.events }
+func (w *fsnotifyWatcher) Errors() <-chan error      { return w.w.Errors }
+
+func (w *fsnotifyWatcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.done)
+		err = w.w.Close()
+	})
+	return err
+}
+
+// forgetTree drops dir and every watched folder below it. A folder moved out
+// of the library would otherwise stay watched under its new name.
+func (w *fsnotifyWatcher) forgetTree(dir string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.dirs[dir] {
+		return false
+	}
+	prefix := strings.TrimRight(dir, string(filepath.Separator)) + string(filepath.Separator)
+	for d := range w.dirs {
+		if d == dir || strings.HasPrefix(d, prefix) {
+			delete(w.dirs, d)
+			_ = w.w.Remove(d)
+		}
+	}
+	return true
+}
+
+func (w *fsnotifyWatcher) readEvents() {
+	defer close(w.events)
+	for {
+		var fe fsnotify.Event
+		select {
+		case e, ok := <-w.w.Events:
+			if !ok {
+				return
+			}
+			fe = e
+		case <-w.done:
+			return
+		}
+
+		ev := watchEvent{Path: fe.Name}
+		switch {
+		case fe.Has(fsnotify.Create):
+			ev.Op = watchCreate
+			if info, err := os.Stat(fe.Name); err == nil && info.IsDir() {
+				ev.IsDir = true
+			}
+		case fe.Has(fsnotify.Write):
+			ev.Op = watchWrite
+		case fe.Has(fsnotify.Rename):
+			ev.Op = watchRename
+			ev.IsDir = w.forgetTree(fe.Name)
+		case fe.Has(fsnotify.Remove):
+			ev.Op = watchRemove
+			ev.IsDir = w.forgetTree(fe.Name)
+		default:
+			continue
+		}
+		select {
+		case w.events <- ev:
+		case <-w.done:
+			return
+		}
+	}
+}
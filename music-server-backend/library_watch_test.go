@@ -0,0 +1,162 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLibraryWatcherIndexesAndCancelsFiles(t *testing.T) {
+	d := scanTestDB(t)
+
+	lib := t.TempDir()
+	d.Exec(`INSERT INTO library_paths (id, path) VALUES (1, ?)`, lib)
+	if err := os.MkdirAll(filepath.Join(lib, "@eaDir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	lw, err := newLibraryWatcher([]LibraryPath{{ID: 1, Path: lib}}, 50*time.Millisecond)
+	if err != nil {
+		t.Skipf("file watching unavailable: %v", err)
+	}
+	defer lw.Close()
+
+	songState := func(path string) (exists, cancelled bool) {
+		var c int
+		if err := d.QueryRow(`SELECT cancelled FROM songs WHERE path = ?`, path).Scan(&c); err != nil {
+			return false, false
+		}
+		return true, c == 1
+	}
+	waitFor := func(desc string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", desc)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	top := filepath.Join(lib, "01 - Top.mp3")
+	os.WriteFile(top, nil, 0o644)
+	os.WriteFile(filepath.Join(lib, "cover.jpg"), nil, 0o644)
+	os.WriteFile(filepath.Join(lib, "@eaDir", "thumb.mp3"), nil, 0o644)
+
+	// A folder created after the watcher started is watched too, including
+	// files that landed before its watch was added.
+	album := filepath.Join(lib, "Artist", "Album")
+	os.MkdirAll(album, 0o755)
+	track := filepath.Join(album, "01 - Track.mp3")
+	os.WriteFile(track, nil, 0o644)
+
+	waitFor("new files to be indexed", func() bool {
+		a, _ := songState(top)
+		b, _ := songState(track)
+		return a && b
+	})
+	var n int
+	d.QueryRow(`SELECT COUNT(*) FROM songs`).Scan(&n)
+	if n != 2 {
+		t.Fatalf("indexed %d songs, want 2 (cover art and ignored folders skipped)", n)
+	}
+	// song_count is refreshed just after the batch that indexed the files
+	waitFor("song_count to reach 2", func() bool {
+		d.QueryRow(`SELECT song_count FROM library_paths WHERE id = 1`).Scan(&n)
+		return n == 2
+	})
+
+	os.Remove(top)
+	waitFor("deleted file to be cancelled", func() bool { _, c := songState(top); return c })
+
+	// Moving a folder out of the library cancels everything below it.
+	os.Rename(filepath.Join(lib, "Artist"), filepath.Join(t.TempDir(), "Artist"))
+	waitFor("moved-away folder to be cancelled", func() bool { _, c := songState(track); return c })
+}
+
+func TestLibraryWatcherWaitsForRunningScan(t *testing.T) {
+	d := scanTestDB(t)
+
+	lib := t.TempDir()
+	d.Exec(`INSERT INTO library_paths (id, path) VALUES (1, ?)`, lib)
+	d.Exec(`UPDATE scan_status SET is_scanning = 1 WHERE id = 1`)
+	lw, err := newLibraryWatcher([]LibraryPath{{ID: 1, Path: lib}}, 50*time.Millisecond)
+	if err != nil {
+		t.Skipf("file watching unavailable: %v", err)
+	}
+	defer lw.Close()
+
+	track := filepath.Join(lib, "01 - Track.mp3")
+	os.WriteFile(track, nil, 0o644)
+
+	time.Sleep(500 * time.Millisecond)
+	var n int
+	d.QueryRow(`SELECT COUNT(*) FROM songs`).Scan(&n)
+	if n != 0 {
+		t.Fatalf("watcher indexed %d songs while a scan was running", n)
+	}
+
+	var genBefore int64
+	d.QueryRow(`SELECT scan_generation FROM scan_status WHERE id = 1`).Scan(&genBefore)
+	d.Exec(`UPDATE scan_status SET is_scanning = 0 WHERE id = 1`)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		d.QueryRow(`SELECT COUNT(*) FROM songs WHERE path = ?`, track).Scan(&n)
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("queued change was not applied after the scan finished")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// The change was applied under a scan claim of its own, since released.
+	deadline = time.Now().Add(10 * time.Second)
+	for {
+		var scanning bool
+		var gen int64
+		d.QueryRow(`SELECT is_scanning, scan_generation FROM scan_status WHERE id = 1`).Scan(&scanning, &gen)
+		if !scanning && gen > genBefore {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("scan claim not taken and released by the watcher (is_scanning %v, generation %d -> %d)", scanning, genBefore, gen)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestLibraryWatcherReloadRunsInBackground(t *testing.T) {
+	d := scanTestDB(t)
+	d.Exec(`INSERT INTO configuration (key, value) VALUES ('watch_library', 'true')`)
+	d.Exec(`INSERT INTO library_paths (id, path) VALUES (1, ?)`, t.TempDir())
+	t.Cleanup(func() {
+		stopLibraryWatcher()
+		libraryWatcherMu.Lock()
+		libraryWatcherStopped = false
+		libraryWatcherMu.Unlock()
+	})
+	running := func() bool {
+		libraryWatcherMu.Lock()
+		defer libraryWatcherMu.Unlock()
+		return activeLibraryWatcher != nil
+	}
+
+	ReloadLibraryWatcher()
+	deadline := time.Now().Add(10 * time.Second)
+	for !running() {
+		if time.Now().After(deadline) {
+			t.Skip("file watching unavailable")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// A reload finishing after shutdown must not start a new watcher.
+	stopLibraryWatcher()
+	reloadLibraryWatcher()
+	if running() {
+		t.Fatal("a watcher was started after shutdown")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Brute-force protection for password logins (JSON /api/v1/user/login and
+// Subsonic u/p or token auth). Failures are counted per client IP and per
+// username inside a sliding window; once either counter reaches the configured
+// threshold, further attempts are refused for a lockout period that doubles
+// with every additional failure (capped at loginMaxLockout). A successful login
+// clears the counters. State is in-memory: a restart resets it, which is fine
+// for throttling and avoids a DB write per failed attempt.
+// The client IP is gin's ClientIP, which only trusts forwarded headers from
+// TRUSTED_PROXIES (see trusted_proxies.go), so it cannot be spoofed to dodge
+// the per-IP counter.
+//
+// Thresholds come from the configuration table:
+//   login_max_failures            failures before lockout (default 5, 0 disables)
+//   login_failure_window_seconds  window failures are counted in (default 900)
+//   login_lockout_seconds         initial lockout, doubled per extra failure (default 60)
+
+var (
+	loginLimiterMu sync.Mutex
+	loginLimiter   = map[string]*loginFailureEntry{}
+)
+
+type loginFailureEntry struct {
+	failures    int
+	firstFailed time.Time
+	lockedUntil time.Time
+}
+
+const loginMaxLockout = time.Hour
+
+// loginFailureDelay is how long a refused Subsonic request is held before the
+// error is returned, slowing down scripted guessing. A var so tests can shorten it.
+var loginFailureDelay = time.Second
+
+type loginLimits struct {
+	maxFailures int
+	window      time.Duration
+	lockout     time.Duration
+}
+
+func currentLoginLimits() loginLimits {
+	return loginLimits{
+		maxFailures: configInt(db, "login_max_failures", 5),
+		window:      time.Duration(configInt(db, "login_failure_window_seconds", 900)) * time.Second,
+		lockout:     time.Duration(configInt(db, "login_lockout_seconds", 60)) * time.Second,
+	}
+}
+
+func loginLimiterKeys(ip, username string) []string {
+	keys := []string{"ip:" + ip}
+	if username != "" {
+		keys = append(keys, "user:"+strings.ToLower(username))
+	}
+	return keys
+}
+
+// loginBlocked reports whether attempts from ip or for username are currently
+// locked out, and for how much longer.
+func loginBlocked(ip, username string) (time.Duration, bool) {
+	now := time.Now()
+	var wait time.Duration
+	loginLimiterMu.Lock()
+	defer loginLimiterMu.Unlock()
+	for _, key := range loginLimiterKeys(ip, username) {
+		if e, ok := loginLimiter[key]; ok && now.Before(e.lockedUntil) {
+			if d := e.lockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait, wait > 0
+}
+
+// recordLoginFailure counts a failed attempt against both the IP and username.
+func recordLoginFailure(ip, username string) {
+	limits := currentLoginLimits()
+	if limits.maxFailures == 0 {
+		return
+	}
+	now := time.Now()
+	loginLimiterMu.Lock()
+	defer loginLimiterMu.Unlock()
+	// Opportunistically evict stale entries to keep the map bounded.
+	if len(loginLimiter) > 4096 {
+		for k, e := range loginLimiter {
+			if now.Sub(e.firstFailed) > limits.window && now.After(e.lockedUntil) {
+				delete(loginLimiter, k)
+			}
+		}
+	}
+	for _, key := range loginLimiterKeys(ip, username) {
+		e, ok := loginLimiter[key]
+		if !ok || (now.Sub(e.firstFailed) > limits.window && now.After(e.lockedUntil)) {
+			e = &loginFailureEntry{firstFailed: now}
+			loginLimiter[key] = e
+		}
+		e.failures++
+		if e.failures >= limits.maxFailures {
+			lockout := limits.lockout
+			for i := limits.maxFailures; i < e.failures && lockout < loginMaxLockout; i++ {
+				lockout *= 2
+			}
+			if lockout > loginMaxLockout {
+				lockout = loginMaxLockout
+			}
+			e.lockedUntil = now.Add(lockout)
+		}
+	}
+}
+
+// recordLoginSuccess clears the failure counters for ip and username.
+func recordLoginSuccess(ip, username string) {
+	loginLimiterMu.Lock()
+	defer loginLimiterMu.Unlock()
+	for _, key := range loginLimiterKeys(ip, username) {
+		delete(loginLimiter, key)
+	}
+}
+
+// resetLoginLimiter clears all counters (used by tests).
+func resetLoginLimiter() {
+	loginLimiterMu.Lock()
+	loginLimiter = map[string]*loginFailureEntry{}
+	loginLimiterMu.Unlock()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFailedLoginsAreRateLimited(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+	stmts := []string{
+		`CREATE TABLE configuration (key TEXT PRIMARY KEY NOT NULL, value TEXT)`,
+		`CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT UNIQUE NOT NULL, password_hash TEXT NOT NULL DEFAULT '',
+			password_plain TEXT NOT NULL DEFAULT '', is_admin BOOLEAN NOT NULL DEFAULT 0, api_key TEXT UNIQUE)`,
+		`INSERT INTO configuration (key, value) VALUES ('login_max_failures', '3')`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+	hash, _ := hashPassword("secret")
+	if _, err := db.Exec(`INSERT INTO users (id, username, password_hash) VALUES (1, 'alice', ?)`, hash); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+
+	resetLoginLimiter()
+	defer resetLoginLimiter()
+	oldDelay := loginFailureDelay
+	loginFailureDelay = 0
+	defer func() { loginFailureDelay = oldDelay }()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/user/login", loginUser)
+	r.GET("/rest/ping.view", SubsonicAuthMiddleware(), subsonicPing)
+
+	login := func(password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"username": "alice", "password": password})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/user/login", strings.NewReader(string(body))))
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := login("wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i+1, w.Code)
+		}
+	}
+	w := login("secret")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After once locked out, got %d", w.Code)
+	}
+
+	// The lockout applies to Subsonic auth for the same user as well.
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rest/ping.view?u=alice&p=secret&f=json", nil))
+	if !strings.Contains(w.Body.String(), `"code":40`) {
+		t.Fatalf("expected Subsonic error 40 while locked out, got %s", w.Body.String())
+	}
+
+	// A successful login clears the counters.
+	resetLoginLimiter()
+	login("wrong")
+	if w := login("secret"); w.Code != http.StatusOK {
+		t.Fatalf("expected successful login after reset, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, blocked := loginBlocked("192.0.2.1", "alice"); blocked {
+		t.Fatal("successful login should clear the failure counters")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Loudness normalization for transcoded streams. Many files carry no
+// ReplayGain tags, so with normalize_loudness=true every ffmpeg transcode runs
+// through the loudnorm filter towards normalize_loudness_target LUFS
+// (default -14, the level most streaming services use).
+//
+// loudnorm is used in its single-pass, dynamic mode because the stream starts
+// before the whole file has been analysed. It adjusts gain continuously from a
+// few seconds of look-ahead, so quiet intros can be lifted and the dynamics of
+// a track slightly compressed; it is not the exact, static gain a two-pass
+// (or ReplayGain) measurement would give. Direct streams are never touched:
+// the server only normalizes audio it is re-encoding anyway.
+
+const defaultLoudnessTarget = -14.0
+
+// validateLoudnessTarget checks a normalize_loudness_target value; loudnorm
+// accepts integrated loudness targets from -70 to -5 LUFS.
+func validateLoudnessTarget(value string) error {
+	target, err := strconv.ParseFloat(value, 64)
+	if err != nil || target < -70 || target > -5 {
+		return fmt.Errorf("normalize_loudness_target must be a number between -70 and -5 (LUFS)")
+	}
+	return nil
+}
+
+// loudnessNormalizationEnabled reports whether normalize_loudness is on.
+func loudnessNormalizationEnabled() bool {
+	return configBool(db, "normalize_loudness")
+}
+
+// loudnormArgs returns the ffmpeg output options that normalize loudness, or
+// nil when normalization is off.
+func loudnormArgs() []string {
+	if !loudnessNormalizationEnabled() {
+		return nil
+	}
+	target := defaultLoudnessTarget
+	if value, err := GetConfig(db, "normalize_loudness_target"); err == nil && validateLoudnessTarget(value) == nil {
+		target, _ = strconv.ParseFloat(value, 64)
+	}
+	return []string{
+		"-af", fmt.Sprintf("loudnorm=I=%g:TP=-1.5:LRA=11", target),
+		// loudnorm resamples to 192kHz internally; bring it back to a rate
+		// every target codec supports.
+		"-ar", "48000",
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTranscodingProfileLoudnorm(t *testing.T) {
+	d := scanTestDB(t)
+
+	if args := getTranscodingProfile("mp3", 192); slices.Contains(args, "-af") {
+		t.Fatalf("loudnorm applied while disabled: %v", args)
+	}
+
+	d.Exec(`INSERT INTO configuration (key, value) VALUES ('normalize_loudness', 'true'), ('normalize_loudness_target', '-16')`)
+	args := getTranscodingProfile("opus", 128)
+	i := slices.Index(args, "-af")
+	if i < 0 || args[i+1] != "loudnorm=I=-16:TP=-1.5:LRA=11" {
+		t.Fatalf("profile = %v, want loudnorm at -16 LUFS", args)
+	}
+	if j := slices.Index(args, "-ar"); j < 0 || args[j+1] != "48000" {
+		t.Errorf("profile = %v, want output resampled to 48kHz", args)
+	}
+
+	// An out-of-range target falls back to the default.
+	d.Exec(`UPDATE configuration SET value = '3' WHERE key = 'normalize_loudness_target'`)
+	if args := strings.Join(getTranscodingProfile("mp3", 192), " "); !strings.Contains(args, "loudnorm=I=-14:") {
+		t.Errorf("profile = %s, want the -14 LUFS default", args)
+	}
+}
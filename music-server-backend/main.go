@@ -62,6 +62,9 @@ func subsonicCompatibilityHandler(router gin.IRouter, method string, path string
 	case "GET":
 		router.GET(path+".view", handler)
 		router.GET(path, handler) // Also register without .view
+		// OpenSubsonic formPost: every read endpoint must also accept POST
+		router.POST(path+".view", handler)
+		router.POST(path, handler)
 	case "POST":
 		router.POST(path+".view", handler)
 		router.POST(path, handler)
@@ -93,7 +96,7 @@ func main() {
 	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
 		log.Fatalf("Failed to create database directory '%s': %v", filepath.Dir(dbPath), err)
 	}
-	db, err = sql.Open("sqlite3", dbPath+"?_journal_mode=WAL")
+	db, err = sql.Open(dbDriverName(), dbPath+"?_journal_mode=WAL")
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -136,19 +139,32 @@ func main() {
 	if err := migrateDB(); err != nil {
 		log.Printf("Database migration warnings/errors: %v", err)
 	}
+	// Reset before any job can start a scan
+	if err := resetStaleScanStatus(); err != nil {
+		log.Fatalf("Failed to reset scan status on startup: %v", err)
+	}
+	startScanWatchdog()
 	startScheduler()
+	ReloadLibraryWatcher() // near-real-time indexing when watch_library is on
+	startSilenceAnalyzer() // lead-in/lead-out silence when analyze_silence is on
+	initHLSTempDir(dbPath)
 	StartSessionCleanup() // Start HLS session cleanup
 
 	// Start periodic DB maintenance (checkpoint, integrity checks, optional backups)
 	startDBMaintenance(db, dbPath)
 
-	if _, err := db.Exec("UPDATE scan_status SET is_scanning = 0 WHERE id = 1"); err != nil {
-		log.Fatalf("Failed to reset scan status on startup: %v", err)
-	}
-
 	r := gin.New()
+	if err := configureTrustedProxies(r); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 	r.Use(gin.Recovery())
+	if metricsEnabled() {
+		r.Use(metricsMiddleware())
+		r.GET("/metrics", prometheusMetricsHandler)
+	}
 	r.Use(corsMiddleware())
+	r.Use(bodyLimitMiddleware())
+	r.Use(subsonicFormPostMiddleware())
 	r.Use(loggingMiddleware())
 
 	// Public Subsonic routes (no auth required) - register both with and without .view
@@ -184,9 +200,11 @@ func main() {
 		subsonicCompatibilityHandler(subsonic, "GET", "/search2", subsonicSearch2)
 		subsonicCompatibilityHandler(subsonic, "GET", "/search3", subsonicSearch3)
 		subsonicCompatibilityHandler(subsonic, "GET", "/getSong", subsonicGetSong)
+		subsonicCompatibilityHandler(subsonic, "GET", "/getSongs", subsonicGetSongs)
 		subsonicCompatibilityHandler(subsonic, "GET", "/getRandomSongs", subsonicGetRandomSongs)
 		subsonicCompatibilityHandler(subsonic, "GET", "/getSongsByGenre", subsonicGetSongsByGenre)
 		subsonicCompatibilityHandler(subsonic, "GET", "/getCoverArt", subsonicGetCoverArt)
+		subsonicCompatibilityHandler(subsonic, "GET", "/getAvatar", subsonicGetAvatar)
 
 		// Media info endpoints
 		subsonicCompatibilityHandler(subsonic, "GET", "/getTopSongs", subsonicGetTopSongs)
@@ -196,11 +214,29 @@ func main() {
 		subsonicCompatibilityHandler(subsonic, "GET", "/getArtistInfo2", subsonicGetArtistInfo2)
 		subsonicCompatibilityHandler(subsonic, "GET", "/getNowPlaying", subsonicGetNowPlaying)
 		subsonicCompatibilityHandler(subsonic, "GET", "/getBookmarks", subsonicGetBookmarks)
+		subsonicCompatibilityHandler(subsonic, "ANY", "/createBookmark", subsonicCreateBookmark)
+		subsonicCompatibilityHandler(subsonic, "ANY", "/deleteBookmark", subsonicDeleteBookmark)
+		subsonicCompatibilityHandler(subsonic, "ANY", "/savePlayQueue", subsonicSavePlayQueue)
+		subsonicCompatibilityHandler(subsonic, "GET", "/getPlayQueue", subsonicGetPlayQueue)
 		subsonicCompatibilityHandler(subsonic, "GET", "/getVideos", subsonicGetVideos)
 		subsonicCompatibilityHandler(subsonic, "GET", "/getAlbumInfo", subsonicGetAlbumInfo)
 		subsonicCompatibilityHandler(subsonic, "GET", "/getAlbumInfo2", subsonicGetAlbumInfo)
 		subsonicCompatibilityHandler(subsonic, "GET", "/download", subsonicDownload)
 
+		// Public sharing
+		subsonicCompatibilityHandler(subsonic, "ANY", "/createShare", subsonicCreateShare)
+		subsonicCompatibilityHandler(subsonic, "GET", "/getShares", subsonicGetShares)
+		subsonicCompatibilityHandler(subsonic, "ANY", "/deleteShare", subsonicDeleteShare)
+
+		// Internet radio
+		subsonicCompatibilityHandler(subsonic, "GET", "/getInternetRadioStations", subsonicGetInternetRadioStations)
+		subsonicCompatibilityHandler(subsonic, "ANY", "/createInternetRadioStation", subsonicCreateInternetRadioStation)
+		subsonicCompatibilityHandler(subsonic, "ANY", "/updateInternetRadioStation", subsonicUpdateInternetRadioStation)
+		subsonicCompatibilityHandler(subsonic, "ANY", "/deleteInternetRadioStation", subsonicDeleteInternetRadioStation)
+
+		// Server-side playback
+		subsonicCompatibilityHandler(subsonic, "ANY", "/jukeboxControl", subsonicJukeboxControl)
+
 		subsonicCompatibilityHandler(subsonic, "ANY", "/startScan", subsonicStartScan)
 		subsonicCompatibilityHandler(subsonic, "GET", "/getScanStatus", subsonicGetScanStatus)
 		subsonicCompatibilityHandler(subsonic, "GET", "/getLibraryPaths", subsonicGetLibraryPaths)
@@ -223,11 +259,13 @@ func main() {
 		subsonicCompatibilityHandler(subsonic, "GET", "/unstar", subsonicUnstar)
 		subsonicCompatibilityHandler(subsonic, "GET", "/getStarred", subsonicGetStarred)
 		subsonicCompatibilityHandler(subsonic, "GET", "/getStarred2", subsonicGetStarred2)
+		subsonicCompatibilityHandler(subsonic, "GET", "/setRating", subsonicSetRating)
 		subsonicCompatibilityHandler(subsonic, "GET", "/getGenres", subsonicGetGenres)
 
 		// API Key Management
 		subsonicCompatibilityHandler(subsonic, "GET", "/getApiKey", subsonicGetApiKey)
 		subsonicCompatibilityHandler(subsonic, "POST", "/revokeApiKey", subsonicRevokeApiKey)
+		subsonicCompatibilityHandler(subsonic, "GET", "/getTokenInfo", subsonicGetTokenInfo)
 
 		// AudioMuse-AI Subsonic routes
 		subsonicCompatibilityHandler(subsonic, "ANY", "/startSonicAnalysis", subsonicStartSonicAnalysis)
@@ -242,11 +280,24 @@ func main() {
 		userRoutes := v1.Group("/user")
 		{
 			userRoutes.POST("/login", loginUser)
+			userRoutes.POST("/refresh", AuthMiddleware(), refreshToken)
+			userRoutes.POST("/logout", AuthMiddleware(), logoutUser)
 			// Return info about the logged-in user (JWT required)
 			userRoutes.GET("/me", AuthMiddleware(), userInfo)
 			// User transcoding settings
 			userRoutes.GET("/settings/transcoding", AuthMiddleware(), getUserTranscodingSettings)
 			userRoutes.POST("/settings/transcoding", AuthMiddleware(), updateUserTranscodingSettings)
+			userRoutes.GET("/transcoding", AuthMiddleware(), getUserTranscodingSettings)
+			userRoutes.PUT("/transcoding", AuthMiddleware(), updateUserTranscodingSettings)
+			// Last.fm account linking and scrobble passthrough
+			userRoutes.GET("/settings/lastfm", AuthMiddleware(), getUserLastFmSettings)
+			userRoutes.POST("/settings/lastfm", AuthMiddleware(), updateUserLastFmSettings)
+			userRoutes.DELETE("/settings/lastfm", AuthMiddleware(), unlinkLastFm)
+			userRoutes.POST("/settings/lastfm/token", AuthMiddleware(), startLastFmAuth)
+			userRoutes.POST("/settings/lastfm/session", AuthMiddleware(), linkLastFmSession)
+			// Avatar shown by getAvatar (an identicon when none is uploaded)
+			userRoutes.POST("/avatar", AuthMiddleware(), uploadAvatar)
+			userRoutes.DELETE("/avatar", AuthMiddleware(), deleteAvatar)
 		}
 		adminRoutes := v1.Group("/admin")
 		adminRoutes.Use(AuthMiddleware(), adminOnly())
@@ -254,13 +305,44 @@ func main() {
 			adminRoutes.GET("/browse", browseFiles)
 			adminRoutes.POST("/scan/cancel", cancelAdminScan)
 			adminRoutes.POST("/scan/rescan", rescanAllLibraries)
+			adminRoutes.POST("/scan/path/:id", rescanLibraryPath)
+			adminRoutes.GET("/duplicates", getDuplicates)
+			adminRoutes.POST("/duplicates/resolve", resolveDuplicates)
+			adminRoutes.GET("/scan-errors", getScanErrors)
+			adminRoutes.GET("/cancelled", getCancelledSongs)
+			adminRoutes.DELETE("/cancelled", purgeCancelledSongs)
+			adminRoutes.POST("/cancelled/:id/restore", restoreCancelledSong)
+			adminRoutes.DELETE("/cancelled/:id", purgeCancelledSong)
+			adminRoutes.POST("/play-history/prune", prunePlayHistoryHandler)
+			adminRoutes.GET("/export", exportLibraryCatalog)
+			adminRoutes.POST("/import", importLibraryCatalog)
+			adminRoutes.GET("/metrics", getServerMetrics)
+			adminRoutes.POST("/rename", renameLibraryEntity)
+			adminRoutes.POST("/analyze", analyzeScoped)
 		}
 		// Discovery views (authenticated)
 		v1.GET("/counts", AuthMiddleware(), getMusicCounts)
+		v1.GET("/stats", AuthMiddleware(), getLibraryStats)
+		v1.GET("/search", AuthMiddleware(), searchLibrary)
+		v1.GET("/download/album/:id", AuthMiddleware(), downloadRoleRequired(), downloadAlbumZip)
+		v1.GET("/download/playlist/:id", AuthMiddleware(), downloadRoleRequired(), downloadPlaylistZip)
+		v1.POST("/playlists/import", AuthMiddleware(), importPlaylist)
+		v1.GET("/playlist/:id/export", AuthMiddleware(), exportPlaylist)
+		v1.POST("/playlist/:id/dedupe", AuthMiddleware(), dedupePlaylist)
+		v1.GET("/smart-playlists", AuthMiddleware(), getSmartPlaylistsHandler)
+		v1.POST("/smart-playlists", AuthMiddleware(), createSmartPlaylistHandler)
+		v1.PUT("/smart-playlists/:id", AuthMiddleware(), updateSmartPlaylistHandler)
+		v1.DELETE("/smart-playlists/:id", AuthMiddleware(), deleteSmartPlaylistHandler)
 		v1.GET("/recently-added", AuthMiddleware(), getRecentlyAdded)
+		v1.GET("/albums/recent", AuthMiddleware(), getRecentAlbums)
 		v1.GET("/most-played", AuthMiddleware(), getMostPlayed)
 		v1.GET("/recently-played", AuthMiddleware(), getRecentlyPlayed)
 		v1.GET("/debug/songs", AuthMiddleware(), debugSongsHandler)
+		v1.GET("/song/:id/stream-url", AuthMiddleware(), getSignedStreamURL)
+		v1.GET("/album/:id/manifest", AuthMiddleware(), getAlbumManifest)
+		v1.GET("/artist/:id/summary", AuthMiddleware(), getArtistSummary)
+		v1.GET("/song/:id/gaps", AuthMiddleware(), getSongGaps)
+		v1.POST("/songs/by-path", AuthMiddleware(), songsByPathHandler)
 	}
 
 	// Admin-protected cleaning endpoint that proxies to AudioMuse-AI
@@ -289,6 +371,17 @@ func main() {
 	// Semantic search endpoints (authenticated)
 	r.POST("/api/semantic-search", AuthMiddleware(), semanticSearchHandler)
 
+	// Public share links (unauthenticated; gated by the enable_shares config key)
+	r.GET("/share/:id", publicShareHandler)
+	r.GET("/share/:id/stream/:songId", publicShareStreamHandler)
+
+	// Time-limited signed stream URLs (unauthenticated; see signed_stream.go)
+	r.GET("/stream/signed", signedStreamHandler)
+
+	// Liveness and readiness probes (unauthenticated; see health.go)
+	r.GET("/healthz", healthzHandler)
+	r.GET("/readyz", readyzHandler)
+
 	// Serve static files from React build
 	buildDir := getEnv("FRONTEND_BUILD_DIR", "/app/music-server-frontend/build")
 	// If the absolute path used in containers doesn't exist locally, try
@@ -431,6 +524,7 @@ func main() {
 	srv := &http.Server{
 		Addr:              ":8080",
 		Handler:           h2c.NewHandler(r, h2s), // Wrap handler with h2c for HTTP/2 without TLS
+		BaseContext:       appBaseContext,         // Cancelled on shutdown
 		ReadTimeout:       30 * time.Second,
 		WriteTimeout:      30 * time.Second,
 		ReadHeaderTimeout: 10 * time.Second,
@@ -442,32 +536,11 @@ func main() {
 	log.Println("[HTTP/2] h2c (HTTP/2 Cleartext) enabled - multiplexing active for parallel cover art requests")
 	log.Println("[HTTP/2] Multiple cover art images can now be downloaded simultaneously over a single connection")
 
-	// Setup graceful shutdown on SIGINT/SIGTERM
+	// Setup graceful shutdown on SIGINT/SIGTERM; see shutdown.go
 	stopSig := make(chan os.Signal, 1)
 	signal.Notify(stopSig, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
-		sig := <-stopSig
-		log.Printf("Signal %s received, initiating graceful shutdown...", sig)
-		isScanCancelled.Store(true)
-		if scheduler != nil {
-			scheduler.Stop()
-		}
-		// Give background tasks a short grace period to stop
-		grace := 30 * time.Second
-		log.Printf("Waiting up to %s for background tasks to stop...", grace)
-		time.Sleep(grace)
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		if err := srv.Shutdown(ctx); err != nil {
-			log.Printf("HTTP server shutdown error: %v", err)
-		}
-		// Final DB checkpoint and close
-		if _, err := db.Exec("PRAGMA wal_checkpoint(FULL)"); err != nil {
-			log.Printf("Final WAL checkpoint failed: %v", err)
-		}
-		if err := db.Close(); err != nil {
-			log.Printf("Error closing DB: %v", err)
-		}
+		shutdown(srv, <-stopSig)
 		os.Exit(0)
 	}()
 
@@ -488,26 +561,82 @@ func adminOnly() gin.HandlerFunc {
 	}
 }
 
-// corsMiddleware sets permissive CORS headers so browser-based frontends
-// can call both the /rest (Subsonic) endpoints and the JSON /api/v1 endpoints.
-// For production you may want to restrict the allowed origin via an env var.
+// corsMiddleware sets CORS headers so browser-based frontends can call both
+// the /rest (Subsonic) endpoints and the JSON /api/v1 endpoints.
+//
+// ALLOWED_ORIGIN is a comma-separated list of origins (scheme://host[:port]).
+// The default "*" lets any origin in without credentials, which is enough for
+// clients that send a token or Subsonic credentials themselves. With a
+// concrete list, a matching Origin is echoed back together with
+// Access-Control-Allow-Credentials, other origins get no CORS headers, and
+// their preflight requests are refused with 403.
 func corsMiddleware() gin.HandlerFunc {
+	allowAny, allowed := parseAllowedOrigins(getEnv("ALLOWED_ORIGIN", "*"))
 	return func(c *gin.Context) {
-		// Allow all origins by default. For stricter security set ALLOWED_ORIGIN env var.
-		allowed := getEnv("ALLOWED_ORIGIN", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Origin", allowed)
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, Cache-Control, Pragma")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		origin := c.Request.Header.Get("Origin")
+		h := c.Writer.Header()
+		h.Add("Vary", "Origin")
+
+		originAllowed := allowAny || allowed[strings.ToLower(origin)]
+		if origin != "" && originAllowed {
+			if allowAny {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			h.Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, Cache-Control, Pragma")
+			h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		}
 
 		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+			if origin != "" && !originAllowed {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
+
+// bodyLimitMiddleware caps request bodies at MAX_REQUEST_BODY_MB (default
+// 10). Requests announcing a larger body are refused with 413 up front; for
+// the rest, reading past the limit fails inside the handler.
+func bodyLimitMiddleware() gin.HandlerFunc {
+	limitMB, err := strconv.ParseInt(getEnv("MAX_REQUEST_BODY_MB", "10"), 10, 64)
+	if err != nil || limitMB <= 0 {
+		limitMB = 10
+	}
+	limit := limitMB << 20
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Request body exceeds %d MB", limitMB)})
 			return
 		}
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
 		c.Next()
 	}
 }
 
+// parseAllowedOrigins splits an ALLOWED_ORIGIN value into a lower-cased set.
+// allowAny is true when the list contains "*" (or is empty).
+func parseAllowedOrigins(value string) (allowAny bool, allowed map[string]bool) {
+	allowed = map[string]bool{}
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+		if origin == "*" {
+			allowAny = true
+		} else if origin != "" {
+			allowed[origin] = true
+		}
+	}
+	return allowAny || len(allowed) == 0, allowed
+}
+
 // startDBMaintenance runs periodic WAL checkpoint and integrity checks and optionally writes backups.
 // Config via env: DB_MAINTENANCE_INTERVAL_MIN (default 10), DB_BACKUP_DIR (optional)
 func startDBMaintenance(db *sql.DB, dbPath string) {
@@ -522,6 +651,7 @@ func startDBMaintenance(db *sql.DB, dbPath string) {
 	ticker := time.NewTicker(time.Duration(intervalMin) * time.Minute)
 	go func() {
 		for range ticker.C {
+			cleanupRevokedTokens(db)
 			log.Println("DB maintenance: running WAL checkpoint and integrity_check")
 			if _, err := db.Exec("PRAGMA wal_checkpoint(FULL)"); err != nil {
 				log.Printf("WAL checkpoint failed: %v", err)
@@ -673,7 +803,7 @@ func checkAndRestoreDB(dbPath string) error {
 	if db != nil {
 		_ = db.Close()
 	}
-	newDB, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL")
+	newDB, err := sql.Open(dbDriverName(), dbPath+"?_journal_mode=WAL")
 	if err != nil {
 		return fmt.Errorf("failed to reopen DB after restore: %v", err)
 	}
@@ -741,7 +871,12 @@ func initDB() {
 		password_hash TEXT NOT NULL,
 		password_plain TEXT NOT NULL,
 		is_admin BOOLEAN NOT NULL DEFAULT 0,
-		api_key TEXT UNIQUE
+		api_key TEXT UNIQUE,
+		download_role INTEGER NOT NULL DEFAULT 1,
+		playlist_role INTEGER NOT NULL DEFAULT 1,
+		settings_role INTEGER NOT NULL DEFAULT 1,
+		scan_role INTEGER NOT NULL DEFAULT 0,
+		jukebox_role INTEGER NOT NULL DEFAULT 0
 	);`)
 	if err != nil {
 		log.Fatalf("Failed to create/update users table: %v", err)
@@ -754,7 +889,9 @@ func initDB() {
 		id INTEGER PRIMARY KEY CHECK (id = 1),
 		is_scanning BOOLEAN NOT NULL DEFAULT 0,
 		songs_added INTEGER NOT NULL DEFAULT 0,
-		last_update_time TEXT
+		last_update_time TEXT,
+		stalled_at TEXT,
+		scan_generation INTEGER NOT NULL DEFAULT 0
 	);`)
 	if err != nil {
 		log.Fatalf("Failed to create scan_status table: %v", err)
@@ -791,7 +928,11 @@ func initDB() {
 		channels INTEGER DEFAULT 0,
 		bit_depth INTEGER DEFAULT 0,
 		comment TEXT DEFAULT '',
-		cancelled INTEGER NOT NULL DEFAULT 0
+		search_text TEXT NOT NULL DEFAULT '',
+		external_id TEXT NOT NULL DEFAULT '',
+		cancelled INTEGER NOT NULL DEFAULT 0,
+		cancelled_at TEXT,
+		cancel_reason TEXT NOT NULL DEFAULT ''
 	);`)
 	if err != nil {
 		log.Fatalf("Failed to create songs table: %v", err)
@@ -891,6 +1032,7 @@ func initDB() {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		name TEXT NOT NULL,
 		user_id INTEGER,
+		public INTEGER DEFAULT 0,
 		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
 	);`)
 	if err != nil {
@@ -931,7 +1073,8 @@ func initDB() {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		path TEXT UNIQUE NOT NULL,
 		song_count INTEGER NOT NULL DEFAULT 0,
-		last_scan_ended TEXT
+		last_scan_ended TEXT,
+		scan_schedule TEXT
 	);`)
 	if err != nil {
 		log.Fatalf("Failed to create library_paths table: %v", err)
@@ -991,7 +1134,12 @@ func initDB() {
 	row := db.QueryRow("SELECT COUNT(*) FROM users")
 	if err := row.Scan(&userCount); err == nil && userCount == 0 {
 		hashedPassword, _ := hashPassword("admin")
-		_, err := db.Exec("INSERT INTO users (username, password_hash, password_plain, is_admin) VALUES (?, ?, ?, ?)", "admin", hashedPassword, "admin", true)
+		// Stored like any other password: encrypted, or blank when
+		// disable_plaintext_passwords is set.
+		storedPlain, err := storedPlainPassword("admin")
+		if err == nil {
+			_, err = db.Exec("INSERT INTO users (username, password_hash, password_plain, is_admin) VALUES (?, ?, ?, ?)", "admin", hashedPassword, storedPlain, true)
+		}
 		if err != nil {
 			log.Println("Could not create default admin user:", err)
 		} else {
@@ -1000,18 +1148,23 @@ func initDB() {
 	}
 }
 
+// startScheduler registers the scan, analysis and clustering jobs at boot.
 func startScheduler() {
-	scheduler = cron.New()
-	var schedule, enabledStr string
+	if err := ReloadScheduler(); err != nil {
+		log.Printf("Error starting scheduler, scheduled jobs are disabled: %v", err)
+	}
+}
+
+// buildScheduler reads the scan, analysis and clustering schedules and enabled
+// flags and returns an unstarted cron.Cron with their jobs registered.
+func buildScheduler() (*cron.Cron, error) {
+	c := cron.New()
+	var enabledStr string
 	var isEnabled bool
 
-	err := db.QueryRow("SELECT value FROM configuration WHERE key = 'scan_schedule'").Scan(&schedule)
-	if err != nil {
-		log.Printf("Could not read scan_schedule from config, using default. Error: %v", err)
-		schedule = "0 2 * * *" // Default: 2 AM daily
-	}
+	schedule := configuredSchedule(db, "scan_schedule", "0 2 * * *") // Default: 2 AM daily
 
-	err = db.QueryRow("SELECT value FROM configuration WHERE key = 'scan_enabled'").Scan(&enabledStr)
+	err := db.QueryRow("SELECT value FROM configuration WHERE key = 'scan_enabled'").Scan(&enabledStr)
 	if err != nil {
 		log.Printf("Could not read scan_enabled from config, defaulting to true. Error: %v", err)
 		isEnabled = true
@@ -1020,47 +1173,26 @@ func startScheduler() {
 	}
 
 	if isEnabled {
-		_, err := scheduler.AddFunc(schedule, func() {
-			log.Println("Cron job triggered: starting scheduled scan of all libraries.")
-			var isScanning bool
-			db.QueryRow("SELECT is_scanning FROM scan_status WHERE id = 1").Scan(&isScanning)
-			if !isScanning {
-				// Perform pre-scan backup synchronously; skip scan on failure
-				dbPath := getEnv("DATABASE_PATH", "/config/music.db")
-				if err := performBackup(db, dbPath); err != nil {
-					log.Printf("Scheduled pre-scan backup failed: %v - skipping scheduled scan", err)
-					return
-				}
-				db.Exec("UPDATE scan_status SET is_scanning = 1, songs_added = 0, last_update_time = ? WHERE id = 1", time.Now().Format(time.RFC3339))
-				scanAllLibraries()
-			} else {
-				log.Println("Scheduled scan skipped: a scan is already in progress.")
-			}
-		})
-		if err != nil {
-			log.Fatalf("Error scheduling library scan cron job: %v", err)
+		// One job per library scan schedule; see addLibraryScanJobs.
+		if err := addLibraryScanJobs(c, schedule); err != nil {
+			return nil, fmt.Errorf("scheduling library scan cron job: %w", err)
 		}
-		scheduler.Start()
-		log.Printf("Scheduled library scan started with schedule: '%s'", schedule)
+		log.Printf("Scheduled library scan started with global schedule: '%s'", schedule)
 	} else {
 		log.Println("Scheduled library scan is disabled.")
 	}
 
 	// Schedule Analysis and Clustering if configured
 	// Analysis: read analysis_schedule and analysis_enabled
-	var analysisSchedule string
 	var analysisEnabledStr string
-	if err := db.QueryRow("SELECT value FROM configuration WHERE key = 'analysis_schedule'").Scan(&analysisSchedule); err != nil {
-		log.Printf("Analysis schedule not set in configuration, using default")
-		analysisSchedule = "0 2 * * 0-5" // default: nightly at 2:00 except Saturday
-	}
+	analysisSchedule := configuredSchedule(db, "analysis_schedule", "0 2 * * 0-5") // default: nightly at 2:00 except Saturday
 	if err := db.QueryRow("SELECT value FROM configuration WHERE key = 'analysis_enabled'").Scan(&analysisEnabledStr); err != nil {
 		analysisEnabledStr = "false"
 	}
 	analysisEnabled := (analysisEnabledStr == "true")
 
 	if analysisEnabled {
-		_, err := scheduler.AddFunc(analysisSchedule, func() {
+		_, err := c.AddFunc(analysisSchedule, func() {
 			if isAnalysisRunning.Load() {
 				log.Println("Scheduled analysis skipped: analysis already running")
 				return
@@ -1076,7 +1208,7 @@ func startScheduler() {
 			}()
 		})
 		if err != nil {
-			log.Fatalf("Error scheduling analysis cron job: %v", err)
+			return nil, fmt.Errorf("scheduling analysis cron job: %w", err)
 		}
 		log.Printf("Scheduled analysis started with schedule: '%s'", analysisSchedule)
 	} else {
@@ -1084,19 +1216,15 @@ func startScheduler() {
 	}
 
 	// Clustering: read clustering_schedule and clustering_enabled
-	var clusteringSchedule string
 	var clusteringEnabledStr string
-	if err := db.QueryRow("SELECT value FROM configuration WHERE key = 'clustering_schedule'").Scan(&clusteringSchedule); err != nil {
-		log.Printf("Clustering schedule not set in configuration, using default")
-		clusteringSchedule = "0 2 * * 6" // default: Saturday at 2:00
-	}
+	clusteringSchedule := configuredSchedule(db, "clustering_schedule", "0 2 * * 6") // default: Saturday at 2:00
 	if err := db.QueryRow("SELECT value FROM configuration WHERE key = 'clustering_enabled'").Scan(&clusteringEnabledStr); err != nil {
 		clusteringEnabledStr = "false"
 	}
 	clusteringEnabled := (clusteringEnabledStr == "true")
 
 	if clusteringEnabled {
-		_, err := scheduler.AddFunc(clusteringSchedule, func() {
+		_, err := c.AddFunc(clusteringSchedule, func() {
 			if isClusteringRunning.Load() {
 				log.Println("Scheduled clustering skipped: clustering already running")
 				return
@@ -1112,10 +1240,19 @@ func startScheduler() {
 			}()
 		})
 		if err != nil {
-			log.Fatalf("Error scheduling clustering cron job: %v", err)
+			return nil, fmt.Errorf("scheduling clustering cron job: %w", err)
 		}
 		log.Printf("Scheduled clustering started with schedule: '%s'", clusteringSchedule)
 	} else {
 		log.Println("Scheduled clustering is disabled.")
 	}
+
+	// Play history cleanup, when play_history_retention_days is set
+	if playHistoryRetentionDays() > 0 {
+		if _, err := c.AddFunc(playHistoryPruneSchedule, runPlayHistoryRetention); err != nil {
+			return nil, fmt.Errorf("scheduling play history cleanup cron job: %w", err)
+		}
+		log.Printf("Scheduled play history cleanup with schedule: '%s'", playHistoryPruneSchedule)
+	}
+	return c, nil
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	t.Setenv("MAX_REQUEST_BODY_MB", "1")
+	r := gin.New()
+	r.Use(bodyLimitMiddleware())
+	r.POST("/echo", func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.String(http.StatusOK, "%d", len(body))
+	})
+
+	post := func(size int, chunked bool) int {
+		req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(strings.Repeat("x", size)))
+		if chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := post(1<<20, false); code != http.StatusOK {
+		t.Errorf("body at the limit: %d, want 200", code)
+	}
+	if code := post(1<<20+1, false); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: %d, want 413", code)
+	}
+	if code := post(1<<20+1, true); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body without Content-Length: %d, want 413", code)
+	}
+}
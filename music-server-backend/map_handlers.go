@@ -1,13 +1,107 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// The map payload covers the whole analyzed library (7000+ items on a large
+// one) and is expensive for the core to build, so it is cached per percent
+// for map_cache_seconds (0 disables the cache). The browser still gets
+// no-cache headers: the copy kept here is the only one.
+
+const (
+	defaultMapPercent  = 25
+	defaultMapCacheTTL = 60
+)
+
+type mapCacheEntry struct {
+	mu        sync.Mutex
+	fetchedAt time.Time
+	body      []byte
+}
+
+var mapCache = struct {
+	sync.Mutex
+	entries map[int]*mapCacheEntry
+}{entries: map[int]*mapCacheEntry{}}
+
+// invalidateMapCache drops every cached map.
+func invalidateMapCache() {
+	mapCache.Lock()
+	mapCache.entries = map[int]*mapCacheEntry{}
+	mapCache.Unlock()
+}
+
+func mapCacheEntryFor(percent int) *mapCacheEntry {
+	mapCache.Lock()
+	defer mapCache.Unlock()
+	e := mapCache.entries[percent]
+	if e == nil {
+		e = &mapCacheEntry{}
+		mapCache.entries[percent] = e
+	}
+	return e
+}
+
+// parseMapPercent reads the percent parameter: the share of the library the
+// map shows, clamped to 1..100 and defaulting to 25.
+func parseMapPercent(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultMapPercent, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, fmt.Errorf("percent must be a number between 1 and 100")
+	}
+	return int(math.Round(math.Min(math.Max(f, 1), 100))), nil
+}
+
+// normalizeMapBody makes sure the map is a JSON object whose items is an
+// array, so clients never have to cope with a null or missing list, and
+// reconciles the items' ids with the current songs (see song_id_reconcile.go).
+// unmatched counts the items dropped because they match no song.
+func normalizeMapBody(body []byte, r *songIDResolver) ([]byte, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = map[string]json.RawMessage{}
+	}
+	var items []map[string]interface{}
+	if raw := bytes.TrimSpace(m["items"]); len(raw) > 0 && raw[0] == '[' {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&items); err != nil {
+			return nil, err
+		}
+	}
+	items, unmatched := reconcileMapItems(r, items)
+	if unmatched > 0 {
+		log.Printf("Map: %d item(s) from AudioMuse-AI match no current song and were left out", unmatched)
+	}
+	var err error
+	if m["items"], err = json.Marshal(items); err != nil {
+		return nil, err
+	}
+	m["unmatched"] = json.RawMessage(strconv.Itoa(unmatched))
+	return json.Marshal(m)
+}
+
 // MapHandler proxies GET /api/map to the configured AudioMuse-AI core /api/map
 func MapHandler(c *gin.Context) {
 	// Ensure the user is authenticated (AuthMiddleware will have run)
@@ -15,8 +109,33 @@ func MapHandler(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
+	percent, err := parseMapPercent(c.Query("percent"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Set explicit no-cache headers so browsers always come back here
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("Expires", "0")
+
+	ttl := time.Duration(configInt(db, "map_cache_seconds", defaultMapCacheTTL)) * time.Second
+	entry := mapCacheEntryFor(percent)
+	// Holding the entry lock while fetching makes concurrent loads of the same
+	// map wait for one core request instead of each sending their own.
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if ttl > 0 && entry.body != nil && time.Since(entry.fetchedAt) < ttl {
+		c.Header("X-Cache", "HIT")
+		c.Data(http.StatusOK, "application/json", entry.body)
+		return
+	}
 
-	body, statusCode, err := audioMuseClient.GetMap(c.Request.Context(), c.Request.URL.Query())
+	// Only percent is forwarded; the frontend's cache-busting parameters
+	// would otherwise make every request unique to the core as well.
+	params := url.Values{"percent": []string{strconv.Itoa(percent)}}
+	body, statusCode, err := audioMuseClient.GetMap(c.Request.Context(), params)
 	if err == ErrAudioMuse401 {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "AudioMuse-AI authentication failed. Please configure API token in Admin settings."})
 		return
@@ -26,14 +145,29 @@ func MapHandler(c *gin.Context) {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to contact AudioMuse-AI Core"})
 		return
 	}
+	if statusCode != http.StatusOK {
+		c.Data(statusCode, "application/json", body)
+		return
+	}
+	resolver, err := loadSongIDResolver(db)
+	if err != nil {
+		log.Printf("Error loading songs for map reconciliation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	body, err = normalizeMapBody(body, resolver)
+	if err != nil {
+		log.Printf("AudioMuse-AI /api/map returned invalid JSON: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Invalid map data from AudioMuse-AI Core"})
+		return
+	}
 
-	// Set explicit no-cache headers to prevent ANY caching
-	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
-	c.Header("Pragma", "no-cache")
-	c.Header("Expires", "0")
-
-	// Return the response directly without caching
-	c.Data(statusCode, "application/json", body)
+	if ttl > 0 {
+		entry.body = body
+		entry.fetchedAt = time.Now()
+	}
+	c.Header("X-Cache", "MISS")
+	c.Data(http.StatusOK, "application/json", body)
 }
 
 // VoyagerSearchTracksHandler proxies search requests for the map UI's autocomplete
@@ -77,6 +211,22 @@ func MapCreatePlaylistHandler(c *gin.Context) {
 		return
 	}
 
+	// Map selections carry the core's item ids; keep the ones that still
+	// resolve to a song rather than failing the whole selection.
+	songIDs, unmatched, err := reconcileSongIDs(db, payload.ItemIDs)
+	if err != nil {
+		log.Printf("Error reconciling map selection: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if len(songIDs) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No valid songs found", "matched": 0, "unmatched": len(unmatched)})
+		return
+	}
+	if len(unmatched) > 0 {
+		log.Printf("Map playlist %q: %d of %d item(s) match no current song", payload.Name, len(unmatched), len(payload.ItemIDs))
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -98,7 +248,7 @@ func MapCreatePlaylistHandler(c *gin.Context) {
 	}
 	defer stmt.Close()
 
-	for i, sid := range payload.ItemIDs {
+	for i, sid := range songIDs {
 		if _, err := stmt.Exec(newID, sid, i); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add song to playlist"})
 			return
@@ -110,7 +260,7 @@ func MapCreatePlaylistHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "ok", "playlist_id": newID})
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "playlist_id": newID, "matched": len(songIDs), "unmatched": len(unmatched), "unmatched_ids": unmatched})
 }
 
 // getUserFromContext attempts to build a User from the Gin context.
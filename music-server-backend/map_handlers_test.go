@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseMapPercent(t *testing.T) {
+	for in, want := range map[string]int{"": 25, "50": 50, "0": 1, "-3": 1, "250": 100, "33.6": 34} {
+		if got, err := parseMapPercent(in); err != nil || got != want {
+			t.Errorf("parseMapPercent(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := parseMapPercent("lots"); err == nil {
+		t.Error("a non-numeric percent should be rejected")
+	}
+}
+
+func TestMapHandlerCachesPerPercent(t *testing.T) {
+	d := scanTestDB(t)
+	var queries []string
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items":null,"projection":"umap"}`))
+	}))
+	defer core.Close()
+	t.Setenv("AUDIOMUSE_AI_CORE_URL", core.URL)
+	prevClient := audioMuseClient
+	audioMuseClient = NewAudioMuseClient(d)
+	t.Cleanup(func() { audioMuseClient = prevClient })
+	invalidateMapCache()
+	t.Cleanup(invalidateMapCache)
+
+	r := gin.New()
+	r.GET("/api/map", func(c *gin.Context) { c.Set("user", User{ID: 1, Username: "test"}) }, MapHandler)
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/map?"+query, nil))
+		return w
+	}
+
+	w := get("percent=50&_t=1")
+	if w.Code != http.StatusOK || w.Header().Get("X-Cache") != "MISS" || w.Body.String() != `{"items":[],"projection":"umap","unmatched":0}` {
+		t.Fatalf("first load = %d %s %s", w.Code, w.Header().Get("X-Cache"), w.Body)
+	}
+	if w := get("percent=50&_t=2&_r=x"); w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("second load should be served from the cache, got %s", w.Header().Get("X-Cache"))
+	}
+	get("percent=500")
+	if len(queries) != 2 || queries[0] != "percent=50" || queries[1] != "percent=100" {
+		t.Errorf("core queries = %v, want one per clamped percent without cache busters", queries)
+	}
+	if w := get("percent=abc"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid percent = %d, want 400", w.Code)
+	}
+
+	if _, err := d.Exec(`INSERT INTO configuration (key, value) VALUES ('map_cache_seconds', '0')`); err != nil {
+		t.Fatal(err)
+	}
+	get("percent=50")
+	if len(queries) != 3 {
+		t.Errorf("map_cache_seconds=0 should disable the cache; core queries = %v", queries)
+	}
+}
+
+func TestMapReconcilesCoreItemIDs(t *testing.T) {
+	d := setupPlaylistTestDB(t)
+	prevDB := db
+	db = d
+	t.Cleanup(func() { db = prevDB; d.Close() })
+	for _, s := range [][]string{
+		{"kept", "Same Id", "Band"},
+		{"newid", "Renamed Id", "Band"},
+		{"dup1", "Twice", "Band"},
+		{"dup2", "Twice", "Band"},
+	} {
+		if _, err := d.Exec(`INSERT INTO songs (id, title, artist, album, path) VALUES (?, ?, ?, 'A', ?)`, s[0], s[1], s[2], "/m/"+s[0]+".mp3"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resolver, err := loadSongIDResolver(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := normalizeMapBody([]byte(`{"items":[
+		{"item_id":"kept","title":"Same Id","author":"Band"},
+		{"item_id":9091736,"title":"renamed id","author":"band"},
+		{"item_id":"x","title":"Twice","author":"Band"},
+		{"item_id":"gone","title":"Deleted","author":"Band"}]}`), resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Items []struct {
+			ItemID     string `json:"item_id"`
+			CoreItemID string `json:"core_item_id"`
+		} `json:"items"`
+		Unmatched int `json:"unmatched"`
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Items) != 2 || got.Items[0].ItemID != "kept" || got.Items[0].CoreItemID != "" ||
+		got.Items[1].ItemID != "newid" || got.Items[1].CoreItemID != "9091736" || got.Unmatched != 2 {
+		t.Fatalf("reconciled map = %s", body)
+	}
+
+	r := gin.New()
+	r.POST("/create", func(c *gin.Context) { c.Set("user", User{ID: 1, Username: "test"}) }, MapCreatePlaylistHandler)
+	post := func(payload string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/create", strings.NewReader(payload)))
+		var resp map[string]any
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := post(`{"name":"From map","item_ids":["kept","9091736","gone"]}`)
+	if code != http.StatusOK || resp["matched"] != 2.0 || resp["unmatched"] != 1.0 {
+		t.Fatalf("create = %d %v", code, resp)
+	}
+	var songs []string
+	rows, err := d.Query(`SELECT song_id FROM playlist_songs WHERE playlist_id = ? ORDER BY position`, resp["playlist_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		songs = append(songs, id)
+	}
+	rows.Close()
+	if strings.Join(songs, ",") != "kept,newid" {
+		t.Errorf("playlist songs = %v, want the core id translated and the unknown one skipped", songs)
+	}
+
+	if code, resp := post(`{"name":"Nothing","item_ids":["gone"]}`); code != http.StatusUnprocessableEntity || resp["unmatched"] != 1.0 {
+		t.Errorf("all-unmatched selection = %d %v, want 422", code, resp)
+	}
+}
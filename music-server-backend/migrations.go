@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // ensureSongSearchIndexes creates the secondary indexes on the songs table that
@@ -22,12 +24,19 @@ func ensureSongSearchIndexes(db *sql.DB) {
 	indexes := []string{
 		`CREATE INDEX IF NOT EXISTS idx_songs_album_albumpath ON songs (album, album_path)`,
 		`CREATE INDEX IF NOT EXISTS idx_songs_album_path ON songs (album_path)`,
-		// (album_path, id) lets the per-song albumId subquery resolve MIN(id)
+		// These let an album's MIN(id) cover song (see album_key.go) resolve
 		// as an index seek instead of scanning each album's rows.
 		`CREATE INDEX IF NOT EXISTS idx_songs_albumpath_id ON songs (album_path, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_songs_albumpath_album_id ON songs (album_path, album, id)`,
 		`CREATE INDEX IF NOT EXISTS idx_songs_artist ON songs (artist)`,
 		`CREATE INDEX IF NOT EXISTS idx_songs_album_artist ON songs (album_artist)`,
 		`CREATE INDEX IF NOT EXISTS idx_songs_genre ON songs (genre)`,
+		// Album listings group by (album, artist) when album_artist is empty.
+		`CREATE INDEX IF NOT EXISTS idx_songs_album_artist_name ON songs (album, artist)`,
+		// The UNIQUE index on path is BINARY, which LIKE (case-insensitive by
+		// default) cannot use. A NOCASE copy lets the "path LIKE 'dir/%'" prefix
+		// scans in scan cleanup and library removal become range seeks.
+		`CREATE INDEX IF NOT EXISTS idx_songs_path_nocase ON songs (path COLLATE NOCASE)`,
 	}
 	for _, stmt := range indexes {
 		if _, err := db.Exec(stmt); err != nil {
@@ -36,6 +45,60 @@ func ensureSongSearchIndexes(db *sql.DB) {
 	}
 }
 
+// songsFTSTriggers keep the external-content songs_fts index in sync with
+// songs. FTS5 needs the OLD column values to remove a row's tokens, and by the
+// time an AFTER trigger runs the content table already holds the new ones, so
+// updates and deletes must go through the special 'delete' command rather than
+// UPDATE/DELETE on songs_fts (which would leave stale tokens behind).
+var songsFTSTriggers = []string{
+	`CREATE TRIGGER songs_ai AFTER INSERT ON songs BEGIN
+		INSERT INTO songs_fts(rowid, title, artist, album, album_artist)
+		VALUES (new.rowid, new.title, new.artist, new.album, new.album_artist);
+	END;`,
+	`CREATE TRIGGER songs_au AFTER UPDATE OF title, artist, album, album_artist ON songs BEGIN
+		INSERT INTO songs_fts(songs_fts, rowid, title, artist, album, album_artist)
+		VALUES ('delete', old.rowid, old.title, old.artist, old.album, old.album_artist);
+		INSERT INTO songs_fts(rowid, title, artist, album, album_artist)
+		VALUES (new.rowid, new.title, new.artist, new.album, new.album_artist);
+	END;`,
+	`CREATE TRIGGER songs_ad AFTER DELETE ON songs BEGIN
+		INSERT INTO songs_fts(songs_fts, rowid, title, artist, album, album_artist)
+		VALUES ('delete', old.rowid, old.title, old.artist, old.album, old.album_artist);
+	END;`,
+}
+
+// ensureSongsFTS creates the songs_fts virtual table (accent-insensitive
+// tokenizer) and its sync triggers, reporting whether FTS5 is usable. When the
+// fts5 module is missing it drops any stale triggers left by an fts5-enabled
+// build: they would otherwise make every write to songs fail with "no such
+// table: main.songs_fts".
+func ensureSongsFTS(db *sql.DB) bool {
+	if _, err := db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS songs_fts
+		USING fts5(title, artist, album, album_artist, content='songs', content_rowid='rowid', tokenize='unicode61 remove_diacritics 2');`); err != nil {
+		log.Printf("ensureSongsFTS: warning - could not create songs_fts virtual table (fts5 may be unavailable, search will use LIKE): %v", err)
+		for _, trig := range []string{"songs_ai", "songs_au", "songs_ad"} {
+			if _, dropErr := db.Exec(`DROP TRIGGER IF EXISTS ` + trig); dropErr != nil {
+				log.Printf("ensureSongsFTS: warning - could not drop stale trigger %s: %v", trig, dropErr)
+			}
+		}
+		return false
+	}
+	// Drop and recreate unconditionally: older builds created triggers whose
+	// body referenced new.id/old.id (a TEXT UUID) or updated songs_fts in place,
+	// and CREATE TRIGGER IF NOT EXISTS would leave those bodies untouched.
+	for _, trig := range []string{"songs_ai", "songs_au", "songs_ad"} {
+		if _, err := db.Exec(`DROP TRIGGER IF EXISTS ` + trig); err != nil {
+			log.Printf("ensureSongsFTS: warning - could not drop trigger %s before recreate: %v", trig, err)
+		}
+	}
+	for _, stmt := range songsFTSTriggers {
+		if _, err := db.Exec(stmt); err != nil {
+			log.Printf("ensureSongsFTS: warning - could not create songs_fts trigger: %v", err)
+		}
+	}
+	return true
+}
+
 // songsFTSIndexEmpty reports whether the songs_fts full-text index contains no
 // indexed rows. Because songs_fts uses external content, a plain COUNT(*) is
 // meaningless, so we take a token from an existing song and probe with MATCH:
@@ -81,7 +144,12 @@ func migrateDB() error {
 		password_hash TEXT NOT NULL,
 		password_plain TEXT NOT NULL,
 		is_admin BOOLEAN NOT NULL DEFAULT 0,
-		api_key TEXT UNIQUE
+		api_key TEXT UNIQUE,
+		download_role INTEGER NOT NULL DEFAULT 1,
+		playlist_role INTEGER NOT NULL DEFAULT 1,
+		settings_role INTEGER NOT NULL DEFAULT 1,
+		scan_role INTEGER NOT NULL DEFAULT 0,
+		jukebox_role INTEGER NOT NULL DEFAULT 0
 	);`)
 	if err != nil {
 		log.Printf("migrateDB: failed to ensure users table: %v", err)
@@ -93,6 +161,13 @@ func migrateDB() error {
 	maybeAddColumn(&columnsAdded, db, "users", "password_plain", "TEXT NOT NULL")
 	maybeAddColumn(&columnsAdded, db, "users", "is_admin", "BOOLEAN NOT NULL DEFAULT 0")
 	maybeAddColumn(&columnsAdded, db, "users", "api_key", "TEXT UNIQUE")
+	maybeAddColumn(&columnsAdded, db, "users", "download_role", "INTEGER NOT NULL DEFAULT 1")
+	maybeAddColumn(&columnsAdded, db, "users", "playlist_role", "INTEGER NOT NULL DEFAULT 1")
+	maybeAddColumn(&columnsAdded, db, "users", "settings_role", "INTEGER NOT NULL DEFAULT 1")
+	maybeAddColumn(&columnsAdded, db, "users", "scan_role", "INTEGER NOT NULL DEFAULT 0")
+	maybeAddColumn(&columnsAdded, db, "users", "jukebox_role", "INTEGER NOT NULL DEFAULT 0")
+	// Bumped on logout to revoke the user's signed stream URLs.
+	maybeAddColumn(&columnsAdded, db, "users", "stream_token_version", "INTEGER NOT NULL DEFAULT 0")
 
 	// --- SCAN_STATUS TABLE ---
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS scan_status (
@@ -109,6 +184,10 @@ func migrateDB() error {
 	maybeAddColumn(&columnsAdded, db, "scan_status", "is_scanning", "BOOLEAN NOT NULL DEFAULT 0")
 	maybeAddColumn(&columnsAdded, db, "scan_status", "songs_added", "INTEGER NOT NULL DEFAULT 0")
 	maybeAddColumn(&columnsAdded, db, "scan_status", "last_update_time", "TEXT")
+	// Set when the watchdog cancels a scan that stopped making progress.
+	maybeAddColumn(&columnsAdded, db, "scan_status", "stalled_at", "TEXT")
+	// Bumped by every scan that claims is_scanning; see claimScanStatus.
+	maybeAddColumn(&columnsAdded, db, "scan_status", "scan_generation", "INTEGER NOT NULL DEFAULT 0")
 
 	// --- SONGS TABLE ---
 	// ...existing code for songs table and per-column ensureColumnExists...
@@ -128,55 +207,10 @@ func migrateDB() error {
 		}
 	}
 
-	// Ensure full-text index exists for fast text searches (albums/artists/songs)
-	// attempt to create the FTS table; if the underlying SQLite does not
-	// support fts5 (common on macOS), simply log and continue.
-	if _, err = db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS songs_fts
-		USING fts5(title, artist, album, album_artist, content='songs', content_rowid='rowid', tokenize='unicode61 remove_diacritics 2');`); err != nil {
-		log.Printf("migrateDB: warning - could not create songs_fts virtual table (fts5 may be unavailable): %v", err)
-		// Drop any pre-existing FTS triggers that reference songs_fts; if those
-		// triggers exist from an older install they will cause every INSERT/UPDATE/
-		// DELETE on the songs table to fail with "no such table: main.songs_fts".
-		for _, trig := range []string{"songs_ai", "songs_au", "songs_ad"} {
-			if _, dropErr := db.Exec(`DROP TRIGGER IF EXISTS ` + trig); dropErr != nil {
-				log.Printf("migrateDB: warning - could not drop stale trigger %s: %v", trig, dropErr)
-			}
-		}
-	} else {
-		// Triggers to keep FTS table in sync with songs data.
-		// Drop any pre-existing triggers first: older builds created triggers whose
-		// body referenced new.id/old.id (a TEXT UUID), which silently broke every
-		// INSERT/UPDATE/DELETE once FTS5 was actually compiled in. Using
-		// CREATE TRIGGER IF NOT EXISTS would leave those broken triggers in place,
-		// so we drop and recreate unconditionally to guarantee the current body.
-		for _, trig := range []string{"songs_ai", "songs_au", "songs_ad"} {
-			if _, dropErr := db.Exec(`DROP TRIGGER IF EXISTS ` + trig); dropErr != nil {
-				log.Printf("migrateDB: warning - could not drop trigger %s before recreate: %v", trig, dropErr)
-			}
-		}
-		if _, err = db.Exec(`
-			CREATE TRIGGER songs_ai AFTER INSERT ON songs BEGIN
-				INSERT INTO songs_fts(rowid, title, artist, album, album_artist)
-				VALUES (new.rowid, new.title, new.artist, new.album, new.album_artist);
-			END;
-		`); err != nil {
-			log.Printf("migrateDB: warning - could not create songs_ai trigger: %v", err)
-		}
-		if _, err = db.Exec(`
-			CREATE TRIGGER songs_au AFTER UPDATE ON songs BEGIN
-				UPDATE songs_fts SET title=new.title, artist=new.artist, album=new.album, album_artist=new.album_artist WHERE rowid=old.rowid;
-			END;
-		`); err != nil {
-			log.Printf("migrateDB: warning - could not create songs_au trigger: %v", err)
-		}
-		if _, err = db.Exec(`
-			CREATE TRIGGER songs_ad AFTER DELETE ON songs BEGIN
-				DELETE FROM songs_fts WHERE rowid=old.rowid;
-			END;
-		`); err != nil {
-			log.Printf("migrateDB: warning - could not create songs_ad trigger: %v", err)
-		}
-
+	// Ensure full-text index exists for fast text searches (albums/artists/songs).
+	// When the underlying SQLite lacks fts5 (common on macOS, or a build without
+	// -tags fts5) search falls back to LIKE; see ftsAvailable.
+	if ensureSongsFTS(db) {
 		// If songs exist but the songs_fts index is empty, rebuild it from the
 		// content table so existing songs are searchable without a full rescan.
 		// NOTE: songs_fts is an external-content FTS5 table, so COUNT(*) on it
@@ -223,6 +257,10 @@ func migrateDB() error {
 	maybeAddColumn(&columnsAdded, db, "starred_songs", "user_id", "INTEGER NOT NULL")
 	maybeAddColumn(&columnsAdded, db, "starred_songs", "song_id", "TEXT NOT NULL")
 	maybeAddColumn(&columnsAdded, db, "starred_songs", "starred_at", "TEXT NOT NULL")
+	if err := ensureStarredSongsPrimaryKey(db); err != nil {
+		log.Printf("migrateDB: failed to rebuild starred_songs with its primary key: %v", err)
+		return err
+	}
 
 	// --- STARRED_ALBUMS TABLE ---
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS starred_albums (
@@ -270,6 +308,8 @@ func migrateDB() error {
 	maybeAddColumn(&columnsAdded, db, "playlists", "id", "INTEGER PRIMARY KEY AUTOINCREMENT")
 	maybeAddColumn(&columnsAdded, db, "playlists", "name", "TEXT NOT NULL")
 	maybeAddColumn(&columnsAdded, db, "playlists", "user_id", "INTEGER")
+	// Owners can mark a playlist public so every user can see it (read-only).
+	maybeAddColumn(&columnsAdded, db, "playlists", "public", "INTEGER DEFAULT 0")
 
 	// --- PLAYLIST_SONGS TABLE ---
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS playlist_songs (
@@ -333,6 +373,8 @@ func migrateDB() error {
 	maybeAddColumn(&columnsAdded, db, "library_paths", "path", "TEXT UNIQUE NOT NULL")
 	maybeAddColumn(&columnsAdded, db, "library_paths", "song_count", "INTEGER NOT NULL DEFAULT 0")
 	maybeAddColumn(&columnsAdded, db, "library_paths", "last_scan_ended", "TEXT")
+	// Per-path cron expression; NULL follows the global scan_schedule.
+	maybeAddColumn(&columnsAdded, db, "library_paths", "scan_schedule", "TEXT")
 
 	// --- PLAY_HISTORY TABLE ---
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS play_history (
@@ -359,6 +401,24 @@ func migrateDB() error {
 		return err
 	}
 
+	// Plays rolled up when old history is pruned; see play_history_retention.go.
+	if err = ensureUserSongStatsTable(db); err != nil {
+		log.Printf("migrateDB: failed to create user_song_stats table: %v", err)
+		return err
+	}
+
+	// Per-user song ratings; see ratings.go.
+	if err = ensureSongRatingsTable(db); err != nil {
+		log.Printf("migrateDB: failed to create song_ratings table: %v", err)
+		return err
+	}
+
+	// Genres and years set by a catalog import; see library_catalog_import.go.
+	if err = ensureSongTagOverridesTable(db); err != nil {
+		log.Printf("migrateDB: failed to create song_tag_overrides table: %v", err)
+		return err
+	}
+
 	// --- TRANSCODING_SETTINGS TABLE ---
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS transcoding_settings (
 		user_id INTEGER PRIMARY KEY NOT NULL,
@@ -401,6 +461,374 @@ func migrateDB() error {
 	maybeAddColumn(&columnsAdded, db, "radio_stations", "created_at", "TEXT NOT NULL")
 	maybeAddColumn(&columnsAdded, db, "radio_stations", "updated_at", "TEXT NOT NULL")
 
+	// --- SHARES TABLE ---
+	// song_ids is a JSON array of song ids; expires_at NULL means the share never expires.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS shares (
+		id TEXT PRIMARY KEY NOT NULL,
+		user_id INTEGER NOT NULL,
+		song_ids TEXT NOT NULL,
+		description TEXT DEFAULT '',
+		expires_at TEXT,
+		created_at TEXT NOT NULL,
+		last_visited TEXT,
+		visit_count INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`)
+	if err != nil {
+		log.Printf("migrateDB: failed to create shares table: %v", err)
+		return err
+	}
+	maybeAddColumn(&columnsAdded, db, "shares", "description", "TEXT DEFAULT ''")
+	maybeAddColumn(&columnsAdded, db, "shares", "last_visited", "TEXT")
+	maybeAddColumn(&columnsAdded, db, "shares", "visit_count", "INTEGER NOT NULL DEFAULT 0")
+
+	// Public sharing is opt-in
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('enable_shares', 'false')`); err != nil {
+		log.Printf("migrateDB: failed to ensure enable_shares config key: %v", err)
+		return err
+	}
+
+	// Jukebox mode plays through the host's speakers, so it is opt-in too.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('enable_jukebox', 'false')`); err != nil {
+		log.Printf("migrateDB: failed to ensure enable_jukebox config key: %v", err)
+		return err
+	}
+
+	// Recoverable passwords (needed only for token/salt auth) are either wiped or
+	// encrypted at rest; see password_crypto.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('disable_plaintext_passwords', 'false')`); err != nil {
+		log.Printf("migrateDB: failed to ensure disable_plaintext_passwords config key: %v", err)
+		return err
+	}
+	if plaintextPasswordsDisabled() {
+		if n, clearErr := clearStoredPlainPasswords(db); clearErr != nil {
+			log.Printf("migrateDB: warning - could not clear stored passwords: %v", clearErr)
+		} else if n > 0 {
+			log.Printf("migrateDB: cleared stored passwords for %d users (disable_plaintext_passwords=true)", n)
+		}
+	} else if passwordEncryptionKey() == nil {
+		log.Printf("migrateDB: warning - PASSWORD_ENCRYPTION_KEY/JWT_SECRET not set; passwords for token auth remain stored unencrypted")
+	} else if n, encErr := encryptLegacyPlainPasswords(db); encErr != nil {
+		log.Printf("migrateDB: warning - could not encrypt stored passwords: %v", encErr)
+	} else if n > 0 {
+		log.Printf("migrateDB: encrypted stored passwords for %d users", n)
+	}
+
+	// --- BOOKMARKS TABLE ---
+	// One saved playback position (milliseconds) per user and song.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS bookmarks (
+		user_id INTEGER NOT NULL,
+		song_id TEXT NOT NULL,
+		position_ms INTEGER NOT NULL DEFAULT 0,
+		comment TEXT DEFAULT '',
+		created TEXT NOT NULL,
+		changed TEXT NOT NULL,
+		PRIMARY KEY (user_id, song_id),
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`)
+	if err != nil {
+		log.Printf("migrateDB: failed to create bookmarks table: %v", err)
+		return err
+	}
+
+	// --- PLAY QUEUE TABLE ---
+	// A single saved queue per user; song_ids is a JSON array in play order.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS play_queue (
+		user_id INTEGER PRIMARY KEY NOT NULL,
+		song_ids TEXT NOT NULL,
+		current TEXT,
+		position_ms INTEGER NOT NULL DEFAULT 0,
+		changed_by TEXT,
+		changed TEXT NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`)
+	if err != nil {
+		log.Printf("migrateDB: failed to create play_queue table: %v", err)
+		return err
+	}
+
+	// --- REVOKED TOKENS TABLE ---
+	// jti of logged-out JWTs, kept until they would have expired anyway (unix seconds).
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS revoked_tokens (
+		jti TEXT PRIMARY KEY NOT NULL,
+		expires_at INTEGER NOT NULL
+	);`)
+	if err != nil {
+		log.Printf("migrateDB: failed to create revoked_tokens table: %v", err)
+		return err
+	}
+	if _, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires ON revoked_tokens(expires_at)`); err != nil {
+		log.Printf("migrateDB: failed to ensure idx_revoked_tokens_expires: %v", err)
+	}
+
+	// Failed-login throttling thresholds; see login_rate_limiter.go.
+	for _, kv := range [][2]string{
+		{"login_max_failures", "5"},
+		{"login_failure_window_seconds", "900"},
+		{"login_lockout_seconds", "60"},
+	} {
+		if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES (?, ?)`, kv[0], kv[1]); err != nil {
+			log.Printf("migrateDB: failed to ensure %s config key: %v", kv[0], err)
+			return err
+		}
+	}
+
+	// Match search words anywhere instead of at word starts; see search_text.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('search_substring_match', 'false')`); err != nil {
+		log.Printf("migrateDB: failed to ensure search_substring_match config key: %v", err)
+		return err
+	}
+
+	// Folders and files library scans skip; see scan_ignore.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('scan_ignore_globs', ?)`, defaultScanIgnoreGlobs); err != nil {
+		log.Printf("migrateDB: failed to ensure scan_ignore_globs config key: %v", err)
+		return err
+	}
+
+	// Merge the disc folders of a release into one album; see album_discs.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('group_multi_disc_albums', 'true')`); err != nil {
+		log.Printf("migrateDB: failed to ensure group_multi_disc_albums config key: %v", err)
+		return err
+	}
+
+	// Leading words artists and albums sort without; see sort_name.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('ignored_articles', ?)`, defaultIgnoredArticles); err != nil {
+		log.Printf("migrateDB: failed to ensure ignored_articles config key: %v", err)
+		return err
+	}
+
+	// Folder image names tried for cover art; see cover_art_files.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('cover_art_filenames', ?)`, defaultCoverArtFilenames); err != nil {
+		log.Printf("migrateDB: failed to ensure cover_art_filenames config key: %v", err)
+		return err
+	}
+
+	// Embedded picture or folder image when a song has both; see cover_art_files.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('cover_art_preference', ?)`, coverArtPreferLargest); err != nil {
+		log.Printf("migrateDB: failed to ensure cover_art_preference config key: %v", err)
+		return err
+	}
+
+	// Days of play history kept (0 keeps all); see play_history_retention.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('play_history_retention_days', '0')`); err != nil {
+		log.Printf("migrateDB: failed to ensure play_history_retention_days config key: %v", err)
+		return err
+	}
+
+	// Follow symlinked folders during scans (off by default); see scan_walk.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('follow_symlinks', 'false')`); err != nil {
+		log.Printf("migrateDB: failed to ensure follow_symlinks config key: %v", err)
+		return err
+	}
+
+	// Duplicate copies found by fingerprint; see duplicates.go.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS duplicates (
+		song_id TEXT PRIMARY KEY,
+		fingerprint TEXT NOT NULL,
+		detected_at TEXT NOT NULL,
+		hidden INTEGER NOT NULL DEFAULT 0
+	);`)
+	if err != nil {
+		log.Printf("migrateDB: failed to create duplicates table: %v", err)
+		return err
+	}
+	if _, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_duplicates_fingerprint ON duplicates(fingerprint)`); err != nil {
+		log.Printf("migrateDB: failed to ensure idx_duplicates_fingerprint: %v", err)
+	}
+	// Chromaprint fingerprints cached between duplicate detection runs.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS fingerprints (
+		path TEXT PRIMARY KEY,
+		size INTEGER NOT NULL,
+		mtime INTEGER NOT NULL,
+		fingerprint TEXT NOT NULL
+	);`)
+	if err != nil {
+		log.Printf("migrateDB: failed to create fingerprints table: %v", err)
+		return err
+	}
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('detect_duplicates', 'false')`); err != nil {
+		log.Printf("migrateDB: failed to ensure detect_duplicates config key: %v", err)
+		return err
+	}
+
+	// Files and folders the last scans could not read; see scan_errors.go.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS scan_errors (
+		path TEXT NOT NULL,
+		category TEXT NOT NULL,
+		error TEXT NOT NULL,
+		occurred_at TEXT NOT NULL,
+		PRIMARY KEY (path, category)
+	);`)
+	if err != nil {
+		log.Printf("migrateDB: failed to create scan_errors table: %v", err)
+		return err
+	}
+
+	// Minutes without scan progress before the watchdog cancels a scan; see scan_watchdog.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('scan_stall_minutes', '15')`); err != nil {
+		log.Printf("migrateDB: failed to ensure scan_stall_minutes config key: %v", err)
+		return err
+	}
+
+	// Seconds before a hung ffprobe is killed; see ffprobe.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('ffprobe_timeout_seconds', '30')`); err != nil {
+		log.Printf("migrateDB: failed to ensure ffprobe_timeout_seconds config key: %v", err)
+		return err
+	}
+
+	// Let lossless files through untranscoded (e.g. on a LAN); see shouldTranscode.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('allow_lossless_direct', 'false')`); err != nil {
+		log.Printf("migrateDB: failed to ensure allow_lossless_direct config key: %v", err)
+		return err
+	}
+
+	// Address ranges that are never transcoded, empty for none; see lan_streaming.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('lan_cidrs', '')`); err != nil {
+		log.Printf("migrateDB: failed to ensure lan_cidrs config key: %v", err)
+		return err
+	}
+
+	// Concurrent ffmpeg transcodes, 0 for one per CPU; see transcode_limit.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('max_concurrent_transcodes', '0')`); err != nil {
+		log.Printf("migrateDB: failed to ensure max_concurrent_transcodes config key: %v", err)
+		return err
+	}
+
+	// Seconds a fetched music map is reused, 0 to disable; see map_handlers.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('map_cache_seconds', '60')`); err != nil {
+		log.Printf("migrateDB: failed to ensure map_cache_seconds config key: %v", err)
+		return err
+	}
+
+	// External album metadata for getAlbumInfo, cached per album; see album_info.go.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS album_info (
+		album_key TEXT PRIMARY KEY,
+		musicbrainz_id TEXT NOT NULL DEFAULT '',
+		notes TEXT NOT NULL DEFAULT '',
+		lastfm_url TEXT NOT NULL DEFAULT '',
+		small_image_url TEXT NOT NULL DEFAULT '',
+		medium_image_url TEXT NOT NULL DEFAULT '',
+		large_image_url TEXT NOT NULL DEFAULT '',
+		fetched_at TEXT NOT NULL,
+		expires_at TEXT NOT NULL
+	);`)
+	if err != nil {
+		log.Printf("migrateDB: failed to create album_info table: %v", err)
+		return err
+	}
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('lastfm_api_key', '')`); err != nil {
+		log.Printf("migrateDB: failed to ensure lastfm_api_key config key: %v", err)
+		return err
+	}
+
+	// Per-user Last.fm sessions for scrobble passthrough; see lastfm.go.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS lastfm_sessions (
+		user_id INTEGER PRIMARY KEY NOT NULL,
+		session_key TEXT NOT NULL,
+		lastfm_user TEXT NOT NULL DEFAULT '',
+		enabled INTEGER NOT NULL DEFAULT 1,
+		linked_at TEXT NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`)
+	if err != nil {
+		log.Printf("migrateDB: failed to create lastfm_sessions table: %v", err)
+		return err
+	}
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('lastfm_api_secret', '')`); err != nil {
+		log.Printf("migrateDB: failed to ensure lastfm_api_secret config key: %v", err)
+		return err
+	}
+
+	// Loudness normalization of transcoded streams; see loudness.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('normalize_loudness', 'false')`); err != nil {
+		log.Printf("migrateDB: failed to ensure normalize_loudness config key: %v", err)
+		return err
+	}
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('normalize_loudness_target', '-14')`); err != nil {
+		log.Printf("migrateDB: failed to ensure normalize_loudness_target config key: %v", err)
+		return err
+	}
+
+	// Background silence analysis for crossfading clients; see silence_analysis.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('analyze_silence', 'false')`); err != nil {
+		log.Printf("migrateDB: failed to ensure analyze_silence config key: %v", err)
+		return err
+	}
+
+	// HLS segment length and idle session lifetime; see hls_transcoding.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('hls_segment_seconds', '10')`); err != nil {
+		log.Printf("migrateDB: failed to ensure hls_segment_seconds config key: %v", err)
+		return err
+	}
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('hls_session_timeout_seconds', '300')`); err != nil {
+		log.Printf("migrateDB: failed to ensure hls_session_timeout_seconds config key: %v", err)
+		return err
+	}
+
+	// Index library changes as they happen (off by default); see library_watch.go.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('watch_library', 'false')`); err != nil {
+		log.Printf("migrateDB: failed to ensure watch_library config key: %v", err)
+		return err
+	}
+
+	// Browse artists by album artist instead of track artist; see UseAlbumArtist.
+	if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES ('use_album_artist', 'false')`); err != nil {
+		log.Printf("migrateDB: failed to ensure use_album_artist config key: %v", err)
+		return err
+	}
+
+	// Transcoding for users without settings of their own; see transcode_defaults.go.
+	for key, value := range map[string]string{
+		"default_transcode_enabled": "false",
+		"default_transcode_format":  "mp3",
+		"default_transcode_bitrate": "128",
+	} {
+		if _, err = db.Exec(`INSERT OR IGNORE INTO configuration (key, value) VALUES (?, ?)`, key, value); err != nil {
+			log.Printf("migrateDB: failed to ensure %s config key: %v", key, err)
+			return err
+		}
+	}
+
+	// Rule-based playlists evaluated on read; see smart_playlists.go.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS smart_playlists (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		public INTEGER NOT NULL DEFAULT 0,
+		rules TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`)
+	if err != nil {
+		log.Printf("migrateDB: failed to create smart_playlists table: %v", err)
+		return err
+	}
+
+	// User avatars served by getAvatar; see avatar.go.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS avatars (
+		user_id INTEGER PRIMARY KEY NOT NULL,
+		image BLOB NOT NULL,
+		updated_at TEXT NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`)
+	if err != nil {
+		log.Printf("migrateDB: failed to create avatars table: %v", err)
+		return err
+	}
+
+	// Internet radio stations for getInternetRadioStations; see internet_radio.go.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS internet_radio (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		stream_url TEXT NOT NULL,
+		homepage_url TEXT NOT NULL DEFAULT ''
+	);`)
+	if err != nil {
+		log.Printf("migrateDB: failed to create internet_radio table: %v", err)
+		return err
+	}
+
 	// --- END OF TABLE MIGRATIONS ---
 
 	// Ensure songs table has core and historical columns (match fresh install)
@@ -496,11 +924,161 @@ func migrateDB() error {
 	maybeAddColumn(&columnsAdded, db, "songs", "bit_depth", "INTEGER DEFAULT 0")
 	maybeAddColumn(&columnsAdded, db, "songs", "comment", "TEXT DEFAULT ''")
 
+	// Accent-folded search text maintained by RebuildLibraryIndex; see search_text.go.
+	maybeAddColumn(&columnsAdded, db, "songs", "search_text", "TEXT NOT NULL DEFAULT ''")
+
+	// Leading/trailing silence measured by the background analysis; see silence_analysis.go.
+	maybeAddColumn(&columnsAdded, db, "songs", "silence_lead_in", "REAL")
+	maybeAddColumn(&columnsAdded, db, "songs", "silence_lead_out", "REAL")
+	maybeAddColumn(&columnsAdded, db, "songs", "silence_analyzed_at", "TEXT")
+
+	// Core-facing song id, kept when songs.id is rewritten; see song_id_reconcile.go.
+	maybeAddColumn(&columnsAdded, db, "songs", "external_id", "TEXT NOT NULL DEFAULT ''")
+	ensureSongExternalIDs(db)
+
+	// When and why a song was soft-deleted; see cancelled_songs.go.
+	maybeAddColumn(&columnsAdded, db, "songs", "cancelled_at", "TEXT")
+	maybeAddColumn(&columnsAdded, db, "songs", "cancel_reason", "TEXT NOT NULL DEFAULT ''")
+	ensureCancelledSongTracking(db)
+
+	// Songs scanned before disc folders were grouped; see album_discs.go.
+	if n, err := applyMultiDiscGrouping(db); err != nil {
+		log.Printf("migrateDB: regrouping multi-disc albums: %v", err)
+	} else if n > 0 {
+		log.Printf("migrateDB: regrouped %d songs into multi-disc albums", n)
+	}
+
+	// Album stars saved when album ids were song ids; see album_key.go.
+	if err := migrateStarredAlbumIDs(db); err != nil {
+		log.Printf("migrateDB: moving album stars to album ids: %v", err)
+	}
+
 	log.Printf("migrateDB: summary: columns_added=%d songs_migrated=%d date_added_backfilled=%d date_updated_backfilled=%d", columnsAdded, songsMigrated, dateAddedBackfilled, dateUpdatedBackfilled)
 	log.Println("migrateDB: completed migrations (idempotent)")
 	return nil
 }
 
+// ensureSongExternalIDs gives every song an external_id (its id at the time,
+// unless migrateSongIDsToUUID preserved the older integer id) and installs the
+// trigger that does the same for songs inserted later, so the AudioMuse-AI
+// Core keeps a stable id for each song whatever happens to songs.id.
+func ensureSongExternalIDs(db *sql.DB) {
+	for _, stmt := range []string{
+		`UPDATE songs SET external_id = id WHERE external_id IS NULL OR external_id = ''`,
+		`CREATE INDEX IF NOT EXISTS idx_songs_external_id ON songs (external_id)`,
+		`CREATE TRIGGER IF NOT EXISTS songs_external_id AFTER INSERT ON songs WHEN new.external_id = '' BEGIN
+			UPDATE songs SET external_id = new.id WHERE rowid = new.rowid;
+		END;`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			log.Printf("ensureSongExternalIDs: warning - %v", err)
+		}
+	}
+}
+
+// ensureStarredSongsPrimaryKey rebuilds a starred_songs table created without
+// PRIMARY KEY (user_id, song_id), which could hold the same star more than
+// once. Duplicates collapse into one row with the latest starred_at.
+func ensureStarredSongsPrimaryKey(db *sql.DB) error {
+	var keyed int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('starred_songs')
+		WHERE (name = 'user_id' AND pk = 1) OR (name = 'song_id' AND pk = 2)`).Scan(&keyed); err != nil {
+		return err
+	}
+	if keyed == 2 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DROP TABLE IF EXISTS starred_songs_new`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE TABLE starred_songs_new (
+		user_id INTEGER NOT NULL,
+		song_id TEXT NOT NULL,
+		starred_at TEXT NOT NULL,
+		PRIMARY KEY (user_id, song_id),
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY(song_id) REFERENCES songs(id) ON DELETE CASCADE
+	)`); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`INSERT INTO starred_songs_new (user_id, song_id, starred_at)
+		SELECT user_id, song_id, COALESCE(MAX(starred_at), ?)
+		FROM starred_songs
+		WHERE user_id IS NOT NULL AND song_id IS NOT NULL
+		GROUP BY user_id, song_id`, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	var before int64
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM starred_songs`).Scan(&before); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DROP TABLE starred_songs`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`ALTER TABLE starred_songs_new RENAME TO starred_songs`); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	kept, _ := res.RowsAffected()
+	log.Printf("migrateDB: rebuilt starred_songs with its primary key (%d rows kept, %d duplicates removed)", kept, before-kept)
+	return nil
+}
+
+// migrateStarredAlbumIDs rewrites album stars saved under a song id (what
+// album ids used to be) to the id of that song's album (see album_key.go).
+// Stars whose song is gone are left alone; they no longer match any album.
+func migrateStarredAlbumIDs(db *sql.DB) error {
+	type star struct {
+		userID           int
+		albumID, starred string
+	}
+	rows, err := db.Query(`SELECT user_id, album_id, starred_at FROM starred_albums WHERE album_id NOT LIKE '` + albumIDPrefix + `%'`)
+	if err != nil {
+		return err
+	}
+	var stars []star
+	for rows.Next() {
+		var s star
+		if err := rows.Scan(&s.userID, &s.albumID, &s.starred); err != nil {
+			rows.Close()
+			return err
+		}
+		stars = append(stars, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	moved := 0
+	for _, s := range stars {
+		ref, err := resolveAlbumRef(db, s.albumID)
+		if err != nil {
+			continue
+		}
+		if _, err := db.Exec(`INSERT OR IGNORE INTO starred_albums (user_id, album_id, starred_at) VALUES (?, ?, ?)`, s.userID, ref.ID, s.starred); err != nil {
+			return err
+		}
+		if _, err := db.Exec(`DELETE FROM starred_albums WHERE user_id = ? AND album_id = ?`, s.userID, s.albumID); err != nil {
+			return err
+		}
+		moved++
+	}
+	if moved > 0 {
+		log.Printf("migrateDB: moved %d album stars to album ids", moved)
+	}
+	return nil
+}
+
 // ensureColumnExists will attempt to add a column to a table if it doesn't exist.
 // For SQLite we attempt to ALTER TABLE ADD COLUMN and ignore duplicate column errors.
 func ensureColumnExists(db *sql.DB, table, column, definition string) (bool, error) {
@@ -578,6 +1156,7 @@ func migrateSongIDsToUUID(db *sql.DB) (int, error) {
 			replaygain_album_gain REAL,
 			replaygain_album_peak REAL,
 			waveform_peaks TEXT,
+			external_id TEXT NOT NULL DEFAULT '',
 			cancelled INTEGER NOT NULL DEFAULT 0
 		)
 	`)
@@ -593,8 +1172,8 @@ func migrateSongIDsToUUID(db *sql.DB) (int, error) {
 	defer rows.Close()
 
 	insertStmt, err := tx.Prepare(`
-		INSERT INTO songs_new (id, title, artist, album, album_artist, path, play_count, last_played, date_added, date_updated, starred, genre, album_path, duration, replaygain_track_gain, replaygain_track_peak, replaygain_album_gain, replaygain_album_peak, waveform_peaks, cancelled)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)
+		INSERT INTO songs_new (id, title, artist, album, album_artist, path, play_count, last_played, date_added, date_updated, starred, genre, album_path, duration, replaygain_track_gain, replaygain_track_peak, replaygain_album_gain, replaygain_album_peak, waveform_peaks, external_id, cancelled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)
 	`)
 	if err != nil {
 		return 0, fmt.Errorf("failed to prepare insert statement: %v", err)
@@ -642,6 +1221,8 @@ func migrateSongIDsToUUID(db *sql.DB) (int, error) {
 			nullFloat64ToInterface(replayGainAlbumGain),
 			nullFloat64ToInterface(replayGainAlbumPeak),
 			"",
+			// The AudioMuse-AI Core analyzed this song under its integer id.
+			strconv.Itoa(oldID),
 		)
 		if err != nil {
 			log.Printf("Error inserting song with new UUID: %v", err)
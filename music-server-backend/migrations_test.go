@@ -2,6 +2,9 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
+	"maps"
+	"strings"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -99,4 +102,74 @@ func TestMigrateDB_IdempotentAndCreatesExpectedTables(t *testing.T) {
 			t.Fatalf("trigger %s not created after songs_fts was created", trig)
 		}
 	}
+
+	// Scan cleanup's "path LIKE 'dir/%'" must be served by an index, not a table scan.
+	var plan strings.Builder
+	planRows, err := db.Query(`EXPLAIN QUERY PLAN SELECT id, path FROM songs WHERE path LIKE ? AND cancelled = 0`, "/music/a/%")
+	if err != nil {
+		t.Fatalf("explain path LIKE: %v", err)
+	}
+	for planRows.Next() {
+		var id, parent, notused int
+		var detail string
+		if err := planRows.Scan(&id, &parent, &notused, &detail); err == nil {
+			plan.WriteString(detail + "\n")
+		}
+	}
+	planRows.Close()
+	if !strings.Contains(plan.String(), "idx_songs_path_nocase") {
+		t.Fatalf("expected path LIKE to use idx_songs_path_nocase, plan:\n%s", plan.String())
+	}
+}
+
+func TestMigrateDB_CollapsesDuplicateStars(t *testing.T) {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer conn.Close()
+	prev := db
+	db = conn
+	defer func() { db = prev }()
+
+	for _, stmt := range []string{
+		`CREATE TABLE songs (id TEXT PRIMARY KEY NOT NULL, title TEXT, artist TEXT, album TEXT, album_artist TEXT DEFAULT '',
+			path TEXT UNIQUE NOT NULL DEFAULT '', cancelled INTEGER NOT NULL DEFAULT 0)`,
+		// starred_songs as created before it had a primary key
+		`CREATE TABLE starred_songs (user_id INTEGER, song_id TEXT, starred_at TEXT)`,
+		`INSERT INTO starred_songs VALUES (1, 's1', '2026-01-01T00:00:00Z'), (1, 's1', '2026-02-01T00:00:00Z'),
+			(1, 's2', '2026-01-05T00:00:00Z'), (2, 's1', '2026-01-03T00:00:00Z'), (2, 's1', '2026-01-02T00:00:00Z')`,
+	} {
+		if _, err := conn.Exec(stmt); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+	}
+
+	if err := migrateDB(); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+
+	got := map[string]string{}
+	rows, err := conn.Query(`SELECT user_id, song_id, starred_at FROM starred_songs`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var user int
+		var song, at string
+		rows.Scan(&user, &song, &at)
+		got[fmt.Sprintf("%d/%s", user, song)] = at
+	}
+	rows.Close()
+	want := map[string]string{"1/s1": "2026-02-01T00:00:00Z", "1/s2": "2026-01-05T00:00:00Z", "2/s1": "2026-01-03T00:00:00Z"}
+	if !maps.Equal(got, want) {
+		t.Errorf("starred_songs = %v, want %v", got, want)
+	}
+
+	if _, err := conn.Exec(`INSERT INTO starred_songs VALUES (1, 's1', '2026-03-01T00:00:00Z')`); err == nil {
+		t.Errorf("duplicate star inserted; starred_songs has no primary key")
+	}
+	if err := migrateDB(); err != nil {
+		t.Fatalf("second migrate failed: %v", err)
+	}
 }
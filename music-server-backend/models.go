@@ -3,6 +3,7 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"encoding/xml"
 	"strconv"
 )
@@ -70,6 +71,7 @@ type LibraryPath struct {
 	Path          string `json:"path"`
 	SongCount     int    `json:"song_count"`
 	LastScanEnded string `json:"last_scan_ended"`
+	ScanSchedule  string `json:"scan_schedule"`
 }
 
 // --- Subsonic Data Structures ---
@@ -204,6 +206,8 @@ type SubsonicSong struct {
 	LastPlayed    string   `xml:"lastPlayed,attr,omitempty" json:"lastPlayed,omitempty"`
 	Created       string   `xml:"created,attr,omitempty" json:"created,omitempty"`
 	Starred       bool     `xml:"starred,attr,omitempty" json:"starred,omitempty"`
+	UserRating    int      `xml:"userRating,attr,omitempty" json:"userRating,omitempty"`
+	AverageRating float64  `xml:"averageRating,attr,omitempty" json:"averageRating,omitempty"`
 	Genre         string   `xml:"genre,attr,omitempty" json:"genre,omitempty"`
 	Comment       string   `xml:"comment,attr,omitempty" json:"comment,omitempty"`     // OpenSubsonic
 	Type          string   `xml:"type,attr,omitempty" json:"type,omitempty"`           // Always "music" for songs
@@ -247,6 +251,7 @@ type SubsonicArtist struct {
 	CoverArt   string   `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
 	AlbumCount int      `xml:"albumCount,attr" json:"albumCount"`
 	SongCount  int      `xml:"songCount,attr,omitempty" json:"songCount,omitempty"`
+	SortName   string   `xml:"sortName,attr,omitempty" json:"sortName,omitempty"`
 }
 
 type SubsonicAlbumList2 struct {
@@ -269,16 +274,20 @@ type SubsonicAlbum struct {
 	Created   string `xml:"created,attr" json:"created"`
 	// OpenSubsonic-extension fields.
 	DisplayArtist string              `xml:"displayArtist,attr,omitempty" json:"displayArtist,omitempty"`
+	SortName      string              `xml:"sortName,attr,omitempty" json:"sortName,omitempty"`
 	Genres        []SubsonicItemGenre `xml:"genres" json:"genres,omitempty"`
 }
 
 // decorateAlbum fills the OpenSubsonic-extension AlbumID3 fields (displayArtist,
-// genres) that are pure derivations of the already-populated artist/genre, so
-// every album construction site emits a spec-aligned object via one call.
+// sortName, genres) that derive from the already-populated name/artist/genre,
+// so every album construction site emits a spec-aligned object via one call.
 func decorateAlbum(a *SubsonicAlbum) {
 	if a.Artist != "" && a.DisplayArtist == "" {
 		a.DisplayArtist = a.Artist
 	}
+	if a.SortName == "" {
+		a.SortName = sortName(a.Name, ignoredArticles(db))
+	}
 	if a.Genre != "" && len(a.Genres) == 0 {
 		a.Genres = []SubsonicItemGenre{{Name: a.Genre}}
 	}
@@ -290,19 +299,32 @@ type SubsonicPlaylists struct {
 }
 
 type SubsonicPlaylist struct {
-	XMLName   xml.Name `xml:"playlist" json:"-"`
-	ID        int      `xml:"id,attr" json:"id"`
-	Name      string   `xml:"name,attr" json:"name"`
-	Owner     string   `xml:"owner,attr" json:"owner"`
-	Public    bool     `xml:"public,attr" json:"public"`
-	SongCount int      `xml:"songCount,attr" json:"songCount"`
-	Duration  int      `xml:"duration,attr" json:"duration"`
+	XMLName   xml.Name   `xml:"playlist" json:"-"`
+	ID        playlistID `xml:"id,attr" json:"id"`
+	Name      string     `xml:"name,attr" json:"name"`
+	Owner     string     `xml:"owner,attr" json:"owner"`
+	Public    bool       `xml:"public,attr" json:"public"`
+	SongCount int        `xml:"songCount,attr" json:"songCount"`
+	Duration  int        `xml:"duration,attr" json:"duration"`
+}
+
+// playlistID is a playlist id as clients see it. Regular playlists keep the
+// numeric JSON id they always had; smart playlists ("smart-3") are strings.
+type playlistID string
+
+func (id playlistID) MarshalJSON() ([]byte, error) {
+	if _, err := strconv.Atoi(string(id)); err == nil {
+		return []byte(id), nil
+	}
+	return json.Marshal(string(id))
 }
 
 type SubsonicScanStatus struct {
 	XMLName  xml.Name `xml:"scanStatus" json:"-"`
 	Scanning bool     `xml:"scanning,attr" json:"scanning"`
 	Count    int64    `xml:"count,attr" json:"count"`
+	// StalledAt is set when the last scan was cancelled for making no progress.
+	StalledAt string `xml:"stalledAt,attr,omitempty" json:"stalledAt,omitempty"`
 }
 
 type SubsonicUsers struct {
@@ -315,6 +337,10 @@ type SubsonicUser struct {
 	Username     string   `xml:"username,attr" json:"username"`
 	AdminRole    bool     `xml:"adminRole,attr" json:"adminRole"`
 	SettingsRole bool     `xml:"settingsRole,attr" json:"settingsRole"`
+	DownloadRole bool     `xml:"downloadRole,attr" json:"downloadRole"`
+	PlaylistRole bool     `xml:"playlistRole,attr" json:"playlistRole"`
+	ScanRole     bool     `xml:"scanRole,attr" json:"scanRole"`
+	JukeboxRole  bool     `xml:"jukeboxRole,attr" json:"jukeboxRole"`
 }
 
 type SubsonicConfigurations struct {
@@ -322,10 +348,14 @@ type SubsonicConfigurations struct {
 	Configurations []SubsonicConfiguration `xml:"configuration" json:"configuration"`
 }
 
+// SubsonicConfiguration is one configuration key. Type and Default come from
+// configSchema and are empty for keys the schema does not know.
 type SubsonicConfiguration struct {
 	XMLName xml.Name `xml:"configuration" json:"-"`
 	Name    string   `xml:"name,attr" json:"name"`
 	Value   string   `xml:"value,attr" json:"value"`
+	Type    string   `xml:"type,attr,omitempty" json:"type,omitempty"`
+	Default string   `xml:"default,attr,omitempty" json:"default,omitempty"`
 }
 
 type SubsonicLibraryPaths struct {
@@ -339,6 +369,7 @@ type SubsonicLibraryPath struct {
 	Path          string   `xml:"path,attr" json:"path"`
 	SongCount     int      `xml:"songCount,attr" json:"songCount"`
 	LastScanEnded string   `xml:"lastScanEnded,attr,omitempty" json:"lastScanEnded"`
+	ScanSchedule  string   `xml:"scanSchedule,attr,omitempty" json:"scanSchedule,omitempty"`
 }
 
 // --- OpenSubsonic Extension Structs ---
@@ -389,6 +420,12 @@ type SubsonicStarred2 struct {
 	Songs   []SubsonicSong   `xml:"song" json:"song"`
 }
 
+// SubsonicSongs is the getSongs response.
+type SubsonicSongs struct {
+	XMLName xml.Name       `xml:"songs" json:"-"`
+	Songs   []SubsonicSong `xml:"song" json:"song"`
+}
+
 type SubsonicSongsByGenre struct {
 	XMLName xml.Name       `xml:"songsByGenre" json:"-"`
 	Songs   []SubsonicSong `xml:"song" json:"song"`
@@ -458,6 +495,8 @@ type SubsonicDirectoryChild struct {
 	LastPlayed    string              `xml:"lastPlayed,attr,omitempty" json:"lastPlayed,omitempty"`
 	Created       string              `xml:"created,attr,omitempty" json:"created,omitempty"`
 	Starred       bool                `xml:"starred,attr,omitempty" json:"starred,omitempty"`
+	UserRating    int                 `xml:"userRating,attr,omitempty" json:"userRating,omitempty"`
+	AverageRating float64             `xml:"averageRating,attr,omitempty" json:"averageRating,omitempty"`
 	Comment       string              `xml:"comment,attr,omitempty" json:"comment,omitempty"`
 	Type          string              `xml:"type,attr,omitempty" json:"type,omitempty"`
 	MediaType     string              `xml:"mediaType,attr,omitempty" json:"mediaType,omitempty"`
@@ -486,6 +525,7 @@ type SubsonicArtistWithAlbums struct {
 	Name       string          `xml:"name,attr" json:"name"`
 	CoverArt   string          `xml:"coverArt,attr,omitempty" json:"coverArt,omitempty"`
 	AlbumCount int             `xml:"albumCount,attr" json:"albumCount"`
+	SortName   string          `xml:"sortName,attr,omitempty" json:"sortName,omitempty"`
 	Albums     []SubsonicAlbum `xml:"album" json:"album"`
 }
 
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Subsonic token/salt authentication needs the user's real password on the
+// server (token = md5(password + salt)), which is why users.password_plain
+// exists. Rather than keeping it in clear text, the value is stored encrypted
+// with AES-GCM under a key derived from PASSWORD_ENCRYPTION_KEY (falling back
+// to JWT_SECRET). Admins who don't need token auth can set the configuration
+// key disable_plaintext_passwords=true, which wipes the column and turns token
+// auth off entirely; API keys and u/p auth keep working.
+
+const encryptedPasswordPrefix = "enc:v1:"
+
+var (
+	passwordKeyOnce sync.Once
+	passwordKey     []byte
+)
+
+// passwordEncryptionKey returns the 32-byte AES key, or nil when no secret is
+// configured (in which case passwords cannot be encrypted at rest).
+func passwordEncryptionKey() []byte {
+	passwordKeyOnce.Do(func() {
+		secret := os.Getenv("PASSWORD_ENCRYPTION_KEY")
+		if secret == "" {
+			secret = os.Getenv("JWT_SECRET")
+		}
+		if secret == "" {
+			return
+		}
+		sum := sha256.Sum256([]byte(secret))
+		passwordKey = sum[:]
+	})
+	return passwordKey
+}
+
+// plaintextPasswordsDisabled reports whether the admin has opted out of storing
+// recoverable passwords (and therefore out of token/salt auth).
+func plaintextPasswordsDisabled() bool {
+	return configBool(db, "disable_plaintext_passwords")
+}
+
+// encryptPassword encrypts a password for storage in users.password_plain.
+// Without a configured key the value is returned unchanged (legacy behaviour).
+func encryptPassword(plain string) (string, error) {
+	key := passwordEncryptionKey()
+	if key == nil || plain == "" {
+		return plain, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedPasswordPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptPassword reverses encryptPassword. Values without the encrypted prefix
+// are legacy plain text and are returned as-is.
+func decryptPassword(stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPasswordPrefix) {
+		return stored, nil
+	}
+	key := passwordEncryptionKey()
+	if key == nil {
+		return "", errors.New("password is encrypted but PASSWORD_ENCRYPTION_KEY/JWT_SECRET is not set")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPasswordPrefix))
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return "", errors.New("encrypted password is too short")
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// storedPlainPassword returns the value to write to users.password_plain for a
+// newly set password: empty when plaintext storage is disabled, otherwise the
+// encrypted password.
+func storedPlainPassword(plain string) (string, error) {
+	if plaintextPasswordsDisabled() {
+		return "", nil
+	}
+	return encryptPassword(plain)
+}
+
+// clearStoredPlainPasswords wipes every recoverable password. The column is
+// NOT NULL in older schemas, so it is blanked rather than set to NULL.
+func clearStoredPlainPasswords(db *sql.DB) (int64, error) {
+	res, err := db.Exec(`UPDATE users SET password_plain = '' WHERE password_plain IS NOT NULL AND password_plain != ''`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// encryptLegacyPlainPasswords encrypts any password_plain values still stored
+// in clear text. It is a no-op when no encryption key is configured.
+func encryptLegacyPlainPasswords(db *sql.DB) (int, error) {
+	if passwordEncryptionKey() == nil {
+		return 0, nil
+	}
+	rows, err := db.Query(`SELECT id, password_plain FROM users WHERE password_plain IS NOT NULL AND password_plain != '' AND password_plain NOT LIKE ?`,
+		encryptedPasswordPrefix+"%")
+	if err != nil {
+		return 0, err
+	}
+	type pending struct {
+		id    int
+		plain string
+	}
+	var todo []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.plain); err != nil {
+			log.Printf("encryptLegacyPlainPasswords: scan failed: %v", err)
+			continue
+		}
+		todo = append(todo, p)
+	}
+	rows.Close()
+
+	encrypted := 0
+	for _, p := range todo {
+		enc, err := encryptPassword(p.plain)
+		if err != nil {
+			return encrypted, err
+		}
+		if _, err := db.Exec(`UPDATE users SET password_plain = ? WHERE id = ?`, enc, p.id); err != nil {
+			return encrypted, err
+		}
+		encrypted++
+	}
+	return encrypted, nil
+}
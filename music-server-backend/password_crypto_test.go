@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withPasswordKey points the lazily-derived encryption key at secret for the
+// duration of a test.
+func withPasswordKey(t *testing.T, secret string) {
+	t.Helper()
+	t.Setenv("PASSWORD_ENCRYPTION_KEY", secret)
+	passwordKeyOnce, passwordKey = sync.Once{}, nil
+	t.Cleanup(func() { passwordKeyOnce, passwordKey = sync.Once{}, nil })
+}
+
+func TestLegacyPasswordsEncryptedAndTokenAuthStillWorks(t *testing.T) {
+	withPasswordKey(t, "test-secret")
+	db = setupFullTestDB(t)
+	defer db.Close()
+	stmts := []string{
+		`CREATE TABLE configuration (key TEXT PRIMARY KEY NOT NULL, value TEXT)`,
+		`CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT UNIQUE NOT NULL, password_hash TEXT NOT NULL DEFAULT '',
+			password_plain TEXT NOT NULL DEFAULT '', is_admin BOOLEAN NOT NULL DEFAULT 0, api_key TEXT UNIQUE)`,
+		`INSERT INTO users (id, username, password_plain) VALUES (1, 'alice', 'hunter2')`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+
+	if n, err := encryptLegacyPlainPasswords(db); err != nil || n != 1 {
+		t.Fatalf("expected 1 password encrypted, got %d (%v)", n, err)
+	}
+	var stored string
+	_ = db.QueryRow(`SELECT password_plain FROM users WHERE id = 1`).Scan(&stored)
+	if !strings.HasPrefix(stored, encryptedPasswordPrefix) || strings.Contains(stored, "hunter2") {
+		t.Fatalf("password not encrypted at rest: %q", stored)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/rest/ping.view", SubsonicAuthMiddleware(), subsonicPing)
+	sum := md5.Sum([]byte("hunter2" + "abc"))
+	tokenURL := "/rest/ping.view?u=alice&t=" + hex.EncodeToString(sum[:]) + "&s=abc&f=json"
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tokenURL, nil))
+	if !strings.Contains(w.Body.String(), `"status":"ok"`) {
+		t.Fatalf("token auth should work with an encrypted password: %s", w.Body.String())
+	}
+
+	// Disabling plaintext passwords wipes the column and rejects token auth.
+	if _, err := db.Exec(`INSERT INTO configuration (key, value) VALUES ('disable_plaintext_passwords', 'true')`); err != nil {
+		t.Fatalf("set config: %v", err)
+	}
+	if _, err := clearStoredPlainPasswords(db); err != nil {
+		t.Fatalf("clear passwords: %v", err)
+	}
+	_ = db.QueryRow(`SELECT password_plain FROM users WHERE id = 1`).Scan(&stored)
+	if stored != "" {
+		t.Fatalf("expected stored password to be wiped, got %q", stored)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tokenURL, nil))
+	if !strings.Contains(w.Body.String(), `"code":42`) {
+		t.Fatalf("token auth should be rejected when disabled: %s", w.Body.String())
+	}
+}
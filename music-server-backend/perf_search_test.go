@@ -30,6 +30,7 @@ func buildLargeDB(tb testing.TB, n int) *sql.DB {
 		replaygain_track_gain REAL, replaygain_track_peak REAL,
 		replaygain_album_gain REAL, replaygain_album_peak REAL,
 		track INTEGER DEFAULT 0, year INTEGER DEFAULT 0, disc_number INTEGER DEFAULT 0, size INTEGER DEFAULT 0, bitrate INTEGER DEFAULT 0, sample_rate INTEGER DEFAULT 0, channels INTEGER DEFAULT 0, bit_depth INTEGER DEFAULT 0, comment TEXT DEFAULT '',
+		search_text TEXT NOT NULL DEFAULT '',
 		cancelled INTEGER NOT NULL DEFAULT 0
 	);`
 	if _, err := d.Exec(schema); err != nil {
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// play_history gets a row for every scrobble, so it grows without bound. With
+// play_history_retention_days set, rows older than that many days are removed
+// daily (playHistoryPruneSchedule; buildScheduler adds the job only while the
+// setting is on) and on demand from the admin API; 0, the default, keeps every
+// row. Before rows go their plays are rolled up into user_song_stats, one row
+// per user and song with the play count and last play of the pruned history,
+// so per-user totals are play_history plus user_song_stats.
+const playHistoryPruneSchedule = "30 3 * * *"
+
+// ensureUserSongStatsTable creates user_song_stats.
+func ensureUserSongStatsTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS user_song_stats (
+		user_id INTEGER NOT NULL,
+		song_id TEXT NOT NULL,
+		play_count INTEGER NOT NULL DEFAULT 0,
+		last_played TEXT,
+		PRIMARY KEY (user_id, song_id),
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY(song_id) REFERENCES songs(id) ON DELETE CASCADE
+	)`)
+	return err
+}
+
+// playHistoryRetentionDays reads play_history_retention_days; 0 keeps
+// everything.
+func playHistoryRetentionDays() int {
+	return configInt(db, "play_history_retention_days", 0)
+}
+
+// prunePlayHistory rolls the play_history rows older than days into
+// user_song_stats and deletes them, in one transaction. It returns how many
+// rows were deleted.
+func prunePlayHistory(db *sql.DB, days int) (int64, error) {
+	// played_at is written with time.RFC3339 in local time.
+	cutoff := time.Now().AddDate(0, 0, -days).Format(time.RFC3339)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO user_song_stats (user_id, song_id, play_count, last_played)
+		SELECT user_id, song_id, COUNT(*), MAX(played_at) FROM play_history WHERE played_at < ? GROUP BY user_id, song_id
+		ON CONFLICT(user_id, song_id) DO UPDATE SET
+			play_count = play_count + excluded.play_count,
+			last_played = MAX(COALESCE(last_played, ''), excluded.last_played)`, cutoff); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(`DELETE FROM play_history WHERE played_at < ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// runPlayHistoryRetention is the scheduled job.
+func runPlayHistoryRetention() {
+	days := playHistoryRetentionDays()
+	if days <= 0 {
+		return // turned off since the job was scheduled
+	}
+	n, err := prunePlayHistory(db, days)
+	if err != nil {
+		log.Printf("Scheduled play history cleanup failed: %v", err)
+		return
+	}
+	log.Printf("Scheduled play history cleanup removed %d plays older than %d days", n, days)
+}
+
+// prunePlayHistoryHandler handles POST /api/v1/admin/play-history/prune,
+// running the cleanup now. olderThanDays overrides the configured retention.
+func prunePlayHistoryHandler(c *gin.Context) {
+	days := playHistoryRetentionDays()
+	if v := c.Query("olderThanDays"); v != "" {
+		var err error
+		if days, err = strconv.Atoi(v); err != nil || days < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "olderThanDays must be a positive number of days"})
+			return
+		}
+	}
+	if days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "play_history_retention_days is not set; pass olderThanDays"})
+		return
+	}
+	n, err := prunePlayHistory(db, days)
+	if err != nil {
+		log.Printf("prunePlayHistory: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clean up play history"})
+		return
+	}
+	log.Printf("Removed %d plays older than %d days from play history", n, days)
+	c.JSON(http.StatusOK, gin.H{"deleted": n, "olderThanDays": days})
+}
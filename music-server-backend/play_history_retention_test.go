@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPrunePlayHistoryRollsUpIntoUserSongStats(t *testing.T) {
+	d := scanTestDB(t)
+	if _, err := d.Exec(`CREATE TABLE play_history (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, song_id TEXT NOT NULL, played_at TEXT NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureUserSongStatsTable(d); err != nil {
+		t.Fatal(err)
+	}
+	daysAgo := func(n int) string { return time.Now().AddDate(0, 0, -n).Format(time.RFC3339) }
+	play := func(user int, song string, at string) {
+		t.Helper()
+		if _, err := d.Exec(`INSERT INTO play_history (user_id, song_id, played_at) VALUES (?, ?, ?)`, user, song, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	play(1, "a", daysAgo(400))
+	play(1, "a", daysAgo(200))
+	play(2, "a", daysAgo(300))
+	play(1, "a", daysAgo(1))
+
+	if n, err := prunePlayHistory(d, 90); err != nil || n != 3 {
+		t.Fatalf("prune removed %d rows (%v), want 3", n, err)
+	}
+	// A later prune adds to the rolled-up counts.
+	play(1, "a", daysAgo(100))
+	if n, err := prunePlayHistory(d, 90); err != nil || n != 1 {
+		t.Fatalf("second prune removed %d rows (%v), want 1", n, err)
+	}
+
+	stats := func(user int) (count int, last string) {
+		d.QueryRow(`SELECT play_count, last_played FROM user_song_stats WHERE user_id = ? AND song_id = 'a'`, user).Scan(&count, &last)
+		return
+	}
+	if count, last := stats(1); count != 3 || last != daysAgo(100) {
+		t.Errorf("user 1 stats = %d, %s; want 3 plays, last %s", count, last, daysAgo(100))
+	}
+	if count, _ := stats(2); count != 1 {
+		t.Errorf("user 2 stats = %d plays, want 1", count)
+	}
+	var left int
+	d.QueryRow(`SELECT COUNT(*) FROM play_history`).Scan(&left)
+	if left != 1 {
+		t.Errorf("%d plays left in history, want the recent one", left)
+	}
+
+	// Recently played still lists songs whose plays were all pruned.
+	if _, err := d.Exec(`INSERT INTO songs (id, title, artist, album, path, date_added) VALUES ('a', 'Song A', 'Artist', 'Album', '/m/a.mp3', ?)`, daysAgo(500)); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/recent", func(c *gin.Context) { c.Set("userID", 2); getRecentlyPlayed(c) })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/recent", nil))
+	var recent []Song
+	if err := json.Unmarshal(w.Body.Bytes(), &recent); err != nil || len(recent) != 1 || recent[0].ID != "a" {
+		t.Errorf("user 2 recently played = %s, want song a from the rolled-up stats", w.Body.String())
+	}
+
+	r.POST("/prune", prunePlayHistoryHandler)
+	for query, want := range map[string]int{
+		"":                 http.StatusBadRequest, // retention not configured
+		"?olderThanDays=0": http.StatusBadRequest,
+		"?olderThanDays=x": http.StatusBadRequest,
+		"?olderThanDays=7": http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/prune"+query, nil))
+		if w.Code != want {
+			t.Errorf("POST /prune%s = %d, want %d", query, w.Code, want)
+		}
+	}
+}
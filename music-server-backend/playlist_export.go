@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Playlist export, the counterpart of importPlaylist. GET
+// /api/v1/playlist/:id/export?format=m3u|json downloads a playlist the caller
+// may see (their own, an admin's or a public one). The M3U flavour is an
+// extended M3U8 whose entries are signed stream URLs by default, or the song
+// paths with entries=path, which is what importPlaylist and local players
+// need. The JSON flavour carries the full song objects, including their paths.
+//
+// The stream URLs stay valid for the playlist's length plus
+// playlistExportGrace, capped at signedStreamDefaultTTL, and die with the
+// exporting user's session on logout; the file is meant to be played, not
+// kept. Paths are relative to the song's library folder unless the caller is
+// an admin, so the export does not reveal the server's directory layout.
+
+// playlistExportGrace is added to the playlist's duration for the lifetime of
+// exported stream URLs, to allow for pauses and a late start.
+const playlistExportGrace = time.Hour
+
+// playlistExport is the JSON export document.
+type playlistExport struct {
+	ID         int            `json:"id"`
+	Name       string         `json:"name"`
+	Owner      string         `json:"owner"`
+	Public     bool           `json:"public"`
+	SongCount  int            `json:"songCount"`
+	Duration   int            `json:"duration"`
+	ExportedAt string         `json:"exportedAt"`
+	Songs      []SubsonicSong `json:"songs"`
+}
+
+// m3uInfoText is the "Artist - Title" part of an #EXTINF line. Line breaks
+// would end the directive, so they are flattened.
+func m3uInfoText(artist, title string) string {
+	text := title
+	if artist != "" {
+		text = artist + " - " + title
+	}
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(text)
+}
+
+// exportPlaylist handles GET /api/v1/playlist/:id/export.
+func exportPlaylist(c *gin.Context) {
+	userID := c.GetInt("userID")
+	format := c.DefaultQuery("format", "m3u")
+	if format != "m3u" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be m3u or json"})
+		return
+	}
+	entries := c.DefaultQuery("entries", "stream")
+	if entries != "stream" && entries != "path" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "entries must be stream or path"})
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return
+	}
+
+	export := playlistExport{ID: id}
+	var ownerIsAdmin bool
+	err = db.QueryRow(
+		"SELECT p.name, u.username, u.is_admin, COALESCE(p.public, 0) FROM playlists p JOIN users u ON p.user_id = u.id WHERE p.id = ? AND (p.user_id = ? OR u.is_admin = 1 OR p.public = 1)",
+		id, userID,
+	).Scan(&export.Name, &export.Owner, &ownerIsAdmin, &export.Public)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return
+	}
+	export.Public = export.Public || ownerIsAdmin
+
+	results, err := GetPlaylistSongs(db, id, userID)
+	if err != nil {
+		log.Printf("Error fetching songs for playlist export %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var roots []string
+	if !c.GetBool("isAdmin") {
+		if roots, err = libraryRoots(db); err != nil {
+			log.Printf("Error reading library paths for playlist export %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+	export.Songs = make([]SubsonicSong, 0, len(results))
+	for _, r := range results {
+		song := buildSubsonicSong(r)
+		song.Path = r.Path
+		if !c.GetBool("isAdmin") {
+			song.Path = libraryRelativePath(r.Path, roots)
+		}
+		export.Duration += song.Duration
+		export.Songs = append(export.Songs, song)
+	}
+	export.SongCount = len(export.Songs)
+
+	if format == "json" {
+		export.ExportedAt = time.Now().UTC().Format(time.RFC3339)
+		c.Header("Content-Disposition", attachmentDisposition(sanitizeZipName(export.Name)+".json"))
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	version, err := streamTokenVersion(userID)
+	if err != nil {
+		log.Printf("Stream token version lookup for user %d failed: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not sign stream URLs"})
+		return
+	}
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&b, "#PLAYLIST:%s\n", m3uInfoText("", export.Name))
+	expires := time.Now().Add(min(time.Duration(export.Duration)*time.Second+playlistExportGrace, signedStreamDefaultTTL))
+	for _, s := range export.Songs {
+		fmt.Fprintf(&b, "#EXTINF:%d,%s\n", s.Duration, m3uInfoText(s.Artist, s.Title))
+		if entries == "path" {
+			b.WriteString(s.Path)
+		} else {
+			b.WriteString(signedStreamURL(c, s.ID, userID, version, expires))
+		}
+		b.WriteString("\n")
+	}
+	c.Header("Content-Disposition", attachmentDisposition(sanitizeZipName(export.Name)+".m3u8"))
+	c.Data(http.StatusOK, "audio/x-mpegurl; charset=utf-8", []byte(b.String()))
+}
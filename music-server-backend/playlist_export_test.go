@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExportPlaylist(t *testing.T) {
+	d := scanTestDB(t)
+	for _, stmt := range []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, is_admin BOOLEAN NOT NULL DEFAULT 0, stream_token_version INTEGER NOT NULL DEFAULT 0)`,
+		`INSERT INTO users (id, username) VALUES (1, 'alice'), (2, 'bob')`,
+		`CREATE TABLE playlists (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, user_id INTEGER, public INTEGER DEFAULT 0)`,
+		`CREATE TABLE playlist_songs (playlist_id INTEGER NOT NULL, song_id TEXT NOT NULL, position INTEGER NOT NULL)`,
+		`INSERT INTO playlists (id, name, user_id) VALUES (1, 'Mix: Best', 1), (2, 'Secret', 2)`,
+		`INSERT INTO songs (id, title, artist, album, duration, path) VALUES
+			('s1', 'One', 'Band', 'A', 201, '/music/A/01 One.mp3'),
+			('s2', 'Two', '', 'A', 95, '/music/A/02 Two.flac')`,
+		`INSERT INTO library_paths (id, path) VALUES (1, '/music')`,
+		`INSERT INTO playlist_songs VALUES (1, 's2', 0), (1, 's1', 1), (2, 's1', 0)`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	admin := false
+	r := gin.New()
+	r.GET("/playlist/:id/export", func(c *gin.Context) { c.Set("userID", 1); c.Set("isAdmin", admin); exportPlaylist(c) })
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := get("/playlist/1/export?entries=path")
+	if w.Code != http.StatusOK {
+		t.Fatalf("m3u: %d %s", w.Code, w.Body.String())
+	}
+	want := "#EXTM3U\n#PLAYLIST:Mix: Best\n#EXTINF:95,Two\nA/02 Two.flac\n#EXTINF:201,Band - One\nA/01 One.mp3\n"
+	if w.Body.String() != want {
+		t.Errorf("m3u =\n%s", w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "Mix_ Best.m3u8") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	w = get("/playlist/1/export")
+	if !strings.Contains(w.Body.String(), "/stream/signed?") || strings.Contains(w.Body.String(), "/music/") {
+		t.Errorf("stream m3u =\n%s", w.Body.String())
+	}
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		u, err := url.Parse(line)
+		if err != nil || u.Query().Get("exp") == "" {
+			continue
+		}
+		exp, _ := strconv.ParseInt(u.Query().Get("exp"), 10, 64)
+		// 296 seconds of music plus the grace period
+		if left := time.Until(time.Unix(exp, 0)); left > playlistExportGrace+5*time.Minute+time.Minute {
+			t.Errorf("stream URL valid for %s", left)
+		}
+	}
+
+	w = get("/playlist/1/export?format=json")
+	var export playlistExport
+	if err := json.Unmarshal(w.Body.Bytes(), &export); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("json: %d %s", w.Code, w.Body.String())
+	}
+	if export.Owner != "alice" || export.SongCount != 2 || export.Duration != 296 ||
+		export.Songs[0].ID != "s2" || export.Songs[1].Path != "A/01 One.mp3" {
+		t.Errorf("export = %+v", export)
+	}
+
+	admin = true
+	if w := get("/playlist/1/export?entries=path"); !strings.Contains(w.Body.String(), "\n/music/A/01 One.mp3\n") {
+		t.Errorf("admin m3u should keep absolute paths:\n%s", w.Body.String())
+	}
+	admin = false
+
+	if w := get("/playlist/2/export"); w.Code != http.StatusNotFound {
+		t.Errorf("private playlist of another user: %d", w.Code)
+	}
+	d.Exec(`UPDATE playlists SET public = 1 WHERE id = 2`)
+	if w := get("/playlist/2/export"); w.Code != http.StatusOK {
+		t.Errorf("public playlist of another user: %d", w.Code)
+	}
+	if w := get("/playlist/1/export?format=pls"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: %d", w.Code)
+	}
+}
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -23,3 +24,27 @@ func addSongToPlaylist(c *gin.Context) {
 	// Placeholder
 	c.JSON(http.StatusOK, gin.H{"message": "Song added to playlist"})
 }
+
+// dedupePlaylist handles POST /api/v1/playlist/:id/dedupe. The same users who
+// may edit the playlist through updatePlaylist may dedupe it: the owner, or
+// any admin when the owner is an admin.
+func dedupePlaylist(c *gin.Context) {
+	userID := c.GetInt("userID")
+	id := c.Param("id")
+
+	var ownerID int
+	var ownerIsAdmin bool
+	err := db.QueryRow("SELECT p.user_id, u.is_admin FROM playlists p JOIN users u ON p.user_id = u.id WHERE p.id = ?", id).Scan(&ownerID, &ownerIsAdmin)
+	if err != nil || (ownerID != userID && !(ownerIsAdmin && c.GetBool("isAdmin"))) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return
+	}
+
+	removed, err := DedupePlaylist(db, id)
+	if err != nil {
+		log.Printf("Error removing duplicates from playlist %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove duplicates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"removed": removed})
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Playlist import. POST /api/v1/playlists/import takes an M3U or M3U8 file in
+// the multipart field "file" and turns it into a playlist owned by the caller.
+// Playlists written by other players rarely carry the exact paths this server
+// scanned, so each entry is tried in order of confidence:
+//
+//  1. the exact path, as GetSongIDByPath looks it up;
+//  2. the same path with either separator;
+//  3. the last three, then two, path components (a different mount point);
+//  4. the file name, ignoring case and extension;
+//  5. the artist and title from its #EXTINF line, ignoring case.
+//
+// Steps 3 to 5 only accept a single candidate. Entries that match nothing are
+// reported back with their line number instead of failing the import.
+
+// m3uEntry is one media line of a playlist with the #EXTINF hints before it.
+type m3uEntry struct {
+	Line   int    `json:"line"`
+	Entry  string `json:"entry"`
+	artist string
+	title  string
+}
+
+// parseM3U reads an M3U/M3U8 playlist. Files that are not valid UTF-8 are
+// taken as Latin-1, the usual encoding of plain .m3u files. name is the
+// #PLAYLIST directive, if any.
+func parseM3U(data []byte) (name string, entries []m3uEntry) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	text := string(data)
+	if !utf8.Valid(data) {
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	}
+
+	var artist, title string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			// #EXTINF:<seconds>[ attributes],<Artist> - <Title>
+			artist, title = "", ""
+			if _, info, ok := strings.Cut(line, ","); ok {
+				if a, t, ok := strings.Cut(info, " - "); ok {
+					artist, title = strings.TrimSpace(a), strings.TrimSpace(t)
+				} else {
+					title = strings.TrimSpace(info)
+				}
+			}
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#"):
+		default:
+			entries = append(entries, m3uEntry{Line: lineNo, Entry: line, artist: artist, title: title})
+			artist, title = "", ""
+		}
+	}
+	return name, entries
+}
+
+// m3uEntryPath returns the file path of an entry, decoding file:// URLs.
+// Other URLs (streams) have no path and return "".
+func m3uEntryPath(entry string) string {
+	if u, err := url.Parse(entry); err == nil && len(u.Scheme) > 1 {
+		if !strings.EqualFold(u.Scheme, "file") {
+			return ""
+		}
+		p := u.Path
+		// file:///C:/Music/x.mp3 parses to /C:/Music/x.mp3
+		if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+			p = p[1:]
+		}
+		return p
+	}
+	return entry
+}
+
+// resolvePlaylistEntry finds the song an entry refers to, returning "" when
+// none matches.
+func resolvePlaylistEntry(e m3uEntry) (string, error) {
+	if p := m3uEntryPath(e.Entry); p != "" {
+		if id, err := uniqueSongID(`path = ?`, p); id != "" || err != nil {
+			return id, err
+		}
+
+		normalized := slashPath(p)
+		if id, err := uniqueSongID(`REPLACE(path, '\', '/') = ?`, normalized); id != "" || err != nil {
+			return id, err
+		}
+
+		parts := strings.Split(strings.TrimPrefix(normalized, "/"), "/")
+		for _, n := range []int{3, 2} {
+			if len(parts) <= n {
+				continue
+			}
+			suffix := strings.Join(parts[len(parts)-n:], "/")
+			if id, err := uniqueSongID(`REPLACE(path, '\', '/') LIKE ? ESCAPE '!'`, "%/"+likeEscaper.Replace(suffix)); id != "" || err != nil {
+				return id, err
+			}
+		}
+
+		base := path.Base(normalized)
+		stem := strings.TrimSuffix(base, path.Ext(base))
+		if stem != "" && stem != "." && stem != "/" {
+			if id, err := uniqueSongID(`REPLACE(path, '\', '/') LIKE ? ESCAPE '!'`, "%/"+likeEscaper.Replace(stem)+".%"); id != "" || err != nil {
+				return id, err
+			}
+		}
+	}
+
+	if e.title != "" && e.artist != "" {
+		return uniqueSongID(`title = ? COLLATE NOCASE AND (artist = ? COLLATE NOCASE OR album_artist = ? COLLATE NOCASE)`,
+			e.title, e.artist, e.artist)
+	}
+	return "", nil
+}
+
+// uniqueSongID returns the id of the only non-cancelled song matching where,
+// or "" when there is none or more than one.
+func uniqueSongID(where string, args ...interface{}) (string, error) {
+	rows, err := db.Query("SELECT id FROM songs WHERE cancelled = 0 AND "+where+" LIMIT 2", args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return "", err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(ids) != 1 {
+		return "", nil
+	}
+	return ids[0], nil
+}
+
+// importPlaylist handles POST /api/v1/playlists/import. The optional form
+// field "name" overrides the playlist's #PLAYLIST name and file name.
+func importPlaylist(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing playlist file"})
+		return
+	}
+	f, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read playlist file"})
+		return
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read playlist file"})
+		return
+	}
+
+	listName, entries := parseM3U(data)
+	name := strings.TrimSpace(c.PostForm("name"))
+	if name == "" {
+		name = listName
+	}
+	if name == "" {
+		base := filepath.Base(strings.ReplaceAll(fileHeader.Filename, `\`, "/"))
+		name = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if name == "" || name == "." {
+		name = "Imported playlist"
+	}
+	if len(entries) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The playlist has no entries"})
+		return
+	}
+
+	var songIDs []string
+	unmatched := []m3uEntry{}
+	for _, e := range entries {
+		id, err := resolvePlaylistEntry(e)
+		if err != nil {
+			log.Printf("Playlist import: failed to resolve %q: %v", e.Entry, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if id == "" {
+			unmatched = append(unmatched, e)
+			continue
+		}
+		songIDs = append(songIDs, id)
+	}
+	if len(songIDs) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "No entries matched songs in the library", "unmatched": unmatched})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO playlists (name, user_id) VALUES (?, ?)", name, c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create playlist"})
+		return
+	}
+	newID, _ := res.LastInsertId()
+
+	stmt, err := tx.Prepare("INSERT INTO playlist_songs (playlist_id, song_id, position) VALUES (?, ?, ?)")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare insert"})
+		return
+	}
+	defer stmt.Close()
+
+	for i, sid := range songIDs {
+		if _, err := stmt.Exec(newID, sid, i); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add song to playlist"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"playlistId": newID,
+		"name":       name,
+		"matched":    len(songIDs),
+		"unmatched":  unmatched,
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseM3U(t *testing.T) {
+	data := []byte("\ufeff#EXTM3U\n#PLAYLIST:Road Trip\n#EXTINF:201,Band - Song One\n/m/a.mp3\n\n# comment\nfile:///C:/Music/b.flac\n")
+	name, entries := parseM3U(data)
+	if name != "Road Trip" || len(entries) != 2 {
+		t.Fatalf("name %q, entries %+v", name, entries)
+	}
+	if e := entries[0]; e.Line != 4 || e.artist != "Band" || e.title != "Song One" {
+		t.Errorf("entries[0] = %+v", e)
+	}
+	if e := entries[1]; e.artist != "" || m3uEntryPath(e.Entry) != "C:/Music/b.flac" {
+		t.Errorf("entries[1] = %+v", e)
+	}
+
+	_, entries = parseM3U([]byte("/m/Caf\xe9.mp3\n"))
+	if len(entries) != 1 || entries[0].Entry != "/m/Café.mp3" {
+		t.Errorf("Latin-1 entry = %+v", entries)
+	}
+}
+
+func TestImportPlaylist(t *testing.T) {
+	d := scanTestDB(t)
+	for _, stmt := range []string{
+		`CREATE TABLE playlists (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, user_id INTEGER, public INTEGER DEFAULT 0)`,
+		`CREATE TABLE playlist_songs (playlist_id INTEGER NOT NULL, song_id TEXT NOT NULL, position INTEGER NOT NULL)`,
+		`INSERT INTO songs (id, title, artist, path) VALUES
+			('exact', 'One', 'Band', '/music/Band/Album/01 One.mp3'),
+			('win', 'Two', 'Band', 'D:\Music\Band\Album\02 Two.mp3'),
+			('moved', 'Three', 'Band', '/music/Band/Album/03 Three.mp3'),
+			('stem', 'Four', 'Band', '/music/Other/04 Four.flac'),
+			('tagged', 'Five', 'Band', '/music/Band/Album/05.mp3'),
+			('dupe1', 'Six', 'Band', '/music/A/06 Six.mp3'),
+			('dupe2', 'Six', 'Band', '/music/B/06 Six.mp3')`,
+		`INSERT INTO songs (id, title, artist, path, cancelled) VALUES ('gone', 'Seven', 'Band', '/music/Band/Album/07 Seven.mp3', 1)`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	playlist := "#EXTM3U\n" +
+		"/music/Band/Album/01 One.mp3\n" +
+		"D:/Music/Band/Album/02 Two.mp3\n" +
+		"/mnt/nas/Band/Album/03 Three.mp3\n" +
+		"..\\Somewhere\\04 FOUR.mp3\n" +
+		"#EXTINF:180,band - five\n" +
+		"missing/05 Five.ogg\n" +
+		"/elsewhere/06 Six.mp3\n" +
+		"/music/Band/Album/07 Seven.mp3\n" +
+		"http://radio.example/stream\n"
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "Favourites.m3u8")
+	fw.Write([]byte(playlist))
+	mw.Close()
+
+	r := gin.New()
+	r.POST("/playlists/import", func(c *gin.Context) { c.Set("userID", 7); importPlaylist(c) })
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/playlists/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		PlaylistID int64
+		Name       string
+		Matched    int
+		Unmatched  []m3uEntry
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Name != "Favourites" || resp.Matched != 5 || len(resp.Unmatched) != 3 {
+		t.Fatalf("response = %+v", resp)
+	}
+	// A cancelled song is not matched, not even by its exact path.
+	if resp.Unmatched[0].Line != 8 || resp.Unmatched[1].Line != 9 || resp.Unmatched[2].Entry != "http://radio.example/stream" {
+		t.Errorf("unmatched = %+v", resp.Unmatched)
+	}
+
+	var owner int
+	d.QueryRow(`SELECT user_id FROM playlists WHERE id = ?`, resp.PlaylistID).Scan(&owner)
+	if owner != 7 {
+		t.Errorf("owner = %d", owner)
+	}
+	rows, err := d.Query(`SELECT song_id FROM playlist_songs WHERE playlist_id = ? ORDER BY position`, resp.PlaylistID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		got = append(got, id)
+	}
+	want := []string{"exact", "win", "moved", "stem", "tagged"}
+	if len(got) != len(want) {
+		t.Fatalf("songs = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("songs = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus metrics. GET /metrics serves library and streaming gauges,
+// per-route request counts and latencies, and SQLite query latencies. It is
+// off by default: METRICS_ENABLED=true adds the endpoint, the request timing
+// middleware and the instrumented database driver. The endpoint exposes route
+// names and library size, so when METRICS_TOKEN is set scrapers must send it
+// as "Authorization: Bearer <token>".
+
+var (
+	httpDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	dbDurationBuckets   = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+)
+
+// metricsEnabled reports whether METRICS_ENABLED turns metrics collection on.
+func metricsEnabled() bool {
+	return getEnv("METRICS_ENABLED", "false") == "true"
+}
+
+// metricsRegistry holds only the server's own collectors, so a scrape does not
+// depend on what other packages register globally.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "audiomuse_http_requests_total",
+		Help: "HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "audiomuse_http_request_duration_seconds",
+		Help:    "HTTP request latency by route.",
+		Buckets: httpDurationBuckets,
+	}, []string{"method", "route"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "audiomuse_db_query_duration_seconds",
+		Help:    "SQLite statement latency by statement kind.",
+		Buckets: dbDurationBuckets,
+	}, []string{"op"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		httpRequestsTotal,
+		httpRequestDuration,
+		dbQueryDuration,
+		// Gauges are read from their sources at scrape time.
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "audiomuse_library_songs",
+			Help: "Songs in the library.",
+		}, librarySongCount),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "audiomuse_active_transcodes",
+			Help: "ffmpeg transcodes currently streaming to clients.",
+		}, func() float64 { return float64(activeTranscodes.Load()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "audiomuse_max_transcodes",
+			Help: "Concurrent transcodes allowed before streams fall back to the original file.",
+		}, func() float64 { return float64(maxConcurrentTranscodes()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "audiomuse_hls_sessions",
+			Help: "Live HLS transcoding sessions.",
+		}, func() float64 { return float64(hlsSessionCount()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "audiomuse_scan_in_progress",
+			Help: "1 while a library scan is running.",
+		}, scanInProgressValue),
+	)
+}
+
+func librarySongCount() float64 {
+	var songs int64
+	if err := db.QueryRow("SELECT COUNT(*) FROM songs WHERE cancelled = 0").Scan(&songs); err != nil {
+		log.Printf("Metrics: failed to count songs: %v", err)
+	}
+	return float64(songs)
+}
+
+func scanInProgressValue() float64 {
+	var scanning bool
+	db.QueryRow("SELECT is_scanning FROM scan_status WHERE id = 1").Scan(&scanning)
+	if scanning {
+		return 1
+	}
+	return 0
+}
+
+// metricsMiddleware counts and times every request by its route pattern.
+// Unmatched paths (static files, 404s) share one label so scanners and the
+// SPA cannot blow up the series count.
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		observeHTTPRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+func observeHTTPRequest(method, route string, status int, elapsed time.Duration) {
+	httpRequestsTotal.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpRequestDuration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+// observeDBQuery records one statement under its kind (select, insert, ...).
+func observeDBQuery(query string, elapsed time.Duration) {
+	dbQueryDuration.WithLabelValues(queryKind(query)).Observe(elapsed.Seconds())
+}
+
+// queryKind returns the lower-cased leading keyword of a statement, or
+// "other" for anything unusual, keeping the label set small.
+func queryKind(query string) string {
+	word, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	word, _, _ = strings.Cut(word, "\n")
+	switch kind := strings.ToLower(strings.TrimSpace(word)); kind {
+	case "select", "insert", "update", "delete", "replace", "with", "pragma", "begin", "commit", "rollback", "create", "alter", "drop":
+		return kind
+	default:
+		return "other"
+	}
+}
+
+var metricsHTTPHandler = promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+
+// prometheusMetricsHandler handles GET /metrics.
+func prometheusMetricsHandler(c *gin.Context) {
+	if token := getEnv("METRICS_TOKEN", ""); token != "" {
+		got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+	}
+	metricsHTTPHandler.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	d := scanTestDB(t)
+	d.Exec(`INSERT INTO songs (id, title, path) VALUES ('s1', 'A', '/m/a.mp3'), ('s2', 'B', '/m/b.mp3')`)
+	d.Exec(`INSERT INTO songs (id, title, path, cancelled) VALUES ('s3', 'C', '/m/c.mp3', 1)`)
+	d.Exec(`UPDATE scan_status SET is_scanning = 1`)
+
+	r := gin.New()
+	r.Use(metricsMiddleware())
+	r.GET("/metrics", prometheusMetricsHandler)
+	r.GET("/api/v1/song/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	for _, path := range []string{"/api/v1/song/s1", "/api/v1/song/s2", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("metrics: %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"audiomuse_library_songs 2\n",
+		"audiomuse_scan_in_progress 1\n",
+		"# TYPE audiomuse_active_transcodes gauge\n",
+		`audiomuse_http_requests_total{method="GET",route="/api/v1/song/:id",status="204"} 2` + "\n",
+		`audiomuse_http_requests_total{method="GET",route="unmatched",status="404"} 1` + "\n",
+		`audiomuse_http_request_duration_seconds_bucket{method="GET",route="/api/v1/song/:id",le="+Inf"} 2` + "\n",
+		`audiomuse_http_request_duration_seconds_count{method="GET",route="/api/v1/song/:id"} 2` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestTimedDriverRecordsQueries(t *testing.T) {
+	d, err := sql.Open(timedDriverName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.SetMaxOpenConns(1)
+
+	selects := func() uint64 { return dbQueryCount(t, "select") }
+	before := selects()
+	insertsBefore := dbQueryCount(t, "insert")
+
+	if _, err := d.Exec(`CREATE TABLE t (v INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := d.Prepare(`INSERT INTO t (v) VALUES (?)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		if _, err := stmt.Exec(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stmt.Close()
+	var n int
+	if err := d.QueryRow(`SELECT COUNT(*) FROM t`).Scan(&n); err != nil || n != 3 {
+		t.Fatalf("count = %d, %v", n, err)
+	}
+	rows, err := d.Query("\n\t\tSELECT v FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+
+	if got := selects() - before; got != 2 {
+		t.Errorf("recorded %d selects, want 2", got)
+	}
+	if got := dbQueryCount(t, "insert") - insertsBefore; got != 3 {
+		t.Errorf("recorded %d prepared inserts, want 3", got)
+	}
+}
+
+func TestPrometheusMetricsToken(t *testing.T) {
+	scanTestDB(t)
+	t.Setenv("METRICS_TOKEN", "s3cret")
+	r := gin.New()
+	r.GET("/metrics", prometheusMetricsHandler)
+	for auth, want := range map[string]int{"": 401, "Bearer wrong": 401, "Bearer s3cret": 200} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("Authorization %q: got %d, want %d", auth, w.Code, want)
+		}
+	}
+}
+
+// dbQueryCount returns how many statements of kind op have been recorded.
+func dbQueryCount(t *testing.T, op string) uint64 {
+	t.Helper()
+	families, err := metricsRegistry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != "audiomuse_db_query_duration_seconds" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "op" && l.GetValue() == op {
+					return m.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	return 0
+}
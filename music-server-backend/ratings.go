@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Song ratings. Every user can give a song 1 to 5 stars with setRating; songs
+// carry the caller's rating as userRating and the mean over all users as
+// averageRating, and getAlbumList(2) type=highest lists the albums with rated
+// songs by the mean rating of those songs. Ratings are read per response
+// (applySongRatings) rather than joined into every song query, so they change
+// without a library index rebuild. Albums and artists cannot be rated.
+
+// ensureSongRatingsTable creates song_ratings.
+func ensureSongRatingsTable(db *sql.DB) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS song_ratings (
+			user_id INTEGER NOT NULL,
+			song_id TEXT NOT NULL,
+			rating INTEGER NOT NULL CHECK (rating BETWEEN 1 AND 5),
+			rated_at TEXT,
+			PRIMARY KEY (user_id, song_id),
+			FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY(song_id) REFERENCES songs(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_song_ratings_song ON song_ratings (song_id)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlExecer is a *sql.DB or *sql.Tx.
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// setSongRating stores userID's rating of songID; 0 removes it.
+func setSongRating(execer sqlExecer, userID int, songID string, rating int) error {
+	if rating == 0 {
+		_, err := execer.Exec(`DELETE FROM song_ratings WHERE user_id = ? AND song_id = ?`, userID, songID)
+		return err
+	}
+	_, err := execer.Exec(`INSERT INTO song_ratings (user_id, song_id, rating, rated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id, song_id) DO UPDATE SET rating = excluded.rating, rated_at = excluded.rated_at`,
+		userID, songID, rating, time.Now().Format(time.RFC3339))
+	return err
+}
+
+// subsonicSetRating handles setRating.view: rating 1-5 rates the song id for
+// the caller, 0 removes the rating. Album and artist ids are answered with
+// error 70 rather than silently ignored.
+func subsonicSetRating(c *gin.Context) {
+	user := c.MustGet("user").(User)
+
+	songID := c.Query("id")
+	ratingParam := c.Query("rating")
+	if songID == "" || ratingParam == "" {
+		subsonicRespond(c, newSubsonicErrorResponse(10, "Required parameter is missing."))
+		return
+	}
+	rating, err := strconv.Atoi(ratingParam)
+	if err != nil || rating < 0 || rating > 5 {
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Rating must be between 0 and 5."))
+		return
+	}
+
+	if _, ok := resolveArtistIDToName(db, songID); ok || isAlbumID(songID) {
+		subsonicRespond(c, newSubsonicErrorResponse(70, "Only songs can be rated."))
+		return
+	}
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM songs WHERE id = ? AND cancelled = 0)", songID).Scan(&exists); err != nil || !exists {
+		subsonicRespond(c, newSubsonicErrorResponse(70, "Song not found."))
+		return
+	}
+	if err := setSongRating(db, user.ID, songID, rating); err != nil {
+		log.Printf("Error rating song %s for user %s: %v", songID, user.Username, err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error."))
+		return
+	}
+	subsonicRespond(c, newSubsonicResponse(nil))
+}
+
+// songRating is one song's rating as seen by one user.
+type songRating struct {
+	user    int
+	average float64
+}
+
+// songRatingsBatch bounds the ids bound into one ratings query.
+const songRatingsBatch = 500
+
+// songRatings returns the ratings of the given songs that have any, keyed by
+// song id.
+func songRatings(db *sql.DB, userID int, ids []string) (map[string]songRating, error) {
+	ratings := map[string]songRating{}
+	for start := 0; start < len(ids); start += songRatingsBatch {
+		batch := ids[start:min(start+songRatingsBatch, len(ids))]
+		args := make([]interface{}, 0, len(batch)+1)
+		args = append(args, userID)
+		for _, id := range batch {
+			args = append(args, id)
+		}
+		rows, err := db.Query(`SELECT song_id, COALESCE(MAX(CASE WHEN user_id = ? THEN rating END), 0), AVG(rating)
+			FROM song_ratings WHERE song_id IN (?`+strings.Repeat(",?", len(batch)-1)+`) GROUP BY song_id`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id string
+			var r songRating
+			if err := rows.Scan(&id, &r.user, &r.average); err == nil {
+				ratings[id] = r
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return ratings, nil
+}
+
+// applySongRatings fills userRating and averageRating on songs for userID.
+// Failures are logged; the songs are still worth returning without ratings.
+func applySongRatings(userID int, songs []SubsonicSong) {
+	if len(songs) == 0 {
+		return
+	}
+	ids := make([]string, len(songs))
+	for i := range songs {
+		ids[i] = songs[i].ID
+	}
+	ratings, err := songRatings(db, userID, ids)
+	if err != nil {
+		log.Printf("Error reading song ratings: %v", err)
+		return
+	}
+	for i := range songs {
+		if r, ok := ratings[songs[i].ID]; ok {
+			songs[i].UserRating = r.user
+			songs[i].AverageRating = r.average
+		}
+	}
+}
+
+// albumRatingsCTE averages the rated songs of every album in one pass, so a
+// type=highest list does not run a subquery per albums row; albumRatingsJoin
+// keeps the albums with a rating and adds their average_rating.
+const (
+	albumRatingsCTE = `WITH album_ratings AS (
+		SELECT s.album AS rated_album, s.album_path AS rated_album_path, AVG(r.rating) AS average_rating
+		FROM song_ratings r JOIN songs s ON s.id = r.song_id
+		WHERE s.cancelled = 0
+		GROUP BY s.album, s.album_path
+	) `
+	albumRatingsJoin = ` JOIN album_ratings ON rated_album = albums.name AND rated_album_path = albums.album_path`
+)
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetRatingAndHighestAlbums(t *testing.T) {
+	d := scanTestDB(t)
+	if err := ensureSongRatingsTable(d); err != nil {
+		t.Fatal(err)
+	}
+	for i, album := range []string{"Good", "Great", "Unrated"} {
+		for track := 0; track < 2; track++ {
+			if _, err := d.Exec(`INSERT INTO songs (id, title, artist, album, path, album_path, date_added) VALUES (?, 't', 'Band', ?, ?, ?, '2024-01-01T00:00:00Z')`,
+				fmt.Sprintf("%s%d", strings.ToLower(album), track), album, fmt.Sprintf("/m/%d/%d.mp3", i, track), fmt.Sprintf("/m/%d", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := RebuildLibraryIndex(d); err != nil {
+		t.Fatal(err)
+	}
+
+	callHandler(t, subsonicSetRating, "id=good0&rating=3")
+	callHandler(t, subsonicSetRating, "id=great0&rating=2")
+	callHandler(t, subsonicSetRating, "id=great0&rating=5") // a second rating replaces the first
+	callHandler(t, subsonicSetRating, "id=great1&rating=4")
+	callHandler(t, subsonicSetRating, "id=unrated0&rating=1")
+	callHandler(t, subsonicSetRating, "id=unrated0&rating=0") // 0 removes it
+	d.Exec(`INSERT INTO song_ratings (user_id, song_id, rating) VALUES (2, 'good0', 4)`)
+
+	songs := []SubsonicSong{{ID: "good0"}, {ID: "great0"}, {ID: "unrated0"}}
+	applySongRatings(1, songs)
+	if songs[0].UserRating != 3 || songs[0].AverageRating != 3.5 || songs[1].UserRating != 5 ||
+		songs[2].UserRating != 0 || songs[2].AverageRating != 0 {
+		t.Errorf("ratings = %+v", songs)
+	}
+
+	list, _ := callHandler(t, subsonicGetAlbumList2, "type=highest")["albumList2"].(map[string]interface{})
+	var got []string
+	for _, a := range list["album"].([]interface{}) {
+		got = append(got, a.(map[string]interface{})["name"].(string))
+	}
+	if want := "Great Good"; strings.Join(got, " ") != want {
+		t.Errorf("getAlbumList2 type=highest = %v, want %s", got, want)
+	}
+
+	gin.SetMode(gin.TestMode)
+	invalidateArtistIDCache()
+	for query, code := range map[string]string{
+		"id=good0":            `"code":10`,
+		"id=good0&rating=6":   `"code":0`,
+		"id=good0&rating=x":   `"code":0`,
+		"id=missing&rating=3": `"code":70`,
+		"id=" + GenerateArtistID("Band") + "&rating=3": `"code":70`,
+		"id=" + AlbumID("Good", "/m/0") + "&rating=3":  `"code":70`,
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/rest/setRating?"+query+"&f=json", nil)
+		c.Set("user", User{ID: 1, Username: "test"})
+		subsonicSetRating(c)
+		if !strings.Contains(w.Body.String(), code) {
+			t.Errorf("setRating %s = %s, want error %s", query, w.Body.String(), code)
+		}
+	}
+}
+
+func TestAlbumListStarredAndHighestPaging(t *testing.T) {
+	d := scanTestDB(t)
+	if err := ensureSongRatingsTable(d); err != nil {
+		t.Fatal(err)
+	}
+	d.Exec(`CREATE TABLE starred_albums (user_id INTEGER, album_id TEXT, starred_at TEXT)`)
+	for i, a := range []struct{ album, genre string }{{"A", "Rock"}, {"B", "Rock"}, {"C", "Jazz"}, {"D", "Rock"}} {
+		for track := 0; track < 2; track++ {
+			if _, err := d.Exec(`INSERT INTO songs (id, title, artist, album, path, album_path, genre, date_added) VALUES (?, 't', 'Band', ?, ?, ?, ?, '2024-01-01T00:00:00Z')`,
+				fmt.Sprintf("%s%d", a.album, track), a.album, fmt.Sprintf("/m/%d/%d.mp3", i, track), fmt.Sprintf("/m/%d", i), a.genre); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := RebuildLibraryIndex(d); err != nil {
+		t.Fatal(err)
+	}
+	names := func(query string) string {
+		t.Helper()
+		list, _ := callHandler(t, subsonicGetAlbumList2, query)["albumList2"].(map[string]interface{})
+		albums, ok := list["album"].([]interface{})
+		if !ok {
+			t.Fatalf("%s: album list is %v, want an array", query, list["album"])
+		}
+		var got []string
+		for _, a := range albums {
+			got = append(got, a.(map[string]interface{})["name"].(string))
+		}
+		return strings.Join(got, " ")
+	}
+
+	// Nothing rated or starred yet: empty lists, not errors.
+	for _, query := range []string{"type=highest", "type=starred"} {
+		if got := names(query); got != "" {
+			t.Errorf("%s = %q before any rating or star", query, got)
+		}
+	}
+
+	for id, rating := range map[string]int{"A0": 2, "B0": 5, "C0": 4, "D1": 3} {
+		setSongRating(d, 1, id, rating)
+	}
+	d.Exec(`INSERT INTO starred_albums (user_id, album_id) VALUES (1, ?), (1, ?), (2, ?)`,
+		AlbumID("B", "/m/1"), AlbumID("C", "/m/2"), AlbumID("D", "/m/3"))
+
+	for query, want := range map[string]string{
+		"type=highest":                     "B C D A",
+		"type=highest&genre=Rock":          "B D A",
+		"type=highest&size=2&offset=1":     "C D",
+		"type=highest&genre=Rock&offset=2": "A",
+		"type=starred":                     "B C",
+		"type=starred&genre=Jazz":          "C",
+		"type=starred&size=1&offset=1":     "C",
+	} {
+		if got := names(query); got != want {
+			t.Errorf("%s = %q, want %q", query, got, want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scans never stop for a single bad file or folder: an unreadable folder is
+// skipped, a file whose tags cannot be read is indexed from its file name.
+// Each such failure is kept in scan_errors so admins can see what was skipped
+// without reading the logs. There is one row per path and category (the
+// latest failure wins). A full scan empties the table when it starts and a
+// single-path scan removes the rows under its path, so the list always
+// reflects the most recent scan of each library.
+
+// Scan error categories.
+const (
+	scanErrorWalk    = "walk"    // a folder or entry could not be listed or stat'ed
+	scanErrorOpen    = "open"    // the file could not be opened
+	scanErrorTag     = "tag"     // the tags could not be parsed
+	scanErrorFFprobe = "ffprobe" // ffprobe could not read the audio properties
+)
+
+const (
+	scanErrorsDefaultLimit = 100
+	scanErrorsMaxLimit     = 500
+)
+
+// recordScanError stores err as the latest failure of category for path.
+func recordScanError(path, category string, err error) {
+	if _, dbErr := db.Exec(`INSERT OR REPLACE INTO scan_errors (path, category, error, occurred_at) VALUES (?, ?, ?, ?)`,
+		path, category, err.Error(), time.Now().Format(time.RFC3339)); dbErr != nil {
+		log.Printf("Failed to record scan error for %s: %v", path, dbErr)
+	}
+}
+
+// clearScanErrors empties scan_errors; called when a full scan starts.
+func clearScanErrors() {
+	if _, err := db.Exec(`DELETE FROM scan_errors`); err != nil {
+		log.Printf("Failed to clear scan errors: %v", err)
+	}
+}
+
+// clearScanErrorsUnder removes the rows for root and everything below it;
+// called when a single library path is scanned.
+func clearScanErrorsUnder(root string) {
+	prefix := strings.TrimRight(root, string(filepath.Separator)) + string(filepath.Separator)
+	if _, err := db.Exec(`DELETE FROM scan_errors WHERE path = ? OR path LIKE ?`, root, prefix+"%"); err != nil {
+		log.Printf("Failed to clear scan errors for %s: %v", root, err)
+	}
+}
+
+// ScanError is one row of GET /api/v1/admin/scan-errors.
+type ScanError struct {
+	Path       string `json:"path"`
+	Category   string `json:"category"`
+	Error      string `json:"error"`
+	OccurredAt string `json:"occurredAt"`
+}
+
+// getScanErrors handles GET /api/v1/admin/scan-errors, newest first. It takes
+// limit (default 100, at most 500), offset and an optional category, and
+// returns the page with the total number of matching rows.
+func getScanErrors(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(scanErrorsDefaultLimit)))
+	if err != nil || limit <= 0 {
+		limit = scanErrorsDefaultLimit
+	}
+	limit = min(limit, scanErrorsMaxLimit)
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	category := c.Query("category")
+
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM scan_errors WHERE ? = '' OR category = ?`, category, category).Scan(&total); err != nil {
+		log.Printf("getScanErrors: count failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query scan errors"})
+		return
+	}
+	rows, err := db.Query(`SELECT path, category, error, occurred_at FROM scan_errors
+		WHERE ? = '' OR category = ?
+		ORDER BY occurred_at DESC, path, category LIMIT ? OFFSET ?`, category, category, limit, offset)
+	if err != nil {
+		log.Printf("getScanErrors: query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query scan errors"})
+		return
+	}
+	defer rows.Close()
+
+	errs := []ScanError{}
+	for rows.Next() {
+		var e ScanError
+		if err := rows.Scan(&e.Path, &e.Category, &e.Error, &e.OccurredAt); err != nil {
+			continue
+		}
+		errs = append(errs, e)
+	}
+	c.JSON(http.StatusOK, gin.H{"errors": errs, "total": total, "limit": limit, "offset": offset})
+}
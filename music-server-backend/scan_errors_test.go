@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type scanErrorsPage struct {
+	Errors []ScanError `json:"errors"`
+	Total  int         `json:"total"`
+}
+
+func fetchScanErrors(t *testing.T, rawQuery string) scanErrorsPage {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/admin/scan-errors?"+rawQuery, nil)
+	getScanErrors(c)
+	var page scanErrorsPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func TestScanRecordsErrorsAndContinues(t *testing.T) {
+	d := scanTestDB(t)
+	d.Exec(`INSERT INTO configuration (key, value) VALUES ('follow_symlinks', 'true')`)
+	lib := t.TempDir()
+	good := filepath.Join(lib, "01 - Good.mp3")
+	broken := filepath.Join(lib, "02 - Broken.mp3")
+	untagged := make([]byte, 1024) // no tags at all is not an error
+	os.WriteFile(good, untagged, 0o644)
+	// An ID3v2 header with an impossible tag size: the tags cannot be read.
+	os.WriteFile(broken, []byte("ID3\x04\x00\x00\x7f\x7f\x7f\x7f"), 0o644)
+	dangling := filepath.Join(lib, "Gone")
+	if err := os.Symlink(filepath.Join(lib, "missing"), dangling); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	processPathWithTracking(0, lib, &seen)
+
+	var songs int
+	d.QueryRow(`SELECT COUNT(*) FROM songs`).Scan(&songs)
+	if songs != 2 {
+		t.Fatalf("indexed %d songs, want 2: a bad file must not stop the scan", songs)
+	}
+
+	for category, want := range map[string]string{scanErrorTag: broken, scanErrorWalk: dangling} {
+		page := fetchScanErrors(t, "category="+category)
+		if page.Total != 1 || len(page.Errors) != 1 || page.Errors[0].Path != want {
+			t.Fatalf("%s errors = %+v, want only %s", category, page, want)
+		}
+		if e := page.Errors[0]; e.Category != category || e.Error == "" || e.OccurredAt == "" {
+			t.Errorf("incomplete scan error %+v", e)
+		}
+	}
+
+	// Paging; ffprobe errors for the fake files may or may not be present
+	// depending on whether ffprobe is installed.
+	all := fetchScanErrors(t, "")
+	if all.Total < 2 || len(all.Errors) != all.Total {
+		t.Fatalf("all errors = %+v", all)
+	}
+	page := fetchScanErrors(t, "limit=1&offset=1")
+	if page.Total != all.Total || len(page.Errors) != 1 || page.Errors[0] != all.Errors[1] {
+		t.Fatalf("page 2 = %+v, want %+v", page, all.Errors[1])
+	}
+
+	// Rescanning the library path starts from a clean list.
+	os.WriteFile(broken, untagged, 0o644)
+	os.Remove(dangling)
+	clearScanErrorsUnder(lib)
+	processPathWithTracking(0, lib, &seen)
+	if page := fetchScanErrors(t, "category=tag"); page.Total != 0 {
+		t.Fatalf("fixed file still listed: %+v", page)
+	}
+	if page := fetchScanErrors(t, "category=walk"); page.Total != 0 {
+		t.Fatalf("removed link still listed: %+v", page)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Library scans skip files and folders matching the newline-separated glob
+// patterns in the scan_ignore_globs configuration key. A pattern without a '/'
+// is matched against every file and directory name ("@eaDir", ".*"); one with a
+// '/' is matched against the path relative to the library root ("Podcasts/*").
+// Matching directories are not descended into. Lines starting with '#' are
+// comments, so "#recycle" must be written as "[#]recycle".
+//
+// The default skips dotfiles and the thumbnail, recycle-bin and system folders
+// NAS devices and desktop OSes create inside shared music folders. Clearing
+// the key indexes everything.
+const defaultScanIgnoreGlobs = `.*
+@eaDir
+[#]recycle
+[#]snapshot
+lost+found
+$RECYCLE.BIN
+System Volume Information`
+
+// scanIgnorePatterns reads scan_ignore_globs, falling back to the defaults when
+// the key has never been set.
+func scanIgnorePatterns() []string {
+	value, err := GetConfig(db, "scan_ignore_globs")
+	if err != nil {
+		value = defaultScanIgnoreGlobs
+	}
+	return parseScanIgnoreGlobs(value)
+}
+
+func parseScanIgnoreGlobs(value string) []string {
+	var patterns []string
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Reject malformed globs up front rather than on every file.
+		if _, err := filepath.Match(line, ""); err != nil {
+			continue
+		}
+		patterns = append(patterns, filepath.ToSlash(line))
+	}
+	return patterns
+}
+
+// scanIgnored reports whether path, found while walking root, matches one of
+// patterns. The root itself is never ignored.
+func scanIgnored(patterns []string, root, path string) bool {
+	if len(patterns) == 0 || path == root {
+		return false
+	}
+	name := filepath.Base(path)
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = name
+	}
+	rel = filepath.ToSlash(rel)
+	for _, p := range patterns {
+		target := name
+		if strings.Contains(p, "/") {
+			target = rel
+		}
+		if ok, _ := filepath.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// skipIgnoredEntry is the WalkDir guard shared by the scanners. skip is true
+// when path matches an ignore pattern; err is then filepath.SkipDir for a
+// directory and nil for a file, ready to be returned from the callback.
+func skipIgnoredEntry(patterns []string, root, path string, d os.DirEntry) (skip bool, err error) {
+	if !scanIgnored(patterns, root, path) {
+		return false, nil
+	}
+	if d.IsDir() {
+		return true, filepath.SkipDir
+	}
+	return true, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestScanIgnoreGlobsSkipJunkFolders(t *testing.T) {
+	root := t.TempDir()
+	for _, f := range []string{
+		"Artist/Album/01.mp3",
+		"Artist/Album/@eaDir/01.mp3",
+		"Artist/.hidden/02.mp3",
+		"Artist/Album/._01.mp3",
+		"#recycle/old.mp3",
+		"lost+found/x.mp3",
+		"Podcasts/show.mp3",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	walk := func(patterns []string) []string {
+		var seen []string
+		filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if skip, err := skipIgnoredEntry(patterns, root, path, d); skip {
+				return err
+			}
+			if !d.IsDir() {
+				rel, _ := filepath.Rel(root, path)
+				seen = append(seen, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		sort.Strings(seen)
+		return seen
+	}
+
+	got := walk(parseScanIgnoreGlobs(defaultScanIgnoreGlobs))
+	if len(got) != 2 || got[0] != "Artist/Album/01.mp3" || got[1] != "Podcasts/show.mp3" {
+		t.Fatalf("default ignores: got %v", got)
+	}
+	got = walk(parseScanIgnoreGlobs(defaultScanIgnoreGlobs + "\n# comment\nPodcasts/*\n[bad"))
+	if len(got) != 1 || got[0] != "Artist/Album/01.mp3" {
+		t.Fatalf("relative pattern: got %v", got)
+	}
+	if got = walk(parseScanIgnoreGlobs("")); len(got) != 7 {
+		t.Fatalf("empty setting should index everything, got %v", got)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Scheduled scans. Each library path may carry its own cron expression in
+// library_paths.scan_schedule (a fast local disk hourly, a slow NAS weekly);
+// paths without one follow the global scan_schedule. Paths sharing a schedule
+// are scanned one after another by a single job, since is_scanning only
+// allows one scan at a time and separate jobs firing together would skip all
+// but the first.
+
+// schedulerMu serializes ReloadScheduler calls.
+var schedulerMu sync.Mutex
+
+// validateCronSchedule checks a cron expression as the scheduler parses it.
+func validateCronSchedule(expr string) error {
+	if strings.TrimSpace(expr) == "" {
+		return fmt.Errorf("a cron expression is required")
+	}
+	if _, err := cron.ParseStandard(expr); err != nil {
+		return fmt.Errorf("invalid cron expression %q: %v", expr, err)
+	}
+	return nil
+}
+
+// validateLibraryScanSchedule checks a library path's own schedule, where
+// empty means "use the global schedule".
+func validateLibraryScanSchedule(expr string) error {
+	if strings.TrimSpace(expr) == "" {
+		return nil
+	}
+	return validateCronSchedule(expr)
+}
+
+// configuredSchedule reads a schedule from the configuration. A missing or
+// unparsable value falls back to def, so a bad stored setting never keeps the
+// scheduler (and the server) from starting.
+func configuredSchedule(db *sql.DB, key, def string) string {
+	var schedule string
+	if err := db.QueryRow("SELECT value FROM configuration WHERE key = ?", key).Scan(&schedule); err != nil {
+		log.Printf("Could not read %s from config, using default '%s'. Error: %v", key, def, err)
+		return def
+	}
+	if err := validateCronSchedule(schedule); err != nil {
+		log.Printf("Stored %s is not usable (%v), using default '%s'", key, err, def)
+		return def
+	}
+	return strings.TrimSpace(schedule)
+}
+
+// libraryScanSchedules groups library path ids by their effective schedule,
+// keeping path order within each group. A path whose expression no longer
+// parses falls back to the global schedule.
+func libraryScanSchedules(db *sql.DB, globalSchedule string) (map[string][]int, error) {
+	rows, err := db.Query("SELECT id, COALESCE(scan_schedule, '') FROM library_paths ORDER BY path")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	schedules := make(map[string][]int)
+	for rows.Next() {
+		var id int
+		var schedule string
+		if err := rows.Scan(&id, &schedule); err != nil {
+			return nil, err
+		}
+		schedule = strings.TrimSpace(schedule)
+		if err := validateLibraryScanSchedule(schedule); err != nil {
+			log.Printf("Library path %d: %v, using the global scan schedule", id, err)
+			schedule = ""
+		}
+		if schedule == "" {
+			schedule = globalSchedule
+		}
+		schedules[schedule] = append(schedules[schedule], id)
+	}
+	return schedules, rows.Err()
+}
+
+// claimScanStatus sets is_scanning if no scan is running and returns the new
+// scan generation. The check and the update are one statement, so a manual
+// scan and a scheduled one starting together cannot both win.
+func claimScanStatus(db *sql.DB) (int64, bool) {
+	var gen int64
+	err := db.QueryRow("UPDATE scan_status SET is_scanning = 1, songs_added = 0, last_update_time = ?, scan_generation = scan_generation + 1 WHERE id = 1 AND is_scanning = 0 RETURNING scan_generation",
+		time.Now().Format(time.RFC3339)).Scan(&gen)
+	if err == sql.ErrNoRows {
+		return 0, false
+	}
+	if err != nil {
+		log.Printf("Could not claim scan status: %v", err)
+		return 0, false
+	}
+	currentScanGeneration.Store(gen)
+	return gen, true
+}
+
+// releaseScanStatus clears is_scanning, unless scan generation gen has been
+// given up on by the watchdog and another scan holds it by now.
+func releaseScanStatus(db *sql.DB, gen int64) {
+	if _, err := db.Exec("UPDATE scan_status SET is_scanning = 0, last_update_time = ? WHERE id = 1 AND scan_generation = ?", time.Now().Format(time.RFC3339), gen); err != nil {
+		log.Printf("Could not release scan status: %v", err)
+	}
+	currentScanGeneration.CompareAndSwap(gen, 0)
+}
+
+// runScheduledScans runs one scheduled job: a single pre-scan backup, then the
+// given library paths in order. A job covering every path is a full scan, so
+// songs of removed paths are cleaned up as after a manual "scan all". A path is
+// skipped when another scan holds is_scanning.
+func runScheduledScans(pathIDs []int, allPaths bool) {
+	gen, ok := claimScanStatus(db)
+	if !ok {
+		log.Printf("Scheduled scan of library paths %v skipped: a scan is already in progress.", pathIDs)
+		return
+	}
+	// Perform pre-scan backup synchronously; skip scan on failure
+	dbPath := getEnv("DATABASE_PATH", "/config/music.db")
+	if err := performBackup(db, dbPath); err != nil {
+		log.Printf("Scheduled pre-scan backup failed: %v - skipping scheduled scan", err)
+		releaseScanStatus(db, gen)
+		return
+	}
+	if allPaths {
+		scanAllLibraries(gen)
+		return
+	}
+	for i, id := range pathIDs {
+		// The first path runs under the claim taken for the backup.
+		if i > 0 {
+			if gen, ok = claimScanStatus(db); !ok {
+				log.Printf("Scheduled scan of library path %d skipped: a scan is already in progress.", id)
+				continue
+			}
+		}
+		scanSingleLibrary(gen, id)
+	}
+}
+
+// addLibraryScanJobs registers one cron job per distinct library scan
+// schedule.
+func addLibraryScanJobs(c *cron.Cron, globalSchedule string) error {
+	schedules, err := libraryScanSchedules(db, globalSchedule)
+	if err != nil {
+		return err
+	}
+	total := 0
+	for _, pathIDs := range schedules {
+		total += len(pathIDs)
+	}
+	for schedule, pathIDs := range schedules {
+		allPaths := len(pathIDs) == total
+		if _, err := c.AddFunc(schedule, func() {
+			log.Printf("Cron job triggered: starting scheduled scan of library paths %v.", pathIDs)
+			runScheduledScans(pathIDs, allPaths)
+		}); err != nil {
+			return err
+		}
+		log.Printf("Scheduled library scan for paths %v with schedule: '%s'", pathIDs, schedule)
+	}
+	return nil
+}
+
+// ReloadScheduler re-reads every schedule and swaps in a new cron.Cron. The
+// new jobs are registered before the old scheduler is stopped, so a failed
+// reload leaves the running schedule in place. Stopping a cron.Cron only
+// prevents further runs: a job already in flight finishes on its own, and the
+// is_scanning, isAnalysisRunning and isClusteringRunning guards keep the new
+// jobs from overlapping it.
+func ReloadScheduler() error {
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	next, err := buildScheduler()
+	if err != nil {
+		return err
+	}
+	if scheduler != nil {
+		scheduler.Stop()
+	}
+	next.Start()
+	scheduler = next
+	return nil
+}
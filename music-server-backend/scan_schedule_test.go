@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestLibraryScanSchedulesFallBackToGlobal(t *testing.T) {
+	d, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, stmt := range []string{
+		`CREATE TABLE library_paths (id INTEGER PRIMARY KEY, path TEXT UNIQUE NOT NULL, scan_schedule TEXT)`,
+		`INSERT INTO library_paths (id, path, scan_schedule) VALUES (1, '/music/ssd', '0 * * * *'), (2, '/music/nas', '0 3 * * 0'),
+			(3, '/music/other', NULL), (4, '/music/broken', 'not a cron'), (5, '/music/blank', '  ')`,
+		`CREATE TABLE scan_status (id INTEGER PRIMARY KEY, is_scanning INTEGER, songs_added INTEGER, last_update_time TEXT, scan_generation INTEGER NOT NULL DEFAULT 0)`,
+		`INSERT INTO scan_status (id, is_scanning, songs_added) VALUES (1, 0, 0)`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := libraryScanSchedules(d, "0 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]int{
+		"0 * * * *": {1},
+		"0 3 * * 0": {2},
+		"0 2 * * *": {5, 4, 3}, // ordered by path
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("schedules = %v, want %v", got, want)
+	}
+
+	defer currentScanGeneration.Store(0)
+	gen, ok := claimScanStatus(d)
+	if !ok {
+		t.Fatal("first claim should succeed")
+	}
+	if _, ok := claimScanStatus(d); ok {
+		t.Fatal("second claim should fail while a scan is running")
+	}
+	releaseScanStatus(d, gen)
+	if next, ok := claimScanStatus(d); !ok || next != gen+1 {
+		t.Fatalf("claim after release = %d, %v; want generation %d", next, ok, gen+1)
+	}
+
+	if err := validateCronSchedule("*/15 * * * *"); err != nil {
+		t.Errorf("valid schedule rejected: %v", err)
+	}
+	if err := validateCronSchedule("every hour"); err == nil {
+		t.Error("invalid schedule accepted")
+	}
+	if err := validateCronSchedule(" "); err == nil {
+		t.Error("empty global schedule accepted")
+	}
+	if err := validateLibraryScanSchedule(""); err != nil {
+		t.Errorf("empty library schedule should mean the global one: %v", err)
+	}
+}
+
+func TestReloadSchedulerKeepsRunningScheduleOnError(t *testing.T) {
+	d, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, stmt := range []string{
+		`CREATE TABLE configuration (key TEXT PRIMARY KEY NOT NULL, value TEXT)`,
+		`INSERT INTO configuration (key, value) VALUES ('scan_enabled', 'false'), ('analysis_enabled', 'true'), ('analysis_schedule', '0 1 * * *')`,
+		`CREATE TABLE library_paths (id INTEGER PRIMARY KEY, path TEXT UNIQUE NOT NULL, scan_schedule TEXT)`,
+		`INSERT INTO library_paths (id, path, scan_schedule) VALUES (1, '/music/ssd', '0 * * * *'), (2, '/music/nas', NULL)`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldDB, oldScheduler := db, scheduler
+	db, scheduler = d, nil
+	defer func() {
+		if scheduler != nil {
+			scheduler.Stop()
+		}
+		db, scheduler = oldDB, oldScheduler
+	}()
+
+	if err := ReloadScheduler(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(scheduler.Entries()); n != 1 {
+		t.Fatalf("scan disabled: got %d jobs, want only the analysis job", n)
+	}
+
+	// Enabling scans picks up both library schedules without a restart.
+	d.Exec(`UPDATE configuration SET value = 'true' WHERE key = 'scan_enabled'`)
+	if err := ReloadScheduler(); err != nil {
+		t.Fatal(err)
+	}
+	running := scheduler
+	if n := len(running.Entries()); n != 3 {
+		t.Fatalf("scan enabled: got %d jobs, want 3", n)
+	}
+
+	// A stored schedule that does not parse falls back to its default.
+	d.Exec(`INSERT INTO configuration (key, value) VALUES ('clustering_enabled', 'true'), ('clustering_schedule', 'bogus')`)
+	if err := ReloadScheduler(); err != nil {
+		t.Fatalf("a bad stored schedule should not fail the reload: %v", err)
+	}
+	running = scheduler
+	if n := len(running.Entries()); n != 4 {
+		t.Fatalf("clustering enabled: got %d jobs, want 4", n)
+	}
+
+	d.Exec(`DROP TABLE library_paths`)
+	if err := ReloadScheduler(); err == nil {
+		t.Fatal("expected an error when library paths cannot be read")
+	}
+	if scheduler != running || len(scheduler.Entries()) != 4 {
+		t.Fatal("a failed reload must leave the running scheduler in place")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// scanWalk walks a library path for the scanners. It is filepath.WalkDir unless
+// follow_symlinks is enabled, in which case symlinked directories and files are
+// followed and reported under their link path (so songs stay inside the
+// library path they were found in).
+func scanWalk(root string, fn fs.WalkDirFunc) error {
+	if !configBool(db, "follow_symlinks") {
+		return filepath.WalkDir(root, fn)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkFollowingSymlinks(root, fs.FileInfoToDirEntry(info), fn, make(map[string]bool))
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkFollowingSymlinks mirrors filepath.WalkDir's callback contract (SkipDir,
+// SkipAll, a second call with the ReadDir error) for the directory at path.
+//
+// Loop protection: following links makes the tree a graph, so a link pointing
+// at one of its own ancestors ("Music/All -> ..") would recurse forever. Every
+// directory is resolved to its real path with EvalSymlinks before it is read,
+// and a real path that has already been walked is skipped. This also keeps a
+// folder that is reachable through several links from being indexed twice.
+func walkFollowingSymlinks(path string, d fs.DirEntry, fn fs.WalkDirFunc, visited map[string]bool) error {
+	if !d.IsDir() {
+		return fn(path, d, nil)
+	}
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		if visited[real] {
+			log.Printf("scan: skipping %s, already walked as %s (symlink loop or duplicate link)", path, real)
+			return nil
+		}
+		visited[real] = true
+	}
+	if err := fn(path, d, nil); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		if err := fn(path, d, err); err != nil && err != filepath.SkipDir {
+			return err
+		}
+		return nil
+	}
+	for _, e := range entries {
+		child := filepath.Join(path, e.Name())
+		if e.Type()&fs.ModeSymlink != 0 {
+			info, err := os.Stat(child)
+			if err != nil {
+				// Dangling link: report it like any unreadable entry.
+				if err := fn(child, e, err); err != nil && err != filepath.SkipDir {
+					return err
+				}
+				continue
+			}
+			e = fs.FileInfoToDirEntry(info)
+		}
+		if err := walkFollowingSymlinks(child, e, fn, visited); err != nil {
+			if err != filepath.SkipDir {
+				return err
+			}
+			if !e.IsDir() {
+				// SkipDir from a file skips the rest of its directory.
+				return nil
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestScanWalkFollowsSymlinksWithoutLooping(t *testing.T) {
+	d, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err := d.Exec(`CREATE TABLE configuration (key TEXT PRIMARY KEY NOT NULL, value TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	old := db
+	db = d
+	defer func() { db = old }()
+
+	store, lib := t.TempDir(), t.TempDir()
+	if err := os.MkdirAll(filepath.Join(store, "Album"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(store, "Album", "01.mp3"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(lib, "top.mp3"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"Linked":  filepath.Join(store, "Album"),
+		"Again":   filepath.Join(store, "Album"), // same folder through a second link
+		"Loop":    lib,                           // points back at the library root
+		"Missing": filepath.Join(store, "nope"),  // dangling
+	} {
+		if err := os.Symlink(target, filepath.Join(lib, link)); err != nil {
+			t.Skipf("symlinks unsupported: %v", err)
+		}
+	}
+
+	walk := func() []string {
+		var files []string
+		err := scanWalk(lib, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if !d.IsDir() && filepath.Ext(path) == ".mp3" {
+				rel, _ := filepath.Rel(lib, path)
+				files = append(files, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("scanWalk: %v", err)
+		}
+		sort.Strings(files)
+		return files
+	}
+
+	if got := walk(); len(got) != 1 || got[0] != "top.mp3" {
+		t.Fatalf("symlinks must not be followed by default, got %v", got)
+	}
+	if _, err := d.Exec(`INSERT INTO configuration (key, value) VALUES ('follow_symlinks', 'true')`); err != nil {
+		t.Fatal(err)
+	}
+	got := walk()
+	if len(got) != 2 || got[1] != "top.mp3" || (got[0] != "Linked/01.mp3" && got[0] != "Again/01.mp3") {
+		t.Fatalf("follow_symlinks should index the linked album once, got %v", got)
+	}
+}
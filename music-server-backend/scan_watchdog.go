@@ -0,0 +1,116 @@
+package main
+
+import (
+	"log"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// recoverScanPanic must be deferred first in every scan entry point. A panic in
+// a scan goroutine would otherwise take the whole server down, and until the
+// restart is_scanning stays 1 and every new scan is refused. The scan's own
+// cleanup defer still runs while panicking; this one then stops the panic and
+// makes sure the flag is cleared even if that cleanup panicked too.
+func recoverScanPanic(scan string, gen int64) {
+	if r := recover(); r != nil {
+		log.Printf("PANIC in %s: %v\n%s", scan, r, debug.Stack())
+		releaseScanStatus(db, gen)
+	}
+}
+
+// Scan generations. Every claim of is_scanning bumps
+// scan_status.scan_generation and the scan carries the number it got. Only
+// that generation may release the flag, and a scan stops as soon as its
+// generation is no longer the current one, so a scan the watchdog gave up on
+// cannot keep walking next to, or clear the flag of, the scan started after it.
+var currentScanGeneration atomic.Int64
+
+// scanCancelled reports whether scan generation gen should stop: the user or
+// shutdown cancelled the running scan, or gen was superseded.
+func scanCancelled(gen int64) bool {
+	return isScanCancelled.Load() || currentScanGeneration.Load() != gen
+}
+
+// resetStaleScanStatus clears is_scanning at startup: no scan survives a
+// restart, so a set flag is left over from a crash or a kill.
+func resetStaleScanStatus() error {
+	var isScanning bool
+	var lastUpdate string
+	db.QueryRow("SELECT is_scanning, COALESCE(last_update_time, '') FROM scan_status WHERE id = 1").Scan(&isScanning, &lastUpdate)
+	if !isScanning {
+		return nil
+	}
+	log.Printf("Clearing scan status left over from the previous run (last progress at %q)", lastUpdate)
+	_, err := db.Exec("UPDATE scan_status SET is_scanning = 0 WHERE id = 1")
+	return err
+}
+
+// Stall detection. Scans bump scan_status.last_update_time as they walk (see
+// scanHeartbeat), so a scan whose timestamp stops moving is stuck, typically
+// on an external tool that never returns. Every minute the watchdog compares
+// it with scan_stall_minutes (default 15, 0 disables): a stalled scan is
+// cancelled, is_scanning is cleared so new scans can start, and stalled_at is
+// set so getScanStatus can tell the user. The next scan clears stalled_at.
+
+const scanHeartbeatInterval = 10 * time.Second
+
+const defaultScanStallMinutes = 15
+
+var lastScanHeartbeat atomic.Int64 // unix nanoseconds of the last write
+
+// scanHeartbeat records that scan generation gen is making progress. It is
+// called for every walked entry and writes at most once per scanHeartbeatInterval.
+func scanHeartbeat(gen int64) {
+	now := time.Now()
+	last := lastScanHeartbeat.Load()
+	if now.UnixNano()-last < int64(scanHeartbeatInterval) || !lastScanHeartbeat.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	db.Exec("UPDATE scan_status SET last_update_time = ? WHERE id = 1 AND is_scanning = 1 AND scan_generation = ?", now.Format(time.RFC3339), gen)
+}
+
+// startScanWatchdog checks for stalled scans once a minute.
+func startScanWatchdog() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			checkStalledScan(now)
+		}
+	}()
+}
+
+// checkStalledScan cancels the running scan if it has not made progress for
+// scan_stall_minutes, and reports whether it did.
+func checkStalledScan(now time.Time) bool {
+	threshold := time.Duration(configInt(db, "scan_stall_minutes", defaultScanStallMinutes)) * time.Minute
+	if threshold <= 0 {
+		return false
+	}
+	var isScanning bool
+	var lastUpdate string
+	var gen int64
+	if err := db.QueryRow("SELECT is_scanning, COALESCE(last_update_time, ''), scan_generation FROM scan_status WHERE id = 1").Scan(&isScanning, &lastUpdate, &gen); err != nil || !isScanning {
+		return false
+	}
+	last, err := time.Parse(time.RFC3339, lastUpdate)
+	if err != nil || now.Sub(last) < threshold {
+		return false
+	}
+	// Only if the scan did not move in the meantime.
+	res, err := db.Exec("UPDATE scan_status SET is_scanning = 0, stalled_at = ? WHERE id = 1 AND is_scanning = 1 AND last_update_time = ? AND scan_generation = ?",
+		now.Format(time.RFC3339), lastUpdate, gen)
+	if err != nil {
+		log.Printf("Failed to reset stalled scan: %v", err)
+		return false
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false
+	}
+	// Retire the generation rather than setting isScanCancelled: the next
+	// scan clears that flag when it starts, which would revive this one.
+	currentScanGeneration.CompareAndSwap(gen, 0)
+	log.Printf("Scan stalled: no progress since %s (more than %s); cancelled it and reset the scan status", lastUpdate, threshold)
+	return true
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScanPanicResetsScanStatus(t *testing.T) {
+	d := scanTestDB(t)
+	isScanning := func() (v bool) {
+		d.QueryRow(`SELECT is_scanning FROM scan_status WHERE id = 1`).Scan(&v)
+		return v
+	}
+
+	defer currentScanGeneration.Store(0)
+	gen, _ := claimScanStatus(d)
+	func() {
+		defer recoverScanPanic("test scan", gen)
+		panic("corrupt file")
+	}()
+	if isScanning() {
+		t.Fatal("is_scanning should be cleared after a panicking scan")
+	}
+
+	d.Exec(`UPDATE scan_status SET is_scanning = 1, last_update_time = '2020-01-01T00:00:00Z'`)
+	if err := resetStaleScanStatus(); err != nil {
+		t.Fatal(err)
+	}
+	if isScanning() {
+		t.Fatal("is_scanning should be cleared at startup")
+	}
+}
+
+func TestCheckStalledScanCancelsScanWithoutProgress(t *testing.T) {
+	d := scanTestDB(t)
+	defer currentScanGeneration.Store(0)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	gen, _ := claimScanStatus(d)
+	d.Exec(`UPDATE scan_status SET last_update_time = ?`, start.Format(time.RFC3339))
+
+	if checkStalledScan(start.Add(14 * time.Minute)) {
+		t.Fatal("scan within the default 15 minutes must not be treated as stalled")
+	}
+	d.Exec(`INSERT INTO configuration (key, value) VALUES ('scan_stall_minutes', '0')`)
+	if checkStalledScan(start.Add(time.Hour)) {
+		t.Fatal("scan_stall_minutes=0 disables the watchdog")
+	}
+	d.Exec(`UPDATE configuration SET value = '5' WHERE key = 'scan_stall_minutes'`)
+	if !checkStalledScan(start.Add(6 * time.Minute)) {
+		t.Fatal("scan without progress for 6 minutes should be stalled")
+	}
+	if !scanCancelled(gen) {
+		t.Error("stalled scan should be cancelled")
+	}
+
+	resp := callHandler(t, subsonicGetScanStatus, "")
+	status, _ := resp["scanStatus"].(map[string]interface{})
+	if status["scanning"] != false || status["stalledAt"] != start.Add(6*time.Minute).Format(time.RFC3339) {
+		t.Fatalf("scanStatus = %v, want scanning=false with stalledAt", status)
+	}
+}
+
+func TestStalledScanCannotReleaseNextScan(t *testing.T) {
+	d := scanTestDB(t)
+	defer currentScanGeneration.Store(0)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	stuck, _ := claimScanStatus(d)
+	d.Exec(`UPDATE scan_status SET last_update_time = ?`, start.Format(time.RFC3339))
+	if !checkStalledScan(start.Add(time.Hour)) {
+		t.Fatal("scan without progress for an hour should be stalled")
+	}
+
+	next, ok := claimScanStatus(d)
+	if !ok {
+		t.Fatal("a new scan should start once the stalled one was reset")
+	}
+	isScanCancelled.Store(false) // as the new scan does when it starts
+	if !scanCancelled(stuck) {
+		t.Error("the stalled scan must stay cancelled after the next scan starts")
+	}
+	if scanCancelled(next) {
+		t.Error("the new scan must not be cancelled")
+	}
+
+	// The stuck scan finally returns and runs its cleanup.
+	releaseScanStatus(d, stuck)
+	var isScanning bool
+	d.QueryRow(`SELECT is_scanning FROM scan_status WHERE id = 1`).Scan(&isScanning)
+	if !isScanning {
+		t.Fatal("the stalled scan released the scan status held by the next scan")
+	}
+	if _, ok := claimScanStatus(d); ok {
+		t.Fatal("a third scan must not start while the second one runs")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchArtist is an artist entry in the JSON search response.
+type SearchArtist struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	AlbumCount int    `json:"albumCount"`
+	SongCount  int    `json:"songCount"`
+}
+
+// SearchAlbum is an album entry in the JSON search response. ID doubles as the
+// cover art id.
+type SearchAlbum struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Artist    string `json:"artist"`
+	ArtistID  string `json:"artistId"`
+	Genre     string `json:"genre"`
+	SongCount int    `json:"songCount"`
+	Duration  int    `json:"duration"`
+	Created   string `json:"created"`
+}
+
+// SearchResponse is returned by GET /api/v1/search. The *Total fields count
+// every match so the UI can page through each section independently.
+type SearchResponse struct {
+	Query       string         `json:"query"`
+	Artists     []SearchArtist `json:"artists"`
+	Albums      []SearchAlbum  `json:"albums"`
+	Songs       []Song         `json:"songs"`
+	ArtistTotal int            `json:"artistTotal"`
+	AlbumTotal  int            `json:"albumTotal"`
+	SongTotal   int            `json:"songTotal"`
+}
+
+const searchMaxPageSize = 500
+
+// searchPage reads a "<name>Limit"/"<name>Offset" pair, clamping the limit to
+// [0, searchMaxPageSize]. A limit of 0 skips that section.
+func searchPage(c *gin.Context, name string, defaultLimit int) (limit, offset int) {
+	limit, err := strconv.Atoi(c.DefaultQuery(name+"Limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit < 0 {
+		limit = defaultLimit
+	}
+	if limit > searchMaxPageSize {
+		limit = searchMaxPageSize
+	}
+	offset, err = strconv.Atoi(c.DefaultQuery(name+"Offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// searchLibrary handles GET /api/v1/search?q=... for the web UI, returning
+// artists, albums and songs as plain JSON instead of a Subsonic envelope. q
+// accepts the search syntax described in search_query.go; effective=true groups
+// artists by album artist (falling back to the track artist) and defaults to the
+// use_album_artist setting.
+func searchLibrary(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing query parameter 'q'"})
+		return
+	}
+	userID := c.GetInt("userID")
+	effective := c.DefaultQuery("effective", strconv.FormatBool(UseAlbumArtist(db))) == "true"
+	artistLimit, artistOffset := searchPage(c, "artist", 20)
+	albumLimit, albumOffset := searchPage(c, "album", 20)
+	songLimit, songOffset := searchPage(c, "song", 50)
+
+	resp := SearchResponse{Query: q, Artists: []SearchArtist{}, Albums: []SearchAlbum{}, Songs: []Song{}}
+
+	if artistLimit > 0 {
+		artists, err := QueryArtists(db, ArtistQueryOptions{
+			SearchTerm:         q,
+			UseEffectiveArtist: effective,
+			IncludeCounts:      true,
+			Limit:              artistLimit,
+			Offset:             artistOffset,
+		})
+		if err != nil {
+			log.Printf("searchLibrary: artist query failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search artists"})
+			return
+		}
+		for _, a := range artists {
+			resp.Artists = append(resp.Artists, SearchArtist{ID: GenerateArtistID(a.Name), Name: a.Name, AlbumCount: a.AlbumCount, SongCount: a.SongCount})
+		}
+		resp.ArtistTotal, _ = CountArtists(db, q, effective)
+	}
+
+	if albumLimit > 0 {
+		albums, err := QueryAlbums(db, AlbumQueryOptions{
+			SearchTerm:      q,
+			GroupByPath:     true,
+			IncludeAlbumID:  true,
+			IncludeGenre:    true,
+			IncludeCounts:   true,
+			IncludeDuration: true,
+			IncludeCreated:  true,
+			Limit:           albumLimit,
+			Offset:          albumOffset,
+		})
+		if err != nil {
+			log.Printf("searchLibrary: album query failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search albums"})
+			return
+		}
+		for _, a := range albums {
+			artist := albumDisplayArtist(db, a.Name, a.AlbumPath)
+			resp.Albums = append(resp.Albums, SearchAlbum{ID: a.AlbumID, Name: a.Name, Artist: artist, ArtistID: GenerateArtistID(artist),
+				Genre: a.Genre, SongCount: a.SongCount, Duration: a.Duration, Created: a.Created})
+		}
+		resp.AlbumTotal, _ = CountAlbums(db, q)
+	}
+
+	if songLimit > 0 {
+		songs, err := QuerySongs(db, SongQueryOptions{
+			SearchTerm:     q,
+			IncludeStarred: true,
+			IncludeGenre:   true,
+			UserID:         userID,
+			Limit:          songLimit,
+			Offset:         songOffset,
+			OrderBy:        "s.artist, s.album, s.title COLLATE NOCASE",
+		})
+		if err != nil {
+			log.Printf("searchLibrary: song query failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search songs"})
+			return
+		}
+		for _, s := range songs {
+			resp.Songs = append(resp.Songs, Song{ID: s.ID, Title: s.Title, Artist: s.Artist, Album: s.Album, AlbumArtist: s.AlbumArtist,
+				Duration: s.Duration, PlayCount: s.PlayCount, LastPlayed: s.LastPlayed, DateAdded: s.Created, Starred: s.Starred, Genre: s.Genre})
+		}
+		resp.SongTotal, _ = CountSongs(db, q)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -21,7 +23,7 @@ func fileSearchTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("open: %v", err)
 	}
 	stmts := []string{
-		`CREATE TABLE songs (id TEXT PRIMARY KEY, title TEXT, artist TEXT, album TEXT, album_artist TEXT DEFAULT '', path TEXT, album_path TEXT DEFAULT '', genre TEXT DEFAULT '', duration INTEGER DEFAULT 0, play_count INTEGER DEFAULT 0, last_played TEXT, date_added TEXT, replaygain_track_gain REAL, replaygain_track_peak REAL, replaygain_album_gain REAL, replaygain_album_peak REAL, track INTEGER DEFAULT 0, year INTEGER DEFAULT 0, disc_number INTEGER DEFAULT 0, size INTEGER DEFAULT 0, bitrate INTEGER DEFAULT 0, sample_rate INTEGER DEFAULT 0, channels INTEGER DEFAULT 0, bit_depth INTEGER DEFAULT 0, comment TEXT DEFAULT '', cancelled INTEGER NOT NULL DEFAULT 0)`,
+		`CREATE TABLE songs (id TEXT PRIMARY KEY, title TEXT, artist TEXT, album TEXT, album_artist TEXT DEFAULT '', path TEXT, album_path TEXT DEFAULT '', genre TEXT DEFAULT '', duration INTEGER DEFAULT 0, play_count INTEGER DEFAULT 0, last_played TEXT, date_added TEXT, replaygain_track_gain REAL, replaygain_track_peak REAL, replaygain_album_gain REAL, replaygain_album_peak REAL, track INTEGER DEFAULT 0, year INTEGER DEFAULT 0, disc_number INTEGER DEFAULT 0, size INTEGER DEFAULT 0, bitrate INTEGER DEFAULT 0, sample_rate INTEGER DEFAULT 0, channels INTEGER DEFAULT 0, bit_depth INTEGER DEFAULT 0, comment TEXT DEFAULT '', search_text TEXT NOT NULL DEFAULT '', external_id TEXT NOT NULL DEFAULT '', cancelled INTEGER NOT NULL DEFAULT 0, cancelled_at TEXT, cancel_reason TEXT NOT NULL DEFAULT '')`,
 		`CREATE VIRTUAL TABLE songs_fts USING fts5(title, artist, album, album_artist, content='songs', content_rowid='rowid', tokenize='unicode61 remove_diacritics 2')`,
 		`CREATE TRIGGER songs_ai AFTER INSERT ON songs BEGIN INSERT INTO songs_fts(rowid,title,artist,album,album_artist) VALUES (new.rowid,new.title,new.artist,new.album,new.album_artist); END;`,
 		`CREATE TABLE starred_songs (user_id INTEGER, song_id TEXT, starred_at TEXT)`,
@@ -192,3 +194,292 @@ func contains(xs []string, want string) bool {
 	}
 	return false
 }
+
+func TestSearchIgnoresDiacriticsWithoutFTS(t *testing.T) {
+	testDB := fileSearchTestDB(t)
+	defer testDB.Close()
+	old := db
+	db = testDB
+	defer func() { db = old }()
+
+	db.Exec(`INSERT INTO songs (id, title, artist, album, album_path, duration) VALUES (?,?,?,?,?,?)`,
+		"s1", "Halo", "Beyoncé", "I Am... Sasha Fierce", "/m/sasha", 200)
+	if err := RebuildLibraryIndex(db); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	var stored string
+	_ = db.QueryRow(`SELECT search_text FROM songs WHERE id = 's1'`).Scan(&stored)
+	if stored != " i am sasha fierce | beyonce | halo " {
+		t.Fatalf("unexpected search_text %q", stored)
+	}
+
+	// Force the LIKE fallback used by builds without fts5.
+	db.Exec(`DROP TRIGGER songs_ai`)
+	db.Exec(`DROP TABLE songs_fts`)
+
+	res := callSearch(t, subsonicSearch3, "query=beyonce&artistCount=0&albumCount=20&songCount=20&f=json")
+	if !contains(songTitles(res, "searchResult3"), "Halo") {
+		t.Errorf("'beyonce' should find the song by Beyoncé: %v", res)
+	}
+	if !hasNamed(res, "searchResult3", "album", "name", "I Am... Sasha Fierce") {
+		t.Errorf("'beyonce' should find the album by Beyoncé: %v", res)
+	}
+	// Album search matches album/artist names only, not song titles.
+	res = callSearch(t, subsonicSearch3, "query=halo&artistCount=0&albumCount=20&songCount=20&f=json")
+	if hasNamed(res, "searchResult3", "album", "name", "I Am... Sasha Fierce") {
+		t.Errorf("album search should not match on song titles")
+	}
+	// Default matching is word-prefix; substring matching is opt-in.
+	if n, _ := CountSongs(db, "once"); n != 0 {
+		t.Errorf("'once' should not match mid-word by default, got %d", n)
+	}
+	db.Exec(`CREATE TABLE configuration (key TEXT PRIMARY KEY, value TEXT)`)
+	db.Exec(`INSERT INTO configuration (key, value) VALUES ('search_substring_match', 'true')`)
+	if n, _ := CountSongs(db, "once"); n != 1 {
+		t.Errorf("'once' should match with search_substring_match=true, got %d", n)
+	}
+}
+
+func TestFieldScopedAndOrSearch(t *testing.T) {
+	if got := parseSearchQuery(`artist:Radiohead "ok computer" OR album:"kid a"`).ftsExpr(); got != `({artist album_artist} : "Radiohead"* "ok computer") OR (album : "kid a")` {
+		t.Fatalf("unexpected FTS expression %q", got)
+	}
+
+	testDB := fileSearchTestDB(t)
+	defer testDB.Close()
+	old := db
+	db = testDB
+	defer func() { db = old }()
+
+	for _, s := range [][]string{
+		{"s1", "Airbag", "Radiohead", "OK Computer", "Rock"},
+		{"s2", "Everything in Its Right Place", "Radiohead", "Kid A", "Electronic"},
+		{"s3", "Radiohead Tribute Song", "Someone Else", "Covers", "Rock"},
+		{"s4", "Karma Police", "Radiohead", "OK Computer", "Rock"},
+		{"s5", "OR", "Nobody", "Letters", "R&B"},
+	} {
+		db.Exec(`INSERT INTO songs (id, title, artist, album, genre) VALUES (?,?,?,?,?)`, s[0], s[1], s[2], s[3], s[4])
+	}
+	if err := RebuildLibraryIndex(db); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+
+	check := func(mode string) {
+		for q, want := range map[string]int{
+			"radiohead":                       4,
+			"artist:radiohead":                3,
+			"title:radiohead":                 1,
+			`artist:radiohead "ok computer"`:  2,
+			`album:"kid a" OR title:karma`:    2,
+			"genre:electronic":                1,
+			"artist:radiohead genre:rock":     2,
+			"airbag OR police OR title:right": 3,
+			// A bare OR/AND that is not between two terms is a word.
+			"OR":        1,
+			"nobody OR": 1,
+			"airbag OR": 0,
+			"AND":       0,
+			// LIKE wildcards in genre terms are literal.
+			"genre:r&b": 1,
+			"genre:r_b": 0,
+		} {
+			if n, err := CountSongs(db, q); err != nil || n != want {
+				t.Errorf("%s: CountSongs(%q) = %d (%v), want %d", mode, q, n, err, want)
+			}
+		}
+	}
+	check("fts")
+	db.Exec(`DROP TRIGGER songs_ai`)
+	db.Exec(`DROP TABLE songs_fts`)
+	check("like")
+}
+
+func TestJSONSearchEndpoint(t *testing.T) {
+	testDB := fileSearchTestDB(t)
+	defer testDB.Close()
+	old := db
+	db = testDB
+	defer func() { db = old }()
+
+	db.Exec(`INSERT INTO songs (id, title, artist, album, album_artist, album_path) VALUES ('s1', 'Blue Song', 'Guest', 'Blue Album', 'Main Band', '/m/blue')`)
+	db.Exec(`INSERT INTO songs (id, title, artist, album, album_artist, album_path) VALUES ('s2', 'Blue Two', 'Main Band', 'Blue Album', 'Main Band', '/m/blue')`)
+	if err := RebuildLibraryIndex(db); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/v1/search", func(c *gin.Context) { c.Set("userID", 1) }, searchLibrary)
+	get := func(url string) (int, SearchResponse) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		var resp SearchResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	if code, _ := get("/api/v1/search"); code != http.StatusBadRequest {
+		t.Fatalf("missing q should be 400, got %d", code)
+	}
+	code, resp := get("/api/v1/search?q=blue&songLimit=1")
+	if code != http.StatusOK || len(resp.Songs) != 1 || resp.SongTotal != 2 || len(resp.Albums) != 1 || resp.Albums[0].Artist != "Main Band" {
+		t.Fatalf("unexpected search response %d: %+v", code, resp)
+	}
+	if len(resp.Artists) != 2 {
+		t.Fatalf("expected both track artists, got %+v", resp.Artists)
+	}
+	_, resp = get("/api/v1/search?q=blue&effective=true")
+	if len(resp.Artists) != 1 || resp.Artists[0].Name != "Main Band" || resp.Artists[0].SongCount != 2 || resp.ArtistTotal != 1 {
+		t.Fatalf("effective=true should group by album artist, got %+v (total %d)", resp.Artists, resp.ArtistTotal)
+	}
+}
+
+// TestAlbumArtistHidesFeaturedArtists checks that an album whose tracks are only
+// partially tagged with an album artist is shown under that album artist alone in
+// getAlbumList2, search2 and search3, not "2Cellos; 2Cellos feat. X".
+func TestAlbumArtistHidesFeaturedArtists(t *testing.T) {
+	testDB := fileSearchTestDB(t)
+	defer testDB.Close()
+	old := db
+	db = testDB
+	defer func() { db = old }()
+
+	db.Exec(`INSERT INTO songs (id, title, artist, album, album_artist, album_path) VALUES ('s1', 'Thunderstruck', '2Cellos', 'Celloverse', '2Cellos', '/m/cv')`)
+	db.Exec(`INSERT INTO songs (id, title, artist, album, album_artist, album_path) VALUES ('s2', 'Live and Let Die', '2Cellos feat. X', 'Celloverse', NULL, '/m/cv')`)
+	if err := RebuildLibraryIndex(db); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+
+	list := callSearch(t, subsonicGetAlbumList2, "type=alphabeticalByName&size=10&f=json")
+	if !hasNamed(list, "albumList2", "album", "artist", "2Cellos") {
+		t.Errorf("getAlbumList2 did not show album artist: %v", list["albumList2"])
+	}
+	for _, h := range []struct {
+		name string
+		fn   gin.HandlerFunc
+		key  string
+	}{{"search2", subsonicSearch2, "searchResult2"}, {"search3", subsonicSearch3, "searchResult3"}} {
+		res := callSearch(t, h.fn, "query=celloverse&artistCount=0&albumCount=10&songCount=0&f=json")
+		if !hasNamed(res, h.key, "album", "artist", "2Cellos") {
+			t.Errorf("%s did not show album artist: %v", h.name, res[h.key])
+		}
+	}
+	if got, _ := getAlbumDisplayArtist(db, "Celloverse", "/m/cv"); got != "2Cellos" {
+		t.Errorf("getAlbumDisplayArtist = %q, want 2Cellos", got)
+	}
+}
+
+// albumIDs maps album artist -> id for result[key].album.
+func albumIDs(result map[string]interface{}, key string) map[string]string {
+	ids := map[string]string{}
+	r, _ := result[key].(map[string]interface{})
+	items, _ := r["album"].([]interface{})
+	for _, it := range items {
+		if m, ok := it.(map[string]interface{}); ok {
+			artist, _ := m["artist"].(string)
+			ids[artist], _ = m["id"].(string)
+		}
+	}
+	return ids
+}
+
+// TestSameNamedAlbumsStayDistinctAcrossEndpoints checks that two "Greatest Hits"
+// albums in different folders are listed separately, with the same album ids,
+// by getAlbumList2, search2 and search3, and that getAlbum opens the right one
+// whichever of its songs it is given.
+func TestSameNamedAlbumsStayDistinctAcrossEndpoints(t *testing.T) {
+	testDB := fileSearchTestDB(t)
+	defer testDB.Close()
+	old := db
+	db = testDB
+	defer func() { db = old }()
+
+	db.Exec(`INSERT INTO songs (id, title, artist, album, album_artist, album_path, path) VALUES ('a1', 'Bohemian Rhapsody', 'Freddie', 'Greatest Hits', 'Queen', '/m/queen', '/m/queen/a1.mp3')`)
+	db.Exec(`INSERT INTO songs (id, title, artist, album, album_artist, album_path, path) VALUES ('a2', 'Under Pressure', 'Queen', 'Greatest Hits', 'Queen & David Bowie', '/m/queen', '/m/queen/a2.mp3')`)
+	db.Exec(`INSERT INTO songs (id, title, artist, album, album_artist, album_path, path) VALUES ('b1', 'Roxanne', 'The Police', 'Greatest Hits', 'The Police', '/m/police', '/m/police/b1.mp3')`)
+	if err := RebuildLibraryIndex(db); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	queen := AlbumID("Greatest Hits", "/m/queen")
+	want := map[string]string{"Queen; Queen & David Bowie": queen, "The Police": AlbumID("Greatest Hits", "/m/police")}
+	if want["The Police"] == queen {
+		t.Fatalf("both albums got id %s", queen)
+	}
+
+	list := albumIDs(callSearch(t, subsonicGetAlbumList2, "type=alphabeticalByName&size=10&f=json"), "albumList2")
+	if len(list) != 2 || list["Queen; Queen & David Bowie"] != queen || list["The Police"] != want["The Police"] {
+		t.Fatalf("getAlbumList2 albums = %v, want %v", list, want)
+	}
+	for _, h := range []struct {
+		name string
+		fn   gin.HandlerFunc
+		key  string
+	}{{"search2", subsonicSearch2, "searchResult2"}, {"search3", subsonicSearch3, "searchResult3"}} {
+		got := albumIDs(callSearch(t, h.fn, "query=greatest&artistCount=0&albumCount=10&songCount=0&f=json"), h.key)
+		if len(got) != 2 || got["Queen; Queen & David Bowie"] != queen || got["The Police"] != want["The Police"] {
+			t.Errorf("%s 'greatest' albums = %v, want %v", h.name, got, want)
+		}
+		// Only a2 matches "bowie", but the album id is still the album's own.
+		got = albumIDs(callSearch(t, h.fn, "query=bowie&artistCount=0&albumCount=10&songCount=0&f=json"), h.key)
+		if len(got) != 1 || got["Queen; Queen & David Bowie"] != queen {
+			t.Errorf("%s 'bowie' albums = %v, want %s", h.name, got, queen)
+		}
+	}
+
+	for _, id := range []string{queen, "a2"} {
+		res := callSearch(t, subsonicGetAlbum, "id="+id+"&f=json")
+		album, _ := res["album"].(map[string]interface{})
+		if album["id"] != queen || album["songCount"] != float64(2) {
+			t.Fatalf("getAlbum(%s) should open album %s with 2 songs, got %v", id, queen, album)
+		}
+	}
+}
+
+// TestAlbumStarsUseAlbumIDs checks that starring an album through one of its
+// songs stores the album id, and that stars saved under a song id by earlier
+// versions are moved to the album id.
+func TestAlbumStarsUseAlbumIDs(t *testing.T) {
+	testDB := fileSearchTestDB(t)
+	defer testDB.Close()
+	old := db
+	db = testDB
+	defer func() { db = old }()
+
+	db.Exec(`CREATE TABLE starred_albums (user_id INTEGER NOT NULL, album_id TEXT NOT NULL, starred_at TEXT NOT NULL, PRIMARY KEY (user_id, album_id))`)
+	db.Exec(`INSERT INTO songs (id, title, artist, album, album_path, path) VALUES
+		('a1', 'One', 'Queen', 'Greatest Hits', '/m/queen', '/m/queen/a1.mp3'),
+		('a2', 'Two', 'Queen', 'Greatest Hits', '/m/queen', '/m/queen/a2.mp3'),
+		('b1', 'Roxanne', 'The Police', 'Greatest Hits', '/m/police', '/m/police/b1.mp3')`)
+	if err := RebuildLibraryIndex(db); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	queen, police := AlbumID("Greatest Hits", "/m/queen"), AlbumID("Greatest Hits", "/m/police")
+
+	db.Exec(`INSERT INTO starred_albums (user_id, album_id, starred_at) VALUES (1, 'b1', '2025-01-01T00:00:00Z')`)
+	if err := migrateStarredAlbumIDs(db); err != nil {
+		t.Fatalf("migrateStarredAlbumIDs: %v", err)
+	}
+	callHandler(t, subsonicStar, "albumId=a2")
+
+	var got []string
+	rows, err := db.Query(`SELECT album_id FROM starred_albums WHERE user_id = 1 ORDER BY album_id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		got = append(got, id)
+	}
+	rows.Close()
+	want := []string{queen, police}
+	sort.Strings(want)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("starred album ids = %v, want %v", got, want)
+	}
+
+	list := albumIDs(callSearch(t, subsonicGetAlbumList2, "type=starred&size=10&f=json"), "albumList2")
+	if len(list) != 2 {
+		t.Errorf("starred album list = %v, want both albums", list)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+)
+
+// Search query syntax shared by search2/search3 and the Query*/Count* helpers:
+//
+//	ok computer              every word must match (title, artist, album...)
+//	"ok computer"            quoted phrase, words must appear together
+//	artist:radiohead         field-scoped word; fields are artist, album, title, genre
+//	album:"kid a"            field-scoped phrase
+//	beatles OR stones        either side may match; OR binds loosest, AND is implicit
+//
+// Unknown prefixes ("ac:dc") are treated as ordinary words, so plain queries
+// behave exactly as before. Terms are matched with FTS5 when it is available,
+// otherwise against songs.search_text (see search_text.go).
+
+type searchTerm struct {
+	field  string // "" (any field), "artist", "album", "title" or "genre"
+	text   string
+	phrase bool
+}
+
+// searchQuery is a disjunction of conjunctions: any group may match, and every
+// term of a group must match.
+type searchQuery [][]searchTerm
+
+// searchScope selects which columns unscoped words are matched against in the
+// LIKE fallback, mirroring what each listing searched before FTS existed.
+type searchScope int
+
+const (
+	searchScopeSong   searchScope = iota // album, artist and title
+	searchScopeAlbum                     // album and artist names
+	searchScopeArtist                    // artist and album_artist
+)
+
+var searchFields = map[string]bool{"artist": true, "album": true, "title": true, "genre": true}
+
+// parseSearchQuery splits a raw query into OR groups of terms. Terms whose text
+// normalizes to nothing (pure punctuation) are dropped, as are empty groups. A
+// bare OR or AND is an operator only between two other terms; anywhere else
+// (a lone "OR", "ok OR") it is searched for as a word.
+func parseSearchQuery(raw string) searchQuery {
+	var terms []searchTerm
+	rs := []rune(raw)
+	for i := 0; i < len(rs); {
+		if unicode.IsSpace(rs[i]) {
+			i++
+			continue
+		}
+		var term searchTerm
+		// Optional "field:" prefix.
+		if j := indexRune(rs[i:], ':'); j > 0 {
+			if name := strings.ToLower(string(rs[i : i+j])); searchFields[name] {
+				term.field = name
+				i += j + 1
+			}
+		}
+		if i < len(rs) && rs[i] == '"' {
+			end := i + 1
+			for end < len(rs) && rs[end] != '"' {
+				end++
+			}
+			term.text, term.phrase = string(rs[i+1:end]), true
+			i = end + 1
+		} else {
+			end := i
+			for end < len(rs) && !unicode.IsSpace(rs[end]) {
+				end++
+			}
+			term.text = string(rs[i:end])
+			i = end
+		}
+		if normalizeSearchText(term.text) == "" {
+			continue
+		}
+		terms = append(terms, term)
+	}
+
+	isOperator := func(k int) bool {
+		t := terms[k]
+		return t.field == "" && !t.phrase && (t.text == "OR" || t.text == "AND")
+	}
+	var q searchQuery
+	var group []searchTerm
+	for k, t := range terms {
+		if isOperator(k) && k > 0 && k < len(terms)-1 && !isOperator(k-1) && !isOperator(k+1) {
+			if t.text == "OR" {
+				q = append(q, group)
+				group = nil
+			}
+			continue
+		}
+		group = append(group, t)
+	}
+	if len(group) > 0 {
+		q = append(q, group)
+	}
+	return q
+}
+
+// indexRune returns the index of r in the leading non-space run of rs, or -1.
+func indexRune(rs []rune, r rune) int {
+	for i, c := range rs {
+		if unicode.IsSpace(c) {
+			return -1
+		}
+		if c == r {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q searchQuery) hasField(field string) bool {
+	for _, group := range q {
+		for _, t := range group {
+			if t.field == field {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ftsExpr renders the query as an FTS5 MATCH expression over songs_fts. Genre
+// is not indexed, so callers must not use it for queries with genre terms.
+func (q searchQuery) ftsExpr() string {
+	groups := make([]string, 0, len(q))
+	for _, group := range q {
+		parts := make([]string, 0, len(group))
+		for _, t := range group {
+			// Quote every term so punctuation and bare AND/OR/NEAR are literal;
+			// single words get '*' for prefix matching, phrases match as written.
+			p := `"` + strings.ReplaceAll(t.text, `"`, `""`) + `"`
+			if !t.phrase {
+				p += "*"
+			}
+			switch t.field {
+			case "artist":
+				p = "{artist album_artist} : " + p
+			case "album", "title":
+				p = t.field + " : " + p
+			}
+			parts = append(parts, p)
+		}
+		expr := strings.Join(parts, " ")
+		if len(q) > 1 {
+			expr = "(" + expr + ")"
+		}
+		groups = append(groups, expr)
+	}
+	return strings.Join(groups, " OR ")
+}
+
+// likeClause renders the query as a WHERE fragment over the songs row whose
+// columns are prefixed by prefix ("s." or ""). A query without usable terms
+// matches nothing.
+func (q searchQuery) likeClause(db *sql.DB, prefix string, scope searchScope) (string, []interface{}) {
+	if len(q) == 0 {
+		return "0", nil
+	}
+	substring := searchSubstringMatch(db)
+	expr := songSearchTextExpr(prefix)
+	var args []interface{}
+	groups := make([]string, 0, len(q))
+	for _, group := range q {
+		parts := make([]string, 0, len(group))
+		for _, t := range group {
+			if t.field == "genre" {
+				parts = append(parts, prefix+"genre LIKE ? ESCAPE '!'")
+				args = append(args, "%"+likeEscaper.Replace(strings.TrimSpace(t.text))+"%")
+				continue
+			}
+			// search_text is " album | artist album_artist | title ": the number of
+			// '|' before and after a match tells which segment it fell in.
+			nw := likeEscaper.Replace(normalizeSearchText(t.text))
+			p := "% " + nw + "%"
+			switch {
+			case substring:
+				p = "%" + nw + "%"
+			case t.phrase:
+				p = "% " + nw + " %"
+			}
+			field := t.field
+			if field == "" && scope == searchScopeAlbum {
+				field = "album+artist"
+			} else if field == "" && scope == searchScopeArtist {
+				field = "artist"
+			}
+			switch field {
+			case "album":
+				p += "|%|%"
+			case "artist":
+				p = "%|" + p + "|%"
+			case "album+artist":
+				p += "|%"
+			case "title":
+				p = "%|%|" + p
+			}
+			parts = append(parts, expr+" LIKE ? ESCAPE '!'")
+			args = append(args, p)
+		}
+		groups = append(groups, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(groups, " OR ") + ")", args
+}
+
+// songSearchFilter returns the JOIN and WHERE fragments that restrict the songs
+// table (referenced as table, e.g. "songs" or "s") to rows matching a search
+// query. FTS5 is used when available and the query has no genre terms;
+// otherwise the LIKE fallback matches unscoped words according to scope.
+func songSearchFilter(db *sql.DB, table, raw string, scope searchScope) (join, where string, args []interface{}) {
+	q := parseSearchQuery(raw)
+	if len(q) > 0 && !q.hasField("genre") && ftsAvailable(db) {
+		return " JOIN songs_fts f ON f.rowid = " + table + ".rowid", "songs_fts MATCH ?", []interface{}{q.ftsExpr()}
+	}
+	where, args = q.likeClause(db, table+".", scope)
+	return "", where, args
+}
+
+// albumMatchesSearch re-checks an album candidate against the query using its
+// name and display artist, ignoring case and diacritics. Title and genre terms
+// were already applied to the songs the album was built from.
+func albumMatchesSearch(raw, albumName, displayArtist string) bool {
+	q := parseSearchQuery(raw)
+	if len(q) == 0 {
+		return true
+	}
+	name, artist := normalizeSearchText(albumName), normalizeSearchText(displayArtist)
+	for _, group := range q {
+		ok := true
+		for _, t := range group {
+			nw := normalizeSearchText(t.text)
+			switch t.field {
+			case "":
+				ok = strings.Contains(name, nw) || strings.Contains(artist, nw)
+			case "album":
+				ok = strings.Contains(name, nw)
+			case "artist":
+				ok = strings.Contains(artist, nw)
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// songs.search_text holds a case- and accent-folded copy of each song's album,
+// artist, album_artist and title so the LIKE fallback (used when fts5 is not
+// compiled in, and for queries with genre terms) matches "Beyonce" against
+// "Beyoncé"; every other search goes through the songs_fts index. The
+// fallback patterns start with a wildcard, so no index can serve them and
+// they scan every song row. search_text is recomputed by RebuildLibraryIndex
+// at the end of every scan; rows added since then have an empty value and are
+// matched through songSearchTextExpr's raw-column fallback instead.
+//
+// Layout: " <album> | <artist> <album_artist> | <title> ". Every word is
+// preceded by a space, so "% word%" is a word-prefix match, and the number of
+// '|' required before/after the word scopes it to a field (see likeClause).
+//
+// Word-prefix matching is the default; setting search_substring_match=true in
+// the configuration restores the old match-anywhere behaviour ("%word%").
+
+// normalizeSearchText lowercases s, strips diacritics and replaces anything
+// that is not a letter or digit with a single space.
+func normalizeSearchText(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space := true
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToLower(r))
+			space = false
+		case !space:
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// songSearchText builds the songs.search_text value for one song.
+func songSearchText(title, artist, album, albumArtist string) string {
+	artists := strings.TrimSpace(normalizeSearchText(artist) + " " + normalizeSearchText(albumArtist))
+	return " " + normalizeSearchText(album) + " | " + artists + " | " + normalizeSearchText(title) + " "
+}
+
+// songSearchTextExpr is the SQL expression to match search patterns against.
+// prefix is the table alias including the dot ("s.") or "" for bare columns.
+func songSearchTextExpr(prefix string) string {
+	return `(CASE WHEN COALESCE(` + prefix + `search_text, '') != '' THEN ` + prefix + `search_text ELSE ' ' || LOWER(COALESCE(` +
+		prefix + `album, '') || ' | ' || COALESCE(` + prefix + `artist, '') || ' ' || COALESCE(` + prefix + `album_artist, '') || ' | ' || COALESCE(` +
+		prefix + `title, '')) || ' ' END)`
+}
+
+// searchSubstringMatch reports whether the admin opted into match-anywhere
+// searches instead of word-prefix matches.
+func searchSubstringMatch(db *sql.DB) bool {
+	return configBool(db, "search_substring_match")
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// activeTranscodes counts the ffmpeg processes currently streaming to a
+// client through streamWithTranscoding.
+var activeTranscodes atomic.Int64
+
+// hlsSessionCount returns the number of live HLS sessions.
+func hlsSessionCount() int {
+	n := 0
+	hlsSessionManager.sessions.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// getServerMetrics handles GET /api/v1/admin/metrics.
+func getServerMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"activeTranscodes": activeTranscodes.Load(),
+		"maxTranscodes":    maxConcurrentTranscodes(),
+		"hlsSessions":      hlsSessionCount(),
+	})
+}
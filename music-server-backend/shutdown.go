@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// appCtx is cancelled when the server starts shutting down. It is the base
+// context of every HTTP request, so handlers still running after the drain
+// period see their request context end, and background ffmpeg processes are
+// started with it so none outlive the server.
+var appCtx, stopApp = context.WithCancel(context.Background())
+
+const (
+	shutdownDrainTimeout = 10 * time.Second // in-flight requests
+	shutdownScanTimeout  = 30 * time.Second // running scans
+)
+
+// appBaseContext is http.Server.BaseContext.
+func appBaseContext(net.Listener) context.Context { return appCtx }
+
+// shutdown stops the server cleanly: scans are cancelled and background jobs
+// stopped, in-flight requests get shutdownDrainTimeout to finish, everything
+// still running is then cancelled, and the database is checkpointed and
+// closed once the scan has released scan_status.
+func shutdown(srv *http.Server, sig os.Signal) {
+	log.Printf("Signal %s received, initiating graceful shutdown...", sig)
+	isScanCancelled.Store(true)
+	schedulerMu.Lock()
+	if scheduler != nil {
+		scheduler.Stop()
+	}
+	schedulerMu.Unlock()
+	stopLibraryWatcher()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownDrainTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown error: %v; closing remaining connections", err)
+	}
+	stopApp() // streams and ffmpeg processes still running
+	srv.Close()
+
+	if !waitForScansToStop(shutdownScanTimeout) {
+		log.Printf("Scan still running after %s; scan_status is reset on next start", shutdownScanTimeout)
+	}
+
+	// Sessions are in-memory only, so their segments are useless after exit
+	cleanupAllSessions()
+
+	// Final DB checkpoint and close
+	if _, err := db.Exec("PRAGMA wal_checkpoint(FULL)"); err != nil {
+		log.Printf("Final WAL checkpoint failed: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Printf("Error closing DB: %v", err)
+	}
+}
+
+// waitForScansToStop polls scan_status until no scan is running, and reports
+// whether that happened within timeout.
+func waitForScansToStop(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		var scanning bool
+		if err := db.QueryRow("SELECT is_scanning FROM scan_status WHERE id = 1").Scan(&scanning); err != nil || !scanning {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
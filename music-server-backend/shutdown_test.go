@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWaitForScansToStop(t *testing.T) {
+	d := scanTestDB(t)
+	if !waitForScansToStop(time.Second) {
+		t.Fatal("idle server reported a running scan")
+	}
+
+	d.Exec(`UPDATE scan_status SET is_scanning = 1 WHERE id = 1`)
+	if waitForScansToStop(300 * time.Millisecond) {
+		t.Fatal("returned while the scan was still running")
+	}
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		d.Exec(`UPDATE scan_status SET is_scanning = 0 WHERE id = 1`)
+	}()
+	if !waitForScansToStop(5 * time.Second) {
+		t.Fatal("did not notice the scan finishing")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Signed stream URLs let a song be played where no auth header can be sent,
+// e.g. an <audio src> in an embedded web player. The URL carries the song id,
+// the issuing user (whose transcoding settings apply) and an expiry, signed
+// with HMAC-SHA256. Anyone holding the URL can stream that one song until it
+// expires, so lifetimes are short. The signature also covers the user's
+// stream_token_version, which logout bumps, so logging out revokes every URL
+// issued before it.
+
+const (
+	signedStreamDefaultTTL = 6 * time.Hour
+	signedStreamMaxTTL     = 24 * time.Hour
+)
+
+var (
+	signedStreamKeyOnce sync.Once
+	signedStreamKey     []byte
+)
+
+// signedStreamSecret returns the signing key: STREAM_URL_SECRET when set,
+// otherwise a key derived from the JWT key, so URLs survive restarts exactly
+// when JWTs do without the JWT key itself signing anything but JWTs.
+func signedStreamSecret() []byte {
+	signedStreamKeyOnce.Do(func() {
+		if secret := os.Getenv("STREAM_URL_SECRET"); secret != "" {
+			signedStreamKey = []byte(secret)
+			return
+		}
+		mac := hmac.New(sha256.New, jwtKey)
+		mac.Write([]byte("stream-url"))
+		signedStreamKey = mac.Sum(nil)
+	})
+	return signedStreamKey
+}
+
+// signStream returns the hex signature of a song id, user id, the user's
+// stream token version and expiry.
+func signStream(songID string, userID, version int, expires int64) string {
+	mac := hmac.New(sha256.New, signedStreamSecret())
+	mac.Write([]byte(songID + "\x00" + strconv.Itoa(userID) + "\x00" + strconv.Itoa(version) + "\x00" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// streamTokenVersion returns the user's current stream token version.
+func streamTokenVersion(userID int) (int, error) {
+	var version int
+	err := db.QueryRow(`SELECT stream_token_version FROM users WHERE id = ?`, userID).Scan(&version)
+	return version, err
+}
+
+// revokeSignedStreamURLs invalidates every stream URL the user has issued.
+func revokeSignedStreamURLs(userID int) error {
+	_, err := db.Exec(`UPDATE users SET stream_token_version = stream_token_version + 1 WHERE id = ?`, userID)
+	return err
+}
+
+// signedStreamURL builds the public /stream/signed URL for songID.
+func signedStreamURL(c *gin.Context, songID string, userID, version int, expires time.Time) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	exp := expires.Unix()
+	query := url.Values{
+		"id":  {songID},
+		"u":   {strconv.Itoa(userID)},
+		"exp": {strconv.FormatInt(exp, 10)},
+		"sig": {signStream(songID, userID, version, exp)},
+	}
+	return scheme + "://" + c.Request.Host + "/stream/signed?" + query.Encode()
+}
+
+// getSignedStreamURL handles GET /api/v1/song/:id/stream-url. The optional ttl
+// query parameter (seconds, at most a day) overrides the 6 hour default.
+func getSignedStreamURL(c *gin.Context) {
+	songID := c.Param("id")
+	if _, err := QuerySongPath(db, songID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
+		return
+	}
+
+	ttl := signedStreamDefaultTTL
+	if v := c.Query("ttl"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ttl must be a positive number of seconds"})
+			return
+		}
+		ttl = min(time.Duration(seconds)*time.Second, signedStreamMaxTTL)
+	}
+
+	userID := c.GetInt("userID")
+	version, err := streamTokenVersion(userID)
+	if err != nil {
+		log.Printf("Stream token version lookup for user %d failed: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not sign stream URL"})
+		return
+	}
+	expires := time.Now().Add(ttl)
+	c.JSON(http.StatusOK, gin.H{
+		"url":       signedStreamURL(c, songID, userID, version, expires),
+		"expiresAt": expires.UTC().Format(time.RFC3339),
+	})
+}
+
+// signedStreamHandler handles the public GET /stream/signed.
+func signedStreamHandler(c *gin.Context) {
+	songID := c.Query("id")
+	userID, errUser := strconv.Atoi(c.Query("u"))
+	exp, errExp := strconv.ParseInt(c.Query("exp"), 10, 64)
+	sig, errSig := hex.DecodeString(c.Query("sig"))
+	if songID == "" || errUser != nil || errExp != nil || errSig != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Malformed stream URL"})
+		return
+	}
+	if time.Now().Unix() > exp {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Stream URL has expired"})
+		return
+	}
+
+	// Deleting the user, or their logging out, revokes every URL they issued.
+	user := User{ID: userID}
+	var version int
+	if err := db.QueryRow(`SELECT username, stream_token_version FROM users WHERE id = ?`, userID).Scan(&user.Username, &version); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Stream URL is no longer valid"})
+		return
+	}
+	want, _ := hex.DecodeString(signStream(songID, userID, version, exp))
+	if !hmac.Equal(sig, want) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid signature"})
+		return
+	}
+	path, duration, err := QuerySongPathAndDuration(db, songID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Signed stream lookup of song %s failed: %v", songID, err)
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
+		return
+	}
+	if duration > 0 {
+		c.Header("X-Content-Duration", strconv.Itoa(duration))
+	}
+	streamSongForUser(c, user, path, duration, 0)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSignedStreamURL(t *testing.T) {
+	d := scanTestDB(t)
+	song := filepath.Join(t.TempDir(), "01.mp3")
+	if err := os.WriteFile(song, []byte("audio-bytes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, stream_token_version INTEGER NOT NULL DEFAULT 0)`,
+		`CREATE TABLE transcoding_settings (user_id INTEGER PRIMARY KEY, enabled INTEGER, format TEXT, bitrate INTEGER)`,
+		`INSERT INTO users (id, username) VALUES (1, 'test')`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Exec(`INSERT INTO songs (id, title, artist, album, path, duration) VALUES ('s1', 'One', 'Band', 'Record', ?, 3)`, song)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/v1/song/:id/stream-url", func(c *gin.Context) { c.Set("userID", 1); getSignedStreamURL(c) })
+	r.GET("/stream/signed", signedStreamHandler)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := get("/api/v1/song/s1/stream-url?ttl=60")
+	var issued struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &issued); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("stream-url: %d %s", w.Code, w.Body.String())
+	}
+	u, err := url.Parse(issued.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := get(u.RequestURI()); w.Code != http.StatusOK || w.Body.String() != "audio-bytes" {
+		t.Fatalf("signed stream: %d %q", w.Code, w.Body.String())
+	}
+
+	q := u.Query()
+	q.Set("id", "s2")
+	if w := get("/stream/signed?" + q.Encode()); w.Code != http.StatusForbidden {
+		t.Errorf("tampered song id: got %d, want 403", w.Code)
+	}
+
+	exp := time.Now().Add(-time.Minute).Unix()
+	q = url.Values{"id": {"s1"}, "u": {"1"}, "exp": {strconv.FormatInt(exp, 10)}, "sig": {signStream("s1", 1, 0, exp)}}
+	if w := get("/stream/signed?" + q.Encode()); w.Code != http.StatusForbidden {
+		t.Errorf("expired URL: got %d, want 403", w.Code)
+	}
+
+	// Logging out revokes the URLs issued before it.
+	if err := revokeSignedStreamURLs(1); err != nil {
+		t.Fatal(err)
+	}
+	if w := get(u.RequestURI()); w.Code != http.StatusForbidden {
+		t.Errorf("URL issued before logout: got %d, want 403", w.Code)
+	}
+}
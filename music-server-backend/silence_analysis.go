@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Silence analysis for crossfading clients. With analyze_silence=true a
+// background worker decodes each song once with ffmpeg's silencedetect and
+// stores how much silence it starts and ends with (silence_lead_in and
+// silence_lead_out, in seconds), so players can trim it for tighter
+// transitions. Songs are picked up in batches, never while a scan is running,
+// and a song that ffmpeg cannot decode (it exits with an error) is marked
+// analyzed without values so it is not retried on every pass.
+// GET /api/v1/song/:id/gaps exposes the result.
+
+const (
+	silenceAnalysisBatch   = 20
+	silenceAnalysisIdle    = 5 * time.Minute // wait when disabled or nothing is left
+	silenceAnalysisTimeout = 5 * time.Minute // per song
+	silenceNoiseFloor      = "-60dB"
+	silenceMinDuration     = "0.5" // seconds; shorter pauses are part of the music
+	silenceEdgeTolerance   = 0.05  // seconds from either end that still count as "at the edge"
+)
+
+var (
+	silenceStartRe   = regexp.MustCompile(`silence_start: (-?[0-9.]+)`)
+	silenceEndRe     = regexp.MustCompile(`silence_end: ([0-9.]+)`)
+	ffmpegDurationRe = regexp.MustCompile(`Duration: (\d+):(\d+):(\d+(?:\.\d+)?)`)
+	silenceEventsRe  = regexp.MustCompile(`silence_(?:start|end): -?[0-9.]+`)
+)
+
+// startSilenceAnalyzer runs the analysis worker for the life of the process.
+func startSilenceAnalyzer() {
+	go func() {
+		for {
+			if n := analyzeSilenceBatch(); n < silenceAnalysisBatch {
+				time.Sleep(silenceAnalysisIdle)
+			}
+		}
+	}()
+}
+
+// analyzeSilenceBatch analyzes up to silenceAnalysisBatch songs and returns
+// how many results it stored. Songs that timed out, could not be run through
+// ffmpeg or failed to save are left for a later pass; the short count makes
+// the worker idle instead of retrying the same batch straight away.
+func analyzeSilenceBatch() int {
+	if !configBool(db, "analyze_silence") {
+		return 0
+	}
+	var scanning bool
+	if db.QueryRow("SELECT is_scanning FROM scan_status WHERE id = 1").Scan(&scanning) == nil && scanning {
+		return 0
+	}
+
+	rows, err := db.Query(`SELECT id, path, COALESCE(duration, 0) FROM songs
+		WHERE silence_analyzed_at IS NULL AND cancelled = 0 LIMIT ?`, silenceAnalysisBatch)
+	if err != nil {
+		log.Printf("Silence analysis: failed to list songs: %v", err)
+		return 0
+	}
+	type pending struct {
+		id, path string
+		duration int
+	}
+	var songs []pending
+	for rows.Next() {
+		var p pending
+		if rows.Scan(&p.id, &p.path, &p.duration) == nil {
+			songs = append(songs, p)
+		}
+	}
+	rows.Close()
+
+	stored := 0
+	for _, s := range songs {
+		var leadIn, leadOut sql.NullFloat64
+		in, out, err := detectSilence(s.path, float64(s.duration))
+		if appCtx.Err() != nil {
+			break // shutting down; the song is picked up again next start
+		}
+		if err != nil {
+			log.Printf("Silence analysis failed for %s: %v", s.path, err)
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				continue // timed out or ffmpeg did not run; retry on a later pass
+			}
+		} else {
+			leadIn = sql.NullFloat64{Float64: in, Valid: true}
+			leadOut = sql.NullFloat64{Float64: out, Valid: true}
+		}
+		if _, err := db.Exec(`UPDATE songs SET silence_lead_in = ?, silence_lead_out = ?, silence_analyzed_at = ? WHERE id = ?`,
+			leadIn, leadOut, time.Now().Format(time.RFC3339), s.id); err != nil {
+			log.Printf("Silence analysis: failed to store result for %s: %v", s.id, err)
+			continue
+		}
+		stored++
+	}
+	return stored
+}
+
+// detectSilence runs silencedetect over the whole file. duration (seconds) is
+// the fallback when ffmpeg does not report the input duration.
+func detectSilence(path string, duration float64) (leadIn, leadOut float64, err error) {
+	ctx, cancel := context.WithTimeout(appCtx, silenceAnalysisTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-nostats", "-i", path, "-vn",
+		"-af", "silencedetect=noise="+silenceNoiseFloor+":d="+silenceMinDuration, "-f", "null", "-")
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return 0, 0, ctx.Err() // killed by the timeout or shutdown, not a decode failure
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	leadIn, leadOut = parseSilenceDetect(string(output), duration)
+	return leadIn, leadOut, nil
+}
+
+// parseSilenceDetect extracts the leading and trailing silence from ffmpeg's
+// silencedetect log. Only silences touching the start or the end of the track
+// count; a silence still open at the end of the log runs to the end.
+func parseSilenceDetect(output string, duration float64) (leadIn, leadOut float64) {
+	if m := ffmpegDurationRe.FindStringSubmatch(output); m != nil {
+		h, _ := strconv.ParseFloat(m[1], 64)
+		m2, _ := strconv.ParseFloat(m[2], 64)
+		sec, _ := strconv.ParseFloat(m[3], 64)
+		duration = h*3600 + m2*60 + sec
+	}
+
+	type span struct{ start, end float64 }
+	var spans []span
+	for _, ev := range silenceEventsRe.FindAllString(output, -1) {
+		if m := silenceStartRe.FindStringSubmatch(ev); m != nil {
+			start, _ := strconv.ParseFloat(m[1], 64)
+			spans = append(spans, span{start: max(start, 0), end: -1})
+		} else if m := silenceEndRe.FindStringSubmatch(ev); m != nil && len(spans) > 0 {
+			spans[len(spans)-1].end, _ = strconv.ParseFloat(m[1], 64)
+		}
+	}
+	if len(spans) == 0 {
+		return 0, 0
+	}
+
+	first, last := spans[0], spans[len(spans)-1]
+	if first.start <= silenceEdgeTolerance && first.end >= 0 {
+		leadIn = first.end
+	}
+	if duration > 0 && (last.end < 0 || last.end >= duration-silenceEdgeTolerance) {
+		leadOut = max(duration-last.start, 0)
+	}
+	if len(spans) == 1 && first.start <= silenceEdgeTolerance && leadOut > 0 {
+		leadIn = 0 // the whole track is silent; report it once, as lead-out
+	}
+	return leadIn, leadOut
+}
+
+// getSongGaps handles GET /api/v1/song/:id/gaps. leadIn and leadOut are null
+// until the song has been analyzed.
+func getSongGaps(c *gin.Context) {
+	id := c.Param("id")
+	var leadIn, leadOut sql.NullFloat64
+	var analyzedAt sql.NullString
+	err := db.QueryRow(`SELECT silence_lead_in, silence_lead_out, silence_analyzed_at FROM songs WHERE id = ? AND cancelled = 0`, id).
+		Scan(&leadIn, &leadOut, &analyzedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load song"})
+		return
+	}
+	resp := gin.H{"id": id, "analyzed": analyzedAt.Valid, "leadIn": nil, "leadOut": nil}
+	if leadIn.Valid {
+		resp["leadIn"] = leadIn.Float64
+	}
+	if leadOut.Valid {
+		resp["leadOut"] = leadOut.Float64
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSilenceDetect(t *testing.T) {
+	const header = "  Duration: 00:03:20.00, start: 0.000000, bitrate: 320 kb/s\n"
+	cases := []struct {
+		name            string
+		log             string
+		duration        float64
+		leadIn, leadOut float64
+	}{
+		{"no silence", header, 0, 0, 0},
+		{"lead-in and open lead-out", header +
+			"[silencedetect @ 0x1] silence_start: 0\n[silencedetect @ 0x1] silence_end: 1.25 | silence_duration: 1.25\n" +
+			"[silencedetect @ 0x1] silence_start: 90\n[silencedetect @ 0x1] silence_end: 91 | silence_duration: 1\n" +
+			"[silencedetect @ 0x1] silence_start: 196.5\n", 0, 1.25, 3.5},
+		{"lead-out closed at end of stream", header +
+			"[silencedetect @ 0x1] silence_start: 197\n[silencedetect @ 0x1] silence_end: 200 | silence_duration: 3\n", 0, 0, 3},
+		{"pause in the middle only", header +
+			"[silencedetect @ 0x1] silence_start: 50\n[silencedetect @ 0x1] silence_end: 52 | silence_duration: 2\n", 0, 0, 0},
+		{"duration from the song row", "[silencedetect @ 0x1] silence_start: 58\n", 60, 0, 2},
+		{"all silent", header + "[silencedetect @ 0x1] silence_start: -0.01\n", 0, 0, 200},
+	}
+	for _, tc := range cases {
+		leadIn, leadOut := parseSilenceDetect(tc.log, tc.duration)
+		if leadIn != tc.leadIn || leadOut != tc.leadOut {
+			t.Errorf("%s: got (%g, %g), want (%g, %g)", tc.name, leadIn, leadOut, tc.leadIn, tc.leadOut)
+		}
+	}
+}
+
+// Only an ffmpeg that ran and exited with an error marks a song analyzed;
+// when ffmpeg cannot be started the song stays pending and the short count
+// makes the worker back off.
+func TestAnalyzeSilenceBatchOnlyMarksDecodeFailures(t *testing.T) {
+	d := scanTestDB(t)
+	for _, stmt := range []string{
+		`ALTER TABLE songs ADD COLUMN silence_lead_in REAL`,
+		`ALTER TABLE songs ADD COLUMN silence_lead_out REAL`,
+		`ALTER TABLE songs ADD COLUMN silence_analyzed_at TEXT`,
+		`INSERT INTO configuration (key, value) VALUES ('analyze_silence', 'true')`,
+		`INSERT INTO songs (id, title, path) VALUES ('s1', 'Broken', '/m/broken.flac')`,
+	} {
+		if _, err := d.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	analyzed := func() bool {
+		var at *string
+		if err := d.QueryRow(`SELECT silence_analyzed_at FROM songs WHERE id = 's1'`).Scan(&at); err != nil {
+			t.Fatal(err)
+		}
+		return at != nil
+	}
+
+	bin := t.TempDir()
+	t.Setenv("PATH", bin)
+	if n := analyzeSilenceBatch(); n != 0 || analyzed() {
+		t.Fatalf("without ffmpeg: stored %d, analyzed %v; want 0, false", n, analyzed())
+	}
+
+	if err := os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte("#!/bin/sh\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if n := analyzeSilenceBatch(); n != 1 || !analyzed() {
+		t.Fatalf("decode failure: stored %d, analyzed %v; want 1, true", n, analyzed())
+	}
+}
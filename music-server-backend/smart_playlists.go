@@ -0,0 +1,446 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Smart playlists are stored as a rule set instead of a song list and are
+// evaluated on every read, so "played in the last 30 days" or "Jazz I have
+// starred" stay current without anyone editing them. Subsonic clients see
+// them through getPlaylists/getPlaylist as ordinary playlists whose id starts
+// with "smart-"; they are created and edited through /api/v1/smart-playlists.
+//
+// A rule set looks like
+//
+//	{"match": "all", "rules": [
+//	    {"field": "genre", "operator": "is", "value": "Jazz"},
+//	    {"field": "starred", "operator": "is", "value": true}],
+//	 "sort": "lastPlayed", "order": "desc", "limit": 100}
+//
+// match is "all" (default) or "any". Operators depend on the field:
+//
+//	genre, artist          is, isNot, contains, notContains, startsWith
+//	year, playCount        is, isNot, gt, lt, inRange ([from, to])
+//	lastPlayed, dateAdded  inTheLast, notInTheLast (days), before, after (YYYY-MM-DD)
+//	starred                is (true or false)
+//
+// Text comparisons ignore case, genre "is" matches one entry of a
+// ";"-separated genre list, and "starred" refers to the stars of whoever is
+// viewing the playlist, so a shared "my favourites" list shows each listener
+// their own. playCount and lastPlayed are the library-wide values returned on
+// songs. A playlist holds at most smartPlaylistMaxSongs songs.
+
+const (
+	smartPlaylistIDPrefix = "smart-"
+	smartPlaylistMaxSongs = 1000
+)
+
+type smartRule struct {
+	Field    string          `json:"field"`
+	Operator string          `json:"operator"`
+	Value    json.RawMessage `json:"value"`
+}
+
+type smartRuleSet struct {
+	Match string      `json:"match,omitempty"`
+	Rules []smartRule `json:"rules"`
+	Sort  string      `json:"sort,omitempty"`
+	Order string      `json:"order,omitempty"`
+	Limit int         `json:"limit,omitempty"`
+}
+
+// smartSortColumns maps the sort names of a rule set to SQL.
+var smartSortColumns = map[string]string{
+	"title":      "s.title COLLATE NOCASE",
+	"artist":     "s.artist COLLATE NOCASE",
+	"album":      "s.album COLLATE NOCASE",
+	"year":       "COALESCE(s.year, 0)",
+	"playCount":  "COALESCE(s.play_count, 0)",
+	"lastPlayed": "julianday(s.last_played)",
+	"dateAdded":  "julianday(s.date_added)",
+}
+
+// smartTextColumns, smartNumberColumns and smartDateColumns map rule fields
+// to SQL by the kind of value they compare.
+var (
+	smartTextColumns   = map[string]string{"genre": "COALESCE(s.genre, '')", "artist": "COALESCE(s.artist, '')"}
+	smartNumberColumns = map[string]string{"year": "COALESCE(s.year, 0)", "playCount": "COALESCE(s.play_count, 0)"}
+	smartDateColumns   = map[string]string{"lastPlayed": "s.last_played", "dateAdded": "s.date_added"}
+)
+
+// parseSmartRuleSet decodes and validates a stored or submitted rule set.
+func parseSmartRuleSet(data []byte) (smartRuleSet, error) {
+	var rs smartRuleSet
+	if err := json.Unmarshal(data, &rs); err != nil {
+		return rs, fmt.Errorf("invalid rules: %v", err)
+	}
+	if _, _, err := rs.where(0); err != nil {
+		return rs, err
+	}
+	return rs, nil
+}
+
+// where translates the rules into a condition on songs aliased s. userID is
+// whose stars the "starred" field looks at.
+func (rs smartRuleSet) where(userID int) (string, []interface{}, error) {
+	joiner := " AND "
+	switch rs.Match {
+	case "", "all":
+	case "any":
+		joiner = " OR "
+	default:
+		return "", nil, fmt.Errorf("match must be all or any")
+	}
+	if len(rs.Rules) == 0 {
+		return "", nil, errors.New("at least one rule is required")
+	}
+	if rs.Sort != "" && rs.Sort != "random" && smartSortColumns[rs.Sort] == "" {
+		return "", nil, fmt.Errorf("unknown sort %q", rs.Sort)
+	}
+	if rs.Order != "" && rs.Order != "asc" && rs.Order != "desc" {
+		return "", nil, errors.New("order must be asc or desc")
+	}
+	if rs.Limit < 0 {
+		return "", nil, errors.New("limit must not be negative")
+	}
+
+	var clauses []string
+	var args []interface{}
+	for _, r := range rs.Rules {
+		clause, ruleArgs, err := r.sql(userID)
+		if err != nil {
+			return "", nil, fmt.Errorf("rule %s %s: %v", r.Field, r.Operator, err)
+		}
+		clauses = append(clauses, "("+clause+")")
+		args = append(args, ruleArgs...)
+	}
+	return strings.Join(clauses, joiner), args, nil
+}
+
+func (r smartRule) sql(userID int) (string, []interface{}, error) {
+	if col, ok := smartTextColumns[r.Field]; ok {
+		var v string
+		if err := json.Unmarshal(r.Value, &v); err != nil || v == "" {
+			return "", nil, errors.New("value must be a non-empty string")
+		}
+		escaped := likeEscaper.Replace(v)
+		if r.Field == "genre" && (r.Operator == "is" || r.Operator == "isNot") {
+			clause := `(';' || REPLACE(` + col + `, '; ', ';') || ';') LIKE ? ESCAPE '!'`
+			if r.Operator == "isNot" {
+				clause = "NOT " + clause
+			}
+			return clause, []interface{}{"%;" + escaped + ";%"}, nil
+		}
+		switch r.Operator {
+		case "is":
+			return col + " = ? COLLATE NOCASE", []interface{}{v}, nil
+		case "isNot":
+			return col + " != ? COLLATE NOCASE", []interface{}{v}, nil
+		case "contains":
+			return col + " LIKE ? ESCAPE '!'", []interface{}{"%" + escaped + "%"}, nil
+		case "notContains":
+			return col + " NOT LIKE ? ESCAPE '!'", []interface{}{"%" + escaped + "%"}, nil
+		case "startsWith":
+			return col + " LIKE ? ESCAPE '!'", []interface{}{escaped + "%"}, nil
+		}
+		return "", nil, errors.New("unknown operator")
+	}
+
+	if col, ok := smartNumberColumns[r.Field]; ok {
+		if r.Operator == "inRange" {
+			var bounds [2]float64
+			if err := json.Unmarshal(r.Value, &bounds); err != nil {
+				return "", nil, errors.New("value must be [from, to]")
+			}
+			return col + " BETWEEN ? AND ?", []interface{}{bounds[0], bounds[1]}, nil
+		}
+		var v float64
+		if err := json.Unmarshal(r.Value, &v); err != nil {
+			return "", nil, errors.New("value must be a number")
+		}
+		op, ok := map[string]string{"is": "=", "isNot": "!=", "gt": ">", "lt": "<"}[r.Operator]
+		if !ok {
+			return "", nil, errors.New("unknown operator")
+		}
+		return col + " " + op + " ?", []interface{}{v}, nil
+	}
+
+	if col, ok := smartDateColumns[r.Field]; ok {
+		switch r.Operator {
+		case "inTheLast", "notInTheLast":
+			var days int
+			if err := json.Unmarshal(r.Value, &days); err != nil || days <= 0 {
+				return "", nil, errors.New("value must be a positive number of days")
+			}
+			since := "-" + strconv.Itoa(days) + " days"
+			if r.Operator == "inTheLast" {
+				return "julianday(" + col + ") >= julianday('now', ?)", []interface{}{since}, nil
+			}
+			// Songs never played (or without a date) count as not in the last n days.
+			return "COALESCE(julianday(" + col + "), 0) < julianday('now', ?)", []interface{}{since}, nil
+		case "before", "after":
+			var v string
+			if err := json.Unmarshal(r.Value, &v); err != nil {
+				return "", nil, errors.New("value must be a YYYY-MM-DD date")
+			}
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				return "", nil, errors.New("value must be a YYYY-MM-DD date")
+			}
+			if r.Operator == "before" {
+				return "julianday(" + col + ") < julianday(?)", []interface{}{v}, nil
+			}
+			return "julianday(" + col + ") >= julianday(?, '+1 day')", []interface{}{v}, nil
+		}
+		return "", nil, errors.New("unknown operator")
+	}
+
+	if r.Field == "starred" {
+		var v bool
+		if err := json.Unmarshal(r.Value, &v); err != nil || r.Operator != "is" {
+			return "", nil, errors.New("use operator is with true or false")
+		}
+		clause := "EXISTS (SELECT 1 FROM starred_songs st WHERE st.song_id = s.id AND st.user_id = ?)"
+		if !v {
+			clause = "NOT " + clause
+		}
+		return clause, []interface{}{userID}, nil
+	}
+
+	return "", nil, errors.New("unknown field")
+}
+
+// orderBy returns the ORDER BY for the rule set, falling back to the library
+// order QuerySongs uses.
+func (rs smartRuleSet) orderBy() string {
+	if rs.Sort == "random" {
+		return "RANDOM()"
+	}
+	col := smartSortColumns[rs.Sort]
+	if col == "" {
+		return "s.artist, s.album, s.title"
+	}
+	dir := "ASC"
+	if rs.Order == "desc" {
+		dir = "DESC"
+	}
+	return col + " " + dir + ", s.artist, s.album, s.title"
+}
+
+func (rs smartRuleSet) limit() int {
+	if rs.Limit <= 0 || rs.Limit > smartPlaylistMaxSongs {
+		return smartPlaylistMaxSongs
+	}
+	return rs.Limit
+}
+
+// smartPlaylist is a stored smart playlist.
+type smartPlaylist struct {
+	ID           int          `json:"id"`
+	Name         string       `json:"name"`
+	Public       bool         `json:"public"`
+	Rules        smartRuleSet `json:"rules"`
+	CreatedAt    string       `json:"createdAt"`
+	UpdatedAt    string       `json:"updatedAt"`
+	ownerID      int
+	owner        string
+	ownerIsAdmin bool
+}
+
+func (p smartPlaylist) subsonicID() string {
+	return smartPlaylistIDPrefix + strconv.Itoa(p.ID)
+}
+
+const smartPlaylistColumns = `sp.id, sp.name, COALESCE(sp.public, 0), sp.rules, sp.created_at, sp.updated_at, sp.user_id, u.username, u.is_admin`
+
+func scanSmartPlaylist(row interface{ Scan(...interface{}) error }) (smartPlaylist, error) {
+	var p smartPlaylist
+	var rules string
+	if err := row.Scan(&p.ID, &p.Name, &p.Public, &rules, &p.CreatedAt, &p.UpdatedAt, &p.ownerID, &p.owner, &p.ownerIsAdmin); err != nil {
+		return p, err
+	}
+	rs, err := parseSmartRuleSet([]byte(rules))
+	if err != nil {
+		return p, fmt.Errorf("smart playlist %d: %v", p.ID, err)
+	}
+	p.Rules = rs
+	return p, nil
+}
+
+// visibleSmartPlaylists lists the smart playlists userID may see, with the
+// same visibility as regular playlists: their own, admins' and public ones.
+func visibleSmartPlaylists(userID int) ([]smartPlaylist, error) {
+	rows, err := db.Query(`SELECT `+smartPlaylistColumns+` FROM smart_playlists sp JOIN users u ON u.id = sp.user_id
+		WHERE sp.user_id = ? OR u.is_admin = 1 OR sp.public = 1 ORDER BY sp.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var lists []smartPlaylist
+	for rows.Next() {
+		p, err := scanSmartPlaylist(rows)
+		if err != nil {
+			log.Printf("Skipping smart playlist: %v", err)
+			continue
+		}
+		lists = append(lists, p)
+	}
+	return lists, rows.Err()
+}
+
+// visibleSmartPlaylist loads one smart playlist by its Subsonic id.
+func visibleSmartPlaylist(subsonicID string, userID int) (smartPlaylist, error) {
+	id, err := strconv.Atoi(strings.TrimPrefix(subsonicID, smartPlaylistIDPrefix))
+	if err != nil {
+		return smartPlaylist{}, sql.ErrNoRows
+	}
+	return scanSmartPlaylist(db.QueryRow(`SELECT `+smartPlaylistColumns+` FROM smart_playlists sp JOIN users u ON u.id = sp.user_id
+		WHERE sp.id = ? AND (sp.user_id = ? OR u.is_admin = 1 OR sp.public = 1)`, id, userID))
+}
+
+// smartPlaylistSongs evaluates the playlist for viewerID, whose stars the
+// "starred" rule matches and are reported on the songs.
+func smartPlaylistSongs(p smartPlaylist, viewerID int) ([]SongResult, error) {
+	where, args, err := p.Rules.where(viewerID)
+	if err != nil {
+		return nil, err
+	}
+	return QuerySongs(db, SongQueryOptions{
+		IncludeGenre:   true,
+		IncludeStarred: true,
+		UserID:         viewerID,
+		Where:          where,
+		WhereArgs:      args,
+		OrderBy:        p.Rules.orderBy(),
+		Limit:          p.Rules.limit(),
+	})
+}
+
+// smartPlaylistSummary counts the songs and total duration of a playlist as
+// viewerID sees it, without loading them, for getPlaylists.
+func smartPlaylistSummary(p smartPlaylist, viewerID int) (count, duration int, err error) {
+	where, args, err := p.Rules.where(viewerID)
+	if err != nil {
+		return 0, 0, err
+	}
+	args = append(args, p.Rules.limit())
+	err = db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(duration), 0) FROM (
+		SELECT COALESCE(s.duration, 0) AS duration FROM songs s WHERE s.cancelled = 0 AND (`+where+`)
+		ORDER BY `+p.Rules.orderBy()+` LIMIT ?)`, args...).Scan(&count, &duration)
+	return count, duration, err
+}
+
+// --- JSON API ---
+
+type smartPlaylistRequest struct {
+	Name   string          `json:"name"`
+	Public bool            `json:"public"`
+	Rules  json.RawMessage `json:"rules"`
+}
+
+func (req smartPlaylistRequest) validate() (string, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return "", errors.New("name is required")
+	}
+	if _, err := parseSmartRuleSet(req.Rules); err != nil {
+		return "", err
+	}
+	return string(req.Rules), nil
+}
+
+// getSmartPlaylistsHandler handles GET /api/v1/smart-playlists, listing the
+// caller's own smart playlists.
+func getSmartPlaylistsHandler(c *gin.Context) {
+	userID := c.GetInt("userID")
+	rows, err := db.Query(`SELECT `+smartPlaylistColumns+` FROM smart_playlists sp JOIN users u ON u.id = sp.user_id
+		WHERE sp.user_id = ? ORDER BY sp.name`, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch smart playlists"})
+		return
+	}
+	defer rows.Close()
+	lists := []smartPlaylist{}
+	for rows.Next() {
+		p, err := scanSmartPlaylist(rows)
+		if err != nil {
+			log.Printf("Skipping smart playlist: %v", err)
+			continue
+		}
+		lists = append(lists, p)
+	}
+	c.JSON(http.StatusOK, gin.H{"playlists": lists})
+}
+
+// createSmartPlaylistHandler handles POST /api/v1/smart-playlists.
+func createSmartPlaylistHandler(c *gin.Context) {
+	var req smartPlaylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	rules, err := req.validate()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := db.Exec(`INSERT INTO smart_playlists (user_id, name, public, rules, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		c.GetInt("userID"), strings.TrimSpace(req.Name), req.Public, rules, now, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create smart playlist"})
+		return
+	}
+	id, _ := res.LastInsertId()
+	c.JSON(http.StatusOK, gin.H{"id": int(id), "subsonicId": smartPlaylistIDPrefix + strconv.FormatInt(id, 10)})
+}
+
+// updateSmartPlaylistHandler handles PUT /api/v1/smart-playlists/:id. Only
+// the owner may change a smart playlist.
+func updateSmartPlaylistHandler(c *gin.Context) {
+	var req smartPlaylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	rules, err := req.validate()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := db.Exec(`UPDATE smart_playlists SET name = ?, public = ?, rules = ?, updated_at = ? WHERE id = ? AND user_id = ?`,
+		strings.TrimSpace(req.Name), req.Public, rules, time.Now().UTC().Format(time.RFC3339), c.Param("id"), c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update smart playlist"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Smart playlist not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// deleteSmartPlaylistHandler handles DELETE /api/v1/smart-playlists/:id.
+func deleteSmartPlaylistHandler(c *gin.Context) {
+	res, err := db.Exec(`DELETE FROM smart_playlists WHERE id = ? AND user_id = ?`, c.Param("id"), c.GetInt("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete smart playlist"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Smart playlist not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
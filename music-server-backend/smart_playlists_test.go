@@ -0,0 +1,134 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupSmartPlaylistTestDB(t *testing.T) {
+	t.Helper()
+	db = setupPlaylistTestDB(t)
+	t.Cleanup(func() { db.Close() })
+
+	recent := time.Now().Add(-48 * time.Hour).Format(time.RFC3339)
+	old := time.Now().AddDate(0, -3, 0).Format(time.RFC3339)
+	stmts := []string{
+		`CREATE TABLE smart_playlists (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, name TEXT NOT NULL, public INTEGER NOT NULL DEFAULT 0, rules TEXT NOT NULL, created_at TEXT NOT NULL, updated_at TEXT NOT NULL)`,
+		`INSERT INTO users (id, username, is_admin) VALUES (2, 'other', 0)`,
+		`INSERT INTO songs (id, title, artist, album, album_path, path, genre, year, duration, play_count, last_played, cancelled) VALUES
+			('jazz1', 'Blue', 'Miles', 'K', '/m/K', '/m/K/1.mp3', 'Jazz', 1959, 300, 12, '` + recent + `', 0),
+			('jazz2', 'So What', 'Miles', 'K', '/m/K', '/m/K/2.mp3', 'Jazz; Modal', 1959, 500, 3, '` + old + `', 0),
+			('rock1', 'Loud', 'Band', 'R', '/m/R', '/m/R/1.mp3', 'Rock', 1991, 200, 0, NULL, 0),
+			('gone', 'Gone', 'Miles', 'K', '/m/K', '/m/K/3.mp3', 'Jazz', 1959, 100, 50, '` + recent + `', 1)`,
+		`INSERT INTO starred_songs (user_id, song_id, starred_at) VALUES (1, 'jazz2', '2024-01-01T00:00:00Z'), (2, 'jazz1', '2024-01-01T00:00:00Z')`,
+		`INSERT INTO smart_playlists (id, user_id, name, rules, created_at, updated_at) VALUES
+			(1, 1, 'Starred Jazz', '{"rules":[{"field":"genre","operator":"is","value":"jazz"},{"field":"starred","operator":"is","value":true}]}', '', ''),
+			(2, 1, 'Recent', '{"rules":[{"field":"lastPlayed","operator":"inTheLast","value":30}],"sort":"playCount","order":"desc"}', '', ''),
+			(3, 2, 'Private', '{"rules":[{"field":"year","operator":"lt","value":2000}]}', '', '')`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+}
+
+func entryIDs(pl map[string]interface{}) []string {
+	var ids []string
+	entries, _ := pl["entry"].([]interface{})
+	for _, e := range entries {
+		ids = append(ids, e.(map[string]interface{})["id"].(string))
+	}
+	return ids
+}
+
+func TestSmartPlaylistRules(t *testing.T) {
+	setupSmartPlaylistTestDB(t)
+
+	cases := []struct {
+		rules string
+		want  string
+	}{
+		{`{"rules":[{"field":"genre","operator":"is","value":"Modal"}]}`, "jazz2"},
+		{`{"rules":[{"field":"genre","operator":"isNot","value":"jazz"}]}`, "rock1"},
+		{`{"rules":[{"field":"artist","operator":"startsWith","value":"mil"}],"sort":"title"}`, "jazz1,jazz2"},
+		{`{"rules":[{"field":"year","operator":"inRange","value":[1990,1999]}]}`, "rock1"},
+		{`{"rules":[{"field":"playCount","operator":"gt","value":5}]}`, "jazz1"},
+		{`{"rules":[{"field":"lastPlayed","operator":"notInTheLast","value":30}],"sort":"title"}`, "rock1,jazz2"},
+		{`{"rules":[{"field":"starred","operator":"is","value":false}],"sort":"title"}`, "jazz1,rock1"},
+		{`{"match":"any","rules":[{"field":"genre","operator":"is","value":"Rock"},{"field":"starred","operator":"is","value":true}],"sort":"title"}`, "rock1,jazz2"},
+		{`{"rules":[{"field":"genre","operator":"contains","value":"a"}],"sort":"title","order":"desc","limit":1}`, "jazz2"},
+	}
+	for _, tc := range cases {
+		rs, err := parseSmartRuleSet([]byte(tc.rules))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.rules, err)
+		}
+		songs, err := smartPlaylistSongs(smartPlaylist{Rules: rs, ownerID: 1}, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.rules, err)
+		}
+		var ids []string
+		for _, s := range songs {
+			ids = append(ids, s.ID)
+		}
+		if got := strings.Join(ids, ","); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.rules, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{
+		`{"rules":[]}`,
+		`{"rules":[{"field":"bitrate","operator":"is","value":320}]}`,
+		`{"rules":[{"field":"year","operator":"contains","value":"19"}]}`,
+		`{"rules":[{"field":"dateAdded","operator":"before","value":"last week"}]}`,
+		`{"match":"some","rules":[{"field":"genre","operator":"is","value":"Jazz"}]}`,
+		`{"rules":[{"field":"genre","operator":"is","value":"Jazz"}],"sort":"path"}`,
+	} {
+		if _, err := parseSmartRuleSet([]byte(bad)); err == nil {
+			t.Errorf("%s: expected a validation error", bad)
+		}
+	}
+}
+
+func TestSmartPlaylistsInSubsonicPlaylists(t *testing.T) {
+	setupSmartPlaylistTestDB(t)
+
+	resp := callHandler(t, subsonicGetPlaylists, "")
+	lists := resp["playlists"].(map[string]interface{})["playlist"].([]interface{})
+	var names []string
+	for _, l := range lists {
+		p := l.(map[string]interface{})
+		names = append(names, p["name"].(string))
+		if p["id"] == "smart-2" && (p["songCount"].(float64) != 1 || p["duration"].(float64) != 300) {
+			t.Errorf("Recent summary = %v", p)
+		}
+	}
+	if got := strings.Join(names, ","); got != "Recent,Starred Jazz" {
+		t.Fatalf("playlists = %s", got)
+	}
+
+	pl, _ := callHandler(t, subsonicGetPlaylist, "id=smart-1")["playlist"].(map[string]interface{})
+	if pl == nil || pl["name"] != "Starred Jazz" || strings.Join(entryIDs(pl), ",") != "jazz2" {
+		t.Fatalf("smart-1 = %v", pl)
+	}
+
+	// "starred" follows whoever looks at the playlist, not its owner.
+	sp, err := visibleSmartPlaylist("smart-1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	songs, err := smartPlaylistSongs(sp, 2)
+	if err != nil || len(songs) != 1 || songs[0].ID != "jazz1" {
+		t.Fatalf("smart-1 for user 2 = %v, %v; want jazz1", songs, err)
+	}
+	if count, _, err := smartPlaylistSummary(sp, 2); err != nil || count != 1 {
+		t.Fatalf("smart-1 summary for user 2 = %d, %v", count, err)
+	}
+
+	if _, err := visibleSmartPlaylist("smart-3", 1); err != sql.ErrNoRows {
+		t.Fatalf("another user's private smart playlist should not be visible: %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// The AudioMuse-AI Core keys its analysis on the song id it was given when
+// the song was analyzed. Ids the server has since rewritten (the move to
+// base62 UUIDs, or a song removed and re-added) no longer match songs.id, so
+// the map and playlists made from it would point at songs that 404. Each song
+// therefore keeps the id the core knows it by in songs.external_id (its
+// pre-UUID integer id, or its first id; see ensureSongExternalIDs), ids going
+// to the core are translated to it, and ids coming back are accepted in
+// either form. Items still unknown under both are matched by title and
+// artist when exactly one song fits.
+
+// songIDResolver maps core items to current song ids.
+type songIDResolver struct {
+	ids           map[string]bool
+	external      map[string]string
+	byTitleArtist map[string]string // "" when several songs share the key
+}
+
+func titleArtistKey(title, artist string) string {
+	return strings.ToLower(strings.TrimSpace(title)) + "\x00" + strings.ToLower(strings.TrimSpace(artist))
+}
+
+// loadSongIDResolver indexes every non-cancelled song by id, external id and
+// title with either its artist or album artist.
+func loadSongIDResolver(db *sql.DB) (*songIDResolver, error) {
+	rows, err := db.Query(`SELECT id, external_id, COALESCE(title, ''), COALESCE(artist, ''), COALESCE(album_artist, '') FROM songs WHERE cancelled = 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	r := &songIDResolver{ids: map[string]bool{}, external: map[string]string{}, byTitleArtist: map[string]string{}}
+	add := func(key, id string) {
+		if prev, ok := r.byTitleArtist[key]; ok && prev != id {
+			r.byTitleArtist[key] = ""
+			return
+		}
+		r.byTitleArtist[key] = id
+	}
+	for rows.Next() {
+		var id, externalID, title, artist, albumArtist string
+		if err := rows.Scan(&id, &externalID, &title, &artist, &albumArtist); err != nil {
+			return nil, err
+		}
+		r.ids[id] = true
+		if externalID != "" && externalID != id {
+			r.external[externalID] = id
+		}
+		if title == "" {
+			continue
+		}
+		add(titleArtistKey(title, artist), id)
+		if albumArtist != "" && !strings.EqualFold(albumArtist, artist) {
+			add(titleArtistKey(title, albumArtist), id)
+		}
+	}
+	return r, rows.Err()
+}
+
+// resolve returns the current id of the core item, or false when it cannot be
+// matched to a single song.
+func (r *songIDResolver) resolve(itemID, title, artist string) (string, bool) {
+	if r.ids[itemID] {
+		return itemID, true
+	}
+	if id, ok := r.external[itemID]; ok {
+		return id, true
+	}
+	if title == "" {
+		return "", false
+	}
+	id := r.byTitleArtist[titleArtistKey(title, artist)]
+	return id, id != ""
+}
+
+// coreItemAliases remembers core item ids that reconciled to a different song
+// id, so later requests carrying only the core id (a map selection made
+// before a refresh) still resolve.
+var coreItemAliases = struct {
+	sync.RWMutex
+	m map[string]string
+}{m: map[string]string{}}
+
+func rememberCoreItemAlias(coreID, songID string) {
+	coreItemAliases.Lock()
+	coreItemAliases.m[coreID] = songID
+	coreItemAliases.Unlock()
+}
+
+func lookupCoreItemAlias(coreID string) (string, bool) {
+	coreItemAliases.RLock()
+	defer coreItemAliases.RUnlock()
+	id, ok := coreItemAliases.m[coreID]
+	return id, ok
+}
+
+// jsonItemID reads an item id the core may send as a string or a number.
+func jsonItemID(v interface{}) string {
+	switch id := v.(type) {
+	case string:
+		return id
+	case json.Number:
+		return id.String()
+	}
+	return ""
+}
+
+// reconcileMapItems rewrites each map item's item_id to the current song id,
+// keeping the core's id in core_item_id when they differ, and drops items that
+// match no song. It returns the kept items and how many were dropped.
+func reconcileMapItems(r *songIDResolver, items []map[string]interface{}) ([]map[string]interface{}, int) {
+	kept := make([]map[string]interface{}, 0, len(items))
+	unmatched := 0
+	for _, item := range items {
+		coreID := jsonItemID(item["item_id"])
+		title, _ := item["title"].(string)
+		artist, _ := item["author"].(string)
+		if artist == "" {
+			artist, _ = item["artist"].(string)
+		}
+		id, ok := r.resolve(coreID, title, artist)
+		if !ok {
+			unmatched++
+			continue
+		}
+		if id != coreID {
+			item["core_item_id"] = coreID
+			rememberCoreItemAlias(coreID, id)
+		}
+		item["item_id"] = id
+		kept = append(kept, item)
+	}
+	return kept, unmatched
+}
+
+// resolveSongIDs maps ids in either form, songs.id or external_id, to the
+// current ids of non-cancelled songs. Ids matching no song are left out; a
+// songs.id match wins over another song's external_id.
+func resolveSongIDs(db *sql.DB, ids []string) (map[string]string, error) {
+	resolved := map[string]string{}
+	const chunk = 400
+	for start := 0; start < len(ids); start += chunk {
+		part := ids[start:min(start+chunk, len(ids))]
+		args := make([]interface{}, 0, 2*len(part))
+		for _, id := range part {
+			args = append(args, id)
+		}
+		args = append(args, args...)
+		placeholders := strings.Repeat("?,", len(part)-1) + "?"
+		rows, err := db.Query(`SELECT id, external_id FROM songs WHERE cancelled = 0 AND (id IN (`+placeholders+`) OR external_id IN (`+placeholders+`))`, args...)
+		if err != nil {
+			return nil, err
+		}
+		var direct []string
+		for rows.Next() {
+			var id, externalID string
+			if err := rows.Scan(&id, &externalID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			direct = append(direct, id)
+			if externalID != "" {
+				if _, taken := resolved[externalID]; !taken {
+					resolved[externalID] = id
+				}
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		for _, id := range direct {
+			resolved[id] = id
+		}
+	}
+	return resolved, nil
+}
+
+// coreItemID returns the id the AudioMuse-AI Core knows a song by, given its
+// id in either form. Unknown ids are returned unchanged.
+func coreItemID(db *sql.DB, id string) string {
+	var externalID string
+	err := db.QueryRow(`SELECT COALESCE(NULLIF(external_id, ''), id) FROM songs WHERE id = ? OR external_id = ? ORDER BY id = ? DESC LIMIT 1`, id, id, id).Scan(&externalID)
+	if err != nil {
+		return id
+	}
+	return externalID
+}
+
+// reconcileSongIDs maps ids from a client or the core to current song ids,
+// in order. Ids that match nothing are returned in unmatched instead of
+// failing the whole list.
+func reconcileSongIDs(db *sql.DB, ids []string) (matched, unmatched []string, err error) {
+	candidates := make([]string, 0, len(ids))
+	for _, id := range ids {
+		candidates = append(candidates, id)
+		if alias, ok := lookupCoreItemAlias(id); ok {
+			candidates = append(candidates, alias)
+		}
+	}
+	resolved, err := resolveSongIDs(db, candidates)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, id := range ids {
+		if current, ok := resolved[id]; ok {
+			matched = append(matched, current)
+		} else if alias, ok := lookupCoreItemAlias(id); ok && resolved[alias] != "" {
+			matched = append(matched, resolved[alias])
+		} else {
+			unmatched = append(unmatched, id)
+		}
+	}
+	return matched, unmatched, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSongExternalIDs(t *testing.T) {
+	d := setupFullTestDB(t)
+	prevDB := db
+	db = d
+	t.Cleanup(func() { db = prevDB })
+
+	// A song migrated from an integer id, and one added before the column existed.
+	if _, err := d.Exec(`INSERT INTO songs (id, title, artist, album, path, play_count, duration, external_id) VALUES ('uuidA', 'A', 'Band', 'X', '/m/a.mp3', 0, 0, '42')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Exec(`INSERT INTO songs (id, title, artist, album, path, play_count, duration) VALUES ('uuidB', 'B', 'Band', 'X', '/m/b.mp3', 0, 0)`); err != nil {
+		t.Fatal(err)
+	}
+	ensureSongExternalIDs(d)
+	if _, err := d.Exec(`INSERT INTO songs (id, title, artist, album, path, play_count, duration) VALUES ('uuidC', 'C', 'Band', 'X', '/m/c.mp3', 0, 0)`); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]string{"uuidA": "42", "uuidB": "uuidB", "uuidC": "uuidC"} {
+		var got string
+		d.QueryRow(`SELECT external_id FROM songs WHERE id = ?`, id).Scan(&got)
+		if got != want {
+			t.Errorf("external_id of %s = %q, want %q", id, got, want)
+		}
+	}
+
+	for in, want := range map[string]string{"uuidA": "42", "42": "42", "uuidC": "uuidC", "nope": "nope"} {
+		if got := coreItemID(d, in); got != want {
+			t.Errorf("coreItemID(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	songs, err := getSongsByIDs([]string{"uuidC", "42", "nope", "uuidB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range songs {
+		got = append(got, s.ID)
+	}
+	if len(got) != 3 || got[0] != "uuidC" || got[1] != "uuidA" || got[2] != "uuidB" {
+		t.Errorf("getSongsByIDs = %v, want [uuidC uuidA uuidB] in request order", got)
+	}
+
+	matched, unmatched, err := reconcileSongIDs(d, []string{"42", "uuidB", "7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matched) != 2 || matched[0] != "uuidA" || matched[1] != "uuidB" || len(unmatched) != 1 || unmatched[0] != "7" {
+		t.Errorf("reconcileSongIDs = %v, %v", matched, unmatched)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPathsPerLookup caps the paths one POST /api/v1/songs/by-path may resolve.
+const maxPathsPerLookup = 5000
+
+// songsByPathHandler resolves a JSON array of file paths to song ids, for
+// integrations (taggers, the AudioMuse-AI Core) that only know files. ids is
+// aligned with the request; unmatched paths get null so callers can report
+// the misses.
+func songsByPathHandler(c *gin.Context) {
+	var paths []string
+	if err := c.ShouldBindJSON(&paths); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a JSON array of paths"})
+		return
+	}
+	if len(paths) > maxPathsPerLookup {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many paths", "max": maxPathsPerLookup})
+		return
+	}
+
+	found, err := BatchGetSongIDsByPath(db, paths)
+	if err != nil {
+		log.Printf("Error resolving song paths: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	ids := make([]*string, len(paths))
+	matched := 0
+	for i, p := range paths {
+		if id, ok := found[p]; ok {
+			ids[i] = &id
+			matched++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"ids": ids, "matched": matched, "unmatched": len(paths) - matched})
+}
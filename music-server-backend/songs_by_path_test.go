@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestSongsByPath(t *testing.T) {
+	d := scanTestDB(t)
+	nfd := norm.NFD.String("/music/Café/01.flac")
+	for _, s := range [][]string{{"a", "/music/A/01.mp3", "0"}, {"b", nfd, "0"}, {"c", "/music/gone.mp3", "1"}} {
+		if _, err := d.Exec(`INSERT INTO songs (id, title, path, cancelled) VALUES (?, 't', ?, ?)`, s[0], s[1], s[2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := gin.New()
+	r.POST("/songs/by-path", songsByPathHandler)
+	body := `["/music/A/./01.mp3", "/music/Café/01.flac", "/music/gone.mp3", "/nowhere.mp3"]`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/songs/by-path", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		IDs       []*string `json:"ids"`
+		Matched   int       `json:"matched"`
+		Unmatched int       `json:"unmatched"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.IDs) != 4 || resp.IDs[0] == nil || *resp.IDs[0] != "a" || resp.IDs[1] == nil || *resp.IDs[1] != "b" ||
+		resp.IDs[2] != nil || resp.IDs[3] != nil || resp.Matched != 2 || resp.Unmatched != 2 {
+		t.Errorf("response = %s", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/songs/by-path", strings.NewReader(`{"paths":[]}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("non-array body = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Artists and albums sort and index by a sort name rather than their display
+// name: a leading word listed in the ignored_articles configuration key
+// (space-separated, matched case-insensitively) is skipped, and the rest is
+// lowercased with diacritics removed, so "The Beatles" files under B and
+// "Émilie Simon" next to "Emiliana Torrini". The display name is untouched.
+//
+// The derived artists and albums tables store the sort names (sort_name, and
+// artist_sort_name for an album's display artist), recomputed by
+// RebuildLibraryIndex at the end of every scan and whenever the setting
+// changes. Queries that group songs directly look the stored sort names up
+// through artistSortNameSQL and albumSortNameSQL.
+const defaultIgnoredArticles = "The El La Los Las Le Les"
+
+// ignoredArticles reads ignored_articles, falling back to the defaults when the
+// key has never been set.
+func ignoredArticles(db *sql.DB) []string {
+	value, err := GetConfig(db, "ignored_articles")
+	if err != nil {
+		value = defaultIgnoredArticles
+	}
+	return strings.Fields(value)
+}
+
+// ignoredArticlesSetting returns the articles as the space-separated list
+// getIndexes reports to clients.
+func ignoredArticlesSetting(db *sql.DB) string {
+	return strings.Join(ignoredArticles(db), " ")
+}
+
+// sortName returns the sort name of an artist or album name.
+func sortName(name string, articles []string) string {
+	name = strings.TrimSpace(name)
+	for _, article := range articles {
+		if rest, ok := cutArticle(name, article); ok {
+			name = rest
+			break
+		}
+	}
+	var b strings.Builder
+	b.Grow(len(name))
+	for _, r := range norm.NFD.String(name) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// cutArticle strips article and the spaces after it from the start of name. A
+// name that is only the article is kept whole.
+func cutArticle(name, article string) (string, bool) {
+	if len(name) <= len(article) || !strings.EqualFold(name[:len(article)], article) || name[len(article)] != ' ' {
+		return name, false
+	}
+	rest := strings.TrimLeft(name[len(article):], " ")
+	return rest, rest != ""
+}
+
+// indexLetter is the getIndexes/getArtists index an artist with this sort
+// name is filed under: its first letter or digit, upper-cased, or "#".
+func indexLetter(sort string) string {
+	for _, r := range sort {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return strings.ToUpper(string(r))
+		}
+	}
+	return "#"
+}
+
+// artistSortNameSQL returns an ORDER BY term for the artist named by the SQL
+// expression expr: its sort name from the artists table, or, for an album
+// artist without songs of its own, the one stored with its albums. Sort names
+// are lower-cased, so the lookups ignore case and can use the name indexes.
+func artistSortNameSQL(expr string) string {
+	name := "TRIM(" + expr + ")"
+	return `COALESCE(
+		(SELECT artists.sort_name FROM artists WHERE artists.name = ` + name + ` COLLATE NOCASE LIMIT 1),
+		(SELECT albums.artist_sort_name FROM albums WHERE albums.artist = ` + name + ` COLLATE NOCASE LIMIT 1),
+		LOWER(` + name + `))`
+}
+
+// albumSortNameSQL returns an ORDER BY term for the album of the songs row
+// aliased as alias: its sort name from the albums table.
+func albumSortNameSQL(alias string) string {
+	return `COALESCE((SELECT albums.sort_name FROM albums WHERE albums.group_key = ` + albumGroupKeySQL(alias) + `), LOWER(TRIM(` + alias + `.album)))`
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSortName(t *testing.T) {
+	articles := []string{"The", "Los", "Le"}
+	for name, want := range map[string]string{
+		"The Beatles":     "beatles",
+		"the   Rolling":   "rolling",
+		"Los Lobos":       "lobos",
+		"Émilie Simon":    "emilie simon",
+		"Theatre of Hate": "theatre of hate",
+		"The":             "the",
+		"The The":         "the",
+		"Legendary Pink":  "legendary pink",
+		"  AC/DC ":        "ac/dc",
+	} {
+		if got := sortName(name, articles); got != want {
+			t.Errorf("sortName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestArticlesSortPastTheIndexLetter(t *testing.T) {
+	d := scanTestDB(t)
+	d.Exec(`INSERT INTO configuration (key, value) VALUES ('ignored_articles', 'The Los')`)
+	for i, s := range []struct{ artist, album string }{
+		{"The Beatles", "The White Album"},
+		{"Abba", "Arrival"},
+		{"Cream", "Disraeli Gears"},
+		{"Los Lobos", "Kiko"},
+	} {
+		if _, err := d.Exec(`INSERT INTO songs (id, title, artist, album, path, album_path, date_added) VALUES (?, 't', ?, ?, ?, ?, '2024-01-01T00:00:00Z')`,
+			fmt.Sprint("s", i), s.artist, s.album, fmt.Sprintf("/m/%d/t.mp3", i), fmt.Sprintf("/m/%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := RebuildLibraryIndex(d); err != nil {
+		t.Fatal(err)
+	}
+	invalidateBrowseCache()
+
+	artists, _ := callHandler(t, subsonicGetArtists, "")["artists"].(map[string]interface{})
+	indexes, _ := artists["index"].([]interface{})
+	var got []string
+	for _, idx := range indexes {
+		idx := idx.(map[string]interface{})
+		for _, a := range idx["artist"].([]interface{}) {
+			a := a.(map[string]interface{})
+			got = append(got, fmt.Sprintf("%s:%s:%s", idx["name"], a["name"], a["sortName"]))
+		}
+	}
+	if want := []string{"A:Abba:abba", "B:The Beatles:beatles", "C:Cream:cream", "L:Los Lobos:lobos"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("getArtists = %v, want %v", got, want)
+	}
+
+	list, _ := callHandler(t, subsonicGetAlbumList2, "type=alphabeticalByName")["albumList2"].(map[string]interface{})
+	got = nil
+	for _, a := range list["album"].([]interface{}) {
+		a := a.(map[string]interface{})
+		got = append(got, fmt.Sprintf("%s:%s", a["name"], a["sortName"]))
+	}
+	if want := []string{"Arrival:arrival", "Disraeli Gears:disraeli gears", "Kiko:kiko", "The White Album:white album"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("getAlbumList2 alphabeticalByName = %v, want %v", got, want)
+	}
+
+	results, err := QueryArtists(d, ArtistQueryOptions{IncludeCounts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for _, r := range results {
+		got = append(got, r.Name)
+	}
+	if want := []string{"Abba", "The Beatles", "Cream", "Los Lobos"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("QueryArtists = %v, want %v", got, want)
+	}
+
+	albums, err := QueryAlbums(d, AlbumQueryOptions{GroupByPath: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for _, a := range albums {
+		got = append(got, a.Name)
+	}
+	if want := []string{"Arrival", "Disraeli Gears", "Kiko", "The White Album"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("QueryAlbums = %v, want %v", got, want)
+	}
+}
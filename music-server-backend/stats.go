@@ -0,0 +1,87 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LibraryStats is the body of GET /api/v1/stats. TotalDuration is in
+// seconds and TotalSize in bytes; LastScan is the most recent
+// last_scan_ended of any library path (RFC 3339), empty before the first
+// scan.
+type LibraryStats struct {
+	Songs         int    `json:"songs"`
+	Artists       int    `json:"artists"`
+	Albums        int    `json:"albums"`
+	Genres        int    `json:"genres"`
+	TotalDuration int64  `json:"totalDuration"`
+	TotalSize     int64  `json:"totalSize"`
+	LastScan      string `json:"lastScan"`
+}
+
+// getLibraryStats handles GET /api/v1/stats. The numbers only change when
+// the library does, so they share the browse cache and are rebuilt after
+// every scan.
+func getLibraryStats(c *gin.Context) {
+	stats, err := cachedBrowse(browseCacheStats, func() (interface{}, error) { return loadLibraryStats() })
+	if err != nil {
+		log.Printf("Error loading library stats: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load library statistics"})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+func loadLibraryStats() (*LibraryStats, error) {
+	var stats LibraryStats
+	var err error
+	if stats.Songs, err = CountSongs(db, ""); err != nil {
+		return nil, err
+	}
+	if stats.Artists, err = CountArtists(db, "", UseAlbumArtist(db)); err != nil {
+		return nil, err
+	}
+	if stats.Albums, err = CountAlbums(db, ""); err != nil {
+		return nil, err
+	}
+	if stats.Genres, err = countGenres(); err != nil {
+		return nil, err
+	}
+	if err := db.QueryRow(`SELECT COALESCE(SUM(duration), 0), COALESCE(SUM(size), 0) FROM songs WHERE cancelled = 0`).
+		Scan(&stats.TotalDuration, &stats.TotalSize); err != nil {
+		return nil, err
+	}
+	var lastScan sql.NullString
+	if err := db.QueryRow(`SELECT MAX(last_scan_ended) FROM library_paths`).Scan(&lastScan); err != nil {
+		return nil, err
+	}
+	stats.LastScan = lastScan.String
+	return &stats, nil
+}
+
+// countGenres counts distinct genres, splitting the ";"-separated values
+// multi-genre files are stored with.
+func countGenres() (int, error) {
+	rows, err := db.Query(`SELECT DISTINCT genre FROM songs WHERE cancelled = 0 AND genre IS NOT NULL AND genre != ''`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	seen := map[string]bool{}
+	for rows.Next() {
+		var genre string
+		if err := rows.Scan(&genre); err != nil {
+			return 0, err
+		}
+		for _, g := range strings.Split(genre, ";") {
+			if g = strings.ToLower(strings.TrimSpace(g)); g != "" {
+				seen[g] = true
+			}
+		}
+	}
+	return len(seen), rows.Err()
+}
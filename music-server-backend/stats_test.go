@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLibraryStats(t *testing.T) {
+	d := scanTestDB(t)
+	invalidateBrowseCache()
+	t.Cleanup(invalidateBrowseCache)
+	d.Exec(`INSERT INTO songs (id, title, artist, album, album_path, genre, duration, size, path) VALUES
+		('s1', 'A', 'Artist 1', 'Album 1', '/m/1', 'Rock;Pop', 200, 1000, '/m/1/a.mp3'),
+		('s2', 'B', 'Artist 1', 'Album 1', '/m/1', 'rock', 100, 500, '/m/1/b.mp3'),
+		('s3', 'C', 'Artist 2', 'Album 2', '/m/2', '', 60, 250, '/m/2/c.mp3')`)
+	d.Exec(`INSERT INTO songs (id, title, artist, album, genre, duration, size, path, cancelled) VALUES
+		('s4', 'D', 'Artist 3', 'Album 3', 'Jazz', 999, 999, '/m/3/d.mp3', 1)`)
+	d.Exec(`INSERT INTO library_paths (path, last_scan_ended) VALUES ('/m', '2026-01-02T03:04:05Z'), ('/n', '2025-12-31T00:00:00Z')`)
+
+	r := gin.New()
+	r.GET("/stats", getLibraryStats)
+	get := func() LibraryStats {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+		var stats LibraryStats
+		if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("stats: %d %s", w.Code, w.Body.String())
+		}
+		return stats
+	}
+
+	want := LibraryStats{Songs: 3, Artists: 2, Albums: 2, Genres: 2, TotalDuration: 360, TotalSize: 1750, LastScan: "2026-01-02T03:04:05Z"}
+	if got := get(); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+
+	// Cached until the next scan invalidates the browse cache.
+	d.Exec(`UPDATE songs SET cancelled = 1 WHERE id = 's3'`)
+	if got := get(); got.Songs != 3 {
+		t.Errorf("songs = %d before invalidation, want the cached 3", got.Songs)
+	}
+	invalidateBrowseCache()
+	if got := get(); got.Songs != 2 || got.Artists != 1 {
+		t.Errorf("stats after invalidation = %+v", got)
+	}
+}
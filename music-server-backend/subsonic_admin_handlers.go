@@ -3,30 +3,36 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
+	"io"
 	"log"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func subsonicStartScan(c *gin.Context) {
 	user := c.MustGet("user").(User)
-	if !user.IsAdmin {
-		subsonicRespond(c, newSubsonicErrorResponse(40, "Admin rights required."))
+	if !userHasRole(user, roleScan) {
+		subsonicRespond(c, newSubsonicErrorResponse(50, "User is not authorized to start a scan."))
 		return
 	}
 
-	var isScanning bool
-	err := db.QueryRow("SELECT is_scanning FROM scan_status WHERE id = 1").Scan(&isScanning)
-	if err != nil && err != sql.ErrNoRows {
-		subsonicRespond(c, newSubsonicErrorResponse(0, "DB error checking scan status."))
-		return
+	pathId := 0
+	if pathIdStr := c.Query("pathId"); pathIdStr != "" {
+		id, err := strconv.Atoi(pathIdStr)
+		if err != nil {
+			subsonicRespond(c, newSubsonicErrorResponse(10, "Invalid pathId provided."))
+			return
+		}
+		pathId = id
 	}
 
-	if isScanning {
+	gen, ok := claimScanStatus(db)
+	if !ok {
 		log.Println("Scan requested, but a scan is already in progress.")
 		subsonicGetScanStatus(c)
 		return
@@ -36,28 +42,15 @@ func subsonicStartScan(c *gin.Context) {
 	dbPath := getEnv("DATABASE_PATH", "/config/music.db")
 	if err := performBackup(db, dbPath); err != nil {
 		log.Printf("Pre-scan backup failed: %v", err)
+		releaseScanStatus(db, gen)
 		subsonicRespond(c, newSubsonicErrorResponse(0, "Pre-scan backup failed; aborting scan."))
 		return
 	}
 
-	_, err = db.Exec("UPDATE scan_status SET is_scanning = 1, songs_added = 0, last_update_time = ? WHERE id = 1", time.Now().Format(time.RFC3339))
-	if err != nil {
-		log.Printf("Error starting scan in DB: %v", err)
-		subsonicRespond(c, newSubsonicErrorResponse(0, "DB error starting scan."))
-		return
-	}
-
-	pathIdStr := c.Query("pathId")
-	if pathIdStr != "" {
-		pathId, err := strconv.Atoi(pathIdStr)
-		if err != nil {
-			subsonicRespond(c, newSubsonicErrorResponse(10, "Invalid pathId provided."))
-			db.Exec("UPDATE scan_status SET is_scanning = 0 WHERE id = 1")
-			return
-		}
-		go scanSingleLibrary(pathId)
+	if pathId != 0 {
+		go scanSingleLibrary(gen, pathId)
 	} else {
-		go scanAllLibraries()
+		go scanAllLibraries(gen)
 	}
 
 	subsonicGetScanStatus(c)
@@ -67,18 +60,19 @@ func subsonicGetScanStatus(c *gin.Context) {
 	_ = c.MustGet("user") // Auth is handled by middleware
 	var isScanning bool
 	var songsAdded int64
-	err := db.QueryRow("SELECT is_scanning, songs_added FROM scan_status WHERE id = 1").Scan(&isScanning, &songsAdded)
+	var stalledAt string
+	err := db.QueryRow("SELECT is_scanning, songs_added, COALESCE(stalled_at, '') FROM scan_status WHERE id = 1").Scan(&isScanning, &songsAdded, &stalledAt)
 	if err != nil {
 		subsonicRespond(c, newSubsonicResponse(&SubsonicScanStatus{Scanning: false, Count: 0}))
 		return
 	}
-	subsonicRespond(c, newSubsonicResponse(&SubsonicScanStatus{Scanning: isScanning, Count: songsAdded}))
+	subsonicRespond(c, newSubsonicResponse(&SubsonicScanStatus{Scanning: isScanning, Count: songsAdded, StalledAt: stalledAt}))
 }
 
 func subsonicGetLibraryPaths(c *gin.Context) {
 	user := c.MustGet("user").(User)
 	_ = user // Auth is handled by middleware
-	rows, err := db.Query("SELECT id, path, song_count, last_scan_ended FROM library_paths ORDER BY path")
+	rows, err := db.Query("SELECT id, path, song_count, last_scan_ended, COALESCE(scan_schedule, '') FROM library_paths ORDER BY path")
 	if err != nil {
 		subsonicRespond(c, newSubsonicErrorResponse(0, "DB error fetching library paths."))
 		return
@@ -89,29 +83,104 @@ func subsonicGetLibraryPaths(c *gin.Context) {
 	for rows.Next() {
 		var p LibraryPath
 		var lastScan sql.NullString
-		if err := rows.Scan(&p.ID, &p.Path, &p.SongCount, &lastScan); err != nil {
+		if err := rows.Scan(&p.ID, &p.Path, &p.SongCount, &lastScan, &p.ScanSchedule); err != nil {
 			log.Printf("Error scanning library path row: %v", err)
 			continue
 		}
 		paths = append(paths, SubsonicLibraryPath{
-			ID: p.ID, Path: p.Path, SongCount: p.SongCount, LastScanEnded: lastScan.String,
+			ID: p.ID, Path: p.Path, SongCount: p.SongCount, LastScanEnded: lastScan.String, ScanSchedule: p.ScanSchedule,
 		})
 	}
 	subsonicRespond(c, newSubsonicResponse(&SubsonicLibraryPaths{Paths: paths}))
 }
 
+// validateLibraryPath checks that a library path is an absolute, readable
+// directory and returns it cleaned (no trailing separator), so that the
+// prefix matching in removeMissingSongsFromPath and subsonicDeleteLibraryPath
+// sees the same form whatever the admin typed.
+func validateLibraryPath(path string) (string, error) {
+	path = strings.TrimSpace(path)
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("library path %q must be absolute", path)
+	}
+	path = filepath.Clean(path)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("library path %q does not exist", path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot access library path %q: %v", path, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("library path %q is not a directory", path)
+	}
+	f, err := os.Open(path)
+	if err == nil {
+		_, err = f.ReadDir(1)
+		f.Close()
+		if err == io.EOF {
+			err = nil
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("library path %q is not readable by the server: %v", path, err)
+	}
+	return path, nil
+}
+
+// checkLibraryPathOverlap rejects a (cleaned) library path that is inside,
+// or contains, another configured path: the songs below both would be
+// counted twice and the scan of one would treat the other's songs as its own.
+// excludeID is the path being updated, or 0 when adding.
+func checkLibraryPathOverlap(path string, excludeID int) error {
+	rows, err := db.Query("SELECT path FROM library_paths WHERE id != ?", excludeID)
+	if err != nil {
+		return fmt.Errorf("failed to load library paths: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var existing string
+		if rows.Scan(&existing) != nil {
+			continue
+		}
+		existing = filepath.Clean(existing)
+		switch {
+		case pathWithin(path, existing):
+			return fmt.Errorf("library path %q is already covered by the library path %q", path, existing)
+		case pathWithin(existing, path):
+			return fmt.Errorf("library path %q contains the existing library path %q; remove that one first", path, existing)
+		}
+	}
+	return rows.Err()
+}
+
 func subsonicAddLibraryPath(c *gin.Context) {
 	user := c.MustGet("user").(User)
 	_ = user // Auth is handled by middleware
 	var req struct {
-		Path string `json:"path"`
+		Path         string `json:"path"`
+		ScanSchedule string `json:"scanSchedule"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil || req.Path == "" {
 		subsonicRespond(c, newSubsonicErrorResponse(10, "A valid path is required."))
 		return
 	}
+	if err := validateLibraryScanSchedule(req.ScanSchedule); err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(10, err.Error()))
+		return
+	}
+	path, err := validateLibraryPath(req.Path)
+	if err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(10, err.Error()))
+		return
+	}
+	if err := checkLibraryPathOverlap(path, 0); err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(0, err.Error()))
+		return
+	}
+	req.Path = path
 
-	_, err := db.Exec("INSERT INTO library_paths (path) VALUES (?)", req.Path)
+	_, err = db.Exec("INSERT INTO library_paths (path, scan_schedule) VALUES (?, NULLIF(TRIM(?), ''))", req.Path, req.ScanSchedule)
 	if err != nil {
 		log.Printf("Database error adding library path '%s': %v", req.Path, err)
 		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
@@ -121,6 +190,10 @@ func subsonicAddLibraryPath(c *gin.Context) {
 		}
 		return
 	}
+	if err := ReloadScheduler(); err != nil {
+		log.Printf("Error reloading scheduler after library path change: %v", err)
+	}
+	ReloadLibraryWatcher()
 	subsonicGetLibraryPaths(c)
 }
 
@@ -130,16 +203,40 @@ func subsonicUpdateLibraryPath(c *gin.Context) {
 	var req struct {
 		ID   int    `json:"id"`
 		Path string `json:"path"`
+		// Omitted keeps the current schedule; "" reverts to the global one.
+		ScanSchedule *string `json:"scanSchedule"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil || req.Path == "" || req.ID == 0 {
 		subsonicRespond(c, newSubsonicErrorResponse(10, "Valid ID and path are required."))
 		return
 	}
-	_, err := db.Exec("UPDATE library_paths SET path = ? WHERE id = ?", req.Path, req.ID)
+	path, err := validateLibraryPath(req.Path)
+	if err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(10, err.Error()))
+		return
+	}
+	if err := checkLibraryPathOverlap(path, req.ID); err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(0, err.Error()))
+		return
+	}
+	req.Path = path
+	if req.ScanSchedule != nil {
+		if err := validateLibraryScanSchedule(*req.ScanSchedule); err != nil {
+			subsonicRespond(c, newSubsonicErrorResponse(10, err.Error()))
+			return
+		}
+		_, err = db.Exec("UPDATE library_paths SET path = ?, scan_schedule = NULLIF(TRIM(?), '') WHERE id = ?", req.Path, *req.ScanSchedule, req.ID)
+	} else {
+		_, err = db.Exec("UPDATE library_paths SET path = ? WHERE id = ?", req.Path, req.ID)
+	}
 	if err != nil {
 		subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to update library path."))
 		return
 	}
+	if err := ReloadScheduler(); err != nil {
+		log.Printf("Error reloading scheduler after library path change: %v", err)
+	}
+	ReloadLibraryWatcher()
 	subsonicGetLibraryPaths(c)
 }
 
@@ -163,13 +260,7 @@ func subsonicDeleteLibraryPath(c *gin.Context) {
 	}
 
 	// Mark all songs in this library path as cancelled (soft delete)
-	searchPath := libraryPath
-	if !strings.HasSuffix(searchPath, "/") && !strings.HasSuffix(searchPath, "\\") {
-		searchPath += string(filepath.Separator)
-	}
-	likePath := searchPath + "%"
-
-	result, err := db.Exec("UPDATE songs SET cancelled = 1 WHERE path LIKE ? AND cancelled = 0", likePath)
+	result, err := db.Exec("UPDATE songs SET cancelled = 1, cancel_reason = ? WHERE "+songUnderPathClause+" AND cancelled = 0", cancelReasonLibraryRemoved, songPathPattern(libraryPath))
 	if err != nil {
 		log.Printf("Error marking songs as cancelled for deleted library path: %v", err)
 	} else {
@@ -183,6 +274,10 @@ func subsonicDeleteLibraryPath(c *gin.Context) {
 		subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to delete library path."))
 		return
 	}
+	if err := ReloadScheduler(); err != nil {
+		log.Printf("Error reloading scheduler after library path change: %v", err)
+	}
+	ReloadLibraryWatcher()
 	subsonicGetLibraryPaths(c)
 }
 
@@ -217,7 +312,8 @@ func subsonicGetConfiguration(c *gin.Context) {
 			log.Printf("Error scanning configuration row: %v", err)
 			continue
 		}
-		configs = append(configs, SubsonicConfiguration{Name: key, Value: value})
+		spec, _ := lookupConfigSpec(key)
+		configs = append(configs, SubsonicConfiguration{Name: key, Value: value, Type: string(spec.Type), Default: spec.Default})
 	}
 	subsonicRespond(c, newSubsonicResponse(&SubsonicConfigurations{Configurations: configs}))
 }
@@ -234,22 +330,74 @@ func subsonicSetConfiguration(c *gin.Context) {
 		subsonicRespond(c, newSubsonicErrorResponse(10, "Parameter 'key' is required."))
 		return
 	}
-	_, err := db.Exec("INSERT OR REPLACE INTO configuration (key, value) VALUES (?, ?)", key, value)
+	// Typed keys are checked and normalized before anything reads them (a bad
+	// cron expression would otherwise only fail when the scheduler reloads);
+	// see config_schema.go. Unknown keys are stored as given.
+	value, err := validateConfigValue(key, value)
+	if err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(10, err.Error()))
+		return
+	}
+	_, err = db.Exec("INSERT OR REPLACE INTO configuration (key, value) VALUES (?, ?)", key, value)
 	if err != nil {
 		log.Printf("Error saving configuration key '%s': %v", key, err)
 		subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to save configuration."))
 		return
 	}
 
-	// Restart scheduler if any schedule-related config changed
-	if key == "scan_schedule" || key == "scan_enabled" ||
-		key == "analysis_schedule" || key == "analysis_enabled" ||
-		key == "clustering_schedule" || key == "clustering_enabled" {
-		log.Println("Scheduler configuration changed, restarting scheduler...")
-		if scheduler != nil {
-			scheduler.Stop()
+	// Turning off recoverable passwords wipes the stored copies immediately
+	if key == "disable_plaintext_passwords" && value == "true" {
+		if n, err := clearStoredPlainPasswords(db); err != nil {
+			log.Printf("Error clearing stored plaintext passwords: %v", err)
+		} else {
+			log.Printf("Cleared stored passwords for %d users; token authentication is now disabled", n)
+		}
+	}
+
+	// Artist browsing is cached; regroup it right away when the grouping changes
+	if key == "use_album_artist" {
+		invalidateBrowseCache()
+	}
+
+	// Albums regroup right away instead of at the next scan
+	if key == "group_multi_disc_albums" {
+		go func() {
+			if n, err := applyMultiDiscGrouping(db); err != nil {
+				log.Printf("Error regrouping multi-disc albums: %v", err)
+			} else {
+				log.Printf("Regrouped %d songs after group_multi_disc_albums changed", n)
+			}
+		}()
+	}
+
+	// Sort names are stored in the library index, so it is rebuilt with the new articles
+	if key == "ignored_articles" {
+		go func() {
+			if err := RebuildLibraryIndex(db); err != nil {
+				log.Printf("Error rebuilding library index after ignored_articles changed: %v", err)
+			}
+			invalidateBrowseCache()
+		}()
+	}
+
+	// Turning off jukebox mode silences the host right away
+	if key == "enable_jukebox" && value != "true" {
+		stopJukebox()
+	}
+
+	// The watcher reads the library layout and scan options when it starts
+	if key == "watch_library" || key == "scan_ignore_globs" || key == "follow_symlinks" {
+		ReloadLibraryWatcher()
+	}
+
+	// Reload the scheduler if any schedule-related config changed
+	if strings.HasSuffix(key, "_schedule") || strings.HasSuffix(key, "_enabled") || key == "play_history_retention_days" {
+		log.Println("Scheduler configuration changed, reloading scheduler...")
+		if err := ReloadScheduler(); err != nil {
+			log.Printf("Error reloading scheduler: %v", err)
+			subsonicRespond(c, newSubsonicErrorResponse(0, "Configuration saved, but the scheduler could not be reloaded."))
+			return
 		}
-		startScheduler()
 	}
 
 	subsonicGetConfiguration(c)
@@ -261,7 +409,7 @@ func subsonicGetUsers(c *gin.Context) {
 		subsonicRespond(c, newSubsonicErrorResponse(40, "Admin rights required."))
 		return
 	}
-	rows, err := db.Query("SELECT username, is_admin FROM users ORDER BY username")
+	rows, err := db.Query("SELECT username, is_admin, download_role, playlist_role, settings_role, scan_role, jukebox_role FROM users ORDER BY username")
 	if err != nil {
 		subsonicRespond(c, newSubsonicErrorResponse(0, "DB error fetching users."))
 		return
@@ -269,12 +417,16 @@ func subsonicGetUsers(c *gin.Context) {
 	defer rows.Close()
 	var users []SubsonicUser
 	for rows.Next() {
-		var u User
-		if err := rows.Scan(&u.Username, &u.IsAdmin); err != nil {
+		var u SubsonicUser
+		if err := rows.Scan(&u.Username, &u.AdminRole, &u.DownloadRole, &u.PlaylistRole, &u.SettingsRole, &u.ScanRole, &u.JukeboxRole); err != nil {
 			log.Printf("Error scanning user row: %v", err)
 			continue
 		}
-		users = append(users, SubsonicUser{Username: u.Username, AdminRole: u.IsAdmin, SettingsRole: u.IsAdmin})
+		if u.AdminRole {
+			// Admins implicitly hold every role.
+			u.DownloadRole, u.PlaylistRole, u.SettingsRole, u.ScanRole, u.JukeboxRole = true, true, true, true, true
+		}
+		users = append(users, u)
 	}
 	subsonicRespond(c, newSubsonicResponse(&SubsonicUsers{Users: users}))
 }
@@ -288,6 +440,16 @@ func subsonicCreateUser(c *gin.Context) {
 	username := c.Query("username")
 	password := c.Query("password")
 	isAdmin, _ := strconv.ParseBool(c.Query("adminRole"))
+	roles, badParam := roleParams(c.Query)
+	if badParam != "" {
+		subsonicRespond(c, newSubsonicErrorResponse(10, "Invalid value for "+badParam+"."))
+		return
+	}
+	for _, r := range userRoleColumns {
+		if _, ok := roles[r.column]; !ok {
+			roles[r.column] = r.initial
+		}
+	}
 
 	if password == "" || username == "" {
 		subsonicRespond(c, newSubsonicErrorResponse(10, "Username and password are required."))
@@ -298,7 +460,14 @@ func subsonicCreateUser(c *gin.Context) {
 		subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to hash password."))
 		return
 	}
-	_, err = db.Exec("INSERT INTO users (username, password_hash, password_plain, is_admin) VALUES (?, ?, ?, ?)", username, hashedPassword, password, isAdmin)
+	storedPlain, err := storedPlainPassword(password)
+	if err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to encrypt password."))
+		return
+	}
+	_, err = db.Exec(`INSERT INTO users (username, password_hash, password_plain, is_admin, download_role, playlist_role, settings_role, scan_role, jukebox_role)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, username, hashedPassword, storedPlain, isAdmin,
+		roles[roleDownload], roles[rolePlaylist], roles[roleSettings], roles[roleScan], roles[roleJukebox])
 	if err != nil {
 		subsonicRespond(c, newSubsonicErrorResponse(0, "Could not create user."))
 		return
@@ -318,6 +487,11 @@ func subsonicUpdateUser(c *gin.Context) {
 		subsonicRespond(c, newSubsonicErrorResponse(10, "Username is required."))
 		return
 	}
+	roles, badParam := roleParams(c.Query)
+	if badParam != "" {
+		subsonicRespond(c, newSubsonicErrorResponse(10, "Invalid value for "+badParam+"."))
+		return
+	}
 
 	if password != "" {
 		hashedPassword, err := hashPassword(password)
@@ -325,13 +499,28 @@ func subsonicUpdateUser(c *gin.Context) {
 			subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to hash password."))
 			return
 		}
-		_, err = db.Exec("UPDATE users SET password_hash = ?, password_plain = ? WHERE username = ?", hashedPassword, password, username)
+		storedPlain, err := storedPlainPassword(password)
+		if err != nil {
+			subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to encrypt password."))
+			return
+		}
+		_, err = db.Exec("UPDATE users SET password_hash = ?, password_plain = ? WHERE username = ?", hashedPassword, storedPlain, username)
 		if err != nil {
 			subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to update password."))
 			return
 		}
 		invalidateAuthCache()
 	}
+	for _, r := range userRoleColumns {
+		granted, ok := roles[r.column]
+		if !ok {
+			continue
+		}
+		if _, err := db.Exec("UPDATE users SET "+r.column+" = ? WHERE username = ?", granted, username); err != nil {
+			subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to update user roles."))
+			return
+		}
+	}
 	subsonicRespond(c, newSubsonicResponse(nil))
 }
 
@@ -379,7 +568,12 @@ func subsonicChangePassword(c *gin.Context) {
 		subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to hash password."))
 		return
 	}
-	_, err = db.Exec("UPDATE users SET password_hash = ?, password_plain = ? WHERE id = ?", hashedPassword, newPassword, user.(User).ID)
+	storedPlain, err := storedPlainPassword(newPassword)
+	if err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to encrypt password."))
+		return
+	}
+	_, err = db.Exec("UPDATE users SET password_hash = ?, password_plain = ? WHERE id = ?", hashedPassword, storedPlain, user.(User).ID)
 	if err != nil {
 		subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to update password."))
 		return
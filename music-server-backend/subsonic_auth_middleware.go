@@ -7,7 +7,9 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"log"
+	"math/big"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -57,7 +59,8 @@ func SubsonicAuthMiddleware() gin.HandlerFunc {
 			var user User
 			err := db.QueryRow("SELECT id, username, is_admin FROM users WHERE api_key = ?", apiKey).Scan(&user.ID, &user.Username, &user.IsAdmin)
 			if err != nil {
-				subsonicRespond(c, newSubsonicErrorResponse(40, "Invalid API key."))
+				// OpenSubsonic reserves error 44 for an unknown/revoked API key.
+				subsonicRespond(c, newSubsonicErrorResponse(44, "Invalid API key."))
 				c.Abort()
 				return
 			}
@@ -90,6 +93,13 @@ func SubsonicAuthMiddleware() gin.HandlerFunc {
 
 		// 3. Legacy Subsonic Authentication (User/Pass & Token/Salt)
 		if username != "" {
+			if _, blocked := loginBlocked(c.ClientIP(), username); blocked {
+				log.Printf("WARN: Subsonic login for '%s' from %s refused: too many failed attempts", username, c.ClientIP())
+				time.Sleep(loginFailureDelay)
+				subsonicRespond(c, newSubsonicErrorResponse(40, "Too many failed login attempts. Try again later."))
+				c.Abort()
+				return
+			}
 			// Plaintext or hex-encoded password check
 			if password != "" {
 				// Fast path: a recently-verified credential skips the expensive
@@ -120,6 +130,7 @@ func SubsonicAuthMiddleware() gin.HandlerFunc {
 							if storedApiKey.Valid && storedApiKey.String != "" && decodedString == storedApiKey.String {
 								log.Printf("DEBUG: Successfully authenticated user '%s' via API key in hex-encoded password", storedUser.Username)
 								authCacheStore(username, password, storedUser)
+								recordLoginSuccess(c.ClientIP(), username)
 								c.Set("user", storedUser)
 								c.Next()
 								return
@@ -129,6 +140,7 @@ func SubsonicAuthMiddleware() gin.HandlerFunc {
 							if checkPasswordHash(decodedString, passwordHash) {
 								log.Printf("DEBUG: Successfully authenticated user '%s' via hex-encoded password", storedUser.Username)
 								authCacheStore(username, password, storedUser)
+								recordLoginSuccess(c.ClientIP(), username)
 								c.Set("user", storedUser)
 								c.Next()
 								return
@@ -141,6 +153,7 @@ func SubsonicAuthMiddleware() gin.HandlerFunc {
 					} else if checkPasswordHash(password, passwordHash) { // Plaintext password check
 						log.Printf("DEBUG: Successfully authenticated user '%s' via plaintext password", storedUser.Username)
 						authCacheStore(username, password, storedUser)
+						recordLoginSuccess(c.ClientIP(), username)
 						c.Set("user", storedUser)
 						c.Next()
 						return
@@ -154,15 +167,25 @@ func SubsonicAuthMiddleware() gin.HandlerFunc {
 
 			// Token/Salt check
 			if token != "" && salt != "" {
+				if plaintextPasswordsDisabled() {
+					subsonicRespond(c, newSubsonicErrorResponse(42, "Token authentication is disabled on this server; use an API key or password."))
+					c.Abort()
+					return
+				}
 				var storedUser User
 				var passwordPlain sql.NullString
 				row := db.QueryRow("SELECT id, username, COALESCE(password_plain, ''), is_admin FROM users WHERE username = ?", username)
 				if err := row.Scan(&storedUser.ID, &storedUser.Username, &passwordPlain, &storedUser.IsAdmin); err == nil && passwordPlain.Valid && passwordPlain.String != "" {
+					plain, decErr := decryptPassword(passwordPlain.String)
+					if decErr != nil {
+						log.Printf("ERROR: Could not decrypt stored password for user '%s': %v", storedUser.Username, decErr)
+					}
 					hasher := md5.New()
-					hasher.Write([]byte(passwordPlain.String + salt))
+					hasher.Write([]byte(plain + salt))
 					expectedToken := hex.EncodeToString(hasher.Sum(nil))
-					if token == expectedToken {
+					if decErr == nil && token == expectedToken {
 						log.Printf("DEBUG: Successfully authenticated user '%s' via token/salt", storedUser.Username)
+						recordLoginSuccess(c.ClientIP(), username)
 						c.Set("user", storedUser)
 						c.Next()
 						return
@@ -184,16 +207,19 @@ func SubsonicAuthMiddleware() gin.HandlerFunc {
 		// If no valid authentication was found
 		log.Printf("DEBUG: Authentication failed for username='%s', password provided=%t, token provided=%t, salt provided=%t",
 			username, password != "", token != "", salt != "")
+		if username != "" && (password != "" || token != "") {
+			recordLoginFailure(c.ClientIP(), username)
+		}
 		subsonicRespond(c, newSubsonicErrorResponse(40, "Authentication failed. Please provide valid credentials."))
 		c.Abort()
 	}
 }
 
-// generateSecureApiKey creates a cryptographically secure random hex string.
+// generateSecureApiKey creates a cryptographically secure random base62 string.
 func generateSecureApiKey() (string, error) {
-	bytes := make([]byte, 24) // 24 bytes = 48 hex characters
+	bytes := make([]byte, 32) // 256 bits of entropy, ~43 base62 characters
 	if _, err := rand.Read(bytes); err != nil {
 		return "", err
 	}
-	return hex.EncodeToString(bytes), nil
+	return toBase62(new(big.Int).SetBytes(bytes)), nil
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/xml"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- getBookmarks / createBookmark / deleteBookmark -------------------------
+
+// Bookmarks let clients resume long tracks (audiobooks, DJ sets) where the user
+// left off. They are managed explicitly by clients; streaming never touches
+// them. Each user has at most one bookmark per song.
+
+// SubsonicBookmarks is the getBookmarks response.
+type SubsonicBookmarks struct {
+	XMLName   xml.Name           `xml:"bookmarks" json:"-"`
+	Bookmarks []SubsonicBookmark `xml:"bookmark" json:"bookmark"`
+}
+
+// SubsonicBookmark is a saved position (in milliseconds) within a song.
+type SubsonicBookmark struct {
+	XMLName  xml.Name     `xml:"bookmark" json:"-"`
+	Position int64        `xml:"position,attr" json:"position"`
+	Username string       `xml:"username,attr" json:"username"`
+	Comment  string       `xml:"comment,attr,omitempty" json:"comment,omitempty"`
+	Created  string       `xml:"created,attr" json:"created"`
+	Changed  string       `xml:"changed,attr" json:"changed"`
+	Entry    SubsonicSong `xml:"entry" json:"entry"`
+}
+
+func subsonicGetBookmarks(c *gin.Context) {
+	user := c.MustGet("user").(User)
+
+	rows, err := db.Query(`SELECT song_id, position_ms, COALESCE(comment, ''), created, changed
+		FROM bookmarks WHERE user_id = ? ORDER BY changed DESC`, user.ID)
+	if err != nil {
+		log.Printf("Error querying bookmarks for user %d: %v", user.ID, err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error fetching bookmarks."))
+		return
+	}
+	type bookmarkRow struct {
+		songID           string
+		position         int64
+		comment          string
+		created, changed string
+	}
+	var found []bookmarkRow
+	for rows.Next() {
+		var b bookmarkRow
+		if err := rows.Scan(&b.songID, &b.position, &b.comment, &b.created, &b.changed); err != nil {
+			log.Printf("Error scanning bookmark row: %v", err)
+			continue
+		}
+		found = append(found, b)
+	}
+	rows.Close()
+
+	bookmarks := []SubsonicBookmark{}
+	for _, b := range found {
+		song, err := QuerySongByID(db, b.songID)
+		if err != nil {
+			// The song was removed or cancelled since it was bookmarked.
+			continue
+		}
+		bookmarks = append(bookmarks, SubsonicBookmark{
+			Position: b.position,
+			Username: user.Username,
+			Comment:  b.comment,
+			Created:  b.created,
+			Changed:  b.changed,
+			Entry:    buildSubsonicSong(*song),
+		})
+	}
+	subsonicRespond(c, newSubsonicResponse(&SubsonicBookmarks{Bookmarks: bookmarks}))
+}
+
+func subsonicCreateBookmark(c *gin.Context) {
+	user := c.MustGet("user").(User)
+
+	songID := c.Query("id")
+	positionStr := c.Query("position")
+	if songID == "" || positionStr == "" {
+		subsonicRespond(c, newSubsonicErrorResponse(10, "Required parameters id and position are missing."))
+		return
+	}
+	position, err := strconv.ParseInt(positionStr, 10, 64)
+	if err != nil || position < 0 {
+		subsonicRespond(c, newSubsonicErrorResponse(10, "Invalid position."))
+		return
+	}
+	if exists, err := SongExists(db, songID); err != nil || !exists {
+		subsonicRespond(c, newSubsonicErrorResponse(70, "Song not found."))
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err = db.Exec(`INSERT INTO bookmarks (user_id, song_id, position_ms, comment, created, changed)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, song_id) DO UPDATE SET position_ms = excluded.position_ms, comment = excluded.comment, changed = excluded.changed`,
+		user.ID, songID, position, c.Query("comment"), now, now)
+	if err != nil {
+		log.Printf("Error saving bookmark for user %d song %s: %v", user.ID, songID, err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to save bookmark."))
+		return
+	}
+	subsonicRespond(c, newSubsonicResponse(nil))
+}
+
+func subsonicDeleteBookmark(c *gin.Context) {
+	user := c.MustGet("user").(User)
+
+	songID := c.Query("id")
+	if songID == "" {
+		subsonicRespond(c, newSubsonicErrorResponse(10, "Required parameter id is missing."))
+		return
+	}
+	res, err := db.Exec(`DELETE FROM bookmarks WHERE user_id = ? AND song_id = ?`, user.ID, songID)
+	if err != nil {
+		log.Printf("Error deleting bookmark for user %d song %s: %v", user.ID, songID, err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to delete bookmark."))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		subsonicRespond(c, newSubsonicErrorResponse(70, "Bookmark not found."))
+		return
+	}
+	subsonicRespond(c, newSubsonicResponse(nil))
+}
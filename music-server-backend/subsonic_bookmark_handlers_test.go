@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestBookmarksLifecycle(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+	stmts := []string{
+		`CREATE TABLE bookmarks (user_id INTEGER NOT NULL, song_id TEXT NOT NULL, position_ms INTEGER NOT NULL DEFAULT 0,
+			comment TEXT DEFAULT '', created TEXT NOT NULL, changed TEXT NOT NULL, PRIMARY KEY (user_id, song_id))`,
+		`INSERT INTO songs (id, title, artist, album, album_path, path, duration, play_count, cancelled) VALUES ('s1', 'Chapter 1', 'Narrator', 'Book', '/m/Book', '/m/Book/1.mp3', 3600, 0, 0)`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+
+	bookmarksOf := func() []interface{} {
+		resp := callHandler(t, subsonicGetBookmarks, "")
+		b, _ := resp["bookmarks"].(map[string]interface{})
+		if b == nil {
+			t.Fatalf("getBookmarks missing bookmarks element: %v", resp)
+		}
+		list, _ := b["bookmark"].([]interface{})
+		return list
+	}
+	if len(bookmarksOf()) != 0 {
+		t.Fatal("expected no bookmarks initially")
+	}
+
+	callHandler(t, subsonicCreateBookmark, "id=s1&position=1000&comment=start")
+	callHandler(t, subsonicCreateBookmark, "id=s1&position=125000")
+	list := bookmarksOf()
+	if len(list) != 1 {
+		t.Fatalf("createBookmark should upsert a single bookmark, got %v", list)
+	}
+	b := list[0].(map[string]interface{})
+	entry, _ := b["entry"].(map[string]interface{})
+	if b["position"] != float64(125000) || b["username"] != "test" || entry["id"] != "s1" {
+		t.Fatalf("unexpected bookmark %v", b)
+	}
+
+	callHandler(t, subsonicDeleteBookmark, "id=s1")
+	if len(bookmarksOf()) != 0 {
+		t.Fatal("deleteBookmark should remove the bookmark")
+	}
+}
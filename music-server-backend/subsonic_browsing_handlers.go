@@ -4,10 +4,8 @@ package main
 import (
 	"database/sql"
 	"log"
-	"path/filepath"
 	"strings"
 	"time"
-	"unicode"
 
 	"github.com/gin-gonic/gin"
 )
@@ -35,6 +33,16 @@ func subsonicGetMusicFolders(c *gin.Context) {
 func subsonicGetIndexes(c *gin.Context) {
 	_ = c.MustGet("user") // Auth is handled by middleware
 
+	body, err := cachedBrowse(browseCacheIndexes, func() (interface{}, error) { return loadIndexes() })
+	if err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error querying artists."))
+		return
+	}
+	subsonicRespond(c, newSubsonicResponse(body.(*SubsonicIndexes)))
+}
+
+// loadIndexes builds the getIndexes body from the derived artists table.
+func loadIndexes() (*SubsonicIndexes, error) {
 	// Get last scan time for the lastModified attribute
 	var lastScanStr sql.NullString
 	err := db.QueryRow("SELECT last_scan_ended FROM library_paths ORDER BY last_scan_ended DESC LIMIT 1").Scan(&lastScanStr)
@@ -46,24 +54,17 @@ func subsonicGetIndexes(c *gin.Context) {
 		}
 	}
 
-	// Read artists from the derived artists table (album counts precomputed).
-	rows, err := db.Query(`SELECT id, name, album_count FROM artists ORDER BY name COLLATE NOCASE`)
+	results, err := browseArtists()
 	if err != nil {
 		log.Printf("Error querying artists for getIndexes: %v", err)
-		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error querying artists."))
-		return
+		return nil, err
 	}
-	defer rows.Close()
 
 	// Build artist index map
 	artistIndex := make(map[string][]SubsonicIndexArtist)
 	seenArtists := make(map[string]bool)
-	for rows.Next() {
-		var artist SubsonicIndexArtist
-		if err := rows.Scan(&artist.ID, &artist.Name, &artist.AlbumCount); err != nil {
-			log.Printf("Error scanning artist for getIndexes: %v", err)
-			continue
-		}
+	for _, result := range results {
+		artist := SubsonicIndexArtist{ID: GenerateArtistID(result.Name), Name: result.Name, AlbumCount: result.AlbumCount}
 		// Deduplicate artists by normalized name
 		key := normalizeKey(artist.Name)
 		if seenArtists[key] {
@@ -73,18 +74,8 @@ func subsonicGetIndexes(c *gin.Context) {
 
 		artist.CoverArt = artist.ID // Set cover art ID for artist images
 
-		// Determine index character
-		var indexChar string
-		for _, r := range artist.Name {
-			if unicode.IsLetter(r) || unicode.IsNumber(r) {
-				indexChar = strings.ToUpper(string(r))
-				break
-			}
-		}
-		if indexChar == "" {
-			indexChar = "#"
-		}
-
+		// Filed under the first letter of the sort name, past any ignored article
+		indexChar := indexLetter(result.SortName)
 		artistIndex[indexChar] = append(artistIndex[indexChar], artist)
 	}
 
@@ -100,12 +91,11 @@ func subsonicGetIndexes(c *gin.Context) {
 	// Sort indices
 	sortIndices(indices)
 
-	response := newSubsonicResponse(&SubsonicIndexes{
+	return &SubsonicIndexes{
 		LastModified:    lastModified,
-		IgnoredArticles: "The El La Los Las Le Les",
+		IgnoredArticles: ignoredArticlesSetting(db),
 		Indices:         indices,
-	})
-	subsonicRespond(c, response)
+	}, nil
 }
 
 // subsonicGetMusicDirectory returns the contents of a music directory
@@ -121,12 +111,9 @@ func subsonicGetMusicDirectory(c *gin.Context) {
 
 	log.Printf("getMusicDirectory called with ID: %s", id)
 
-	// Check if ID exists as a song ID (representing an album)
-	var albumName, artistName string
-	err := db.QueryRow("SELECT album, artist FROM songs WHERE id = ? AND cancelled = 0", id).Scan(&albumName, &artistName)
-	if err == nil {
-		// Found song - return songs in this album
-		getAlbumDirectory(c, user, id, albumName, artistName)
+	// An album id (or a song id of the album) lists the album's songs
+	if album, err := resolveAlbumRef(db, id); err == nil {
+		getAlbumDirectory(c, user, album)
 		return
 	}
 
@@ -134,7 +121,7 @@ func subsonicGetMusicDirectory(c *gin.Context) {
 	if actualArtistName, ok := resolveArtistIDToName(db, id); ok {
 		getArtistDirectory(c, actualArtistName)
 	} else {
-		// ID doesn't match any song or artist
+		// ID doesn't match any album, song or artist
 		subsonicRespond(c, newSubsonicErrorResponse(70, "Item not found."))
 	}
 }
@@ -158,7 +145,7 @@ func getArtistDirectory(c *gin.Context, artistName string) {
 			FROM songs
 			WHERE (artist = ? OR album_artist = ?) AND album != '' AND cancelled = 0
 		)
-		ORDER BY a.name COLLATE NOCASE
+		ORDER BY a.sort_name, a.name COLLATE NOCASE
 	`
 
 	rows, err := db.Query(query, artistName, artistName)
@@ -201,20 +188,8 @@ func getArtistDirectory(c *gin.Context, artistName string) {
 }
 
 // getAlbumDirectory returns all songs in an album
-func getAlbumDirectory(c *gin.Context, user User, albumID string, albumName, artistName string) {
-	// Get the album's directory path from the albumID song
-	var albumPath, albumDir string
-	err := db.QueryRow("SELECT path, COALESCE(album_path, '') FROM songs WHERE id = ? AND cancelled = 0", albumID).Scan(&albumPath, &albumDir)
-	if err != nil {
-		log.Printf("Error getting album path for ID %s: %v", albumID, err)
-		subsonicRespond(c, newSubsonicErrorResponse(70, "Album not found."))
-		return
-	}
-
-	// Legacy rows without album_path fall back to the song's directory.
-	if albumDir == "" {
-		albumDir = filepath.Dir(albumPath)
-	}
+func getAlbumDirectory(c *gin.Context, user User, album albumRef) {
+	albumID, albumName, albumDir := album.ID, album.Name, album.Path
 	// Display album artist (precomputed in the derived albums table)
 	displayArtist := albumDisplayArtist(db, albumName, albumDir)
 
@@ -239,7 +214,7 @@ func getAlbumDirectory(c *gin.Context, user User, albumID string, albumName, art
 	}
 	defer rows.Close()
 
-	var children []SubsonicDirectoryChild
+	var songs []SubsonicSong
 	for rows.Next() {
 		var r SongResult
 		var lastPlayed, genreVal, albumArtist, created sql.NullString
@@ -268,7 +243,13 @@ func getAlbumDirectory(c *gin.Context, user User, albumID string, albumName, art
 		r.AlbumID = albumID
 		r.ReplayGain = newReplayGain(rgTrackGain, rgTrackPeak, rgAlbumGain, rgAlbumPeak)
 
-		child := directoryChildFromSong(buildSubsonicSong(r))
+		songs = append(songs, buildSubsonicSong(r))
+	}
+	applySongRatings(user.ID, songs)
+
+	var children []SubsonicDirectoryChild
+	for _, s := range songs {
+		child := directoryChildFromSong(s)
 		child.CoverArt = albumID // Songs share the album cover
 		children = append(children, child)
 	}
@@ -308,15 +289,15 @@ func subsonicGetArtist(c *gin.Context) {
 	// Get albums by this artist
 	// Match on BOTH artist and album_artist fields to show all albums where this artist appears in ANY song
 	query := `
-		SELECT album, MIN(id) as album_id, COUNT(*) as song_count, COALESCE(genre, '') as genre, MIN(album_path) as album_path, COALESCE(SUM(duration), 0) as total_duration, MIN(date_added) as created
+		SELECT album, COUNT(*) as song_count, COALESCE(genre, '') as genre, MIN(album_path) as album_path, COALESCE(SUM(duration), 0) as total_duration, MIN(date_added) as created
 		FROM songs
 		WHERE (artist = ? OR album_artist = ?) AND cancelled = 0
 		GROUP BY CASE
 			WHEN album_path IS NOT NULL AND album_path != '' THEN album_path || '|||' || album
 			ELSE album
 		END
-		ORDER BY album COLLATE NOCASE
-	`
+		ORDER BY ` + albumSortNameSQL("songs") + `, album COLLATE NOCASE`
+	articles := ignoredArticles(db)
 
 	rows, err := db.Query(query, artistName, artistName)
 	if err != nil {
@@ -329,16 +310,16 @@ func subsonicGetArtist(c *gin.Context) {
 	var albums []SubsonicAlbum
 	for rows.Next() {
 		var albumName string
-		var albumID string
 		var songCount, totalDuration int
 		var genre string
 		var albumPath string
 		var created sql.NullString
 
-		if err := rows.Scan(&albumName, &albumID, &songCount, &genre, &albumPath, &totalDuration, &created); err != nil {
+		if err := rows.Scan(&albumName, &songCount, &genre, &albumPath, &totalDuration, &created); err != nil {
 			log.Printf("Error scanning album: %v", err)
 			continue
 		}
+		albumID := AlbumID(albumName, albumPath)
 
 		// Display artist for this album (precomputed in the derived albums table)
 		displayArtist := albumDisplayArtist(db, albumName, strings.TrimSpace(albumPath))
@@ -353,6 +334,7 @@ func subsonicGetArtist(c *gin.Context) {
 			SongCount: songCount,
 			Duration:  totalDuration,
 			Created:   created.String,
+			SortName:  sortName(albumName, articles),
 		}
 		decorateAlbum(&album)
 		albums = append(albums, album)
@@ -363,6 +345,7 @@ func subsonicGetArtist(c *gin.Context) {
 		Name:       artistName,
 		CoverArt:   artistName,
 		AlbumCount: len(albums),
+		SortName:   sortName(artistName, articles),
 		Albums:     albums,
 	}
 
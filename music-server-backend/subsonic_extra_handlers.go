@@ -87,24 +87,6 @@ func subsonicGetNowPlaying(c *gin.Context) {
 	subsonicRespond(c, newSubsonicResponse(&SubsonicNowPlaying{Entries: []SubsonicNowPlayingEntry{}}))
 }
 
-// --- getBookmarks -----------------------------------------------------------
-
-// SubsonicBookmarks is the getBookmarks response. Bookmarks are not stored, so
-// the list is empty (spec-valid).
-type SubsonicBookmarks struct {
-	XMLName   xml.Name           `xml:"bookmarks" json:"-"`
-	Bookmarks []SubsonicBookmark `xml:"bookmark" json:"bookmark"`
-}
-
-type SubsonicBookmark struct {
-	XMLName xml.Name `xml:"bookmark" json:"-"`
-}
-
-func subsonicGetBookmarks(c *gin.Context) {
-	_ = c.MustGet("user")
-	subsonicRespond(c, newSubsonicResponse(&SubsonicBookmarks{Bookmarks: []SubsonicBookmark{}}))
-}
-
 // --- getVideos --------------------------------------------------------------
 
 // SubsonicVideos is the getVideos response. Video media is not supported, so the
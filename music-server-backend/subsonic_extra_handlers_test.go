@@ -3,8 +3,10 @@ package main
 import (
 	"encoding/json"
 	"encoding/xml"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
 
@@ -69,9 +71,6 @@ func TestNewEndpointsReturnSpecShapedResponses(t *testing.T) {
 	if _, ok := callHandler(t, subsonicGetNowPlaying, "")["nowPlaying"]; !ok {
 		t.Errorf("getNowPlaying missing nowPlaying element")
 	}
-	if _, ok := callHandler(t, subsonicGetBookmarks, "")["bookmarks"]; !ok {
-		t.Errorf("getBookmarks missing bookmarks element")
-	}
 	if _, ok := callHandler(t, subsonicGetVideos, "")["videos"]; !ok {
 		t.Errorf("getVideos missing videos element")
 	}
@@ -83,6 +82,19 @@ func TestNewEndpointsReturnSpecShapedResponses(t *testing.T) {
 	}
 }
 
+func TestVideoFilesAreSkippedByScanner(t *testing.T) {
+	for _, p := range []string{"/m/a.MP3", "/m/b.flac", "/m/c.opus"} {
+		if !isSupportedAudioFile(p) {
+			t.Errorf("%s should be scanned", p)
+		}
+	}
+	for _, p := range []string{"/m/clip.mp4", "/m/movie.mkv", "/m/x.avi", "/m/cover.jpg"} {
+		if isSupportedAudioFile(p) {
+			t.Errorf("%s should be skipped", p)
+		}
+	}
+}
+
 func TestStarred2AndAlbumListElements(t *testing.T) {
 	db = setupFullTestDB(t)
 	defer db.Close()
@@ -101,3 +113,36 @@ func TestStarred2AndAlbumListElements(t *testing.T) {
 		t.Errorf("getAlbumList missing albumList element")
 	}
 }
+
+func TestGetStarredPagination(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+	for i, id := range []string{"s1", "s2", "s3"} {
+		db.Exec(`INSERT INTO songs (id, title, artist, album, path, play_count) VALUES (?, ?, 'A', 'X', ?, 0)`, id, id, "/m/"+id+".mp3")
+		db.Exec(`INSERT INTO starred_songs (user_id, song_id, starred_at) VALUES (1, ?, ?)`, id, fmt.Sprintf("2026-01-0%dT00:00:00Z", i+1))
+	}
+
+	songIDs := func(query string) []string {
+		starred := callHandler(t, subsonicGetStarred2, query)["starred2"].(map[string]interface{})
+		list, _ := starred["song"].([]interface{})
+		ids := []string{}
+		for _, s := range list {
+			ids = append(ids, s.(map[string]interface{})["id"].(string))
+		}
+		return ids
+	}
+
+	for query, want := range map[string][]string{
+		"":                       {"s3", "s2", "s1"},
+		"size=2":                 {"s3", "s2"},
+		"size=2&offset=2":        {"s1"},
+		"count=1&offset=1":       {"s2"},
+		"size=5&offset=10":       {},
+		"musicFolderId=1&size=1": {"s3"},
+		"musicFolderId=2":        {},
+	} {
+		if got := songIDs(query); !slices.Equal(got, want) {
+			t.Errorf("getStarred2?%s = %v, want %v", query, got, want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ package main
 import (
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,21 +12,63 @@ import (
 const subsonicVersion = "1.16.1"
 const subsonicAuthErrorMsg = "Wrong username or password."
 
+// OpenSubsonic requires type/serverVersion/openSubsonic on every response, not
+// just ping, so clients can detect the server from any call.
+const subsonicServerType = "AudioMuse-AI"
+const subsonicServerVersion = "0.1.0"
+
+// openSubsonicExtensions lists the OpenSubsonic extensions this server actually
+// implements. Clients gate features on it, so only add an entry once the
+// corresponding behaviour exists.
+var openSubsonicExtensions = []OpenSubsonicExtension{
+	{Name: "apiKeyAuthentication", Versions: []int{1}},
+	{Name: "formPost", Versions: []int{1}},
+	{Name: "transcodeOffset", Versions: []int{1}},
+}
+
 func newSubsonicResponse(body interface{}) SubsonicResponse {
 	return SubsonicResponse{
-		Status:  "ok",
-		Version: subsonicVersion,
-		Xmlns:   "http://subsonic.org/restapi",
-		Body:    body,
+		Status:        "ok",
+		Version:       subsonicVersion,
+		Xmlns:         "http://subsonic.org/restapi",
+		Type:          subsonicServerType,
+		ServerVersion: subsonicServerVersion,
+		OpenSubsonic:  true,
+		Body:          body,
 	}
 }
 
 func newSubsonicErrorResponse(code int, message string) SubsonicResponse {
 	return SubsonicResponse{
-		Status:  "failed",
-		Version: subsonicVersion,
-		Xmlns:   "http://subsonic.org/restapi",
-		Body:    &SubsonicError{Code: code, Message: message},
+		Status:        "failed",
+		Version:       subsonicVersion,
+		Xmlns:         "http://subsonic.org/restapi",
+		Type:          subsonicServerType,
+		ServerVersion: subsonicServerVersion,
+		OpenSubsonic:  true,
+		Body:          &SubsonicError{Code: code, Message: message},
+	}
+}
+
+// subsonicFormPostMiddleware implements the OpenSubsonic formPost extension:
+// parameters sent as an application/x-www-form-urlencoded POST body to /rest
+// endpoints are merged into the query string, so auth and handlers (which read
+// c.Query) see them exactly as if they had been sent with GET.
+func subsonicFormPostMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodPost && strings.HasPrefix(c.Request.URL.Path, "/rest/") &&
+			strings.HasPrefix(c.ContentType(), "application/x-www-form-urlencoded") {
+			if err := c.Request.ParseForm(); err == nil && len(c.Request.PostForm) > 0 {
+				query := c.Request.URL.Query()
+				for key, values := range c.Request.PostForm {
+					for _, v := range values {
+						query.Add(key, v)
+					}
+				}
+				c.Request.URL.RawQuery = query.Encode()
+			}
+		}
+		c.Next()
 	}
 }
 
@@ -95,6 +138,8 @@ func subsonicRespond(c *gin.Context, response SubsonicResponse) {
 			bodyMap["openSubsonicExtensions"] = body.Extensions // Directly embed the slice
 		case *ApiKeyResponse:
 			bodyMap["apiKey"] = body
+		case *SubsonicTokenInfo:
+			bodyMap["tokenInfo"] = body
 		case *SubsonicSongWrapper:
 			bodyMap["song"] = body.Song
 		case *SubsonicSearchResult2:
@@ -107,6 +152,8 @@ func subsonicRespond(c *gin.Context, response SubsonicResponse) {
 			bodyMap["starred2"] = body
 		case *SubsonicSimilarArtists:
 			bodyMap["similarArtists2"] = body
+		case *SubsonicSongs:
+			bodyMap["songs"] = body
 		case *SubsonicSongsByGenre:
 			bodyMap["songsByGenre"] = body
 		case *SubsonicGenres:
@@ -117,16 +164,28 @@ func subsonicRespond(c *gin.Context, response SubsonicResponse) {
 			bodyMap["artistInfo"] = body
 		case *SubsonicArtistInfo2:
 			bodyMap["artistInfo2"] = body
+		case *SubsonicAlbumInfo:
+			bodyMap["albumInfo"] = body
 		case *SubsonicNowPlaying:
 			bodyMap["nowPlaying"] = body
 		case *SubsonicBookmarks:
 			bodyMap["bookmarks"] = body
+		case *SubsonicPlayQueue:
+			bodyMap["playQueue"] = body
 		case *SubsonicVideos:
 			bodyMap["videos"] = body
 		case *SubsonicRandomSongs:
 			bodyMap["randomSongs"] = body
 		case *SubsonicPlaylistWithSongs:
 			bodyMap["playlist"] = body
+		case *SubsonicShares:
+			bodyMap["shares"] = body
+		case *SubsonicInternetRadioStations:
+			bodyMap["internetRadioStations"] = body
+		case *SubsonicJukeboxStatus:
+			bodyMap["jukeboxStatus"] = body
+		case *SubsonicJukeboxPlaylist:
+			bodyMap["jukeboxPlaylist"] = body
 		case nil:
 			// No body
 		default:
@@ -3,19 +3,25 @@ package main
 
 import (
 	"archive/zip"
+	"database/sql"
 	"fmt"
 	"io"
 	"log"
+	"mime"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/dhowden/tag"
 	"github.com/gin-gonic/gin"
 )
 
 // subsonicGetTopSongs returns the most played songs for an artist
 func subsonicGetTopSongs(c *gin.Context) {
-	_ = c.MustGet("user") // Auth is handled by middleware
+	user := c.MustGet("user").(User)
 
 	artistName := c.Query("artist")
 	if artistName == "" {
@@ -51,6 +57,7 @@ func subsonicGetTopSongs(c *gin.Context) {
 	if songs == nil {
 		songs = []SubsonicSong{}
 	}
+	applySongRatings(user.ID, songs)
 
 	response := newSubsonicResponse(&SubsonicTopSongs{Songs: songs})
 	subsonicRespond(c, response)
@@ -58,7 +65,7 @@ func subsonicGetTopSongs(c *gin.Context) {
 
 // subsonicGetSimilarSongs2 returns songs similar to a given song (based on artist and genre)
 func subsonicGetSimilarSongs2(c *gin.Context) {
-	_ = c.MustGet("user") // Auth is handled by middleware
+	user := c.MustGet("user").(User)
 
 	songID := c.Query("id")
 	if songID == "" {
@@ -89,14 +96,20 @@ func subsonicGetSimilarSongs2(c *gin.Context) {
 	if songs == nil {
 		songs = []SubsonicSong{}
 	}
+	applySongRatings(user.ID, songs)
 
 	response := newSubsonicResponse(&SubsonicSimilarSongs{Songs: songs})
 	subsonicRespond(c, response)
 }
 
-// subsonicDownload downloads a song or creates a zip archive of an album
+// subsonicDownload serves the original, never transcoded, bytes of a song, and
+// a zip of the member songs for an album or artist id.
 func subsonicDownload(c *gin.Context) {
-	_ = c.MustGet("user") // Auth is handled by middleware
+	user := c.MustGet("user").(User)
+	if !userHasRole(user, roleDownload) {
+		subsonicRespond(c, newSubsonicErrorResponse(50, "User is not authorized to download files."))
+		return
+	}
 
 	id := c.Query("id")
 	if id == "" {
@@ -106,32 +119,58 @@ func subsonicDownload(c *gin.Context) {
 
 	log.Printf("download called for ID: %s", id)
 
-	// Check if this is a single song or an album reference
-	albumName, artistName, _, path, err := QueryAlbumDetails(db, id)
-	if err != nil {
-		log.Printf("Song not found for download: %v", err)
-		subsonicRespond(c, newSubsonicErrorResponse(70, "Song not found."))
+	if isAlbumID(id) {
+		album, err := resolveAlbumRef(db, id)
+		if err != nil {
+			subsonicRespond(c, newSubsonicErrorResponse(70, "Album not found."))
+			return
+		}
+		songs, err := querySongsForZip(`album = ? AND album_path = ?`, album.Name, album.Path)
+		if err != nil || len(songs) == 0 {
+			subsonicRespond(c, newSubsonicErrorResponse(70, "No songs found for album."))
+			return
+		}
+		streamAlbumZip(c, album, songs)
 		return
 	}
 
-	// Check if request wants the whole album by checking for multiple songs
-	albumSongCount, err := QueryAlbumSongCount(db, albumName, artistName)
-	if err != nil || albumSongCount <= 1 {
-		// Single song download
+	var path string
+	err := db.QueryRow("SELECT path FROM songs WHERE id = ? AND cancelled = 0", id).Scan(&path)
+	if err == nil {
 		downloadSingleFile(c, path)
 		return
 	}
+	if err != sql.ErrNoRows {
+		log.Printf("Error looking up song for download: %v", err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error."))
+		return
+	}
 
-	// Multiple songs - create zip archive of the album
-	downloadAlbumAsZip(c, albumName, artistName)
+	if artistName, found := resolveArtistIDToName(db, id); found {
+		songs, err := querySongsForZip(`(artist = ? OR album_artist = ?)`, artistName, artistName)
+		if err != nil || len(songs) == 0 {
+			subsonicRespond(c, newSubsonicErrorResponse(70, "No songs found for artist."))
+			return
+		}
+		streamSongsAsZip(c, artistName+".zip", songs, zipLayout{perAlbum: true})
+		return
+	}
+	subsonicRespond(c, newSubsonicErrorResponse(70, "Song not found."))
+}
+
+// attachmentDisposition builds a Content-Disposition header value, using the
+// RFC 2231 encoding when the filename is not plain ASCII.
+func attachmentDisposition(filename string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": filename})
 }
 
-// downloadSingleFile serves a single file for download
+// downloadSingleFile serves a file unmodified as an attachment. Range requests
+// are honoured so interrupted downloads can resume.
 func downloadSingleFile(c *gin.Context, filePath string) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		log.Printf("Error opening file for download: %v", err)
-		c.Status(500)
+		c.Status(http.StatusNotFound)
 		return
 	}
 	defer file.Close()
@@ -139,100 +178,208 @@ func downloadSingleFile(c *gin.Context, filePath string) {
 	fileInfo, err := file.Stat()
 	if err != nil {
 		log.Printf("Error getting file info: %v", err)
-		c.Status(500)
+		c.Status(http.StatusInternalServerError)
 		return
 	}
 
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(filePath)))
-	c.Header("Content-Type", "application/octet-stream")
-	c.Header("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
+	contentType := mime.TypeByExtension(strings.ToLower(filepath.Ext(filePath)))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Disposition", attachmentDisposition(filepath.Base(filePath)))
+	c.Header("Content-Type", contentType)
+	c.Header("ETag", fileETag(fileInfo))
+	http.ServeContent(c.Writer, c.Request, filepath.Base(filePath), fileInfo.ModTime(), file)
+}
 
-	io.Copy(c.Writer, file)
+// zipSong is a song selected for a zip download.
+type zipSong struct {
+	ID    string
+	Title string
+	Album string
+	Path  string
+	Disc  int
+	Track int
 }
 
-// downloadAlbumAsZip creates a zip archive of all songs in an album
-func downloadAlbumAsZip(c *gin.Context, albumName, artistName string) {
-	// Query all songs in the album
-	query := `
-		SELECT id, title, path
+// querySongsForZip returns the non-cancelled songs matching where, ordered as
+// they appear on their albums.
+func querySongsForZip(where string, args ...interface{}) ([]zipSong, error) {
+	rows, err := db.Query(`
+		SELECT id, title, album, path, COALESCE(disc_number, 0), COALESCE(track, 0)
 		FROM songs
-		WHERE album = ? AND artist = ?
-		ORDER BY title COLLATE NOCASE
-	`
-
-	rows, err := db.Query(query, albumName, artistName)
+		WHERE `+where+` AND cancelled = 0
+		ORDER BY album COLLATE NOCASE, COALESCE(album_path, ''), COALESCE(disc_number, 0), COALESCE(track, 0), title COLLATE NOCASE`, args...)
 	if err != nil {
-		log.Printf("Error querying songs for album zip: %v", err)
-		c.Status(500)
-		return
+		log.Printf("Error querying songs for zip: %v", err)
+		return nil, err
 	}
 	defer rows.Close()
 
-	// Collect song paths
-	var songs []struct {
-		ID    int
-		Title string
-		Path  string
-	}
-
+	var songs []zipSong
 	for rows.Next() {
-		var song struct {
-			ID    int
-			Title string
-			Path  string
-		}
-		if err := rows.Scan(&song.ID, &song.Title, &song.Path); err != nil {
+		var s zipSong
+		if err := rows.Scan(&s.ID, &s.Title, &s.Album, &s.Path, &s.Disc, &s.Track); err != nil {
 			log.Printf("Error scanning song for zip: %v", err)
 			continue
 		}
-		songs = append(songs, song)
+		songs = append(songs, s)
 	}
+	return songs, rows.Err()
+}
 
-	if len(songs) == 0 {
-		c.Status(404)
-		return
-	}
+// zipLayout controls how streamSongsAsZip names archive entries.
+type zipLayout struct {
+	// perAlbum places each entry in a folder named after its album.
+	perAlbum bool
+	// trackNames names entries "NN - Title.ext" instead of the file's own name.
+	trackNames bool
+	// cover, when set, is written first as cover.jpg (or cover.png).
+	cover *zipCover
+}
+
+type zipCover struct {
+	data     []byte
+	mimeType string
+}
 
-	// Set headers for zip download
-	zipFilename := fmt.Sprintf("%s - %s.zip", artistName, albumName)
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", zipFilename))
+// streamSongsAsZip writes songs to the client as a zip archive built on the
+// fly. Audio is already compressed, so entries are stored rather than
+// deflated, and nothing is buffered beyond io.Copy's chunk; without a
+// Content-Length the response goes out with chunked encoding.
+func streamSongsAsZip(c *gin.Context, zipFilename string, songs []zipSong, layout zipLayout) {
+	c.Header("Content-Disposition", attachmentDisposition(sanitizeZipName(zipFilename)))
 	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	// Archives take longer than the server's WriteTimeout to send.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
 
-	// Create zip writer
 	zipWriter := zip.NewWriter(c.Writer)
 	defer zipWriter.Close()
 
-	// Add each song to the zip
+	if layout.cover != nil {
+		name := "cover.jpg"
+		if layout.cover.mimeType == "image/png" {
+			name = "cover.png"
+		}
+		if entry, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()}); err == nil {
+			_, _ = entry.Write(layout.cover.data)
+		}
+	}
+
+	multiDisc := false
 	for _, song := range songs {
-		file, err := os.Open(song.Path)
-		if err != nil {
-			log.Printf("Error opening song file for zip: %v", err)
-			continue
+		if song.Disc > 1 {
+			multiDisc = true
+			break
 		}
+	}
 
-		// Create entry in zip
-		zipEntry, err := zipWriter.Create(filepath.Base(song.Path))
-		if err != nil {
-			log.Printf("Error creating zip entry: %v", err)
-			file.Close()
+	used := make(map[string]int)
+	added := 0
+	for _, song := range songs {
+		name := filepath.Base(song.Path)
+		if layout.trackNames {
+			name = zipTrackName(song, multiDisc)
+		}
+		if layout.perAlbum {
+			name = sanitizeZipName(song.Album) + "/" + name
+		}
+		if n := used[name]; n > 0 {
+			ext := filepath.Ext(name)
+			name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n+1, ext)
+		}
+		used[name]++
+		if err := addFileToZip(zipWriter, name, song.Path); err != nil {
+			log.Printf("Error adding %s to zip: %v", song.Path, err)
 			continue
 		}
+		added++
+	}
 
-		// Copy file content to zip
-		_, err = io.Copy(zipEntry, file)
-		file.Close()
+	log.Printf("Streamed zip archive %q with %d of %d songs", zipFilename, added, len(songs))
+}
+
+// zipTrackName names an entry after its track number and title, prefixed with
+// the disc number when the archive spans several discs.
+func zipTrackName(song zipSong, multiDisc bool) string {
+	title := sanitizeZipName(song.Title)
+	if title == "download" {
+		title = strings.TrimSuffix(filepath.Base(song.Path), filepath.Ext(song.Path))
+	}
+	ext := filepath.Ext(song.Path)
+	switch {
+	case multiDisc && song.Disc > 0:
+		return fmt.Sprintf("%d-%02d - %s%s", song.Disc, song.Track, title, ext)
+	case song.Track > 0:
+		return fmt.Sprintf("%02d - %s%s", song.Track, title, ext)
+	}
+	return title + ext
+}
 
+// embeddedCover returns the first embedded picture found in the given files.
+func embeddedCover(paths ...string) *zipCover {
+	for _, path := range paths {
+		file, err := os.Open(path)
 		if err != nil {
-			log.Printf("Error copying file to zip: %v", err)
 			continue
 		}
+		meta, err := tag.ReadFrom(file)
+		file.Close()
+		if err == nil && meta != nil && meta.Picture() != nil && len(meta.Picture().Data) > 0 {
+			return &zipCover{data: meta.Picture().Data, mimeType: meta.Picture().MIMEType}
+		}
 	}
+	return nil
+}
 
-	log.Printf("Created zip archive with %d songs for album: %s", len(songs), albumName)
+// addFileToZip copies the file at path into the archive as an uncompressed entry.
+func addFileToZip(zipWriter *zip.Writer, name, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Store
+	entry, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, file)
+	return err
 }
 
-// subsonicGetAlbumInfo returns metadata about an album
-// For now, we return basic info from our database
+// sanitizeZipName strips characters that are invalid in file names on common
+// platforms so archive and entry names extract cleanly everywhere.
+func sanitizeZipName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." {
+		return "download"
+	}
+	return name
+}
+
+// subsonicGetAlbumInfo serves getAlbumInfo and getAlbumInfo2 with notes,
+// musicBrainzId and image URLs from MusicBrainz and Last.fm; see album_info.go.
 func subsonicGetAlbumInfo(c *gin.Context) {
 	_ = c.MustGet("user") // Auth is handled by middleware
 
@@ -242,26 +389,20 @@ func subsonicGetAlbumInfo(c *gin.Context) {
 		return
 	}
 
-	log.Printf("getAlbumInfo called for ID: %s", id)
-
-	// Get album info from a song in the album
-	albumName, artistName, _, _, err := QueryAlbumDetails(db, id)
+	ref, err := resolveAlbumRef(db, id)
 	if err != nil {
 		log.Printf("Album not found for getAlbumInfo: %v", err)
 		subsonicRespond(c, newSubsonicErrorResponse(70, "Album not found."))
 		return
 	}
 
-	// Build album info response
-	albumInfo := &SubsonicAlbumInfo{
-		Notes:          fmt.Sprintf("Album: %s by %s", albumName, artistName),
-		MusicBrainzID:  "",
-		LastFmUrl:      "",
-		SmallImageUrl:  "",
-		MediumImageUrl: "",
-		LargeImageUrl:  "",
-	}
-
-	response := newSubsonicResponse(albumInfo)
-	subsonicRespond(c, response)
+	info := albumInfoFor(c.Request.Context(), ref, albumDisplayArtist(db, ref.Name, ref.Path))
+	subsonicRespond(c, newSubsonicResponse(&SubsonicAlbumInfo{
+		Notes:          info.Notes,
+		MusicBrainzID:  info.MusicBrainzID,
+		LastFmUrl:      info.LastFmURL,
+		SmallImageUrl:  info.SmallImageURL,
+		MediumImageUrl: info.MediumImageURL,
+		LargeImageUrl:  info.LargeImageURL,
+	}))
 }
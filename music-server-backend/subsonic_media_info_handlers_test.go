@@ -0,0 +1,120 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDownloadServesOriginalFilesAndZips(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+	invalidateArtistIDCache()
+	defer invalidateArtistIDCache()
+
+	dir := filepath.Join(t.TempDir(), "Album")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{"01.flac": "first-track-bytes", "02.flac": "second-track-bytes"}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stmts := []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT UNIQUE NOT NULL, is_admin BOOLEAN NOT NULL DEFAULT 0,
+			download_role INTEGER NOT NULL DEFAULT 1)`,
+		`INSERT INTO users (id, username) VALUES (1, 'test')`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+	for i, name := range []string{"01.flac", "02.flac"} {
+		if _, err := db.Exec(`INSERT INTO songs (id, title, artist, album, album_path, path, track, cancelled) VALUES (?, ?, 'Band', 'Record', ?, ?, ?, 0)`,
+			[]string{"a1", "a2"}[i], name, dir, filepath.Join(dir, name), i+1); err != nil {
+			t.Fatalf("seed song: %v", err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	download := func(id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/rest/download.view?id="+id, nil)
+		c.Set("user", User{ID: 1, Username: "test"})
+		subsonicDownload(c)
+		return w
+	}
+	zipEntries := func(w *httptest.ResponseRecorder) []string {
+		zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+		if err != nil {
+			t.Fatalf("response is not a zip: %v", err)
+		}
+		var names []string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	// A plain song id returns that file untouched.
+	w := download("a2")
+	if w.Body.String() != "second-track-bytes" {
+		t.Fatalf("expected original bytes, got %q", w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") || !strings.Contains(cd, "02.flac") {
+		t.Fatalf("unexpected Content-Disposition %q", cd)
+	}
+
+	// The album's first song id is still just that song.
+	w = download("a1")
+	if w.Body.String() != "first-track-bytes" {
+		t.Fatalf("expected the first song's bytes, got %q", w.Body.String())
+	}
+
+	// An album id returns every track of the album.
+	if err := RebuildLibraryIndex(db); err != nil {
+		t.Fatal(err)
+	}
+	w = download(AlbumID("Record", dir))
+	if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Fatalf("album download Content-Type = %q, body %s", ct, w.Body.String())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("album download is not a zip: %v", err)
+	}
+	var contents []string
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		contents = append(contents, string(b))
+	}
+	sort.Strings(contents)
+	if strings.Join(contents, ",") != "first-track-bytes,second-track-bytes" {
+		t.Fatalf("album zip holds %v, want both tracks", contents)
+	}
+
+	// An artist id returns every song grouped by album folder.
+	w = download(GenerateArtistID("Band"))
+	if got := zipEntries(w); strings.Join(got, ",") != "Record/01.flac,Record/02.flac" {
+		t.Fatalf("artist zip entries = %v", got)
+	}
+}
@@ -17,7 +17,6 @@ import (
 	"strconv"
 	"strings"
 	"time"
-	"unicode"
 
 	"github.com/dhowden/tag"
 	"github.com/disintegration/imaging"
@@ -36,13 +35,11 @@ type AudioInfo struct {
 
 // getDuration extracts the duration of an audio file using ffprobe
 func getDuration(filePath string) int {
-	cmd := exec.Command("ffprobe",
+	output, err := runFFprobe(
 		"-v", "error",
 		"-show_entries", "format=duration",
 		"-of", "default=noprint_wrappers=1:nokey=1",
 		filePath)
-
-	output, err := cmd.Output()
 	if err != nil {
 		log.Printf("⚠️  FFprobe duration failed for %s: %v", filepath.Base(filePath), err)
 		return 0
@@ -80,15 +77,15 @@ func getAudioProperties(filePath string) audioProperties {
 		props.Size = fi.Size()
 	}
 
-	cmd := exec.Command("ffprobe",
+	output, err := runFFprobe(
 		"-v", "error",
 		"-select_streams", "a:0",
 		"-show_entries", "format=duration,bit_rate:stream=sample_rate,channels,bits_per_raw_sample",
 		"-of", "default=noprint_wrappers=1",
 		filePath)
-	output, err := cmd.Output()
 	if err != nil {
 		log.Printf("⚠️  FFprobe properties failed for %s: %v", filepath.Base(filePath), err)
+		recordScanError(filePath, scanErrorFFprobe, err)
 		return props
 	}
 
@@ -339,41 +336,38 @@ func findLibraryRootForFile(filePath string) (string, bool) {
 	return filepath.Clean(libPath), true
 }
 
-// detectAudioFormat detects the format and bitrate of an audio file using FFprobe
-func detectAudioFormat(filePath string) (*AudioInfo, error) {
-	info := &AudioInfo{}
+// audioCodecs maps the formats audioFormatFromExt returns to their codec.
+var audioCodecs = map[string]string{"mp3": "mp3", "flac": "flac", "aac": "aac", "ogg": "vorbis", "opus": "opus"}
 
-	// Detect format from file extension
-	ext := strings.ToLower(filepath.Ext(filePath))
-	switch ext {
+// audioFormatFromExt names a file's format from its extension.
+func audioFormatFromExt(filePath string) string {
+	switch strings.ToLower(filepath.Ext(filePath)) {
 	case ".mp3":
-		info.Format = "mp3"
-		info.Codec = "mp3"
+		return "mp3"
 	case ".flac":
-		info.Format = "flac"
-		info.Codec = "flac"
+		return "flac"
 	case ".m4a", ".aac":
-		info.Format = "aac"
-		info.Codec = "aac"
+		return "aac"
 	case ".ogg":
-		info.Format = "ogg"
-		info.Codec = "vorbis"
+		return "ogg"
 	case ".opus":
-		info.Format = "opus"
-		info.Codec = "opus"
-	default:
-		info.Format = "unknown"
+		return "opus"
 	}
+	return "unknown"
+}
+
+// detectAudioFormat detects the format and bitrate of an audio file using FFprobe
+func detectAudioFormat(filePath string) (*AudioInfo, error) {
+	info := &AudioInfo{Format: audioFormatFromExt(filePath)}
+	info.Codec = audioCodecs[info.Format]
 
 	// Use ffprobe to get accurate bitrate
 	// ffprobe -v error -show_entries format=bit_rate -of default=noprint_wrappers=1:nokey=1 file.mp3
-	cmd := exec.Command("ffprobe",
+	output, err := runFFprobe(
 		"-v", "error",
 		"-show_entries", "format=bit_rate",
 		"-of", "default=noprint_wrappers=1:nokey=1",
 		filePath)
-
-	output, err := cmd.Output()
 	if err != nil {
 		log.Printf("⚠️  FFprobe failed for %s: %v (will transcode)", filepath.Base(filePath), err)
 		info.Bitrate = 0 // Unknown bitrate, will transcode
@@ -396,12 +390,24 @@ func detectAudioFormat(filePath string) (*AudioInfo, error) {
 	return info, nil
 }
 
-// shouldTranscode determines if transcoding is necessary
-func shouldTranscode(sourceInfo *AudioInfo, targetFormat string, targetBitrate int) bool {
-	// Always transcode lossless formats (FLAC) to save bandwidth
+// losslessDirectAllowed reports whether allow_lossless_direct lets lossless
+// sources through untouched for users who have transcoding on, e.g. on a LAN
+// where bandwidth does not matter.
+func losslessDirectAllowed() bool {
+	return configBool(db, "allow_lossless_direct")
+}
+
+// shouldTranscode determines if transcoding is necessary. reason is the short
+// explanation sent in X-Stream-Reason.
+func shouldTranscode(sourceInfo *AudioInfo, targetFormat string, targetBitrate int) (transcode bool, reason string) {
+	// Transcode lossless formats (FLAC) to save bandwidth unless the admin allows them
 	if sourceInfo.Format == "flac" {
+		if losslessDirectAllowed() {
+			log.Printf("✨ Skipping transcode: lossless direct play is allowed")
+			return false, "lossless direct play allowed"
+		}
 		log.Printf("🔄 Transcoding needed: source is lossless FLAC")
-		return true
+		return true, "lossless source"
 	}
 
 	// If source format matches target format
@@ -409,19 +415,41 @@ func shouldTranscode(sourceInfo *AudioInfo, targetFormat string, targetBitrate i
 		// If we can't determine source bitrate, assume transcoding needed
 		if sourceInfo.Bitrate == 0 {
 			log.Printf("🔄 Transcoding: source format matches but bitrate unknown")
-			return true
+			return true, "source bitrate unknown"
 		}
 
 		// If source bitrate is lower or equal to target, no need to transcode
 		if sourceInfo.Bitrate <= targetBitrate {
 			log.Printf("✨ Skipping transcode: source %s %dkbps <= target %dkbps",
 				sourceInfo.Format, sourceInfo.Bitrate, targetBitrate)
-			return false
+			return false, "source bitrate within target"
 		}
+		log.Printf("🔄 Transcoding needed: source %dkbps > target %dkbps", sourceInfo.Bitrate, targetBitrate)
+		return true, "source bitrate above target"
 	}
 
 	log.Printf("🔄 Transcoding needed: %s → %s", sourceInfo.Format, targetFormat)
-	return true
+	return true, "format differs from target"
+}
+
+// storedAudioInfo describes path from its extension and the bitrate the
+// scanner stored, for direct streams that need no ffprobe run.
+func storedAudioInfo(path string) *AudioInfo {
+	info := &AudioInfo{Format: audioFormatFromExt(path)}
+	db.QueryRow("SELECT COALESCE(bitrate, 0) FROM songs WHERE path = ?", path).Scan(&info.Bitrate)
+	return info
+}
+
+// setStreamSource sends X-Stream-Reason and the source's X-Source-Format and
+// X-Source-Bitrate (kbps, when known). X-Stream-Decision itself is set where
+// the response is actually produced, by streamDirect(At) or
+// streamWithTranscoding, so fallbacks are reported truthfully.
+func setStreamSource(c *gin.Context, reason string, source *AudioInfo) {
+	c.Header("X-Stream-Reason", reason)
+	c.Header("X-Source-Format", source.Format)
+	if source.Bitrate > 0 {
+		c.Header("X-Source-Bitrate", strconv.Itoa(source.Bitrate))
+	}
 }
 
 // getTranscodingProfile returns optimized FFmpeg parameters based on quality
@@ -440,6 +468,7 @@ func getTranscodingProfile(format string, bitrate int) []string {
 		"-analyzeduration", "0", // Skip analysis, start immediately
 		"-avoid_negative_ts", "make_zero", // Handle timestamp issues
 	}
+	baseArgs = append(baseArgs, loudnormArgs()...) // Optional; see loudness.go
 
 	// Format-specific optimizations
 	// Note: Some encoders like libmp3lame don't support preset parameter
@@ -452,7 +481,8 @@ func getTranscodingProfile(format string, bitrate int) []string {
 			"-compression_level", "0", // FASTEST encoding
 			"-reservoir", "0", // Disable bit reservoir for instant start
 			"-write_xing", "0", // Skip Xing header for immediate streaming
-			"-q:a", "9", // Lowest quality for maximum speed (still acceptable at 192k)
+			// No -q:a here: it switches LAME to VBR, and streamWithTranscoding
+			// maps Range byte offsets to seek times assuming a constant bitrate.
 		)
 	case "ogg":
 		return append(baseArgs,
@@ -490,6 +520,9 @@ func subsonicStream(c *gin.Context) {
 	user := c.MustGet("user").(User)
 
 	songID := c.Query("id")
+	if streamInternetRadio(c, songID) {
+		return
+	}
 	path, duration, err := QuerySongPathAndDuration(db, songID)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -500,38 +533,116 @@ func subsonicStream(c *gin.Context) {
 		return
 	}
 
+	// timeOffset (seconds) starts playback mid-track, e.g. to resume a bookmark.
+	var timeOffset float64
+	if v := c.Query("timeOffset"); v != "" {
+		timeOffset, err = strconv.ParseFloat(v, 64)
+		if err != nil || timeOffset < 0 {
+			subsonicRespond(c, newSubsonicErrorResponse(10, "Invalid timeOffset."))
+			return
+		}
+		if duration > 0 && timeOffset >= float64(duration) {
+			timeOffset = 0
+		}
+	}
+
 	// Set X-Content-Duration header (like Navidrome does) so browser knows duration immediately
-	// This is critical for HTML5 audio controls to show correct timeline
+	// This is critical for HTML5 audio controls to show correct timeline. With a
+	// timeOffset it reflects the remaining time.
 	if duration > 0 {
-		c.Header("X-Content-Duration", strconv.Itoa(duration))
+		c.Header("X-Content-Duration", strconv.Itoa(duration-int(timeOffset)))
 	}
 
-	// Check if user has transcoding enabled
-	var transcodingEnabled int
-	var format string
-	var bitrate int
-	err = db.QueryRow("SELECT enabled, format, bitrate FROM transcoding_settings WHERE user_id = ?", user.ID).
-		Scan(&transcodingEnabled, &format, &bitrate)
-
-	useTranscoding := err == nil && transcodingEnabled == 1
+	streamSongForUser(c, user, path, duration, timeOffset)
+}
 
-	log.Printf("🎧 Stream request: user=%s, song=%s, duration=%ds, transcoding_enabled=%v, format=%s, bitrate=%d",
-		user.Username, filepath.Base(path), duration, useTranscoding, format, bitrate)
+// streamSongForUser streams path directly or through ffmpeg, following the
+// user's transcoding settings or, without any, the server default (see
+// userTranscodePreference).
+func streamSongForUser(c *gin.Context, user User, path string, duration int, timeOffset float64) {
+	pref, _ := userTranscodePreference(user.ID)
+	useTranscoding, format, bitrate := pref.Enabled, pref.Format, pref.Bitrate
+
+	log.Printf("🎧 Stream request: user=%s, song=%s, duration=%ds, transcoding_enabled=%v, format=%s, bitrate=%d, timeOffset=%.1fs",
+		user.Username, filepath.Base(path), duration, useTranscoding, format, bitrate, timeOffset)
+
+	// Clients on the local network always get the original; see lan_streaming.go.
+	if useTranscoding && isLANClient(c.ClientIP()) {
+		log.Printf("🏠 LAN client %s: direct streaming %s", c.ClientIP(), filepath.Base(path))
+		setStreamSource(c, "LAN client", storedAudioInfo(path))
+		streamDirectAt(c, path, timeOffset, duration)
+		return
+	}
 
 	if useTranscoding {
 		// Smart codec detection: check if transcoding is actually needed
-		sourceInfo, err := detectAudioFormat(path)
-		if err == nil && !shouldTranscode(sourceInfo, format, bitrate) {
+		// A source that needs no re-encoding is still transcoded when loudness
+		// normalization is on, so every track is played at the same level.
+		sourceInfo, _ := detectAudioFormat(path)
+		transcode, reason := shouldTranscode(sourceInfo, format, bitrate)
+		if !transcode && loudnessNormalizationEnabled() {
+			transcode, reason = true, "loudness normalization"
+		}
+		setStreamSource(c, reason, sourceInfo)
+		if !transcode {
 			log.Printf("✨ Smart skip: source already optimal, direct streaming")
-			streamDirect(c, path)
+			streamDirectAt(c, path, timeOffset, duration)
 			return
 		}
 
-		streamWithTranscoding(c, path, format, bitrate)
+		streamWithTranscoding(c, path, format, bitrate, timeOffset, duration)
 	} else {
 		log.Printf("📀 Direct stream (no transcoding): %s", filepath.Base(path))
+		setStreamSource(c, "transcoding disabled", storedAudioInfo(path))
+		streamDirectAt(c, path, timeOffset, duration)
+	}
+}
+
+// frameSeekableExts are formats made of self-synchronising frames, so a
+// player can start decoding from an arbitrary byte offset.
+var frameSeekableExts = map[string]bool{".mp3": true, ".aac": true}
+
+// streamDirectAt streams the original file starting timeOffset seconds in.
+// For frame-based formats the offset is mapped to a byte position assuming a
+// constant bitrate (close enough for VBR too; the player resyncs on the next
+// frame). Other containers cannot be entered mid-file, so they are transcoded
+// with an ffmpeg seek instead.
+func streamDirectAt(c *gin.Context, path string, timeOffset float64, duration int) {
+	if timeOffset <= 0 || duration <= 0 {
 		streamDirect(c, path)
+		return
+	}
+	if !frameSeekableExts[strings.ToLower(filepath.Ext(path))] {
+		log.Printf("⏩ timeOffset on non-seekable %s: transcoding from %.1fs", filepath.Base(path), timeOffset)
+		c.Header("X-Stream-Reason", "timeOffset in a non-seekable format")
+		streamWithTranscoding(c, path, "mp3", 320, timeOffset, duration)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Printf("Could not open file for streaming %s: %v", path, err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Could not open file."))
+		return
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		log.Printf("Could not get file info for streaming %s: %v", path, err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Could not read file info."))
+		return
+	}
+
+	start := int64(timeOffset / float64(duration) * float64(fileInfo.Size()))
+	log.Printf("⏩ timeOffset %.1fs -> byte %d of %s", timeOffset, start, filepath.Base(path))
+	c.Header("X-Stream-Decision", "direct")
+	if !prepareRangeRequest(c, filepath.Base(path), fileInfo.Size()-start) {
+		return
 	}
+	c.Header("ETag", strings.TrimSuffix(fileETag(fileInfo), `"`)+"-"+strconv.FormatInt(start, 36)+`"`)
+	http.ServeContent(c.Writer, c.Request, fileInfo.Name(), fileInfo.ModTime(),
+		io.NewSectionReader(file, start, fileInfo.Size()-start))
 }
 
 func streamDirect(c *gin.Context, path string) {
@@ -550,15 +661,22 @@ func streamDirect(c *gin.Context, path string) {
 		return
 	}
 
+	c.Header("X-Stream-Decision", "direct")
+	if !prepareRangeRequest(c, filepath.Base(path), fileInfo.Size()) {
+		return
+	}
 	// Explicitly set Content-Length to help browser determine duration faster
 	// http.ServeContent should do this, but let's be explicit
 	c.Header("Content-Length", strconv.FormatInt(fileInfo.Size(), 10))
-	c.Header("Accept-Ranges", "bytes")
+	c.Header("ETag", fileETag(fileInfo))
 
 	http.ServeContent(c.Writer, c.Request, fileInfo.Name(), fileInfo.ModTime(), file)
 }
 
-func streamWithTranscoding(c *gin.Context, inputPath string, format string, bitrate int) {
+// streamWithTranscoding pipes ffmpeg output to the client. startOffset (seconds)
+// is added to any seek derived from a Range header; duration is the song's
+// length in seconds, announced as X-Content-Duration.
+func streamWithTranscoding(c *gin.Context, inputPath string, format string, bitrate int, startOffset float64, duration int) {
 	startTime := time.Now()
 	songID := c.Query("id")
 
@@ -598,16 +716,29 @@ func streamWithTranscoding(c *gin.Context, inputPath string, format string, bitr
 	ffmpegFormat, ok := ffmpegFormatMap[format]
 	if !ok {
 		log.Printf("❌ Unsupported transcoding format: %s - falling back to direct stream", format)
+		c.Header("X-Stream-Reason", "unsupported transcoding format")
+		streamDirect(c, inputPath)
+		return
+	}
+
+	release, ok := acquireTranscodeSlot(c.Request.Context(), transcodeQueueWait)
+	if !ok {
+		if c.Request.Context().Err() != nil {
+			return
+		}
+		log.Printf("⏳ All %d transcode slots busy - falling back to direct stream", maxConcurrentTranscodes())
+		c.Header("X-Stream-Reason", "transcode slots busy")
 		streamDirect(c, inputPath)
 		return
 	}
+	defer release()
 
-	var seekSeconds float64 = 0
+	seekSeconds := startOffset
 
 	if isRangeRequest && requestedStart > 0 {
 		// Calculate approximate seek time from byte offset
 		// Formula: bytes / (bitrate_kbps * 125) = seconds
-		seekSeconds = float64(requestedStart) / float64(bitrate*125)
+		seekSeconds += float64(requestedStart) / float64(bitrate*125)
 		log.Printf("🔍 Calculated seek position: %.2f seconds", seekSeconds)
 	}
 
@@ -629,7 +760,10 @@ func streamWithTranscoding(c *gin.Context, inputPath string, format string, bitr
 
 	log.Printf("🔧 FFmpeg command: ffmpeg %s", strings.Join(args, " "))
 
-	cmd := exec.Command("ffmpeg", args...)
+	// ffmpeg is killed as soon as the request context ends, which also covers
+	// clients that disconnect without a failed write and server shutdown.
+	cmd := exec.CommandContext(c.Request.Context(), "ffmpeg", args...)
+	cmd.WaitDelay = time.Second // don't hang in Wait on the stderr reader
 
 	// Capture stderr for debugging
 	stderr, err := cmd.StderrPipe()
@@ -653,15 +787,20 @@ func streamWithTranscoding(c *gin.Context, inputPath string, format string, bitr
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		log.Printf("❌ Failed to create FFmpeg stdout pipe: %v", err)
+		c.Header("X-Stream-Reason", "ffmpeg failed to start")
 		streamDirect(c, inputPath)
 		return
 	}
 
 	if err := cmd.Start(); err != nil {
 		log.Printf("❌ Failed to start FFmpeg: %v", err)
+		c.Header("X-Stream-Reason", "ffmpeg failed to start")
 		streamDirect(c, inputPath)
 		return
 	}
+	activeTranscodes.Add(1)
+	defer activeTranscodes.Add(-1)
+	// Every path below ends in cmd.Wait, so no ffmpeg is left as a zombie.
 
 	// Set headers
 	contentTypes := map[string]string{
@@ -676,11 +815,19 @@ func streamWithTranscoding(c *gin.Context, inputPath string, format string, bitr
 	c.Header("Content-Type", contentType)
 	c.Header("Accept-Ranges", "bytes") // Support seeking
 	c.Header("X-Transcoded", "true")
+	c.Header("X-Stream-Decision", "transcode")
 	c.Header("X-Transcode-Format", format)
 	c.Header("X-Transcode-Bitrate", bitrateStr)
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
 
+	// Announce the duration so players can draw a timeline. No Content-Length
+	// is sent: the encoded size is only known once ffmpeg finishes, and a
+	// wrong estimate would cut the song short or pad it with garbage.
+	if !isRangeRequest && duration > 0 {
+		c.Header("X-Content-Duration", strconv.Itoa(int(float64(duration)-seekSeconds)))
+	}
+
 	if isRangeRequest {
 		c.Status(http.StatusPartialContent)
 		log.Printf("📤 Sending 206 Partial Content response")
@@ -733,6 +880,10 @@ func streamWithTranscoding(c *gin.Context, inputPath string, format string, bitr
 	}
 
 	cmd.Wait()
+	if c.Request.Context().Err() != nil {
+		log.Printf("⚠️  Client went away, FFmpeg stopped after %d bytes", bytesWritten)
+		return
+	}
 	log.Printf("✅ Transcoding complete: %d bytes sent", bytesWritten)
 }
 
@@ -944,6 +1095,15 @@ func subsonicScrobble(c *gin.Context) {
 		log.Printf("Error inserting play history for user '%s' on song '%s': %v", user.Username, songID, err)
 	}
 
+	// Mirror submissions (not "now playing" notifications) to Last.fm; see lastfm.go.
+	if c.DefaultQuery("submission", "true") != "false" {
+		playedAt := time.Now()
+		if ms, err := strconv.ParseInt(c.Query("time"), 10, 64); err == nil && ms > 0 {
+			playedAt = time.UnixMilli(ms)
+		}
+		go scrobbleToLastFm(user.ID, songID, playedAt)
+	}
+
 	log.Printf("Scrobbled song '%s' for user '%s'", songID, user.Username)
 	subsonicRespond(c, newSubsonicResponse(nil))
 }
@@ -951,21 +1111,49 @@ func subsonicScrobble(c *gin.Context) {
 func subsonicGetArtists(c *gin.Context) {
 	_ = c.MustGet("user") // Auth is handled by middleware
 
-	// List artists from the derived artists table (counts precomputed).
-	rows, err := db.Query(`SELECT name, song_count, album_count FROM artists ORDER BY name COLLATE NOCASE`)
+	body, err := cachedBrowse(browseCacheArtists, func() (interface{}, error) { return loadArtistsIndex() })
 	if err != nil {
 		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error querying artists."))
 		return
 	}
+	subsonicRespond(c, newSubsonicResponse(body.(*SubsonicArtists)))
+}
+
+// browseArtists lists every artist with its counts for getArtists/getIndexes.
+// By default this reads the derived artists table (grouped by the raw artist
+// tag); with use_album_artist it groups songs by album artist instead so
+// "X feat. Y" tracks on X's albums don't become artists of their own.
+//
+// Artists come back in sort name order (see sort_name.go).
+func browseArtists() ([]ArtistResult, error) {
+	if UseAlbumArtist(db) {
+		results, err := QueryArtists(db, ArtistQueryOptions{UseEffectiveArtist: true, IncludeCounts: true})
+		// SQL only skips the articles; this also folds accents.
+		sort.SliceStable(results, func(i, j int) bool { return results[i].SortName < results[j].SortName })
+		return results, err
+	}
+	rows, err := db.Query(`SELECT name, sort_name, song_count, album_count FROM artists ORDER BY sort_name, name COLLATE NOCASE`)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 	var results []ArtistResult
 	for rows.Next() {
 		var r ArtistResult
-		if err := rows.Scan(&r.Name, &r.SongCount, &r.AlbumCount); err != nil {
+		if err := rows.Scan(&r.Name, &r.SortName, &r.SongCount, &r.AlbumCount); err != nil {
 			continue
 		}
 		results = append(results, r)
 	}
+	return results, rows.Err()
+}
+
+// loadArtistsIndex builds the getArtists body from browseArtists.
+func loadArtistsIndex() (*SubsonicArtists, error) {
+	results, err := browseArtists()
+	if err != nil {
+		return nil, err
+	}
 
 	artistIndex := make(map[string][]SubsonicArtist)
 	seenArtists := make(map[string]bool)
@@ -983,18 +1171,9 @@ func subsonicGetArtists(c *gin.Context) {
 		artist.CoverArt = artist.Name
 		artist.AlbumCount = result.AlbumCount
 		artist.SongCount = result.SongCount
+		artist.SortName = result.SortName
 
-		var indexChar string
-		for _, r := range artist.Name {
-			if unicode.IsLetter(r) || unicode.IsNumber(r) {
-				indexChar = strings.ToUpper(string(r))
-				break
-			}
-		}
-		if indexChar == "" {
-			indexChar = "#"
-		}
-
+		indexChar := indexLetter(artist.SortName)
 		artistIndex[indexChar] = append(artistIndex[indexChar], artist)
 	}
 
@@ -1010,9 +1189,7 @@ func subsonicGetArtists(c *gin.Context) {
 		return indices[i].Name < indices[j].Name
 	})
 
-	responseBody := &SubsonicArtists{Index: indices}
-	response := newSubsonicResponse(responseBody)
-	subsonicRespond(c, response)
+	return &SubsonicArtists{Index: indices}, nil
 }
 
 // fetchAlbumList resolves the album list for getAlbumList/getAlbumList2 from the
@@ -1048,12 +1225,14 @@ func fetchAlbumList(c *gin.Context) (resultAlbums []SubsonicAlbum, ok bool) {
 	}
 
 	var orderByClause string
+	withSQL, fromSQL := "", "albums"
 	switch listType {
 	case "starred":
 		user := c.MustGet("user").(User)
-		where = append(where, "id IN (SELECT album_id FROM starred_albums WHERE user_id = ?)")
+		// star stores album ids (see resolveAlbumRef).
+		where = append(where, `EXISTS (SELECT 1 FROM starred_albums sa WHERE sa.user_id = ? AND sa.album_id = albums.id)`)
 		args = append(args, user.ID)
-		orderByClause = "ORDER BY name COLLATE NOCASE"
+		orderByClause = "ORDER BY sort_name, name COLLATE NOCASE"
 	case "newest":
 		orderByClause = "ORDER BY max_date_added DESC, artist, name"
 	case "recent":
@@ -1062,13 +1241,16 @@ func fetchAlbumList(c *gin.Context) (resultAlbums []SubsonicAlbum, ok bool) {
 		orderByClause = "ORDER BY total_play_count DESC, artist, name"
 	case "random":
 		orderByClause = "ORDER BY RANDOM()"
+	case "highest":
+		withSQL, fromSQL = albumRatingsCTE, "albums"+albumRatingsJoin
+		orderByClause = "ORDER BY average_rating DESC, artist_sort_name, sort_name"
 	case "alphabeticalByName":
-		orderByClause = "ORDER BY name COLLATE NOCASE, artist"
+		orderByClause = "ORDER BY sort_name, artist_sort_name, name COLLATE NOCASE"
 	case "alphabeticalByArtist":
-		orderByClause = "ORDER BY artist COLLATE NOCASE, name COLLATE NOCASE"
+		orderByClause = "ORDER BY artist_sort_name, sort_name, name COLLATE NOCASE"
 	default:
 		log.Printf("Warning: Unknown album list type '%s', defaulting to alphabeticalByArtist", listType)
-		orderByClause = "ORDER BY artist COLLATE NOCASE, name COLLATE NOCASE"
+		orderByClause = "ORDER BY artist_sort_name, sort_name, name COLLATE NOCASE"
 	}
 
 	whereSQL := ""
@@ -1079,7 +1261,7 @@ func fetchAlbumList(c *gin.Context) (resultAlbums []SubsonicAlbum, ok bool) {
 	var totalAlbums int
 	countArgs := make([]interface{}, len(args))
 	copy(countArgs, args)
-	if err := db.QueryRow("SELECT COUNT(*) FROM albums "+whereSQL, countArgs...).Scan(&totalAlbums); err != nil {
+	if err := db.QueryRow(withSQL+"SELECT COUNT(*) FROM "+fromSQL+" "+whereSQL, countArgs...).Scan(&totalAlbums); err != nil {
 		log.Printf("Error counting albums for pagination: %v", err)
 		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error querying albums."))
 		return nil, false
@@ -1089,8 +1271,8 @@ func fetchAlbumList(c *gin.Context) (resultAlbums []SubsonicAlbum, ok bool) {
 		return []SubsonicAlbum{}, true
 	}
 
-	query := fmt.Sprintf(`SELECT id, name, artist, artist_id, COALESCE(genre,''), song_count, total_duration, COALESCE(min_date_added,'')
-		FROM albums %s %s LIMIT ? OFFSET ?`, whereSQL, orderByClause)
+	query := fmt.Sprintf(`%sSELECT id, name, sort_name, artist, artist_id, COALESCE(genre,''), song_count, total_duration, COALESCE(min_date_added,'')
+		FROM %s %s %s LIMIT ? OFFSET ?`, withSQL, fromSQL, whereSQL, orderByClause)
 	args = append(args, size, offset)
 	rows, err := db.Query(query, args...)
 	if err != nil {
@@ -1105,7 +1287,7 @@ func fetchAlbumList(c *gin.Context) (resultAlbums []SubsonicAlbum, ok bool) {
 	var albums []SubsonicAlbum
 	for rows.Next() {
 		var album SubsonicAlbum
-		if err := rows.Scan(&album.ID, &album.Name, &album.Artist, &album.ArtistID, &album.Genre, &album.SongCount, &album.Duration, &album.Created); err != nil {
+		if err := rows.Scan(&album.ID, &album.Name, &album.SortName, &album.Artist, &album.ArtistID, &album.Genre, &album.SongCount, &album.Duration, &album.Created); err != nil {
 			log.Printf("Error scanning album row: %v", err)
 			continue
 		}
@@ -1159,25 +1341,24 @@ func subsonicGetAlbumList(c *gin.Context) {
 func subsonicGetAlbum(c *gin.Context) {
 	user := c.MustGet("user").(User)
 
-	albumSongId := c.Query("id")
-	if albumSongId == "" {
+	albumID := c.Query("id")
+	if albumID == "" {
 		subsonicRespond(c, newSubsonicErrorResponse(10, "Missing required parameter 'id'"))
 		return
 	}
 
-	var albumName, artistName, albumGenre, albumPath, albumDir string
-	err := db.QueryRow("SELECT album, artist, COALESCE(genre, ''), path, COALESCE(album_path, '') FROM songs WHERE id = ? AND cancelled = 0", albumSongId).Scan(&albumName, &artistName, &albumGenre, &albumPath, &albumDir)
+	// Album ids and, for older clients, any song of the album resolve to the
+	// same album (see album_key.go); the response carries the album id.
+	album, err := resolveAlbumRef(db, albumID)
 	if err != nil {
 		subsonicRespond(c, newSubsonicErrorResponse(70, "Album not found."))
 		return
 	}
-
-	// The album group is (album_path, album), matching the derived albums
-	// table. Legacy rows without album_path fall back to the song's directory.
-	if albumDir == "" {
-		albumDir = filepath.Dir(albumPath)
-	}
-	log.Printf("getAlbum: Fetching songs for album='%s', artist='%s', albumId=%s, albumDir='%s'", albumName, artistName, albumSongId, albumDir)
+	albumID = album.ID
+	albumName, albumDir := album.Name, album.Path
+	var albumGenre string
+	_ = db.QueryRow("SELECT genre FROM albums WHERE id = ?", albumID).Scan(&albumGenre)
+	log.Printf("getAlbum: Fetching songs for album='%s', albumId=%s, albumDir='%s'", albumName, albumID, albumDir)
 
 	// Display album artist (precomputed in the derived albums table)
 	displayArtist := albumDisplayArtist(db, albumName, albumDir)
@@ -1228,9 +1409,9 @@ func subsonicGetAlbum(c *gin.Context) {
 		}
 		r.Starred = starred == 1
 		r.ReplayGain = newReplayGain(rgTrackGain, rgTrackPeak, rgAlbumGain, rgAlbumPeak)
-		// The album's representative id and display artist override the
+		// The album's id and display artist override the
 		// per-row derivations so all songs share a consistent album context.
-		r.AlbumID = albumSongId
+		r.AlbumID = albumID
 		r.AlbumArtist = displayArtist
 
 		albumDuration += r.Duration
@@ -1239,18 +1420,19 @@ func subsonicGetAlbum(c *gin.Context) {
 		}
 
 		s := buildSubsonicSong(r)
-		s.CoverArt = albumSongId // Songs share the album cover
+		s.CoverArt = albumID // Songs share the album cover
 		songs = append(songs, s)
 	}
 
+	applySongRatings(user.ID, songs)
 	log.Printf("getAlbum: Returning %d songs for album '%s'", len(songs), albumName)
 
 	responseBody := &SubsonicAlbumWithSongs{
-		ID:            albumSongId,
+		ID:            albumID,
 		Name:          albumName,
 		Artist:        displayArtist,
 		ArtistID:      GenerateArtistID(displayArtist),
-		CoverArt:      albumSongId,
+		CoverArt:      albumID,
 		SongCount:     len(songs),
 		Duration:      albumDuration,
 		Created:       albumCreated,
@@ -1293,13 +1475,60 @@ func subsonicGetSong(c *gin.Context) {
 		return
 	}
 
-	s := buildSubsonicSong(results[0])
+	songs := []SubsonicSong{buildSubsonicSong(results[0])}
+	applySongRatings(user.ID, songs)
+
+	subsonicRespond(c, newSubsonicResponse(&SubsonicSongWrapper{Song: songs[0]}))
+}
+
+// maxGetSongsIDs caps the ids one getSongs call may ask for.
+const maxGetSongsIDs = 500
+
+// subsonicGetSongs is getSong for several ids at once (repeated id
+// parameters), so a client filling a queue needs one round trip instead of one
+// per song. Songs come back in request order; unknown ids are skipped.
+func subsonicGetSongs(c *gin.Context) {
+	user := c.MustGet("user").(User)
+
+	ids := c.QueryArray("id")
+	unique := uniqueSongIDs(ids)
+	if len(unique) == 0 {
+		subsonicRespond(c, newSubsonicErrorResponse(10, "Missing required parameter 'id'"))
+		return
+	}
+	if len(ids) > maxGetSongsIDs {
+		subsonicRespond(c, newSubsonicErrorResponse(0, fmt.Sprintf("At most %d ids per request.", maxGetSongsIDs)))
+		return
+	}
+
+	results, err := QuerySongs(db, SongQueryOptions{
+		IDs:            unique,
+		IncludeGenre:   true,
+		IncludeStarred: true,
+		UserID:         user.ID,
+	})
+	if err != nil {
+		log.Printf("Error querying for songs in getSongs: %v", err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error."))
+		return
+	}
+	byID := make(map[string]SongResult, len(results))
+	for _, r := range results {
+		byID[r.ID] = r
+	}
 
-	subsonicRespond(c, newSubsonicResponse(&SubsonicSongWrapper{Song: s}))
+	songs := make([]SubsonicSong, 0, len(ids))
+	for _, id := range ids {
+		if r, ok := byID[id]; ok {
+			songs = append(songs, buildSubsonicSong(r))
+		}
+	}
+	applySongRatings(user.ID, songs)
+	subsonicRespond(c, newSubsonicResponse(&SubsonicSongs{Songs: songs}))
 }
 
 func subsonicGetRandomSongs(c *gin.Context) {
-	_ = c.MustGet("user") // Auth is handled by middleware
+	user := c.MustGet("user").(User)
 
 	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
 	if size > 500 {
@@ -1323,6 +1552,7 @@ func subsonicGetRandomSongs(c *gin.Context) {
 	if songs == nil {
 		songs = []SubsonicSong{}
 	}
+	applySongRatings(user.ID, songs)
 	responseBody := &SubsonicRandomSongs{Songs: songs}
 	subsonicRespond(c, newSubsonicResponse(responseBody))
 }
@@ -1340,7 +1570,19 @@ func subsonicGetCoverArt(c *gin.Context) {
 		size = 512 // Default on parse error
 	}
 
-	// Check if ID exists in songs table (song/album ID)
+	// An album's cover is that of one of its songs (see album_key.go).
+	if isAlbumID(id) {
+		if album, err := resolveAlbumRef(db, id); err == nil {
+			if songID, err := albumCoverSongID(db, album); err == nil {
+				handleAlbumArt(c, songID, size)
+				return
+			}
+		}
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	// Check if ID exists in songs table
 	exists, err := SongExists(db, id)
 	if err == nil && exists {
 		handleAlbumArt(c, id, size)
@@ -1365,6 +1607,23 @@ func handleAlbumArt(c *gin.Context, songID string, size int) {
 	}
 	log.Printf("[COVER ART] Found path for song ID %s: %s", songID, path)
 
+	// The art comes from the tags or a folder image, so both are validators,
+	// as is the preference choosing between them.
+	songInfo, err := os.Stat(path)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	pref := coverArtPreference()
+	var folderInfo os.FileInfo
+	imagePath, hasFolderImage := findAlbumImage(path)
+	if hasFolderImage {
+		folderInfo, _ = os.Stat(imagePath)
+	}
+	if notModified(c, artETag(c, songID+"\x00"+pref, size, songInfo, folderInfo), latestModTime(songInfo, folderInfo), coverArtCacheControl) {
+		return
+	}
+
 	file, err := os.Open(path)
 	if err != nil {
 		c.Status(http.StatusInternalServerError)
@@ -1375,15 +1634,14 @@ func handleAlbumArt(c *gin.Context, songID string, size int) {
 	meta, err := tag.ReadFrom(file)
 	if err != nil {
 		log.Printf("INFO: unable to read tags for cover art in %s: %v", path, err)
-	} else if meta != nil && meta.Picture() != nil {
+	} else if meta != nil && meta.Picture() != nil && (!hasFolderImage || !useFolderArt(pref, meta.Picture().Data, imagePath, size)) {
 		pic := meta.Picture()
 		log.Printf("[COVER ART] Found embedded picture in %s", path)
 		resizeAndServeImage(c, bytes.NewReader(pic.Data), pic.MIMEType, size)
 		return
 	}
 
-	albumDir := filepath.Dir(path)
-	if imagePath, ok := findLocalImage(albumDir); ok {
+	if hasFolderImage {
 		log.Printf("[COVER ART] Found local image file: %s", imagePath)
 		localFile, err := os.Open(imagePath)
 		if err == nil {
@@ -1394,6 +1652,7 @@ func handleAlbumArt(c *gin.Context, songID string, size int) {
 	}
 
 	log.Printf("[COVER ART] No cover art found for song ID %s", songID)
+	c.Header("Cache-Control", "no-cache")
 	c.Status(http.StatusNotFound)
 }
 
@@ -1407,6 +1666,10 @@ func handleArtistArt(c *gin.Context, artistName string, size int) {
 			localFile, err := os.Open(imagePath)
 			if err == nil {
 				defer localFile.Close()
+				if info, err := localFile.Stat(); err == nil &&
+					notModified(c, artETag(c, artistName, size, info), info.ModTime(), coverArtCacheControl) {
+					return
+				}
 				log.Printf("[ARTIST ART] Found local image for '%s': %s", artistName, imagePath)
 				resizeAndServeImage(c, localFile, http.DetectContentType(nil), size)
 				return
@@ -1418,17 +1681,6 @@ func handleArtistArt(c *gin.Context, artistName string, size int) {
 	c.Status(http.StatusNotFound)
 }
 
-func findLocalImage(dir string) (string, bool) {
-	imageNames := []string{"cover.jpg", "cover.png", "folder.jpg", "front.jpg", "artist.jpg", "artist.png"}
-	for _, name := range imageNames {
-		path := filepath.Join(dir, name)
-		if _, err := os.Stat(path); err == nil {
-			return path, true
-		}
-	}
-	return "", false
-}
-
 func resizeAndServeImage(c *gin.Context, reader io.Reader, contentType string, size int) {
 	// Read all data first so we can retry with different decoders
 	data, err := io.ReadAll(reader)
@@ -1451,6 +1703,15 @@ func resizeAndServeImage(c *gin.Context, reader io.Reader, contentType string, s
 	// Resize image
 	resizedImg := imaging.Fit(img, size, size, imaging.Lanczos)
 
+	if artOutputFormat(c) == "webp" {
+		webp, err := encodeWebP(c.Request.Context(), resizedImg)
+		if err == nil {
+			c.Data(http.StatusOK, "image/webp", webp)
+			return
+		}
+		log.Printf("[RESIZE] WebP encoding failed, falling back: %v", err)
+	}
+
 	// Determine output format
 	var format imaging.Format
 	switch contentType {
@@ -1516,16 +1777,15 @@ func subsonicStar(c *gin.Context) {
 
 	// Star albums
 	for _, albumID := range albumIDs {
-		// Check if album exists (albumID is actually a song ID representing the album)
-		var exists bool
-		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM songs WHERE id = ? AND cancelled = 0)", albumID).Scan(&exists)
-		if err != nil || !exists {
+		// The star is kept under the album id, whichever id resolved it.
+		album, err := resolveAlbumRef(db, albumID)
+		if err != nil {
 			log.Printf("Album %s not found for starring", albumID)
 			continue
 		}
 
 		_, err = db.Exec(`INSERT OR REPLACE INTO starred_albums (user_id, album_id, starred_at) VALUES (?, ?, ?)`,
-			user.ID, albumID, now)
+			user.ID, album.ID, now)
 		if err != nil {
 			log.Printf("Error starring album %s for user %s: %v", albumID, user.Username, err)
 		} else {
@@ -1593,6 +1853,9 @@ func subsonicUnstar(c *gin.Context) {
 
 	// Unstar albums
 	for _, albumID := range albumIDs {
+		if album, err := resolveAlbumRef(db, albumID); err == nil {
+			albumID = album.ID
+		}
 		err := UnstarAlbum(db, user.ID, albumID)
 		if err != nil {
 			log.Printf("Error unstarring album %s for user %s: %v", albumID, user.Username, err)
@@ -1632,13 +1895,30 @@ func subsonicUnstar(c *gin.Context) {
 // collectStarred gathers the current user's starred songs, albums and artists.
 // Shared by getStarred (<starred>) and getStarred2 (<starred2>); on a DB error
 // it responds with a Subsonic error and returns ok=false.
+//
+// Songs are newest-starred first and can be paged with size (or count) and
+// offset; without size every starred song is returned. The server exposes a
+// single music folder, so any musicFolderId other than 1 yields empty lists.
 func collectStarred(c *gin.Context, user User) (songsOut []SubsonicSong, albumsOut []SubsonicAlbum, artistsOut []SubsonicArtist, ok bool) {
+	if folder := c.Query("musicFolderId"); folder != "" && folder != "1" {
+		return []SubsonicSong{}, []SubsonicAlbum{}, []SubsonicArtist{}, true
+	}
+	limit := -1 // no limit
+	sizeParam := c.DefaultQuery("size", c.Query("count"))
+	if size, err := strconv.Atoi(sizeParam); err == nil && size >= 0 {
+		limit = size
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
 	// Get starred songs (deduplicated by song_id in case of duplicate starred_songs entries)
 	query := `
 		SELECT s.id, s.title, s.artist, s.album, s.path, s.play_count, s.last_played, COALESCE(s.genre, '') as genre, COALESCE(s.duration, 0) as duration,
 			COALESCE(s.album_artist, ''), COALESCE(s.date_added, ''),
 			s.replaygain_track_gain, s.replaygain_track_peak, s.replaygain_album_gain, s.replaygain_album_peak,
-			(SELECT MIN(s2.id) FROM songs s2 WHERE s2.album_path = s.album_path AND s2.cancelled = 0) AS album_id,
+			COALESCE(s.album_path, '') AS album_path,
 			COALESCE(s.track, 0), COALESCE(s.year, 0), COALESCE(s.disc_number, 0),
 			COALESCE(s.size, 0), COALESCE(s.bitrate, 0), COALESCE(s.sample_rate, 0), COALESCE(s.channels, 0), COALESCE(s.bit_depth, 0), COALESCE(s.comment, '')
 		FROM songs s
@@ -1649,10 +1929,11 @@ func collectStarred(c *gin.Context, user User) (songsOut []SubsonicSong, albumsO
 			GROUP BY song_id
 		) ss ON s.id = ss.song_id
 		WHERE s.cancelled = 0
-		ORDER BY ss.starred_at DESC
+		ORDER BY ss.starred_at DESC, s.id
+		LIMIT ? OFFSET ?
 	`
 
-	rows, err := db.Query(query, user.ID)
+	rows, err := db.Query(query, user.ID, limit, offset)
 	if err != nil {
 		log.Printf("Starred songs query error: %v", err)
 		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error."))
@@ -1663,11 +1944,11 @@ func collectStarred(c *gin.Context, user User) (songsOut []SubsonicSong, albumsO
 	var songs []SubsonicSong
 	for rows.Next() {
 		var r SongResult
-		var lastPlayed, genreVal, albumArtist, created, albumID sql.NullString
+		var lastPlayed, genreVal, albumArtist, created, albumPath sql.NullString
 		var rgTrackGain, rgTrackPeak, rgAlbumGain, rgAlbumPeak sql.NullFloat64
 		var trackInt, yearInt, discInt sql.NullInt64
 		err := rows.Scan(&r.ID, &r.Title, &r.Artist, &r.Album, &r.Path, &r.PlayCount, &lastPlayed, &genreVal, &r.Duration,
-			&albumArtist, &created, &rgTrackGain, &rgTrackPeak, &rgAlbumGain, &rgAlbumPeak, &albumID,
+			&albumArtist, &created, &rgTrackGain, &rgTrackPeak, &rgAlbumGain, &rgAlbumPeak, &albumPath,
 			&trackInt, &yearInt, &discInt,
 			&r.Size, &r.BitRate, &r.SamplingRate, &r.ChannelCount, &r.BitDepth, &r.Comment)
 		if err != nil {
@@ -1689,9 +1970,7 @@ func collectStarred(c *gin.Context, user User) (songsOut []SubsonicSong, albumsO
 		if created.Valid {
 			r.Created = created.String
 		}
-		if albumID.Valid {
-			r.AlbumID = albumID.String
-		}
+		r.AlbumID = AlbumID(r.Album, albumPath.String)
 		r.Starred = true
 		r.ReplayGain = newReplayGain(rgTrackGain, rgTrackPeak, rgAlbumGain, rgAlbumPeak)
 		songs = append(songs, buildSubsonicSong(r))
@@ -1699,11 +1978,10 @@ func collectStarred(c *gin.Context, user User) (songsOut []SubsonicSong, albumsO
 
 	// Get starred albums
 	albumQuery := `
-		SELECT s.album, s.artist, COALESCE(s.genre, ''), sa.album_id
+		SELECT al.name, al.artist, al.genre, sa.album_id
 		FROM starred_albums sa
-		INNER JOIN songs s ON sa.album_id = s.id
+		INNER JOIN albums al ON al.id = sa.album_id
 		WHERE sa.user_id = ?
-		GROUP BY sa.album_id
 		ORDER BY sa.starred_at DESC
 	`
 
@@ -1769,6 +2047,7 @@ func subsonicGetStarred(c *gin.Context) {
 	if !ok {
 		return
 	}
+	applySongRatings(user.ID, songs)
 	subsonicRespond(c, newSubsonicResponse(&SubsonicStarred{
 		Artists: artists,
 		Albums:  albums,
@@ -1783,6 +2062,7 @@ func subsonicGetStarred2(c *gin.Context) {
 	if !ok {
 		return
 	}
+	applySongRatings(user.ID, songs)
 	subsonicRespond(c, newSubsonicResponse(&SubsonicStarred2{
 		Songs:   songs,
 		Albums:  albums,
@@ -1795,6 +2075,16 @@ func subsonicGetGenres(c *gin.Context) {
 	user := c.MustGet("user").(User)
 	log.Printf("subsonicGetGenres called by user: %s", user.Username)
 
+	body, err := cachedBrowse(browseCacheGenres, func() (interface{}, error) { return loadGenres() })
+	if err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error."))
+		return
+	}
+	subsonicRespond(c, newSubsonicResponse(body.(*SubsonicGenres)))
+}
+
+// loadGenres builds the getGenres body with per-genre song and album counts.
+func loadGenres() (*SubsonicGenres, error) {
 	// First, let's check if we have any songs at all
 	var totalSongs int
 	err := db.QueryRow("SELECT COUNT(*) FROM songs WHERE cancelled = 0").Scan(&totalSongs)
@@ -1824,8 +2114,7 @@ func subsonicGetGenres(c *gin.Context) {
 	rows, err := db.Query(query)
 	if err != nil {
 		log.Printf("Genre query error: %v", err)
-		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error."))
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -1857,9 +2146,7 @@ func subsonicGetGenres(c *gin.Context) {
 		})
 	}
 
-	genreList := &SubsonicGenres{Genres: genres}
-	log.Printf("About to respond with genres: %+v", genreList)
-	subsonicRespond(c, newSubsonicResponse(genreList))
+	return &SubsonicGenres{Genres: genres}, nil
 }
 
 // subsonicGetSongsByGenre handles the getSongsByGenre.view API endpoint
@@ -1905,7 +2192,7 @@ func subsonicGetSongsByGenre(c *gin.Context) {
 		SELECT s.id, s.title, s.artist, s.album, s.path, s.play_count, s.last_played, COALESCE(s.genre, ''), s.duration,
 		       COALESCE(s.album_artist, ''), COALESCE(s.date_added, ''),
 		       s.replaygain_track_gain, s.replaygain_track_peak, s.replaygain_album_gain, s.replaygain_album_peak,
-		       (SELECT MIN(s2.id) FROM songs s2 WHERE s2.album_path = s.album_path AND s2.cancelled = 0) AS album_id,
+		       COALESCE(s.album_path, '') AS album_path,
 		       COALESCE(s.track, 0), COALESCE(s.year, 0), COALESCE(s.disc_number, 0),
 		       COALESCE(s.size, 0), COALESCE(s.bitrate, 0), COALESCE(s.sample_rate, 0), COALESCE(s.channels, 0), COALESCE(s.bit_depth, 0), COALESCE(s.comment, ''),
 		       CASE WHEN ss.song_id IS NOT NULL THEN 1 ELSE 0 END as starred
@@ -1932,14 +2219,14 @@ func subsonicGetSongsByGenre(c *gin.Context) {
 	var songs []SubsonicSong
 	for rows.Next() {
 		var r SongResult
-		var lastPlayed, genreVal, albumArtist, created, albumID sql.NullString
+		var lastPlayed, genreVal, albumArtist, created, albumPath sql.NullString
 		var rgTrackGain, rgTrackPeak, rgAlbumGain, rgAlbumPeak sql.NullFloat64
 		var trackInt, yearInt, discInt sql.NullInt64
 		var starred int
 
 		if err := rows.Scan(&r.ID, &r.Title, &r.Artist, &r.Album,
 			&r.Path, &r.PlayCount, &lastPlayed, &genreVal, &r.Duration,
-			&albumArtist, &created, &rgTrackGain, &rgTrackPeak, &rgAlbumGain, &rgAlbumPeak, &albumID,
+			&albumArtist, &created, &rgTrackGain, &rgTrackPeak, &rgAlbumGain, &rgAlbumPeak, &albumPath,
 			&trackInt, &yearInt, &discInt,
 			&r.Size, &r.BitRate, &r.SamplingRate, &r.ChannelCount, &r.BitDepth, &r.Comment, &starred); err != nil {
 			log.Printf("[ERROR] getSongsByGenre: Scan failed: %v", err)
@@ -1960,9 +2247,7 @@ func subsonicGetSongsByGenre(c *gin.Context) {
 		if created.Valid {
 			r.Created = created.String
 		}
-		if albumID.Valid {
-			r.AlbumID = albumID.String
-		}
+		r.AlbumID = AlbumID(r.Album, albumPath.String)
 		r.Starred = starred == 1
 		r.ReplayGain = newReplayGain(rgTrackGain, rgTrackPeak, rgAlbumGain, rgAlbumPeak)
 
@@ -1974,6 +2259,7 @@ func subsonicGetSongsByGenre(c *gin.Context) {
 		songs = []SubsonicSong{}
 	}
 
+	applySongRatings(user.ID, songs)
 	log.Printf("[DEBUG] getSongsByGenre: Found %d songs for genre '%s'", len(songs), genre)
 
 	result := &SubsonicSongsByGenre{Songs: songs}
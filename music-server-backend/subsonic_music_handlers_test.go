@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStreamTimeOffsetSkipsIntoDirectStream(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+
+	content := bytes.Repeat([]byte("0123456789"), 100) // 1000 bytes
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO songs (id, title, artist, album, path, duration, play_count, cancelled) VALUES ('s1', 'T', 'A', 'X', ?, 10, 0, 0)`, path); err != nil {
+		t.Fatalf("seed song: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	stream := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/rest/stream.view?"+query, nil)
+		c.Set("user", User{ID: 1, Username: "test"})
+		subsonicStream(c)
+		return w
+	}
+
+	w := stream("id=s1&timeOffset=4")
+	if !bytes.Equal(w.Body.Bytes(), content[400:]) {
+		t.Fatalf("expected stream to start at byte 400, got %d bytes", w.Body.Len())
+	}
+	if got := w.Header().Get("X-Content-Duration"); got != "6" {
+		t.Fatalf("X-Content-Duration should be the remaining 6s, got %q", got)
+	}
+
+	if w := stream("id=s1"); w.Body.Len() != len(content) || w.Header().Get("X-Content-Duration") != "10" {
+		t.Fatalf("stream without offset should send the whole file, got %d bytes", w.Body.Len())
+	}
+	if w := stream("id=s1&timeOffset=-3&f=json"); !bytes.Contains(w.Body.Bytes(), []byte(`"code":10`)) {
+		t.Fatalf("negative timeOffset should be rejected: %s", w.Body.String())
+	}
+}
+
+func TestUseAlbumArtistGroupsArtistBrowsing(t *testing.T) {
+	testDB := fileSearchTestDB(t)
+	defer testDB.Close()
+	old := db
+	db = testDB
+	defer func() { db = old }()
+
+	for _, s := range []string{
+		`CREATE TABLE configuration (key TEXT PRIMARY KEY NOT NULL, value TEXT)`,
+		`INSERT INTO songs (id, title, artist, album, album_artist, album_path) VALUES ('s1', 'Thunderstruck', '2Cellos', 'Celloverse', '2Cellos', '/m/cv')`,
+		`INSERT INTO songs (id, title, artist, album, album_artist, album_path) VALUES ('s2', 'Live and Let Die', '2Cellos feat. X', 'Celloverse', '2Cellos', '/m/cv')`,
+	} {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+	if err := RebuildLibraryIndex(db); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	names := func() map[string]int {
+		body, err := loadArtistsIndex()
+		if err != nil {
+			t.Fatalf("loadArtistsIndex: %v", err)
+		}
+		out := map[string]int{}
+		for _, idx := range body.Index {
+			for _, a := range idx.Artists {
+				out[a.Name] = a.SongCount
+			}
+		}
+		return out
+	}
+
+	if got := names(); len(got) != 2 {
+		t.Fatalf("by default getArtists should list both track artists, got %v", got)
+	}
+	if n, _ := CountArtists(db, "", UseAlbumArtist(db)); n != 2 {
+		t.Fatalf("expected 2 artists by default, got %d", n)
+	}
+
+	if err := SetConfig(db, "use_album_artist", "true"); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(); len(got) != 1 || got["2Cellos"] != 2 {
+		t.Fatalf("use_album_artist should group by album artist, got %v", got)
+	}
+	indexes, err := loadIndexes()
+	if err != nil || len(indexes.Indices) != 1 || len(indexes.Indices[0].Artists) != 1 ||
+		indexes.Indices[0].Artists[0].ID != GenerateArtistID("2Cellos") {
+		t.Fatalf("getIndexes should follow use_album_artist, got %+v (%v)", indexes, err)
+	}
+	if n, _ := CountArtists(db, "", UseAlbumArtist(db)); n != 1 {
+		t.Fatalf("expected 1 artist with use_album_artist, got %d", n)
+	}
+}
+
+func TestShouldTranscodeReasons(t *testing.T) {
+	scanTestDB(t)
+
+	cases := []struct {
+		source    AudioInfo
+		transcode bool
+		reason    string
+	}{
+		{AudioInfo{Format: "flac", Bitrate: 900}, true, "lossless source"},
+		{AudioInfo{Format: "mp3", Bitrate: 0}, true, "source bitrate unknown"},
+		{AudioInfo{Format: "mp3", Bitrate: 128}, false, "source bitrate within target"},
+		{AudioInfo{Format: "mp3", Bitrate: 320}, true, "source bitrate above target"},
+		{AudioInfo{Format: "ogg", Bitrate: 96}, true, "format differs from target"},
+	}
+	for _, tc := range cases {
+		if transcode, reason := shouldTranscode(&tc.source, "mp3", 192); transcode != tc.transcode || reason != tc.reason {
+			t.Errorf("%+v: got %v %q, want %v %q", tc.source, transcode, reason, tc.transcode, tc.reason)
+		}
+	}
+
+	if _, err := db.Exec(`INSERT INTO configuration (key, value) VALUES ('allow_lossless_direct', 'true')`); err != nil {
+		t.Fatal(err)
+	}
+	if transcode, reason := shouldTranscode(&AudioInfo{Format: "flac"}, "mp3", 192); transcode || reason != "lossless direct play allowed" {
+		t.Errorf("allow_lossless_direct should let FLAC through, got %v %q", transcode, reason)
+	}
+}
+
+func TestDirectStreamReportsDecision(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+
+	path := filepath.Join(t.TempDir(), "track.FLAC")
+	if err := os.WriteFile(path, []byte("lossless"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO songs (id, title, artist, album, path, duration, play_count, cancelled, bitrate) VALUES ('s1', 'T', 'A', 'X', ?, 10, 0, 0, 1411)`, path); err != nil {
+		t.Fatalf("seed song: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/rest/stream.view?id=s1", nil)
+	c.Set("user", User{ID: 1, Username: "test"})
+	subsonicStream(c)
+
+	want := map[string]string{
+		"X-Stream-Decision": "direct",
+		"X-Stream-Reason":   "transcoding disabled",
+		"X-Source-Format":   "flac",
+		"X-Source-Bitrate":  "1411",
+	}
+	for header, value := range want {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+	}
+}
+
+func TestGetSongsKeepsRequestOrder(t *testing.T) {
+	d := scanTestDB(t)
+	for _, id := range []string{"a", "b", "c"} {
+		if _, err := d.Exec(`INSERT INTO songs (id, title, artist, album, path) VALUES (?, ?, 'Band', 'X', ?)`, id, "Song "+id, "/m/"+id+".mp3"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp := callHandler(t, subsonicGetSongs, "id=c&id=missing&id=a&id=c")
+	songs, _ := resp["songs"].(map[string]interface{})["song"].([]interface{})
+	var got []string
+	for _, s := range songs {
+		got = append(got, s.(map[string]interface{})["id"].(string))
+	}
+	if strings.Join(got, ",") != "c,a,c" {
+		t.Errorf("getSongs = %v, want c,a,c", got)
+	}
+}
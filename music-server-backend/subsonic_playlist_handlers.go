@@ -4,6 +4,7 @@ package main
 import (
 	"database/sql"
 	"log"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -14,15 +15,16 @@ func subsonicGetPlaylists(c *gin.Context) {
 	user := c.MustGet("user").(User)
 	_ = user // Auth is handled by middleware
 
-	// Return playlists owned by the user and also playlists created by admin users (visible to all)
+	// Return playlists owned by the user, playlists created by admin users and
+	// playlists other users have marked public (all visible to everyone)
 	query := `
-		SELECT p.id, p.name, COUNT(CASE WHEN s.cancelled = 0 THEN 1 END), u.username, u.is_admin
+		SELECT p.id, p.name, COUNT(CASE WHEN s.cancelled = 0 THEN 1 END), u.username, u.is_admin, COALESCE(p.public, 0)
 		FROM playlists p
 		LEFT JOIN playlist_songs ps ON p.id = ps.playlist_id
 		LEFT JOIN songs s ON ps.song_id = s.id
 		JOIN users u ON u.id = p.user_id
-		WHERE p.user_id = ? OR u.is_admin = 1
-		GROUP BY p.id, p.name, u.username, u.is_admin
+		WHERE p.user_id = ? OR u.is_admin = 1 OR p.public = 1
+		GROUP BY p.id, p.name, u.username, u.is_admin, p.public
 		ORDER BY p.name
 	`
 	rows, err := db.Query(query, user.ID)
@@ -35,18 +37,43 @@ func subsonicGetPlaylists(c *gin.Context) {
 	var playlists []SubsonicPlaylist
 	for rows.Next() {
 		var p SubsonicPlaylist
+		var id int
 		var ownerUsername string
-		var ownerIsAdmin bool
-		if err := rows.Scan(&p.ID, &p.Name, &p.SongCount, &ownerUsername, &ownerIsAdmin); err != nil {
+		var ownerIsAdmin, isPublic bool
+		if err := rows.Scan(&id, &p.Name, &p.SongCount, &ownerUsername, &ownerIsAdmin, &isPublic); err != nil {
 			log.Printf("Error scanning playlist row: %v", err)
 			continue
 		}
+		p.ID = playlistID(strconv.Itoa(id))
 		p.Owner = ownerUsername
-		// Mark playlists created by admin users as public/visible
-		p.Public = ownerIsAdmin
+		// Playlists created by admin users are always visible to everyone
+		p.Public = ownerIsAdmin || isPublic
 		playlists = append(playlists, p)
 	}
 
+	smartLists, err := visibleSmartPlaylists(user.ID)
+	if err != nil {
+		log.Printf("Error fetching smart playlists: %v", err)
+	}
+	for _, sp := range smartLists {
+		count, duration, err := smartPlaylistSummary(sp, user.ID)
+		if err != nil {
+			log.Printf("Error evaluating smart playlist %d: %v", sp.ID, err)
+			continue
+		}
+		playlists = append(playlists, SubsonicPlaylist{
+			ID:        playlistID(sp.subsonicID()),
+			Name:      sp.Name,
+			Owner:     sp.owner,
+			Public:    sp.ownerIsAdmin || sp.Public,
+			SongCount: count,
+			Duration:  duration,
+		})
+	}
+	if len(smartLists) > 0 {
+		sort.SliceStable(playlists, func(i, j int) bool { return playlists[i].Name < playlists[j].Name })
+	}
+
 	// Ensure playlists is never nil for proper JSON marshaling
 	if playlists == nil {
 		playlists = []SubsonicPlaylist{}
@@ -64,73 +91,42 @@ func subsonicGetPlaylist(c *gin.Context) {
 		subsonicRespond(c, newSubsonicErrorResponse(10, "Missing required parameter 'id'"))
 		return
 	}
+	if strings.HasPrefix(playlistID, smartPlaylistIDPrefix) {
+		subsonicGetSmartPlaylist(c, user, playlistID)
+		return
+	}
 
-	// Allow viewing the playlist if the requester is the owner OR the playlist was created by an admin
+	// Allow viewing the playlist if the requester is the owner, the playlist was created by an admin,
+	// or the owner marked it public
 	var playlistName string
 	var ownerUsername string
-	var ownerIsAdmin bool
+	var ownerIsAdmin, isPublic bool
 	err := db.QueryRow(
-		"SELECT p.name, u.username, u.is_admin FROM playlists p JOIN users u ON p.user_id = u.id WHERE p.id = ? AND (p.user_id = ? OR u.is_admin = 1)",
+		"SELECT p.name, u.username, u.is_admin, COALESCE(p.public, 0) FROM playlists p JOIN users u ON p.user_id = u.id WHERE p.id = ? AND (p.user_id = ? OR u.is_admin = 1 OR p.public = 1)",
 		playlistID, user.ID,
-	).Scan(&playlistName, &ownerUsername, &ownerIsAdmin)
+	).Scan(&playlistName, &ownerUsername, &ownerIsAdmin, &isPublic)
 	if err != nil {
 		subsonicRespond(c, newSubsonicErrorResponse(70, "Playlist not found."))
 		return
 	}
 
-	query := `
-		SELECT s.id, s.title, s.artist, s.album, s.path, s.play_count, s.last_played, COALESCE(s.genre, ''), s.duration,
-			COALESCE(s.album_artist, ''), COALESCE(s.date_added, ''),
-			s.replaygain_track_gain, s.replaygain_track_peak, s.replaygain_album_gain, s.replaygain_album_peak,
-			(SELECT MIN(s2.id) FROM songs s2 WHERE s2.album_path = s.album_path AND s2.cancelled = 0) AS album_id,
-			COALESCE(s.track, 0), COALESCE(s.year, 0), COALESCE(s.disc_number, 0),
-			COALESCE(s.size, 0), COALESCE(s.bitrate, 0), COALESCE(s.sample_rate, 0), COALESCE(s.channels, 0), COALESCE(s.bit_depth, 0), COALESCE(s.comment, '')
-		FROM songs s
-		JOIN playlist_songs ps ON s.id = ps.song_id
-		WHERE ps.playlist_id = ? AND s.cancelled = 0
-		ORDER BY ps.position ASC
-	`
-	rows, err := db.Query(query, playlistID)
+	id, err := strconv.Atoi(playlistID)
 	if err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(70, "Playlist not found."))
+		return
+	}
+	results, err := GetPlaylistSongs(db, id, user.ID)
+	if err != nil {
+		log.Printf("Error fetching songs for playlist %s: %v", playlistID, err)
 		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error fetching playlist songs."))
 		return
 	}
-	defer rows.Close()
 
-	var songs []SubsonicSong
-	for rows.Next() {
-		var r SongResult
-		var lastPlayed, genreVal, albumArtist, created, albumID sql.NullString
-		var rgTrackGain, rgTrackPeak, rgAlbumGain, rgAlbumPeak sql.NullFloat64
-		var trackInt, yearInt, discInt sql.NullInt64
-		if err := rows.Scan(&r.ID, &r.Title, &r.Artist, &r.Album, &r.Path, &r.PlayCount, &lastPlayed, &genreVal, &r.Duration,
-			&albumArtist, &created, &rgTrackGain, &rgTrackPeak, &rgAlbumGain, &rgAlbumPeak, &albumID,
-			&trackInt, &yearInt, &discInt,
-			&r.Size, &r.BitRate, &r.SamplingRate, &r.ChannelCount, &r.BitDepth, &r.Comment); err != nil {
-			log.Printf("Error scanning playlist song row: %v", err)
-			continue
-		}
-		r.Track = int(trackInt.Int64)
-		r.Year = int(yearInt.Int64)
-		r.DiscNumber = int(discInt.Int64)
-		if lastPlayed.Valid {
-			r.LastPlayed = lastPlayed.String
-		}
-		if genreVal.Valid {
-			r.Genre = genreVal.String
-		}
-		if albumArtist.Valid {
-			r.AlbumArtist = albumArtist.String
-		}
-		if created.Valid {
-			r.Created = created.String
-		}
-		if albumID.Valid {
-			r.AlbumID = albumID.String
-		}
-		r.ReplayGain = newReplayGain(rgTrackGain, rgTrackPeak, rgAlbumGain, rgAlbumPeak)
+	songs := make([]SubsonicSong, 0, len(results))
+	for _, r := range results {
 		songs = append(songs, buildSubsonicSong(r))
 	}
+	applySongRatings(user.ID, songs)
 
 	totalDuration := 0
 	for _, s := range songs {
@@ -141,7 +137,7 @@ func subsonicGetPlaylist(c *gin.Context) {
 		ID:        playlistID,
 		Name:      playlistName,
 		Owner:     ownerUsername,
-		Public:    ownerIsAdmin, // admin-owned playlists are visible to all users
+		Public:    ownerIsAdmin || isPublic, // admin-owned playlists are visible to all users
 		SongCount: len(songs),
 		Duration:  totalDuration,
 		Entries:   songs,
@@ -149,6 +145,45 @@ func subsonicGetPlaylist(c *gin.Context) {
 	subsonicRespond(c, newSubsonicResponse(responseBody))
 }
 
+// subsonicGetSmartPlaylist answers getPlaylist for a smart playlist by
+// evaluating its rules.
+func subsonicGetSmartPlaylist(c *gin.Context, user User, playlistID string) {
+	sp, err := visibleSmartPlaylist(playlistID, user.ID)
+	if err == sql.ErrNoRows {
+		subsonicRespond(c, newSubsonicErrorResponse(70, "Playlist not found."))
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading smart playlist %s: %v", playlistID, err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error fetching playlist."))
+		return
+	}
+	results, err := smartPlaylistSongs(sp, user.ID)
+	if err != nil {
+		log.Printf("Error evaluating smart playlist %s: %v", playlistID, err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error fetching playlist songs."))
+		return
+	}
+
+	songs := make([]SubsonicSong, 0, len(results))
+	totalDuration := 0
+	for _, r := range results {
+		song := buildSubsonicSong(r)
+		totalDuration += song.Duration
+		songs = append(songs, song)
+	}
+	applySongRatings(user.ID, songs)
+	subsonicRespond(c, newSubsonicResponse(&SubsonicPlaylistWithSongs{
+		ID:        playlistID,
+		Name:      sp.Name,
+		Owner:     sp.owner,
+		Public:    sp.ownerIsAdmin || sp.Public,
+		SongCount: len(songs),
+		Duration:  totalDuration,
+		Entries:   songs,
+	}))
+}
+
 func subsonicCreatePlaylist(c *gin.Context) {
 	user := c.MustGet("user").(User)
 	_ = user // Auth is handled by middleware
@@ -175,7 +210,15 @@ func subsonicCreatePlaylist(c *gin.Context) {
 	}
 	newID, _ := res.LastInsertId()
 
+	added := 0
 	if len(songIds) > 0 {
+		nextPos, err := nextPlaylistPosition(tx, newID)
+		if err != nil {
+			tx.Rollback()
+			subsonicRespond(c, newSubsonicErrorResponse(0, "Error reading playlist positions."))
+			return
+		}
+
 		stmt, err := tx.Prepare("INSERT INTO playlist_songs (playlist_id, song_id, position) VALUES (?, ?, ?)")
 		if err != nil {
 			tx.Rollback()
@@ -184,13 +227,17 @@ func subsonicCreatePlaylist(c *gin.Context) {
 		}
 		defer stmt.Close()
 
-		for i, songID := range songIds {
-			if _, err := stmt.Exec(newID, songID, i); err != nil {
+		for _, songID := range songIds {
+			if songID == "" {
+				continue
+			}
+			if _, err := stmt.Exec(newID, songID, nextPos+added); err != nil {
 				tx.Rollback()
 				log.Printf("Error adding song %s to new playlist %d: %v", songID, newID, err)
 				subsonicRespond(c, newSubsonicErrorResponse(0, "Error adding a song to the playlist."))
 				return
 			}
+			added++
 		}
 	}
 
@@ -200,11 +247,11 @@ func subsonicCreatePlaylist(c *gin.Context) {
 	}
 
 	createdPlaylist := SubsonicPlaylist{
-		ID:        int(newID),
+		ID:        playlistID(strconv.FormatInt(newID, 10)),
 		Name:      playlistName,
 		Owner:     user.Username,
 		Public:    false,
-		SongCount: len(songIds),
+		SongCount: added,
 	}
 
 	response := newSubsonicResponse(&createdPlaylist)
@@ -217,8 +264,12 @@ func subsonicUpdatePlaylist(c *gin.Context) {
 
 	playlistID := c.Query("playlistId")
 	newName := c.Query("name")
+	publicParam := c.Query("public")
 	songIdsToAdd := c.QueryArray("songIdToAdd")
 	songIndicesToRemoveStr := c.QueryArray("songIndexToRemove")
+	// Non-standard: removeDuplicates=true drops repeated songs, keeping the
+	// first occurrence of each.
+	removeDuplicates := c.Query("removeDuplicates") == "true"
 
 	// Correctly parse comma-separated list for full playlist updates
 	songIdParam := c.Query("songId")
@@ -244,6 +295,7 @@ func subsonicUpdatePlaylist(c *gin.Context) {
 	// Permission rules:
 	// - The playlist owner can update their own playlists.
 	// - If the playlist owner is an admin, only other admins may edit/delete it.
+	// - Public playlists owned by someone else are read-only.
 	if ownerId != user.ID {
 		if ownerIsAdmin && user.IsAdmin {
 			// allow: admin editing another admin's playlist
@@ -269,8 +321,21 @@ func subsonicUpdatePlaylist(c *gin.Context) {
 		}
 	}
 
-	// If no song modifications are requested, commit potential name change and exit
-	if len(fullSongIdList) == 0 && len(songIdsToAdd) == 0 && len(songIndicesToRemoveStr) == 0 {
+	if publicParam != "" {
+		isPublic, err := strconv.ParseBool(publicParam)
+		if err != nil {
+			subsonicRespond(c, newSubsonicErrorResponse(10, "Invalid value for parameter 'public'"))
+			return
+		}
+		if _, err := tx.Exec("UPDATE playlists SET public = ? WHERE id = ?", isPublic, playlistID); err != nil {
+			log.Printf("Error updating public flag of playlist %s: %v", playlistID, err)
+			subsonicRespond(c, newSubsonicErrorResponse(0, "Error updating playlist visibility."))
+			return
+		}
+	}
+
+	// If no song modifications are requested, commit potential name/visibility change and exit
+	if len(fullSongIdList) == 0 && len(songIdsToAdd) == 0 && len(songIndicesToRemoveStr) == 0 && !removeDuplicates {
 		if err := tx.Commit(); err != nil {
 			subsonicRespond(c, newSubsonicErrorResponse(0, "Error committing playlist changes."))
 		} else {
@@ -324,6 +389,9 @@ func subsonicUpdatePlaylist(c *gin.Context) {
 		currentSongIds = append(currentSongIds, songIdsToAdd...)
 		finalSongIds = currentSongIds
 	}
+	if removeDuplicates {
+		finalSongIds = uniqueSongIDs(finalSongIds)
+	}
 
 	// Atomically update the playlist songs
 	_, err = tx.Exec("DELETE FROM playlist_songs WHERE playlist_id = ?", playlistID)
@@ -333,6 +401,8 @@ func subsonicUpdatePlaylist(c *gin.Context) {
 	}
 
 	if len(finalSongIds) > 0 {
+		// The playlist was just emptied, so positions start again at 0.
+		nextPos := 0
 		stmt, err := tx.Prepare("INSERT INTO playlist_songs (playlist_id, song_id, position) VALUES (?, ?, ?)")
 		if err != nil {
 			subsonicRespond(c, newSubsonicErrorResponse(0, "Error preparing to update playlist songs."))
@@ -340,15 +410,17 @@ func subsonicUpdatePlaylist(c *gin.Context) {
 		}
 		defer stmt.Close()
 
-		for i, songID := range finalSongIds {
+		for _, songID := range finalSongIds {
 			// Ensure songID is not an empty string which can happen from trailing commas
-			if songID != "" {
-				if _, err := stmt.Exec(playlistID, songID, i); err != nil {
-					log.Printf("Error inserting song %s into playlist %s at position %d: %v", songID, playlistID, i, err)
-					subsonicRespond(c, newSubsonicErrorResponse(0, "Error inserting song into playlist."))
-					return
-				}
+			if songID == "" {
+				continue
+			}
+			if _, err := stmt.Exec(playlistID, songID, nextPos); err != nil {
+				log.Printf("Error inserting song %s into playlist %s at position %d: %v", songID, playlistID, nextPos, err)
+				subsonicRespond(c, newSubsonicErrorResponse(0, "Error inserting song into playlist."))
+				return
 			}
+			nextPos++
 		}
 	}
 
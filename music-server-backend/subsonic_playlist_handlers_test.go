@@ -0,0 +1,210 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupPlaylistTestDB extends the full test DB with the users/playlists tables
+// the Subsonic playlist handlers join against.
+func setupPlaylistTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn := setupFullTestDB(t)
+	stmts := []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT UNIQUE NOT NULL, is_admin BOOLEAN NOT NULL DEFAULT 0)`,
+		`CREATE TABLE playlists (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, user_id INTEGER, public INTEGER DEFAULT 0)`,
+		`CREATE TABLE playlist_songs (playlist_id INTEGER NOT NULL, song_id TEXT NOT NULL, position INTEGER NOT NULL)`,
+		`INSERT INTO users (id, username, is_admin) VALUES (1, 'test', 0)`,
+	}
+	for _, s := range stmts {
+		if _, err := conn.Exec(s); err != nil {
+			t.Fatalf("setup %q: %v", s, err)
+		}
+	}
+	return conn
+}
+
+func playlistPositions(t *testing.T, playlistID int) map[string]int {
+	t.Helper()
+	rows, err := db.Query(`SELECT song_id, position FROM playlist_songs WHERE playlist_id = ? ORDER BY position`, playlistID)
+	if err != nil {
+		t.Fatalf("query positions: %v", err)
+	}
+	defer rows.Close()
+	out := map[string]int{}
+	for rows.Next() {
+		var id string
+		var pos int
+		if err := rows.Scan(&id, &pos); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		out[id] = pos
+	}
+	return out
+}
+
+func TestCreateAndUpdatePlaylistAssignPositions(t *testing.T) {
+	db = setupPlaylistTestDB(t)
+	defer db.Close()
+
+	resp := callHandler(t, subsonicCreatePlaylist, "name=Mix&songId=a&songId=b&songId=")
+	pl, _ := resp["playlist"].(map[string]interface{})
+	if pl == nil || pl["songCount"].(float64) != 2 {
+		t.Fatalf("expected created playlist with 2 songs, got %v", resp)
+	}
+	idValue, ok := pl["id"].(float64)
+	if !ok {
+		t.Fatalf("playlist id %#v should be a JSON number", pl["id"])
+	}
+	id := int(idValue)
+
+	got := playlistPositions(t, id)
+	if len(got) != 2 || got["a"] != 0 || got["b"] != 1 {
+		t.Fatalf("unexpected positions after create: %v", got)
+	}
+
+	callHandler(t, subsonicUpdatePlaylist, "playlistId=1&songIdToAdd=c&songIndexToRemove=0")
+	got = playlistPositions(t, id)
+	if len(got) != 2 || got["b"] != 0 || got["c"] != 1 {
+		t.Fatalf("unexpected positions after update: %v", got)
+	}
+}
+
+func TestGetPlaylistReturnsSongsWithDurationAndStarred(t *testing.T) {
+	db = setupPlaylistTestDB(t)
+	defer db.Close()
+
+	stmts := []string{
+		`INSERT INTO songs (id, title, artist, album, album_path, path, duration, play_count, cancelled) VALUES ('s1', 'One', 'A', 'X', '/m/X', '/m/X/1.mp3', 120, 0, 0)`,
+		`INSERT INTO songs (id, title, artist, album, album_path, path, duration, play_count, cancelled) VALUES ('s2', 'Two', 'A', 'X', '/m/X', '/m/X/2.mp3', 80, 0, 0)`,
+		`INSERT INTO playlists (id, name, user_id) VALUES (1, 'P', 1)`,
+		`INSERT INTO playlist_songs (playlist_id, song_id, position) VALUES (1, 's2', 0), (1, 's1', 1)`,
+		`INSERT INTO starred_songs (user_id, song_id, starred_at) VALUES (1, 's1', '2024-01-01T00:00:00Z')`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+
+	pl, _ := callHandler(t, subsonicGetPlaylist, "id=1")["playlist"].(map[string]interface{})
+	if pl == nil {
+		t.Fatal("getPlaylist missing playlist element")
+	}
+	if pl["songCount"].(float64) != 2 || pl["duration"].(float64) != 200 {
+		t.Fatalf("unexpected playlist totals: %v", pl)
+	}
+	entries, _ := pl["entry"].([]interface{})
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", pl["entry"])
+	}
+	first := entries[0].(map[string]interface{})
+	second := entries[1].(map[string]interface{})
+	if first["id"] != "s2" || first["duration"].(float64) != 80 || first["coverArt"] != "s2" {
+		t.Fatalf("unexpected first entry: %v", first)
+	}
+	if _, ok := second["starred"]; !ok {
+		t.Fatalf("expected starred song to carry starred attribute: %v", second)
+	}
+}
+
+func TestPublicPlaylistsVisibleButReadOnlyForOthers(t *testing.T) {
+	db = setupPlaylistTestDB(t)
+	defer db.Close()
+
+	stmts := []string{
+		`INSERT INTO users (id, username, is_admin) VALUES (2, 'other', 0)`,
+		`INSERT INTO playlists (id, name, user_id) VALUES (1, 'Shared', 2), (2, 'Private', 2)`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+
+	// Owner (user 2) publishes playlist 1.
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/rest/updatePlaylist?playlistId=1&public=true&f=json", nil)
+	c.Set("user", User{ID: 2, Username: "other"})
+	subsonicUpdatePlaylist(c)
+	if !strings.Contains(w.Body.String(), `"status":"ok"`) {
+		t.Fatalf("owner could not publish playlist: %s", w.Body.String())
+	}
+
+	lists, _ := callHandler(t, subsonicGetPlaylists, "")["playlists"].(map[string]interface{})
+	items, _ := lists["playlist"].([]interface{})
+	if len(items) != 1 {
+		t.Fatalf("expected only the public playlist to be visible, got %v", lists)
+	}
+	if pl := items[0].(map[string]interface{}); pl["name"] != "Shared" || pl["public"] != true {
+		t.Fatalf("unexpected visible playlist: %v", pl)
+	}
+	if pl, _ := callHandler(t, subsonicGetPlaylist, "id=1")["playlist"].(map[string]interface{}); pl == nil || pl["name"] != "Shared" || pl["owner"] != "other" {
+		t.Fatalf("non-owner could not read the public playlist: %v", pl)
+	}
+
+	// Non-owner (user 1 via callHandler's context) must not be able to modify it.
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/rest/updatePlaylist?playlistId=1&name=Hijacked&f=json", nil)
+	c.Set("user", User{ID: 1, Username: "test"})
+	subsonicUpdatePlaylist(c)
+	if !strings.Contains(w.Body.String(), `"status":"failed"`) {
+		t.Fatalf("non-owner update of public playlist should fail: %s", w.Body.String())
+	}
+}
+
+func TestRemovePlaylistDuplicates(t *testing.T) {
+	db = setupPlaylistTestDB(t)
+	defer db.Close()
+
+	stmts := []string{
+		`INSERT INTO users (id, username, is_admin) VALUES (2, 'other', 0)`,
+		`INSERT INTO playlists (id, name, user_id) VALUES (1, 'Mine', 1), (2, 'Theirs', 2)`,
+		`INSERT INTO playlist_songs (playlist_id, song_id, position) VALUES
+			(1, 'a', 0), (1, 'b', 1), (1, 'a', 2), (1, 'c', 3), (1, 'b', 4),
+			(2, 'a', 0), (2, 'a', 1)`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+
+	r := gin.New()
+	r.POST("/playlist/:id/dedupe", func(c *gin.Context) { c.Set("userID", 1); dedupePlaylist(c) })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/playlist/1/dedupe", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"removed":2`) {
+		t.Fatalf("dedupe: %d %s", w.Code, w.Body.String())
+	}
+	got := playlistPositions(t, 1)
+	if len(got) != 3 || got["a"] != 0 || got["b"] != 1 || got["c"] != 2 {
+		t.Fatalf("positions after dedupe = %v", got)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/playlist/2/dedupe", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("dedupe of another user's playlist: %d", w.Code)
+	}
+
+	// updatePlaylist's removeDuplicates flag also applies to songs being added.
+	callHandler(t, subsonicUpdatePlaylist, "playlistId=1&songIdToAdd=c&songIdToAdd=d&removeDuplicates=true")
+	got = playlistPositions(t, 1)
+	if len(got) != 4 || got["c"] != 2 || got["d"] != 3 {
+		t.Fatalf("positions after updatePlaylist = %v", got)
+	}
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM playlist_songs WHERE playlist_id = 1`).Scan(&count)
+	if count != 4 {
+		t.Fatalf("playlist 1 has %d entries, want 4", count)
+	}
+}
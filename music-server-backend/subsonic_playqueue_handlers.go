@@ -0,0 +1,121 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- savePlayQueue / getPlayQueue -------------------------------------------
+
+// Each user has a single saved play queue, overwritten on every save, which
+// lets clients hand playback over between devices.
+
+// SubsonicPlayQueue is the getPlayQueue response.
+type SubsonicPlayQueue struct {
+	XMLName   xml.Name       `xml:"playQueue" json:"-"`
+	Current   string         `xml:"current,attr,omitempty" json:"current,omitempty"`
+	Position  int64          `xml:"position,attr" json:"position"`
+	Username  string         `xml:"username,attr" json:"username"`
+	Changed   string         `xml:"changed,attr" json:"changed"`
+	ChangedBy string         `xml:"changedBy,attr" json:"changedBy"`
+	Entries   []SubsonicSong `xml:"entry" json:"entry"`
+}
+
+func subsonicSavePlayQueue(c *gin.Context) {
+	user := c.MustGet("user").(User)
+
+	ids := c.QueryArray("id")
+	if len(ids) == 0 {
+		// An empty queue clears the saved one.
+		if _, err := db.Exec(`DELETE FROM play_queue WHERE user_id = ?`, user.ID); err != nil {
+			log.Printf("Error clearing play queue for user %d: %v", user.ID, err)
+			subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to save play queue."))
+			return
+		}
+		subsonicRespond(c, newSubsonicResponse(nil))
+		return
+	}
+
+	current := c.Query("current")
+	var position int64
+	if p := c.Query("position"); p != "" {
+		var err error
+		position, err = strconv.ParseInt(p, 10, 64)
+		if err != nil || position < 0 {
+			subsonicRespond(c, newSubsonicErrorResponse(10, "Invalid position."))
+			return
+		}
+	}
+
+	songIDs, _ := json.Marshal(ids)
+	_, err := db.Exec(`INSERT INTO play_queue (user_id, song_ids, current, position_ms, changed_by, changed)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET song_ids = excluded.song_ids, current = excluded.current,
+			position_ms = excluded.position_ms, changed_by = excluded.changed_by, changed = excluded.changed`,
+		user.ID, string(songIDs), current, position, c.Query("c"), time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("Error saving play queue for user %d: %v", user.ID, err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to save play queue."))
+		return
+	}
+	subsonicRespond(c, newSubsonicResponse(nil))
+}
+
+func subsonicGetPlayQueue(c *gin.Context) {
+	user := c.MustGet("user").(User)
+
+	var songIDsJSON, current, changedBy, changed string
+	var position int64
+	err := db.QueryRow(`SELECT song_ids, COALESCE(current, ''), position_ms, COALESCE(changed_by, ''), changed
+		FROM play_queue WHERE user_id = ?`, user.ID).Scan(&songIDsJSON, &current, &position, &changedBy, &changed)
+	if err == sql.ErrNoRows {
+		// No saved queue: an empty response is what clients expect.
+		subsonicRespond(c, newSubsonicResponse(nil))
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading play queue for user %d: %v", user.ID, err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error fetching play queue."))
+		return
+	}
+
+	var ids []string
+	if err := json.Unmarshal([]byte(songIDsJSON), &ids); err != nil {
+		log.Printf("Corrupt play queue for user %d: %v", user.ID, err)
+	}
+	songs, err := getSongsByIDs(ids)
+	if err != nil {
+		log.Printf("Error resolving play queue songs for user %d: %v", user.ID, err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error fetching play queue."))
+		return
+	}
+	byID := make(map[string]SubsonicSong, len(songs))
+	for _, s := range songs {
+		byID[s.ID] = s
+	}
+	// Keep the saved order (and repeated entries); drop songs that are gone.
+	entries := make([]SubsonicSong, 0, len(ids))
+	for _, id := range ids {
+		if s, ok := byID[id]; ok {
+			entries = append(entries, s)
+		}
+	}
+	if _, ok := byID[current]; !ok {
+		current, position = "", 0
+	}
+
+	subsonicRespond(c, newSubsonicResponse(&SubsonicPlayQueue{
+		Current:   current,
+		Position:  position,
+		Username:  user.Username,
+		Changed:   changed,
+		ChangedBy: changedBy,
+		Entries:   entries,
+	}))
+}
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestSaveAndGetPlayQueue(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+	stmts := []string{
+		`CREATE TABLE play_queue (user_id INTEGER PRIMARY KEY NOT NULL, song_ids TEXT NOT NULL, current TEXT,
+			position_ms INTEGER NOT NULL DEFAULT 0, changed_by TEXT, changed TEXT NOT NULL)`,
+		`INSERT INTO songs (id, title, artist, album, album_path, path, duration, play_count, cancelled) VALUES
+			('s1', 'One', 'A', 'X', '/m/X', '/m/X/1.mp3', 100, 0, 0),
+			('s2', 'Two', 'A', 'X', '/m/X', '/m/X/2.mp3', 100, 0, 0)`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+
+	if _, ok := callHandler(t, subsonicGetPlayQueue, "")["playQueue"]; ok {
+		t.Fatal("expected no playQueue before anything is saved")
+	}
+
+	callHandler(t, subsonicSavePlayQueue, "id=s2&id=s1&id=s2&current=s1&position=4500&c=DSub")
+	pq, _ := callHandler(t, subsonicGetPlayQueue, "")["playQueue"].(map[string]interface{})
+	if pq == nil {
+		t.Fatal("getPlayQueue should return the saved queue")
+	}
+	if pq["current"] != "s1" || pq["position"] != float64(4500) || pq["changedBy"] != "DSub" || pq["username"] != "test" {
+		t.Fatalf("unexpected play queue attributes %v", pq)
+	}
+	entries, _ := pq["entry"].([]interface{})
+	var order []string
+	for _, e := range entries {
+		order = append(order, e.(map[string]interface{})["id"].(string))
+	}
+	if len(order) != 3 || order[0] != "s2" || order[1] != "s1" || order[2] != "s2" {
+		t.Fatalf("queue order not preserved: %v", order)
+	}
+
+	// Saving again overwrites the queue.
+	callHandler(t, subsonicSavePlayQueue, "id=s1")
+	pq, _ = callHandler(t, subsonicGetPlayQueue, "")["playQueue"].(map[string]interface{})
+	if entries, _ := pq["entry"].([]interface{}); len(entries) != 1 || pq["current"] != nil {
+		t.Fatalf("expected overwritten single-entry queue, got %v", pq)
+	}
+}
@@ -36,7 +36,7 @@ type SubsonicSearchResult3 struct {
 
 // subsonicSearch2 handles the search2 API endpoint (old tag format).
 func subsonicSearch2(c *gin.Context) {
-	_ = c.MustGet("user") // Auth is handled by middleware
+	user := c.MustGet("user").(User)
 
 	query := c.Query("query")
 	isShortQuery := len(query) < 3 // Show all items if query is less than 3 characters
@@ -49,7 +49,6 @@ func subsonicSearch2(c *gin.Context) {
 	songOffset, _ := strconv.Atoi(c.DefaultQuery("songOffset", "0"))
 
 	result := SubsonicSearchResult2{}
-	searchWords := strings.Fields(query)
 
 	// --- Count total results (not paginated) ---
 	// Count total artists (search artist field only)
@@ -59,12 +58,8 @@ func subsonicSearch2(c *gin.Context) {
 		if !isShortQuery && query != "" && query != "*" {
 			searchTerm = query
 		}
-		allArtists, err := QueryArtists(db, ArtistQueryOptions{
-			SearchTerm:    searchTerm,
-			IncludeCounts: false,
-		})
-		if err == nil {
-			result.ArtistCount = len(allArtists)
+		if cnt, err := CountArtists(db, searchTerm, UseAlbumArtist(db)); err == nil {
+			result.ArtistCount = cnt
 		}
 	}
 
@@ -99,10 +94,11 @@ func subsonicSearch2(c *gin.Context) {
 		}
 
 		artists, err := QueryArtists(db, ArtistQueryOptions{
-			SearchTerm:    searchTerm,
-			IncludeCounts: true,
-			Limit:         artistCount,
-			Offset:        artistOffset,
+			SearchTerm:         searchTerm,
+			UseEffectiveArtist: UseAlbumArtist(db),
+			IncludeCounts:      true,
+			Limit:              artistCount,
+			Offset:             artistOffset,
 		})
 		if err != nil {
 			log.Printf("[ERROR] subsonicSearch2: Artist query failed: %v", err)
@@ -147,36 +143,26 @@ func subsonicSearch2(c *gin.Context) {
 					continue
 				}
 				displayArtist := albumDisplayArtist(db, albumName, albumPath)
-				match := true
-				for _, word := range searchWords {
-					lw := strings.ToLower(word)
-					if !strings.Contains(strings.ToLower(albumName), lw) && !strings.Contains(strings.ToLower(displayArtist), lw) {
-						match = false
-						break
-					}
+				if !albumMatchesSearch(query, albumName, displayArtist) {
+					continue
 				}
-				if !match {
+				// One entry per album (see AlbumKey): same-named albums in
+				// different folders are distinct and are all listed.
+				key := AlbumKey(albumName, albumPath)
+				if _, ok := seen[key]; ok {
 					continue
 				}
-				key := normalizeKey(albumName)
 				candidate := SubsonicAlbum{ID: ar.AlbumID, Name: albumName, Artist: displayArtist, ArtistID: GenerateArtistID(displayArtist), Genre: ar.Genre, CoverArt: ar.AlbumID, SongCount: ar.SongCount, Duration: ar.Duration, Created: ar.Created}
 				decorateAlbum(&candidate)
-				if existing, ok := seen[key]; ok {
-					candIsAlbumArtist, _ := CheckAlbumHasAlbumArtist(db, albumName, albumPath)
-					existIsAlbumArtist, _ := CheckAlbumHasAlbumArtist(db, existing.Name, "")
-					if candIsAlbumArtist && !existIsAlbumArtist {
-						seen[key] = candidate
-					}
-				} else {
-					seen[key] = candidate
-					order = append(order, key)
-				}
+				seen[key] = candidate
+				order = append(order, key)
 			}
+			// Short queries were already paged by QueryAlbums.
 			start := albumOffset
-			end := start + albumCount
-			if start < 0 {
+			if start < 0 || isShortQuery {
 				start = 0
 			}
+			end := start + albumCount
 			if start > len(order) {
 				start = len(order)
 			}
@@ -198,7 +184,6 @@ func subsonicSearch2(c *gin.Context) {
 					album,
 					MIN(NULLIF(album_path, '')) as album_path,
 					COALESCE(genre, '') as genre,
-					MIN(id) as albumId,
 					COUNT(*) as song_count,
 					COALESCE(SUM(duration), 0) as total_duration,
 					MIN(date_added) as created
@@ -221,62 +206,42 @@ func subsonicSearch2(c *gin.Context) {
 				order := []string{}
 				for albumRows.Next() {
 					var albumName, albumPath, genre string
-					var albumID string
 					var songCount, totalDuration int
 					var created sql.NullString
-					if err := albumRows.Scan(&albumName, &albumPath, &genre, &albumID, &songCount, &totalDuration, &created); err == nil {
+					if err := albumRows.Scan(&albumName, &albumPath, &genre, &songCount, &totalDuration, &created); err == nil {
 						albumName = strings.TrimSpace(albumName)
 						albumPath = strings.TrimSpace(albumPath)
 						if albumName == "" && albumPath == "" {
 							continue
 						}
+						albumID := AlbumID(albumName, albumPath)
 						displayArtist := albumDisplayArtist(db, albumName, albumPath)
-						key := normalizeKey(albumName)
+						key := AlbumKey(albumName, albumPath)
+						if _, ok := seen[key]; ok {
+							continue
+						}
 						candidate := SubsonicAlbum{ID: albumID, Name: albumName, Artist: displayArtist, ArtistID: GenerateArtistID(displayArtist), Genre: genre, CoverArt: albumID, SongCount: songCount, Duration: totalDuration, Created: created.String}
 						decorateAlbum(&candidate)
-						if existing, ok := seen[key]; ok {
-							candIsAlbumArtist, _ := CheckAlbumHasAlbumArtist(db, albumName, albumPath)
-							existIsAlbumArtist, _ := CheckAlbumHasAlbumArtist(db, existing.Name, "")
-							if candIsAlbumArtist && !existIsAlbumArtist {
-								seen[key] = candidate
-							}
-						} else {
-							seen[key] = candidate
-							order = append(order, key)
-						}
+						seen[key] = candidate
+						order = append(order, key)
 					}
 				}
-				start := albumOffset
-				end := start + albumCount
-				if start < 0 {
-					start = 0
-				}
-				if start > len(order) {
-					start = len(order)
-				}
-				if end > len(order) {
-					end = len(order)
-				}
-				for _, k := range order[start:end] {
+				// Already paged by LIMIT/OFFSET.
+				for _, k := range order {
 					result.Albums = append(result.Albums, seen[k])
 				}
 			}
 		} else {
 			// For search terms: fetch matching songs and build albums from those song groups in Go
 			// This ensures the album listing is derived from the same candidate songs used for counting
-			var songConditions []string
-			var songArgs []interface{}
-			for _, word := range searchWords {
-				songConditions = append(songConditions, "(album LIKE ? OR artist LIKE ? OR album_artist LIKE ?)")
-				like := "%" + word + "%"
-				songArgs = append(songArgs, like, like, like)
-			}
+			songJoin, songCondition, songArgs := songSearchFilter(db, "songs", query, searchScopeAlbum)
 
 			songQuery := `
-				SELECT album, MIN(NULLIF(album_path, '')) as album_path, album_artist, artist, id, COALESCE(genre, '') as genre, COALESCE(duration, 0) as duration, COALESCE(date_added, '') as date_added
-				FROM songs
-				WHERE (` + strings.Join(songConditions, " AND ") + `) AND cancelled = 0
-				ORDER BY album COLLATE NOCASE, id`
+				SELECT songs.album, COALESCE(NULLIF(songs.album_path, ''), '') as album_path, COALESCE(songs.album_artist, '') as album_artist,
+					COALESCE(NULLIF(TRIM(songs.album_artist), ''), songs.artist, '') as effective_artist, songs.id, COALESCE(songs.genre, '') as genre, COALESCE(songs.duration, 0) as duration, COALESCE(songs.date_added, '') as date_added
+				FROM songs` + songJoin + `
+				WHERE ` + songCondition + ` AND songs.cancelled = 0
+				ORDER BY songs.album COLLATE NOCASE, songs.id`
 
 			rows, err := db.Query(songQuery, songArgs...)
 			if err != nil {
@@ -309,21 +274,13 @@ func subsonicSearch2(c *gin.Context) {
 					if albumName == "" && albumPath == "" {
 						continue
 					}
-					key := ""
-					if albumPath != "" {
-						key = albumPath + "|||" + albumName
-					} else {
-						key = albumName
-					}
+					key := AlbumKey(albumName, albumPath)
 					g := groups[key]
 					if g == nil {
-						g = &albumGroup{albumName: albumName, albumPath: albumPath, genre: strings.TrimSpace(genre), albumArts: make(map[string]bool), artists: make(map[string]bool)}
+						g = &albumGroup{albumName: albumName, albumPath: albumPath, albumID: AlbumID(albumName, albumPath), genre: strings.TrimSpace(genre), albumArts: make(map[string]bool), artists: make(map[string]bool)}
 						groups[key] = g
 						order = append(order, key)
 					}
-					if id != "" && g.albumID == "" {
-						g.albumID = id
-					}
 					if genre != "" && g.genre == "" {
 						g.genre = genre
 					}
@@ -340,9 +297,10 @@ func subsonicSearch2(c *gin.Context) {
 					}
 				}
 
-				// Build candidates and deduplicate by normalized album name, preferring album_artist-backed groups
+				// Build one candidate per album group (see AlbumKey). FTS also
+				// matches titles, so keep only albums whose name or artist matches.
 				seen := make(map[string]SubsonicAlbum)
-				orderKeys := []string{}
+				var orderKeys []string
 				for _, k := range order {
 					g := groups[k]
 					var artistList []string
@@ -361,18 +319,14 @@ func subsonicSearch2(c *gin.Context) {
 						displayArtist = strings.Join(artistList, "; ")
 					}
 
+					if !albumMatchesSearch(query, g.albumName, displayArtist) {
+						continue
+					}
+
 					candidate := SubsonicAlbum{ID: g.albumID, Name: g.albumName, Artist: displayArtist, ArtistID: GenerateArtistID(displayArtist), Genre: g.genre, CoverArt: g.albumID, SongCount: g.songCount, Duration: g.totalDuration, Created: g.minCreated}
 					decorateAlbum(&candidate)
-
-					nk := normalizeKey(g.albumName)
-					if existing, ok := seen[nk]; ok {
-						if len(g.albumArts) > 0 && (existing.Artist == "Unknown Artist" || existing.Artist == "") {
-							seen[nk] = candidate
-						}
-					} else {
-						seen[nk] = candidate
-						orderKeys = append(orderKeys, nk)
-					}
+					seen[k] = candidate
+					orderKeys = append(orderKeys, k)
 				}
 
 				// paginate ordered results
@@ -433,6 +387,7 @@ SKIP_OLD_ALBUM_QUERY:
 	if result.Songs == nil {
 		result.Songs = []SubsonicSong{}
 	}
+	applySongRatings(user.ID, result.Songs)
 
 	response := newSubsonicResponse(&result)
 	subsonicRespond(c, response)
@@ -462,13 +417,13 @@ func subsonicSearch3(c *gin.Context) {
 	// and de-duplicated in memory, which on a large library could pull hundreds of
 	// thousands of rows for a common term; the COUNT(DISTINCT ...) + FTS join keeps
 	// the work inside SQLite and returns a single number.
-	// Count total artists (artist tag only)
+	// Count total artists (artist tag, or album artist with use_album_artist)
 	if artistCount > 0 {
 		searchTerm := ""
 		if !isShortQuery && query != "" && query != "*" {
 			searchTerm = query
 		}
-		if cnt, err := CountArtists(db, searchTerm, false); err == nil {
+		if cnt, err := CountArtists(db, searchTerm, UseAlbumArtist(db)); err == nil {
 			result.ArtistCount = cnt
 		}
 	}
@@ -505,10 +460,11 @@ func subsonicSearch3(c *gin.Context) {
 		}
 
 		artists, err := QueryArtists(db, ArtistQueryOptions{
-			SearchTerm:    searchTerm,
-			IncludeCounts: true,
-			Limit:         artistCount,
-			Offset:        artistOffset,
+			SearchTerm:         searchTerm,
+			UseEffectiveArtist: UseAlbumArtist(db),
+			IncludeCounts:      true,
+			Limit:              artistCount,
+			Offset:             artistOffset,
 		})
 		if err != nil {
 			log.Printf("[ERROR] subsonicSearch3: Artist query failed: %v", err)
@@ -537,9 +493,8 @@ func subsonicSearch3(c *gin.Context) {
 			albumQuery = `
 				SELECT
 					album,
-					MIN(NULLIF(album_path, '')) as albumPath,
+					COALESCE(MIN(NULLIF(album_path, '')), '') as albumPath,
 					COALESCE(genre, '') as genre,
-					MIN(id) as albumId,
 					COUNT(*) as song_count,
 					COALESCE(SUM(duration), 0) as total_duration,
 					MIN(date_added) as created
@@ -553,31 +508,26 @@ func subsonicSearch3(c *gin.Context) {
 				LIMIT ? OFFSET ?`
 			albumArgs = append(albumArgs, albumCount, albumOffset)
 		} else {
-			// Filter by search terms (match album name, artist, or album_artist)
-			var albumConditions []string
-			for _, word := range searchWords {
-				// Match on album name, artist, OR album_artist to show albums where the artist appears in ANY song
-				albumConditions = append(albumConditions, "(album LIKE ? OR artist LIKE ? OR album_artist LIKE ?)")
-				likeWord := "%" + word + "%"
-				albumArgs = append(albumArgs, likeWord, likeWord, likeWord)
-			}
+			// Filter by search terms: match album name, artist, OR album_artist so
+			// albums where the artist appears in ANY song are shown (accent-insensitive).
+			var albumJoin, albumCondition string
+			albumJoin, albumCondition, albumArgs = songSearchFilter(db, "songs", query, searchScopeAlbum)
 			// Fetch candidates filtered by album name, artist, or album_artist
 			albumQuery = `
 				SELECT
-					album,
-					MIN(NULLIF(album_path, '')) as albumPath,
-					COALESCE(genre, '') as genre,
-					MIN(id) as albumId,
+					songs.album,
+					COALESCE(MIN(NULLIF(songs.album_path, '')), '') as albumPath,
+					COALESCE(songs.genre, '') as genre,
 					COUNT(*) as song_count,
-					COALESCE(SUM(duration), 0) as total_duration,
-					MIN(date_added) as created
-				FROM songs
-				WHERE (` + strings.Join(albumConditions, " AND ") + `) AND cancelled = 0
+					COALESCE(SUM(songs.duration), 0) as total_duration,
+					MIN(songs.date_added) as created
+				FROM songs` + albumJoin + `
+				WHERE ` + albumCondition + ` AND songs.cancelled = 0
 				GROUP BY CASE
-					WHEN album_path IS NOT NULL AND album_path != '' THEN album_path || '|||' || album
-					ELSE album
+					WHEN songs.album_path IS NOT NULL AND songs.album_path != '' THEN songs.album_path || '|||' || songs.album
+					ELSE songs.album
 				END
-				ORDER BY album COLLATE NOCASE`
+				ORDER BY songs.album COLLATE NOCASE`
 		}
 
 		albumRows, err := db.Query(albumQuery, albumArgs...)
@@ -585,27 +535,19 @@ func subsonicSearch3(c *gin.Context) {
 			log.Printf("[ERROR] subsonicSearch3: Album query failed: %v", err)
 		} else {
 			defer albumRows.Close()
-			// Deduplicate albums preferring entries backed by album_artist when duplicates exist
-			seenAlbums := make(map[string]SubsonicAlbum)
-			orderAlbums := []string{}
+			// Rows are already one per album (see AlbumKey); same-named albums
+			// in different folders are different albums and are all listed.
 			candidates := []SubsonicAlbum{}
 			for albumRows.Next() {
 				var albumName, genre, albumPath string
-				var albumID string
 				var songCount, totalDuration int
 				var created sql.NullString
-				if err := albumRows.Scan(&albumName, &albumPath, &genre, &albumID, &songCount, &totalDuration, &created); err == nil {
+				if err := albumRows.Scan(&albumName, &albumPath, &genre, &songCount, &totalDuration, &created); err == nil {
+					albumID := AlbumID(albumName, albumPath)
 					// Compute display artist for this album
 					displayArtist := albumDisplayArtist(db, albumName, strings.TrimSpace(albumPath))
 					// Ensure album matches search words by album name or display artist (case-insensitive)
-					match := true
-					for _, word := range searchWords {
-						lw := strings.ToLower(word)
-						if !strings.Contains(strings.ToLower(albumName), lw) && !strings.Contains(strings.ToLower(displayArtist), lw) {
-							match = false
-							break
-						}
-					}
+					match := albumMatchesSearch(query, albumName, displayArtist)
 					// Debug: log when searching for 'unknown' so we can inspect why albums are matching
 					if strings.Contains(strings.ToLower(query), "unknown") {
 						log.Printf("DEBUG search: query='%s' searchWords=%v album='%s' displayArtist='%s' match=%t", query, searchWords, albumName, displayArtist, match)
@@ -628,32 +570,19 @@ func subsonicSearch3(c *gin.Context) {
 					candidates = append(candidates, candidate)
 				}
 			}
-			// Deduplicate candidates by album name (preserve first occurrence), preferring album_artist-backed entries
-			for _, candidate := range candidates {
-				key := normalizeKey(candidate.Name)
-				if existing, ok := seenAlbums[key]; ok {
-					candIsAlbumArtist, _ := AlbumExists(db, candidate.Name, candidate.Artist)
-					existIsAlbumArtist, _ := AlbumExists(db, existing.Name, existing.Artist)
-					if candIsAlbumArtist && !existIsAlbumArtist {
-						seenAlbums[key] = candidate
-					}
-				} else {
-					seenAlbums[key] = candidate
-					orderAlbums = append(orderAlbums, key)
-				}
-			}
-			// Apply pagination
+			// Apply pagination (short queries were already paged in SQL)
 			start := albumOffset
-			if start < 0 {
+			if start < 0 || isShortQuery {
 				start = 0
 			}
-			end := start + albumCount
-			if end > len(orderAlbums) {
-				end = len(orderAlbums)
+			if start > len(candidates) {
+				start = len(candidates)
 			}
-			for _, k := range orderAlbums[start:end] {
-				result.Albums = append(result.Albums, seenAlbums[k])
+			end := start + albumCount
+			if end > len(candidates) {
+				end = len(candidates)
 			}
+			result.Albums = append(result.Albums, candidates[start:end]...)
 		}
 	}
 
@@ -693,6 +622,7 @@ func subsonicSearch3(c *gin.Context) {
 	if result.Songs == nil {
 		result.Songs = []SubsonicSong{}
 	}
+	applySongRatings(user.ID, result.Songs)
 
 	response := newSubsonicResponse(&result)
 	subsonicRespond(c, response)
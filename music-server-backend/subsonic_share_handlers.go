@@ -0,0 +1,337 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- createShare / getShares / deleteShare ----------------------------------
+
+// SubsonicShares is the getShares/createShare response.
+type SubsonicShares struct {
+	XMLName xml.Name        `xml:"shares" json:"-"`
+	Shares  []SubsonicShare `xml:"share" json:"share"`
+}
+
+// SubsonicShare describes a public link to a set of songs. Entries are the
+// shared songs in the order they were given to createShare.
+type SubsonicShare struct {
+	XMLName     xml.Name       `xml:"share" json:"-"`
+	ID          string         `xml:"id,attr" json:"id"`
+	URL         string         `xml:"url,attr" json:"url"`
+	Description string         `xml:"description,attr,omitempty" json:"description,omitempty"`
+	Username    string         `xml:"username,attr" json:"username"`
+	Created     string         `xml:"created,attr" json:"created"`
+	Expires     string         `xml:"expires,attr,omitempty" json:"expires,omitempty"`
+	LastVisited string         `xml:"lastVisited,attr,omitempty" json:"lastVisited,omitempty"`
+	VisitCount  int            `xml:"visitCount,attr" json:"visitCount"`
+	Entries     []SubsonicSong `xml:"entry" json:"entry"`
+}
+
+// sharesEnabled reports whether the admin has turned on public sharing via the
+// enable_shares configuration key (off by default).
+func sharesEnabled() bool {
+	return configBool(db, "enable_shares")
+}
+
+// shareURL builds the public, unauthenticated URL for a share id.
+func shareURL(c *gin.Context, id string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host + "/share/" + id
+}
+
+// shareRow is a row of the shares table joined with the owner's username.
+type shareRow struct {
+	ID          string
+	UserID      int
+	Username    string
+	SongIDs     []string
+	Description string
+	ExpiresAt   string
+	CreatedAt   string
+	LastVisited string
+	VisitCount  int
+}
+
+// expired reports whether the share has passed its expiry time.
+func (s shareRow) expired() bool {
+	if s.ExpiresAt == "" {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, s.ExpiresAt)
+	return err == nil && time.Now().After(t)
+}
+
+const shareSelectColumns = `SELECT sh.id, sh.user_id, u.username, sh.song_ids, COALESCE(sh.description, ''),
+	COALESCE(sh.expires_at, ''), sh.created_at, COALESCE(sh.last_visited, ''), sh.visit_count
+	FROM shares sh JOIN users u ON u.id = sh.user_id`
+
+func scanShareRow(scanner interface{ Scan(...interface{}) error }) (shareRow, error) {
+	var s shareRow
+	var songIDs string
+	if err := scanner.Scan(&s.ID, &s.UserID, &s.Username, &songIDs, &s.Description,
+		&s.ExpiresAt, &s.CreatedAt, &s.LastVisited, &s.VisitCount); err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal([]byte(songIDs), &s.SongIDs); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// shareSongs loads the shared songs, preserving the order they were shared in
+// and silently dropping songs that have since been removed from the library.
+func shareSongs(s shareRow) ([]SongResult, error) {
+	results, err := QuerySongsByIDs(db, s.SongIDs)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]SongResult, len(results))
+	for _, r := range results {
+		byID[r.ID] = r
+	}
+	ordered := make([]SongResult, 0, len(results))
+	for _, id := range s.SongIDs {
+		if r, ok := byID[id]; ok {
+			ordered = append(ordered, r)
+		}
+	}
+	return ordered, nil
+}
+
+func buildSubsonicShare(c *gin.Context, s shareRow) SubsonicShare {
+	share := SubsonicShare{
+		ID:          s.ID,
+		URL:         shareURL(c, s.ID),
+		Description: s.Description,
+		Username:    s.Username,
+		Created:     s.CreatedAt,
+		Expires:     s.ExpiresAt,
+		LastVisited: s.LastVisited,
+		VisitCount:  s.VisitCount,
+		Entries:     []SubsonicSong{},
+	}
+	songs, err := shareSongs(s)
+	if err != nil {
+		log.Printf("[SHARES] Error loading songs for share %s: %v", s.ID, err)
+		return share
+	}
+	for _, r := range songs {
+		share.Entries = append(share.Entries, buildSubsonicSong(r))
+	}
+	return share
+}
+
+func subsonicCreateShare(c *gin.Context) {
+	user := c.MustGet("user").(User)
+
+	if !sharesEnabled() {
+		subsonicRespond(c, newSubsonicErrorResponse(50, "Sharing is disabled on this server."))
+		return
+	}
+
+	var songIDs []string
+	for _, id := range c.QueryArray("id") {
+		if id != "" {
+			songIDs = append(songIDs, id)
+		}
+	}
+	if len(songIDs) == 0 {
+		subsonicRespond(c, newSubsonicErrorResponse(10, "Required parameter id is missing."))
+		return
+	}
+	for _, id := range songIDs {
+		exists, err := SongExists(db, id)
+		if err != nil {
+			subsonicRespond(c, newSubsonicErrorResponse(0, "Database error."))
+			return
+		}
+		if !exists {
+			subsonicRespond(c, newSubsonicErrorResponse(70, "Song not found: "+id))
+			return
+		}
+	}
+
+	// expires is given in milliseconds since the epoch; 0/absent means never.
+	var expiresAt interface{}
+	if expStr := c.Query("expires"); expStr != "" {
+		ms, err := strconv.ParseInt(expStr, 10, 64)
+		if err != nil {
+			subsonicRespond(c, newSubsonicErrorResponse(10, "Invalid value for parameter 'expires'."))
+			return
+		}
+		if ms > 0 {
+			expiresAt = time.UnixMilli(ms).UTC().Format(time.RFC3339)
+		}
+	}
+
+	songIDsJSON, _ := json.Marshal(songIDs)
+	id := GenerateBase62UUID()
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	_, err := db.Exec(`INSERT INTO shares (id, user_id, song_ids, description, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		id, user.ID, string(songIDsJSON), c.Query("description"), expiresAt, createdAt)
+	if err != nil {
+		log.Printf("[SHARES] Error creating share for user %s: %v", user.Username, err)
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Could not create share."))
+		return
+	}
+
+	s, err := scanShareRow(db.QueryRow(shareSelectColumns+` WHERE sh.id = ?`, id))
+	if err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Could not load share."))
+		return
+	}
+	subsonicRespond(c, newSubsonicResponse(&SubsonicShares{Shares: []SubsonicShare{buildSubsonicShare(c, s)}}))
+}
+
+func subsonicGetShares(c *gin.Context) {
+	user := c.MustGet("user").(User)
+
+	rows, err := db.Query(shareSelectColumns+` WHERE sh.user_id = ? ORDER BY sh.created_at DESC`, user.ID)
+	if err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error fetching shares."))
+		return
+	}
+	var list []shareRow
+	for rows.Next() {
+		s, err := scanShareRow(rows)
+		if err != nil {
+			log.Printf("[SHARES] Error scanning share row: %v", err)
+			continue
+		}
+		list = append(list, s)
+	}
+	rows.Close()
+
+	shares := make([]SubsonicShare, 0, len(list))
+	for _, s := range list {
+		shares = append(shares, buildSubsonicShare(c, s))
+	}
+	subsonicRespond(c, newSubsonicResponse(&SubsonicShares{Shares: shares}))
+}
+
+func subsonicDeleteShare(c *gin.Context) {
+	user := c.MustGet("user").(User)
+
+	id := c.Query("id")
+	if id == "" {
+		subsonicRespond(c, newSubsonicErrorResponse(10, "Required parameter id is missing."))
+		return
+	}
+
+	// Owners can delete their own shares; admins can delete any share.
+	res, err := db.Exec(`DELETE FROM shares WHERE id = ? AND (user_id = ? OR ?)`, id, user.ID, user.IsAdmin)
+	if err != nil {
+		subsonicRespond(c, newSubsonicErrorResponse(0, "Error deleting share."))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		subsonicRespond(c, newSubsonicErrorResponse(70, "Share not found."))
+		return
+	}
+	subsonicRespond(c, newSubsonicResponse(nil))
+}
+
+// --- public share endpoints -------------------------------------------------
+
+// loadPublicShare resolves a share for the unauthenticated endpoints, writing
+// a 404 when sharing is disabled or the share is unknown and 410 once expired.
+func loadPublicShare(c *gin.Context) (shareRow, bool) {
+	if !sharesEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share not found"})
+		return shareRow{}, false
+	}
+	s, err := scanShareRow(db.QueryRow(shareSelectColumns+` WHERE sh.id = ?`, c.Param("id")))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("[SHARES] Error loading share %s: %v", c.Param("id"), err)
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share not found"})
+		return shareRow{}, false
+	}
+	if s.expired() {
+		c.JSON(http.StatusGone, gin.H{"error": "Share has expired"})
+		return shareRow{}, false
+	}
+	return s, true
+}
+
+// publicShareHandler lists the songs of a share. No authentication is required;
+// the unguessable share id is the credential.
+func publicShareHandler(c *gin.Context) {
+	s, ok := loadPublicShare(c)
+	if !ok {
+		return
+	}
+
+	if _, err := db.Exec(`UPDATE shares SET visit_count = visit_count + 1, last_visited = ? WHERE id = ?`,
+		time.Now().UTC().Format(time.RFC3339), s.ID); err != nil {
+		log.Printf("[SHARES] Error recording visit for share %s: %v", s.ID, err)
+	}
+
+	songs, err := shareSongs(s)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	items := make([]gin.H, 0, len(songs))
+	for _, r := range songs {
+		items = append(items, gin.H{
+			"id":        r.ID,
+			"title":     r.Title,
+			"artist":    r.Artist,
+			"album":     r.Album,
+			"duration":  r.Duration,
+			"streamUrl": "/share/" + s.ID + "/stream/" + r.ID,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":          s.ID,
+		"description": s.Description,
+		"username":    s.Username,
+		"created":     s.CreatedAt,
+		"expires":     s.ExpiresAt,
+		"songs":       items,
+	})
+}
+
+// publicShareStreamHandler streams the original file of a song in a share.
+func publicShareStreamHandler(c *gin.Context) {
+	s, ok := loadPublicShare(c)
+	if !ok {
+		return
+	}
+
+	songID := c.Param("songId")
+	shared := false
+	for _, id := range s.SongIDs {
+		if id == songID {
+			shared = true
+			break
+		}
+	}
+	if !shared {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Song not found in share"})
+		return
+	}
+
+	path, err := QuerySongPath(db, songID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
+		return
+	}
+	streamDirect(c, path)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSharesLifecycleAndPublicAccess(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+
+	stmts := []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT UNIQUE NOT NULL, is_admin BOOLEAN NOT NULL DEFAULT 0)`,
+		`CREATE TABLE configuration (key TEXT PRIMARY KEY NOT NULL, value TEXT)`,
+		`CREATE TABLE shares (id TEXT PRIMARY KEY NOT NULL, user_id INTEGER NOT NULL, song_ids TEXT NOT NULL, description TEXT DEFAULT '',
+			expires_at TEXT, created_at TEXT NOT NULL, last_visited TEXT, visit_count INTEGER NOT NULL DEFAULT 0)`,
+		`INSERT INTO users (id, username) VALUES (1, 'test')`,
+		`INSERT INTO configuration (key, value) VALUES ('enable_shares', 'true')`,
+		`INSERT INTO songs (id, title, artist, album, album_path, path, duration, play_count, cancelled) VALUES ('s1', 'One', 'A', 'X', '/m/X', '/m/X/1.mp3', 120, 0, 0)`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+
+	shares, _ := callHandler(t, subsonicCreateShare, "id=s1&description=hello")["shares"].(map[string]interface{})
+	list, _ := shares["share"].([]interface{})
+	if len(list) != 1 {
+		t.Fatalf("createShare should return the new share, got %v", shares)
+	}
+	created := list[0].(map[string]interface{})
+	shareID := created["id"].(string)
+	if entries, _ := created["entry"].([]interface{}); len(entries) != 1 {
+		t.Fatalf("share should contain one entry: %v", created)
+	}
+
+	shares, _ = callHandler(t, subsonicGetShares, "")["shares"].(map[string]interface{})
+	if list, _ := shares["share"].([]interface{}); len(list) != 1 {
+		t.Fatalf("getShares should list the share, got %v", shares)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/share/:id", publicShareHandler)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/share/"+shareID, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("public share should be reachable, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if _, err := db.Exec(`UPDATE shares SET expires_at = '2000-01-01T00:00:00Z' WHERE id = ?`, shareID); err != nil {
+		t.Fatalf("expire share: %v", err)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/share/"+shareID, nil))
+	if w.Code != http.StatusGone {
+		t.Fatalf("expired share should return 410, got %d", w.Code)
+	}
+
+	callHandler(t, subsonicDeleteShare, "id="+shareID)
+	var n int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM shares`).Scan(&n)
+	if n != 0 {
+		t.Fatalf("deleteShare should remove the share, %d left", n)
+	}
+}
@@ -109,6 +109,8 @@ func directoryChildFromSong(s SubsonicSong) SubsonicDirectoryChild {
 		LastPlayed:    s.LastPlayed,
 		Created:       s.Created,
 		Starred:       s.Starred,
+		UserRating:    s.UserRating,
+		AverageRating: s.AverageRating,
 		Comment:       s.Comment,
 		Type:          s.Type,
 		MediaType:     s.MediaType,
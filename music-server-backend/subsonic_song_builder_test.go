@@ -126,8 +126,8 @@ func TestQuerySongs_RoundTripSpecFields(t *testing.T) {
 	if s.AlbumArtist != "RT AlbumArtist" || s.AlbumArtistID == "" {
 		t.Errorf("albumArtist/Id = %q/%q", s.AlbumArtist, s.AlbumArtistID)
 	}
-	if s.AlbumID != "rt1" || s.Parent != "rt1" {
-		t.Errorf("albumId/parent = %q/%q, want rt1 (MIN id over album_path)", s.AlbumID, s.Parent)
+	if want := AlbumID("RT Album", "/m/RT Artist/RT Album"); s.AlbumID != want || s.Parent != want {
+		t.Errorf("albumId/parent = %q/%q, want %s", s.AlbumID, s.Parent, want)
 	}
 	if s.ReplayGain == nil || s.ReplayGain.TrackGain == nil || *s.ReplayGain.TrackGain != -6.5 {
 		t.Errorf("replayGain not wired: %+v", s.ReplayGain)
@@ -3,7 +3,9 @@ package main
 
 import (
 	"database/sql"
+	"encoding/xml"
 	"log"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,21 +13,11 @@ import (
 // --- Public Endpoints ---
 
 func subsonicPing(c *gin.Context) {
-	response := newSubsonicResponse(nil)
-	response.Type = "AudioMuse-AI"
-	response.ServerVersion = "0.1.0" // Replace with your app version
-	response.OpenSubsonic = true
-	subsonicRespond(c, response)
+	subsonicRespond(c, newSubsonicResponse(nil))
 }
 
 func subsonicGetOpenSubsonicExtensions(c *gin.Context) {
-	extensions := []OpenSubsonicExtension{
-		{Name: "apiKeyAuthentication", Versions: []int{1}},
-		// Add other supported extensions here
-	}
-	response := newSubsonicResponse(&OpenSubsonicExtensions{Extensions: extensions})
-	response.OpenSubsonic = true
-	subsonicRespond(c, response)
+	subsonicRespond(c, newSubsonicResponse(&OpenSubsonicExtensions{Extensions: openSubsonicExtensions}))
 }
 
 // --- Authenticated Endpoints ---
@@ -35,6 +27,18 @@ func subsonicGetLicense(c *gin.Context) {
 	subsonicRespond(c, newSubsonicResponse(&SubsonicLicense{Valid: true}))
 }
 
+// SubsonicTokenInfo is the OpenSubsonic getTokenInfo response describing the
+// user the presented credentials (typically an API key) belong to.
+type SubsonicTokenInfo struct {
+	XMLName  xml.Name `xml:"tokenInfo" json:"-"`
+	Username string   `xml:"username,attr" json:"username"`
+}
+
+func subsonicGetTokenInfo(c *gin.Context) {
+	user := c.MustGet("user").(User)
+	subsonicRespond(c, newSubsonicResponse(&SubsonicTokenInfo{Username: user.Username}))
+}
+
 // --- API Key Management ---
 
 func subsonicGetApiKey(c *gin.Context) {
@@ -53,23 +57,40 @@ func subsonicGetApiKey(c *gin.Context) {
 		return
 	}
 
-	// If no key exists, generate, save, and return it.
-	newKey, err := generateSecureApiKey()
-	if err != nil {
-		log.Printf("CRITICAL: Failed to generate secure API key: %v", err)
-		subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to generate new API key."))
-		return
-	}
-
-	_, err = db.Exec("UPDATE users SET api_key = ? WHERE id = ?", newKey, user.ID)
-	if err != nil {
-		log.Printf("Error saving new API key for user %d: %v", user.ID, err)
-		subsonicRespond(c, newSubsonicErrorResponse(0, "Database error saving new API key."))
+	// If no key exists, generate, save, and return it. users.api_key is UNIQUE,
+	// so a (vanishingly unlikely) collision with another user's key is retried.
+	const maxAttempts = 5
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		newKey, err := generateSecureApiKey()
+		if err != nil {
+			log.Printf("CRITICAL: Failed to generate secure API key: %v", err)
+			subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to generate new API key."))
+			return
+		}
+
+		// Only set the key if none exists yet so concurrent calls agree on one key.
+		_, err = db.Exec("UPDATE users SET api_key = ? WHERE id = ? AND (api_key IS NULL OR api_key = '')", newKey, user.ID)
+		if err != nil {
+			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+				log.Printf("API key collision for user %d (attempt %d/%d), retrying", user.ID, attempt, maxAttempts)
+				continue
+			}
+			log.Printf("Error saving new API key for user %d: %v", user.ID, err)
+			subsonicRespond(c, newSubsonicErrorResponse(0, "Database error saving new API key."))
+			return
+		}
+
+		if err := db.QueryRow("SELECT api_key FROM users WHERE id = ?", user.ID).Scan(&apiKey); err != nil || !apiKey.Valid {
+			log.Printf("Error reading back API key for user %d: %v", user.ID, err)
+			subsonicRespond(c, newSubsonicErrorResponse(0, "Database error saving new API key."))
+			return
+		}
+		log.Printf("Generated new API key for user '%s'", user.Username)
+		subsonicRespond(c, newSubsonicResponse(&ApiKeyResponse{Key: apiKey.String}))
 		return
 	}
 
-	log.Printf("Generated new API key for user '%s'", user.Username)
-	subsonicRespond(c, newSubsonicResponse(&ApiKeyResponse{Key: newKey}))
+	subsonicRespond(c, newSubsonicErrorResponse(0, "Failed to generate a unique API key."))
 }
 
 func subsonicRevokeApiKey(c *gin.Context) {
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenSubsonicExtensionsAndFormPost(t *testing.T) {
+	resp := callHandler(t, subsonicGetOpenSubsonicExtensions, "")
+	if resp["openSubsonic"] != true || resp["type"] != subsonicServerType {
+		t.Fatalf("expected openSubsonic server markers on response: %v", resp)
+	}
+	exts, _ := resp["openSubsonicExtensions"].([]interface{})
+	names := map[string]bool{}
+	for _, e := range exts {
+		names[e.(map[string]interface{})["name"].(string)] = true
+	}
+	if !names["apiKeyAuthentication"] || !names["formPost"] {
+		t.Fatalf("expected apiKeyAuthentication and formPost extensions, got %v", names)
+	}
+
+	// Every response, including errors, should carry openSubsonic=true.
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/rest/x?f=json", nil)
+	subsonicRespond(c, newSubsonicErrorResponse(70, "nope"))
+	if !strings.Contains(w.Body.String(), `"openSubsonic":true`) {
+		t.Fatalf("error response missing openSubsonic flag: %s", w.Body.String())
+	}
+
+	// Form-encoded POST parameters must be visible through c.Query.
+	r := gin.New()
+	r.Use(subsonicFormPostMiddleware())
+	var gotU, gotF string
+	r.POST("/rest/ping.view", func(c *gin.Context) {
+		gotU, gotF = c.Query("u"), c.Query("f")
+	})
+	req := httptest.NewRequest(http.MethodPost, "/rest/ping.view?f=json", strings.NewReader("u=alice&v=1.16.1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if gotU != "alice" || gotF != "json" {
+		t.Fatalf("form POST params not merged into query: u=%q f=%q", gotU, gotF)
+	}
+}
+
+func TestApiKeyAuthenticationAndTokenInfo(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT UNIQUE NOT NULL,
+		password_hash TEXT NOT NULL DEFAULT '', password_plain TEXT, is_admin BOOLEAN NOT NULL DEFAULT 0, api_key TEXT UNIQUE)`); err != nil {
+		t.Fatalf("create users: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO users (id, username, api_key) VALUES (1, 'alice', 'k3y')`); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/rest/getTokenInfo.view", SubsonicAuthMiddleware(), subsonicGetTokenInfo)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rest/getTokenInfo.view?apiKey=k3y&f=json", nil))
+	if !strings.Contains(w.Body.String(), `"tokenInfo":{"username":"alice"}`) {
+		t.Fatalf("expected tokenInfo for alice, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rest/getTokenInfo.view?apiKey=wrong&f=json", nil))
+	if !strings.Contains(w.Body.String(), `"code":44`) {
+		t.Fatalf("expected error 44 for unknown API key, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rest/getTokenInfo.view?apiKey=k3y&u=alice&f=json", nil))
+	if !strings.Contains(w.Body.String(), `"code":43`) {
+		t.Fatalf("expected error 43 when apiKey is combined with u, got %s", w.Body.String())
+	}
+}
+
+func TestGetApiKeyIsStableAndRevocable(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT UNIQUE NOT NULL, is_admin BOOLEAN NOT NULL DEFAULT 0, api_key TEXT UNIQUE)`); err != nil {
+		t.Fatalf("create users: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO users (id, username) VALUES (1, 'test')`); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+
+	keyOf := func() string {
+		k, _ := callHandler(t, subsonicGetApiKey, "")["apiKey"].(map[string]interface{})
+		s, _ := k["key"].(string)
+		return s
+	}
+	first := keyOf()
+	if len(first) < 32 || strings.Trim(first, base62Alphabet) != "" {
+		t.Fatalf("expected a long base62 key, got %q", first)
+	}
+	if second := keyOf(); second != first {
+		t.Fatalf("getApiKey should return the stored key, got %q then %q", first, second)
+	}
+
+	callHandler(t, subsonicRevokeApiKey, "")
+	var stored sql.NullString
+	_ = db.QueryRow(`SELECT api_key FROM users WHERE id = 1`).Scan(&stored)
+	if stored.Valid {
+		t.Fatalf("revokeApiKey should NULL the key, got %q", stored.String)
+	}
+	if third := keyOf(); third == first || third == "" {
+		t.Fatalf("expected a fresh key after revoke, got %q", third)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// Which transcoding a stream gets is decided in this order:
+//
+//  1. the user's own transcoding_settings row, written from the web UI,
+//     whether it turns transcoding on or off;
+//  2. otherwise the server-wide default_transcode_enabled,
+//     default_transcode_format and default_transcode_bitrate keys, so new
+//     users and clients that never opened the settings do not pull
+//     full-size FLAC over a mobile connection;
+//  3. with default_transcode_enabled=false (the default), the original file.
+
+const (
+	defaultTranscodeFormat  = "mp3"
+	defaultTranscodeBitrate = 128
+	minTranscodeBitrate     = 64
+	maxTranscodeBitrate     = 320
+)
+
+// transcodeFormats are the output formats streamWithTranscoding supports.
+var transcodeFormats = map[string]bool{"mp3": true, "ogg": true, "aac": true, "opus": true}
+
+type transcodePreference struct {
+	Enabled bool
+	Format  string
+	Bitrate int
+}
+
+// validateTranscodeFormat checks a format for a user setting or
+// default_transcode_format.
+func validateTranscodeFormat(format string) error {
+	if !transcodeFormats[format] {
+		return fmt.Errorf("invalid format %q. Supported: mp3, ogg, aac, opus", format)
+	}
+	return nil
+}
+
+// validateTranscodeBitrate checks a bitrate (kbps) for a user setting or
+// default_transcode_bitrate.
+func validateTranscodeBitrate(bitrate int) error {
+	if bitrate < minTranscodeBitrate || bitrate > maxTranscodeBitrate {
+		return fmt.Errorf("bitrate must be between %d and %d", minTranscodeBitrate, maxTranscodeBitrate)
+	}
+	return nil
+}
+
+// defaultTranscodePreference reads the server-wide defaults. Invalid values
+// fall back to mp3 at 128 kbps.
+func defaultTranscodePreference() transcodePreference {
+	pref := transcodePreference{Enabled: configBool(db, "default_transcode_enabled"), Format: defaultTranscodeFormat, Bitrate: defaultTranscodeBitrate}
+	if value, err := GetConfig(db, "default_transcode_format"); err == nil && validateTranscodeFormat(value) == nil {
+		pref.Format = value
+	}
+	if value, err := GetConfig(db, "default_transcode_bitrate"); err == nil {
+		if n, err := strconv.Atoi(value); err == nil && validateTranscodeBitrate(n) == nil {
+			pref.Bitrate = n
+		}
+	}
+	return pref
+}
+
+// userTranscodePreference resolves the transcoding for userID's streams; see
+// the precedence above. isDefault reports that no per-user row exists.
+func userTranscodePreference(userID int) (pref transcodePreference, isDefault bool) {
+	var enabled int
+	err := db.QueryRow("SELECT enabled, format, bitrate FROM transcoding_settings WHERE user_id = ?", userID).
+		Scan(&enabled, &pref.Format, &pref.Bitrate)
+	if err == nil {
+		pref.Enabled = enabled == 1
+		return pref, false
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("Failed to read transcoding settings of user %d, using the server default: %v", userID, err)
+	}
+	return defaultTranscodePreference(), true
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestUserTranscodePreference(t *testing.T) {
+	d := scanTestDB(t)
+	if _, err := d.Exec(`CREATE TABLE transcoding_settings (user_id INTEGER PRIMARY KEY NOT NULL, enabled INTEGER NOT NULL DEFAULT 0, format TEXT NOT NULL DEFAULT 'mp3', bitrate INTEGER NOT NULL DEFAULT 128)`); err != nil {
+		t.Fatal(err)
+	}
+	d.Exec(`INSERT INTO transcoding_settings VALUES (1, 0, 'ogg', 192)`)
+
+	// No configuration at all: direct streaming.
+	if pref, isDefault := userTranscodePreference(2); pref.Enabled || !isDefault || pref.Format != "mp3" || pref.Bitrate != 128 {
+		t.Errorf("unconfigured default = %+v, %v", pref, isDefault)
+	}
+
+	d.Exec(`INSERT INTO configuration (key, value) VALUES ('default_transcode_enabled', 'true'), ('default_transcode_format', 'opus'), ('default_transcode_bitrate', '96')`)
+	if pref, _ := userTranscodePreference(2); !pref.Enabled || pref.Format != "opus" || pref.Bitrate != 96 {
+		t.Errorf("server default = %+v", pref)
+	}
+	// A user's own row wins, even when it turns transcoding off.
+	if pref, isDefault := userTranscodePreference(1); pref.Enabled || isDefault || pref.Format != "ogg" || pref.Bitrate != 192 {
+		t.Errorf("user setting = %+v, %v", pref, isDefault)
+	}
+
+	d.Exec(`UPDATE configuration SET value = 'wav' WHERE key = 'default_transcode_format'`)
+	d.Exec(`UPDATE configuration SET value = '9000' WHERE key = 'default_transcode_bitrate'`)
+	if pref := defaultTranscodePreference(); pref.Format != "mp3" || pref.Bitrate != 128 {
+		t.Errorf("invalid values should fall back, got %+v", pref)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Concurrent ffmpeg transcodes, HLS segment encodes included, are capped by
+// max_concurrent_transcodes (0, the default, means one per CPU) so a handful
+// of listeners cannot starve each other's streams. A request that finds every
+// slot taken waits up to transcodeQueueWait for one and is then served the
+// original file instead (HLS segments answer 503).
+
+const transcodeQueueWait = 5 * time.Second
+
+// errTranscodeSlotsBusy is returned by ffmpeg jobs that could not get a slot.
+var errTranscodeSlotsBusy = errors.New("all transcode slots are busy")
+
+// transcodeSlots is a buffered channel used as a semaphore. It is replaced
+// when the configured limit changes; transcodes already running release into
+// the channel they acquired from.
+var transcodeSlots struct {
+	sync.Mutex
+	slots chan struct{}
+}
+
+// maxConcurrentTranscodes returns the configured limit.
+func maxConcurrentTranscodes() int {
+	if n := configInt(db, "max_concurrent_transcodes", 0); n > 0 {
+		return n
+	}
+	return runtime.NumCPU()
+}
+
+func currentTranscodeSlots() chan struct{} {
+	limit := maxConcurrentTranscodes()
+	transcodeSlots.Lock()
+	defer transcodeSlots.Unlock()
+	if transcodeSlots.slots == nil || cap(transcodeSlots.slots) != limit {
+		transcodeSlots.slots = make(chan struct{}, limit)
+	}
+	return transcodeSlots.slots
+}
+
+// acquireTranscodeSlot waits for a free transcode slot for at most wait, or
+// until ctx ends. ok is false when no slot was free; otherwise release must be
+// called once ffmpeg has finished.
+func acquireTranscodeSlot(ctx context.Context, wait time.Duration) (release func(), ok bool) {
+	slots := currentTranscodeSlots()
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, true
+	default:
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return nil, false
+}
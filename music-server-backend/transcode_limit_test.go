@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestTranscodeSlots(t *testing.T) {
+	scanTestDB(t)
+	ctx := context.Background()
+	t.Cleanup(func() { transcodeSlots.slots = nil })
+
+	if got := maxConcurrentTranscodes(); got != runtime.NumCPU() {
+		t.Fatalf("default limit = %d, want NumCPU %d", got, runtime.NumCPU())
+	}
+	if _, err := db.Exec(`INSERT OR REPLACE INTO configuration (key, value) VALUES ('max_concurrent_transcodes', '1')`); err != nil {
+		t.Fatal(err)
+	}
+
+	release, ok := acquireTranscodeSlot(ctx, time.Second)
+	if !ok {
+		t.Fatal("the first transcode should get a slot")
+	}
+	if _, ok := acquireTranscodeSlot(ctx, 20*time.Millisecond); ok {
+		t.Fatal("a second transcode should not get a slot while the limit is 1")
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		release()
+	}()
+	release, ok = acquireTranscodeSlot(ctx, 5*time.Second)
+	if !ok {
+		t.Fatal("a waiting transcode should get the slot once it is released")
+	}
+	defer release()
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, ok := acquireTranscodeSlot(cancelled, 5*time.Second); ok {
+		t.Fatal("a request that went away should not get a slot")
+	}
+
+	if _, err := db.Exec(`UPDATE configuration SET value = '2' WHERE key = 'max_concurrent_transcodes'`); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, ok := acquireTranscodeSlot(ctx, 20*time.Millisecond); !ok {
+			t.Fatalf("raising the limit should free slot %d", i+1)
+		}
+	}
+}
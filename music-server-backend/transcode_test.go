@@ -0,0 +1,55 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTranscodeStopsFFmpegWhenClientGoesAway(t *testing.T) {
+	scanTestDB(t)
+
+	// A stand-in ffmpeg that streams forever.
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "ffmpeg"), []byte("#!/bin/sh\nexec yes\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/rest/stream?id=s1", nil).WithContext(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		streamWithTranscoding(c, "/m/song.flac", "mp3", 128, 0, 0)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for activeTranscodes.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("transcode never started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel() // the client disconnects without any failed write
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("streamWithTranscoding kept running after the request context ended")
+	}
+	if n := activeTranscodes.Load(); n != 0 {
+		t.Errorf("activeTranscodes = %d after the stream ended, want 0", n)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gin's ClientIP reads X-Forwarded-For / X-Real-IP only on requests coming
+// from a trusted proxy. TRUSTED_PROXIES lists those proxies (comma-separated
+// addresses or CIDR ranges, e.g. "172.18.0.0/16" for a reverse proxy on the
+// Docker network). Unset, no proxy is trusted and ClientIP is the address of
+// the connection itself, so a client cannot pick the IP the login limiter
+// (login_rate_limiter.go) or the LAN check (lan_streaming.go) sees by sending
+// a forged header.
+
+// trustedProxies returns the proxies listed in TRUSTED_PROXIES, or nil.
+func trustedProxies() []string {
+	var proxies []string
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			proxies = append(proxies, entry)
+		}
+	}
+	return proxies
+}
+
+// configureTrustedProxies applies TRUSTED_PROXIES to the router.
+func configureTrustedProxies(r *gin.Engine) error {
+	return r.SetTrustedProxies(trustedProxies())
+}
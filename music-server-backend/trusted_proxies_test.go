@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientIPIgnoresForwardedForUnlessProxyTrusted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clientIP := func() string {
+		r := gin.New()
+		if err := configureTrustedProxies(r); err != nil {
+			t.Fatalf("configureTrustedProxies: %v", err)
+		}
+		var ip string
+		r.GET("/", func(c *gin.Context) { ip = c.ClientIP() })
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.5:40000"
+		req.Header.Set("X-Forwarded-For", "10.0.0.1")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		return ip
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "")
+	if got := clientIP(); got != "203.0.113.5" {
+		t.Errorf("no trusted proxies: ClientIP = %s, want the connection address", got)
+	}
+	t.Setenv("TRUSTED_PROXIES", "192.0.2.1, 203.0.113.0/24")
+	if got := clientIP(); got != "10.0.0.1" {
+		t.Errorf("trusted proxy: ClientIP = %s, want the forwarded address", got)
+	}
+	t.Setenv("TRUSTED_PROXIES", "not-an-ip")
+	if err := configureTrustedProxies(gin.New()); err == nil {
+		t.Error("an invalid TRUSTED_PROXIES entry was accepted")
+	}
+}
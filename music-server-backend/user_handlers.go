@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -22,12 +23,20 @@ func loginUser(c *gin.Context) {
 		return
 	}
 
+	if wait, blocked := loginBlocked(c.ClientIP(), creds.Username); blocked {
+		log.Printf("Login for '%s' from %s refused: too many failed attempts", creds.Username, c.ClientIP())
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts. Try again later."})
+		return
+	}
+
 	var id int
 	var hashedPassword string
 	var isAdmin bool
 	err := db.QueryRow("SELECT id, password_hash, is_admin FROM users WHERE username = ?", creds.Username).Scan(&id, &hashedPassword, &isAdmin)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			recordLoginFailure(c.ClientIP(), creds.Username)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			return
 		}
@@ -37,9 +46,11 @@ func loginUser(c *gin.Context) {
 	}
 
 	if !checkPasswordHash(creds.Password, hashedPassword) {
+		recordLoginFailure(c.ClientIP(), creds.Username)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	recordLoginSuccess(c.ClientIP(), creds.Username)
 
 	token, err := GenerateJWT(id, creds.Username, isAdmin)
 	if err != nil {
@@ -50,6 +61,58 @@ func loginUser(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"token": token, "is_admin": isAdmin})
 }
 
+// refreshToken issues a fresh access token for a caller holding a valid, not
+// revoked one, and revokes the old token so each one can be refreshed only
+// once. The user is re-read so deleted accounts and admin changes take effect
+// on the next refresh.
+func refreshToken(c *gin.Context) {
+	userID := c.GetInt("userID")
+	var username string
+	var isAdmin bool
+	err := db.QueryRow("SELECT username, is_admin FROM users WHERE id = ?", userID).Scan(&username, &isAdmin)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User no longer exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	token, err := GenerateJWT(userID, username, isAdmin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+	if claims, ok := c.MustGet("claims").(*Claims); ok {
+		if err := revokeToken(claims); err != nil {
+			log.Printf("Failed to revoke refreshed token for user '%s': %v", username, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke token"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"token": token, "is_admin": isAdmin})
+}
+
+// logoutUser revokes the token used for this request and the signed stream
+// URLs the user has handed out.
+func logoutUser(c *gin.Context) {
+	claims, ok := c.MustGet("claims").(*Claims)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Missing token claims"})
+		return
+	}
+	if err := revokeToken(claims); err != nil {
+		log.Printf("Failed to revoke token for user '%s': %v", claims.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke token"})
+		return
+	}
+	if err := revokeSignedStreamURLs(claims.UserID); err != nil {
+		log.Printf("Failed to revoke stream URLs for user '%s': %v", claims.Username, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
 // --- Password Hashing ---
 
 func hashPassword(password string) (string, error) {
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"strconv"
+)
+
+// Per-user permissions beyond is_admin. Each role is an INTEGER column on the
+// users table; admins implicitly hold every role. Roles default to enabled
+// except scan_role and jukebox_role, so existing non-admin accounts keep their behaviour.
+const (
+	roleDownload = "download_role"
+	rolePlaylist = "playlist_role"
+	roleSettings = "settings_role"
+	roleScan     = "scan_role"
+	roleJukebox  = "jukebox_role"
+)
+
+// userRoleColumns lists the role columns with their default for new users and
+// the Subsonic parameter that sets them in createUser/updateUser.
+var userRoleColumns = []struct {
+	column  string
+	param   string
+	initial bool
+}{
+	{roleDownload, "downloadRole", true},
+	{rolePlaylist, "playlistRole", true},
+	{roleSettings, "settingsRole", true},
+	{roleScan, "scanRole", false},
+	{roleJukebox, "jukeboxRole", false},
+}
+
+// userHasRole reports whether user holds role. A failed lookup denies the
+// role, so a database error never grants a permission.
+func userHasRole(user User, role string) bool {
+	if user.IsAdmin {
+		return true
+	}
+	isKnown := false
+	for _, r := range userRoleColumns {
+		if r.column == role {
+			isKnown = true
+			break
+		}
+	}
+	if !isKnown {
+		return false
+	}
+	var granted bool
+	err := db.QueryRow("SELECT "+role+" FROM users WHERE id = ?", user.ID).Scan(&granted)
+	if err != nil {
+		log.Printf("Failed to read %s for user %d, denying: %v", role, user.ID, err)
+		return false
+	}
+	return granted
+}
+
+// roleParams reads the role query parameters present on the request. Invalid
+// values are reported via the returned parameter name.
+func roleParams(query func(string) string) (map[string]bool, string) {
+	roles := map[string]bool{}
+	for _, r := range userRoleColumns {
+		v := query(r.param)
+		if v == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, r.param
+		}
+		roles[r.column] = b
+	}
+	return roles, ""
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUserRolesStoredAndEnforced(t *testing.T) {
+	db = setupFullTestDB(t)
+	defer db.Close()
+	stmts := []string{
+		`CREATE TABLE configuration (key TEXT PRIMARY KEY NOT NULL, value TEXT)`,
+		`CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT UNIQUE NOT NULL, password_hash TEXT NOT NULL DEFAULT '',
+			password_plain TEXT NOT NULL DEFAULT '', is_admin BOOLEAN NOT NULL DEFAULT 0, api_key TEXT UNIQUE,
+			download_role INTEGER NOT NULL DEFAULT 1, playlist_role INTEGER NOT NULL DEFAULT 1,
+			settings_role INTEGER NOT NULL DEFAULT 1, scan_role INTEGER NOT NULL DEFAULT 0, jukebox_role INTEGER NOT NULL DEFAULT 0)`,
+		`INSERT INTO users (id, username, is_admin) VALUES (1, 'admin', 1)`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed %q: %v", s, err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	call := func(handler gin.HandlerFunc, user User, rawQuery string) string {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/rest/x?"+rawQuery+"&f=json", nil)
+		c.Set("user", user)
+		handler(c)
+		return w.Body.String()
+	}
+	admin := User{ID: 1, Username: "admin", IsAdmin: true}
+
+	if body := call(subsonicCreateUser, admin, "username=bob&password=pw&downloadRole=false&scanRole=true"); !strings.Contains(body, `"status":"ok"`) {
+		t.Fatalf("createUser failed: %s", body)
+	}
+	var bobID int
+	var download, playlist, scan bool
+	if err := db.QueryRow(`SELECT id, download_role, playlist_role, scan_role FROM users WHERE username = 'bob'`).Scan(&bobID, &download, &playlist, &scan); err != nil {
+		t.Fatalf("read bob: %v", err)
+	}
+	if download || !playlist || !scan {
+		t.Fatalf("unexpected roles download=%v playlist=%v scan=%v", download, playlist, scan)
+	}
+
+	body := call(subsonicGetUsers, admin, "")
+	if !strings.Contains(body, `{"username":"bob","adminRole":false,"settingsRole":true,"downloadRole":false,"playlistRole":true,"scanRole":true,"jukeboxRole":false}`) {
+		t.Fatalf("getUsers should report bob's roles: %s", body)
+	}
+
+	bob := User{ID: bobID, Username: "bob"}
+	if body := call(subsonicDownload, bob, "id=anything"); !strings.Contains(body, `"code":50`) {
+		t.Fatalf("download without download_role should return error 50: %s", body)
+	}
+
+	if body := call(subsonicUpdateUser, admin, "username=bob&scanRole=false"); !strings.Contains(body, `"status":"ok"`) {
+		t.Fatalf("updateUser failed: %s", body)
+	}
+	if body := call(subsonicStartScan, bob, ""); !strings.Contains(body, `"code":50`) {
+		t.Fatalf("startScan without scan_role should return error 50: %s", body)
+	}
+	if body := call(subsonicUpdateUser, admin, "username=bob&downloadRole=maybe"); !strings.Contains(body, `"code":10`) {
+		t.Fatalf("invalid role value should be rejected: %s", body)
+	}
+	if userHasRole(User{ID: 999, Username: "ghost"}, roleDownload) {
+		t.Fatal("a failed role lookup should deny the role")
+	}
+}
@@ -15,6 +15,9 @@ type TranscodingSettings struct {
 	Enabled bool   `json:"enabled"`
 	Format  string `json:"format"`
 	Bitrate int    `json:"bitrate"`
+	// IsDefault is set when the user has no settings of their own and the
+	// values shown are the server default (see userTranscodePreference).
+	IsDefault bool `json:"isDefault"`
 }
 
 // getUserTranscodingSettings retrieves transcoding settings for the authenticated user
@@ -32,12 +35,14 @@ func getUserTranscodingSettings(c *gin.Context) {
 		Scan(&settings.UserID, &enabled, &settings.Format, &settings.Bitrate)
 
 	if err == sql.ErrNoRows {
-		// Return default settings if none exist
+		// Without a row of their own the user streams with the server default
+		pref := defaultTranscodePreference()
 		settings = TranscodingSettings{
-			UserID:  userID,
-			Enabled: false,
-			Format:  "mp3",
-			Bitrate: 128,
+			UserID:    userID,
+			Enabled:   pref.Enabled,
+			Format:    pref.Format,
+			Bitrate:   pref.Bitrate,
+			IsDefault: true,
 		}
 		c.JSON(http.StatusOK, settings)
 		return
@@ -66,14 +71,13 @@ func updateUserTranscodingSettings(c *gin.Context) {
 	}
 
 	// Validate format
-	validFormats := map[string]bool{"mp3": true, "ogg": true, "aac": true, "opus": true}
-	if !validFormats[settings.Format] {
+	if !transcodeFormats[settings.Format] {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format. Supported: mp3, ogg, aac, opus"})
 		return
 	}
 
 	// Validate bitrate
-	if settings.Bitrate < 64 || settings.Bitrate > 320 {
+	if validateTranscodeBitrate(settings.Bitrate) != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Bitrate must be between 64 and 320"})
 		return
 	}
@@ -93,7 +97,9 @@ func updateUserTranscodingSettings(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Settings updated successfully"})
+	settings.UserID = userID
+	settings.IsDefault = false
+	c.JSON(http.StatusOK, gin.H{"message": "Settings updated successfully", "settings": settings})
 }
 
 // Discovery view handlers
@@ -300,7 +306,9 @@ func getMostPlayed(c *gin.Context) {
 	c.JSON(http.StatusOK, songs)
 }
 
-// getRecentlyPlayed returns recently played songs for the authenticated user
+// getRecentlyPlayed returns recently played songs for the authenticated user.
+// Plays pruned from play_history live on in user_song_stats (see
+// play_history_retention.go), so both are read.
 func getRecentlyPlayed(c *gin.Context) {
 	userIDVal, exists := c.Get("userID")
 	if !exists {
@@ -321,10 +329,14 @@ func getRecentlyPlayed(c *gin.Context) {
 		CASE WHEN ss.song_id IS NOT NULL THEN 1 ELSE 0 END as starred,
 		s.genre, MAX(ph.played_at) as recent_play
 		FROM songs s
-		INNER JOIN play_history ph ON s.id = ph.song_id
+		INNER JOIN (
+			SELECT song_id, played_at FROM play_history WHERE user_id = ?
+			UNION ALL
+			SELECT song_id, last_played FROM user_song_stats WHERE user_id = ? AND last_played IS NOT NULL
+		) ph ON s.id = ph.song_id
 		LEFT JOIN starred_songs ss ON s.id = ss.song_id AND ss.user_id = ?
-		WHERE ph.user_id = ? AND s.cancelled = 0`
-	args := []interface{}{userID, userID}
+		WHERE s.cancelled = 0`
+	args := []interface{}{userID, userID, userID}
 
 	if genre != "" {
 		query += " AND (s.genre = ? OR s.genre LIKE ? OR s.genre LIKE ? OR s.genre LIKE ?)"
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUserTranscodingAPI(t *testing.T) {
+	d := scanTestDB(t)
+	if _, err := d.Exec(`CREATE TABLE transcoding_settings (user_id INTEGER PRIMARY KEY NOT NULL, enabled INTEGER NOT NULL DEFAULT 0, format TEXT NOT NULL DEFAULT 'mp3', bitrate INTEGER NOT NULL DEFAULT 128)`); err != nil {
+		t.Fatal(err)
+	}
+	d.Exec(`INSERT INTO configuration (key, value) VALUES ('default_transcode_enabled', 'true'), ('default_transcode_format', 'aac')`)
+
+	r := gin.New()
+	withUser := func(h gin.HandlerFunc) gin.HandlerFunc {
+		return func(c *gin.Context) { c.Set("userID", 3); h(c) }
+	}
+	r.GET("/user/transcoding", withUser(getUserTranscodingSettings))
+	r.PUT("/user/transcoding", withUser(updateUserTranscodingSettings))
+	get := func() TranscodingSettings {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/transcoding", nil))
+		var s TranscodingSettings
+		if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("GET: %d %s", w.Code, w.Body.String())
+		}
+		return s
+	}
+	put := func(body string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/user/transcoding", bytes.NewBufferString(body)))
+		return w.Code
+	}
+
+	if s := get(); !s.IsDefault || !s.Enabled || s.Format != "aac" || s.Bitrate != 128 || s.UserID != 3 {
+		t.Errorf("before any PUT = %+v", s)
+	}
+	if code := put(`{"enabled":false,"format":"opus","bitrate":160}`); code != http.StatusOK {
+		t.Fatalf("PUT: %d", code)
+	}
+	if s := get(); s.IsDefault || s.Enabled || s.Format != "opus" || s.Bitrate != 160 {
+		t.Errorf("after PUT = %+v", s)
+	}
+	for _, body := range []string{`{"enabled":true,"format":"wav","bitrate":160}`, `{"enabled":true,"format":"mp3","bitrate":32}`, `not json`} {
+		if code := put(body); code != http.StatusBadRequest {
+			t.Errorf("PUT %s: %d", body, code)
+		}
+	}
+}
@@ -3,6 +3,7 @@ import React, { useState, useEffect } from 'react';
 import Dashboard from './components/Dashboard';
 import Login from './components/Login';
 import { getAuthToken } from './utils/tokenUtils';
+import { ensureFreshToken, scheduleTokenRefresh, cancelTokenRefresh } from './api';
 
 // --- Main App Component ---
 function App() {
@@ -51,6 +52,24 @@ function App() {
 		validateAndRestoreSession();
 	}, []);
 
+	// Keep the session token renewed while logged in, also when the tab comes
+	// back after timers were throttled in the background.
+	useEffect(() => {
+		if (!credentials) return undefined;
+		scheduleTokenRefresh();
+		const onVisible = async () => {
+			if (document.visibilityState === 'visible') {
+				await ensureFreshToken();
+				scheduleTokenRefresh();
+			}
+		};
+		document.addEventListener('visibilitychange', onVisible);
+		return () => {
+			document.removeEventListener('visibilitychange', onVisible);
+			cancelTokenRefresh();
+		};
+	}, [credentials]);
+
 	const handleLogin = (creds, adminStatus, token) => {
 		// If we received a JWT token, prefer storing only the username in credentials
 		// to avoid sending plaintext passwords in querystrings from the UI.
@@ -71,6 +90,12 @@ function App() {
 	};
 
 	const handleLogout = () => {
+		// Revoke the token server-side; the local session is cleared regardless.
+		const token = getAuthToken();
+		if (token) {
+			fetch('/api/v1/user/logout', { method: 'POST', headers: { 'Authorization': `Bearer ${token}` } })
+				.catch(() => {});
+		}
 		localStorage.removeItem('token'); // For admin panel
 		localStorage.removeItem('username');
 		localStorage.removeItem('isAdmin');
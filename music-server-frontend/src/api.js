@@ -3,13 +3,92 @@
 // Use relative URLs - no explicit API_BASE needed
 // Container internal routing handles the rest
 
-import { getAuthToken } from './utils/tokenUtils.js';
+import { getAuthToken, setAuthToken, tokenSecondsRemaining } from './utils/tokenUtils.js';
 
 const API_BASE = ''; // Empty = relative URLs like the working version
 
 export { API_BASE };
 
+// Access tokens are short-lived; renew one that is close to expiry before it is
+// used. Concurrent callers share a single in-flight refresh request. A timer
+// also renews the token ahead of expiry so media URLs that carry it keep
+// working while nothing else calls the API; listeners are told through the
+// TOKEN_REFRESHED_EVENT window event.
+const TOKEN_REFRESH_THRESHOLD_SECONDS = 5 * 60;
+const TOKEN_REFRESH_RETRY_SECONDS = 30;
+export const TOKEN_REFRESHED_EVENT = 'authTokenRefreshed';
+let refreshInFlight = null;
+let refreshTimer = null;
+
+// refreshToken resolves to whether a new token was stored.
+function refreshToken() {
+    if (!refreshInFlight) {
+        refreshInFlight = fetch(`${API_BASE}/api/v1/user/refresh`, {
+            method: 'POST',
+            headers: { 'Authorization': `Bearer ${getAuthToken()}` },
+        })
+            .then(async res => {
+                if (!res.ok) return false;
+                const data = await res.json();
+                setAuthToken(data.token);
+                window.dispatchEvent(new Event(TOKEN_REFRESHED_EVENT));
+                if (refreshTimer !== null) scheduleTokenRefresh();
+                return true;
+            })
+            .catch(err => {
+                console.warn('Token refresh failed:', err);
+                return false;
+            })
+            .finally(() => { refreshInFlight = null; });
+    }
+    return refreshInFlight;
+}
+
+export async function ensureFreshToken() {
+    const remaining = tokenSecondsRemaining();
+    if (remaining === null || remaining <= 0 || remaining > TOKEN_REFRESH_THRESHOLD_SECONDS) {
+        return;
+    }
+    await refreshToken();
+}
+
+// scheduleTokenRefresh arms the refresh timer for the stored token; it re-arms
+// itself after each refresh until cancelTokenRefresh is called.
+export function scheduleTokenRefresh(delaySeconds) {
+    cancelTokenRefresh();
+    const remaining = tokenSecondsRemaining();
+    if (remaining === null || remaining <= 0) {
+        return;
+    }
+    const delay = delaySeconds ?? Math.max(remaining - TOKEN_REFRESH_THRESHOLD_SECONDS, 0);
+    refreshTimer = setTimeout(async () => {
+        if (!(await refreshToken()) && refreshTimer !== null) {
+            scheduleTokenRefresh(TOKEN_REFRESH_RETRY_SECONDS);
+        }
+    }, delay * 1000);
+}
+
+export function cancelTokenRefresh() {
+    if (refreshTimer !== null) {
+        clearTimeout(refreshTimer);
+        refreshTimer = null;
+    }
+}
+
+// withCurrentToken returns url with its jwt parameter set to the stored token.
+export function withCurrentToken(url) {
+    const token = getAuthToken();
+    if (!token) return url;
+    const u = new URL(url, window.location.origin);
+    if (!u.searchParams.has('jwt')) return url;
+    u.searchParams.set('jwt', token);
+    return url.startsWith('http') ? u.toString() : `${u.pathname}${u.search}`;
+}
+
 export async function apiFetch(path, options = {}) {
+    if (path !== '/api/v1/user/login') {
+        await ensureFreshToken();
+    }
     const headers = options.headers || {};
     const token = getAuthToken();
     if (token) {
@@ -51,6 +130,7 @@ export async function subsonicFetch(endpoint, params = {}) {
     });
     
     // FRONTEND USES JWT ONLY - no username/password in querystring
+    await ensureFreshToken();
     const token = getAuthToken();
     const headers = {};
     if (token) {
@@ -116,6 +196,32 @@ export async function addSongsToPlaylist(playlistId, songIds) {
     }
 }
 
+// getSongs fetches several songs in request order with one getSongs.view call
+// per chunk of ids (the server accepts up to 500 per call). Unknown ids are skipped.
+export async function getSongs(songIds) {
+    const ids = (songIds || []).filter(Boolean);
+    const CHUNK = 300;
+    const token = getAuthToken();
+    if (!token) {
+        throw new Error('No JWT token found. Please log in again.');
+    }
+    const songs = [];
+    for (let i = 0; i < ids.length; i += CHUNK) {
+        const params = new URLSearchParams({ v: '1.16.1', c: 'AudioMuse-AI', f: 'json' });
+        ids.slice(i, i + CHUNK).forEach(id => params.append('id', id));
+        const res = await fetch(`${API_BASE}/rest/getSongs.view?${params.toString()}`, {
+            headers: { Authorization: `Bearer ${token}` }
+        });
+        if (!res.ok) {
+            throw new Error(`Failed to load songs: ${res.status}`);
+        }
+        const data = await res.json();
+        const list = data['subsonic-response']?.songs?.song;
+        if (list) songs.push(...(Array.isArray(list) ? list : [list]));
+    }
+    return songs;
+}
+
 // Star/Unstar functions
 export async function starSong(songId) {
     return await subsonicFetch('star.view', { id: songId });
@@ -164,9 +270,9 @@ export async function getAlbums(params = {}) {
     return await subsonicFetch('getAlbumList2.view', { type: 'alphabeticalByArtist', ...params });
 }
 
-// Rescan functionality for admin
-export async function rescanLibrary() {
-    const res = await apiFetch('/api/v1/admin/scan/rescan', { method: 'POST' });
+// Rescan functionality for admin; wipe deletes the library (stars, playlists) first
+export async function rescanLibrary({ wipe = false } = {}) {
+    const res = await apiFetch(`/api/v1/admin/scan/rescan${wipe ? '?wipe=true' : ''}`, { method: 'POST' });
     if (!res.ok) {
         const errorData = await res.json().catch(() => ({}));
         throw new Error(errorData.error || `Rescan failed: ${res.status}`);
@@ -174,6 +280,16 @@ export async function rescanLibrary() {
     return await res.json();
 }
 
+// Rescan a single library path
+export async function rescanLibraryPath(pathId) {
+    const res = await apiFetch(`/api/v1/admin/scan/path/${encodeURIComponent(pathId)}`, { method: 'POST' });
+    if (!res.ok) {
+        const errorData = await res.json().catch(() => ({}));
+        throw new Error(errorData.error || `Scan failed: ${res.status}`);
+    }
+    return await res.json();
+}
+
 // Discovery views
 export async function getMusicCounts(genre = '') {
     const params = genre ? `?genre=${encodeURIComponent(genre)}` : '';
@@ -221,6 +337,15 @@ export async function getRecentlyPlayed(limit = 50, offset = 0, genre = '') {
     return Array.isArray(data) ? data : [];
 }
 
+export async function getArtistSummary(artistId) {
+    const res = await apiFetch(`/api/v1/artist/${encodeURIComponent(artistId)}/summary`);
+    if (!res.ok) {
+        const errorData = await res.json().catch(() => ({}));
+        throw new Error(errorData.error || `Failed to load artist summary: ${res.status}`);
+    }
+    return res.json();
+}
+
 // Radio API functions
 export async function createRadio(name, seedSongs, temperature, subtractDistance) {
     const res = await apiFetch('/api/radios', {
@@ -1,6 +1,6 @@
 // Suggested path: music-server-frontend/src/components/AudioPlayer.jsx
 import React, { useState, useEffect, useRef, useCallback } from 'react';
-import { API_BASE, apiFetch } from '../api';
+import { API_BASE, apiFetch, withCurrentToken, TOKEN_REFRESHED_EVENT } from '../api';
 import WaveSurfer from 'wavesurfer.js';
 import Hover from 'wavesurfer.js/dist/plugins/hover.esm.js';
 import Hls from 'hls.js';
@@ -28,6 +28,7 @@ function CustomAudioPlayer({ song, onEnded, credentials, onPlayNext, onPlayPrevi
     const wavesurferMobileRef = useRef(null);
     const seekDebounceRef = useRef(null);
     const isSeekingViaWaveformRef = useRef(false);
+    const resumeAtRef = useRef(null); // Position to restore after the source URL is re-minted
 
     // Effect for fetching audio data and scrobbling
     useEffect(() => {
@@ -178,6 +179,9 @@ function CustomAudioPlayer({ song, onEnded, credentials, onPlayNext, onPlayPrevi
                             // CRITICAL: Enable smooth audio transitions between segments
                             enableWorker: true,             // Use web worker for better performance
                             forceKeyFrameOnDiscontinuity: false, // Don't force keyframes (audio only)
+
+                            // Playlist and segment URLs carry the JWT; always send the current one
+                            xhrSetup: (xhr, url) => xhr.open('GET', withCurrentToken(url), true),
                         });
 
                         hls.loadSource(hlsPlaylistUrl);
@@ -608,6 +612,19 @@ function CustomAudioPlayer({ song, onEnded, credentials, onPlayNext, onPlayPrevi
 
 
     
+    // The JWT in a media URL expires with the session token; when the token is
+    // refreshed, swap in a URL with the new one and continue where playback was.
+    useEffect(() => {
+        const onTokenRefreshed = () => {
+            const audio = audioRef.current;
+            if (!audio || !audioSrc || !audioSrc.includes('jwt=')) return;
+            resumeAtRef.current = { time: audio.currentTime, playing: !audio.paused };
+            setAudioSrc(withCurrentToken(audioSrc));
+        };
+        window.addEventListener(TOKEN_REFRESHED_EVENT, onTokenRefreshed);
+        return () => window.removeEventListener(TOKEN_REFRESHED_EVENT, onTokenRefreshed);
+    }, [audioSrc]);
+
     useEffect(() => {
         if (audioSrc && audioRef.current) {
             console.log('🎵 audioSrc changed, loading new audio');
@@ -620,6 +637,20 @@ function CustomAudioPlayer({ song, onEnded, credentials, onPlayNext, onPlayPrevi
                 playPromiseRef.current = null;
             }
 
+            // Same song with a re-minted URL: restore position and play state
+            const resumeAt = resumeAtRef.current;
+            if (resumeAt) {
+                resumeAtRef.current = null;
+                const audio = audioRef.current;
+                audio.addEventListener('loadedmetadata', () => {
+                    audio.currentTime = resumeAt.time;
+                    if (resumeAt.playing) {
+                        audio.play().catch(e => console.error('Resume after token refresh failed:', e));
+                    }
+                }, { once: true });
+                return;
+            }
+
             // Check if this song was added from Map - if so, don't auto-play
             if (isMapSongRef.current) {
                 console.log('Map song detected in audioSrc effect - skipping auto-play');
@@ -1,6 +1,6 @@
 import React, { useEffect, useState, useRef, useCallback } from 'react';
 import Plotly from 'plotly.js-dist-min';
-import { apiFetch, searchMusic, subsonicFetch } from '../api';
+import { apiFetch, getSongs, searchMusic, subsonicFetch } from '../api';
 
 export default function Map({ onNavigate, onAddToQueue, onPlay, onRemoveFromQueue, onClearQueue, playQueue = [] }) {
   const [loading, setLoading] = useState(false);
@@ -440,18 +440,8 @@ export default function Map({ onNavigate, onAddToQueue, onPlay, onRemoveFromQueu
     if (!onAddToQueue || !onPlay) return alert('Playback not available');
     
     try {
-      // Fetch full song details for all selected IDs using Subsonic API
-      const songPromises = sel.map(async (id) => {
-        try {
-          const data = await subsonicFetch('getSong.view', { id });
-          return data.song || null;
-        } catch (err) {
-          console.warn('Failed to fetch song', id, err);
-          return null;
-        }
-      });
-      
-      const songs = (await Promise.all(songPromises)).filter(Boolean);
+      // Fetch full song details for all selected IDs in one getSongs.view call
+      const songs = await getSongs(sel.map(String));
       
       if (songs.length === 0) return alert('No valid songs found');
       
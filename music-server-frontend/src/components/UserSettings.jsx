@@ -12,11 +12,62 @@ export function UserSettings({ credentials }) {
     const [saving, setSaving] = useState(false);
     const [error, setError] = useState('');
     const [success, setSuccess] = useState('');
+    const [lastFm, setLastFm] = useState(null);
+    const [lastFmToken, setLastFmToken] = useState('');
 
     useEffect(() => {
         loadSettings();
+        loadLastFm();
     }, []);
 
+    const loadLastFm = async () => {
+        try {
+            const response = await apiFetch('/api/v1/user/settings/lastfm');
+            if (response.ok) setLastFm(await response.json());
+        } catch (err) {
+            // Last.fm is optional; leave the section hidden.
+        }
+    };
+
+    const lastFmRequest = async (path, method, body) => {
+        setError('');
+        try {
+            const response = await apiFetch('/api/v1/user/settings/lastfm' + path, {
+                method,
+                body: body ? JSON.stringify(body) : undefined
+            });
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Request failed');
+            return data;
+        } catch (err) {
+            setError('Last.fm: ' + err.message);
+            return null;
+        }
+    };
+
+    const connectLastFm = async () => {
+        const data = await lastFmRequest('/token', 'POST');
+        if (data) {
+            setLastFmToken(data.token);
+            window.open(data.authUrl, '_blank', 'noopener');
+        }
+    };
+
+    const finishLastFm = async () => {
+        if (await lastFmRequest('/session', 'POST', { token: lastFmToken })) {
+            setLastFmToken('');
+            loadLastFm();
+        }
+    };
+
+    const toggleLastFm = async () => {
+        if (await lastFmRequest('', 'POST', { enabled: !lastFm.enabled })) loadLastFm();
+    };
+
+    const unlinkLastFm = async () => {
+        if (await lastFmRequest('', 'DELETE')) loadLastFm();
+    };
+
     const loadSettings = async () => {
         try {
             const response = await apiFetch('/api/v1/user/settings/transcoding');
@@ -192,6 +243,54 @@ export function UserSettings({ credentials }) {
                         </div>
                     </div>
 
+                {/* Last.fm Section */}
+                {lastFm && lastFm.available && (
+                    <div className="space-y-4 mt-8">
+                        <div className="border-b border-dark-600 pb-4">
+                            <h3 className="text-xl font-semibold text-white mb-2">Last.fm Scrobbling</h3>
+                            <p className="text-sm text-gray-400">
+                                Mirror the songs you play to your Last.fm profile.
+                            </p>
+                        </div>
+                        {lastFm.linked ? (
+                            <div className="flex items-center justify-between p-4 bg-dark-750 rounded-lg">
+                                <div>
+                                    <label className="text-white font-medium">Scrobble to {lastFm.lastFmUser || 'Last.fm'}</label>
+                                    <p className="text-sm text-gray-400 mt-1">
+                                        <button onClick={unlinkLastFm} className="text-accent-400 hover:underline">Disconnect account</button>
+                                    </p>
+                                </div>
+                                <button
+                                    onClick={toggleLastFm}
+                                    className={`relative inline-flex h-8 w-14 items-center rounded-full transition-colors ${
+                                        lastFm.enabled ? 'bg-accent-500' : 'bg-dark-600'
+                                    }`}
+                                >
+                                    <span
+                                        className={`inline-block h-6 w-6 transform rounded-full bg-white transition-transform ${
+                                            lastFm.enabled ? 'translate-x-7' : 'translate-x-1'
+                                        }`}
+                                    />
+                                </button>
+                            </div>
+                        ) : (
+                            <div className="flex flex-col sm:flex-row items-start sm:items-center gap-3 p-4 bg-dark-750 rounded-lg">
+                                <p className="text-sm text-gray-400 flex-1">
+                                    {lastFmToken
+                                        ? 'Approve access in the Last.fm tab, then finish connecting here.'
+                                        : 'Connect your Last.fm account to start scrobbling.'}
+                                </p>
+                                <button
+                                    onClick={lastFmToken ? finishLastFm : connectLastFm}
+                                    className="px-4 py-2 rounded-lg bg-dark-700 hover:bg-dark-600 text-white text-sm font-semibold transition-all"
+                                >
+                                    {lastFmToken ? 'Finish connecting' : 'Connect Last.fm'}
+                                </button>
+                            </div>
+                        )}
+                    </div>
+                )}
+
                 {/* Actions */}
                 <div className="flex flex-col sm:flex-row justify-end gap-3 mt-8 pt-6 border-t border-dark-600">
                     <button 
@@ -1,14 +1,15 @@
 import React, { useState, useEffect, useCallback, useRef } from 'react';
-import { subsonicFetch, apiFetch } from '../../api';
+import { subsonicFetch, apiFetch, rescanLibraryPath } from '../../api';
 import Modal from '../Modal';
 import FileBrowser from './FileBrowser';
 
 const LibraryPathModal = ({ path, onClose, onSave }) => {
     const [currentPath, setCurrentPath] = useState(path ? path.path : '');
+    const [scanSchedule, setScanSchedule] = useState(path?.scanSchedule || '');
     const [showBrowser, setShowBrowser] = useState(false);
 
     const handleSave = () => {
-        onSave({ ...path, path: currentPath });
+        onSave({ ...path, path: currentPath, scanSchedule: scanSchedule.trim() });
     };
 
     return (
@@ -24,6 +25,14 @@ const LibraryPathModal = ({ path, onClose, onSave }) => {
                 />
                 <button onClick={() => setShowBrowser(true)} className="border-2 border-blue-500 text-blue-400 bg-blue-500/10 hover:bg-blue-500/20 hover:scale-105 transition-all font-bold py-2 px-4 rounded-lg">Browse</button>
             </div>
+            <label className="block mt-4 mb-1 text-sm text-gray-400">Scan schedule (cron, leave empty to use the global schedule)</label>
+            <input
+                type="text"
+                value={scanSchedule}
+                onChange={(e) => setScanSchedule(e.target.value)}
+                placeholder="e.g. 0 * * * *"
+                className="w-full p-2 bg-gray-700 rounded border border-gray-600 font-mono"
+            />
             <div className="flex justify-end space-x-4 mt-6">
                 <button onClick={onClose} className="border-2 border-gray-500 text-gray-400 bg-gray-500/10 hover:bg-gray-500/20 hover:scale-105 transition-all font-bold py-2 px-4 rounded-lg">Cancel</button>
                 <button onClick={handleSave} className="border-2 border-teal-500 text-teal-400 bg-teal-500/10 hover:bg-teal-500/20 hover:scale-105 transition-all font-bold py-2 px-4 rounded-lg">Save</button>
@@ -38,7 +47,7 @@ const LibraryPathModal = ({ path, onClose, onSave }) => {
 
 
 function LibraryManagement({ onConfigChange }) {
-    const [scanStatus, setScanStatus] = useState({ scanning: false, count: 0 });
+    const [scanStatus, setScanStatus] = useState({ scanning: false, count: 0, stalledAt: '' });
     const [message, setMessage] = useState('');
     const [libraryPaths, setLibraryPaths] = useState([]);
     const [editingPath, setEditingPath] = useState(null);
@@ -86,7 +95,7 @@ function LibraryManagement({ onConfigChange }) {
             const data = await subsonicApiRequest('GET', 'getScanStatus.view');
             if (data && data.scanStatus) {
                 const isScanningNow = data.scanStatus.scanning;
-                setScanStatus({ scanning: isScanningNow, count: data.scanStatus.count });
+                setScanStatus({ scanning: isScanningNow, count: data.scanStatus.count, stalledAt: data.scanStatus.stalledAt || '' });
                 if (wasScanningRef.current && !isScanningNow) {
                     fetchLibraryPaths();
                 }
@@ -119,8 +128,11 @@ function LibraryManagement({ onConfigChange }) {
         setError('');
         setScanStatus(prev => ({ ...prev, scanning: true, count: 0 }));
         try {
-            const params = pathId ? { pathId } : {};
-            await subsonicApiRequest('GET', 'startScan.view', params);
+            if (pathId) {
+                await rescanLibraryPath(pathId);
+            } else {
+                await subsonicApiRequest('GET', 'startScan.view', {});
+            }
         } catch (e) {
             setScanStatus(prev => ({ ...prev, scanning: false }));
             setError(e.message || 'Error starting scan.');
@@ -200,6 +212,12 @@ function LibraryManagement({ onConfigChange }) {
             {error && <p className="text-red-500 mb-4 p-3 bg-red-900/50 rounded">{error}</p>}
             {message && !scanStatus.scanning && <p className="text-sm text-center mb-2 p-3 bg-gray-700 rounded">{message}</p>}
 
+            {!scanStatus.scanning && scanStatus.stalledAt && (
+                <p className="text-yellow-400 mb-4 p-3 bg-yellow-900/40 rounded">
+                    The last scan stopped making progress and was cancelled at {formatDate(scanStatus.stalledAt)}. Check the scan errors and server logs for the file it was stuck on.
+                </p>
+            )}
+
             {scanStatus.scanning && (
                 <div className="text-center my-4 p-3 bg-gray-700 rounded">
                     <p>Scan in Progress... {scanStatus.count} new songs found.</p>
@@ -216,6 +234,7 @@ function LibraryManagement({ onConfigChange }) {
                             <th scope="col" className="px-6 py-3">Path</th>
                             <th scope="col" className="px-6 py-3">Songs</th>
                             <th scope="col" className="px-6 py-3">Last Scanned</th>
+                            <th scope="col" className="px-6 py-3">Schedule</th>
                             <th scope="col" className="px-6 py-3 text-right">Actions</th>
                         </tr>
                     </thead>
@@ -225,6 +244,7 @@ function LibraryManagement({ onConfigChange }) {
                                 <td className="px-6 py-4 font-mono text-white break-all">{path.path}</td>
                                 <td className="px-6 py-4">{path.songCount}</td>
                                 <td className="px-6 py-4">{formatDate(path.lastScanEnded)}</td>
+                                <td className="px-6 py-4 font-mono">{path.scanSchedule || 'Global'}</td>
                                 <td className="px-6 py-4 text-right space-x-2 whitespace-nowrap">
                                     <button onClick={() => handleStartScan(path.id)} disabled={scanStatus.scanning} className="border-2 border-green-500 text-green-400 bg-green-500/10 hover:bg-green-500/20 hover:scale-105 transition-all px-2 py-1 rounded-lg text-sm disabled:opacity-50 disabled:cursor-not-allowed disabled:hover:scale-100">Scan</button>
                                     <button onClick={() => setEditingPath(path)} disabled={scanStatus.scanning} className="border-2 border-blue-500 text-blue-400 bg-blue-500/10 hover:bg-blue-500/20 hover:scale-105 transition-all px-2 py-1 rounded-lg text-sm disabled:opacity-50 disabled:cursor-not-allowed disabled:hover:scale-100">Edit</button>
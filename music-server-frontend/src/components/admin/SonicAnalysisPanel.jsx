@@ -1,6 +1,15 @@
 import React, { useState, useEffect, useCallback } from 'react';
 import { API_BASE } from '../../api';
 import { getAuthToken } from '../../utils/tokenUtils';
+// formatEta renders a progressInfo.etaSeconds value as "1h 5m" / "4m" / "30s".
+const formatEta = (seconds) => {
+    const h = Math.floor(seconds / 3600);
+    const m = Math.floor((seconds % 3600) / 60);
+    if (h > 0) return `${h}h ${m}m`;
+    if (m > 0) return `${m}m`;
+    return `${seconds}s`;
+};
+
 function SonicAnalysisPanel() {
     const [status, setStatus] = useState(null);
     const [error, setError] = useState('');
@@ -175,6 +184,8 @@ function SonicAnalysisPanel() {
     };
 
     const isTaskRunning = status && (status.status === 'PROGRESS' || status.status === 'STARTED' || status.status === 'PENDING');
+    const progressInfo = status?.progressInfo;
+    const progressPercent = progressInfo?.percent ?? status?.progress ?? 0;
     const isAudioMuseConfigured = audioMuseConfigured === true;
 
     return (
@@ -251,9 +262,19 @@ function SonicAnalysisPanel() {
                     {isTaskRunning && (
                         <div>
                              <div className="w-full bg-gray-700 rounded-full h-2.5">
-                                <div className="bg-teal-500 h-2.5 rounded-full" style={{ width: `${status.progress || 0}%` }}></div>
+                                <div className="bg-teal-500 h-2.5 rounded-full" style={{ width: `${progressPercent}%` }}></div>
                             </div>
-                            <p className="text-center text-sm mt-1">{Math.round(status.progress || 0)}%</p>
+                            <p className="text-center text-sm mt-1">
+                                {Math.round(progressPercent)}%
+                                {progressInfo?.totalAlbums > 0 && ` · ${progressInfo.analyzed} of ${progressInfo.totalAlbums} albums`}
+                                {progressInfo?.etaSeconds > 0 && ` · about ${formatEta(progressInfo.etaSeconds)} left`}
+                            </p>
+                        </div>
+                    )}
+                    {progressInfo?.lastError && (
+                        <div>
+                            <span className="font-semibold text-gray-400">Last error: </span>
+                            <span className="text-red-400">{progressInfo.lastError}</span>
                         </div>
                     )}
                     <div>
@@ -17,3 +17,16 @@ export function getAuthHeaders() {
     const token = getAuthToken();
     return token ? { 'Authorization': `Bearer ${token}` } : {};
 }
+
+// Seconds until the stored JWT expires, or null if there is no readable token.
+export function tokenSecondsRemaining() {
+    const token = getAuthToken();
+    if (!token) return null;
+    try {
+        const payload = JSON.parse(atob(token.split('.')[1].replace(/-/g, '+').replace(/_/g, '/')));
+        if (!payload.exp) return null;
+        return payload.exp - Math.floor(Date.now() / 1000);
+    } catch {
+        return null;
+    }
+}